@@ -9,6 +9,7 @@ import (
 	"context"
 	"github.com/dgraph-io/dgo"
 	"github.com/dgraph-io/dgo/protos/api"
+	"github.com/fluidmediaproductions/central_hotel_door_server/clients"
 	"github.com/fluidmediaproductions/central_hotel_door_server/utils"
 	"github.com/gorilla/mux"
 	"github.com/spf13/viper"
@@ -24,25 +25,10 @@ const addr = ":80"
 var db *dgo.Dgraph
 var jwtSecret []byte
 
-type JWTResp struct {
-	Err string `json:"err"`
-	Jwt string `json:"jwt"`
-}
-
-type ChangePasswordResp struct {
-	Err     string `json:"err"`
-	Success bool   `json:"success"`
-}
-
-type UpdateUserResp struct {
-	Err     string `json:"err"`
-	Success bool   `json:"success"`
-}
-
-type UserInfoResp struct {
-	Err  string      `json:"err"`
-	User *utils.User `json:"user"`
-}
+type JWTResp = clients.JWTResp
+type ChangePasswordResp = clients.ChangePasswordResp
+type UpdateUserResp = clients.UpdateUserResp
+type UserInfoResp = clients.UserInfoResp
 
 func checkForPwnage(pass string) error {
 	h := sha1.New()
@@ -91,7 +77,8 @@ func loginUser(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		w.WriteHeader(http.StatusBadRequest)
 		json.NewEncoder(w).Encode(&JWTResp{
-			Err: err.Error(),
+			Err:  err.Error(),
+			Code: utils.CodeBadRequest,
 		})
 		return
 	}
@@ -108,6 +95,8 @@ func loginUser(w http.ResponseWriter, r *http.Request) {
                       uid
                       email
                       name
+                      roles
+                      disabled
                       checkpwd(pass, $pass)
 	                }
                   }`
@@ -116,7 +105,8 @@ func loginUser(w http.ResponseWriter, r *http.Request) {
 			if err != nil {
 				w.WriteHeader(http.StatusInternalServerError)
 				json.NewEncoder(w).Encode(&JWTResp{
-					Err: err.Error(),
+					Err:  err.Error(),
+					Code: utils.CodeInternal,
 				})
 				return
 			}
@@ -129,13 +119,16 @@ func loginUser(w http.ResponseWriter, r *http.Request) {
 					Email string `json:"email"`
 					Name  string `json:"name"`
 					ID    string `json:"uid"`
+					Roles []string `json:"roles"`
+					Disabled bool `json:"disabled"`
 				} `json:"login_attempt"`
 			}
 			err = json.Unmarshal(resp.GetJson(), &login)
 			if err != nil {
 				w.WriteHeader(http.StatusInternalServerError)
 				json.NewEncoder(w).Encode(&JWTResp{
-					Err: err.Error(),
+					Err:  err.Error(),
+					Code: utils.CodeInternal,
 				})
 				return
 			}
@@ -143,23 +136,35 @@ func loginUser(w http.ResponseWriter, r *http.Request) {
 			if len(login.Account) == 0 {
 				w.WriteHeader(http.StatusNotFound)
 				json.NewEncoder(w).Encode(&JWTResp{
-					Err: "user not found",
+					Err:  "user not found",
+					Code: utils.CodeNotFound,
 				})
 				return
 			}
 
 			if login.Account[0].Pass[0].CheckPwd {
+				if login.Account[0].Disabled {
+					w.WriteHeader(http.StatusForbidden)
+					json.NewEncoder(w).Encode(&JWTResp{
+						Err:  errAccountDisabled.Error(),
+						Code: utils.CodeAccountDisabled,
+					})
+					return
+				}
+
 				user := &utils.User{
 					Email: login.Account[0].Email,
 					Name:  login.Account[0].Name,
 					ID:    login.Account[0].ID,
+					Roles: login.Account[0].Roles,
 				}
 
 				jwt, err := utils.NewJWT(user, jwtSecret)
 				if err != nil {
 					w.WriteHeader(http.StatusInternalServerError)
 					json.NewEncoder(w).Encode(&JWTResp{
-						Err: err.Error(),
+						Err:  err.Error(),
+						Code: utils.CodeInternal,
 					})
 					return
 				}
@@ -170,7 +175,8 @@ func loginUser(w http.ResponseWriter, r *http.Request) {
 			} else {
 				w.WriteHeader(http.StatusForbidden)
 				json.NewEncoder(w).Encode(&JWTResp{
-					Err: "invalid password",
+					Err:  "invalid password",
+					Code: utils.CodeUnauthenticated,
 				})
 				return
 			}
@@ -178,7 +184,8 @@ func loginUser(w http.ResponseWriter, r *http.Request) {
 	}
 	w.WriteHeader(http.StatusBadRequest)
 	json.NewEncoder(w).Encode(&JWTResp{
-		Err: "bad request data",
+		Err:  "bad request data",
+		Code: utils.CodeBadRequest,
 	})
 }
 
@@ -195,7 +202,8 @@ func changePassword(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		w.WriteHeader(http.StatusBadRequest)
 		json.NewEncoder(w).Encode(&ChangePasswordResp{
-			Err: err.Error(),
+			Err:  err.Error(),
+			Code: utils.CodeBadRequest,
 		})
 		return
 	}
@@ -213,7 +221,8 @@ func changePassword(w http.ResponseWriter, r *http.Request) {
 				if err != nil {
 					w.WriteHeader(http.StatusForbidden)
 					json.NewEncoder(w).Encode(&ChangePasswordResp{
-						Err: err.Error(),
+						Err:  err.Error(),
+						Code: utils.CodeUnauthenticated,
 					})
 					return
 				}
@@ -221,40 +230,29 @@ func changePassword(w http.ResponseWriter, r *http.Request) {
 				ctx := context.Background()
 				txn := db.NewTxn()
 
-				variables := map[string]string{"$id": claims.User.Email}
-				q := `query Me($id: uid){
-                        user(func: uid($id)) @filter(has(user)) {
-                          uid
-                        }
-                      }`
-
-				resp, err := txn.QueryWithVars(ctx, q, variables)
-				if err != nil {
-					w.WriteHeader(http.StatusInternalServerError)
+				account, err := getAccount(ctx, txn, claims.User.ID)
+				if err == errUserNotFound {
+					w.WriteHeader(http.StatusNotFound)
 					json.NewEncoder(w).Encode(&ChangePasswordResp{
-						Err: err.Error(),
+						Err:  err.Error(),
+						Code: utils.CodeNotFound,
 					})
 					return
-				}
-
-				var user struct {
-					Account []struct {
-						ID string `json:"uid"`
-					} `json:"user"`
-				}
-				err = json.Unmarshal(resp.GetJson(), &user)
-				if err != nil {
+				} else if err != nil {
 					w.WriteHeader(http.StatusInternalServerError)
 					json.NewEncoder(w).Encode(&ChangePasswordResp{
-						Err: err.Error(),
+						Err:  err.Error(),
+						Code: utils.CodeInternal,
 					})
 					return
 				}
 
-				if len(user.Account) == 0 {
-					w.WriteHeader(http.StatusNotFound)
+				code, err := checkSession(account, claims)
+				if err != nil {
+					w.WriteHeader(http.StatusForbidden)
 					json.NewEncoder(w).Encode(&ChangePasswordResp{
-						Err: "user not found",
+						Err:  err.Error(),
+						Code: code,
 					})
 					return
 				}
@@ -263,36 +261,41 @@ func changePassword(w http.ResponseWriter, r *http.Request) {
 				if err != nil {
 					w.WriteHeader(http.StatusBadRequest)
 					json.NewEncoder(w).Encode(&ChangePasswordResp{
-						Err: err.Error(),
+						Err:  err.Error(),
+						Code: utils.CodeBadRequest,
 					})
 					return
 				}
 
 				var mutation struct {
-					ID   string `json:"uid"`
-					Pass string `json:"pass"`
+					ID            string `json:"uid"`
+					Pass          string `json:"pass"`
+					MustResetPass bool   `json:"mustResetPass"`
 				}
-				mutation.ID = claims.User.ID
+				mutation.ID = account.ID
 				mutation.Pass = pass
 
 				mutData, err := json.Marshal(&mutation)
 				if err != nil {
 					w.WriteHeader(http.StatusInternalServerError)
 					json.NewEncoder(w).Encode(&ChangePasswordResp{
-						Err: err.Error(),
+						Err:  err.Error(),
+						Code: utils.CodeInternal,
 					})
 					return
 				}
 
 				mu := &api.Mutation{
-					SetJson: mutData,
+					SetJson:   mutData,
+					CommitNow: true,
 				}
 
 				_, err = txn.Mutate(ctx, mu)
 				if err != nil {
 					w.WriteHeader(http.StatusInternalServerError)
 					json.NewEncoder(w).Encode(&ChangePasswordResp{
-						Err: err.Error(),
+						Err:  err.Error(),
+						Code: utils.CodeInternal,
 					})
 					return
 				}
@@ -305,12 +308,14 @@ func changePassword(w http.ResponseWriter, r *http.Request) {
 		}
 		w.WriteHeader(http.StatusForbidden)
 		json.NewEncoder(w).Encode(&ChangePasswordResp{
-			Err: "no auth header",
+			Err:  "no auth header",
+			Code: utils.CodeUnauthenticated,
 		})
 	}
 	w.WriteHeader(http.StatusBadRequest)
 	json.NewEncoder(w).Encode(&ChangePasswordResp{
-		Err: "bad request data",
+		Err:  "bad request data",
+		Code: utils.CodeBadRequest,
 	})
 }
 
@@ -327,7 +332,8 @@ func updateUser(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		w.WriteHeader(http.StatusBadRequest)
 		json.NewEncoder(w).Encode(&JWTResp{
-			Err: err.Error(),
+			Err:  err.Error(),
+			Code: utils.CodeBadRequest,
 		})
 		return
 	}
@@ -341,7 +347,8 @@ func updateUser(w http.ResponseWriter, r *http.Request) {
 			if err != nil {
 				w.WriteHeader(http.StatusForbidden)
 				json.NewEncoder(w).Encode(&UpdateUserResp{
-					Err: err.Error(),
+					Err:  err.Error(),
+					Code: utils.CodeUnauthenticated,
 				})
 				return
 			}
@@ -349,54 +356,64 @@ func updateUser(w http.ResponseWriter, r *http.Request) {
 			ctx := context.Background()
 			txn := db.NewTxn()
 
-			variables := map[string]string{"$id": claims.User.Email}
-			q := `query Me($id: uid){
-                        user(func: uid($id)) @filter(has(user)) {
-                          uid
-                        }
-                      }`
-
-			resp, err := txn.QueryWithVars(ctx, q, variables)
-			if err != nil {
-				w.WriteHeader(http.StatusInternalServerError)
-				json.NewEncoder(w).Encode(&JWTResp{
-					Err: err.Error(),
+			account, err := getAccount(ctx, txn, claims.User.ID)
+			if err == errUserNotFound {
+				w.WriteHeader(http.StatusNotFound)
+				json.NewEncoder(w).Encode(&UpdateUserResp{
+					Err:  err.Error(),
+					Code: utils.CodeNotFound,
 				})
 				return
-			}
-
-			var user struct {
-				Account []struct {
-					ID string `json:"uid"`
-				} `json:"user"`
-			}
-			err = json.Unmarshal(resp.GetJson(), &user)
-			if err != nil {
+			} else if err != nil {
 				w.WriteHeader(http.StatusInternalServerError)
-				json.NewEncoder(w).Encode(&JWTResp{
-					Err: err.Error(),
+				json.NewEncoder(w).Encode(&UpdateUserResp{
+					Err:  err.Error(),
+					Code: utils.CodeInternal,
 				})
 				return
 			}
 
-			if len(user.Account) == 0 {
-				w.WriteHeader(http.StatusNotFound)
-				json.NewEncoder(w).Encode(&JWTResp{
-					Err: "user not found",
+			code, err := checkSession(account, claims)
+			if err != nil {
+				w.WriteHeader(http.StatusForbidden)
+				json.NewEncoder(w).Encode(&UpdateUserResp{
+					Err:  err.Error(),
+					Code: code,
 				})
 				return
 			}
 
 			var mutation struct {
-				ID    string `json:"uid"`
-				Name  string `json:"name,omitempty"`
-				Email string `json:"email,omitempty"`
+				ID            string `json:"uid"`
+				Name          string `json:"name,omitempty"`
+				Email         string `json:"email,omitempty"`
+				EmailVerified *bool  `json:"emailVerified,omitempty"`
 			}
-			mutation.ID = user.Account[0].ID
+			mutation.ID = account.ID
 
 			email, isOk := data["email"].(string)
-			if isOk {
+			if isOk && email != account.Email {
+				taken, err := emailTaken(ctx, txn, email, account.ID)
+				if err != nil {
+					w.WriteHeader(http.StatusInternalServerError)
+					json.NewEncoder(w).Encode(&UpdateUserResp{
+						Err:  err.Error(),
+						Code: utils.CodeInternal,
+					})
+					return
+				}
+				if taken {
+					w.WriteHeader(http.StatusConflict)
+					json.NewEncoder(w).Encode(&UpdateUserResp{
+						Err:  errEmailTaken.Error(),
+						Code: utils.CodeConflict,
+					})
+					return
+				}
+				// A new email hasn't been checked yet
+				verified := false
 				mutation.Email = email
+				mutation.EmailVerified = &verified
 			}
 			name, isOk := data["name"].(string)
 			if isOk {
@@ -407,20 +424,23 @@ func updateUser(w http.ResponseWriter, r *http.Request) {
 			if err != nil {
 				w.WriteHeader(http.StatusInternalServerError)
 				json.NewEncoder(w).Encode(&JWTResp{
-					Err: err.Error(),
+					Err:  err.Error(),
+					Code: utils.CodeInternal,
 				})
 				return
 			}
 
 			mu := &api.Mutation{
-				SetJson: mutData,
+				SetJson:   mutData,
+				CommitNow: true,
 			}
 
 			_, err = txn.Mutate(ctx, mu)
 			if err != nil {
 				w.WriteHeader(http.StatusInternalServerError)
 				json.NewEncoder(w).Encode(&JWTResp{
-					Err: err.Error(),
+					Err:  err.Error(),
+					Code: utils.CodeInternal,
 				})
 				return
 			}
@@ -433,7 +453,8 @@ func updateUser(w http.ResponseWriter, r *http.Request) {
 	}
 	w.WriteHeader(http.StatusForbidden)
 	json.NewEncoder(w).Encode(&UpdateUserResp{
-		Err: "no auth header",
+		Err:  "no auth header",
+		Code: utils.CodeUnauthenticated,
 	})
 }
 
@@ -448,7 +469,8 @@ func userInfo(w http.ResponseWriter, r *http.Request) {
 			if err != nil {
 				w.WriteHeader(http.StatusForbidden)
 				json.NewEncoder(w).Encode(&UserInfoResp{
-					Err: err.Error(),
+					Err:  err.Error(),
+					Code: utils.CodeUnauthenticated,
 				})
 				return
 			}
@@ -456,52 +478,41 @@ func userInfo(w http.ResponseWriter, r *http.Request) {
 			ctx := context.Background()
 			txn := db.NewTxn()
 
-			variables := map[string]string{"$id": claims.User.Email}
-			q := `query Me($id: uid){
-                        user(func: uid($id)) @filter(has(user)) {
-                          uid
-                          email
-                          name
-                        }
-                      }`
-
-			resp, err := txn.QueryWithVars(ctx, q, variables)
-			if err != nil {
-				w.WriteHeader(http.StatusInternalServerError)
-				json.NewEncoder(w).Encode(&JWTResp{
-					Err: err.Error(),
+			account, err := getAccount(ctx, txn, claims.User.ID)
+			if err == errUserNotFound {
+				w.WriteHeader(http.StatusNotFound)
+				json.NewEncoder(w).Encode(&UserInfoResp{
+					Err:  err.Error(),
+					Code: utils.CodeNotFound,
 				})
 				return
-			}
-
-			var user struct {
-				Account []struct {
-					ID    string `json:"uid"`
-					Email string `json:"email"`
-					Name  string `json:"name"`
-				} `json:"user"`
-			}
-			err = json.Unmarshal(resp.GetJson(), &user)
-			if err != nil {
+			} else if err != nil {
 				w.WriteHeader(http.StatusInternalServerError)
-				json.NewEncoder(w).Encode(&JWTResp{
-					Err: err.Error(),
+				json.NewEncoder(w).Encode(&UserInfoResp{
+					Err:  err.Error(),
+					Code: utils.CodeInternal,
 				})
 				return
 			}
 
-			if len(user.Account) == 0 {
-				w.WriteHeader(http.StatusNotFound)
-				json.NewEncoder(w).Encode(&JWTResp{
-					Err: "user not found",
+			code, err := checkSession(account, claims)
+			if err == nil && account.MustResetPass {
+				code, err = utils.CodePasswordReset, errPasswordReset
+			}
+			if err != nil {
+				w.WriteHeader(http.StatusForbidden)
+				json.NewEncoder(w).Encode(&UserInfoResp{
+					Err:  err.Error(),
+					Code: code,
 				})
 				return
 			}
 
 			userResp := &utils.User{
-				ID:    user.Account[0].ID,
-				Email: user.Account[0].Email,
-				Name:  user.Account[0].Name,
+				ID:    account.ID,
+				Email: account.Email,
+				Name:  account.Name,
+				Roles: account.Roles,
 			}
 
 			json.NewEncoder(w).Encode(&UserInfoResp{
@@ -512,7 +523,8 @@ func userInfo(w http.ResponseWriter, r *http.Request) {
 	}
 	w.WriteHeader(http.StatusForbidden)
 	json.NewEncoder(w).Encode(&UserInfoResp{
-		Err: "no auth header",
+		Err:  "no auth header",
+		Code: utils.CodeUnauthenticated,
 	})
 }
 
@@ -523,6 +535,13 @@ func router() *mux.Router {
 	r.Methods("POST").Path("/changePassword").HandlerFunc(changePassword)
 	r.Methods("POST").Path("/updateUser").HandlerFunc(updateUser)
 	r.Methods("GET").Path("/userInfo").HandlerFunc(userInfo)
+	r.Methods("GET").Path("/users").HandlerFunc(searchUsers)
+	r.Methods("GET").Path("/users/{id}").HandlerFunc(getUserAccount)
+	r.Methods("POST").Path("/users/{id}/disable").HandlerFunc(disableUser)
+	r.Methods("POST").Path("/users/{id}/enable").HandlerFunc(enableUser)
+	r.Methods("POST").Path("/users/{id}/revoke-sessions").HandlerFunc(revokeSessions)
+	r.Methods("POST").Path("/users/{id}/force-reset").HandlerFunc(forcePasswordReset)
+	r.Methods("POST").Path("/users/{id}/verify-email").HandlerFunc(verifyEmail)
 
 	return r
 }
@@ -541,10 +560,15 @@ func newDbClient(dbHost string) *dgo.Dgraph {
 func setup(c *dgo.Dgraph) {
 	err := c.Alter(context.Background(), &api.Operation{
 		Schema: `
-			name: string .
+			name: string @index(term) .
 			email: string @index(hash) @upsert .
             pass: password .
-		`,
+			roles: [string] .
+			disabled: bool .
+			mustResetPass: bool .
+			emailVerified: bool .
+			sessionsValidAfter: dateTime .
+		` + utils.AuditSchema,
 	})
 	if err != nil {
 		log.Fatalf("Error setting up schema: %v\n", err)
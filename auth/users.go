@@ -0,0 +1,328 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dgraph-io/dgo"
+	"github.com/dgraph-io/dgo/protos/api"
+	"github.com/fluidmediaproductions/central_hotel_door_server/clients"
+	"github.com/fluidmediaproductions/central_hotel_door_server/utils"
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+)
+
+type UserAccount = clients.UserAccount
+type UserAccountResp = clients.UserAccountResp
+type UserAccountsResp = clients.UserAccountsResp
+
+var errUserNotFound = errors.New("user not found")
+var errNotAllowed = errors.New("your roles don't allow managing users")
+var errAccountDisabled = errors.New("account disabled")
+var errSessionRevoked = errors.New("session revoked")
+var errPasswordReset = errors.New("password reset required")
+var errEmailTaken = errors.New("email already in use")
+
+// Support staff can look users up and turn their accounts on and off, only
+// admins can end sessions and force password resets.
+var supportRoles = []string{utils.RoleAdmin, utils.RoleSupport}
+var adminRoles = []string{utils.RoleAdmin}
+
+const accountFields = `uid
+                      email
+                      name
+                      roles
+                      disabled
+                      mustResetPass
+                      emailVerified
+                      sessionsValidAfter`
+
+type accountQuery struct {
+	Users []*UserAccount `json:"users"`
+}
+
+func getAccount(ctx context.Context, txn *dgo.Txn, id string) (*UserAccount, error) {
+	q := `query q($id: string) {
+                    users(func: uid($id)) @filter(has(user)) {
+                      ` + accountFields + `
+	                }
+                  }`
+	resp, err := txn.QueryWithVars(ctx, q, map[string]string{"$id": id})
+	if err != nil {
+		return nil, err
+	}
+	var accounts accountQuery
+	err = json.Unmarshal(resp.GetJson(), &accounts)
+	if err != nil {
+		return nil, err
+	}
+	if len(accounts.Users) == 0 {
+		return nil, errUserNotFound
+	}
+	return accounts.Users[0], nil
+}
+
+// emailTaken is whether a user other than the one with the uid id already
+// has an email.
+func emailTaken(ctx context.Context, txn *dgo.Txn, email string, id string) (bool, error) {
+	q := `query q($email: string) {
+                    users(func: eq(email, $email)) @filter(has(user)) {
+                      uid
+	                }
+                  }`
+	resp, err := txn.QueryWithVars(ctx, q, map[string]string{"$email": email})
+	if err != nil {
+		return false, err
+	}
+	var accounts accountQuery
+	err = json.Unmarshal(resp.GetJson(), &accounts)
+	if err != nil {
+		return false, err
+	}
+	for _, account := range accounts.Users {
+		if account.ID != id {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// checkSession makes sure a token can still be used for an account. Tokens
+// issued at or before the account's sessions were revoked are turned away.
+func checkSession(account *UserAccount, claims *utils.JWTClaims) (string, error) {
+	if account.Disabled {
+		return utils.CodeAccountDisabled, errAccountDisabled
+	}
+	if account.SessionsValidAfter != nil && claims.IssuedAt <= account.SessionsValidAfter.Unix() {
+		return utils.CodeUnauthenticated, errSessionRevoked
+	}
+	return "", nil
+}
+
+func getStaffClaims(r *http.Request, roles []string) (*utils.JWTClaims, error) {
+	claims, err := utils.GetRequestJWT(r, jwtSecret)
+	if err != nil {
+		return nil, err
+	}
+	if !claims.User.HasRole(roles...) {
+		return nil, errNotAllowed
+	}
+	return claims, nil
+}
+
+func writeStaffAuthError(w http.ResponseWriter, err error) {
+	code := utils.CodeUnauthenticated
+	if err == errNotAllowed {
+		code = utils.CodeForbidden
+	}
+	w.WriteHeader(http.StatusForbidden)
+	json.NewEncoder(w).Encode(&UserAccountResp{
+		Err:  err.Error(),
+		Code: code,
+	})
+}
+
+func writeAccountError(w http.ResponseWriter, status int, err error) {
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(&UserAccountResp{
+		Err:  err.Error(),
+		Code: utils.StatusCode(status),
+	})
+}
+
+func writeAudit(ctx context.Context, txn *dgo.Txn, entry *utils.AuditEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	_, err = txn.Mutate(ctx, &api.Mutation{SetJson: data})
+	return err
+}
+
+// searchUsers finds users by their exact email, or any of the words of
+// their name, given in the q query parameter. With no q every user is listed.
+func searchUsers(w http.ResponseWriter, r *http.Request) {
+	_, err := getStaffClaims(r, supportRoles)
+	if err != nil {
+		writeStaffAuthError(w, err)
+		return
+	}
+
+	ctx := context.Background()
+	txn := db.NewTxn()
+
+	search := strings.TrimSpace(r.URL.Query().Get("q"))
+	variables := map[string]string{}
+	q := `query {
+                    users(func: has(user), orderasc: email) {
+                      ` + accountFields + `
+	                }
+                  }`
+	if search != "" {
+		variables["$q"] = search
+		q = `query q($q: string) {
+                    var(func: eq(email, $q)) {
+                      e as uid
+                    }
+                    var(func: anyofterms(name, $q)) {
+                      n as uid
+                    }
+                    users(func: uid(e, n), orderasc: email) @filter(has(user)) {
+                      ` + accountFields + `
+	                }
+                  }`
+	}
+
+	resp, err := txn.QueryWithVars(ctx, q, variables)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(&UserAccountsResp{
+			Err:  err.Error(),
+			Code: utils.CodeInternal,
+		})
+		return
+	}
+	var accounts accountQuery
+	err = json.Unmarshal(resp.GetJson(), &accounts)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(&UserAccountsResp{
+			Err:  err.Error(),
+			Code: utils.CodeInternal,
+		})
+		return
+	}
+
+	users := accounts.Users
+	if users == nil {
+		users = make([]*UserAccount, 0)
+	}
+	json.NewEncoder(w).Encode(&UserAccountsResp{
+		Users: users,
+	})
+}
+
+func getUserAccount(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	_, err := getStaffClaims(r, supportRoles)
+	if err != nil {
+		writeStaffAuthError(w, err)
+		return
+	}
+
+	account, err := getAccount(context.Background(), db.NewTxn(), id)
+	if err == errUserNotFound {
+		writeAccountError(w, http.StatusNotFound, err)
+		return
+	} else if err != nil {
+		writeAccountError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(&UserAccountResp{
+		User: account,
+	})
+}
+
+// setAccountState changes the predicates in state on the account in the
+// URL, if the requester has one of roles, and audits it as action.
+func setAccountState(w http.ResponseWriter, r *http.Request, roles []string, action string, state map[string]interface{}) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	claims, err := getStaffClaims(r, roles)
+	if err != nil {
+		writeStaffAuthError(w, err)
+		return
+	}
+	if id == claims.User.ID {
+		writeAccountError(w, http.StatusBadRequest, errors.New("you can't change the state of your own account"))
+		return
+	}
+
+	ctx := context.Background()
+	txn := db.NewTxn()
+	defer txn.Discard(ctx)
+
+	_, err = getAccount(ctx, txn, id)
+	if err == errUserNotFound {
+		writeAccountError(w, http.StatusNotFound, err)
+		return
+	} else if err != nil {
+		writeAccountError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	node := map[string]interface{}{
+		"uid": id,
+	}
+	for predicate, value := range state {
+		node[predicate] = value
+	}
+	mutData, err := json.Marshal(node)
+	if err == nil {
+		_, err = txn.Mutate(ctx, &api.Mutation{SetJson: mutData})
+	}
+	if err == nil {
+		err = writeAudit(ctx, txn, utils.NewAuditEntry(action, claims.User.ID, id, ""))
+	}
+	if err == nil {
+		err = txn.Commit(ctx)
+	}
+	if err != nil {
+		writeAccountError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	account, err := getAccount(ctx, db.NewTxn(), id)
+	if err != nil {
+		writeAccountError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(&UserAccountResp{
+		User: account,
+	})
+}
+
+func disableUser(w http.ResponseWriter, r *http.Request) {
+	setAccountState(w, r, supportRoles, "user.disabled", map[string]interface{}{
+		"disabled": true,
+	})
+}
+
+func enableUser(w http.ResponseWriter, r *http.Request) {
+	setAccountState(w, r, supportRoles, "user.enabled", map[string]interface{}{
+		"disabled": false,
+	})
+}
+
+// revokeSessions logs a user out everywhere, as tokens issued until now stop
+// working.
+func revokeSessions(w http.ResponseWriter, r *http.Request) {
+	setAccountState(w, r, adminRoles, "user.sessionsRevoked", map[string]interface{}{
+		"sessionsValidAfter": time.Now(),
+	})
+}
+
+// verifyEmail marks a user's email as checked by staff, so it can be used to
+// match them to bookings from a PMS.
+func verifyEmail(w http.ResponseWriter, r *http.Request) {
+	setAccountState(w, r, supportRoles, "user.emailVerified", map[string]interface{}{
+		"emailVerified": true,
+	})
+}
+
+// forcePasswordReset logs a user out everywhere, and has them change their
+// password before they can do anything else once they log back in.
+func forcePasswordReset(w http.ResponseWriter, r *http.Request) {
+	setAccountState(w, r, adminRoles, "user.passwordResetForced", map[string]interface{}{
+		"mustResetPass":      true,
+		"sessionsValidAfter": time.Now(),
+	})
+}
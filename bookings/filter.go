@@ -0,0 +1,100 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/fluidmediaproductions/central_hotel_door_server/clients"
+	"github.com/fluidmediaproductions/central_hotel_door_server/utils"
+	"github.com/pkg/errors"
+)
+
+// bookingFilter is the page and filters passed to a list of bookings.
+type bookingFilter struct {
+	page   *utils.Page
+	from   *time.Time
+	to     *time.Time
+	status string
+	state  string
+}
+
+func parseTimeParam(query url.Values, name string) (*time.Time, error) {
+	value := query.Get(name)
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, errors.Errorf("invalid %s %q", name, value)
+	}
+	return &t, nil
+}
+
+func parseBookingFilter(query url.Values) (*bookingFilter, error) {
+	page, err := utils.ParsePage(query)
+	if err != nil {
+		return nil, err
+	}
+	filter := &bookingFilter{
+		page:   page,
+		status: query.Get("status"),
+		state:  query.Get("state"),
+	}
+	filter.from, err = parseTimeParam(query, "from")
+	if err != nil {
+		return nil, err
+	}
+	filter.to, err = parseTimeParam(query, "to")
+	if err != nil {
+		return nil, err
+	}
+	switch filter.status {
+	case "", clients.BookingUpcoming, clients.BookingActive, clients.BookingPast:
+	default:
+		return nil, errors.Errorf("invalid status %q", filter.status)
+	}
+	if _, isOk := statusTimes[filter.state]; filter.state != "" && filter.state != clients.BookingConfirmed && !isOk {
+		return nil, errors.Errorf("invalid state %q", filter.state)
+	}
+	return filter, nil
+}
+
+// openFilter leaves out bookings that have been finished with, which don't
+// count as upcoming or active whatever their dates.
+const openFilter = `(` + confirmedFilter + ` OR eq(booking.status, "` + clients.BookingCheckedIn + `"))`
+
+// dgraphFilter builds the @filter for the bookings, adding the values it
+// needs to the query's variables.
+func (f *bookingFilter) dgraphFilter(variables map[string]string, now time.Time) string {
+	var conds []string
+	if f.from != nil {
+		variables["$from"] = f.from.Format(time.RFC3339)
+		conds = append(conds, "ge(booking.end, $from)")
+	}
+	if f.to != nil {
+		variables["$to"] = f.to.Format(time.RFC3339)
+		conds = append(conds, "le(booking.start, $to)")
+	}
+	if f.status != "" {
+		variables["$now"] = now.Format(time.RFC3339)
+		switch f.status {
+		case clients.BookingUpcoming:
+			conds = append(conds, "gt(booking.start, $now)", openFilter)
+		case clients.BookingActive:
+			conds = append(conds, "le(booking.start, $now) AND ge(booking.end, $now)", openFilter)
+		case clients.BookingPast:
+			conds = append(conds, "lt(booking.end, $now)")
+		}
+	}
+	if f.state == clients.BookingConfirmed {
+		conds = append(conds, confirmedFilter)
+	} else if f.state != "" {
+		variables["$state"] = f.state
+		conds = append(conds, "eq(booking.status, $state)")
+	}
+	if len(conds) == 0 {
+		return ""
+	}
+	return "@filter(" + strings.Join(conds, " AND ") + ")"
+}
@@ -0,0 +1,477 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dgraph-io/dgo"
+	"github.com/dgraph-io/dgo/protos/api"
+	"github.com/fluidmediaproductions/central_hotel_door_server/clients"
+	"github.com/fluidmediaproductions/central_hotel_door_server/utils"
+	"github.com/gorilla/mux"
+)
+
+var HotelsServer = "http://hotels"
+
+var hotelsClient = clients.NewHotelsClient(HotelsServer)
+
+type Folio = clients.Folio
+type FolioLine = clients.FolioLine
+type FolioResp = clients.FolioResp
+type FolioExtra = clients.FolioExtra
+type FolioPayment = clients.FolioPayment
+
+const folioFields = `booking.folio (orderasc: folio.postedAt) {
+                uid
+                folio.kind
+                folio.description
+                folio.quantity
+                folio.unitAmount
+                folio.amount
+                folio.method
+                folio.reference
+                folio.postedAt
+                folio.postedBy {
+                  uid
+                }
+              }`
+
+type folioEntryQuery struct {
+	ID          string    `json:"uid"`
+	Kind        string    `json:"folio.kind"`
+	Description string    `json:"folio.description"`
+	Quantity    int       `json:"folio.quantity"`
+	UnitAmount  int64     `json:"folio.unitAmount"`
+	Amount      int64     `json:"folio.amount"`
+	Method      string    `json:"folio.method"`
+	Reference   string    `json:"folio.reference"`
+	PostedAt    time.Time `json:"folio.postedAt"`
+	PostedBy    []struct {
+		ID string `json:"uid"`
+	} `json:"folio.postedBy"`
+}
+
+func (e *folioEntryQuery) toLine(loc *time.Location) *FolioLine {
+	line := &FolioLine{
+		ID:          e.ID,
+		Kind:        e.Kind,
+		Date:        e.PostedAt.In(loc).Format(clients.DateLayout),
+		Description: e.Description,
+		Quantity:    e.Quantity,
+		UnitAmount:  e.UnitAmount,
+		Amount:      e.Amount,
+		Method:      e.Method,
+		Reference:   e.Reference,
+		PostedAt:    e.PostedAt,
+	}
+	if len(e.PostedBy) > 0 {
+		line.PostedBy = e.PostedBy[0].ID
+	}
+	return line
+}
+
+// folioSource is everything a folio is made from.
+type folioSource struct {
+	booking    *Booking
+	hotel      *clients.Hotel
+	guestName  string
+	guestEmail string
+	lines      []*FolioLine
+}
+
+// getFolioSource gets the lines posted to a booking, its guest and its hotel.
+func getFolioSource(ctx context.Context, txn *dgo.Txn, booking *Booking) (*folioSource, error) {
+	q := `query q($id: string) {
+            bookings(func: uid($id)) @filter(has(booking)) {
+              booking.user {
+                name
+                email
+              }
+              ` + folioFields + `
+            }
+          }`
+
+	resp, err := txn.QueryWithVars(ctx, q, map[string]string{"$id": booking.ID})
+	if err != nil {
+		return nil, err
+	}
+	var bookings struct {
+		Bookings []struct {
+			User []struct {
+				Name  string `json:"name"`
+				Email string `json:"email"`
+			} `json:"booking.user"`
+			Folio []*folioEntryQuery `json:"booking.folio"`
+		} `json:"bookings"`
+	}
+	err = json.Unmarshal(resp.GetJson(), &bookings)
+	if err != nil {
+		return nil, err
+	}
+	if len(bookings.Bookings) == 0 {
+		return nil, errBookingNotFound
+	}
+
+	hotel, err := hotelsClient.GetHotel(ctx, booking.HotelID)
+	if err != nil {
+		return nil, err
+	}
+
+	source := &folioSource{
+		booking: booking,
+		hotel:   hotel,
+	}
+	if users := bookings.Bookings[0].User; len(users) > 0 {
+		source.guestName = users[0].Name
+		source.guestEmail = users[0].Email
+	}
+	for _, entry := range bookings.Bookings[0].Folio {
+		source.lines = append(source.lines, entry.toLine(hotel.Zone()))
+	}
+	return source, nil
+}
+
+// folio totals up a booking's account. Bookings without a price only have
+// what's been posted to them.
+func (s *folioSource) folio(now time.Time) *Folio {
+	folio := &Folio{
+		BookingID:  s.booking.ID,
+		HotelID:    s.booking.HotelID,
+		GuestName:  s.guestName,
+		GuestEmail: s.guestEmail,
+		Start:      s.booking.Start,
+		End:        s.booking.End,
+		Charges:    make([]*FolioLine, 0),
+		Taxes:      make([]*clients.QuoteTax, 0),
+		Payments:   make([]*FolioLine, 0),
+		IssuedAt:   now,
+	}
+	if s.hotel != nil {
+		folio.HotelName = s.hotel.Name
+		folio.HotelAddress = s.hotel.Address
+		folio.TimeZone = s.hotel.TimeZone
+	}
+
+	if price := s.booking.Price; price != nil {
+		folio.Currency = price.Currency
+		for _, night := range price.Nights {
+			description := "Room"
+			if night.Season != "" {
+				description = fmt.Sprintf("Room, %s", night.Season)
+			}
+			folio.Charges = append(folio.Charges, &FolioLine{
+				Kind:        clients.FolioLineNight,
+				Date:        night.Date,
+				Description: description,
+				Quantity:    1,
+				UnitAmount:  night.Amount,
+				Amount:      night.Amount,
+				PostedAt:    price.QuotedAt,
+			})
+			folio.ChargeTotal += night.Amount
+		}
+		for _, tax := range price.Taxes {
+			folio.Taxes = append(folio.Taxes, tax)
+			folio.TaxTotal += tax.Amount
+		}
+	}
+
+	for _, line := range s.lines {
+		switch line.Kind {
+		case clients.FolioLineExtra:
+			folio.Charges = append(folio.Charges, line)
+			folio.ChargeTotal += line.Amount
+		case clients.FolioLinePayment:
+			folio.Payments = append(folio.Payments, line)
+			folio.Paid += line.Amount
+		case clients.FolioLineRefund:
+			folio.Payments = append(folio.Payments, line)
+			folio.Paid -= line.Amount
+		}
+	}
+
+	folio.Total = folio.ChargeTotal + folio.TaxTotal
+	folio.Balance = folio.Total - folio.Paid
+	return folio
+}
+
+// folioEntry is the node a folio line is saved as. Lines the system posts,
+// like refunds for cancellations, aren't posted by anyone.
+func folioEntry(line *FolioLine, userId string) map[string]interface{} {
+	entry := map[string]interface{}{
+		"uid":               "_:entry",
+		"folio.kind":        line.Kind,
+		"folio.description": line.Description,
+		"folio.quantity":    line.Quantity,
+		"folio.unitAmount":  line.UnitAmount,
+		"folio.amount":      line.Amount,
+		"folio.postedAt":    line.PostedAt,
+	}
+	if userId != "" {
+		entry["folio.postedBy"] = &utils.UIDRef{ID: userId}
+	}
+	if line.Method != "" {
+		entry["folio.method"] = line.Method
+	}
+	if line.Reference != "" {
+		entry["folio.reference"] = line.Reference
+	}
+	return entry
+}
+
+// postFolioLine adds a line to a booking's folio, committing the transaction.
+func postFolioLine(ctx context.Context, txn *dgo.Txn, source *folioSource, line *FolioLine, userId string) error {
+	entry := folioEntry(line, userId)
+	detail := fmt.Sprintf("%s of %d %s", line.Description, line.Amount, source.booking.Price.Currency)
+
+	mutData, err := json.Marshal([]interface{}{
+		map[string]interface{}{
+			"uid":           source.booking.ID,
+			"booking.folio": entry,
+		},
+		utils.NewAuditEntry("booking.folio_"+line.Kind, userId, source.booking.ID, detail),
+	})
+	if err != nil {
+		return err
+	}
+	assigned, err := txn.Mutate(ctx, &api.Mutation{SetJson: mutData})
+	if err == nil {
+		err = txn.Commit(ctx)
+	}
+	if err != nil {
+		return err
+	}
+
+	line.ID = assigned.Uids["entry"]
+	line.PostedBy = userId
+	line.Date = line.PostedAt.In(source.hotel.Zone()).Format(clients.DateLayout)
+	source.lines = append(source.lines, line)
+	return nil
+}
+
+// checkExtra tidies up an extra, defaulting to one of it.
+func checkExtra(extra *FolioExtra) error {
+	extra.Description = strings.TrimSpace(extra.Description)
+	if extra.Description == "" {
+		return fmt.Errorf("extras need a description")
+	}
+	if extra.Quantity == 0 {
+		extra.Quantity = 1
+	}
+	if extra.Quantity < 0 {
+		return fmt.Errorf("quantity can't be negative")
+	}
+	if extra.UnitAmount < 0 {
+		return fmt.Errorf("unit amount can't be negative")
+	}
+	return nil
+}
+
+// checkPayment tidies up a payment. Methods are free text, like "cash".
+func checkPayment(payment *FolioPayment) error {
+	payment.Method = strings.ToLower(strings.TrimSpace(payment.Method))
+	payment.Reference = strings.TrimSpace(payment.Reference)
+	if payment.Method == "" {
+		return fmt.Errorf("payments need a method")
+	}
+	if payment.Amount <= 0 {
+		return fmt.Errorf("payments have to be more than nothing")
+	}
+	return nil
+}
+
+func writeFolioError(w http.ResponseWriter, err error) {
+	if clients.IsNotFound(err) {
+		err = &statusError{
+			status:  http.StatusNotFound,
+			code:    utils.CodeNotFound,
+			message: "hotel not found",
+		}
+	}
+	writeStatusError(w, err)
+}
+
+// openFolio gets a booking's folio source for its owner, or for staff.
+func openFolio(w http.ResponseWriter, r *http.Request, ctx context.Context, txn *dgo.Txn) (*utils.JWTClaims, *folioSource, bool) {
+	claims, err := utils.GetRequestJWT(r, jwtSecret)
+	if err != nil {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(&FolioResp{
+			Err:  err.Error(),
+			Code: utils.CodeUnauthenticated,
+		})
+		return nil, nil, false
+	}
+
+	vars := mux.Vars(r)
+
+	id := vars["id"]
+
+	booking, err := getBookingByID(ctx, txn, id)
+	if err != nil {
+		writeFolioError(w, err)
+		return nil, nil, false
+	}
+	if !claims.User.HasRole(staffRoles...) && booking.UserID != claims.User.ID {
+		writeFolioError(w, errBookingNotFound)
+		return nil, nil, false
+	}
+
+	source, err := getFolioSource(ctx, txn, booking)
+	if err != nil {
+		writeFolioError(w, err)
+		return nil, nil, false
+	}
+	return claims, source, true
+}
+
+// getFolio gets a booking's folio, for its owner or staff.
+func getFolio(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+	txn := db.NewTxn()
+	defer txn.Discard(ctx)
+
+	_, source, isOk := openFolio(w, r, ctx, txn)
+	if !isOk {
+		return
+	}
+
+	json.NewEncoder(w).Encode(&FolioResp{
+		Folio: source.folio(time.Now()),
+	})
+}
+
+// getInvoice renders a booking's folio as an invoice, as a PDF unless
+// another format is asked for.
+func getInvoice(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = clients.InvoicePDF
+	}
+	if format != clients.InvoicePDF && format != clients.InvoiceHTML {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(&clients.InvoiceResp{
+			Err:  "unknown invoice format",
+			Code: utils.CodeBadRequest,
+		})
+		return
+	}
+
+	ctx := context.Background()
+	txn := db.NewTxn()
+	defer txn.Discard(ctx)
+
+	_, source, isOk := openFolio(w, r, ctx, txn)
+	if !isOk {
+		return
+	}
+
+	invoice, err := renderInvoice(source.folio(time.Now()), format)
+	if err != nil {
+		writeStatusError(w, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(&clients.InvoiceResp{
+		Invoice: invoice,
+	})
+}
+
+// postFolio adds a line made from the request body to a booking's folio,
+// for staff. Lines can only be posted to bookings with a price, as that's
+// where the folio's currency comes from.
+func postFolio(w http.ResponseWriter, r *http.Request, makeLine func(now time.Time) (*FolioLine, error)) {
+	ctx := context.Background()
+	txn := db.NewTxn()
+	defer txn.Discard(ctx)
+
+	claims, source, isOk := openFolio(w, r, ctx, txn)
+	if !isOk {
+		return
+	}
+	if !claims.User.HasRole(staffRoles...) {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(&FolioResp{
+			Err:  "only staff can post to folios",
+			Code: utils.CodeForbidden,
+		})
+		return
+	}
+
+	now := time.Now()
+	line, err := makeLine(now)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(&FolioResp{
+			Err:  err.Error(),
+			Code: utils.CodeBadRequest,
+		})
+		return
+	}
+	if source.booking.Price == nil {
+		writeStatusError(w, conflictError("booking has no price to post against"))
+		return
+	}
+
+	err = postFolioLine(ctx, txn, source, line, claims.User.ID)
+	if err != nil {
+		writeStatusError(w, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(&FolioResp{
+		Folio: source.folio(now),
+	})
+}
+
+func postFolioExtra(w http.ResponseWriter, r *http.Request) {
+	var extra FolioExtra
+	err := json.NewDecoder(r.Body).Decode(&extra)
+	r.Body.Close()
+
+	postFolio(w, r, func(now time.Time) (*FolioLine, error) {
+		if err != nil {
+			return nil, fmt.Errorf("bad request data")
+		}
+		if err := checkExtra(&extra); err != nil {
+			return nil, err
+		}
+		return &FolioLine{
+			Kind:        clients.FolioLineExtra,
+			Description: extra.Description,
+			Quantity:    extra.Quantity,
+			UnitAmount:  extra.UnitAmount,
+			Amount:      int64(extra.Quantity) * extra.UnitAmount,
+			PostedAt:    now,
+		}, nil
+	})
+}
+
+func recordFolioPayment(w http.ResponseWriter, r *http.Request) {
+	var payment FolioPayment
+	err := json.NewDecoder(r.Body).Decode(&payment)
+	r.Body.Close()
+
+	postFolio(w, r, func(now time.Time) (*FolioLine, error) {
+		if err != nil {
+			return nil, fmt.Errorf("bad request data")
+		}
+		if err := checkPayment(&payment); err != nil {
+			return nil, err
+		}
+		return &FolioLine{
+			Kind:        clients.FolioLinePayment,
+			Description: fmt.Sprintf("Payment by %s", payment.Method),
+			Quantity:    1,
+			UnitAmount:  payment.Amount,
+			Amount:      payment.Amount,
+			Method:      payment.Method,
+			Reference:   payment.Reference,
+			PostedAt:    now,
+		}, nil
+	})
+}
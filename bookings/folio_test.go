@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fluidmediaproductions/central_hotel_door_server/clients"
+)
+
+func testFolioSource() *folioSource {
+	start := time.Date(2030, 12, 30, 20, 0, 0, 0, time.UTC)
+	return &folioSource{
+		booking: &Booking{
+			ID:      "0x1",
+			HotelID: "0x2",
+			Start:   start,
+			End:     start.Add(48 * time.Hour),
+			Price: &Quote{
+				Currency: "GBP",
+				Nights: []*clients.QuoteNight{
+					{Date: "2030-12-31", Amount: 10000},
+					{Date: "2031-01-01", Amount: 25000, Season: "New Year"},
+				},
+				Subtotal: 35000,
+				Taxes: []*clients.QuoteTax{
+					{Name: "VAT", Percent: 20, Amount: 7000},
+				},
+				Total: 42000,
+			},
+		},
+		hotel: &clients.Hotel{
+			Name:     "The <Grand>",
+			Address:  "1 High St",
+			TimeZone: "Asia/Tokyo",
+		},
+		guestName:  "Ann Guest",
+		guestEmail: "ann@example.com",
+		lines: []*FolioLine{
+			{Kind: clients.FolioLineExtra, Date: "2031-01-01", Description: "Breakfast", Quantity: 2, UnitAmount: 1250, Amount: 2500},
+			{Kind: clients.FolioLinePayment, Date: "2031-01-01", Description: "Payment by card", Quantity: 1, UnitAmount: 20000, Amount: 20000, Method: "card", Reference: "A1"},
+		},
+	}
+}
+
+func TestFolio(t *testing.T) {
+	folio := testFolioSource().folio(time.Date(2031, 1, 1, 9, 0, 0, 0, time.UTC))
+
+	if len(folio.Charges) != 3 || folio.Charges[1].Description != "Room, New Year" || folio.Charges[2].Description != "Breakfast" {
+		t.Errorf("Unexpected charges %+v", folio.Charges)
+	}
+	if folio.ChargeTotal != 37500 || folio.TaxTotal != 7000 || folio.Total != 44500 {
+		t.Errorf("Unexpected totals %+v", folio)
+	}
+	if len(folio.Payments) != 1 || folio.Paid != 20000 || folio.Balance != 24500 {
+		t.Errorf("Unexpected payments %+v", folio)
+	}
+	if folio.Currency != "GBP" || folio.HotelName != "The <Grand>" || folio.TimeZone != "Asia/Tokyo" {
+		t.Errorf("Unexpected folio %+v", folio)
+	}
+
+	// Bookings without a price only have what's been posted to them
+	source := testFolioSource()
+	source.booking.Price = nil
+	source.lines = source.lines[:1]
+	folio = source.folio(time.Now())
+	if len(folio.Charges) != 1 || len(folio.Taxes) != 0 || folio.Total != 2500 || folio.Balance != 2500 {
+		t.Errorf("Unexpected folio without a price %+v", folio)
+	}
+}
+
+func TestCheckFolioLines(t *testing.T) {
+	extra := &FolioExtra{Description: " Parking ", UnitAmount: 1500}
+	if err := checkExtra(extra); err != nil || extra.Quantity != 1 || extra.Description != "Parking" {
+		t.Errorf("Unexpected extra %+v: %v", extra, err)
+	}
+	for _, extra := range []*FolioExtra{
+		{Description: " ", UnitAmount: 100},
+		{Description: "Parking", Quantity: -1, UnitAmount: 100},
+		{Description: "Parking", UnitAmount: -100},
+	} {
+		if err := checkExtra(extra); err == nil {
+			t.Errorf("Expected an error for %+v", extra)
+		}
+	}
+
+	payment := &FolioPayment{Amount: 100, Method: " Cash"}
+	if err := checkPayment(payment); err != nil || payment.Method != "cash" {
+		t.Errorf("Unexpected payment %+v: %v", payment, err)
+	}
+	for _, payment := range []*FolioPayment{
+		{Amount: 100},
+		{Amount: 0, Method: "cash"},
+		{Amount: -100, Method: "cash"},
+	} {
+		if err := checkPayment(payment); err == nil {
+			t.Errorf("Expected an error for %+v", payment)
+		}
+	}
+}
+
+func TestFormatAmount(t *testing.T) {
+	tests := []struct {
+		amount   int64
+		currency string
+		out      string
+	}{
+		{123456, "GBP", "1,234.56"},
+		{5, "EUR", "0.05"},
+		{-20000, "GBP", "-200.00"},
+		{1234567, "JPY", "1,234,567"},
+		{1500, "KWD", "1.500"},
+		{0, "USD", "0.00"},
+	}
+	for _, test := range tests {
+		if out := formatAmount(test.amount, test.currency); out != test.out {
+			t.Errorf("%d %s: expected %s, got %s", test.amount, test.currency, test.out, out)
+		}
+	}
+}
+
+func TestRenderInvoice(t *testing.T) {
+	folio := testFolioSource().folio(time.Date(2031, 1, 1, 20, 0, 0, 0, time.UTC))
+
+	invoice, err := renderInvoice(folio, clients.InvoiceHTML)
+	if err != nil {
+		t.Fatalf("Error rendering HTML: %v", err)
+	}
+	html := string(invoice.Data)
+	if invoice.FileName != "invoice-0x1.html" || !strings.HasPrefix(invoice.ContentType, "text/html") {
+		t.Errorf("Unexpected invoice %s %s", invoice.FileName, invoice.ContentType)
+	}
+	if !strings.Contains(html, "The &lt;Grand&gt;") {
+		t.Error("Expected the hotel's name to be escaped")
+	}
+	// Dates are in the hotel's time zone
+	for _, want := range []string{"Issued 2 Jan 2031", "31 Dec 2030 to 2 Jan 2031", "VAT 20%", "445.00", "Payment by card, ref A1", "-200.00", "245.00"} {
+		if !strings.Contains(html, want) {
+			t.Errorf("Expected the HTML invoice to contain %q", want)
+		}
+	}
+
+	invoice, err = renderInvoice(folio, clients.InvoicePDF)
+	if err != nil {
+		t.Fatalf("Error rendering PDF: %v", err)
+	}
+	pdf := invoice.Data
+	if invoice.ContentType != "application/pdf" || !bytes.HasPrefix(pdf, []byte("%PDF-1.4\n")) || !bytes.HasSuffix(pdf, []byte("%%EOF\n")) {
+		t.Fatal("Expected a PDF")
+	}
+	for _, want := range []string{"(The <Grand>)", "(Room, New Year)", "(Balance due)", "(245.00)"} {
+		if !bytes.Contains(pdf, []byte(want)) {
+			t.Errorf("Expected the PDF invoice to contain %q", want)
+		}
+	}
+	checkPDFXref(t, pdf)
+
+	if _, err := renderInvoice(folio, "doc"); err == nil {
+		t.Error("Expected an error for an unknown format")
+	}
+}
+
+// checkPDFXref checks the cross-reference table points at each object.
+func checkPDFXref(t *testing.T, pdf []byte) {
+	match := regexp.MustCompile(`startxref\n(\d+)\n`).FindSubmatch(pdf)
+	if match == nil {
+		t.Fatal("Expected a startxref")
+	}
+	xref, _ := strconv.Atoi(string(match[1]))
+	if !bytes.HasPrefix(pdf[xref:], []byte("xref\n")) {
+		t.Fatalf("startxref %d doesn't point at the xref table", xref)
+	}
+	offsets := regexp.MustCompile(`(\d{10}) 00000 n `).FindAllSubmatch(pdf[xref:], -1)
+	if len(offsets) == 0 {
+		t.Fatal("Expected objects in the xref table")
+	}
+	for i, offset := range offsets {
+		at, _ := strconv.Atoi(string(offset[1]))
+		if !bytes.HasPrefix(pdf[at:], []byte(fmt.Sprintf("%d 0 obj\n", i+1))) {
+			t.Errorf("Object %d isn't at %d", i+1, at)
+		}
+	}
+}
+
+func TestPDFString(t *testing.T) {
+	if out := pdfString(`a (b) \ é €`); out != `a \(b\) \\ \351 ?` {
+		t.Errorf("Unexpected escaping %s", out)
+	}
+}
@@ -0,0 +1,550 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dgraph-io/dgo"
+	"github.com/dgraph-io/dgo/protos/api"
+	"github.com/fluidmediaproductions/central_hotel_door_server/clients"
+	"github.com/fluidmediaproductions/central_hotel_door_server/utils"
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+)
+
+var errBookingNotFound = errors.New("booking not found")
+var errInviteNotFound = errors.New("invite not found")
+
+type BookingGuest = clients.BookingGuest
+type BookingGuestResp = clients.BookingGuestResp
+
+type guestQuery struct {
+	ID      string     `json:"uid"`
+	Email   string     `json:"guest.email"`
+	Start   *time.Time `json:"guest.start"`
+	End     *time.Time `json:"guest.end"`
+	Revoked bool       `json:"guest.revoked"`
+	User    []struct {
+		ID string `json:"uid"`
+	} `json:"guest.user"`
+}
+
+const guestFields = `booking.guests {
+                        uid
+                        guest.email
+                        guest.start
+                        guest.end
+                        guest.revoked
+                        guest.user {
+                          uid
+                        }
+                      }`
+
+func (g *guestQuery) toGuest() *BookingGuest {
+	guest := &BookingGuest{
+		ID:      g.ID,
+		Email:   g.Email,
+		Revoked: g.Revoked,
+	}
+	if g.Start != nil {
+		guest.Start = *g.Start
+	}
+	if g.End != nil {
+		guest.End = *g.End
+	}
+	if len(g.User) > 0 {
+		guest.UserID = g.User[0].ID
+	}
+	return guest
+}
+
+// guestAccessQuery finds the bookings for a room a user has accepted an
+// invite to. Guests only get into the room, not the hotel's other zones.
+type guestAccessQuery struct {
+	Guests []struct {
+		guestQuery
+		Booking []struct {
+			Start  *time.Time `json:"booking.start"`
+			End    *time.Time `json:"booking.end"`
+			Type   string     `json:"booking.type"`
+			Status string     `json:"booking.status"`
+			User   []struct {
+				ID string `json:"uid"`
+			} `json:"booking.user"`
+			Hotel []struct {
+				ID string `json:"uid"`
+			} `json:"booking.hotel"`
+			Room []struct {
+				ID string `json:"uid"`
+			} `json:"booking.room"`
+			ID string `json:"uid"`
+		} `json:"~booking.guests"`
+	} `json:"guests"`
+}
+
+const guestAccessQueryBlock = `var (func: uid($user)) {
+		              ug as ~guest.user
+	                }
+                    guests(func: uid(ug)) {
+                      uid
+                      guest.start
+                      guest.end
+                      guest.revoked
+                      ~booking.guests {
+                        uid
+                        booking.start
+                        booking.end
+                        booking.type
+                        booking.status
+                        booking.hotel {
+                          uid
+                        }
+                        booking.room @filter(uid(r)) {
+                          uid
+                        }
+                        booking.user {
+                          uid
+                        }
+                      }
+	                }`
+
+// toBookings returns the bookings the user is a guest on, cut down to the
+// time their invite covers.
+func (q *guestAccessQuery) toBookings() []*Booking {
+	outBookings := make([]*Booking, 0)
+	for _, guest := range q.Guests {
+		if guest.Revoked || guest.Start == nil || guest.End == nil {
+			continue
+		}
+		for _, booking := range guest.Booking {
+			if len(booking.User) == 0 || len(booking.Hotel) == 0 || len(booking.Room) == 0 {
+				continue
+			}
+			if booking.Start == nil || booking.End == nil {
+				continue
+			}
+			outBooking := &Booking{
+				ID:      booking.ID,
+				HotelID: booking.Hotel[0].ID,
+				RoomID:  booking.Room[0].ID,
+				Start:   *booking.Start,
+				End:     *booking.End,
+				UserID:  booking.User[0].ID,
+				Type:    booking.Type,
+				Status:  bookingState(booking.Status),
+				GuestID: guest.ID,
+			}
+			if guest.Start.After(outBooking.Start) {
+				outBooking.Start = *guest.Start
+			}
+			if guest.End.Before(outBooking.End) {
+				outBooking.End = *guest.End
+			}
+			if !outBooking.End.After(outBooking.Start) {
+				continue
+			}
+			outBookings = append(outBookings, outBooking)
+		}
+	}
+	return outBookings
+}
+
+func getOwnedBooking(ctx context.Context, txn *dgo.Txn, id string, userId string) (*Booking, error) {
+	variables := map[string]string{"$id": id, "$user": userId}
+	q := `query q($id: uid, $user: uid) {
+            var (func: uid($user)) {
+              u as uid
+            }
+            bookings(func: uid($id)) @filter(has(booking)) {
+              uid
+              booking.start
+              booking.end
+              booking.type
+              booking.category
+              ` + statusFields + `
+              ` + priceFields + `
+              ` + paymentFields + `
+              booking.hotel {
+                uid
+              }
+              booking.room {
+                uid
+              }
+              booking.user @filter(uid(u)) {
+                uid
+              }
+              ` + guestFields + `
+            }
+          }`
+
+	resp, err := txn.QueryWithVars(ctx, q, variables)
+	if err != nil {
+		return nil, err
+	}
+	var bookings bookingQuery
+	err = json.Unmarshal(resp.GetJson(), &bookings)
+	if err != nil {
+		return nil, err
+	}
+
+	outBookings := bookings.toBookings()
+	if len(outBookings) == 0 {
+		return nil, errBookingNotFound
+	}
+	return outBookings[0], nil
+}
+
+func writeGuestError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	if err == errBookingNotFound {
+		status = http.StatusNotFound
+	}
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(&BookingGuestResp{
+		Err:  err.Error(),
+		Code: utils.StatusCode(status),
+	})
+}
+
+// newInviteToken makes the secret a guest uses to accept an invite. Only its
+// hash is stored.
+func newInviteToken() (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashInviteToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// inviteGuest adds a guest to one of the user's bookings. The invite isn't
+// linked to anyone until the guest accepts it with the token handed back
+// here, so an email address alone never gets anyone into the room.
+func inviteGuest(w http.ResponseWriter, r *http.Request) {
+	claims, err := utils.GetRequestJWT(r, jwtSecret)
+	if err != nil {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(&BookingGuestResp{
+			Err:  err.Error(),
+			Code: utils.CodeUnauthenticated,
+		})
+		return
+	}
+
+	vars := mux.Vars(r)
+
+	id := vars["id"]
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(&BookingGuestResp{
+			Err:  err.Error(),
+			Code: utils.CodeBadRequest,
+		})
+		return
+	}
+	defer r.Body.Close()
+
+	var data struct {
+		Email string     `json:"email"`
+		Start *time.Time `json:"start"`
+		End   *time.Time `json:"end"`
+	}
+	err = json.Unmarshal(body, &data)
+	data.Email = strings.TrimSpace(data.Email)
+	if err != nil || data.Email == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(&BookingGuestResp{
+			Err:  "bad request data",
+			Code: utils.CodeBadRequest,
+		})
+		return
+	}
+	if strings.EqualFold(data.Email, claims.User.Email) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(&BookingGuestResp{
+			Err:  "can't invite yourself",
+			Code: utils.CodeBadRequest,
+		})
+		return
+	}
+
+	ctx := context.Background()
+	txn := db.NewTxn()
+	defer txn.Discard(ctx)
+
+	booking, err := getOwnedBooking(ctx, txn, id, claims.User.ID)
+	if err != nil {
+		writeGuestError(w, err)
+		return
+	}
+
+	// Guests can't be given access outside of the booking
+	guest := &BookingGuest{
+		Email: data.Email,
+		Start: booking.Start,
+		End:   booking.End,
+	}
+	if data.Start != nil && data.Start.After(guest.Start) {
+		guest.Start = *data.Start
+	}
+	if data.End != nil && data.End.Before(guest.End) {
+		guest.End = *data.End
+	}
+	if !guest.End.After(guest.Start) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(&BookingGuestResp{
+			Err:  "guest access is outside of the booking",
+			Code: utils.CodeBadRequest,
+		})
+		return
+	}
+
+	token, err := newInviteToken()
+	if err != nil {
+		writeGuestError(w, err)
+		return
+	}
+
+	guestNode := map[string]interface{}{
+		"uid":           "_:guest",
+		"guest.email":   guest.Email,
+		"guest.start":   guest.Start,
+		"guest.end":     guest.End,
+		"guest.revoked": false,
+		"guest.token":   hashInviteToken(token),
+	}
+	mutation := map[string]interface{}{
+		"uid":            booking.ID,
+		"booking.guests": guestNode,
+	}
+
+	mutData, err := json.Marshal(mutation)
+	if err != nil {
+		writeGuestError(w, err)
+		return
+	}
+	assigned, err := txn.Mutate(ctx, &api.Mutation{SetJson: mutData})
+	if err == nil {
+		err = txn.Commit(ctx)
+	}
+	if err != nil {
+		writeGuestError(w, err)
+		return
+	}
+	guest.ID = assigned.GetUids()["guest"]
+	guest.InviteToken = token
+
+	json.NewEncoder(w).Encode(&BookingGuestResp{
+		Guest: guest,
+	})
+}
+
+func revokeGuest(w http.ResponseWriter, r *http.Request) {
+	claims, err := utils.GetRequestJWT(r, jwtSecret)
+	if err != nil {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(&BookingGuestResp{
+			Err:  err.Error(),
+			Code: utils.CodeUnauthenticated,
+		})
+		return
+	}
+
+	vars := mux.Vars(r)
+
+	id := vars["id"]
+	guestId := vars["guestId"]
+
+	ctx := context.Background()
+	txn := db.NewTxn()
+	defer txn.Discard(ctx)
+
+	booking, err := getOwnedBooking(ctx, txn, id, claims.User.ID)
+	if err != nil {
+		writeGuestError(w, err)
+		return
+	}
+
+	var guest *BookingGuest
+	for _, g := range booking.Guests {
+		if g.ID == guestId {
+			guest = g
+		}
+	}
+	if guest == nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(&BookingGuestResp{
+			Err:  "guest not found",
+			Code: utils.CodeNotFound,
+		})
+		return
+	}
+
+	var mutation struct {
+		ID      string `json:"uid"`
+		Revoked bool   `json:"guest.revoked"`
+	}
+	mutation.ID = guest.ID
+	mutation.Revoked = true
+
+	mutData, err := json.Marshal(&mutation)
+	if err != nil {
+		writeGuestError(w, err)
+		return
+	}
+	_, err = txn.Mutate(ctx, &api.Mutation{SetJson: mutData, CommitNow: true})
+	if err != nil {
+		writeGuestError(w, err)
+		return
+	}
+
+	guest.Revoked = true
+	json.NewEncoder(w).Encode(&BookingGuestResp{
+		Guest: guest,
+	})
+}
+
+// acceptGuestInvite links an invite to the user redeeming its token. Tokens
+// can only be used once.
+func acceptGuestInvite(w http.ResponseWriter, r *http.Request) {
+	claims, err := utils.GetRequestJWT(r, jwtSecret)
+	if err != nil {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(&BookingGuestResp{
+			Err:  err.Error(),
+			Code: utils.CodeUnauthenticated,
+		})
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(&BookingGuestResp{
+			Err:  err.Error(),
+			Code: utils.CodeBadRequest,
+		})
+		return
+	}
+	defer r.Body.Close()
+
+	var accept clients.GuestInviteAccept
+	err = json.Unmarshal(body, &accept)
+	if err != nil || accept.Token == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(&BookingGuestResp{
+			Err:  "bad request data",
+			Code: utils.CodeBadRequest,
+		})
+		return
+	}
+
+	ctx := context.Background()
+	txn := db.NewTxn()
+	defer txn.Discard(ctx)
+
+	variables := map[string]string{"$token": hashInviteToken(accept.Token)}
+	q := `query q($token: string) {
+            guests(func: eq(guest.token, $token)) {
+              uid
+              guest.email
+              guest.start
+              guest.end
+              guest.revoked
+              ~booking.guests {
+                booking.user {
+                  uid
+                }
+              }
+            }
+          }`
+	resp, err := txn.QueryWithVars(ctx, q, variables)
+	if err != nil {
+		writeGuestError(w, err)
+		return
+	}
+	var guests struct {
+		Guests []struct {
+			guestQuery
+			Booking []struct {
+				User []struct {
+					ID string `json:"uid"`
+				} `json:"booking.user"`
+			} `json:"~booking.guests"`
+		} `json:"guests"`
+	}
+	err = json.Unmarshal(resp.GetJson(), &guests)
+	if err != nil {
+		writeGuestError(w, err)
+		return
+	}
+	if len(guests.Guests) == 0 || guests.Guests[0].Revoked {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(&BookingGuestResp{
+			Err:  errInviteNotFound.Error(),
+			Code: utils.CodeNotFound,
+		})
+		return
+	}
+	found := guests.Guests[0]
+	for _, booking := range found.Booking {
+		if len(booking.User) > 0 && booking.User[0].ID == claims.User.ID {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(&BookingGuestResp{
+				Err:  "can't accept an invite to your own booking",
+				Code: utils.CodeBadRequest,
+			})
+			return
+		}
+	}
+
+	del, err := json.Marshal(map[string]interface{}{
+		"uid":         found.ID,
+		"guest.token": nil,
+	})
+	if err == nil {
+		_, err = txn.Mutate(ctx, &api.Mutation{DeleteJson: del})
+	}
+	if err != nil {
+		writeGuestError(w, err)
+		return
+	}
+	mutData, err := json.Marshal([]interface{}{
+		map[string]interface{}{
+			"uid":        found.ID,
+			"guest.user": map[string]string{"uid": claims.User.ID},
+		},
+		utils.NewAuditEntry("guest.accepted", claims.User.ID, found.ID, found.Email),
+	})
+	if err == nil {
+		_, err = txn.Mutate(ctx, &api.Mutation{SetJson: mutData})
+	}
+	if err == nil {
+		err = txn.Commit(ctx)
+	}
+	if err != nil {
+		writeGuestError(w, err)
+		return
+	}
+
+	guest := found.toGuest()
+	guest.UserID = claims.User.ID
+	json.NewEncoder(w).Encode(&BookingGuestResp{
+		Guest: guest,
+	})
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/fluidmediaproductions/central_hotel_door_server/utils"
+)
+
+const testOwnedBookingJSON = `{
+	"bookings": [
+		{
+			"uid": "0x10",
+			"booking.start": "2030-01-01T14:00:00Z",
+			"booking.end": "2030-01-03T14:00:00Z",
+			"booking.hotel": [{"uid": "0x1"}],
+			"booking.room": [{"uid": "0x2"}],
+			"booking.user": [{"uid": "0x3"}],
+			"booking.guests": [
+				{
+					"uid": "0x40",
+					"guest.email": "guest@bar.com",
+					"guest.start": "2030-01-01T14:00:00Z",
+					"guest.end": "2030-01-02T14:00:00Z",
+					"guest.user": [{"uid": "0x5"}]
+				}
+			]
+		}
+	]
+}`
+
+func TestInviteGuest(t *testing.T) {
+	fake, restore := useFakeDB(t)
+	defer restore()
+
+	owner := newTestJWT(t, &utils.User{ID: "0x3", Email: "foo@bar.com"})
+
+	resp, _ := doJSONRequest("POST", "http://a/bookings/0x10/guests", "", `{"email": "guest@bar.com"}`)
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("Expected 403 error without a JWT, got %s", resp.Status)
+	}
+	for _, body := range []string{`{"email": " "}`, `{"email": "FOO@bar.com"}`} {
+		resp, _ = doJSONRequest("POST", "http://a/bookings/0x10/guests", owner, body)
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("Expected 400 error for %s, got %s", body, resp.Status)
+		}
+	}
+
+	// The invitee's email isn't looked up, so only the owned booking is queried
+	fake.expectQuery("@filter(has(booking))", testOwnedBookingJSON)
+	resp, body := doJSONRequest("POST", "http://a/bookings/0x10/guests", owner, `{"email": "new@bar.com"}`)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected the guest, got %s %s", resp.Status, string(body))
+	}
+	var guestResp BookingGuestResp
+	err := json.Unmarshal(body, &guestResp)
+	if err != nil || guestResp.Guest.InviteToken == "" || guestResp.Guest.UserID != "" {
+		t.Fatalf("Expected an unaccepted guest with an invite token, got %s", string(body))
+	}
+	if !guestResp.Guest.Start.Equal(testStart) || !guestResp.Guest.End.Equal(testEnd) {
+		t.Errorf("Expected the guest to have the booking's times, got %+v", guestResp.Guest)
+	}
+
+	if len(fake.mutations) != 1 {
+		t.Fatalf("Expected one mutation, got %d", len(fake.mutations))
+	}
+	var mutation struct {
+		Guest map[string]interface{} `json:"booking.guests"`
+	}
+	err = json.Unmarshal(fake.mutations[0].SetJson, &mutation)
+	if err != nil {
+		t.Fatalf("Error reading mutation: %v", err)
+	}
+	if _, isOk := mutation.Guest["guest.user"]; isOk {
+		t.Errorf("Expected the guest not to be linked to a user, got %s", string(fake.mutations[0].SetJson))
+	}
+	if mutation.Guest["guest.token"] != hashInviteToken(guestResp.Guest.InviteToken) {
+		t.Errorf("Expected only the token's hash to be saved, got %s", string(fake.mutations[0].SetJson))
+	}
+}
+
+func TestAcceptGuestInvite(t *testing.T) {
+	fake, restore := useFakeDB(t)
+	defer restore()
+
+	owner := newTestJWT(t, &utils.User{ID: "0x3"})
+	guest := newTestJWT(t, &utils.User{ID: "0x5"})
+
+	resp, _ := doJSONRequest("POST", "http://a/guests/accept", "", `{"token": "abc"}`)
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("Expected 403 error without a JWT, got %s", resp.Status)
+	}
+	resp, _ = doJSONRequest("POST", "http://a/guests/accept", guest, `{}`)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected 400 error without a token, got %s", resp.Status)
+	}
+
+	// Used up tokens are removed, so they aren't found again
+	fake.expectQuery("eq(guest.token, $token)", `{"guests": []}`)
+	resp, _ = doJSONRequest("POST", "http://a/guests/accept", guest, `{"token": "abc"}`)
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected 404 error for an unknown token, got %s", resp.Status)
+	}
+
+	fake.queries = nil
+	fake.expectQuery("eq(guest.token, $token)", `{
+		"guests": [
+			{
+				"uid": "0x40",
+				"guest.revoked": true,
+				"~booking.guests": [{"booking.user": [{"uid": "0x3"}]}]
+			}
+		]
+	}`)
+	resp, _ = doJSONRequest("POST", "http://a/guests/accept", guest, `{"token": "abc"}`)
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected 404 error for a revoked invite, got %s", resp.Status)
+	}
+
+	fake.queries = nil
+	fake.expectQuery("eq(guest.token, $token)", `{
+		"guests": [
+			{
+				"uid": "0x40",
+				"guest.email": "guest@bar.com",
+				"guest.start": "2030-01-01T14:00:00Z",
+				"guest.end": "2030-01-02T14:00:00Z",
+				"~booking.guests": [{"booking.user": [{"uid": "0x3"}]}]
+			}
+		]
+	}`)
+	resp, _ = doJSONRequest("POST", "http://a/guests/accept", owner, `{"token": "abc"}`)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected 400 error for the booking's owner, got %s", resp.Status)
+	}
+	if len(fake.mutations) != 0 {
+		t.Fatalf("Expected no mutations, got %d", len(fake.mutations))
+	}
+
+	resp, body := doJSONRequest("POST", "http://a/guests/accept", guest, `{"token": "abc"}`)
+	var guestResp BookingGuestResp
+	err := json.Unmarshal(body, &guestResp)
+	if resp.StatusCode != http.StatusOK || err != nil || guestResp.Guest.ID != "0x40" || guestResp.Guest.UserID != "0x5" {
+		t.Fatalf("Expected the guest to be linked to the user, got %s %s", resp.Status, string(body))
+	}
+
+	if len(fake.mutations) != 2 {
+		t.Fatalf("Expected two mutations, got %d", len(fake.mutations))
+	}
+	var deleted map[string]interface{}
+	err = json.Unmarshal(fake.mutations[0].DeleteJson, &deleted)
+	if _, isOk := deleted["guest.token"]; err != nil || !isOk || deleted["uid"] != "0x40" {
+		t.Errorf("Expected the token to be used up, got %s", string(fake.mutations[0].DeleteJson))
+	}
+	var nodes []map[string]interface{}
+	err = json.Unmarshal(fake.mutations[1].SetJson, &nodes)
+	if err != nil || len(nodes) != 2 || nodes[1]["audit.action"] != "guest.accepted" {
+		t.Fatalf("Expected the guest to be linked and audited, got %s", string(fake.mutations[1].SetJson))
+	}
+	user, _ := nodes[0]["guest.user"].(map[string]interface{})
+	if nodes[0]["uid"] != "0x40" || user["uid"] != "0x5" {
+		t.Errorf("Expected the guest to be linked to the user, got %s", string(fake.mutations[1].SetJson))
+	}
+}
+
+func TestRevokeGuest(t *testing.T) {
+	fake, restore := useFakeDB(t)
+	defer restore()
+
+	owner := newTestJWT(t, &utils.User{ID: "0x3"})
+
+	resp, _ := doRequest("POST", "http://a/bookings/0x10/guests/0x40/revoke", "")
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("Expected 403 error without a JWT, got %s", resp.Status)
+	}
+
+	fake.expectQuery("@filter(has(booking))", testOwnedBookingJSON)
+	resp, _ = doRequest("POST", "http://a/bookings/0x10/guests/0x41/revoke", owner)
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected 404 error for an unknown guest, got %s", resp.Status)
+	}
+	if len(fake.mutations) != 0 {
+		t.Fatalf("Expected no mutations, got %d", len(fake.mutations))
+	}
+
+	resp, body := doRequest("POST", "http://a/bookings/0x10/guests/0x40/revoke", owner)
+	var guestResp BookingGuestResp
+	err := json.Unmarshal(body, &guestResp)
+	if resp.StatusCode != http.StatusOK || err != nil || !guestResp.Guest.Revoked {
+		t.Fatalf("Expected the guest to be revoked, got %s %s", resp.Status, string(body))
+	}
+	if len(fake.mutations) != 1 || !fake.mutations[0].CommitNow {
+		t.Fatalf("Expected one committed mutation, got %d", len(fake.mutations))
+	}
+	var mutation map[string]interface{}
+	err = json.Unmarshal(fake.mutations[0].SetJson, &mutation)
+	if err != nil || mutation["uid"] != "0x40" || mutation["guest.revoked"] != true {
+		t.Errorf("Expected the guest to be revoked, got %s", string(fake.mutations[0].SetJson))
+	}
+}
+
+func TestGuestAccess(t *testing.T) {
+	fake, restore := useFakeDB(t)
+	defer restore()
+
+	guest := newTestJWT(t, &utils.User{ID: "0x5", Email: "guest@bar.com"})
+
+	// Guests are only found through the invites they've accepted
+	fake.expectQuery("guests(func: uid(ug))", `{
+		"bookings": [],
+		"guests": [
+			{
+				"uid": "0x40",
+				"guest.start": "2030-01-02T14:00:00Z",
+				"guest.end": "2030-01-05T14:00:00Z",
+				"~booking.guests": [
+					{
+						"uid": "0x10",
+						"booking.start": "2030-01-01T14:00:00Z",
+						"booking.end": "2030-01-03T14:00:00Z",
+						"booking.hotel": [{"uid": "0x1"}],
+						"booking.room": [{"uid": "0x2"}],
+						"booking.user": [{"uid": "0x3"}]
+					}
+				]
+			},
+			{
+				"uid": "0x41",
+				"guest.start": "2030-01-01T14:00:00Z",
+				"guest.end": "2030-01-03T14:00:00Z",
+				"guest.revoked": true,
+				"~booking.guests": [
+					{
+						"uid": "0x11",
+						"booking.start": "2030-01-01T14:00:00Z",
+						"booking.end": "2030-01-03T14:00:00Z",
+						"booking.hotel": [{"uid": "0x1"}],
+						"booking.room": [{"uid": "0x2"}],
+						"booking.user": [{"uid": "0x3"}]
+					}
+				]
+			}
+		]
+	}`)
+	resp, body := doRequest("GET", "http://a/bookings/by-room/0x2", guest)
+
+	booking := testBooking()
+	booking.Start = testStart.Add(24 * time.Hour)
+	booking.GuestID = "0x40"
+	expBody := encodeResp(t, &BookingsResp{
+		Bookings: []*Booking{booking},
+	})
+	if resp.StatusCode != http.StatusOK || string(body) != expBody {
+		t.Errorf("Response not what was expected, got %s %s wanted %s", resp.Status, string(body), expBody)
+	}
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fluidmediaproductions/central_hotel_door_server/clients"
+	"github.com/fluidmediaproductions/central_hotel_door_server/utils"
+)
+
+type Invoice = clients.Invoice
+
+// minorUnits are the currencies that don't have two decimal places.
+var minorUnits = map[string]int{
+	"BHD": 3, "JOD": 3, "KWD": 3, "OMR": 3, "TND": 3,
+	"CLP": 0, "ISK": 0, "JPY": 0, "KRW": 0, "PYG": 0, "UGX": 0, "VND": 0, "XAF": 0, "XOF": 0,
+}
+
+// formatAmount writes an amount in the minor unit of a currency in its major
+// unit, like 123456 GBP as 1,234.56.
+func formatAmount(amount int64, currency string) string {
+	places, isOk := minorUnits[currency]
+	if !isOk {
+		places = 2
+	}
+
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+	digits := strconv.FormatInt(amount, 10)
+	for len(digits) <= places {
+		digits = "0" + digits
+	}
+	whole, fraction := digits[:len(digits)-places], digits[len(digits)-places:]
+
+	var grouped []string
+	for len(whole) > 3 {
+		grouped = append([]string{whole[len(whole)-3:]}, grouped...)
+		whole = whole[:len(whole)-3]
+	}
+	grouped = append([]string{whole}, grouped...)
+
+	out := sign + strings.Join(grouped, ",")
+	if places > 0 {
+		out += "." + fraction
+	}
+	return out
+}
+
+// formatDate writes a date from a folio the way people read them.
+func formatDate(date string) string {
+	day, err := time.Parse(clients.DateLayout, date)
+	if err != nil {
+		return date
+	}
+	return day.Format("2 Jan 2006")
+}
+
+type invoiceRow struct {
+	Date        string
+	Description string
+	Quantity    string
+	Unit        string
+	Amount      string
+}
+
+type invoiceTotal struct {
+	Label  string
+	Amount string
+}
+
+// invoiceDoc is a folio laid out as the text of an invoice, which each
+// format then draws.
+type invoiceDoc struct {
+	Number       string
+	HotelName    string
+	HotelAddress string
+	GuestName    string
+	GuestEmail   string
+	Stay         string
+	Issued       string
+	Currency     string
+	Charges      []invoiceRow
+	Totals       []invoiceTotal
+	Payments     []invoiceRow
+	Balance      invoiceTotal
+}
+
+func newInvoiceDoc(folio *Folio) *invoiceDoc {
+	loc := utils.LoadTimeZone(folio.TimeZone)
+	amount := func(amount int64) string {
+		return formatAmount(amount, folio.Currency)
+	}
+
+	doc := &invoiceDoc{
+		Number:       folio.BookingID,
+		HotelName:    folio.HotelName,
+		HotelAddress: folio.HotelAddress,
+		GuestName:    folio.GuestName,
+		GuestEmail:   folio.GuestEmail,
+		Stay: fmt.Sprintf("%s to %s", folio.Start.In(loc).Format("2 Jan 2006"),
+			folio.End.In(loc).Format("2 Jan 2006")),
+		Issued:   folio.IssuedAt.In(loc).Format("2 Jan 2006"),
+		Currency: folio.Currency,
+	}
+	for _, line := range folio.Charges {
+		doc.Charges = append(doc.Charges, invoiceRow{
+			Date:        formatDate(line.Date),
+			Description: line.Description,
+			Quantity:    strconv.Itoa(line.Quantity),
+			Unit:        amount(line.UnitAmount),
+			Amount:      amount(line.Amount),
+		})
+	}
+
+	doc.Totals = append(doc.Totals, invoiceTotal{"Subtotal", amount(folio.ChargeTotal)})
+	for _, tax := range folio.Taxes {
+		label := fmt.Sprintf("%s %s%%", tax.Name, strconv.FormatFloat(tax.Percent, 'f', -1, 64))
+		doc.Totals = append(doc.Totals, invoiceTotal{label, amount(tax.Amount)})
+	}
+	doc.Totals = append(doc.Totals, invoiceTotal{"Total", amount(folio.Total)})
+
+	for _, line := range folio.Payments {
+		description := line.Description
+		if line.Reference != "" {
+			description = fmt.Sprintf("%s, ref %s", description, line.Reference)
+		}
+		paid := -line.Amount
+		if line.Kind == clients.FolioLineRefund {
+			paid = line.Amount
+		}
+		doc.Payments = append(doc.Payments, invoiceRow{
+			Date:        formatDate(line.Date),
+			Description: description,
+			Amount:      amount(paid),
+		})
+	}
+	doc.Balance = invoiceTotal{"Balance due", amount(folio.Balance)}
+	return doc
+}
+
+// renderInvoice draws a folio as an invoice in one of the invoice formats.
+func renderInvoice(folio *Folio, format string) (*Invoice, error) {
+	doc := newInvoiceDoc(folio)
+	invoice := &Invoice{
+		Format:   format,
+		FileName: fmt.Sprintf("invoice-%s.%s", folio.BookingID, format),
+	}
+	switch format {
+	case clients.InvoiceHTML:
+		var out bytes.Buffer
+		err := invoiceTemplate.Execute(&out, doc)
+		if err != nil {
+			return nil, err
+		}
+		invoice.ContentType = "text/html; charset=utf-8"
+		invoice.Data = out.Bytes()
+	case clients.InvoicePDF:
+		invoice.ContentType = "application/pdf"
+		invoice.Data = doc.pdf()
+	default:
+		return nil, fmt.Errorf("unknown invoice format %s", format)
+	}
+	return invoice, nil
+}
+
+var invoiceTemplate = template.Must(template.New("invoice").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Invoice {{.Number}}</title>
+<style>
+body { font-family: Helvetica, Arial, sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; width: 100%; margin-top: 1em; }
+th, td { padding: 0.3em 0.5em; text-align: left; border-bottom: 1px solid #ddd; }
+.amount { text-align: right; }
+.total td { font-weight: bold; }
+</style>
+</head>
+<body>
+<h1>Invoice</h1>
+<p><strong>{{.HotelName}}</strong><br>{{.HotelAddress}}</p>
+<p>Booking {{.Number}}<br>Issued {{.Issued}}</p>
+<p>{{.GuestName}}<br>{{.GuestEmail}}</p>
+<p>Stay {{.Stay}}. Amounts in {{.Currency}}.</p>
+<table>
+<thead><tr><th>Date</th><th>Description</th><th class="amount">Qty</th><th class="amount">Unit</th><th class="amount">Amount</th></tr></thead>
+<tbody>
+{{range .Charges}}<tr><td>{{.Date}}</td><td>{{.Description}}</td><td class="amount">{{.Quantity}}</td><td class="amount">{{.Unit}}</td><td class="amount">{{.Amount}}</td></tr>
+{{end}}</tbody>
+<tbody>
+{{range .Totals}}<tr class="total"><td colspan="4">{{.Label}}</td><td class="amount">{{.Amount}}</td></tr>
+{{end}}</tbody>
+</table>
+{{if .Payments}}<table>
+<thead><tr><th>Date</th><th>Payment</th><th class="amount">Amount</th></tr></thead>
+<tbody>
+{{range .Payments}}<tr><td>{{.Date}}</td><td>{{.Description}}</td><td class="amount">{{.Amount}}</td></tr>
+{{end}}</tbody>
+</table>
+{{end}}<table>
+<tr class="total"><td>{{.Balance.Label}}</td><td class="amount">{{.Balance.Amount}}</td></tr>
+</table>
+</body>
+</html>
+`))
+
+// pdf draws the invoice on as many A4 pages as it takes.
+func (d *invoiceDoc) pdf() []byte {
+	const (
+		left     = 50.0
+		right    = pdfPageWidth - 50.0
+		top      = pdfPageHeight - 60.0
+		bottom   = 60.0
+		leading  = 16.0
+		fontSize = 10.0
+	)
+	pdf := &pdfDoc{}
+	pdf.addPage()
+	y := top
+	next := func() {
+		y -= leading
+		if y < bottom {
+			pdf.addPage()
+			y = top
+		}
+	}
+
+	pdf.text(left, y, 20, true, "Invoice")
+	y -= 2 * leading
+	pdf.text(left, y, fontSize, true, d.HotelName)
+	next()
+	pdf.text(left, y, fontSize, false, d.HotelAddress)
+	next()
+	next()
+	pdf.text(left, y, fontSize, false, fmt.Sprintf("Booking %s, issued %s", d.Number, d.Issued))
+	next()
+	pdf.text(left, y, fontSize, false, fmt.Sprintf("%s <%s>", d.GuestName, d.GuestEmail))
+	next()
+	pdf.text(left, y, fontSize, false, fmt.Sprintf("Stay %s. Amounts in %s.", d.Stay, d.Currency))
+	next()
+	next()
+
+	row := func(row invoiceRow, bold bool) {
+		pdf.text(left, y, fontSize, bold, row.Date)
+		pdf.text(left+85, y, fontSize, bold, row.Description)
+		pdf.textRight(right-150, y, fontSize, bold, row.Quantity)
+		pdf.textRight(right-75, y, fontSize, bold, row.Unit)
+		pdf.textRight(right, y, fontSize, bold, row.Amount)
+		next()
+	}
+	total := func(total invoiceTotal, bold bool) {
+		pdf.text(right-220, y, fontSize, bold, total.Label)
+		pdf.textRight(right, y, fontSize, bold, total.Amount)
+		next()
+	}
+
+	pdf.text(left, y, fontSize, true, "Date")
+	pdf.text(left+85, y, fontSize, true, "Description")
+	pdf.text(right-170, y, fontSize, true, "Qty")
+	pdf.text(right-100, y, fontSize, true, "Unit")
+	pdf.text(right-40, y, fontSize, true, "Amount")
+	pdf.rule(left, right, y-4)
+	next()
+	for _, charge := range d.Charges {
+		row(charge, false)
+	}
+	pdf.rule(left, right, y+leading-4)
+	for i, line := range d.Totals {
+		total(line, i == len(d.Totals)-1)
+	}
+	if len(d.Payments) > 0 {
+		next()
+		for _, payment := range d.Payments {
+			row(payment, false)
+		}
+	}
+	pdf.rule(right-220, right, y+leading-4)
+	total(d.Balance, true)
+
+	return pdf.bytes()
+}
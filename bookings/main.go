@@ -9,6 +9,7 @@ import (
 
 	"github.com/dgraph-io/dgo"
 	"github.com/dgraph-io/dgo/protos/api"
+	"github.com/fluidmediaproductions/central_hotel_door_server/clients"
 	"github.com/fluidmediaproductions/central_hotel_door_server/utils"
 	"github.com/gorilla/mux"
 	"github.com/spf13/viper"
@@ -21,29 +22,16 @@ const addr = ":80"
 var db *dgo.Dgraph
 var jwtSecret []byte
 
-type Booking struct {
-	ID      string    `json:"uid"`
-	UserID  string    `json:"userId"`
-	Start   time.Time `json:"start"`
-	End     time.Time `json:"end"`
-	HotelID string    `json:"hotelId"`
-	RoomID  string    `json:"roomId"`
-}
-
-type BookingsResp struct {
-	Err      string     `json:"err"`
-	Bookings []*Booking `json:"bookings"`
-}
-
-type BookingResp struct {
-	Err     string   `json:"err"`
-	Booking *Booking `json:"booking"`
-}
+type Booking = clients.Booking
+type BookingsResp = clients.BookingsResp
+type BookingResp = clients.BookingResp
 
 type bookingQuery struct {
 	Bookings []struct {
 		Start *time.Time `json:"booking.start"`
 		End  *time.Time `json:"booking.end"`
+		Type  string `json:"booking.type"`
+		Category string `json:"booking.category"`
 		User  []struct{
 			ID    string `json:"uid"`
 		} `json:"booking.user"`
@@ -53,10 +41,60 @@ type bookingQuery struct {
 		Room  []struct{
 			ID    string `json:"uid"`
 		} `json:"booking.room"`
+		Guests []*guestQuery `json:"booking.guests"`
+		Assignments []*assignmentQuery `json:"booking.assignments"`
+		Price []*priceQuery `json:"booking.price"`
+		Payment []*paymentQuery `json:"booking.payment"`
 		ID    string `json:"uid"`
+		bookingStatus
 	} `json:"bookings"`
 }
 
+// toBookings skips bookings missing a user, hotel, room or dates, which
+// includes bookings removed by a filter on one of those edges. Bookings made
+// against a category don't need a room.
+func (q *bookingQuery) toBookings() []*Booking {
+	outBookings := make([]*Booking, 0)
+	for _, booking := range q.Bookings {
+		if len(booking.User) == 0 || len(booking.Hotel) == 0 {
+			continue
+		}
+		if len(booking.Room) == 0 && booking.Category == "" {
+			continue
+		}
+		if booking.Start == nil || booking.End == nil {
+			continue
+		}
+		outBooking := &Booking{
+			ID:       booking.ID,
+			HotelID:  booking.Hotel[0].ID,
+			Start:    *booking.Start,
+			End:      *booking.End,
+			UserID:   booking.User[0].ID,
+			Type:     booking.Type,
+			Category: booking.Category,
+		}
+		if len(booking.Room) > 0 {
+			outBooking.RoomID = booking.Room[0].ID
+		}
+		booking.bookingStatus.fill(outBooking)
+		if len(booking.Price) > 0 {
+			outBooking.Price = booking.Price[0].toQuote()
+		}
+		if len(booking.Payment) > 0 {
+			outBooking.Payment = booking.Payment[0].toPayment()
+		}
+		for _, assignment := range booking.Assignments {
+			outBooking.RoomHistory = append(outBooking.RoomHistory, assignment.toAssignment())
+		}
+		for _, guest := range booking.Guests {
+			outBooking.Guests = append(outBooking.Guests, guest.toGuest())
+		}
+		outBookings = append(outBookings, outBooking)
+	}
+	return outBookings
+}
+
 func getBookings(w http.ResponseWriter, r *http.Request) {
 	authHeaders, isOk := r.Header["Authorization"]
 	if isOk {
@@ -68,7 +106,18 @@ func getBookings(w http.ResponseWriter, r *http.Request) {
 			if err != nil {
 				w.WriteHeader(http.StatusForbidden)
 				json.NewEncoder(w).Encode(&BookingsResp{
-					Err: err.Error(),
+					Err:  err.Error(),
+					Code: utils.CodeUnauthenticated,
+				})
+				return
+			}
+
+			filter, err := parseBookingFilter(r.URL.Query())
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(&BookingsResp{
+					Err:  err.Error(),
+					Code: utils.CodeBadRequest,
 				})
 				return
 			}
@@ -77,14 +126,21 @@ func getBookings(w http.ResponseWriter, r *http.Request) {
 			txn := db.NewTxn()
 
 			variables := map[string]string{"$userID": claims.User.ID}
-			q := `query q($userID: string) {
+			dgraphFilter := filter.dgraphFilter(variables, time.Now())
+			q := utils.QueryHeader(variables) + ` {
                     var (func: uid($userID)) {
 		              u as uid
+		              b as ~booking.user
 	                }
-                    bookings(func: has(booking)) @cascade {
+                    bookings(func: uid(b)` + filter.page.Args() + `) ` + dgraphFilter + ` {
                       uid
                       booking.start
                       booking.end
+                      booking.type
+                      booking.category
+                      ` + statusFields + `
+                      ` + priceFields + `
+                      ` + paymentFields + `
                       booking.hotel {
                         uid
                       }
@@ -94,6 +150,7 @@ func getBookings(w http.ResponseWriter, r *http.Request) {
                       booking.user @filter(uid(u)) {
                         uid
                       }
+                      ` + guestFields + `
 	                }
                   }`
 
@@ -101,7 +158,8 @@ func getBookings(w http.ResponseWriter, r *http.Request) {
 			if err != nil {
 				w.WriteHeader(http.StatusInternalServerError)
 				json.NewEncoder(w).Encode(&BookingsResp{
-					Err: err.Error(),
+					Err:  err.Error(),
+					Code: utils.CodeInternal,
 				})
 				return
 			}
@@ -110,33 +168,33 @@ func getBookings(w http.ResponseWriter, r *http.Request) {
 			if err != nil {
 				w.WriteHeader(http.StatusInternalServerError)
 				json.NewEncoder(w).Encode(&BookingsResp{
-					Err: err.Error(),
+					Err:  err.Error(),
+					Code: utils.CodeInternal,
 				})
 				return
 			}
 
-			outBookings := make([]*Booking, 0)
-			for _, booking := range bookings.Bookings {
-				outBooking := &Booking{
-					ID: booking.ID,
-					HotelID: booking.Hotel[0].ID,
-					RoomID: booking.Room[0].ID,
-					Start: *booking.Start,
-					End: *booking.End,
-					UserID: booking.User[0].ID,
-				}
-				outBookings = append(outBookings, outBooking)
+			// The page is cut from what Dgraph returned, before rows are dropped,
+			// so the cursor and hasNext line up with the query
+			count, hasNext := filter.page.Limit(len(bookings.Bookings))
+			bookings.Bookings = bookings.Bookings[:count]
+			lastID := ""
+			if count > 0 {
+				lastID = bookings.Bookings[count-1].ID
 			}
+			outBookings := bookings.toBookings()
 
 			json.NewEncoder(w).Encode(&BookingsResp{
 				Bookings: outBookings,
+				PageInfo: utils.NewPageInfo(hasNext, lastID),
 			})
 			return
 		}
 	}
 	w.WriteHeader(http.StatusForbidden)
 	json.NewEncoder(w).Encode(&BookingsResp{
-		Err: "no auth header",
+		Err:  "no auth header",
+		Code: utils.CodeUnauthenticated,
 	})
 }
 
@@ -151,7 +209,8 @@ func getBooking(w http.ResponseWriter, r *http.Request) {
 			if err != nil {
 				w.WriteHeader(http.StatusForbidden)
 				json.NewEncoder(w).Encode(&BookingResp{
-					Err: err.Error(),
+					Err:  err.Error(),
+					Code: utils.CodeUnauthenticated,
 				})
 				return
 			}
@@ -168,10 +227,16 @@ func getBooking(w http.ResponseWriter, r *http.Request) {
                     var (func: uid($user)) {
 		              u as uid
 	                }
-                    bookings(func: uid($id)) @filter(has(booking)) @cascade {
+                    bookings(func: uid($id)) @filter(has(booking)) {
                       uid
                       booking.start
                       booking.end
+                      booking.type
+                      booking.category
+                      ` + statusFields + `
+                      ` + priceFields + `
+                      ` + paymentFields + `
+                      ` + roomHistoryFields + `
                       booking.hotel {
                         uid
                       }
@@ -181,6 +246,7 @@ func getBooking(w http.ResponseWriter, r *http.Request) {
                       booking.user @filter(uid(u)) {
                         uid
                       }
+                      ` + guestFields + `
 	                }
                   }`
 
@@ -188,7 +254,8 @@ func getBooking(w http.ResponseWriter, r *http.Request) {
 			if err != nil {
 				w.WriteHeader(http.StatusInternalServerError)
 				json.NewEncoder(w).Encode(&BookingsResp{
-					Err: err.Error(),
+					Err:  err.Error(),
+					Code: utils.CodeInternal,
 				})
 				return
 			}
@@ -197,44 +264,33 @@ func getBooking(w http.ResponseWriter, r *http.Request) {
 			if err != nil {
 				w.WriteHeader(http.StatusInternalServerError)
 				json.NewEncoder(w).Encode(&BookingsResp{
-					Err: err.Error(),
+					Err:  err.Error(),
+					Code: utils.CodeInternal,
 				})
 				return
 			}
 
 
-			if len(bookings.Bookings) == 0 {
+			outBookings := bookings.toBookings()
+			if len(outBookings) == 0 {
 				w.WriteHeader(http.StatusNotFound)
 				json.NewEncoder(w).Encode(&BookingResp{
-					Err: "booking not found",
+					Err:  "booking not found",
+					Code: utils.CodeNotFound,
 				})
 				return
 			}
 
-			booking := bookings.Bookings[0]
-				outBooking := &Booking{
-					ID: booking.ID,
-					HotelID: booking.Hotel[0].ID,
-					RoomID: booking.Room[0].ID,
-					Start: *booking.Start,
-					End: *booking.End,
-					UserID: booking.User[0].ID,
-				}
-
-			json.NewEncoder(w).Encode(&BookingResp{
-				Booking: outBooking,
-			})
-			return
-
 			json.NewEncoder(w).Encode(&BookingResp{
-				Booking: outBooking,
+				Booking: outBookings[0],
 			})
 			return
 		}
 	}
 	w.WriteHeader(http.StatusForbidden)
 	json.NewEncoder(w).Encode(&BookingResp{
-		Err: "no auth header",
+		Err:  "no auth header",
+		Code: utils.CodeUnauthenticated,
 	})
 }
 
@@ -249,7 +305,8 @@ func getBookingsByRoom(w http.ResponseWriter, r *http.Request) {
 			if err != nil {
 				w.WriteHeader(http.StatusForbidden)
 				json.NewEncoder(w).Encode(&BookingResp{
-					Err: err.Error(),
+					Err:  err.Error(),
+					Code: utils.CodeUnauthenticated,
 				})
 				return
 			}
@@ -269,10 +326,15 @@ func getBookingsByRoom(w http.ResponseWriter, r *http.Request) {
                     var (func: uid($id)) {
 		              r as uid
 	                }
-                    bookings(func: has(booking)) @cascade {
+                    bookings(func: has(booking)) {
                       uid
                       booking.start
                       booking.end
+                      booking.type
+                      booking.category
+                      ` + statusFields + `
+                      ` + priceFields + `
+                      ` + paymentFields + `
                       booking.hotel {
                         uid
                       }
@@ -283,13 +345,15 @@ func getBookingsByRoom(w http.ResponseWriter, r *http.Request) {
                         uid
                       }
 	                }
+                    ` + guestAccessQueryBlock + `
                   }`
 
 			resp, err := txn.QueryWithVars(ctx, q, variables)
 			if err != nil {
 				w.WriteHeader(http.StatusInternalServerError)
 				json.NewEncoder(w).Encode(&BookingsResp{
-					Err: err.Error(),
+					Err:  err.Error(),
+					Code: utils.CodeInternal,
 				})
 				return
 			}
@@ -298,33 +362,33 @@ func getBookingsByRoom(w http.ResponseWriter, r *http.Request) {
 			if err != nil {
 				w.WriteHeader(http.StatusInternalServerError)
 				json.NewEncoder(w).Encode(&BookingsResp{
-					Err: err.Error(),
+					Err:  err.Error(),
+					Code: utils.CodeInternal,
 				})
 				return
 			}
 
-			outBookings := make([]*Booking, 0)
-			for _, booking := range bookings.Bookings {
-				outBooking := &Booking{
-					ID: booking.ID,
-					HotelID: booking.Hotel[0].ID,
-					RoomID: booking.Room[0].ID,
-					Start: *booking.Start,
-					End: *booking.End,
-					UserID: booking.User[0].ID,
-				}
-				outBookings = append(outBookings, outBooking)
+			var guests guestAccessQuery
+			err = json.Unmarshal(resp.GetJson(), &guests)
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				json.NewEncoder(w).Encode(&BookingsResp{
+					Err:  err.Error(),
+					Code: utils.CodeInternal,
+				})
+				return
 			}
 
 			json.NewEncoder(w).Encode(&BookingsResp{
-				Bookings: outBookings,
+				Bookings: append(bookings.toBookings(), guests.toBookings()...),
 			})
 			return
 		}
 	}
 	w.WriteHeader(http.StatusForbidden)
 	json.NewEncoder(w).Encode(&BookingResp{
-		Err: "no auth header",
+		Err:  "no auth header",
+		Code: utils.CodeUnauthenticated,
 	})
 }
 
@@ -339,7 +403,8 @@ func getBookingsByHotel(w http.ResponseWriter, r *http.Request) {
 			if err != nil {
 				w.WriteHeader(http.StatusForbidden)
 				json.NewEncoder(w).Encode(&BookingResp{
-					Err: err.Error(),
+					Err:  err.Error(),
+					Code: utils.CodeUnauthenticated,
 				})
 				return
 			}
@@ -359,10 +424,15 @@ func getBookingsByHotel(w http.ResponseWriter, r *http.Request) {
                     var (func: uid($id)) {
 		              h as uid
 	                }
-                    bookings(func: has(booking)) @cascade {
+                    bookings(func: has(booking)) {
                       uid
                       booking.start
                       booking.end
+                      booking.type
+                      booking.category
+                      ` + statusFields + `
+                      ` + priceFields + `
+                      ` + paymentFields + `
                       booking.hotel @filter(uid(h)) {
                         uid
                       }
@@ -379,7 +449,8 @@ func getBookingsByHotel(w http.ResponseWriter, r *http.Request) {
 			if err != nil {
 				w.WriteHeader(http.StatusInternalServerError)
 				json.NewEncoder(w).Encode(&BookingsResp{
-					Err: err.Error(),
+					Err:  err.Error(),
+					Code: utils.CodeInternal,
 				})
 				return
 			}
@@ -388,33 +459,22 @@ func getBookingsByHotel(w http.ResponseWriter, r *http.Request) {
 			if err != nil {
 				w.WriteHeader(http.StatusInternalServerError)
 				json.NewEncoder(w).Encode(&BookingsResp{
-					Err: err.Error(),
+					Err:  err.Error(),
+					Code: utils.CodeInternal,
 				})
 				return
 			}
 
-			outBookings := make([]*Booking, 0)
-			for _, booking := range bookings.Bookings {
-				outBooking := &Booking{
-					ID: booking.ID,
-					HotelID: booking.Hotel[0].ID,
-					RoomID: booking.Room[0].ID,
-					Start: *booking.Start,
-					End: *booking.End,
-					UserID: booking.User[0].ID,
-				}
-				outBookings = append(outBookings, outBooking)
-			}
-
 			json.NewEncoder(w).Encode(&BookingsResp{
-				Bookings: outBookings,
+				Bookings: bookings.toBookings(),
 			})
 			return
 		}
 	}
 	w.WriteHeader(http.StatusForbidden)
 	json.NewEncoder(w).Encode(&BookingResp{
-		Err: "no auth header",
+		Err:  "no auth header",
+		Code: utils.CodeUnauthenticated,
 	})
 }
 
@@ -422,9 +482,24 @@ func router() *mux.Router {
 	r := mux.NewRouter()
 
 	r.Methods("GET").Path("/bookings").HandlerFunc(getBookings)
+	r.Methods("POST").Path("/bookings").HandlerFunc(createBooking)
 	r.Methods("GET").Path("/bookings/{id}").HandlerFunc(getBooking)
 	r.Methods("GET").Path("/bookings/by-room/{id}").HandlerFunc(getBookingsByRoom)
 	r.Methods("GET").Path("/bookings/by-hotel/{id}").HandlerFunc(getBookingsByHotel)
+	r.Methods("GET").Path("/bookings/by-user/{id}").HandlerFunc(getBookingsByUser)
+	r.Methods("GET").Path("/bookings/needs-room/{id}").HandlerFunc(getBookingsNeedingRooms)
+	r.Methods("POST").Path("/bookings/{id}/status").HandlerFunc(setStatus)
+	r.Methods("POST").Path("/bookings/{id}/room").HandlerFunc(assignRoom)
+	r.Methods("POST").Path("/bookings/{id}/type").HandlerFunc(setBookingType)
+	r.Methods("POST").Path("/bookings/{id}/guests").HandlerFunc(inviteGuest)
+	r.Methods("POST").Path("/bookings/{id}/guests/{guestId}/revoke").HandlerFunc(revokeGuest)
+	r.Methods("POST").Path("/guests/accept").HandlerFunc(acceptGuestInvite)
+	r.Methods("GET").Path("/bookings/{id}/folio").HandlerFunc(getFolio)
+	r.Methods("POST").Path("/bookings/{id}/folio/extras").HandlerFunc(postFolioExtra)
+	r.Methods("POST").Path("/bookings/{id}/folio/payments").HandlerFunc(recordFolioPayment)
+	r.Methods("GET").Path("/bookings/{id}/invoice").HandlerFunc(getInvoice)
+	r.Methods("POST").Path("/pms/{adapter}/reservations").HandlerFunc(receiveReservations)
+	r.Methods("POST").Path("/payments/{provider}/events").HandlerFunc(receivePaymentEvent)
 
 	return r
 }
@@ -443,12 +518,68 @@ func newDbClient(dbHost string) *dgo.Dgraph {
 func setupSchema(c *dgo.Dgraph) {
 	err := c.Alter(context.Background(), &api.Operation{
 		Schema: `
-			booking.start: dateTime .
-			booking.end: dateTime .
+			booking.start: dateTime @index(hour) .
+			booking.end: dateTime @index(hour) .
 			booking.hotel: uid @reverse .
 			booking.room: uid @reverse .
 			booking.user: uid @reverse .
-		`,
+			booking.type: string .
+			booking.category: string @index(exact) .
+			booking.assignments: uid @reverse .
+			assignment.room: uid @reverse .
+			assignment.start: dateTime .
+			assignment.end: dateTime .
+			assignment.by: uid .
+			booking.guests: uid @reverse .
+			booking.status: string @index(exact) .
+			booking.needsRoom: bool @index(bool) .
+			booking.checkedInAt: dateTime .
+			booking.checkedOutAt: dateTime .
+			booking.cancelledAt: dateTime .
+			booking.noShowAt: dateTime .
+			booking.pmsRef: string @index(exact) @upsert .
+			booking.price: uid .
+			price.currency: string .
+			price.subtotal: int .
+			price.total: int .
+			price.minStay: int .
+			price.quotedAt: dateTime .
+			price.roomType: uid .
+			price.ratePlan: uid .
+			price.nights: uid .
+			price.taxes: uid .
+			night.date: string .
+			night.amount: int .
+			night.season: string .
+			tax.name: string .
+			tax.percent: float .
+			tax.amount: int .
+			booking.folio: uid @reverse .
+			folio.kind: string @index(exact) .
+			folio.description: string .
+			folio.quantity: int .
+			folio.unitAmount: int .
+			folio.amount: int .
+			folio.method: string .
+			folio.reference: string @index(exact) .
+			folio.postedAt: dateTime .
+			folio.postedBy: uid .
+			booking.payment: uid @reverse .
+			payment.provider: string @index(exact) .
+			payment.ref: string @index(exact) .
+			payment.status: string @index(exact) .
+			payment.amount: int .
+			payment.currency: string .
+			payment.capturedAt: dateTime .
+			payment.refundedAt: dateTime .
+			payment.failedAt: dateTime .
+			guest.email: string @index(hash) .
+			guest.user: uid @reverse .
+			guest.start: dateTime .
+			guest.end: dateTime .
+			guest.revoked: bool .
+			guest.token: string @index(exact) .
+		` + utils.AuditSchema,
 	})
 	if err != nil {
 		log.Fatalf("Error setting up schema: %v\n", err)
@@ -457,6 +588,9 @@ func setupSchema(c *dgo.Dgraph) {
 
 func main() {
 	viper.SetDefault("DB_HOST", "dgraph-server-public:9080")
+	viper.SetDefault("PMS_POLL_INTERVAL", "1m")
+	viper.SetDefault("NO_SHOW_INTERVAL", "15m")
+	viper.SetDefault("NO_SHOW_GRACE", "24h")
 
 	viper.SetEnvPrefix("TRAVELR")
 	viper.AutomaticEnv()
@@ -469,6 +603,23 @@ func main() {
 
 	setupSchema(db)
 
+	go runNoShowJob(viper.GetDuration("NO_SHOW_INTERVAL"), viper.GetDuration("NO_SHOW_GRACE"))
+
+	if secret := viper.GetString("PMS_WEBHOOK_SECRET"); secret != "" {
+		pmsReceivers["json"] = &jsonAdapter{secret: []byte(secret)}
+	}
+	if viper.GetString("PAYMENT_PROVIDER") == "local" {
+		secret := viper.GetString("PAYMENT_WEBHOOK_SECRET")
+		if secret == "" {
+			log.Fatalln("The local payment provider needs a PAYMENT_WEBHOOK_SECRET")
+		}
+		log.Println("Taking payments with the local provider, which doesn't charge anyone")
+		payments = newLocalProvider([]byte(secret))
+	}
+	if dir := viper.GetString("PMS_DROP_DIR"); dir != "" {
+		go pollPMS(&fileAdapter{dir: dir}, viper.GetDuration("PMS_POLL_INTERVAL"))
+	}
+
 	log.Printf("Listening on %s\n", addr)
 	log.Fatalln(http.ListenAndServe(addr, router()))
 }
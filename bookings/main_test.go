@@ -2,644 +2,410 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
-	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
-	"regexp"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/dgraph-io/dgo"
+	"github.com/dgraph-io/dgo/protos/api"
+	"github.com/fluidmediaproductions/central_hotel_door_server/clients"
 	"github.com/fluidmediaproductions/central_hotel_door_server/utils"
-	"github.com/jinzhu/gorm"
-	"gopkg.in/DATA-DOG/go-sqlmock.v1"
-	"log"
+	"google.golang.org/grpc"
 )
 
-func fixedFullRe(s string) string {
-	return fmt.Sprintf("^%s$", regexp.QuoteMeta(s))
+// fakeDgraph stands in for a Dgraph server. Each query is answered with the
+// JSON of the first expectation whose text it contains, and mutations are
+// recorded for the test to look at.
+type fakeDgraph struct {
+	api.DgraphClient
+	t         *testing.T
+	queries   []*fakeQuery
+	mutations []*api.Mutation
 }
 
-func newDB(t *testing.T) (sqlmock.Sqlmock, *gorm.DB) {
-	db, mock, err := sqlmock.New()
-	if err != nil {
-		t.Fatalf("can't create sqlmock: %s", err)
-	}
+type fakeQuery struct {
+	contains string
+	json     string
+	err      error
+}
 
-	gormDB, gerr := gorm.Open("mysql", db)
-	if gerr != nil {
-		t.Fatalf("can't open gorm connection: %s", err)
-	}
+func (f *fakeDgraph) expectQuery(contains string, json string) {
+	f.queries = append(f.queries, &fakeQuery{contains: contains, json: json})
+}
 
-	return mock, gormDB.Set("gorm:update_column", true)
+func (f *fakeDgraph) failQuery(contains string, err error) {
+	f.queries = append(f.queries, &fakeQuery{contains: contains, err: err})
 }
 
-func getRowsForBookings(bookings []*Booking) *sqlmock.Rows {
-	var bookingFieldNames = []string{"id", "hotel_id", "user_id", "room_id", "start", "end", "created_at", "updated_at", "deleted_at"}
-	rows := sqlmock.NewRows(bookingFieldNames)
-	for _, b := range bookings {
-		rows = rows.AddRow(b.ID, b.HotelID, b.UserID, b.RoomID, b.Start, b.End, b.CreatedAt, b.UpdatedAt, b.DeletedAt)
-	}
-	return rows
+func (f *fakeDgraph) Query(ctx context.Context, in *api.Request, opts ...grpc.CallOption) (*api.Response, error) {
+	for _, query := range f.queries {
+		if strings.Contains(in.Query, query.contains) {
+			if query.err != nil {
+				return nil, query.err
+			}
+			return &api.Response{Json: []byte(query.json)}, nil
+		}
+	}
+	f.t.Errorf("Unexpected query %s", in.Query)
+	return nil, errors.New("unexpected query")
 }
 
-func TestGetBookings(t *testing.T) {
-	sqlMock, dbMock := newDB(t)
+func (f *fakeDgraph) Mutate(ctx context.Context, in *api.Mutation, opts ...grpc.CallOption) (*api.Assigned, error) {
+	f.mutations = append(f.mutations, in)
+	return &api.Assigned{Uids: map[string]string{}}, nil
+}
 
+// useFakeDB points the service at a fake Dgraph until the returned func is
+// called.
+func useFakeDB(t *testing.T) (*fakeDgraph, func()) {
+	fake := &fakeDgraph{t: t}
 	oldDb := db
-	db = dbMock
-
-	user := &utils.User{
-		Model: gorm.Model{
-			ID: 1,
-		},
+	db = dgo.NewDgraphClient(fake)
+	return fake, func() {
+		db = oldDb
 	}
-	jwt, err := utils.NewJWT(user)
+}
+
+func newTestJWT(t *testing.T, user *utils.User) string {
+	jwt, err := utils.NewJWT(user, jwtSecret)
 	if err != nil {
-		log.Fatalf("Error making JWT: %v", err)
+		t.Fatalf("Error making JWT: %v", err)
 	}
+	return jwt
+}
 
-	req := httptest.NewRequest("GET", "http://a/bookings", nil)
-	req.Header.Set("Authorization", "Bearer "+jwt)
-	w := httptest.NewRecorder()
-
-	bookings := []*Booking{
-		{
-			Model: gorm.Model{
-				ID:        uint(1),
-				CreatedAt: time.Now(),
-				UpdatedAt: time.Now(),
-			},
-			UserID:  1,
-			HotelID: 1,
-		},
+func doRequest(method string, url string, jwt string) (*http.Response, []byte) {
+	req := httptest.NewRequest(method, url, nil)
+	if jwt != "" {
+		req.Header.Set("Authorization", "Bearer "+jwt)
 	}
-
-	sqlMock.ExpectQuery(fixedFullRe("SELECT * FROM `bookings` WHERE `bookings`.`deleted_at` IS NULL AND ((`bookings`.`user_id` = ?))")).
-		WithArgs(1).
-		WillReturnRows(getRowsForBookings(bookings))
-
+	w := httptest.NewRecorder()
 	router().ServeHTTP(w, req)
 
 	resp := w.Result()
 	body, _ := ioutil.ReadAll(resp.Body)
-
-	expBody := &bytes.Buffer{}
-	err = json.NewEncoder(expBody).Encode(&BookingsResp{
-		Bookings: bookings,
-	})
-	if err != nil {
-		t.Fatalf("Error creating test JSON: %v", err)
-	}
-
-	if string(body) != string(expBody.Bytes()) {
-		t.Errorf("Response not what was expected, got %s wanted %s", string(body), string(expBody.Bytes()))
-	}
-
-	req = httptest.NewRequest("GET", "http://a/bookings", nil)
-	req.Header.Set("Authorization", "Bearer "+jwt)
-	w = httptest.NewRecorder()
-
-	sqlMock.ExpectQuery(fixedFullRe("SELECT * FROM `bookings` WHERE `bookings`.`deleted_at` IS NULL AND ((`bookings`.`user_id` = ?))")).
-		WithArgs(1).
-		WillReturnError(errors.New("foobar"))
-
-	router().ServeHTTP(w, req)
-
-	resp = w.Result()
-	body, _ = ioutil.ReadAll(resp.Body)
-
-	if resp.StatusCode != http.StatusInternalServerError {
-		t.Errorf("Expected 500 error got %s", resp.Status)
-	}
-
-	expBody = &bytes.Buffer{}
-	err = json.NewEncoder(expBody).Encode(&BookingsResp{
-		Err: "foobar",
-	})
-	if err != nil {
-		t.Fatalf("Error creating test JSON: %v", err)
-	}
-
-	if string(body) != string(expBody.Bytes()) {
-		t.Errorf("Response not what was expected, got %s wanted %s", string(body), string(expBody.Bytes()))
-	}
-
-	req = httptest.NewRequest("GET", "http://a/bookings", nil)
-	w = httptest.NewRecorder()
-
-	router().ServeHTTP(w, req)
-
-	resp = w.Result()
-	body, _ = ioutil.ReadAll(resp.Body)
-
-	expBody = &bytes.Buffer{}
-	err = json.NewEncoder(expBody).Encode(&BookingsResp{
-		Err: "no auth header",
-	})
-	if err != nil {
-		t.Fatalf("Error creating test JSON: %v", err)
-	}
-
-	if string(body) != string(expBody.Bytes()) {
-		t.Errorf("Response not what was expected, got %s wanted %s", string(body), string(expBody.Bytes()))
-	}
-
-	req = httptest.NewRequest("GET", "http://a/bookings", nil)
-	req.Header.Set("Authorization", "Bearer a")
-	w = httptest.NewRecorder()
-
-	router().ServeHTTP(w, req)
-
-	resp = w.Result()
-	body, _ = ioutil.ReadAll(resp.Body)
-
-	expBody = &bytes.Buffer{}
-	err = json.NewEncoder(expBody).Encode(&BookingsResp{
-		Err: "token contains an invalid number of segments",
-	})
-	if err != nil {
-		t.Fatalf("Error creating test JSON: %v", err)
-	}
-
-	if string(body) != string(expBody.Bytes()) {
-		t.Errorf("Response not what was expected, got %s wanted %s", string(body), string(expBody.Bytes()))
-	}
-
-	db = oldDb
+	return resp, body
 }
 
-func TestGetBooking(t *testing.T) {
-	sqlMock, dbMock := newDB(t)
-
-	oldDb := db
-	db = dbMock
-
-	user := &utils.User{
-		Model: gorm.Model{
-			ID: 1,
-		},
-	}
-	jwt, err := utils.NewJWT(user)
-	if err != nil {
-		log.Fatalf("Error making JWT: %v", err)
+func doJSONRequest(method string, url string, jwt string, body string) (*http.Response, []byte) {
+	req := httptest.NewRequest(method, url, strings.NewReader(body))
+	if jwt != "" {
+		req.Header.Set("Authorization", "Bearer "+jwt)
 	}
-
-	req := httptest.NewRequest("GET", "http://a/bookings/1", nil)
-	req.Header.Set("Authorization", "Bearer "+jwt)
 	w := httptest.NewRecorder()
-
-	booking := &Booking{
-		Model: gorm.Model{
-			ID:        uint(1),
-			CreatedAt: time.Now(),
-			UpdatedAt: time.Now(),
-		},
-		UserID:  1,
-		HotelID: 1,
-	}
-
-	sqlMock.ExpectQuery(fixedFullRe("SELECT * FROM `bookings` WHERE `bookings`.`deleted_at` IS NULL AND ((`bookings`.`id` = 1))")).
-		WillReturnRows(getRowsForBookings([]*Booking{booking}))
-
 	router().ServeHTTP(w, req)
 
 	resp := w.Result()
-	body, _ := ioutil.ReadAll(resp.Body)
+	respBody, _ := ioutil.ReadAll(resp.Body)
+	return resp, respBody
+}
 
+func encodeResp(t *testing.T, v interface{}) string {
 	expBody := &bytes.Buffer{}
-	err = json.NewEncoder(expBody).Encode(&BookingResp{
-		Booking: booking,
-	})
+	err := json.NewEncoder(expBody).Encode(v)
 	if err != nil {
 		t.Fatalf("Error creating test JSON: %v", err)
 	}
+	return expBody.String()
+}
 
-	if string(body) != string(expBody.Bytes()) {
-		t.Errorf("Response not what was expected, got %s wanted %s", string(body), string(expBody.Bytes()))
+// expectAuthErrors checks a GET without a JWT, or with one that can't be
+// read, is turned away.
+func expectAuthErrors(t *testing.T, url string) {
+	for jwt, expErr := range map[string]string{
+		"":  "no auth header",
+		"a": "token contains an invalid number of segments",
+	} {
+		resp, body := doRequest("GET", url, jwt)
+		var errResp struct {
+			Err  string `json:"err"`
+			Code string `json:"code"`
+		}
+		json.Unmarshal(body, &errResp)
+		if resp.StatusCode != http.StatusForbidden || errResp.Err != expErr || errResp.Code != utils.CodeUnauthenticated {
+			t.Errorf("Expected 403 error %q for %s with JWT %q, got %s %s", expErr, url, jwt, resp.Status, string(body))
+		}
 	}
+}
 
-	req = httptest.NewRequest("GET", "http://a/bookings/1", nil)
-	req.Header.Set("Authorization", "Bearer "+jwt)
-	w = httptest.NewRecorder()
-
-	sqlMock.ExpectQuery(fixedFullRe("SELECT * FROM `bookings` WHERE `bookings`.`deleted_at` IS NULL AND ((`bookings`.`id` = 1))")).
-		WillReturnRows(getRowsForBookings([]*Booking{}))
-
-	router().ServeHTTP(w, req)
-
-	resp = w.Result()
-	body, _ = ioutil.ReadAll(resp.Body)
-
-	expBody = &bytes.Buffer{}
-	err = json.NewEncoder(expBody).Encode(&BookingResp{
-		Err: "booking not found",
-	})
-	if err != nil {
-		t.Fatalf("Error creating test JSON: %v", err)
-	}
+var testStart = time.Date(2030, 1, 1, 14, 0, 0, 0, time.UTC)
+var testEnd = testStart.Add(48 * time.Hour)
 
-	if string(body) != string(expBody.Bytes()) {
-		t.Errorf("Response not what was expected, got %s wanted %s", string(body), string(expBody.Bytes()))
+const testBookingsJSON = `{
+	"bookings": [
+		{
+			"uid": "0x10",
+			"booking.start": "2030-01-01T14:00:00Z",
+			"booking.end": "2030-01-03T14:00:00Z",
+			"booking.hotel": [{"uid": "0x1"}],
+			"booking.room": [{"uid": "0x2"}],
+			"booking.user": [{"uid": "0x3"}]
+		},
+		{
+			"uid": "0x11",
+			"booking.start": "2030-01-01T14:00:00Z",
+			"booking.end": "2030-01-03T14:00:00Z",
+			"booking.hotel": [{"uid": "0x1"}],
+			"booking.room": [{"uid": "0x2"}]
+		}
+	]
+}`
+
+func testBooking() *Booking {
+	return &Booking{
+		ID:      "0x10",
+		HotelID: "0x1",
+		RoomID:  "0x2",
+		UserID:  "0x3",
+		Start:   testStart,
+		End:     testEnd,
+		Status:  clients.BookingConfirmed,
 	}
+}
 
-	req = httptest.NewRequest("GET", "http://a/bookings/1", nil)
-	req.Header.Set("Authorization", "Bearer "+jwt)
-	w = httptest.NewRecorder()
+func TestGetBookings(t *testing.T) {
+	fake, restore := useFakeDB(t)
+	defer restore()
 
-	sqlMock.ExpectQuery(fixedFullRe("SELECT * FROM `bookings` WHERE `bookings`.`deleted_at` IS NULL AND ((`bookings`.`id` = 1))")).
-		WillReturnError(errors.New("foobar"))
+	jwt := newTestJWT(t, &utils.User{ID: "0x3"})
 
-	router().ServeHTTP(w, req)
+	fake.expectQuery("bookings(func: uid(b)", testBookingsJSON)
+	resp, body := doRequest("GET", "http://a/bookings", jwt)
 
-	resp = w.Result()
-	body, _ = ioutil.ReadAll(resp.Body)
-
-	expBody = &bytes.Buffer{}
-	err = json.NewEncoder(expBody).Encode(&BookingResp{
-		Err: "foobar",
+	// The second booking isn't the user's, so the query's filter left it
+	// without a user. The cursor still goes past it.
+	expBody := encodeResp(t, &BookingsResp{
+		Bookings: []*Booking{testBooking()},
+		PageInfo: utils.NewPageInfo(false, "0x11"),
 	})
-	if err != nil {
-		t.Fatalf("Error creating test JSON: %v", err)
+	if resp.StatusCode != http.StatusOK || string(body) != expBody {
+		t.Errorf("Response not what was expected, got %s %s wanted %s", resp.Status, string(body), expBody)
 	}
 
-	if string(body) != string(expBody.Bytes()) {
-		t.Errorf("Response not what was expected, got %s wanted %s", string(body), string(expBody.Bytes()))
-	}
-
-	req = httptest.NewRequest("GET", "http://a/bookings/1", nil)
-	req.Header.Set("Authorization", "Bearer a")
-	w = httptest.NewRecorder()
-
-	router().ServeHTTP(w, req)
-
-	resp = w.Result()
-	body, _ = ioutil.ReadAll(resp.Body)
-
-	expBody = &bytes.Buffer{}
-	err = json.NewEncoder(expBody).Encode(&BookingResp{
-		Err: "token contains an invalid number of segments",
+	// The extra booking fetched to check for another page counts even though
+	// it's dropped
+	resp, body = doRequest("GET", "http://a/bookings?first=1", jwt)
+	expBody = encodeResp(t, &BookingsResp{
+		Bookings: []*Booking{testBooking()},
+		PageInfo: utils.NewPageInfo(true, "0x10"),
 	})
-	if err != nil {
-		t.Fatalf("Error creating test JSON: %v", err)
+	if resp.StatusCode != http.StatusOK || string(body) != expBody {
+		t.Errorf("Response not what was expected, got %s %s wanted %s", resp.Status, string(body), expBody)
 	}
 
-	if string(body) != string(expBody.Bytes()) {
-		t.Errorf("Response not what was expected, got %s wanted %s", string(body), string(expBody.Bytes()))
-	}
-
-	req = httptest.NewRequest("GET", "http://a/bookings/1", nil)
-	w = httptest.NewRecorder()
-
-	router().ServeHTTP(w, req)
+	fake.queries = nil
+	fake.failQuery("bookings(func: uid(b)", errors.New("foobar"))
+	resp, body = doRequest("GET", "http://a/bookings", jwt)
 
-	resp = w.Result()
-	body, _ = ioutil.ReadAll(resp.Body)
-
-	expBody = &bytes.Buffer{}
-	err = json.NewEncoder(expBody).Encode(&BookingResp{
-		Err: "no auth header",
+	expBody = encodeResp(t, &BookingsResp{
+		Err:  "foobar",
+		Code: utils.CodeInternal,
 	})
-	if err != nil {
-		t.Fatalf("Error creating test JSON: %v", err)
+	if resp.StatusCode != http.StatusInternalServerError || string(body) != expBody {
+		t.Errorf("Expected 500 error, got %s %s", resp.Status, string(body))
 	}
 
-	if string(body) != string(expBody.Bytes()) {
-		t.Errorf("Response not what was expected, got %s wanted %s", string(body), string(expBody.Bytes()))
-	}
-
-	req = httptest.NewRequest("GET", "http://a/bookings/1", nil)
-	req.Header.Set("Authorization", "Bearer "+jwt)
-	w = httptest.NewRecorder()
-
-	booking = &Booking{
-		Model: gorm.Model{
-			ID:        uint(1),
-			CreatedAt: time.Now(),
-			UpdatedAt: time.Now(),
-		},
-		UserID:  2,
-		HotelID: 1,
+	resp, body = doRequest("GET", "http://a/bookings?first=0", jwt)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected 400 error with a bad page size, got %s %s", resp.Status, string(body))
 	}
 
-	sqlMock.ExpectQuery(fixedFullRe("SELECT * FROM `bookings` WHERE `bookings`.`deleted_at` IS NULL AND ((`bookings`.`id` = 1))")).
-		WillReturnRows(getRowsForBookings([]*Booking{booking}))
-
-	router().ServeHTTP(w, req)
-
-	resp = w.Result()
-	body, _ = ioutil.ReadAll(resp.Body)
-
-	expBody = &bytes.Buffer{}
-	err = json.NewEncoder(expBody).Encode(&BookingResp{
-		Err: "booking not owned by user",
-	})
-	if err != nil {
-		t.Fatalf("Error creating test JSON: %v", err)
-	}
-
-	if string(body) != string(expBody.Bytes()) {
-		t.Errorf("Response not what was expected, got %s wanted %s", string(body), string(expBody.Bytes()))
-	}
-
-	db = oldDb
+	expectAuthErrors(t, "http://a/bookings")
 }
 
-func TestGetBookingByHotel(t *testing.T) {
-	sqlMock, dbMock := newDB(t)
-
-	oldDb := db
-	db = dbMock
-
-	user := &utils.User{
-		Model: gorm.Model{
-			ID: 1,
-		},
-	}
-	jwt, err := utils.NewJWT(user)
-	if err != nil {
-		log.Fatalf("Error making JWT: %v", err)
-	}
-
-	req := httptest.NewRequest("GET", "http://a/bookings/by-hotel/1", nil)
-	req.Header.Set("Authorization", "Bearer "+jwt)
-	w := httptest.NewRecorder()
-
-	booking := &Booking{
-		Model: gorm.Model{
-			ID:        uint(1),
-			CreatedAt: time.Now(),
-			UpdatedAt: time.Now(),
-		},
-		UserID:  1,
-		HotelID: 1,
-	}
+func TestGetBooking(t *testing.T) {
+	fake, restore := useFakeDB(t)
+	defer restore()
 
-	sqlMock.ExpectQuery(fixedFullRe("SELECT * FROM `bookings` WHERE `bookings`.`deleted_at` IS NULL AND ((`bookings`.`user_id` = ?)"+
-		" AND (`bookings`.`hotel_id` = ?))")).
-		WithArgs(1, 1).
-		WillReturnRows(getRowsForBookings([]*Booking{booking}))
+	jwt := newTestJWT(t, &utils.User{ID: "0x3"})
 
-	router().ServeHTTP(w, req)
+	fake.expectQuery("bookings(func: uid($id))", testBookingsJSON)
+	resp, body := doRequest("GET", "http://a/bookings/0x10", jwt)
 
-	resp := w.Result()
-	body, _ := ioutil.ReadAll(resp.Body)
-
-	expBody := &bytes.Buffer{}
-	err = json.NewEncoder(expBody).Encode(&BookingResp{
-		Booking: booking,
+	expBody := encodeResp(t, &BookingResp{
+		Booking: testBooking(),
 	})
-	if err != nil {
-		t.Fatalf("Error creating test JSON: %v", err)
-	}
-
-	if string(body) != string(expBody.Bytes()) {
-		t.Errorf("Response not what was expected, got %s wanted %s", string(body), string(expBody.Bytes()))
+	if resp.StatusCode != http.StatusOK || string(body) != expBody {
+		t.Errorf("Response not what was expected, got %s %s wanted %s", resp.Status, string(body), expBody)
 	}
 
-	req = httptest.NewRequest("GET", "http://a/bookings/by-hotel/2", nil)
-	req.Header.Set("Authorization", "Bearer "+jwt)
-	w = httptest.NewRecorder()
-
-	sqlMock.ExpectQuery(fixedFullRe("SELECT * FROM `bookings` WHERE `bookings`.`deleted_at` IS NULL AND ((`bookings`.`user_id` = ?)"+
-		" AND (`bookings`.`hotel_id` = ?))")).
-		WithArgs(1, 2).
-		WillReturnRows(getRowsForBookings([]*Booking{}))
-
-	router().ServeHTTP(w, req)
-
-	resp = w.Result()
-	body, _ = ioutil.ReadAll(resp.Body)
+	fake.queries = nil
+	fake.expectQuery("bookings(func: uid($id))", `{"bookings": []}`)
+	resp, body = doRequest("GET", "http://a/bookings/0x12", jwt)
 
-	expBody = &bytes.Buffer{}
-	err = json.NewEncoder(expBody).Encode(&BookingResp{
-		Err: "booking not found",
+	expBody = encodeResp(t, &BookingResp{
+		Err:  "booking not found",
+		Code: utils.CodeNotFound,
 	})
-	if err != nil {
-		t.Fatalf("Error creating test JSON: %v", err)
-	}
-
-	if string(body) != string(expBody.Bytes()) {
-		t.Errorf("Response not what was expected, got %s wanted %s", string(body), string(expBody.Bytes()))
-	}
-
-	req = httptest.NewRequest("GET", "http://a/bookings/by-hotel/1", nil)
-	req.Header.Set("Authorization", "Bearer "+jwt)
-	w = httptest.NewRecorder()
+	if resp.StatusCode != http.StatusNotFound || string(body) != expBody {
+		t.Errorf("Expected 404 error, got %s %s", resp.Status, string(body))
+	}
+
+	// Another user's booking comes back without its user, so it isn't found
+	fake.queries = nil
+	fake.expectQuery("bookings(func: uid($id))", `{
+		"bookings": [
+			{
+				"uid": "0x11",
+				"booking.start": "2030-01-01T14:00:00Z",
+				"booking.end": "2030-01-03T14:00:00Z",
+				"booking.hotel": [{"uid": "0x1"}],
+				"booking.room": [{"uid": "0x2"}]
+			}
+		]
+	}`)
+	resp, body = doRequest("GET", "http://a/bookings/0x11", jwt)
+	if resp.StatusCode != http.StatusNotFound || string(body) != expBody {
+		t.Errorf("Expected 404 error for another user's booking, got %s %s", resp.Status, string(body))
+	}
+
+	fake.queries = nil
+	fake.failQuery("bookings(func: uid($id))", errors.New("foobar"))
+	resp, body = doRequest("GET", "http://a/bookings/0x10", jwt)
+	var errResp BookingResp
+	json.Unmarshal(body, &errResp)
+	if resp.StatusCode != http.StatusInternalServerError || errResp.Err != "foobar" || errResp.Code != utils.CodeInternal {
+		t.Errorf("Expected 500 error, got %s %s", resp.Status, string(body))
+	}
+
+	expectAuthErrors(t, "http://a/bookings/0x10")
+}
 
-	sqlMock.ExpectQuery(fixedFullRe("SELECT * FROM `bookings` WHERE `bookings`.`deleted_at` IS NULL AND ((`bookings`.`user_id` = ?)"+
-		" AND (`bookings`.`hotel_id` = ?))")).
-		WithArgs(1, 1).
-		WillReturnError(errors.New("foobar"))
+func TestGetBookingByHotel(t *testing.T) {
+	fake, restore := useFakeDB(t)
+	defer restore()
 
-	router().ServeHTTP(w, req)
+	jwt := newTestJWT(t, &utils.User{ID: "0x3"})
 
-	resp = w.Result()
-	body, _ = ioutil.ReadAll(resp.Body)
+	fake.expectQuery("h as uid", testBookingsJSON)
+	resp, body := doRequest("GET", "http://a/bookings/by-hotel/0x1", jwt)
 
-	expBody = &bytes.Buffer{}
-	err = json.NewEncoder(expBody).Encode(&BookingResp{
-		Err: "foobar",
+	expBody := encodeResp(t, &BookingsResp{
+		Bookings: []*Booking{testBooking()},
 	})
-	if err != nil {
-		t.Fatalf("Error creating test JSON: %v", err)
+	if resp.StatusCode != http.StatusOK || string(body) != expBody {
+		t.Errorf("Response not what was expected, got %s %s wanted %s", resp.Status, string(body), expBody)
 	}
 
-	if string(body) != string(expBody.Bytes()) {
-		t.Errorf("Response not what was expected, got %s wanted %s", string(body), string(expBody.Bytes()))
-	}
-
-	req = httptest.NewRequest("GET", "http://a/bookings/by-hotel/1", nil)
-	req.Header.Set("Authorization", "Bearer a")
-	w = httptest.NewRecorder()
-
-	router().ServeHTTP(w, req)
+	fake.queries = nil
+	fake.expectQuery("h as uid", `{"bookings": []}`)
+	resp, body = doRequest("GET", "http://a/bookings/by-hotel/0x1", jwt)
 
-	resp = w.Result()
-	body, _ = ioutil.ReadAll(resp.Body)
-
-	expBody = &bytes.Buffer{}
-	err = json.NewEncoder(expBody).Encode(&BookingResp{
-		Err: "token contains an invalid number of segments",
+	expBody = encodeResp(t, &BookingsResp{
+		Bookings: []*Booking{},
 	})
-	if err != nil {
-		t.Fatalf("Error creating test JSON: %v", err)
+	if resp.StatusCode != http.StatusOK || string(body) != expBody {
+		t.Errorf("Expected no bookings, got %s %s", resp.Status, string(body))
 	}
 
-	if string(body) != string(expBody.Bytes()) {
-		t.Errorf("Response not what was expected, got %s wanted %s", string(body), string(expBody.Bytes()))
-	}
-
-	req = httptest.NewRequest("GET", "http://a/bookings/by-hotel/1", nil)
-	w = httptest.NewRecorder()
-
-	router().ServeHTTP(w, req)
+	fake.queries = nil
+	fake.failQuery("h as uid", errors.New("foobar"))
+	resp, body = doRequest("GET", "http://a/bookings/by-hotel/0x1", jwt)
 
-	resp = w.Result()
-	body, _ = ioutil.ReadAll(resp.Body)
-
-	expBody = &bytes.Buffer{}
-	err = json.NewEncoder(expBody).Encode(&BookingResp{
-		Err: "no auth header",
+	expBody = encodeResp(t, &BookingsResp{
+		Err:  "foobar",
+		Code: utils.CodeInternal,
 	})
-	if err != nil {
-		t.Fatalf("Error creating test JSON: %v", err)
-	}
-
-	if string(body) != string(expBody.Bytes()) {
-		t.Errorf("Response not what was expected, got %s wanted %s", string(body), string(expBody.Bytes()))
+	if resp.StatusCode != http.StatusInternalServerError || string(body) != expBody {
+		t.Errorf("Expected 500 error, got %s %s", resp.Status, string(body))
 	}
 
-	db = oldDb
+	expectAuthErrors(t, "http://a/bookings/by-hotel/0x1")
 }
 
 func TestGetBookingByRoom(t *testing.T) {
-	sqlMock, dbMock := newDB(t)
-
-	oldDb := db
-	db = dbMock
-
-	user := &utils.User{
-		Model: gorm.Model{
-			ID: 1,
-		},
-	}
-	jwt, err := utils.NewJWT(user)
-	if err != nil {
-		log.Fatalf("Error making JWT: %v", err)
-	}
-
-	req := httptest.NewRequest("GET", "http://a/bookings/by-room/1", nil)
-	req.Header.Set("Authorization", "Bearer "+jwt)
-	w := httptest.NewRecorder()
-
-	booking := &Booking{
-		Model: gorm.Model{
-			ID:        uint(1),
-			CreatedAt: time.Now(),
-			UpdatedAt: time.Now(),
-		},
-		UserID:  1,
-		HotelID: 1,
-		RoomID:  1,
-	}
+	fake, restore := useFakeDB(t)
+	defer restore()
 
-	sqlMock.ExpectQuery(fixedFullRe("SELECT * FROM `bookings` WHERE `bookings`.`deleted_at` IS NULL AND ((`bookings`.`user_id` = ?)"+
-		" AND (`bookings`.`room_id` = ?))")).
-		WithArgs(1, 1).
-		WillReturnRows(getRowsForBookings([]*Booking{booking}))
-
-	router().ServeHTTP(w, req)
+	jwt := newTestJWT(t, &utils.User{ID: "0x3", Email: "foo@bar.com"})
 
-	resp := w.Result()
-	body, _ := ioutil.ReadAll(resp.Body)
+	fake.expectQuery("r as uid", testBookingsJSON)
+	resp, body := doRequest("GET", "http://a/bookings/by-room/0x2", jwt)
 
-	expBody := &bytes.Buffer{}
-	err = json.NewEncoder(expBody).Encode(&BookingResp{
-		Booking: booking,
+	expBody := encodeResp(t, &BookingsResp{
+		Bookings: []*Booking{testBooking()},
 	})
-	if err != nil {
-		t.Fatalf("Error creating test JSON: %v", err)
-	}
-
-	if string(body) != string(expBody.Bytes()) {
-		t.Errorf("Response not what was expected, got %s wanted %s", string(body), string(expBody.Bytes()))
+	if resp.StatusCode != http.StatusOK || string(body) != expBody {
+		t.Errorf("Response not what was expected, got %s %s wanted %s", resp.Status, string(body), expBody)
 	}
 
-	req = httptest.NewRequest("GET", "http://a/bookings/by-room/2", nil)
-	req.Header.Set("Authorization", "Bearer "+jwt)
-	w = httptest.NewRecorder()
-
-	sqlMock.ExpectQuery(fixedFullRe("SELECT * FROM `bookings` WHERE `bookings`.`deleted_at` IS NULL AND ((`bookings`.`user_id` = ?)"+
-		" AND (`bookings`.`room_id` = ?))")).
-		WithArgs(1, 2).
-		WillReturnRows(getRowsForBookings([]*Booking{}))
-
-	router().ServeHTTP(w, req)
-
-	resp = w.Result()
-	body, _ = ioutil.ReadAll(resp.Body)
+	fake.queries = nil
+	fake.expectQuery("r as uid", `{"bookings": []}`)
+	resp, body = doRequest("GET", "http://a/bookings/by-room/0x2", jwt)
 
-	expBody = &bytes.Buffer{}
-	err = json.NewEncoder(expBody).Encode(&BookingResp{
-		Err: "booking not found",
+	expBody = encodeResp(t, &BookingsResp{
+		Bookings: []*Booking{},
 	})
-	if err != nil {
-		t.Fatalf("Error creating test JSON: %v", err)
-	}
-
-	if string(body) != string(expBody.Bytes()) {
-		t.Errorf("Response not what was expected, got %s wanted %s", string(body), string(expBody.Bytes()))
+	if resp.StatusCode != http.StatusOK || string(body) != expBody {
+		t.Errorf("Expected no bookings, got %s %s", resp.Status, string(body))
 	}
 
-	req = httptest.NewRequest("GET", "http://a/bookings/by-room/1", nil)
-	req.Header.Set("Authorization", "Bearer "+jwt)
-	w = httptest.NewRecorder()
-
-	sqlMock.ExpectQuery(fixedFullRe("SELECT * FROM `bookings` WHERE `bookings`.`deleted_at` IS NULL AND ((`bookings`.`user_id` = ?)"+
-		" AND (`bookings`.`room_id` = ?))")).
-		WithArgs(1, 1).
-		WillReturnError(errors.New("foobar"))
-
-	router().ServeHTTP(w, req)
-
-	resp = w.Result()
-	body, _ = ioutil.ReadAll(resp.Body)
+	fake.queries = nil
+	fake.failQuery("r as uid", errors.New("foobar"))
+	resp, body = doRequest("GET", "http://a/bookings/by-room/0x2", jwt)
 
-	expBody = &bytes.Buffer{}
-	err = json.NewEncoder(expBody).Encode(&BookingResp{
-		Err: "foobar",
+	expBody = encodeResp(t, &BookingsResp{
+		Err:  "foobar",
+		Code: utils.CodeInternal,
 	})
-	if err != nil {
-		t.Fatalf("Error creating test JSON: %v", err)
-	}
-
-	if string(body) != string(expBody.Bytes()) {
-		t.Errorf("Response not what was expected, got %s wanted %s", string(body), string(expBody.Bytes()))
+	if resp.StatusCode != http.StatusInternalServerError || string(body) != expBody {
+		t.Errorf("Expected 500 error, got %s %s", resp.Status, string(body))
 	}
 
-	req = httptest.NewRequest("GET", "http://a/bookings/by-room/1", nil)
-	req.Header.Set("Authorization", "Bearer a")
-	w = httptest.NewRecorder()
+	expectAuthErrors(t, "http://a/bookings/by-room/0x2")
+}
 
+func TestSetBookingType(t *testing.T) {
+	fake, restore := useFakeDB(t)
+	defer restore()
+
+	admin := newTestJWT(t, &utils.User{ID: "0x9", Roles: []string{utils.RoleAdmin}})
+	frontDesk := newTestJWT(t, &utils.User{ID: "0x8", Roles: []string{utils.RoleFrontDesk}})
+
+	resp, _ := doRequest("POST", "http://a/bookings/0x10/type", frontDesk)
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("Expected 403 error for the front desk, got %s", resp.Status)
+	}
+
+	// A cancelled booking has no keys left to revoke
+	fake.expectQuery("bookings(func: uid($id))", `{
+		"bookings": [
+			{
+				"uid": "0x10",
+				"booking.start": "2030-01-01T14:00:00Z",
+				"booking.end": "2030-01-03T14:00:00Z",
+				"booking.status": "cancelled",
+				"booking.hotel": [{"uid": "0x1"}],
+				"booking.room": [{"uid": "0x2"}],
+				"booking.user": [{"uid": "0x3"}]
+			}
+		]
+	}`)
+	req := httptest.NewRequest("POST", "http://a/bookings/0x10/type", strings.NewReader(`{"type": " spa "}`))
+	req.Header.Set("Authorization", "Bearer "+admin)
+	w := httptest.NewRecorder()
 	router().ServeHTTP(w, req)
 
-	resp = w.Result()
-	body, _ = ioutil.ReadAll(resp.Body)
-
-	expBody = &bytes.Buffer{}
-	err = json.NewEncoder(expBody).Encode(&BookingResp{
-		Err: "token contains an invalid number of segments",
-	})
-	if err != nil {
-		t.Fatalf("Error creating test JSON: %v", err)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected the booking, got %d %s", w.Code, w.Body.String())
 	}
-
-	if string(body) != string(expBody.Bytes()) {
-		t.Errorf("Response not what was expected, got %s wanted %s", string(body), string(expBody.Bytes()))
+	var bookingResp BookingResp
+	err := json.Unmarshal(w.Body.Bytes(), &bookingResp)
+	if err != nil || bookingResp.Booking.Type != "spa" {
+		t.Errorf("Expected a spa booking, got %s", w.Body.String())
 	}
-
-	req = httptest.NewRequest("GET", "http://a/bookings/by-room/1", nil)
-	w = httptest.NewRecorder()
-
-	router().ServeHTTP(w, req)
-
-	resp = w.Result()
-	body, _ = ioutil.ReadAll(resp.Body)
-
-	expBody = &bytes.Buffer{}
-	err = json.NewEncoder(expBody).Encode(&BookingResp{
-		Err: "no auth header",
-	})
-	if err != nil {
-		t.Fatalf("Error creating test JSON: %v", err)
+	if len(fake.mutations) != 1 {
+		t.Fatalf("Expected one mutation, got %d", len(fake.mutations))
 	}
-
-	if string(body) != string(expBody.Bytes()) {
-		t.Errorf("Response not what was expected, got %s wanted %s", string(body), string(expBody.Bytes()))
+	var nodes []map[string]interface{}
+	err = json.Unmarshal(fake.mutations[0].SetJson, &nodes)
+	if err != nil || len(nodes) != 2 || nodes[0]["booking.type"] != "spa" || nodes[1]["audit.action"] != "booking.typeChanged" {
+		t.Errorf("Expected the type to be set and audited, got %s", string(fake.mutations[0].SetJson))
 	}
-
-	db = oldDb
 }
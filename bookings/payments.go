@@ -0,0 +1,569 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/dgraph-io/dgo"
+	"github.com/dgraph-io/dgo/protos/api"
+	"github.com/fluidmediaproductions/central_hotel_door_server/clients"
+	"github.com/fluidmediaproductions/central_hotel_door_server/utils"
+	"github.com/gorilla/mux"
+)
+
+type BookingPayment = clients.BookingPayment
+type BookingRequest = clients.BookingRequest
+
+// PaymentProvider takes payments for bookings through a payment service.
+// Amounts are in the minor unit of the currency. Authorising holds the money
+// on the guest's card and capturing takes it. Refunding gives back a captured
+// payment, or releases an authorisation that was never captured, and is safe
+// to repeat.
+type PaymentProvider interface {
+	Name() string
+	Authorise(ctx context.Context, request *PaymentRequest) (string, error)
+	Capture(ctx context.Context, ref string, amount int64) error
+	Refund(ctx context.Context, ref string, amount int64) error
+	VerifyWebhook(r *http.Request) (*PaymentEvent, error)
+}
+
+// PaymentRequest asks a provider to authorise a payment. The method is what
+// the provider's checkout gave the guest's app, like a card token.
+type PaymentRequest struct {
+	Amount      int64
+	Currency    string
+	Method      string
+	Description string
+}
+
+// Events a provider can send about a payment after it's been made.
+const (
+	PaymentEventFailed   = "payment.failed"
+	PaymentEventRefunded = "payment.refunded"
+)
+
+// PaymentEvent is something that happened to a payment at the provider, like
+// a bank rejecting it after capture, or a refund made from the provider's
+// dashboard.
+type PaymentEvent struct {
+	Type string `json:"type"`
+	Ref  string `json:"ref"`
+}
+
+// declinedError is a payment the provider turned down, as opposed to one it
+// couldn't be asked about.
+type declinedError struct {
+	reason string
+}
+
+func (e *declinedError) Error() string {
+	return "payment declined: " + e.reason
+}
+
+// payments takes the payments for new bookings. Bookings can't be paid for
+// without one.
+var payments PaymentProvider
+
+// paymentProvider is the provider a payment was made with, if it's still
+// the one in use.
+func paymentProvider(name string) PaymentProvider {
+	if payments != nil && payments.Name() == name {
+		return payments
+	}
+	return nil
+}
+
+// paymentError is the response for a provider failing.
+func paymentError(err error) error {
+	if declined, isOk := err.(*declinedError); isOk {
+		return &statusError{
+			status:  http.StatusPaymentRequired,
+			code:    utils.CodePaymentFailed,
+			message: declined.Error(),
+		}
+	}
+	return &statusError{
+		status:  http.StatusBadGateway,
+		code:    utils.CodeUpstreamUnavailable,
+		message: fmt.Sprintf("payment provider unavailable: %v", err),
+	}
+}
+
+// chargeBooking pays for a booking around saving it. The payment is
+// authorised, the booking staged with it, the money captured and only then
+// the booking committed. If any step fails the payment is refunded, which
+// also releases an authorisation that wasn't captured, so a booking is never
+// saved without its money or the money kept without a booking.
+func chargeBooking(ctx context.Context, provider PaymentProvider, request *PaymentRequest, stage func(ref string) error, commit func() error) (string, error) {
+	ref, err := provider.Authorise(ctx, request)
+	if err != nil {
+		return "", paymentError(err)
+	}
+
+	err = stage(ref)
+	if err == nil {
+		err = provider.Capture(ctx, ref, request.Amount)
+		if err != nil {
+			err = paymentError(err)
+		}
+	}
+	if err == nil {
+		err = commit()
+	}
+	if err != nil {
+		if refundErr := provider.Refund(ctx, ref, request.Amount); refundErr != nil {
+			log.Printf("Error refunding payment %s for a booking that wasn't made: %v\n", ref, refundErr)
+		}
+		return "", err
+	}
+	return ref, nil
+}
+
+// refundPayment gives back the money taken for a booking.
+func refundPayment(ctx context.Context, payment *BookingPayment) error {
+	provider := paymentProvider(payment.Provider)
+	if provider == nil {
+		return &statusError{
+			status:  http.StatusServiceUnavailable,
+			code:    utils.CodeUpstreamUnavailable,
+			message: fmt.Sprintf("payment provider %s isn't set up", payment.Provider),
+		}
+	}
+	err := provider.Refund(ctx, payment.Ref, payment.Amount)
+	if err != nil {
+		return paymentError(err)
+	}
+	return nil
+}
+
+// refundedPayment marks a booking's payment as refunded, with a line on its
+// folio giving the money back.
+func refundedPayment(booking *Booking, userId string, now time.Time) []interface{} {
+	payment := booking.Payment
+	line := &FolioLine{
+		Kind:        clients.FolioLineRefund,
+		Description: fmt.Sprintf("Refund by %s", payment.Provider),
+		Quantity:    1,
+		UnitAmount:  payment.Amount,
+		Amount:      payment.Amount,
+		Method:      payment.Provider,
+		Reference:   payment.Ref,
+		PostedAt:    now,
+	}
+	return []interface{}{
+		map[string]interface{}{
+			"uid":                payment.ID,
+			"payment.status":     clients.PaymentRefunded,
+			"payment.refundedAt": now,
+		},
+		map[string]interface{}{
+			"uid":           booking.ID,
+			"booking.folio": folioEntry(line, userId),
+		},
+	}
+}
+
+const paymentFields = `booking.payment {
+                uid
+                payment.provider
+                payment.ref
+                payment.status
+                payment.amount
+                payment.currency
+                payment.capturedAt
+                payment.refundedAt
+                payment.failedAt
+              }`
+
+type paymentQuery struct {
+	ID         string     `json:"uid"`
+	Provider   string     `json:"payment.provider"`
+	Ref        string     `json:"payment.ref"`
+	Status     string     `json:"payment.status"`
+	Amount     int64      `json:"payment.amount"`
+	Currency   string     `json:"payment.currency"`
+	CapturedAt *time.Time `json:"payment.capturedAt"`
+	RefundedAt *time.Time `json:"payment.refundedAt"`
+	FailedAt   *time.Time `json:"payment.failedAt"`
+}
+
+func (p *paymentQuery) toPayment() *BookingPayment {
+	return &BookingPayment{
+		ID:         p.ID,
+		Provider:   p.Provider,
+		Ref:        p.Ref,
+		Status:     p.Status,
+		Amount:     p.Amount,
+		Currency:   p.Currency,
+		CapturedAt: p.CapturedAt,
+		RefundedAt: p.RefundedAt,
+		FailedAt:   p.FailedAt,
+	}
+}
+
+// getBookingByPayment finds the booking a payment was made for.
+func getBookingByPayment(ctx context.Context, txn *dgo.Txn, provider string, ref string) (*Booking, error) {
+	q := `query q($provider: string, $ref: string) {
+            payments(func: eq(payment.ref, $ref)) @filter(eq(payment.provider, $provider)) {
+              ~booking.payment {
+                uid
+              }
+            }
+          }`
+
+	resp, err := txn.QueryWithVars(ctx, q, map[string]string{
+		"$provider": provider,
+		"$ref":      ref,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var found struct {
+		Payments []struct {
+			Bookings []struct {
+				ID string `json:"uid"`
+			} `json:"~booking.payment"`
+		} `json:"payments"`
+	}
+	err = json.Unmarshal(resp.GetJson(), &found)
+	if err != nil {
+		return nil, err
+	}
+	if len(found.Payments) == 0 || len(found.Payments[0].Bookings) == 0 {
+		return nil, errBookingNotFound
+	}
+	return getBookingByID(ctx, txn, found.Payments[0].Bookings[0].ID)
+}
+
+// applyPaymentEvent updates a booking for something that happened to its
+// payment, committing the transaction. A confirmed booking whose payment
+// fails is cancelled, taking away its door access. Guests already checked in
+// have their keys revoked and are left for the front desk to settle with,
+// which the audit log flags for them.
+func applyPaymentEvent(ctx context.Context, txn *dgo.Txn, booking *Booking, event *PaymentEvent, now time.Time) error {
+	payment := booking.Payment
+
+	var set []interface{}
+	switch event.Type {
+	case PaymentEventFailed:
+		if payment.Status == clients.PaymentFailed {
+			return nil
+		}
+		set = []interface{}{
+			map[string]interface{}{
+				"uid":              payment.ID,
+				"payment.status":   clients.PaymentFailed,
+				"payment.failedAt": now,
+			},
+		}
+	case PaymentEventRefunded:
+		if payment.Status != clients.PaymentCaptured {
+			return nil
+		}
+		set = refundedPayment(booking, "", now)
+	default:
+		return nil
+	}
+	set = append(set, utils.NewAuditEntry("booking."+event.Type, "", booking.ID, payment.Ref))
+	revoke := event.Type == PaymentEventFailed && booking.Status == clients.BookingCheckedIn
+	if revoke {
+		set = append(set, utils.NewAuditEntry("booking.accessRevoked", "", booking.ID, "payment failed after check-in, settle at the front desk"))
+	}
+
+	mutData, err := json.Marshal(set)
+	if err != nil {
+		return err
+	}
+	_, err = txn.Mutate(ctx, &api.Mutation{SetJson: mutData})
+	if err != nil {
+		return err
+	}
+
+	if event.Type == PaymentEventFailed {
+		payment.Status = clients.PaymentFailed
+		payment.FailedAt = &now
+		if booking.Status == clients.BookingConfirmed {
+			return changeStatus(ctx, txn, booking, clients.BookingCancelled, "", now)
+		}
+	} else {
+		payment.Status = clients.PaymentRefunded
+		payment.RefundedAt = &now
+	}
+	err = txn.Commit(ctx)
+	if err != nil {
+		return err
+	}
+	if revoke {
+		revokeAccess(booking.ID)
+	}
+	return nil
+}
+
+// receivePaymentEvent takes webhooks from the payment provider. Events for
+// payments without a booking, like ones refunded when a booking couldn't be
+// made, are acknowledged and ignored.
+func receivePaymentEvent(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	provider := paymentProvider(vars["provider"])
+	if provider == nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(&BookingResp{
+			Err:  "unknown payment provider",
+			Code: utils.CodeNotFound,
+		})
+		return
+	}
+
+	event, err := provider.VerifyWebhook(r)
+	if err == errBadSignature {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(&BookingResp{
+			Err:  err.Error(),
+			Code: utils.CodeUnauthenticated,
+		})
+		return
+	} else if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(&BookingResp{
+			Err:  err.Error(),
+			Code: utils.CodeBadRequest,
+		})
+		return
+	}
+
+	ctx := context.Background()
+	txn := db.NewTxn()
+	defer txn.Discard(ctx)
+
+	booking, err := getBookingByPayment(ctx, txn, provider.Name(), event.Ref)
+	if err == errBookingNotFound {
+		json.NewEncoder(w).Encode(&BookingResp{})
+		return
+	}
+	if err == nil {
+		err = applyPaymentEvent(ctx, txn, booking, event, time.Now())
+	}
+	if err != nil {
+		writeStatusError(w, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(&BookingResp{
+		Booking: booking,
+	})
+}
+
+// checkBookingRequest checks a booking asked for makes sense, before
+// anything is looked up for it.
+func checkBookingRequest(request *BookingRequest, now time.Time) error {
+	if !utils.IsUID(request.RoomID) || request.PaymentMethod == "" {
+		return fmt.Errorf("bookings need a room and a payment method")
+	}
+	if !request.Start.Before(request.End) {
+		return fmt.Errorf("start has to be before end")
+	}
+	if !request.End.After(now) {
+		return fmt.Errorf("stay is already over")
+	}
+	return nil
+}
+
+// createBooking books a room for the user and takes payment for it at its
+// quoted price. The booking is only saved, and so only gets door access,
+// once the payment has been captured.
+func createBooking(w http.ResponseWriter, r *http.Request) {
+	claims, err := utils.GetRequestJWT(r, jwtSecret)
+	if err != nil {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(&BookingResp{
+			Err:  err.Error(),
+			Code: utils.CodeUnauthenticated,
+		})
+		return
+	}
+
+	var request BookingRequest
+	err = json.NewDecoder(r.Body).Decode(&request)
+	r.Body.Close()
+	now := time.Now()
+	if err == nil {
+		err = checkBookingRequest(&request, now)
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(&BookingResp{
+			Err:  err.Error(),
+			Code: utils.CodeBadRequest,
+		})
+		return
+	}
+
+	if payments == nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(&BookingResp{
+			Err:  "payments aren't set up",
+			Code: utils.CodeUpstreamUnavailable,
+		})
+		return
+	}
+
+	ctx := context.Background()
+	txn := db.NewTxn()
+	defer txn.Discard(ctx)
+
+	booking := &Booking{
+		UserID: claims.User.ID,
+		RoomID: request.RoomID,
+		Start:  request.Start,
+		End:    request.End,
+		Status: clients.BookingConfirmed,
+	}
+	quote, err := checkRoomFree(ctx, txn, booking, now)
+	if err != nil {
+		writeStatusError(w, err)
+		return
+	}
+
+	var assigned *api.Assigned
+	stage := func(ref string) error {
+		line := &FolioLine{
+			Kind:        clients.FolioLinePayment,
+			Description: fmt.Sprintf("Payment by %s", payments.Name()),
+			Quantity:    1,
+			UnitAmount:  quote.Total,
+			Amount:      quote.Total,
+			Method:      payments.Name(),
+			Reference:   ref,
+			PostedAt:    now,
+		}
+		booking.Price = quote
+		booking.Payment = &BookingPayment{
+			Provider:   payments.Name(),
+			Ref:        ref,
+			Status:     clients.PaymentCaptured,
+			Amount:     quote.Total,
+			Currency:   quote.Currency,
+			CapturedAt: &now,
+		}
+		node := map[string]interface{}{
+			"uid":            "_:booking",
+			"booking":        true,
+			"booking.start":  booking.Start,
+			"booking.end":    booking.End,
+			"booking.hotel":  &utils.UIDRef{ID: booking.HotelID},
+			"booking.room":   &utils.UIDRef{ID: booking.RoomID},
+			"booking.user":   &utils.UIDRef{ID: booking.UserID},
+			"booking.status": clients.BookingConfirmed,
+			"booking.price":  priceNode(quote),
+			"booking.payment": map[string]interface{}{
+				"uid":                "_:payment",
+				"payment.provider":   payments.Name(),
+				"payment.ref":        ref,
+				"payment.status":     clients.PaymentCaptured,
+				"payment.amount":     quote.Total,
+				"payment.currency":   quote.Currency,
+				"payment.capturedAt": now,
+			},
+			"booking.folio": folioEntry(line, booking.UserID),
+		}
+		detail := fmt.Sprintf("paid %d %s", quote.Total, quote.Currency)
+
+		mutData, err := json.Marshal([]interface{}{
+			node,
+			utils.NewAuditEntry("booking.created", booking.UserID, "_:booking", detail),
+		})
+		if err != nil {
+			return err
+		}
+		assigned, err = txn.Mutate(ctx, &api.Mutation{SetJson: mutData})
+		return err
+	}
+	commit := func() error {
+		return txn.Commit(ctx)
+	}
+
+	_, err = chargeBooking(ctx, payments, &PaymentRequest{
+		Amount:      quote.Total,
+		Currency:    quote.Currency,
+		Method:      request.PaymentMethod,
+		Description: fmt.Sprintf("Booking from %s to %s", quote.Nights[0].Date, request.End.Format(clients.DateLayout)),
+	}, stage, commit)
+	if err != nil {
+		writeStatusError(w, err)
+		return
+	}
+
+	booking.ID = assigned.Uids["booking"]
+	booking.Payment.ID = assigned.Uids["payment"]
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(&BookingResp{
+		Booking: booking,
+	})
+}
+
+// checkRoomFree checks a new booking's room can be booked for its stay, and
+// prices it. The booking's hotel is filled in from the room.
+func checkRoomFree(ctx context.Context, txn *dgo.Txn, booking *Booking, now time.Time) (*Quote, error) {
+	room, err := getBookingRoom(ctx, txn, booking.RoomID)
+	if err != nil {
+		return nil, err
+	}
+	if room == nil {
+		return nil, &statusError{
+			status:  http.StatusNotFound,
+			code:    utils.CodeNotFound,
+			message: "room not found",
+		}
+	}
+	if room.Archived {
+		return nil, conflictError("room is archived")
+	}
+	booking.HotelID = room.HotelID
+
+	taken, err := roomTaken(ctx, txn, room.ID, booking, now)
+	if err != nil {
+		return nil, err
+	}
+	if taken {
+		return nil, conflictError("room is already booked")
+	}
+	blocked, err := roomBlocked(ctx, txn, room.ID, stayLeft(booking, now), booking.End)
+	if err != nil {
+		return nil, err
+	}
+	if blocked {
+		return nil, &statusError{
+			status:  http.StatusConflict,
+			code:    utils.CodeRoomOutOfService,
+			message: "room is out of service",
+		}
+	}
+
+	quote, err := quoteRoom(ctx, txn, room.ID, booking.Start, booking.End)
+	if clients.ErrorCode(err) == utils.CodeBadRequest {
+		return nil, &statusError{
+			status:  http.StatusBadRequest,
+			code:    utils.CodeBadRequest,
+			message: err.Error(),
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if quote == nil {
+		return nil, conflictError("room can't be booked online")
+	}
+	if !quote.MeetsMinStay() {
+		return nil, &statusError{
+			status:  http.StatusConflict,
+			code:    utils.CodeMinStay,
+			message: fmt.Sprintf("stays from %s have to be at least %d nights", quote.Nights[0].Date, quote.MinStay),
+		}
+	}
+	return quote, nil
+}
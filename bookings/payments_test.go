@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fluidmediaproductions/central_hotel_door_server/clients"
+	"github.com/fluidmediaproductions/central_hotel_door_server/utils"
+)
+
+func TestLocalProvider(t *testing.T) {
+	ctx := context.Background()
+	provider := newLocalProvider([]byte("secret"))
+
+	ref, err := provider.Authorise(ctx, &PaymentRequest{Amount: 1000, Currency: "GBP", Method: "card"})
+	if err != nil {
+		t.Fatalf("Error authorising: %v", err)
+	}
+	if err := provider.Capture(ctx, ref, 2000); err == nil {
+		t.Error("Expected capturing more than was authorised to fail")
+	}
+	if err := provider.Capture(ctx, ref, 1000); err != nil || provider.status(ref) != localCaptured {
+		t.Fatalf("Expected a capture, got %s: %v", provider.status(ref), err)
+	}
+	if err := provider.Capture(ctx, ref, 1000); err == nil {
+		t.Error("Expected capturing twice to fail")
+	}
+	// Refunds are safe to repeat
+	for i := 0; i < 2; i++ {
+		if err := provider.Refund(ctx, ref, 1000); err != nil || provider.status(ref) != localRefunded {
+			t.Errorf("Expected a refund, got %s: %v", provider.status(ref), err)
+		}
+	}
+
+	ref, _ = provider.Authorise(ctx, &PaymentRequest{Amount: 1000, Currency: "GBP", Method: "card"})
+	if err := provider.Refund(ctx, ref, 1000); err != nil || provider.status(ref) != localVoided {
+		t.Errorf("Expected refunding an authorisation to void it, got %s: %v", provider.status(ref), err)
+	}
+
+	_, err = provider.Authorise(ctx, &PaymentRequest{Amount: 1000, Currency: "GBP", Method: localCardDeclined})
+	if _, isOk := err.(*declinedError); !isOk {
+		t.Errorf("Expected a decline, got %v", err)
+	}
+}
+
+func TestLocalProviderWebhook(t *testing.T) {
+	provider := newLocalProvider([]byte("secret"))
+	body, signature := provider.signEvent(&PaymentEvent{Type: PaymentEventFailed, Ref: "local_1"})
+
+	r := httptest.NewRequest("POST", "/payments/local/events", bytes.NewReader(body))
+	r.Header.Set("X-Payment-Signature", signature)
+	event, err := provider.VerifyWebhook(r)
+	if err != nil || event.Type != PaymentEventFailed || event.Ref != "local_1" {
+		t.Errorf("Unexpected event %+v: %v", event, err)
+	}
+
+	r = httptest.NewRequest("POST", "/payments/local/events", bytes.NewReader(body))
+	r.Header.Set("X-Payment-Signature", "00"+signature[2:])
+	if _, err := provider.VerifyWebhook(r); err != errBadSignature {
+		t.Errorf("Expected a bad signature, got %v", err)
+	}
+
+	body, signature = provider.signEvent(&PaymentEvent{Type: "payment.made", Ref: "local_1"})
+	r = httptest.NewRequest("POST", "/payments/local/events", bytes.NewReader(body))
+	r.Header.Set("X-Payment-Signature", signature)
+	if _, err := provider.VerifyWebhook(r); err == nil {
+		t.Error("Expected an error for an unknown event")
+	}
+
+	unsigned := newLocalProvider(nil)
+	body, signature = unsigned.signEvent(&PaymentEvent{Type: PaymentEventFailed, Ref: "local_1"})
+	r = httptest.NewRequest("POST", "/payments/local/events", bytes.NewReader(body))
+	r.Header.Set("X-Payment-Signature", signature)
+	if _, err := unsigned.VerifyWebhook(r); err != errBadSignature {
+		t.Errorf("Expected events to be refused without a secret, got %v", err)
+	}
+}
+
+func TestChargeBooking(t *testing.T) {
+	ctx := context.Background()
+	errCommit := errors.New("commit failed")
+
+	tests := []struct {
+		name      string
+		method    string
+		commitErr error
+		staged    bool
+		committed bool
+		status    string
+		code      string
+	}{
+		{"paid", "card", nil, true, true, localCaptured, ""},
+		{"declined", localCardDeclined, nil, false, false, "", utils.CodePaymentFailed},
+		{"capture fails", localCardCaptureFails, nil, true, false, localVoided, utils.CodePaymentFailed},
+		{"commit fails", "card", errCommit, true, true, localRefunded, ""},
+	}
+	for _, test := range tests {
+		provider := newLocalProvider(nil)
+		staged, committed := "", false
+		stage := func(ref string) error {
+			staged = ref
+			return nil
+		}
+		commit := func() error {
+			committed = true
+			return test.commitErr
+		}
+
+		ref, err := chargeBooking(ctx, provider, &PaymentRequest{
+			Amount:   42000,
+			Currency: "GBP",
+			Method:   test.method,
+		}, stage, commit)
+
+		if (staged != "") != test.staged || committed != test.committed {
+			t.Errorf("%s: expected staged %v and committed %v, got %v and %v", test.name, test.staged, test.committed, staged != "", committed)
+		}
+		if provider.status(staged) != test.status {
+			t.Errorf("%s: expected the payment to be %s, got %s", test.name, test.status, provider.status(staged))
+		}
+		if test.status == localCaptured {
+			if err != nil || ref != staged {
+				t.Errorf("%s: expected payment %s, got %s: %v", test.name, staged, ref, err)
+			}
+			continue
+		}
+		if err == nil || ref != "" {
+			t.Errorf("%s: expected an error", test.name)
+		}
+		if test.commitErr != nil && err != test.commitErr {
+			t.Errorf("%s: expected the commit's error, got %v", test.name, err)
+		}
+		if statusErr, isOk := err.(*statusError); test.code != "" && (!isOk || statusErr.code != test.code || statusErr.status != http.StatusPaymentRequired) {
+			t.Errorf("%s: expected a %s error, got %v", test.name, test.code, err)
+		}
+	}
+}
+
+func TestCheckBookingRequest(t *testing.T) {
+	now := time.Date(2030, 6, 1, 12, 0, 0, 0, time.UTC)
+	start := now.Add(24 * time.Hour)
+	end := start.Add(48 * time.Hour)
+
+	if err := checkBookingRequest(&BookingRequest{RoomID: "0x1", Start: start, End: end, PaymentMethod: "card"}, now); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	for i, request := range []*BookingRequest{
+		{RoomID: "room", Start: start, End: end, PaymentMethod: "card"},
+		{RoomID: "0x1", Start: start, End: end},
+		{RoomID: "0x1", Start: end, End: start, PaymentMethod: "card"},
+		{RoomID: "0x1", Start: now.Add(-72 * time.Hour), End: now.Add(-time.Hour), PaymentMethod: "card"},
+	} {
+		if err := checkBookingRequest(request, now); err == nil {
+			t.Errorf("%d: expected an error for %+v", i, request)
+		}
+	}
+}
+
+func TestApplyPaymentEventCheckedIn(t *testing.T) {
+	fake, restore := useFakeDB(t)
+	defer restore()
+
+	revoked := make(chan *http.Request, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		revoked <- r
+		w.Write([]byte(`{"err": "", "revoked": 1}`))
+	}))
+	defer ts.Close()
+	oldClient := hotelGatewayClient
+	hotelGatewayClient = clients.NewHotelGatewayClient(ts.URL)
+	defer func() { hotelGatewayClient = oldClient }()
+
+	booking := &Booking{
+		ID:      "0x10",
+		Status:  clients.BookingCheckedIn,
+		Payment: &BookingPayment{ID: "0x20", Status: clients.PaymentCaptured, Ref: "local_1"},
+	}
+	now := time.Now()
+	ctx := context.Background()
+	err := applyPaymentEvent(ctx, db.NewTxn(), booking, &PaymentEvent{Type: PaymentEventFailed, Ref: "local_1"}, now)
+	if err != nil {
+		t.Fatalf("Error applying event: %v", err)
+	}
+	if booking.Status != clients.BookingCheckedIn || booking.Payment.Status != clients.PaymentFailed {
+		t.Errorf("Expected a checked in booking with a failed payment, got %s %s", booking.Status, booking.Payment.Status)
+	}
+	if len(fake.mutations) != 1 || !bytes.Contains(fake.mutations[0].SetJson, []byte(`"booking.accessRevoked"`)) {
+		t.Errorf("Expected the revocation to be audited for the front desk")
+	}
+
+	select {
+	case r := <-revoked:
+		if r.URL.Path != "/credentials/by-booking/0x10/revoke" {
+			t.Errorf("Expected the booking's credentials to be revoked, got %s", r.URL.Path)
+		}
+		claims, err := utils.VerifyJWT(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "), jwtSecret)
+		if err != nil || !claims.User.HasRole(utils.RoleService) {
+			t.Errorf("Expected a service JWT revoking credentials: %v", err)
+		}
+	default:
+		t.Error("Expected the booking's credentials to be revoked")
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// A4 in points.
+const (
+	pdfPageWidth  = 595
+	pdfPageHeight = 842
+)
+
+// pdfDoc is just enough of a PDF writer for invoices: pages of text and
+// rules in Helvetica. It's one of the fonts every PDF reader has, so nothing
+// needs embedding.
+type pdfDoc struct {
+	pages []*bytes.Buffer
+}
+
+func (d *pdfDoc) addPage() {
+	d.pages = append(d.pages, &bytes.Buffer{})
+}
+
+func (d *pdfDoc) page() *bytes.Buffer {
+	if len(d.pages) == 0 {
+		d.addPage()
+	}
+	return d.pages[len(d.pages)-1]
+}
+
+func pdfFont(bold bool) string {
+	if bold {
+		return "F2"
+	}
+	return "F1"
+}
+
+// text writes a line of text with its baseline starting at x, y, measured
+// from the bottom left of the page.
+func (d *pdfDoc) text(x float64, y float64, size float64, bold bool, s string) {
+	fmt.Fprintf(d.page(), "BT /%s %.1f Tf %.2f %.2f Td (%s) Tj ET\n", pdfFont(bold), size, x, y, pdfString(s))
+}
+
+// textRight writes a line of text ending at x.
+func (d *pdfDoc) textRight(x float64, y float64, size float64, bold bool, s string) {
+	d.text(x-pdfTextWidth(s, size), y, size, bold, s)
+}
+
+// rule draws a thin line across the page.
+func (d *pdfDoc) rule(x1 float64, x2 float64, y float64) {
+	fmt.Fprintf(d.page(), "0.5 w %.2f %.2f m %.2f %.2f l S\n", x1, y, x2, y)
+}
+
+// pdfTextWidth is how wide text is in Helvetica. Only the characters in
+// amounts are measured exactly, which are the only text right aligned.
+func pdfTextWidth(s string, size float64) float64 {
+	width := 0
+	for _, r := range s {
+		switch {
+		case r >= '0' && r <= '9':
+			width += 556
+		case r == '.' || r == ',' || r == ' ':
+			width += 278
+		case r == '-':
+			width += 333
+		default:
+			width += 611
+		}
+	}
+	return float64(width) * size / 1000
+}
+
+// pdfString escapes text for a PDF string in WinAnsiEncoding. Anything
+// outside Latin-1 can't be shown with the standard fonts.
+func pdfString(s string) string {
+	var out strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			out.WriteByte('\\')
+			out.WriteRune(r)
+		case r >= 0x20 && r < 0x7f:
+			out.WriteRune(r)
+		case r >= 0xa0 && r <= 0xff:
+			fmt.Fprintf(&out, "\\%03o", r)
+		default:
+			out.WriteByte('?')
+		}
+	}
+	return out.String()
+}
+
+// bytes writes out the document. Objects 1 to 4 are the catalog, the page
+// tree and the two fonts, followed by each page and its contents.
+func (d *pdfDoc) bytes() []byte {
+	if len(d.pages) == 0 {
+		d.addPage()
+	}
+
+	var out bytes.Buffer
+	offsets := []int{}
+	object := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	out.WriteString("%PDF-1.4\n")
+
+	kids := make([]string, len(d.pages))
+	for i := range d.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 5+2*i)
+	}
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(d.pages)))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+	for i, page := range d.pages {
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>",
+			pdfPageWidth, pdfPageHeight, 6+2*i))
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", page.Len(), page.String()))
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	return out.Bytes()
+}
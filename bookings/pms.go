@@ -0,0 +1,615 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dgraph-io/dgo/protos/api"
+	"github.com/fluidmediaproductions/central_hotel_door_server/clients"
+	"github.com/fluidmediaproductions/central_hotel_door_server/utils"
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+)
+
+type Reservation = clients.Reservation
+type ReservationBatch = clients.ReservationBatch
+type SyncReport = clients.SyncReport
+type SyncError = clients.SyncError
+type SyncResp = clients.SyncResp
+
+// PMSAdapter brings in reservations from a property management system
+// (PMS), mapped onto our own ReservationBatch.
+type PMSAdapter interface {
+	Name() string
+}
+
+// PMSReceiver is an adapter the PMS sends reservations to.
+type PMSReceiver interface {
+	PMSAdapter
+	Receive(r *http.Request) (*ReservationBatch, error)
+}
+
+// PMSPoller is an adapter that goes and fetches reservations. Poll passes
+// each batch it finds to sync.
+type PMSPoller interface {
+	PMSAdapter
+	Poll(sync func(*ReservationBatch) error) error
+}
+
+var errHotelNotFound = errors.New("hotel not found")
+var errGuestUnverified = errors.New("guest's email hasn't been verified")
+var errGuestAmbiguous = errors.New("more than one user has the guest's email")
+
+var pmsReceivers = map[string]PMSReceiver{}
+
+// pmsBooking is a booking that came from a PMS.
+type pmsBooking struct {
+	ID       string
+	Ref      string
+	HotelID  string
+	RoomID   string
+	Category string
+	UserID   string
+	Type     string
+	Status   string
+	Start    time.Time
+	End      time.Time
+	Price    *Quote
+}
+
+// pmsStore is what syncing reservations needs from the database.
+type pmsStore interface {
+	// findBooking returns the booking in a hotel made from the reservation
+	// with ref, or nil if there isn't one.
+	findBooking(ref string, hotelId string) (*pmsBooking, error)
+	// sourceBookings lists the bookings a PMS has made in a hotel.
+	sourceBookings(source string, hotelId string) ([]*pmsBooking, error)
+	// hotelRooms returns the uids of a hotel's rooms by their names.
+	hotelRooms(hotelId string) (map[string]string, error)
+	// findUser returns the uid of the user with an email, or an empty string.
+	// It fails with errGuestUnverified if the email hasn't been verified, and
+	// errGuestAmbiguous if more than one user has it.
+	findUser(email string) (string, error)
+	// roomBlocked is whether a room is out of service for any of a time.
+	roomBlocked(roomId string, start time.Time, end time.Time) (bool, error)
+	// quoteRoom prices a stay in a room, or returns nil if its type has no
+	// rates.
+	quoteRoom(roomId string, start time.Time, end time.Time) (*Quote, error)
+	saveBooking(id string, hotelId string, booking *pmsBooking) error
+	// cancelBooking moves a confirmed booking to cancelled.
+	cancelBooking(id string) error
+}
+
+// pmsRef is what a booking from a PMS is matched up by, so the same
+// reservation ID from two systems can't clash.
+func pmsRef(source string, id string) string {
+	return source + ":" + id
+}
+
+// matches is whether a booking is already up to date with another. A
+// reservation for a category leaves alone whatever room the hotel has
+// assigned.
+func (b *pmsBooking) matches(other *pmsBooking) bool {
+	return (other.RoomID == "" || b.RoomID == other.RoomID) && b.Category == other.Category && b.UserID == other.UserID &&
+		b.Start.Equal(other.Start) && b.End.Equal(other.End) &&
+		(other.Type == "" || b.Type == other.Type)
+}
+
+// reservationRoom finds the uid of the room a reservation is for, which is
+// empty for a reservation for a category.
+func reservationRoom(res *Reservation, rooms map[string]string) (string, error) {
+	if res.Room == "" && res.RoomID == "" {
+		if res.Category == "" {
+			return "", errors.New("reservation has no room or category")
+		}
+		return "", nil
+	}
+	if res.RoomID != "" {
+		for _, id := range rooms {
+			if id == res.RoomID {
+				return id, nil
+			}
+		}
+		return "", errors.Errorf("room %s isn't in the hotel", res.RoomID)
+	}
+	id, isOk := rooms[res.Room]
+	if !isOk {
+		return "", errors.Errorf("no room named %q in the hotel", res.Room)
+	}
+	return id, nil
+}
+
+// syncReservations brings a hotel's bookings in line with a batch from a PMS.
+// Guests are matched to users by verified email. A reservation that can't be synced
+// is left out and reported, the rest of the batch still goes through.
+func syncReservations(s pmsStore, batch *ReservationBatch, now time.Time) (*SyncReport, error) {
+	if batch.Source == "" {
+		return nil, errors.New("batch has no source")
+	}
+	if !utils.IsUID(batch.HotelID) {
+		return nil, errors.Errorf("invalid hotel %q", batch.HotelID)
+	}
+	rooms, err := s.hotelRooms(batch.HotelID)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &SyncReport{
+		Errors: make([]*SyncError, 0),
+	}
+	addError := func(res *Reservation, err error) {
+		report.Errors = append(report.Errors, &SyncError{
+			ID:      res.ID,
+			Message: err.Error(),
+		})
+	}
+
+	seen := map[string]bool{}
+	for _, res := range batch.Reservations {
+		if res.ID == "" {
+			addError(res, errors.New("reservation has no id"))
+			continue
+		}
+		ref := pmsRef(batch.Source, res.ID)
+		seen[ref] = true
+
+		existing, err := s.findBooking(ref, batch.HotelID)
+		if err != nil {
+			return nil, err
+		}
+
+		switch res.Status {
+		case clients.ReservationCancelled:
+			if existing == nil || existing.Status == clients.BookingCancelled {
+				report.Unchanged++
+				continue
+			}
+			if existing.Status != clients.BookingConfirmed {
+				addError(res, errors.Errorf("can't cancel a booking that's %s", existing.Status))
+				continue
+			}
+			err = s.cancelBooking(existing.ID)
+			if err != nil {
+				return nil, err
+			}
+			report.Cancelled++
+			continue
+		case "", clients.ReservationBooked:
+		default:
+			addError(res, errors.Errorf("unknown status %q", res.Status))
+			continue
+		}
+
+		if existing != nil && existing.Status != clients.BookingConfirmed && existing.Status != clients.BookingCheckedIn {
+			addError(res, errors.Errorf("booking is already %s", existing.Status))
+			continue
+		}
+		if !res.Start.Before(res.End) {
+			addError(res, errors.New("start must be before end"))
+			continue
+		}
+		room, err := reservationRoom(res, rooms)
+		if err != nil {
+			addError(res, err)
+			continue
+		}
+		user, err := s.findUser(strings.TrimSpace(res.GuestEmail))
+		if err == errGuestUnverified || err == errGuestAmbiguous {
+			addError(res, err)
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		if user == "" {
+			addError(res, errors.Errorf("no user with email %q", res.GuestEmail))
+			continue
+		}
+
+		booking := &pmsBooking{
+			Ref:      ref,
+			RoomID:   room,
+			Category: res.Category,
+			UserID:   user,
+			Type:     res.Type,
+			Start:    res.Start,
+			End:      res.End,
+		}
+		if existing != nil && existing.matches(booking) {
+			report.Unchanged++
+			continue
+		}
+		if room != "" {
+			blocked, err := s.roomBlocked(room, res.Start, res.End)
+			if err != nil {
+				return nil, err
+			}
+			if blocked {
+				addError(res, errors.New("room is out of service"))
+				continue
+			}
+		}
+		// New bookings keep the price they were made at. Those for a category
+		// go without until there's a room to price.
+		if existing == nil && room != "" {
+			booking.Price, err = s.quoteRoom(room, res.Start, res.End)
+			if err != nil {
+				return nil, err
+			}
+		}
+		id := ""
+		if existing != nil {
+			id = existing.ID
+		}
+		err = s.saveBooking(id, batch.HotelID, booking)
+		if err != nil {
+			return nil, err
+		}
+		if existing == nil {
+			report.Created++
+		} else {
+			report.Updated++
+		}
+	}
+
+	if batch.Full {
+		bookings, err := s.sourceBookings(batch.Source, batch.HotelID)
+		if err != nil {
+			return nil, err
+		}
+		for _, booking := range bookings {
+			if seen[booking.Ref] || booking.Status != clients.BookingConfirmed || !booking.End.After(now) {
+				continue
+			}
+			err = s.cancelBooking(booking.ID)
+			if err != nil {
+				return nil, err
+			}
+			report.Cancelled++
+		}
+	}
+	return report, nil
+}
+
+// receiveReservations takes a batch of reservations sent to one of the
+// receiving adapters.
+func receiveReservations(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	receiver, isOk := pmsReceivers[vars["adapter"]]
+	if !isOk {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(&SyncResp{
+			Err:  "unknown adapter",
+			Code: utils.CodeNotFound,
+		})
+		return
+	}
+
+	batch, err := receiver.Receive(r)
+	if err == errBadSignature {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(&SyncResp{
+			Err:  err.Error(),
+			Code: utils.CodeUnauthenticated,
+		})
+		return
+	} else if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(&SyncResp{
+			Err:  err.Error(),
+			Code: utils.CodeBadRequest,
+		})
+		return
+	}
+
+	report, err := syncReservations(&dgraphPMSStore{}, batch, time.Now())
+	if err == errHotelNotFound {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(&SyncResp{
+			Err:  err.Error(),
+			Code: utils.CodeNotFound,
+		})
+		return
+	} else if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(&SyncResp{
+			Err:  err.Error(),
+			Code: utils.CodeInternal,
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(&SyncResp{
+		Report: report,
+	})
+}
+
+// pollPMS runs a polling adapter forever.
+func pollPMS(poller PMSPoller, interval time.Duration) {
+	for {
+		err := poller.Poll(func(batch *ReservationBatch) error {
+			report, err := syncReservations(&dgraphPMSStore{}, batch, time.Now())
+			if err != nil {
+				return err
+			}
+			log.Printf("Synced %s reservations for hotel %s: %d created, %d updated, %d cancelled, %d errors\n",
+				batch.Source, batch.HotelID, report.Created, report.Updated, report.Cancelled, len(report.Errors))
+			return nil
+		})
+		if err != nil {
+			log.Printf("Error polling %s adapter: %v\n", poller.Name(), err)
+		}
+		time.Sleep(interval)
+	}
+}
+
+// dgraphPMSStore is the pmsStore reservations are synced to.
+type dgraphPMSStore struct{}
+
+const pmsBookingFields = `uid
+              booking.pmsRef
+              booking.start
+              booking.end
+              booking.type
+              booking.category
+              booking.status
+              booking.hotel {
+                uid
+              }
+              booking.room {
+                uid
+              }
+              booking.user {
+                uid
+              }`
+
+type pmsBookingQuery struct {
+	Bookings []struct {
+		ID       string     `json:"uid"`
+		Ref      string     `json:"booking.pmsRef"`
+		Start    *time.Time `json:"booking.start"`
+		End      *time.Time `json:"booking.end"`
+		Type     string     `json:"booking.type"`
+		Category string     `json:"booking.category"`
+		Status   string     `json:"booking.status"`
+		Hotel    []struct {
+			ID string `json:"uid"`
+		} `json:"booking.hotel"`
+		Room []struct {
+			ID string `json:"uid"`
+		} `json:"booking.room"`
+		User []struct {
+			ID string `json:"uid"`
+		} `json:"booking.user"`
+	} `json:"bookings"`
+}
+
+func (q *pmsBookingQuery) toBookings() []*pmsBooking {
+	bookings := make([]*pmsBooking, 0)
+	for _, b := range q.Bookings {
+		booking := &pmsBooking{
+			ID:       b.ID,
+			Ref:      b.Ref,
+			Type:     b.Type,
+			Category: b.Category,
+			Status:   bookingState(b.Status),
+		}
+		if b.Start != nil {
+			booking.Start = *b.Start
+		}
+		if b.End != nil {
+			booking.End = *b.End
+		}
+		if len(b.Hotel) > 0 {
+			booking.HotelID = b.Hotel[0].ID
+		}
+		if len(b.Room) > 0 {
+			booking.RoomID = b.Room[0].ID
+		}
+		if len(b.User) > 0 {
+			booking.UserID = b.User[0].ID
+		}
+		bookings = append(bookings, booking)
+	}
+	return bookings
+}
+
+func (s *dgraphPMSStore) query(q string, variables map[string]string, out interface{}) error {
+	resp, err := db.NewTxn().QueryWithVars(context.Background(), q, variables)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(resp.GetJson(), out)
+}
+
+// findBooking only looks in the hotel, as reservation IDs are only unique
+// within the PMS of one hotel.
+func (s *dgraphPMSStore) findBooking(ref string, hotelId string) (*pmsBooking, error) {
+	q := `query q($ref: string) {
+            bookings(func: eq(booking.pmsRef, $ref)) {
+              ` + pmsBookingFields + `
+	        }
+          }`
+	var bookings pmsBookingQuery
+	err := s.query(q, map[string]string{"$ref": ref}, &bookings)
+	if err != nil {
+		return nil, err
+	}
+	for _, booking := range bookings.toBookings() {
+		if booking.HotelID == hotelId {
+			return booking, nil
+		}
+	}
+	return nil, nil
+}
+
+func (s *dgraphPMSStore) sourceBookings(source string, hotelId string) ([]*pmsBooking, error) {
+	q := `query q($hotel: string) {
+            var(func: uid($hotel)) {
+              b as ~booking.hotel @filter(has(booking.pmsRef))
+            }
+            bookings(func: uid(b)) {
+              ` + pmsBookingFields + `
+	        }
+          }`
+	var bookings pmsBookingQuery
+	err := s.query(q, map[string]string{"$hotel": hotelId}, &bookings)
+	if err != nil {
+		return nil, err
+	}
+	fromSource := make([]*pmsBooking, 0)
+	for _, booking := range bookings.toBookings() {
+		if strings.HasPrefix(booking.Ref, source+":") {
+			fromSource = append(fromSource, booking)
+		}
+	}
+	return fromSource, nil
+}
+
+func (s *dgraphPMSStore) hotelRooms(hotelId string) (map[string]string, error) {
+	q := `query q($hotel: string) {
+            hotels(func: uid($hotel)) @filter(has(hotel)) {
+              ~room.hotel {
+                uid
+                room.name
+              }
+	        }
+          }`
+	var hotels struct {
+		Hotels []struct {
+			Rooms []struct {
+				ID   string `json:"uid"`
+				Name string `json:"room.name"`
+			} `json:"~room.hotel"`
+		} `json:"hotels"`
+	}
+	err := s.query(q, map[string]string{"$hotel": hotelId}, &hotels)
+	if err != nil {
+		return nil, err
+	}
+	if len(hotels.Hotels) == 0 {
+		return nil, errHotelNotFound
+	}
+	rooms := map[string]string{}
+	for _, room := range hotels.Hotels[0].Rooms {
+		rooms[room.Name] = room.ID
+	}
+	return rooms, nil
+}
+
+func (s *dgraphPMSStore) roomBlocked(roomId string, start time.Time, end time.Time) (bool, error) {
+	ctx := context.Background()
+	txn := db.NewTxn()
+	defer txn.Discard(ctx)
+	return roomBlocked(ctx, txn, roomId, start, end)
+}
+
+func (s *dgraphPMSStore) quoteRoom(roomId string, start time.Time, end time.Time) (*Quote, error) {
+	ctx := context.Background()
+	txn := db.NewTxn()
+	defer txn.Discard(ctx)
+	return quoteRoom(ctx, txn, roomId, start, end)
+}
+
+func (s *dgraphPMSStore) findUser(email string) (string, error) {
+	q := `query q($email: string) {
+            users(func: eq(email, $email)) @filter(has(user)) {
+              uid
+              emailVerified
+	        }
+          }`
+	var users struct {
+		Users []struct {
+			ID       string `json:"uid"`
+			Verified bool   `json:"emailVerified"`
+		} `json:"users"`
+	}
+	err := s.query(q, map[string]string{"$email": email}, &users)
+	if err != nil || len(users.Users) == 0 {
+		return "", err
+	}
+	if len(users.Users) > 1 {
+		return "", errGuestAmbiguous
+	}
+	if !users.Users[0].Verified {
+		return "", errGuestUnverified
+	}
+	return users.Users[0].ID, nil
+}
+
+// saveBooking writes a booking from a PMS, replacing the edges of an
+// existing one as they only ever point to one node. Bookings for a category
+// keep any room they've been assigned, and existing bookings stay in their
+// hotel.
+func (s *dgraphPMSStore) saveBooking(id string, hotelId string, booking *pmsBooking) error {
+	ctx := context.Background()
+	txn := db.NewTxn()
+	defer txn.Discard(ctx)
+
+	node := map[string]interface{}{
+		"uid":           id,
+		"booking.start": booking.Start,
+		"booking.end":   booking.End,
+		"booking.user":  &utils.UIDRef{ID: booking.UserID},
+	}
+	if booking.RoomID != "" {
+		node["booking.room"] = &utils.UIDRef{ID: booking.RoomID}
+	}
+	if booking.Type != "" {
+		node["booking.type"] = booking.Type
+	}
+	if booking.Category != "" {
+		node["booking.category"] = booking.Category
+	}
+	if id == "" {
+		node["uid"] = "_:booking"
+		node["booking"] = true
+		node["booking.hotel"] = &utils.UIDRef{ID: hotelId}
+		node["booking.pmsRef"] = booking.Ref
+		if booking.Price != nil {
+			node["booking.price"] = priceNode(booking.Price)
+		}
+	} else {
+		edges := map[string]interface{}{
+			"uid":          id,
+			"booking.user": nil,
+		}
+		if booking.RoomID != "" {
+			edges["booking.room"] = nil
+		}
+		del, err := json.Marshal(edges)
+		if err == nil {
+			_, err = txn.Mutate(ctx, &api.Mutation{DeleteJson: del})
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	mutData, err := json.Marshal(node)
+	if err != nil {
+		return err
+	}
+	_, err = txn.Mutate(ctx, &api.Mutation{SetJson: mutData})
+	if err != nil {
+		return err
+	}
+	return txn.Commit(ctx)
+}
+
+// cancelBooking cancels a booking the PMS has cancelled, like a guest would.
+func (s *dgraphPMSStore) cancelBooking(id string) error {
+	ctx := context.Background()
+	txn := db.NewTxn()
+	defer txn.Discard(ctx)
+
+	booking, err := getBookingByID(ctx, txn, id)
+	if err != nil {
+		return err
+	}
+	return changeStatus(ctx, txn, booking, clients.BookingCancelled, "", time.Now())
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// maxBatchSize limits the size of a batch of reservations.
+const maxBatchSize = 8 << 20
+
+var errBadSignature = errors.New("bad signature")
+
+// decodeBatch reads a batch of reservations in our own JSON format.
+func decodeBatch(data []byte) (*ReservationBatch, error) {
+	var batch ReservationBatch
+	err := json.Unmarshal(data, &batch)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid batch")
+	}
+	if batch.Source == "" || batch.HotelID == "" {
+		return nil, errors.New("batch needs a source and hotelId")
+	}
+	return &batch, nil
+}
+
+// jsonAdapter receives batches in our own JSON format, as a webhook a PMS or
+// some middleware posts to. The body is signed with a shared secret, as the
+// hex HMAC-SHA256 in the X-PMS-Signature header.
+type jsonAdapter struct {
+	secret []byte
+}
+
+func (a *jsonAdapter) Name() string {
+	return "json"
+}
+
+func (a *jsonAdapter) sign(body []byte) []byte {
+	mac := hmac.New(sha256.New, a.secret)
+	mac.Write(body)
+	return mac.Sum(nil)
+}
+
+func (a *jsonAdapter) Receive(r *http.Request) (*ReservationBatch, error) {
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxBatchSize))
+	r.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	signature, err := hex.DecodeString(r.Header.Get("X-PMS-Signature"))
+	if err != nil || !hmac.Equal(signature, a.sign(body)) {
+		return nil, errBadSignature
+	}
+	return decodeBatch(body)
+}
+
+// fileAdapter picks up batches dropped as JSON files in a directory, for a PMS
+// that can only export files, and for trying out syncs locally. Each file is
+// moved to processed or failed once it's been synced. Only one replica should
+// watch a directory.
+type fileAdapter struct {
+	dir string
+}
+
+func (a *fileAdapter) Name() string {
+	return "file"
+}
+
+// move puts a file that's been dealt with in a subdirectory.
+func (a *fileAdapter) move(path string, subdir string) error {
+	dir := filepath.Join(a.dir, subdir)
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return err
+	}
+	return os.Rename(path, filepath.Join(dir, filepath.Base(path)))
+}
+
+func (a *fileAdapter) Poll(sync func(*ReservationBatch) error) error {
+	paths, err := filepath.Glob(filepath.Join(a.dir, "*.json"))
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		batch, err := decodeBatch(data)
+		if err == nil {
+			err = sync(batch)
+		}
+		if err != nil {
+			err = a.move(path, "failed")
+		} else {
+			err = a.move(path, "processed")
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,518 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fluidmediaproductions/central_hotel_door_server/clients"
+	"github.com/pkg/errors"
+)
+
+const testHotel = "0x1"
+
+type fakePMSStore struct {
+	rooms    map[string]string
+	users    map[string][]string
+	verified map[string]bool
+	blocks   map[string][]*clients.RoomBlock
+	plans    map[string]*clients.RatePlan
+	bookings map[string]*pmsBooking
+	nextID   int
+}
+
+func newFakePMSStore() *fakePMSStore {
+	return &fakePMSStore{
+		rooms:    map[string]string{"101": "0x10", "102": "0x11"},
+		users:    map[string][]string{"guest@example.com": {"0x20"}},
+		verified: map[string]bool{"0x20": true},
+		blocks:   map[string][]*clients.RoomBlock{},
+		plans:    map[string]*clients.RatePlan{},
+		bookings: map[string]*pmsBooking{},
+	}
+}
+
+func (s *fakePMSStore) findBooking(ref string, hotelId string) (*pmsBooking, error) {
+	for _, booking := range s.bookings {
+		if booking.Ref == ref && booking.HotelID == hotelId {
+			copied := *booking
+			return &copied, nil
+		}
+	}
+	return nil, nil
+}
+
+func (s *fakePMSStore) sourceBookings(source string, hotelId string) ([]*pmsBooking, error) {
+	bookings := make([]*pmsBooking, 0)
+	for _, booking := range s.bookings {
+		if strings.HasPrefix(booking.Ref, source+":") {
+			bookings = append(bookings, booking)
+		}
+	}
+	return bookings, nil
+}
+
+func (s *fakePMSStore) hotelRooms(hotelId string) (map[string]string, error) {
+	if hotelId != testHotel {
+		return nil, errHotelNotFound
+	}
+	return s.rooms, nil
+}
+
+func (s *fakePMSStore) findUser(email string) (string, error) {
+	users := s.users[email]
+	if len(users) == 0 {
+		return "", nil
+	}
+	if len(users) > 1 {
+		return "", errGuestAmbiguous
+	}
+	if !s.verified[users[0]] {
+		return "", errGuestUnverified
+	}
+	return users[0], nil
+}
+
+func (s *fakePMSStore) roomBlocked(roomId string, start time.Time, end time.Time) (bool, error) {
+	for _, block := range s.blocks[roomId] {
+		if block.Overlaps(start, end) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (s *fakePMSStore) quoteRoom(roomId string, start time.Time, end time.Time) (*Quote, error) {
+	plan, isOk := s.plans[roomId]
+	if !isOk {
+		return nil, nil
+	}
+	return plan.Quote(start, end, time.UTC, start)
+}
+
+func (s *fakePMSStore) saveBooking(id string, hotelId string, booking *pmsBooking) error {
+	if id == "" {
+		s.nextID++
+		id = fmt.Sprintf("0x%d", 100+s.nextID)
+	}
+	saved := *booking
+	saved.ID = id
+	saved.HotelID = hotelId
+	saved.Status = clients.BookingConfirmed
+	if existing, isOk := s.bookings[id]; isOk {
+		saved.Status = existing.Status
+		if saved.RoomID == "" {
+			saved.RoomID = existing.RoomID
+		}
+		saved.Price = existing.Price
+	}
+	s.bookings[id] = &saved
+	return nil
+}
+
+func (s *fakePMSStore) cancelBooking(id string) error {
+	s.bookings[id].Status = clients.BookingCancelled
+	return nil
+}
+
+func (s *fakePMSStore) countStatus(status string) int {
+	count := 0
+	for _, booking := range s.bookings {
+		if booking.Status == status {
+			count++
+		}
+	}
+	return count
+}
+
+func testReservation(id string, room string) *Reservation {
+	start := time.Date(2030, 1, 1, 14, 0, 0, 0, time.UTC)
+	return &Reservation{
+		ID:         id,
+		Room:       room,
+		GuestEmail: "guest@example.com",
+		Start:      start,
+		End:        start.Add(48 * time.Hour),
+	}
+}
+
+func TestSyncReservations(t *testing.T) {
+	s := newFakePMSStore()
+	now := time.Date(2029, 12, 1, 0, 0, 0, 0, time.UTC)
+	batch := &ReservationBatch{
+		Source:  "test",
+		HotelID: testHotel,
+		Reservations: []*Reservation{
+			testReservation("A1", "101"),
+			testReservation("A2", "102"),
+		},
+	}
+
+	report, err := syncReservations(s, batch, now)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if report.Created != 2 || len(report.Errors) != 0 {
+		t.Fatalf("expected 2 created, got %+v", report)
+	}
+
+	report, err = syncReservations(s, batch, now)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if report.Unchanged != 2 || report.Created != 0 {
+		t.Errorf("expected a rerun to change nothing, got %+v", report)
+	}
+
+	batch.Reservations[0].Room = "102"
+	batch.Reservations[1].Status = clients.ReservationCancelled
+	report, err = syncReservations(s, batch, now)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if report.Updated != 1 || report.Cancelled != 1 {
+		t.Errorf("expected 1 updated and 1 cancelled, got %+v", report)
+	}
+	booking, _ := s.findBooking("test:A1", testHotel)
+	if booking == nil || booking.RoomID != "0x11" {
+		t.Errorf("expected the booking to move to room 102, got %+v", booking)
+	}
+	if s.countStatus(clients.BookingCancelled) != 1 {
+		t.Errorf("expected 1 booking to be cancelled, got %d", s.countStatus(clients.BookingCancelled))
+	}
+
+	batch.Reservations[1].Status = clients.ReservationBooked
+	report, err = syncReservations(s, batch, now)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(report.Errors) != 1 {
+		t.Errorf("expected a cancelled booking not to be rebooked, got %+v", report)
+	}
+}
+
+func TestSyncReservationsCategory(t *testing.T) {
+	s := newFakePMSStore()
+	now := time.Date(2029, 12, 1, 0, 0, 0, 0, time.UTC)
+	res := testReservation("A1", "")
+	res.Category = "double"
+	batch := &ReservationBatch{
+		Source:       "test",
+		HotelID:      testHotel,
+		Reservations: []*Reservation{res, testReservation("A2", "")},
+	}
+
+	report, err := syncReservations(s, batch, now)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if report.Created != 1 || len(report.Errors) != 1 {
+		t.Fatalf("expected 1 created and a reservation without a room or category to fail, got %+v", report)
+	}
+	booking, _ := s.findBooking("test:A1", testHotel)
+	if booking == nil || booking.RoomID != "" || booking.Category != "double" {
+		t.Fatalf("expected a double booking without a room, got %+v", booking)
+	}
+
+	s.bookings[booking.ID].RoomID = "0x10"
+	batch.Reservations = batch.Reservations[:1]
+	report, err = syncReservations(s, batch, now)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if report.Unchanged != 1 {
+		t.Errorf("expected the assigned room to be kept, got %+v", report)
+	}
+}
+
+func TestSyncReservationsBlockedRoom(t *testing.T) {
+	s := newFakePMSStore()
+	now := time.Date(2029, 12, 1, 0, 0, 0, 0, time.UTC)
+	res := testReservation("A1", "101")
+	s.blocks["0x10"] = []*clients.RoomBlock{{
+		RoomID: "0x10",
+		Start:  res.End.Add(-time.Hour),
+		End:    res.End.Add(24 * time.Hour),
+		Reason: "leaking radiator",
+	}}
+	batch := &ReservationBatch{
+		Source:       "test",
+		HotelID:      testHotel,
+		Reservations: []*Reservation{res, testReservation("A2", "102")},
+	}
+
+	report, err := syncReservations(s, batch, now)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if report.Created != 1 || len(report.Errors) != 1 || report.Errors[0].ID != "A1" {
+		t.Errorf("expected the reservation in the blocked room to fail, got %+v", report)
+	}
+
+	res.End = res.End.Add(-2 * time.Hour)
+	report, err = syncReservations(s, batch, now)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if report.Created != 1 || report.Unchanged != 1 {
+		t.Errorf("expected a reservation ending before the block to go through, got %+v", report)
+	}
+}
+
+func TestSyncReservationsPrice(t *testing.T) {
+	s := newFakePMSStore()
+	now := time.Date(2029, 12, 1, 0, 0, 0, 0, time.UTC)
+	plan := &clients.RatePlan{Currency: "GBP", Nightly: 10000}
+	s.plans["0x10"] = plan
+	res := testReservation("A1", "101")
+	batch := &ReservationBatch{
+		Source:       "test",
+		HotelID:      testHotel,
+		Reservations: []*Reservation{res, testReservation("A2", "102")},
+	}
+
+	_, err := syncReservations(s, batch, now)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	priced, _ := s.findBooking(pmsRef("test", "A1"), testHotel)
+	if priced.Price == nil || priced.Price.Total != 20000 || len(priced.Price.Nights) != 2 {
+		t.Errorf("expected a two night booking at 100.00 a night, got %+v", priced.Price)
+	}
+	unpriced, _ := s.findBooking(pmsRef("test", "A2"), testHotel)
+	if unpriced.Price != nil {
+		t.Errorf("expected no price for a room without rates, got %+v", unpriced.Price)
+	}
+
+	// Changing the rates doesn't change what's already been booked
+	plan.Nightly = 15000
+	res.End = res.End.Add(-2 * time.Hour)
+	report, err := syncReservations(s, batch, now)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	priced, _ = s.findBooking(pmsRef("test", "A1"), testHotel)
+	if report.Updated != 1 || priced.Price == nil || priced.Price.Total != 20000 {
+		t.Errorf("expected the booking to keep its price, got %+v", priced.Price)
+	}
+}
+
+func TestSyncReservationsFull(t *testing.T) {
+	s := newFakePMSStore()
+	now := time.Date(2029, 12, 1, 0, 0, 0, 0, time.UTC)
+	_, err := syncReservations(s, &ReservationBatch{
+		Source:  "test",
+		HotelID: testHotel,
+		Reservations: []*Reservation{
+			testReservation("A1", "101"),
+			testReservation("A2", "102"),
+		},
+	}, now)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	report, err := syncReservations(s, &ReservationBatch{
+		Source:  "test",
+		HotelID: testHotel,
+		Full:    true,
+		Reservations: []*Reservation{
+			testReservation("A1", "101"),
+		},
+	}, now)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if report.Cancelled != 1 || report.Unchanged != 1 {
+		t.Errorf("expected the missing reservation to be cancelled, got %+v", report)
+	}
+
+	report, err = syncReservations(s, &ReservationBatch{
+		Source:  "test",
+		HotelID: testHotel,
+		Full:    true,
+		Reservations: []*Reservation{
+			testReservation("A1", "101"),
+		},
+	}, now)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if report.Cancelled != 0 {
+		t.Errorf("expected a cancelled booking to stay cancelled, got %+v", report)
+	}
+}
+
+func TestSyncReservationsErrors(t *testing.T) {
+	s := newFakePMSStore()
+	s.users["shared@example.com"] = []string{"0x21", "0x22"}
+	s.users["unverified@example.com"] = []string{"0x23"}
+	unknownGuest := testReservation("A2", "101")
+	unknownGuest.GuestEmail = "nobody@example.com"
+	sharedGuest := testReservation("A5", "101")
+	sharedGuest.GuestEmail = "shared@example.com"
+	unverifiedGuest := testReservation("A6", "101")
+	unverifiedGuest.GuestEmail = "unverified@example.com"
+	backwards := testReservation("A4", "101")
+	backwards.End = backwards.Start
+	report, err := syncReservations(s, &ReservationBatch{
+		Source:  "test",
+		HotelID: testHotel,
+		Reservations: []*Reservation{
+			testReservation("A1", "101"),
+			unknownGuest,
+			testReservation("A3", "999"),
+			backwards,
+			testReservation("", "101"),
+			sharedGuest,
+			unverifiedGuest,
+		},
+	}, time.Now())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if report.Created != 1 || len(report.Errors) != 6 {
+		t.Fatalf("expected 1 created and 6 errors, got %+v", report)
+	}
+	if report.Errors[4].ID != "A5" || report.Errors[4].Message != errGuestAmbiguous.Error() {
+		t.Errorf("expected a guest email shared by two users to be reported, got %+v", report.Errors[4])
+	}
+	if report.Errors[5].ID != "A6" || report.Errors[5].Message != errGuestUnverified.Error() {
+		t.Errorf("expected an unverified guest email to be reported, got %+v", report.Errors[5])
+	}
+
+	_, err = syncReservations(s, &ReservationBatch{
+		Source:  "test",
+		HotelID: "0x2",
+	}, time.Now())
+	if err != errHotelNotFound {
+		t.Errorf("expected hotel not found, got %v", err)
+	}
+}
+
+func TestJSONAdapterReceive(t *testing.T) {
+	adapter := &jsonAdapter{secret: []byte("secret")}
+	body, _ := json.Marshal(&ReservationBatch{
+		Source:       "test",
+		HotelID:      testHotel,
+		Reservations: []*Reservation{testReservation("A1", "101")},
+	})
+
+	r := httptest.NewRequest("POST", "/pms/json/reservations", bytes.NewReader(body))
+	r.Header.Set("X-PMS-Signature", hex.EncodeToString(adapter.sign(body)))
+	batch, err := adapter.Receive(r)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if batch.Source != "test" || len(batch.Reservations) != 1 || batch.Reservations[0].Room != "101" {
+		t.Errorf("unexpected batch %+v", batch)
+	}
+
+	r = httptest.NewRequest("POST", "/pms/json/reservations", bytes.NewReader(body))
+	r.Header.Set("X-PMS-Signature", hex.EncodeToString((&jsonAdapter{secret: []byte("wrong")}).sign(body)))
+	_, err = adapter.Receive(r)
+	if err != errBadSignature {
+		t.Errorf("expected a bad signature, got %v", err)
+	}
+}
+
+func TestFileAdapterPoll(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pms")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	good, _ := json.Marshal(&ReservationBatch{
+		Source:  "test",
+		HotelID: testHotel,
+	})
+	ioutil.WriteFile(filepath.Join(dir, "good.json"), good, 0644)
+	ioutil.WriteFile(filepath.Join(dir, "bad.json"), []byte("{"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "ignored.txt"), []byte("{"), 0644)
+
+	synced := 0
+	adapter := &fileAdapter{dir: dir}
+	err = adapter.Poll(func(batch *ReservationBatch) error {
+		synced++
+		if batch.Source != "test" {
+			return errors.New("wrong batch")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if synced != 1 {
+		t.Errorf("expected 1 batch to be synced, got %d", synced)
+	}
+	for _, path := range []string{"processed/good.json", "failed/bad.json", "ignored.txt"} {
+		if _, err := os.Stat(filepath.Join(dir, path)); err != nil {
+			t.Errorf("expected %s: %v", path, err)
+		}
+	}
+}
+
+func TestDgraphPMSStoreFindUser(t *testing.T) {
+	fake, restore := useFakeDB(t)
+	defer restore()
+
+	s := &dgraphPMSStore{}
+	for _, test := range []struct {
+		json string
+		user string
+		err  error
+	}{
+		{`{"users": []}`, "", nil},
+		{`{"users": [{"uid": "0x20", "emailVerified": true}]}`, "0x20", nil},
+		{`{"users": [{"uid": "0x20"}]}`, "", errGuestUnverified},
+		{`{"users": [{"uid": "0x20", "emailVerified": true}, {"uid": "0x21", "emailVerified": true}]}`, "", errGuestAmbiguous},
+	} {
+		fake.queries = nil
+		fake.expectQuery("eq(email, $email)", test.json)
+		user, err := s.findUser("guest@example.com")
+		if user != test.user || err != test.err {
+			t.Errorf("expected %q and %v for %s, got %q and %v", test.user, test.err, test.json, user, err)
+		}
+	}
+}
+
+func TestDgraphPMSStoreFindBooking(t *testing.T) {
+	fake, restore := useFakeDB(t)
+	defer restore()
+
+	// Another hotel's PMS can use the same reservation ID
+	fake.expectQuery("eq(booking.pmsRef, $ref)", `{
+		"bookings": [
+			{"uid": "0x30", "booking.pmsRef": "test:A1", "booking.hotel": [{"uid": "0x2"}]},
+			{"uid": "0x31", "booking.pmsRef": "test:A1", "booking.hotel": [{"uid": "0x1"}]}
+		]
+	}`)
+	s := &dgraphPMSStore{}
+	booking, err := s.findBooking("test:A1", testHotel)
+	if err != nil || booking == nil || booking.ID != "0x31" {
+		t.Errorf("expected the hotel's own booking, got %+v, %v", booking, err)
+	}
+	booking, err = s.findBooking("test:A1", "0x3")
+	if err != nil || booking != nil {
+		t.Errorf("expected no booking in another hotel, got %+v, %v", booking, err)
+	}
+
+	err = s.saveBooking("0x31", testHotel, &pmsBooking{UserID: "0x20"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, mutation := range fake.mutations {
+		if bytes.Contains(mutation.SetJson, []byte("booking.hotel")) || bytes.Contains(mutation.DeleteJson, []byte("booking.hotel")) {
+			t.Errorf("expected an existing booking to stay in its hotel, got %s%s", string(mutation.SetJson), string(mutation.DeleteJson))
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/dgraph-io/dgo"
+	"github.com/fluidmediaproductions/central_hotel_door_server/clients"
+	"github.com/fluidmediaproductions/central_hotel_door_server/utils"
+)
+
+var RoomsServer = "http://rooms"
+
+var roomsClient = clients.NewRoomsClient(RoomsServer)
+
+type Quote = clients.Quote
+
+// priceFields gets the price a booking was quoted when it was made. Bookings
+// from before there was pricing, or in rooms without rates, have none.
+const priceFields = `booking.price {
+                uid
+                price.currency
+                price.subtotal
+                price.total
+                price.minStay
+                price.quotedAt
+                price.roomType {
+                  uid
+                }
+                price.ratePlan {
+                  uid
+                }
+                price.nights (orderasc: night.date) {
+                  night.date
+                  night.amount
+                  night.season
+                }
+                price.taxes (orderasc: tax.name) {
+                  tax.name
+                  tax.percent
+                  tax.amount
+                }
+              }`
+
+type priceQuery struct {
+	Currency string    `json:"price.currency"`
+	Subtotal int64     `json:"price.subtotal"`
+	Total    int64     `json:"price.total"`
+	MinStay  int       `json:"price.minStay"`
+	QuotedAt time.Time `json:"price.quotedAt"`
+	RoomType []struct {
+		ID string `json:"uid"`
+	} `json:"price.roomType"`
+	RatePlan []struct {
+		ID string `json:"uid"`
+	} `json:"price.ratePlan"`
+	Nights []struct {
+		Date   string `json:"night.date"`
+		Amount int64  `json:"night.amount"`
+		Season string `json:"night.season"`
+	} `json:"price.nights"`
+	Taxes []struct {
+		Name    string  `json:"tax.name"`
+		Percent float64 `json:"tax.percent"`
+		Amount  int64   `json:"tax.amount"`
+	} `json:"price.taxes"`
+}
+
+func (p *priceQuery) toQuote() *Quote {
+	quote := &Quote{
+		Currency: p.Currency,
+		Nights:   make([]*clients.QuoteNight, 0, len(p.Nights)),
+		MinStay:  p.MinStay,
+		Subtotal: p.Subtotal,
+		Taxes:    make([]*clients.QuoteTax, 0, len(p.Taxes)),
+		Total:    p.Total,
+		QuotedAt: p.QuotedAt,
+	}
+	if len(p.RoomType) > 0 {
+		quote.RoomTypeID = p.RoomType[0].ID
+	}
+	if len(p.RatePlan) > 0 {
+		quote.RatePlanID = p.RatePlan[0].ID
+	}
+	for _, night := range p.Nights {
+		quote.Nights = append(quote.Nights, &clients.QuoteNight{
+			Date:   night.Date,
+			Amount: night.Amount,
+			Season: night.Season,
+		})
+	}
+	for _, tax := range p.Taxes {
+		quote.Taxes = append(quote.Taxes, &clients.QuoteTax{
+			Name:    tax.Name,
+			Percent: tax.Percent,
+			Amount:  tax.Amount,
+		})
+	}
+	return quote
+}
+
+// priceNode turns a quote into the node a booking keeps its price in. The
+// nights and taxes are copied, so nothing about the price depends on the
+// rate plan it came from.
+func priceNode(quote *Quote) map[string]interface{} {
+	nights := make([]map[string]interface{}, 0, len(quote.Nights))
+	for _, night := range quote.Nights {
+		nights = append(nights, map[string]interface{}{
+			"night.date":   night.Date,
+			"night.amount": night.Amount,
+			"night.season": night.Season,
+		})
+	}
+	taxes := make([]map[string]interface{}, 0, len(quote.Taxes))
+	for _, tax := range quote.Taxes {
+		taxes = append(taxes, map[string]interface{}{
+			"tax.name":    tax.Name,
+			"tax.percent": tax.Percent,
+			"tax.amount":  tax.Amount,
+		})
+	}
+
+	node := map[string]interface{}{
+		"price.currency": quote.Currency,
+		"price.subtotal": quote.Subtotal,
+		"price.total":    quote.Total,
+		"price.minStay":  quote.MinStay,
+		"price.quotedAt": quote.QuotedAt,
+		"price.nights":   nights,
+		"price.taxes":    taxes,
+	}
+	if quote.RoomTypeID != "" {
+		node["price.roomType"] = &utils.UIDRef{ID: quote.RoomTypeID}
+	}
+	if quote.RatePlanID != "" {
+		node["price.ratePlan"] = &utils.UIDRef{ID: quote.RatePlanID}
+	}
+	return node
+}
+
+// getRoomTypeID finds the type of a room, or an empty string for rooms
+// without one.
+func getRoomTypeID(ctx context.Context, txn *dgo.Txn, roomId string) (string, error) {
+	q := `query q($id: string) {
+            rooms(func: uid($id)) @filter(has(room)) {
+              room.type {
+                uid
+              }
+            }
+          }`
+
+	resp, err := txn.QueryWithVars(ctx, q, map[string]string{"$id": roomId})
+	if err != nil {
+		return "", err
+	}
+	var rooms struct {
+		Rooms []struct {
+			Type []struct {
+				ID string `json:"uid"`
+			} `json:"room.type"`
+		} `json:"rooms"`
+	}
+	err = json.Unmarshal(resp.GetJson(), &rooms)
+	if err != nil {
+		return "", err
+	}
+	if len(rooms.Rooms) == 0 || len(rooms.Rooms[0].Type) == 0 {
+		return "", nil
+	}
+	return rooms.Rooms[0].Type[0].ID, nil
+}
+
+// quoteRoom prices a stay in a room at its type's current rates. Rooms
+// without a type, or types without rates, give no quote rather than an
+// error, and the booking is left without a price.
+func quoteRoom(ctx context.Context, txn *dgo.Txn, roomId string, start time.Time, end time.Time) (*Quote, error) {
+	typeId, err := getRoomTypeID(ctx, txn, roomId)
+	if err != nil || typeId == "" {
+		return nil, err
+	}
+	quote, err := roomsClient.GetQuote(ctx, "", typeId, start, end)
+	if clients.IsNotFound(err) {
+		return nil, nil
+	}
+	return quote, err
+}
@@ -0,0 +1,495 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/dgraph-io/dgo"
+	"github.com/dgraph-io/dgo/protos/api"
+	"github.com/fluidmediaproductions/central_hotel_door_server/clients"
+	"github.com/fluidmediaproductions/central_hotel_door_server/utils"
+	"github.com/gorilla/mux"
+)
+
+type RoomChange = clients.RoomChange
+type RoomAssignment = clients.RoomAssignment
+
+// roomHistoryFields gets every room a booking has been in. Bookings from
+// before rooms could be moved have no history.
+const roomHistoryFields = `booking.assignments (orderasc: assignment.start) {
+                uid
+                assignment.start
+                assignment.end
+                assignment.room {
+                  uid
+                }
+                assignment.by {
+                  uid
+                }
+              }`
+
+type assignmentQuery struct {
+	ID    string     `json:"uid"`
+	Start time.Time  `json:"assignment.start"`
+	End   *time.Time `json:"assignment.end"`
+	Room  []struct {
+		ID string `json:"uid"`
+	} `json:"assignment.room"`
+	By []struct {
+		ID string `json:"uid"`
+	} `json:"assignment.by"`
+}
+
+func (a *assignmentQuery) toAssignment() *RoomAssignment {
+	assignment := &RoomAssignment{
+		ID:    a.ID,
+		Start: a.Start,
+		End:   a.End,
+	}
+	if len(a.Room) > 0 {
+		assignment.RoomID = a.Room[0].ID
+	}
+	if len(a.By) > 0 {
+		assignment.AssignedBy = a.By[0].ID
+	}
+	return assignment
+}
+
+// bookingRoom is a room a booking is being put in.
+type bookingRoom struct {
+	ID       string
+	HotelID  string
+	Category string
+	Archived bool
+}
+
+func getBookingRoom(ctx context.Context, txn *dgo.Txn, id string) (*bookingRoom, error) {
+	q := `query q($id: string) {
+            rooms(func: uid($id)) @filter(has(room)) {
+              uid
+              room.category
+              room.archivedAt
+              room.hotel {
+                uid
+              }
+            }
+          }`
+
+	resp, err := txn.QueryWithVars(ctx, q, map[string]string{"$id": id})
+	if err != nil {
+		return nil, err
+	}
+	var rooms struct {
+		Rooms []struct {
+			ID         string     `json:"uid"`
+			Category   string     `json:"room.category"`
+			ArchivedAt *time.Time `json:"room.archivedAt"`
+			Hotel      []struct {
+				ID string `json:"uid"`
+			} `json:"room.hotel"`
+		} `json:"rooms"`
+	}
+	err = json.Unmarshal(resp.GetJson(), &rooms)
+	if err != nil {
+		return nil, err
+	}
+	if len(rooms.Rooms) == 0 || len(rooms.Rooms[0].Hotel) == 0 {
+		return nil, nil
+	}
+	room := rooms.Rooms[0]
+	return &bookingRoom{
+		ID:       room.ID,
+		HotelID:  room.Hotel[0].ID,
+		Category: room.Category,
+		Archived: room.ArchivedAt != nil,
+	}, nil
+}
+
+// stayLeft is when the rest of a booking from now starts.
+func stayLeft(booking *Booking, now time.Time) time.Time {
+	if now.After(booking.Start) {
+		return now
+	}
+	return booking.Start
+}
+
+// roomTaken is whether another open booking has a room for any of the rest
+// of a booking. New bookings don't have an ID yet, so any open booking in
+// the room counts.
+func roomTaken(ctx context.Context, txn *dgo.Txn, roomId string, booking *Booking, now time.Time) (bool, error) {
+	from := stayLeft(booking, now)
+
+	variables := map[string]string{
+		"$room": roomId,
+		"$from": from.Format(time.RFC3339),
+		"$to":   booking.End.Format(time.RFC3339),
+	}
+	others := ""
+	if booking.ID != "" {
+		variables["$id"] = booking.ID
+		others = "NOT uid($id) AND "
+	}
+	q := utils.QueryHeader(variables) + ` {
+            rooms(func: uid($room)) {
+              ~booking.room @filter(` + others + `lt(booking.start, $to) AND gt(booking.end, $from) AND ` + openFilter + `) {
+                uid
+              }
+            }
+          }`
+
+	resp, err := txn.QueryWithVars(ctx, q, variables)
+	if err != nil {
+		return false, err
+	}
+	var rooms struct {
+		Rooms []struct {
+			Bookings []struct {
+				ID string `json:"uid"`
+			} `json:"~booking.room"`
+		} `json:"rooms"`
+	}
+	err = json.Unmarshal(resp.GetJson(), &rooms)
+	if err != nil {
+		return false, err
+	}
+	return len(rooms.Rooms) > 0 && len(rooms.Rooms[0].Bookings) > 0, nil
+}
+
+// roomBlocked is whether a room is out of service for any of a time.
+func roomBlocked(ctx context.Context, txn *dgo.Txn, roomId string, start time.Time, end time.Time) (bool, error) {
+	q := `query q($room: string, $from: string, $to: string) {
+            rooms(func: uid($room)) {
+              ~block.room @filter(lt(block.start, $to) AND gt(block.end, $from)) {
+                uid
+              }
+            }
+          }`
+
+	resp, err := txn.QueryWithVars(ctx, q, map[string]string{
+		"$room": roomId,
+		"$from": start.Format(time.RFC3339),
+		"$to":   end.Format(time.RFC3339),
+	})
+	if err != nil {
+		return false, err
+	}
+	var rooms struct {
+		Rooms []struct {
+			Blocks []struct {
+				ID string `json:"uid"`
+			} `json:"~block.room"`
+		} `json:"rooms"`
+	}
+	err = json.Unmarshal(resp.GetJson(), &rooms)
+	if err != nil {
+		return false, err
+	}
+	return len(rooms.Rooms) > 0 && len(rooms.Rooms[0].Blocks) > 0, nil
+}
+
+// checkRoomChange checks a booking can be put in a room now. A booking made
+// against a category has to be given a room of that category, while staff can
+// move guests to any room in the hotel once they have one.
+func checkRoomChange(booking *Booking, room *bookingRoom, now time.Time) error {
+	if !booking.IsOpen() {
+		return conflictError("booking is already %s", booking.Status)
+	}
+	if now.After(booking.End) {
+		return &statusError{
+			status:  http.StatusConflict,
+			code:    utils.CodeBookingNotActive,
+			message: "booking has ended",
+		}
+	}
+	if room == nil || room.HotelID != booking.HotelID {
+		return &statusError{
+			status:  http.StatusBadRequest,
+			code:    utils.CodeBadRequest,
+			message: "room isn't in the booking's hotel",
+		}
+	}
+	if room.Archived {
+		return conflictError("room is archived")
+	}
+	if room.ID == booking.RoomID {
+		return conflictError("booking is already in that room")
+	}
+	if booking.RoomID == "" && booking.Category != "" && room.Category != booking.Category {
+		return conflictError("room isn't a %s room", booking.Category)
+	}
+	return nil
+}
+
+// dirtyRoom marks a room a guest has left as needing housekeeping.
+func dirtyRoom(roomId string, now time.Time) map[string]interface{} {
+	return map[string]interface{}{
+		"uid":                 roomId,
+		"room.housekeeping":   clients.HousekeepingDirty,
+		"room.housekeepingAt": now,
+	}
+}
+
+// moveRoom puts a booking in a room, committing the transaction. The move is
+// made in one go with closing off the booking's time in its old room and
+// cancelling any unlock of that room still waiting for the hotel, so the
+// guest can't get into both.
+func moveRoom(ctx context.Context, txn *dgo.Txn, booking *Booking, roomId string, userId string, now time.Time) error {
+	set := make([]interface{}, 0)
+
+	assignment := map[string]interface{}{
+		"uid":              "_:assignment",
+		"assignment.room":  &utils.UIDRef{ID: roomId},
+		"assignment.start": now,
+	}
+	if userId != "" {
+		assignment["assignment.by"] = &utils.UIDRef{ID: userId}
+	}
+	node := map[string]interface{}{
+		"uid":                 booking.ID,
+		"booking.room":        &utils.UIDRef{ID: roomId},
+		"booking.assignments": []interface{}{assignment},
+		"booking.needsRoom":   false,
+	}
+	set = append(set, node)
+
+	action := "booking.room_assigned"
+	detail := "to " + roomId
+	if booking.RoomID != "" {
+		action = "booking.room_moved"
+		detail = "from " + booking.RoomID + " to " + roomId
+
+		closed := false
+		for _, previous := range booking.RoomHistory {
+			if previous.End == nil {
+				set = append(set, map[string]interface{}{
+					"uid":            previous.ID,
+					"assignment.end": now,
+				})
+				closed = true
+			}
+		}
+		if !closed {
+			// Bookings from before rooms could be moved have been in the room
+			// since they started
+			node["booking.assignments"] = []interface{}{
+				map[string]interface{}{
+					"assignment.room":  &utils.UIDRef{ID: booking.RoomID},
+					"assignment.start": booking.Start,
+					"assignment.end":   now,
+				},
+				assignment,
+			}
+		}
+		set = append(set, map[string]interface{}{
+			"uid":             booking.RoomID,
+			"room.shouldOpen": false,
+		})
+		if booking.Status == clients.BookingCheckedIn {
+			set = append(set, dirtyRoom(booking.RoomID, now))
+		}
+
+		del, err := json.Marshal(map[string]interface{}{
+			"uid":          booking.ID,
+			"booking.room": nil,
+		})
+		if err == nil {
+			_, err = txn.Mutate(ctx, &api.Mutation{DeleteJson: del})
+		}
+		if err != nil {
+			return err
+		}
+	}
+	set = append(set, utils.NewAuditEntry(action, userId, booking.ID, detail))
+
+	mutData, err := json.Marshal(set)
+	if err != nil {
+		return err
+	}
+	_, err = txn.Mutate(ctx, &api.Mutation{SetJson: mutData})
+	if err == nil {
+		err = txn.Commit(ctx)
+	}
+	if err != nil {
+		return err
+	}
+
+	// Offline keys name the room they open, so guests need new ones
+	if booking.RoomID != "" {
+		revokeAccess(booking.ID)
+	}
+	return nil
+}
+
+// assignRoom puts a booking in a room or moves it to another, for staff.
+func assignRoom(w http.ResponseWriter, r *http.Request) {
+	claims, err := utils.GetRequestJWT(r, jwtSecret)
+	if err != nil {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(&BookingResp{
+			Err:  err.Error(),
+			Code: utils.CodeUnauthenticated,
+		})
+		return
+	}
+	if !claims.User.HasRole(staffRoles...) {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(&BookingResp{
+			Err:  "only staff can assign rooms",
+			Code: utils.CodeForbidden,
+		})
+		return
+	}
+
+	vars := mux.Vars(r)
+
+	id := vars["id"]
+
+	var change RoomChange
+	err = json.NewDecoder(r.Body).Decode(&change)
+	r.Body.Close()
+	if err != nil || !utils.IsUID(change.RoomID) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(&BookingResp{
+			Err:  "bad request data",
+			Code: utils.CodeBadRequest,
+		})
+		return
+	}
+
+	ctx := context.Background()
+	txn := db.NewTxn()
+	defer txn.Discard(ctx)
+
+	booking, err := getBookingByID(ctx, txn, id)
+	if err != nil {
+		writeStatusError(w, err)
+		return
+	}
+	room, err := getBookingRoom(ctx, txn, change.RoomID)
+	if err != nil {
+		writeStatusError(w, err)
+		return
+	}
+
+	now := time.Now()
+	err = checkRoomChange(booking, room, now)
+	if err == nil {
+		var taken bool
+		taken, err = roomTaken(ctx, txn, room.ID, booking, now)
+		if err == nil && taken {
+			err = conflictError("room is booked by someone else")
+		}
+	}
+	if err == nil {
+		var blocked bool
+		blocked, err = roomBlocked(ctx, txn, room.ID, stayLeft(booking, now), booking.End)
+		if err == nil && blocked {
+			err = &statusError{
+				status:  http.StatusConflict,
+				code:    utils.CodeRoomOutOfService,
+				message: "room is out of service",
+			}
+		}
+	}
+	if err == nil {
+		err = moveRoom(ctx, txn, booking, room.ID, claims.User.ID, now)
+	}
+	if err != nil {
+		writeStatusError(w, err)
+		return
+	}
+
+	readTxn := db.NewTxn()
+	defer readTxn.Discard(ctx)
+	booking, err = getBookingByID(ctx, readTxn, id)
+	if err != nil {
+		writeStatusError(w, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(&BookingResp{
+		Booking: booking,
+	})
+}
+
+// getBookingsNeedingRooms lists a hotel's open bookings whose rooms have been
+// taken out of service, for staff to move.
+func getBookingsNeedingRooms(w http.ResponseWriter, r *http.Request) {
+	claims, err := utils.GetRequestJWT(r, jwtSecret)
+	if err != nil {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(&BookingsResp{
+			Err:  err.Error(),
+			Code: utils.CodeUnauthenticated,
+		})
+		return
+	}
+	if !claims.User.HasRole(staffRoles...) {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(&BookingsResp{
+			Err:  "only staff can see bookings needing rooms",
+			Code: utils.CodeForbidden,
+		})
+		return
+	}
+
+	vars := mux.Vars(r)
+
+	id := vars["id"]
+
+	ctx := context.Background()
+	txn := db.NewTxn()
+	defer txn.Discard(ctx)
+
+	q := `query q($id: string) {
+            var (func: uid($id)) {
+              b as ~booking.hotel @filter(eq(booking.needsRoom, true) AND ` + openFilter + `)
+            }
+            bookings(func: uid(b), orderasc: booking.start) {
+              uid
+              booking.start
+              booking.end
+              booking.type
+              booking.category
+              ` + statusFields + `
+              ` + priceFields + `
+              ` + paymentFields + `
+              ` + roomHistoryFields + `
+              booking.hotel {
+                uid
+              }
+              booking.room {
+                uid
+              }
+              booking.user {
+                uid
+              }
+            }
+          }`
+
+	resp, err := txn.QueryWithVars(ctx, q, map[string]string{"$id": id})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(&BookingsResp{
+			Err:  err.Error(),
+			Code: utils.CodeInternal,
+		})
+		return
+	}
+	var bookings bookingQuery
+	err = json.Unmarshal(resp.GetJson(), &bookings)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(&BookingsResp{
+			Err:  err.Error(),
+			Code: utils.CodeInternal,
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(&BookingsResp{
+		Bookings: bookings.toBookings(),
+	})
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/fluidmediaproductions/central_hotel_door_server/clients"
+	"github.com/fluidmediaproductions/central_hotel_door_server/utils"
+)
+
+func TestCheckRoomChange(t *testing.T) {
+	start := time.Date(2030, 1, 1, 14, 0, 0, 0, time.UTC)
+	end := start.Add(48 * time.Hour)
+	during := start.Add(time.Hour)
+
+	double := &bookingRoom{ID: "0x10", HotelID: "0x1", Category: "double"}
+	suite := &bookingRoom{ID: "0x11", HotelID: "0x1", Category: "suite"}
+
+	tests := []struct {
+		roomId   string
+		category string
+		state    string
+		room     *bookingRoom
+		now      time.Time
+		status   int
+		code     string
+	}{
+		{"", "double", clients.BookingConfirmed, double, during, 0, ""},
+		{"", "double", clients.BookingConfirmed, suite, during, http.StatusConflict, utils.CodeConflict},
+		{"0x10", "double", clients.BookingCheckedIn, suite, during, 0, ""},
+		{"0x10", "", clients.BookingConfirmed, double, during, http.StatusConflict, utils.CodeConflict},
+		{"0x10", "", clients.BookingCheckedOut, suite, during, http.StatusConflict, utils.CodeConflict},
+		{"0x10", "", clients.BookingConfirmed, suite, end.Add(time.Hour), http.StatusConflict, utils.CodeBookingNotActive},
+		{"0x10", "", clients.BookingConfirmed, nil, during, http.StatusBadRequest, utils.CodeBadRequest},
+		{"0x10", "", clients.BookingConfirmed, &bookingRoom{ID: "0x12", HotelID: "0x2"}, during, http.StatusBadRequest, utils.CodeBadRequest},
+		{"0x10", "", clients.BookingConfirmed, &bookingRoom{ID: "0x12", HotelID: "0x1", Archived: true}, during, http.StatusConflict, utils.CodeConflict},
+	}
+
+	for i, test := range tests {
+		booking := &Booking{
+			HotelID:  "0x1",
+			RoomID:   test.roomId,
+			Category: test.category,
+			Start:    start,
+			End:      end,
+			Status:   test.state,
+		}
+		err := checkRoomChange(booking, test.room, test.now)
+		if test.status == 0 {
+			if err != nil {
+				t.Errorf("%d: unexpected error %v", i, err)
+			}
+			continue
+		}
+		statusErr, isOk := err.(*statusError)
+		if !isOk {
+			t.Errorf("%d: expected a status error, got %v", i, err)
+			continue
+		}
+		if statusErr.status != test.status || statusErr.code != test.code {
+			t.Errorf("%d: expected %d %s, got %d %s", i, test.status, test.code, statusErr.status, statusErr.code)
+		}
+	}
+}
@@ -0,0 +1,494 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dgraph-io/dgo"
+	"github.com/dgraph-io/dgo/protos/api"
+	"github.com/fluidmediaproductions/central_hotel_door_server/clients"
+	"github.com/fluidmediaproductions/central_hotel_door_server/utils"
+	"github.com/gorilla/mux"
+)
+
+var HotelGatewayServer = "http://hotel-gateway"
+
+var hotelGatewayClient = clients.NewHotelGatewayClient(HotelGatewayServer)
+
+type BookingStatusChange = clients.BookingStatusChange
+type BookingTypeChange = clients.BookingTypeChange
+
+// staffRoles can change the state of anyone's booking.
+var staffRoles = []string{utils.RoleAdmin, utils.RoleSupport, utils.RoleFrontDesk}
+
+// bookingTransitions are the states each state can move on to. Checked out,
+// cancelled and no-show bookings are finished with.
+var bookingTransitions = map[string][]string{
+	clients.BookingConfirmed: {clients.BookingCheckedIn, clients.BookingCancelled, clients.BookingNoShow},
+	clients.BookingCheckedIn: {clients.BookingCheckedOut},
+}
+
+// statusTimes are the predicates holding when a booking moved to each state.
+var statusTimes = map[string]string{
+	clients.BookingCheckedIn:  "booking.checkedInAt",
+	clients.BookingCheckedOut: "booking.checkedOutAt",
+	clients.BookingCancelled:  "booking.cancelledAt",
+	clients.BookingNoShow:     "booking.noShowAt",
+}
+
+// confirmedFilter matches confirmed bookings, including those made before
+// bookings had states.
+const confirmedFilter = `(NOT has(booking.status) OR eq(booking.status, "` + clients.BookingConfirmed + `"))`
+
+const statusFields = `booking.status
+                      booking.checkedInAt
+                      booking.checkedOutAt
+                      booking.cancelledAt
+                      booking.noShowAt
+                      booking.needsRoom`
+
+type bookingStatus struct {
+	Status       string     `json:"booking.status"`
+	CheckedInAt  *time.Time `json:"booking.checkedInAt"`
+	CheckedOutAt *time.Time `json:"booking.checkedOutAt"`
+	CancelledAt  *time.Time `json:"booking.cancelledAt"`
+	NoShowAt     *time.Time `json:"booking.noShowAt"`
+	NeedsRoom    bool       `json:"booking.needsRoom"`
+}
+
+func (s *bookingStatus) fill(booking *Booking) {
+	booking.Status = bookingState(s.Status)
+	booking.CheckedInAt = s.CheckedInAt
+	booking.CheckedOutAt = s.CheckedOutAt
+	booking.CancelledAt = s.CancelledAt
+	booking.NoShowAt = s.NoShowAt
+	booking.NeedsRoom = s.NeedsRoom
+}
+
+// bookingState is the state of a booking with a stored status, as bookings
+// made before there were states don't have one.
+func bookingState(status string) string {
+	if status == "" {
+		return clients.BookingConfirmed
+	}
+	return status
+}
+
+// statusError is a state change that isn't allowed.
+type statusError struct {
+	status  int
+	code    string
+	message string
+}
+
+func (e *statusError) Error() string {
+	return e.message
+}
+
+func conflictError(format string, args ...interface{}) error {
+	return &statusError{
+		status:  http.StatusConflict,
+		code:    utils.CodeConflict,
+		message: fmt.Sprintf(format, args...),
+	}
+}
+
+// checkTransition checks a booking can move to a state now. Guests can check
+// in while their booking is on, check out early and cancel before it starts,
+// while staff can check in early and mark no-shows.
+func checkTransition(booking *Booking, status string, staff bool, now time.Time) error {
+	allowed := false
+	for _, next := range bookingTransitions[booking.Status] {
+		if next == status {
+			allowed = true
+		}
+	}
+	if !allowed {
+		return conflictError("booking can't go from %s to %s", booking.Status, status)
+	}
+
+	switch status {
+	case clients.BookingCheckedIn:
+		if now.After(booking.End) {
+			return &statusError{
+				status:  http.StatusConflict,
+				code:    utils.CodeBookingNotActive,
+				message: "booking has ended",
+			}
+		}
+		if !staff && now.Before(booking.Start) {
+			return &statusError{
+				status:  http.StatusConflict,
+				code:    utils.CodeBookingNotActive,
+				message: "booking hasn't started",
+			}
+		}
+	case clients.BookingCancelled:
+		if !staff && !now.Before(booking.Start) {
+			return conflictError("booking has already started")
+		}
+	case clients.BookingNoShow:
+		if !staff {
+			return &statusError{
+				status:  http.StatusForbidden,
+				code:    utils.CodeForbidden,
+				message: "only staff can mark a no-show",
+			}
+		}
+		if now.Before(booking.Start) {
+			return conflictError("booking hasn't started")
+		}
+	}
+	return nil
+}
+
+// changeStatus moves a booking to a state, committing the transaction, and
+// takes away its door access if it's finished with. Checking out leaves the
+// room for housekeeping. Cancelling a paid booking refunds it before the
+// cancellation is committed, so a failed refund leaves the booking as it was.
+func changeStatus(ctx context.Context, txn *dgo.Txn, booking *Booking, status string, userId string, now time.Time) error {
+	mutation := map[string]interface{}{
+		"uid":            booking.ID,
+		"booking.status": status,
+	}
+	if predicate, isOk := statusTimes[status]; isOk {
+		mutation[predicate] = now
+	}
+	detail := fmt.Sprintf("%s to %s", booking.Status, status)
+	set := []interface{}{
+		mutation,
+		utils.NewAuditEntry("booking."+status, userId, booking.ID, detail),
+	}
+	if status == clients.BookingCheckedOut && booking.RoomID != "" {
+		set = append(set, dirtyRoom(booking.RoomID, now))
+	}
+	refund := status == clients.BookingCancelled && booking.Payment != nil && booking.Payment.Status == clients.PaymentCaptured
+	if refund {
+		set = append(set, refundedPayment(booking, userId, now)...)
+	}
+
+	mutData, err := json.Marshal(set)
+	if err != nil {
+		return err
+	}
+	_, err = txn.Mutate(ctx, &api.Mutation{SetJson: mutData})
+	if err == nil && refund {
+		err = refundPayment(ctx, booking.Payment)
+		if err == nil {
+			err = txn.Commit(ctx)
+			if err != nil {
+				// The money's gone back, so the room mustn't stay open
+				log.Printf("Error cancelling refunded booking %s: %v\n", booking.ID, err)
+				revokeAccess(booking.ID)
+			}
+		}
+	} else if err == nil {
+		err = txn.Commit(ctx)
+	}
+	if err != nil {
+		return err
+	}
+
+	booking.Status = status
+	switch status {
+	case clients.BookingCheckedIn:
+		booking.CheckedInAt = &now
+	case clients.BookingCheckedOut:
+		booking.CheckedOutAt = &now
+	case clients.BookingCancelled:
+		booking.CancelledAt = &now
+		if refund {
+			booking.Payment.Status = clients.PaymentRefunded
+			booking.Payment.RefundedAt = &now
+		}
+	case clients.BookingNoShow:
+		booking.NoShowAt = &now
+	}
+	if !booking.IsOpen() {
+		revokeAccess(booking.ID)
+	}
+	return nil
+}
+
+// revokeAccess revokes the offline credentials issued for a booking. The
+// state change has already been made by then, so a failure is only logged,
+// leaving the credentials to run out at the end of the booking.
+func revokeAccess(bookingId string) {
+	token, err := utils.NewServiceJWT("bookings", jwtSecret)
+	if err != nil {
+		log.Printf("Error signing service token: %v\n", err)
+		return
+	}
+	_, err = hotelGatewayClient.RevokeBookingCredentials(context.Background(), token, bookingId)
+	if err != nil {
+		log.Printf("Error revoking credentials for booking %s: %v\n", bookingId, err)
+	}
+}
+
+// getBookingByID gets any booking, for staff and for checking the owner of a
+// booking with the state.
+func getBookingByID(ctx context.Context, txn *dgo.Txn, id string) (*Booking, error) {
+	q := `query q($id: string) {
+            bookings(func: uid($id)) @filter(has(booking)) {
+              uid
+              booking.start
+              booking.end
+              booking.type
+              booking.category
+              ` + statusFields + `
+              ` + priceFields + `
+              ` + paymentFields + `
+              ` + roomHistoryFields + `
+              booking.hotel {
+                uid
+              }
+              booking.room {
+                uid
+              }
+              booking.user {
+                uid
+              }
+            }
+          }`
+
+	resp, err := txn.QueryWithVars(ctx, q, map[string]string{"$id": id})
+	if err != nil {
+		return nil, err
+	}
+	var bookings bookingQuery
+	err = json.Unmarshal(resp.GetJson(), &bookings)
+	if err != nil {
+		return nil, err
+	}
+
+	outBookings := bookings.toBookings()
+	if len(outBookings) == 0 {
+		return nil, errBookingNotFound
+	}
+	return outBookings[0], nil
+}
+
+func writeStatusError(w http.ResponseWriter, err error) {
+	if statusErr, isOk := err.(*statusError); isOk {
+		w.WriteHeader(statusErr.status)
+		json.NewEncoder(w).Encode(&BookingResp{
+			Err:  statusErr.message,
+			Code: statusErr.code,
+		})
+		return
+	}
+	status := http.StatusInternalServerError
+	if err == errBookingNotFound {
+		status = http.StatusNotFound
+	}
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(&BookingResp{
+		Err:  err.Error(),
+		Code: utils.StatusCode(status),
+	})
+}
+
+// setStatus moves a booking on to another state, for its owner or staff.
+func setStatus(w http.ResponseWriter, r *http.Request) {
+	claims, err := utils.GetRequestJWT(r, jwtSecret)
+	if err != nil {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(&BookingResp{
+			Err:  err.Error(),
+			Code: utils.CodeUnauthenticated,
+		})
+		return
+	}
+
+	vars := mux.Vars(r)
+
+	id := vars["id"]
+
+	var change BookingStatusChange
+	err = json.NewDecoder(r.Body).Decode(&change)
+	r.Body.Close()
+	if _, isOk := statusTimes[change.Status]; err != nil || !isOk {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(&BookingResp{
+			Err:  "bad request data",
+			Code: utils.CodeBadRequest,
+		})
+		return
+	}
+
+	ctx := context.Background()
+	txn := db.NewTxn()
+	defer txn.Discard(ctx)
+
+	booking, err := getBookingByID(ctx, txn, id)
+	if err != nil {
+		writeStatusError(w, err)
+		return
+	}
+	staff := claims.User.HasRole(staffRoles...)
+	if !staff && booking.UserID != claims.User.ID {
+		writeStatusError(w, errBookingNotFound)
+		return
+	}
+
+	now := time.Now()
+	err = checkTransition(booking, change.Status, staff, now)
+	if err == nil {
+		err = changeStatus(ctx, txn, booking, change.Status, claims.User.ID, now)
+	}
+	if err != nil {
+		writeStatusError(w, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(&BookingResp{
+		Booking: booking,
+	})
+}
+
+// setBookingType changes what type of booking it is, for admins. The type
+// decides which zones its guests can get in to, so keys already issued for
+// the booking are revoked and have to be fetched again.
+func setBookingType(w http.ResponseWriter, r *http.Request) {
+	claims, err := utils.GetRequestJWT(r, jwtSecret)
+	if err != nil {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(&BookingResp{
+			Err:  err.Error(),
+			Code: utils.CodeUnauthenticated,
+		})
+		return
+	}
+	if !claims.User.HasRole(utils.RoleAdmin) {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(&BookingResp{
+			Err:  "only admins can change a booking's type",
+			Code: utils.CodeForbidden,
+		})
+		return
+	}
+
+	vars := mux.Vars(r)
+
+	id := vars["id"]
+
+	var change BookingTypeChange
+	err = json.NewDecoder(r.Body).Decode(&change)
+	r.Body.Close()
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(&BookingResp{
+			Err:  "bad request data",
+			Code: utils.CodeBadRequest,
+		})
+		return
+	}
+	bookingType := strings.TrimSpace(change.Type)
+
+	ctx := context.Background()
+	txn := db.NewTxn()
+	defer txn.Discard(ctx)
+
+	booking, err := getBookingByID(ctx, txn, id)
+	if err != nil {
+		writeStatusError(w, err)
+		return
+	}
+
+	detail := fmt.Sprintf("%q to %q", booking.Type, bookingType)
+	mutData, err := json.Marshal([]interface{}{
+		map[string]interface{}{
+			"uid":          booking.ID,
+			"booking.type": bookingType,
+		},
+		utils.NewAuditEntry("booking.typeChanged", claims.User.ID, booking.ID, detail),
+	})
+	if err == nil {
+		_, err = txn.Mutate(ctx, &api.Mutation{SetJson: mutData})
+	}
+	if err == nil {
+		err = txn.Commit(ctx)
+	}
+	if err != nil {
+		writeStatusError(w, err)
+		return
+	}
+
+	booking.Type = bookingType
+	if booking.IsOpen() {
+		revokeAccess(booking.ID)
+	}
+	json.NewEncoder(w).Encode(&BookingResp{
+		Booking: booking,
+	})
+}
+
+// markNoShows marks confirmed bookings as no-shows once they've been going
+// for longer than the grace period without the guest checking in.
+func markNoShows(now time.Time, grace time.Duration) (int, error) {
+	ctx := context.Background()
+
+	q := `query q($cutoff: string) {
+            bookings(func: le(booking.start, $cutoff)) @filter(has(booking) AND ` + confirmedFilter + `) {
+              uid
+              booking.start
+              booking.end
+              booking.type
+              booking.category
+              ` + statusFields + `
+              booking.hotel {
+                uid
+              }
+              booking.room {
+                uid
+              }
+              booking.user {
+                uid
+              }
+            }
+          }`
+
+	resp, err := db.NewTxn().QueryWithVars(ctx, q, map[string]string{
+		"$cutoff": now.Add(-grace).Format(time.RFC3339),
+	})
+	if err != nil {
+		return 0, err
+	}
+	var bookings bookingQuery
+	err = json.Unmarshal(resp.GetJson(), &bookings)
+	if err != nil {
+		return 0, err
+	}
+
+	marked := 0
+	for _, booking := range bookings.toBookings() {
+		txn := db.NewTxn()
+		err = changeStatus(ctx, txn, booking, clients.BookingNoShow, "", now)
+		txn.Discard(ctx)
+		if err != nil {
+			// Another replica may have got to it first
+			log.Printf("Error marking booking %s as a no-show: %v\n", booking.ID, err)
+			continue
+		}
+		marked++
+	}
+	return marked, nil
+}
+
+// runNoShowJob marks no-shows forever.
+func runNoShowJob(interval time.Duration, grace time.Duration) {
+	for {
+		marked, err := markNoShows(time.Now(), grace)
+		if err != nil {
+			log.Printf("Error marking no-shows: %v\n", err)
+		} else if marked > 0 {
+			log.Printf("Marked %d bookings as no-shows\n", marked)
+		}
+		time.Sleep(interval)
+	}
+}
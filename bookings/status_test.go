@@ -0,0 +1,67 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/fluidmediaproductions/central_hotel_door_server/clients"
+	"github.com/fluidmediaproductions/central_hotel_door_server/utils"
+)
+
+func TestCheckTransition(t *testing.T) {
+	start := time.Date(2030, 1, 1, 14, 0, 0, 0, time.UTC)
+	end := start.Add(48 * time.Hour)
+	before := start.Add(-time.Hour)
+	during := start.Add(time.Hour)
+	after := end.Add(time.Hour)
+
+	tests := []struct {
+		from   string
+		to     string
+		staff  bool
+		now    time.Time
+		status int
+		code   string
+	}{
+		{clients.BookingConfirmed, clients.BookingCheckedIn, false, during, 0, ""},
+		{clients.BookingConfirmed, clients.BookingCheckedIn, false, before, http.StatusConflict, utils.CodeBookingNotActive},
+		{clients.BookingConfirmed, clients.BookingCheckedIn, true, before, 0, ""},
+		{clients.BookingConfirmed, clients.BookingCheckedIn, true, after, http.StatusConflict, utils.CodeBookingNotActive},
+		{clients.BookingCheckedIn, clients.BookingCheckedOut, false, during, 0, ""},
+		{clients.BookingConfirmed, clients.BookingCheckedOut, false, during, http.StatusConflict, utils.CodeConflict},
+		{clients.BookingConfirmed, clients.BookingCancelled, false, before, 0, ""},
+		{clients.BookingConfirmed, clients.BookingCancelled, false, during, http.StatusConflict, utils.CodeConflict},
+		{clients.BookingConfirmed, clients.BookingCancelled, true, during, 0, ""},
+		{clients.BookingCheckedIn, clients.BookingCancelled, true, during, http.StatusConflict, utils.CodeConflict},
+		{clients.BookingConfirmed, clients.BookingNoShow, false, after, http.StatusForbidden, utils.CodeForbidden},
+		{clients.BookingConfirmed, clients.BookingNoShow, true, before, http.StatusConflict, utils.CodeConflict},
+		{clients.BookingConfirmed, clients.BookingNoShow, true, during, 0, ""},
+		{clients.BookingCancelled, clients.BookingCheckedIn, true, during, http.StatusConflict, utils.CodeConflict},
+		{clients.BookingNoShow, clients.BookingCheckedIn, true, during, http.StatusConflict, utils.CodeConflict},
+	}
+
+	for _, test := range tests {
+		booking := &Booking{
+			Start:  start,
+			End:    end,
+			Status: test.from,
+		}
+		err := checkTransition(booking, test.to, test.staff, test.now)
+		if test.status == 0 {
+			if err != nil {
+				t.Errorf("%s to %s (staff %v): unexpected error %v", test.from, test.to, test.staff, err)
+			}
+			continue
+		}
+		statusErr, isOk := err.(*statusError)
+		if !isOk {
+			t.Errorf("%s to %s (staff %v): expected a status error, got %v", test.from, test.to, test.staff, err)
+			continue
+		}
+		if statusErr.status != test.status || statusErr.code != test.code {
+			t.Errorf("%s to %s (staff %v): expected %d %s, got %d %s", test.from, test.to, test.staff,
+				test.status, test.code, statusErr.status, statusErr.code)
+		}
+	}
+}
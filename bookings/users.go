@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/fluidmediaproductions/central_hotel_door_server/utils"
+	"github.com/gorilla/mux"
+)
+
+// getBookingsByUser lists all of a user's bookings, for support staff
+// looking into a guest's account.
+func getBookingsByUser(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	id := vars["id"]
+
+	claims, err := utils.GetRequestJWT(r, jwtSecret)
+	if err != nil {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(&BookingsResp{
+			Err:  err.Error(),
+			Code: utils.CodeUnauthenticated,
+		})
+		return
+	}
+	if !claims.User.HasRole(utils.RoleAdmin, utils.RoleSupport) {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(&BookingsResp{
+			Err:  "other users' bookings need the admin or support role",
+			Code: utils.CodeForbidden,
+		})
+		return
+	}
+
+	ctx := context.Background()
+	txn := db.NewTxn()
+
+	q := `query q($id: string) {
+            var (func: uid($id)) {
+              u as uid
+              b as ~booking.user
+            }
+            bookings(func: uid(b), orderasc: booking.start) {
+              uid
+              booking.start
+              booking.end
+              booking.type
+              booking.category
+              ` + statusFields + `
+              ` + priceFields + `
+              ` + paymentFields + `
+              ` + roomHistoryFields + `
+              booking.hotel {
+                uid
+              }
+              booking.room {
+                uid
+              }
+              booking.user @filter(uid(u)) {
+                uid
+              }
+              ` + guestFields + `
+            }
+          }`
+
+	resp, err := txn.QueryWithVars(ctx, q, map[string]string{"$id": id})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(&BookingsResp{
+			Err:  err.Error(),
+			Code: utils.CodeInternal,
+		})
+		return
+	}
+	var bookings bookingQuery
+	err = json.Unmarshal(resp.GetJson(), &bookings)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(&BookingsResp{
+			Err:  err.Error(),
+			Code: utils.CodeInternal,
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(&BookingsResp{
+		Bookings: bookings.toBookings(),
+	})
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/dgraph-io/dgo"
+	"github.com/dgraph-io/dgo/protos/api"
+	"github.com/fluidmediaproductions/central_hotel_door_server/clients"
+)
+
+// dgraphStore is the store imports use when they run for real.
+type dgraphStore struct {
+	db *dgo.Dgraph
+}
+
+type uidQuery struct {
+	Nodes []struct {
+		ID string `json:"uid"`
+	} `json:"nodes"`
+}
+
+func (q *uidQuery) first() string {
+	if len(q.Nodes) == 0 {
+		return ""
+	}
+	return q.Nodes[0].ID
+}
+
+func (s *dgraphStore) query(q string, variables map[string]string, out interface{}) error {
+	resp, err := s.db.NewTxn().QueryWithVars(context.Background(), q, variables)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(resp.GetJson(), out)
+}
+
+// findRef is only called with the kind constants, so they're safe to put in
+// the query.
+func (s *dgraphStore) findRef(kind string, ref string) (string, error) {
+	q := `query q($ref: string) {
+            nodes(func: eq(` + kind + `.importRef, $ref)) @filter(has(` + kind + `)) {
+              uid
+	        }
+          }`
+	var nodes uidQuery
+	err := s.query(q, map[string]string{"$ref": ref}, &nodes)
+	return nodes.first(), err
+}
+
+func (s *dgraphStore) nodeExists(kind string, id string) (bool, error) {
+	q := `query q($id: string) {
+            nodes(func: uid($id)) @filter(has(` + kind + `)) {
+              uid
+	        }
+          }`
+	var nodes uidQuery
+	err := s.query(q, map[string]string{"$id": id}, &nodes)
+	return nodes.first() != "", err
+}
+
+func (s *dgraphStore) findUser(email string) (string, error) {
+	q := `query q($email: string) {
+            nodes(func: eq(email, $email)) @filter(has(user)) {
+              uid
+	        }
+          }`
+	var nodes uidQuery
+	err := s.query(q, map[string]string{"$email": email}, &nodes)
+	return nodes.first(), err
+}
+
+func (s *dgraphStore) roomHotel(roomId string) (string, error) {
+	q := `query q($id: string) {
+            rooms(func: uid($id)) {
+              nodes: room.hotel {
+                uid
+              }
+	        }
+          }`
+	var rooms struct {
+		Rooms []*uidQuery `json:"rooms"`
+	}
+	err := s.query(q, map[string]string{"$id": roomId}, &rooms)
+	if err != nil || len(rooms.Rooms) == 0 {
+		return "", err
+	}
+	return rooms.Rooms[0].first(), nil
+}
+
+func (s *dgraphStore) roomBookings(roomId string) ([]*existingBooking, error) {
+	q := `query q($id: string) {
+            rooms(func: uid($id)) {
+              ~booking.room {
+                uid
+                booking.importRef
+                booking.start
+                booking.end
+              }
+	        }
+          }`
+	var rooms struct {
+		Rooms []struct {
+			Bookings []struct {
+				ID    string     `json:"uid"`
+				Ref   string     `json:"booking.importRef"`
+				Start *time.Time `json:"booking.start"`
+				End   *time.Time `json:"booking.end"`
+			} `json:"~booking.room"`
+		} `json:"rooms"`
+	}
+	err := s.query(q, map[string]string{"$id": roomId}, &rooms)
+	if err != nil {
+		return nil, err
+	}
+
+	bookings := make([]*existingBooking, 0)
+	for _, room := range rooms.Rooms {
+		for _, booking := range room.Bookings {
+			if booking.Start == nil || booking.End == nil {
+				continue
+			}
+			bookings = append(bookings, &existingBooking{
+				ID:    booking.ID,
+				Ref:   booking.Ref,
+				Start: *booking.Start,
+				End:   *booking.End,
+			})
+		}
+	}
+	return bookings, nil
+}
+
+func (s *dgraphStore) roomBlocks(roomId string) ([]*clients.RoomBlock, error) {
+	q := `query q($id: string) {
+            rooms(func: uid($id)) {
+              ~block.room {
+                uid
+                block.start
+                block.end
+                block.reason
+              }
+	        }
+          }`
+	var rooms struct {
+		Rooms []struct {
+			Blocks []struct {
+				ID     string    `json:"uid"`
+				Start  time.Time `json:"block.start"`
+				End    time.Time `json:"block.end"`
+				Reason string    `json:"block.reason"`
+			} `json:"~block.room"`
+		} `json:"rooms"`
+	}
+	err := s.query(q, map[string]string{"$id": roomId}, &rooms)
+	if err != nil {
+		return nil, err
+	}
+
+	blocks := make([]*clients.RoomBlock, 0)
+	for _, room := range rooms.Rooms {
+		for _, block := range room.Blocks {
+			blocks = append(blocks, &clients.RoomBlock{
+				ID:     block.ID,
+				RoomID: roomId,
+				Start:  block.Start,
+				End:    block.End,
+				Reason: block.Reason,
+			})
+		}
+	}
+	return blocks, nil
+}
+
+func (s *dgraphStore) write(set []interface{}, del []interface{}) (map[string]string, error) {
+	ctx := context.Background()
+	txn := s.db.NewTxn()
+	defer txn.Discard(ctx)
+
+	if len(del) > 0 {
+		delData, err := json.Marshal(del)
+		if err != nil {
+			return nil, err
+		}
+		_, err = txn.Mutate(ctx, &api.Mutation{DeleteJson: delData})
+		if err != nil {
+			return nil, err
+		}
+	}
+	setData, err := json.Marshal(set)
+	if err != nil {
+		return nil, err
+	}
+	assigned, err := txn.Mutate(ctx, &api.Mutation{SetJson: setData})
+	if err != nil {
+		return nil, err
+	}
+	err = txn.Commit(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return assigned.GetUids(), nil
+}
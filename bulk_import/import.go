@@ -0,0 +1,233 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/fluidmediaproductions/central_hotel_door_server/clients"
+	"github.com/fluidmediaproductions/central_hotel_door_server/utils"
+)
+
+// writeBatchSize is how many rows go in each transaction. A failed import
+// leaves the transactions before it written, which is safe as running it
+// again matches those rows up by ref.
+const writeBatchSize = 50
+
+// importNode is a node to write for one row.
+type importNode struct {
+	ref string
+	set map[string]interface{}
+	// defaults are only set on new nodes
+	defaults map[string]interface{}
+	// edges are the uid predicates to clear first on existing nodes, as they
+	// only ever point to one node
+	edges []string
+}
+
+// runImport parses, checks and then writes an import, unless it's a dry run
+// or there were any errors.
+func runImport(s store, req *ImportRequest, userId string) (*ImportReport, error) {
+	report := &ImportReport{
+		DryRun: req.DryRun,
+		Errors: make([]*ImportError, 0),
+	}
+	b := parseBatch(req.Files, report)
+	r := newResolver(s)
+	err := validate(b, r, report)
+	if err != nil {
+		return nil, err
+	}
+	if len(report.Errors) > 0 {
+		return report, nil
+	}
+	if req.DryRun {
+		return report, countChanges(b, r, report)
+	}
+
+	err = writeHotels(b, r, report)
+	if err == nil {
+		err = writeRooms(b, r, report)
+	}
+	if err == nil {
+		err = writeBookings(b, r, report)
+	}
+	if err != nil {
+		return report, err
+	}
+
+	detail := fmt.Sprintf("hotels %d created %d updated, rooms %d created %d updated, bookings %d created %d updated",
+		report.Hotels.Created, report.Hotels.Updated, report.Rooms.Created, report.Rooms.Updated,
+		report.Bookings.Created, report.Bookings.Updated)
+	_, err = s.write([]interface{}{utils.NewAuditEntry("import.completed", userId, "", detail)}, nil)
+	return report, err
+}
+
+func countRef(r *resolver, kind string, ref string, counts *clients.ImportCounts) error {
+	uid, err := r.find(kind, ref)
+	if err != nil {
+		return err
+	}
+	if uid == "" {
+		counts.Created++
+	} else {
+		counts.Updated++
+	}
+	return nil
+}
+
+// countChanges fills in the counts of a dry run.
+func countChanges(b *batch, r *resolver, report *ImportReport) error {
+	for _, hotel := range b.hotels {
+		if err := countRef(r, kindHotel, hotel.ref, &report.Hotels); err != nil {
+			return err
+		}
+	}
+	for _, room := range b.rooms {
+		if err := countRef(r, kindRoom, room.ref, &report.Rooms); err != nil {
+			return err
+		}
+	}
+	for _, booking := range b.bookings {
+		if err := countRef(r, kindBooking, booking.ref, &report.Bookings); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeNodes writes the nodes of a kind in batches, updating the nodes that
+// were imported before with the same ref and creating the rest.
+func writeNodes(r *resolver, kind string, nodes []*importNode, counts *clients.ImportCounts) error {
+	for start := 0; start < len(nodes); start += writeBatchSize {
+		end := start + writeBatchSize
+		if end > len(nodes) {
+			end = len(nodes)
+		}
+		chunk := nodes[start:end]
+
+		set := make([]interface{}, 0, len(chunk))
+		del := make([]interface{}, 0)
+		created := 0
+		for i, node := range chunk {
+			uid, err := r.find(kind, node.ref)
+			if err != nil {
+				return err
+			}
+			if uid == "" {
+				uid = fmt.Sprintf("_:%s%d", kind, i)
+				node.set[kind] = true
+				node.set[kind+".importRef"] = node.ref
+				for predicate, value := range node.defaults {
+					node.set[predicate] = value
+				}
+				created++
+			} else if len(node.edges) > 0 {
+				clear := map[string]interface{}{
+					"uid": uid,
+				}
+				for _, edge := range node.edges {
+					clear[edge] = nil
+				}
+				del = append(del, clear)
+			}
+			node.set["uid"] = uid
+			set = append(set, node.set)
+		}
+
+		assigned, err := r.store.write(set, del)
+		if err != nil {
+			return err
+		}
+		for i, node := range chunk {
+			if uid, isOk := assigned[fmt.Sprintf("%s%d", kind, i)]; isOk {
+				r.remember(kind, node.ref, uid)
+			}
+		}
+		counts.Created += created
+		counts.Updated += len(chunk) - created
+	}
+	return nil
+}
+
+func writeHotels(b *batch, r *resolver, report *ImportReport) error {
+	nodes := make([]*importNode, 0, len(b.hotels))
+	for _, hotel := range b.hotels {
+		set := map[string]interface{}{
+			"hotel.name":       hotel.name,
+			"hotel.address":    hotel.address,
+			"hotel.location":   utils.NewPoint(hotel.lat, hotel.lng),
+			"hotel.checkIn":    hotel.checkIn,
+			"hotel.hasCarPark": hotel.hasCarPark,
+		}
+		if hotel.timeZone != "" {
+			set["hotel.timeZone"] = hotel.timeZone
+		}
+		nodes = append(nodes, &importNode{
+			ref: hotel.ref,
+			set: set,
+		})
+	}
+	return writeNodes(r, kindHotel, nodes, &report.Hotels)
+}
+
+func writeRooms(b *batch, r *resolver, report *ImportReport) error {
+	nodes := make([]*importNode, 0, len(b.rooms))
+	for _, room := range b.rooms {
+		hotel, err := r.find(kindHotel, room.hotel)
+		if err != nil {
+			return err
+		}
+		nodes = append(nodes, &importNode{
+			ref: room.ref,
+			set: map[string]interface{}{
+				"room.name":     room.name,
+				"room.floor":    room.floor,
+				"room.category": room.category,
+				"room.hotel":    &utils.UIDRef{ID: hotel},
+			},
+			defaults: map[string]interface{}{
+				"room.shouldOpen": false,
+			},
+			edges: []string{"room.hotel"},
+		})
+	}
+	return writeNodes(r, kindRoom, nodes, &report.Rooms)
+}
+
+// writeBookings is run after the rooms are written, so a booking's hotel can
+// be taken from its room.
+func writeBookings(b *batch, r *resolver, report *ImportReport) error {
+	nodes := make([]*importNode, 0, len(b.bookings))
+	for _, booking := range b.bookings {
+		room, err := r.find(kindRoom, booking.room)
+		if err != nil {
+			return err
+		}
+		hotel, err := r.store.roomHotel(room)
+		if err != nil {
+			return err
+		}
+		user, err := r.store.findUser(booking.user)
+		if err != nil {
+			return err
+		}
+
+		set := map[string]interface{}{
+			"booking.start": booking.start,
+			"booking.end":   booking.end,
+			"booking.room":  &utils.UIDRef{ID: room},
+			"booking.user":  &utils.UIDRef{ID: user},
+		}
+		if hotel != "" {
+			set["booking.hotel"] = &utils.UIDRef{ID: hotel}
+		}
+		if booking.bookingType != "" {
+			set["booking.type"] = booking.bookingType
+		}
+		nodes = append(nodes, &importNode{
+			ref:   booking.ref,
+			set:   set,
+			edges: []string{"booking.room", "booking.hotel", "booking.user"},
+		})
+	}
+	return writeNodes(r, kindBooking, nodes, &report.Bookings)
+}
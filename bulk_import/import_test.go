@@ -0,0 +1,234 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fluidmediaproductions/central_hotel_door_server/clients"
+	"github.com/fluidmediaproductions/central_hotel_door_server/utils"
+)
+
+// fakeStore keeps nodes in memory, keyed by uid.
+type fakeStore struct {
+	nodes  map[string]map[string]interface{}
+	users  map[string]string
+	blocks map[string][]*clients.RoomBlock
+	next   int
+	writes int
+}
+
+func newFakeStore() *fakeStore {
+	return &fakeStore{
+		nodes:  map[string]map[string]interface{}{},
+		users:  map[string]string{"guest@example.com": "0x100"},
+		blocks: map[string][]*clients.RoomBlock{},
+		next:   0x200,
+	}
+}
+
+func (s *fakeStore) findRef(kind string, ref string) (string, error) {
+	for uid, node := range s.nodes {
+		if node[kind+".importRef"] == ref {
+			return uid, nil
+		}
+	}
+	return "", nil
+}
+
+func (s *fakeStore) nodeExists(kind string, id string) (bool, error) {
+	node, isOk := s.nodes[id]
+	return isOk && node[kind] == true, nil
+}
+
+func (s *fakeStore) findUser(email string) (string, error) {
+	return s.users[email], nil
+}
+
+func (s *fakeStore) roomHotel(roomId string) (string, error) {
+	hotel, _ := s.nodes[roomId]["room.hotel.uid"].(string)
+	return hotel, nil
+}
+
+func (s *fakeStore) roomBookings(roomId string) ([]*existingBooking, error) {
+	bookings := make([]*existingBooking, 0)
+	for uid, node := range s.nodes {
+		if node["booking.room.uid"] != roomId {
+			continue
+		}
+		ref, _ := node["booking.importRef"].(string)
+		bookings = append(bookings, &existingBooking{
+			ID:    uid,
+			Ref:   ref,
+			Start: node["booking.start"].(time.Time),
+			End:   node["booking.end"].(time.Time),
+		})
+	}
+	return bookings, nil
+}
+
+func (s *fakeStore) roomBlocks(roomId string) ([]*clients.RoomBlock, error) {
+	return s.blocks[roomId], nil
+}
+
+func (s *fakeStore) write(set []interface{}, del []interface{}) (map[string]string, error) {
+	s.writes++
+	assigned := map[string]string{}
+	for _, item := range set {
+		// Audit entries aren't kept
+		node, isOk := item.(map[string]interface{})
+		if !isOk {
+			continue
+		}
+		uid := node["uid"].(string)
+		if strings.HasPrefix(uid, "_:") {
+			newUID := fmt.Sprintf("%#x", s.next)
+			s.next++
+			assigned[strings.TrimPrefix(uid, "_:")] = newUID
+			uid = newUID
+		}
+		stored, isOk := s.nodes[uid]
+		if !isOk {
+			stored = map[string]interface{}{}
+			s.nodes[uid] = stored
+		}
+		for predicate, value := range node {
+			stored[predicate] = value
+		}
+		// Keep edges as plain uids so they're easy to look up
+		for _, edge := range []string{"room.hotel", "booking.room", "booking.hotel", "booking.user"} {
+			if ref, isOk := stored[edge].(*utils.UIDRef); isOk {
+				stored[edge+".uid"] = ref.ID
+			}
+		}
+	}
+	return assigned, nil
+}
+
+const testHotels = "ref,name,address,lat,lng,checkIn\n" +
+	"h1,Grand,1 High St,51.5,-0.1,2018-01-01T15:00:00Z\n"
+
+const testRooms = "ref,hotel,name,floor\n" +
+	"r1,h1,101,1\n" +
+	"r2,h1,102,1\n"
+
+func testRequest(bookings string, dryRun bool) *ImportRequest {
+	return &ImportRequest{
+		DryRun: dryRun,
+		Files: []*ImportFile{
+			{Kind: clients.ImportHotels, Format: clients.ImportCSV, Data: testHotels},
+			{Kind: clients.ImportRooms, Format: clients.ImportCSV, Data: testRooms},
+			{Kind: clients.ImportBookings, Format: clients.ImportJSON, Data: bookings},
+		},
+	}
+}
+
+const testBookings = `[
+	{"ref": "b1", "room": "r1", "user": "guest@example.com", "start": "2018-02-01T15:00:00Z", "end": "2018-02-03T10:00:00Z"},
+	{"ref": "b2", "room": "r1", "user": "guest@example.com", "start": "2018-02-03T15:00:00Z", "end": "2018-02-04T10:00:00Z"}
+]`
+
+func TestImportDryRun(t *testing.T) {
+	s := newFakeStore()
+	report, err := runImport(s, testRequest(testBookings, true), "0x1")
+	if err != nil {
+		t.Fatalf("Error importing: %v", err)
+	}
+	if len(report.Errors) != 0 {
+		t.Fatalf("Unexpected errors %+v", report.Errors)
+	}
+	if report.Hotels.Created != 1 || report.Rooms.Created != 2 || report.Bookings.Created != 2 {
+		t.Errorf("Unexpected counts %+v", report)
+	}
+	if s.writes != 0 {
+		t.Errorf("Dry run wrote %d times", s.writes)
+	}
+}
+
+func TestImportIsIdempotent(t *testing.T) {
+	s := newFakeStore()
+	report, err := runImport(s, testRequest(testBookings, false), "0x1")
+	if err != nil {
+		t.Fatalf("Error importing: %v", err)
+	}
+	if len(report.Errors) != 0 {
+		t.Fatalf("Unexpected errors %+v", report.Errors)
+	}
+	nodeCount := len(s.nodes)
+
+	report, err = runImport(s, testRequest(testBookings, false), "0x1")
+	if err != nil {
+		t.Fatalf("Error importing again: %v", err)
+	}
+	if len(report.Errors) != 0 {
+		t.Fatalf("Unexpected errors importing again %+v", report.Errors)
+	}
+	if report.Hotels.Updated != 1 || report.Rooms.Updated != 2 || report.Bookings.Updated != 2 {
+		t.Errorf("Expected everything to be updated, got %+v", report)
+	}
+	if report.Hotels.Created != 0 || report.Rooms.Created != 0 || report.Bookings.Created != 0 {
+		t.Errorf("Expected nothing to be created, got %+v", report)
+	}
+	if len(s.nodes) != nodeCount {
+		t.Errorf("Expected %d nodes after importing again, got %d", nodeCount, len(s.nodes))
+	}
+
+	hotel, _ := s.findRef(kindHotel, "h1")
+	booking, _ := s.findRef(kindBooking, "b1")
+	if s.nodes[booking]["booking.hotel.uid"] != hotel {
+		t.Errorf("Expected booking in hotel %s, got %v", hotel, s.nodes[booking]["booking.hotel.uid"])
+	}
+}
+
+func TestImportValidation(t *testing.T) {
+	s := newFakeStore()
+	_, err := runImport(s, testRequest(testBookings, false), "0x1")
+	if err != nil {
+		t.Fatalf("Error importing: %v", err)
+	}
+	room, _ := s.findRef(kindRoom, "r2")
+	s.blocks[room] = []*clients.RoomBlock{{
+		RoomID: room,
+		Start:  time.Date(2018, 5, 4, 0, 0, 0, 0, time.UTC),
+		End:    time.Date(2018, 5, 10, 0, 0, 0, 0, time.UTC),
+		Reason: "repainting",
+	}}
+
+	bookings := `[
+		{"ref": "b3", "room": "r2", "user": "guest@example.com", "start": "2018-03-01T15:00:00Z", "end": "2018-03-03T10:00:00Z"},
+		{"ref": "b4", "room": "` + room + `", "user": "guest@example.com", "start": "2018-03-02T15:00:00Z", "end": "2018-03-04T10:00:00Z"},
+		{"ref": "b5", "room": "r1", "user": "guest@example.com", "start": "2018-02-02T15:00:00Z", "end": "2018-02-05T10:00:00Z"},
+		{"ref": "b6", "room": "r9", "user": "guest@example.com", "start": "2018-02-02T15:00:00Z", "end": "2018-02-05T10:00:00Z"},
+		{"ref": "b7", "room": "r2", "user": "nobody@example.com", "start": "2018-04-02T15:00:00Z", "end": "2018-04-05T10:00:00Z"},
+		{"ref": "b7", "room": "r2", "user": "guest@example.com", "start": "2018-05-02T15:00:00Z", "end": "2018-05-05T10:00:00Z"}
+	]`
+	writes := s.writes
+	report, err := runImport(s, testRequest(bookings, false), "0x1")
+	if err != nil {
+		t.Fatalf("Error importing: %v", err)
+	}
+	if s.writes != writes {
+		t.Errorf("Import with errors wrote %d times", s.writes-writes)
+	}
+
+	expected := map[string]bool{}
+	for _, e := range report.Errors {
+		expected[e.Ref+": "+e.Message] = true
+	}
+	for _, message := range []string{
+		"b7: ref used more than once",
+		"b6: room \"r9\" not found",
+		"b7: user \"nobody@example.com\" not found",
+		"b4: overlaps booking \"b3\" in the import",
+		"b7: room is out of service for repainting",
+	} {
+		if !expected[message] {
+			t.Errorf("Expected error %q, got %+v", message, report.Errors)
+		}
+	}
+	b1, _ := s.findRef(kindBooking, "b1")
+	if !expected["b5: overlaps booking "+b1] {
+		t.Errorf("Expected b5 to overlap b1, got %+v", report.Errors)
+	}
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dgraph-io/dgo"
+	"github.com/dgraph-io/dgo/protos/api"
+	"github.com/fluidmediaproductions/central_hotel_door_server/clients"
+	"github.com/fluidmediaproductions/central_hotel_door_server/utils"
+	"github.com/gorilla/mux"
+	"github.com/spf13/viper"
+	"google.golang.org/grpc"
+)
+
+const addr = ":80"
+
+// maxImportSize limits the size of an import request body.
+const maxImportSize = 32 << 20
+
+var db *dgo.Dgraph
+var jwtSecret []byte
+
+// importData runs an import sent by the management API. Only admins can
+// import.
+func importData(w http.ResponseWriter, r *http.Request) {
+	claims, err := utils.GetRequestJWT(r, jwtSecret)
+	if err != nil {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(&ImportResp{
+			Err:  err.Error(),
+			Code: utils.CodeUnauthenticated,
+		})
+		return
+	}
+	if !claims.User.HasRole(utils.RoleAdmin) {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(&ImportResp{
+			Err:  "importing needs the admin role",
+			Code: utils.CodeForbidden,
+		})
+		return
+	}
+
+	var req ImportRequest
+	err = json.NewDecoder(http.MaxBytesReader(w, r.Body, maxImportSize)).Decode(&req)
+	r.Body.Close()
+	if err != nil || len(req.Files) == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(&ImportResp{
+			Err:  "bad request data",
+			Code: utils.CodeBadRequest,
+		})
+		return
+	}
+
+	report, err := runImport(&dgraphStore{db: db}, &req, claims.User.ID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(&ImportResp{
+			Err:    err.Error(),
+			Code:   utils.CodeInternal,
+			Report: report,
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(&ImportResp{
+		Report: report,
+	})
+}
+
+func router() *mux.Router {
+	r := mux.NewRouter()
+
+	r.Methods("POST").Path("/import").HandlerFunc(importData)
+
+	return r
+}
+
+// readImportFile reads a file to import from disk, taking its format from
+// its extension.
+func readImportFile(kind string, path string) (*ImportFile, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	format := clients.ImportCSV
+	if strings.ToLower(filepath.Ext(path)) == ".json" {
+		format = clients.ImportJSON
+	}
+	return &ImportFile{
+		Kind:   kind,
+		Format: format,
+		Data:   string(data),
+	}, nil
+}
+
+// runCommand imports the files given on the command line, prints the report
+// and exits, with a failure if anything was wrong with the files.
+func runCommand(paths map[string]string, dryRun bool) {
+	req := &ImportRequest{
+		DryRun: dryRun,
+	}
+	for _, kind := range []string{clients.ImportHotels, clients.ImportRooms, clients.ImportBookings} {
+		if paths[kind] == "" {
+			continue
+		}
+		file, err := readImportFile(kind, paths[kind])
+		if err != nil {
+			log.Fatalf("Error reading %s: %v\n", kind, err)
+		}
+		req.Files = append(req.Files, file)
+	}
+
+	report, err := runImport(&dgraphStore{db: db}, req, "")
+	if report != nil {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(report)
+	}
+	if err != nil {
+		log.Fatalf("Error importing: %v\n", err)
+	}
+	if len(report.Errors) > 0 {
+		os.Exit(1)
+	}
+}
+
+func newDbClient(dbHost string) *dgo.Dgraph {
+	d, err := grpc.Dial(dbHost, grpc.WithInsecure())
+	if err != nil {
+		log.Fatalf("Error connecting: %v\n", err)
+	}
+
+	return dgo.NewDgraphClient(
+		api.NewDgraphClient(d),
+	)
+}
+
+func setup(c *dgo.Dgraph) {
+	err := c.Alter(context.Background(), &api.Operation{
+		Schema: `
+			hotel.importRef: string @index(exact) @upsert .
+			room.importRef: string @index(exact) @upsert .
+			booking.importRef: string @index(exact) @upsert .
+		` + utils.AuditSchema,
+	})
+	if err != nil {
+		log.Fatalf("Error setting up schema: %v\n", err)
+	}
+}
+
+func main() {
+	hotels := flag.String("hotels", "", "CSV or JSON file of hotels to import")
+	rooms := flag.String("rooms", "", "CSV or JSON file of rooms to import")
+	bookings := flag.String("bookings", "", "CSV or JSON file of bookings to import")
+	dryRun := flag.Bool("dry-run", false, "check the files and report what would change, without writing anything")
+	flag.Parse()
+
+	viper.SetDefault("DB_HOST", "dgraph-server-public:9080")
+
+	viper.SetEnvPrefix("TRAVELR")
+	viper.AutomaticEnv()
+
+	dbHost := viper.GetString("DB_HOST")
+
+	jwtSecret = []byte(viper.GetString("JWT_SECRET"))
+
+	db = newDbClient(dbHost)
+
+	setup(db)
+
+	if *hotels != "" || *rooms != "" || *bookings != "" {
+		runCommand(map[string]string{
+			clients.ImportHotels:   *hotels,
+			clients.ImportRooms:    *rooms,
+			clients.ImportBookings: *bookings,
+		}, *dryRun)
+		return
+	}
+
+	log.Printf("Listening on %s\n", addr)
+	log.Fatalln(http.ListenAndServe(addr, router()))
+}
@@ -0,0 +1,338 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fluidmediaproductions/central_hotel_door_server/clients"
+	"github.com/fluidmediaproductions/central_hotel_door_server/utils"
+	"github.com/pkg/errors"
+)
+
+type ImportFile = clients.ImportFile
+type ImportRequest = clients.ImportRequest
+type ImportReport = clients.ImportReport
+type ImportError = clients.ImportError
+type ImportResp = clients.ImportResp
+
+// fields holds the values of one row of a file by column name.
+type fields map[string]string
+
+type row struct {
+	num    int
+	fields fields
+}
+
+func parseRows(format string, data string) ([]*row, error) {
+	switch format {
+	case clients.ImportCSV:
+		return parseCSV(data)
+	case clients.ImportJSON:
+		return parseJSON(data)
+	}
+	return nil, errors.Errorf("unknown format %q", format)
+}
+
+func parseCSV(data string) ([]*row, error) {
+	reader := csv.NewReader(strings.NewReader(data))
+	reader.TrimLeadingSpace = true
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, errors.New("missing header row")
+	}
+
+	header := records[0]
+	for i, name := range header {
+		header[i] = strings.TrimSpace(name)
+	}
+	rows := make([]*row, 0, len(records)-1)
+	for i, record := range records[1:] {
+		values := fields{}
+		for j, value := range record {
+			values[header[j]] = strings.TrimSpace(value)
+		}
+		rows = append(rows, &row{
+			num:    i + 2,
+			fields: values,
+		})
+	}
+	return rows, nil
+}
+
+func parseJSON(data string) ([]*row, error) {
+	decoder := json.NewDecoder(strings.NewReader(data))
+	decoder.UseNumber()
+	var items []map[string]interface{}
+	err := decoder.Decode(&items)
+	if err != nil {
+		return nil, err
+	}
+
+	rows := make([]*row, 0, len(items))
+	for i, item := range items {
+		values := fields{}
+		for name, value := range item {
+			switch v := value.(type) {
+			case nil:
+			case string:
+				values[name] = strings.TrimSpace(v)
+			case json.Number, bool:
+				values[name] = fmt.Sprint(v)
+			default:
+				return nil, errors.Errorf("item %d: %s must be a string, number or boolean", i+1, name)
+			}
+		}
+		rows = append(rows, &row{
+			num:    i + 1,
+			fields: values,
+		})
+	}
+	return rows, nil
+}
+
+func (f fields) required(name string) (string, error) {
+	value := f[name]
+	if value == "" {
+		return "", errors.Errorf("%s is needed", name)
+	}
+	return value, nil
+}
+
+func (f fields) float(name string) (float64, error) {
+	value, err := f.required(name)
+	if err != nil {
+		return 0, err
+	}
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, errors.Errorf("invalid %s %q", name, value)
+	}
+	return number, nil
+}
+
+func (f fields) time(name string) (time.Time, error) {
+	value, err := f.required(name)
+	if err != nil {
+		return time.Time{}, err
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, errors.Errorf("invalid %s %q, it should be RFC 3339", name, value)
+	}
+	return t, nil
+}
+
+// bool reads an optional flag, which is false when left empty.
+func (f fields) bool(name string) (bool, error) {
+	value := f[name]
+	if value == "" {
+		return false, nil
+	}
+	flag, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, errors.Errorf("invalid %s %q", name, value)
+	}
+	return flag, nil
+}
+
+// ref reads the ID a row has in the system it came from. Rows are matched to
+// what's already been imported by it, which makes importing a file again
+// update the same nodes.
+func (f fields) ref() (string, error) {
+	ref, err := f.required("ref")
+	if err != nil {
+		return "", err
+	}
+	if utils.IsUID(ref) {
+		return "", errors.Errorf("ref %q can't look like a uid", ref)
+	}
+	return ref, nil
+}
+
+type hotelRecord struct {
+	row        int
+	ref        string
+	name       string
+	address    string
+	lat        float64
+	lng        float64
+	checkIn    time.Time
+	timeZone   string
+	hasCarPark bool
+}
+
+func hotelFromFields(f fields) (*hotelRecord, error) {
+	var err error
+	hotel := &hotelRecord{}
+	if hotel.ref, err = f.ref(); err != nil {
+		return nil, err
+	}
+	if hotel.name, err = f.required("name"); err != nil {
+		return nil, err
+	}
+	if hotel.address, err = f.required("address"); err != nil {
+		return nil, err
+	}
+	if hotel.lat, err = f.float("lat"); err != nil {
+		return nil, err
+	}
+	if hotel.lng, err = f.float("lng"); err != nil {
+		return nil, err
+	}
+	if err = utils.CheckLatLng(hotel.lat, hotel.lng); err != nil {
+		return nil, err
+	}
+	if hotel.checkIn, err = f.time("checkIn"); err != nil {
+		return nil, err
+	}
+	// Check-in is a time on the hotel's own clock
+	hotel.checkIn = utils.ClockTime(hotel.checkIn)
+	// A hotel's time zone is only changed when one is given
+	if hotel.timeZone = f["timeZone"]; hotel.timeZone != "" {
+		if err = utils.CheckTimeZone(hotel.timeZone); err != nil {
+			return nil, err
+		}
+	}
+	if hotel.hasCarPark, err = f.bool("hasCarPark"); err != nil {
+		return nil, err
+	}
+	return hotel, nil
+}
+
+// roomRecord is a room, in the hotel with the ref or uid in hotel.
+type roomRecord struct {
+	row      int
+	ref      string
+	hotel    string
+	name     string
+	floor    string
+	category string
+}
+
+func roomFromFields(f fields) (*roomRecord, error) {
+	var err error
+	room := &roomRecord{
+		floor:    f["floor"],
+		category: f["category"],
+	}
+	if room.ref, err = f.ref(); err != nil {
+		return nil, err
+	}
+	if room.hotel, err = f.required("hotel"); err != nil {
+		return nil, err
+	}
+	if room.name, err = f.required("name"); err != nil {
+		return nil, err
+	}
+	return room, nil
+}
+
+// bookingRecord is a booking of the room with the ref or uid in room, for
+// the user with the email in user.
+type bookingRecord struct {
+	row         int
+	ref         string
+	room        string
+	user        string
+	start       time.Time
+	end         time.Time
+	bookingType string
+}
+
+func bookingFromFields(f fields) (*bookingRecord, error) {
+	var err error
+	booking := &bookingRecord{
+		bookingType: f["type"],
+	}
+	if booking.ref, err = f.ref(); err != nil {
+		return nil, err
+	}
+	if booking.room, err = f.required("room"); err != nil {
+		return nil, err
+	}
+	if booking.user, err = f.required("user"); err != nil {
+		return nil, err
+	}
+	if booking.start, err = f.time("start"); err != nil {
+		return nil, err
+	}
+	if booking.end, err = f.time("end"); err != nil {
+		return nil, err
+	}
+	if !booking.start.Before(booking.end) {
+		return nil, errors.New("start must be before end")
+	}
+	return booking, nil
+}
+
+// batch is everything in one import.
+type batch struct {
+	hotels   []*hotelRecord
+	rooms    []*roomRecord
+	bookings []*bookingRecord
+}
+
+func addError(report *ImportReport, kind string, row int, ref string, err error) {
+	report.Errors = append(report.Errors, &ImportError{
+		Kind:    kind,
+		Row:     row,
+		Ref:     ref,
+		Message: err.Error(),
+	})
+}
+
+// parseBatch reads the files of an import, adding any rows it can't read to
+// the report's errors.
+func parseBatch(files []*ImportFile, report *ImportReport) *batch {
+	b := &batch{}
+	for _, file := range files {
+		switch file.Kind {
+		case clients.ImportHotels, clients.ImportRooms, clients.ImportBookings:
+		default:
+			addError(report, file.Kind, 0, "", errors.Errorf("unknown kind %q", file.Kind))
+			continue
+		}
+		rows, err := parseRows(file.Format, file.Data)
+		if err != nil {
+			addError(report, file.Kind, 0, "", err)
+			continue
+		}
+		for _, r := range rows {
+			ref := r.fields["ref"]
+			switch file.Kind {
+			case clients.ImportHotels:
+				hotel, err := hotelFromFields(r.fields)
+				if err != nil {
+					addError(report, file.Kind, r.num, ref, err)
+					continue
+				}
+				hotel.row = r.num
+				b.hotels = append(b.hotels, hotel)
+			case clients.ImportRooms:
+				room, err := roomFromFields(r.fields)
+				if err != nil {
+					addError(report, file.Kind, r.num, ref, err)
+					continue
+				}
+				room.row = r.num
+				b.rooms = append(b.rooms, room)
+			case clients.ImportBookings:
+				booking, err := bookingFromFields(r.fields)
+				if err != nil {
+					addError(report, file.Kind, r.num, ref, err)
+					continue
+				}
+				booking.row = r.num
+				b.bookings = append(b.bookings, booking)
+			}
+		}
+	}
+	return b
+}
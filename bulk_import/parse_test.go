@@ -0,0 +1,103 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/fluidmediaproductions/central_hotel_door_server/clients"
+)
+
+func TestParseCSV(t *testing.T) {
+	rows, err := parseRows(clients.ImportCSV, "ref, name\nh1, Grand \nh2,\"Sea, View\"\n")
+	if err != nil {
+		t.Fatalf("Error parsing CSV: %v", err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("Expected 2 rows, got %d", len(rows))
+	}
+	if rows[0].num != 2 || rows[0].fields["name"] != "Grand" {
+		t.Errorf("Unexpected first row %+v", rows[0])
+	}
+	if rows[1].num != 3 || rows[1].fields["name"] != "Sea, View" {
+		t.Errorf("Unexpected second row %+v", rows[1])
+	}
+
+	_, err = parseRows(clients.ImportCSV, "")
+	if err == nil {
+		t.Errorf("Expected an error for a CSV file without a header")
+	}
+}
+
+func TestParseJSON(t *testing.T) {
+	rows, err := parseRows(clients.ImportJSON, `[{"ref": "h1", "lat": 51.5, "hasCarPark": true, "address": null}]`)
+	if err != nil {
+		t.Fatalf("Error parsing JSON: %v", err)
+	}
+	if len(rows) != 1 || rows[0].num != 1 {
+		t.Fatalf("Unexpected rows %+v", rows)
+	}
+	f := rows[0].fields
+	if f["lat"] != "51.5" || f["hasCarPark"] != "true" || f["address"] != "" {
+		t.Errorf("Unexpected fields %+v", f)
+	}
+
+	_, err = parseRows(clients.ImportJSON, `[{"ref": {"nested": true}}]`)
+	if err == nil {
+		t.Errorf("Expected an error for a nested value")
+	}
+	_, err = parseRows("xml", "")
+	if err == nil {
+		t.Errorf("Expected an error for an unknown format")
+	}
+}
+
+func TestParseBatch(t *testing.T) {
+	report := &ImportReport{}
+	b := parseBatch([]*ImportFile{
+		{
+			Kind:   clients.ImportHotels,
+			Format: clients.ImportCSV,
+			Data: "ref,name,address,lat,lng,checkIn,hasCarPark,timeZone\n" +
+				"h1,Grand,1 High St,51.5,-0.1,2018-01-01T15:00:00Z,yes,\n" +
+				"h2,Grand,1 High St,91,-0.1,2018-01-01T15:00:00Z,,\n" +
+				"0x1,Grand,1 High St,51.5,-0.1,2018-01-01T15:00:00Z,,\n" +
+				"h3,Grand,1 High St,51.5,-0.1,2018-01-01T15:00:00Z,,Europe/Nowhere\n",
+		},
+		{
+			Kind:   clients.ImportBookings,
+			Format: clients.ImportJSON,
+			Data: `[{"ref": "b1", "room": "r1", "user": "a@b.com", "start": "2018-01-02T15:00:00Z", "end": "2018-01-01T10:00:00Z"},
+				{"ref": "b2", "room": "r1", "user": "a@b.com", "start": "2018-01-01T15:00:00Z", "end": "2018-01-02T10:00:00Z"}]`,
+		},
+		{
+			Kind:   "guests",
+			Format: clients.ImportCSV,
+		},
+	}, report)
+
+	if len(b.hotels) != 0 {
+		t.Errorf("Expected no valid hotels, got %d", len(b.hotels))
+	}
+	if len(b.bookings) != 1 || b.bookings[0].ref != "b2" || b.bookings[0].row != 2 {
+		t.Errorf("Expected only booking b2, got %+v", b.bookings)
+	}
+
+	expected := []struct {
+		kind string
+		row  int
+	}{
+		{clients.ImportHotels, 2},
+		{clients.ImportHotels, 3},
+		{clients.ImportHotels, 4},
+		{clients.ImportHotels, 5},
+		{clients.ImportBookings, 1},
+		{"guests", 0},
+	}
+	if len(report.Errors) != len(expected) {
+		t.Fatalf("Expected %d errors, got %+v", len(expected), report.Errors)
+	}
+	for i, e := range expected {
+		if report.Errors[i].Kind != e.kind || report.Errors[i].Row != e.row {
+			t.Errorf("Expected error %d to be %s row %d, got %+v", i, e.kind, e.row, report.Errors[i])
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"sort"
+	"time"
+
+	"github.com/fluidmediaproductions/central_hotel_door_server/clients"
+	"github.com/fluidmediaproductions/central_hotel_door_server/utils"
+	"github.com/pkg/errors"
+)
+
+// The node kinds an import writes. Each has a predicate holding the import
+// ref, named kind.importRef.
+const (
+	kindHotel   = "hotel"
+	kindRoom    = "room"
+	kindBooking = "booking"
+)
+
+// existingBooking is a booking already in the database, to check imported
+// bookings don't overlap it.
+type existingBooking struct {
+	ID    string
+	Ref   string
+	Start time.Time
+	End   time.Time
+}
+
+// store is what an import needs from the database.
+type store interface {
+	// findRef returns the uid of the node of a kind imported with ref, or an
+	// empty string if there isn't one.
+	findRef(kind string, ref string) (string, error)
+	nodeExists(kind string, id string) (bool, error)
+	// findUser returns the uid of the user with an email, or an empty string.
+	findUser(email string) (string, error)
+	roomHotel(roomId string) (string, error)
+	roomBookings(roomId string) ([]*existingBooking, error)
+	// roomBlocks lists the times a room is out of service.
+	roomBlocks(roomId string) ([]*clients.RoomBlock, error)
+	// write sets and deletes nodes in one transaction, returning the uids
+	// given to blank nodes.
+	write(set []interface{}, del []interface{}) (map[string]string, error)
+}
+
+// resolver finds the uids of the nodes an import refers to, by their ref or
+// by uid, remembering them as it goes.
+type resolver struct {
+	store store
+	uids  map[string]string
+}
+
+func newResolver(s store) *resolver {
+	return &resolver{
+		store: s,
+		uids:  map[string]string{},
+	}
+}
+
+// find returns the uid of a node of a kind from its ref or uid, or an empty
+// string if it isn't in the database.
+func (r *resolver) find(kind string, key string) (string, error) {
+	cacheKey := kind + "/" + key
+	if uid, isOk := r.uids[cacheKey]; isOk {
+		return uid, nil
+	}
+	uid := ""
+	if utils.IsUID(key) {
+		exists, err := r.store.nodeExists(kind, key)
+		if err != nil {
+			return "", err
+		}
+		if exists {
+			uid = key
+		}
+	} else {
+		var err error
+		uid, err = r.store.findRef(kind, key)
+		if err != nil {
+			return "", err
+		}
+	}
+	r.uids[cacheKey] = uid
+	return uid, nil
+}
+
+// remember records the uid a node was written with.
+func (r *resolver) remember(kind string, ref string, uid string) {
+	r.uids[kind+"/"+ref] = uid
+}
+
+func overlaps(aStart time.Time, aEnd time.Time, bStart time.Time, bEnd time.Time) bool {
+	return aStart.Before(bEnd) && bStart.Before(aEnd)
+}
+
+// validate checks the references in an import resolve, refs aren't used
+// twice, and no room ends up double booked or booked while it's out of
+// service. It adds what it finds to the report's errors.
+func validate(b *batch, r *resolver, report *ImportReport) error {
+	hotelRefs := map[string]bool{}
+	for _, hotel := range b.hotels {
+		if hotelRefs[hotel.ref] {
+			addError(report, clients.ImportHotels, hotel.row, hotel.ref, errors.New("ref used more than once"))
+		}
+		hotelRefs[hotel.ref] = true
+	}
+
+	roomRefs := map[string]bool{}
+	for _, room := range b.rooms {
+		if roomRefs[room.ref] {
+			addError(report, clients.ImportRooms, room.row, room.ref, errors.New("ref used more than once"))
+		}
+		roomRefs[room.ref] = true
+
+		if hotelRefs[room.hotel] {
+			continue
+		}
+		uid, err := r.find(kindHotel, room.hotel)
+		if err != nil {
+			return err
+		}
+		if uid == "" {
+			addError(report, clients.ImportRooms, room.row, room.ref, errors.Errorf("hotel %q not found", room.hotel))
+		}
+	}
+
+	bookingRefs := map[string]bool{}
+	for _, booking := range b.bookings {
+		if bookingRefs[booking.ref] {
+			addError(report, clients.ImportBookings, booking.row, booking.ref, errors.New("ref used more than once"))
+		}
+		bookingRefs[booking.ref] = true
+	}
+
+	// Group the bookings by room, under the room's uid if it has one so a
+	// room given by ref and by uid is still seen as one room
+	byRoom := map[string][]*bookingRecord{}
+	roomUIDs := map[string]string{}
+	for _, booking := range b.bookings {
+		uid, err := r.find(kindRoom, booking.room)
+		if err != nil {
+			return err
+		}
+		if uid == "" && !roomRefs[booking.room] {
+			addError(report, clients.ImportBookings, booking.row, booking.ref, errors.Errorf("room %q not found", booking.room))
+			continue
+		}
+		user, err := r.store.findUser(booking.user)
+		if err != nil {
+			return err
+		}
+		if user == "" {
+			addError(report, clients.ImportBookings, booking.row, booking.ref, errors.Errorf("user %q not found", booking.user))
+		}
+
+		key := "ref/" + booking.room
+		if uid != "" {
+			key = uid
+		}
+		roomUIDs[key] = uid
+		byRoom[key] = append(byRoom[key], booking)
+	}
+
+	keys := make([]string, 0, len(byRoom))
+	for key := range byRoom {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		bookings := byRoom[key]
+		sort.Slice(bookings, func(i, j int) bool {
+			return bookings[i].start.Before(bookings[j].start)
+		})
+		for i := 1; i < len(bookings); i++ {
+			if overlaps(bookings[i-1].start, bookings[i-1].end, bookings[i].start, bookings[i].end) {
+				addError(report, clients.ImportBookings, bookings[i].row, bookings[i].ref,
+					errors.Errorf("overlaps booking %q in the import", bookings[i-1].ref))
+			}
+		}
+
+		if roomUIDs[key] == "" {
+			continue
+		}
+		existing, err := r.store.roomBookings(roomUIDs[key])
+		if err != nil {
+			return err
+		}
+		for _, booking := range bookings {
+			for _, other := range existing {
+				// A booking being imported again replaces itself
+				if other.Ref != "" && bookingRefs[other.Ref] {
+					continue
+				}
+				if overlaps(booking.start, booking.end, other.Start, other.End) {
+					addError(report, clients.ImportBookings, booking.row, booking.ref,
+						errors.Errorf("overlaps booking %s", other.ID))
+				}
+			}
+		}
+
+		blocks, err := r.store.roomBlocks(roomUIDs[key])
+		if err != nil {
+			return err
+		}
+		for _, booking := range bookings {
+			for _, block := range blocks {
+				if block.Overlaps(booking.start, booking.end) {
+					addError(report, clients.ImportBookings, booking.row, booking.ref,
+						errors.Errorf("room is out of service for %s", block.Reason))
+				}
+			}
+		}
+	}
+	return nil
+}
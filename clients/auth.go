@@ -0,0 +1,102 @@
+package clients
+
+import (
+	"context"
+	"time"
+
+	"github.com/fluidmediaproductions/central_hotel_door_server/utils"
+)
+
+type JWTResp struct {
+	Err  string `json:"err"`
+	Code string `json:"code,omitempty"`
+	Jwt  string `json:"jwt"`
+}
+
+type ChangePasswordResp struct {
+	Err     string `json:"err"`
+	Code    string `json:"code,omitempty"`
+	Success bool   `json:"success"`
+}
+
+type UpdateUserResp struct {
+	Err     string `json:"err"`
+	Code    string `json:"code,omitempty"`
+	Success bool   `json:"success"`
+}
+
+type UserInfoResp struct {
+	Err  string      `json:"err"`
+	Code string      `json:"code,omitempty"`
+	User *utils.User `json:"user"`
+}
+
+// UserAccount is a user as support staff see it, with the state of their
+// account.
+type UserAccount struct {
+	ID                 string     `json:"uid"`
+	Email              string     `json:"email"`
+	Name               string     `json:"name"`
+	Roles              []string   `json:"roles,omitempty"`
+	Disabled           bool       `json:"disabled"`
+	MustResetPass      bool       `json:"mustResetPass"`
+	EmailVerified      bool       `json:"emailVerified"`
+	SessionsValidAfter *time.Time `json:"sessionsValidAfter,omitempty"`
+}
+
+type UserAccountResp struct {
+	Err  string       `json:"err"`
+	Code string       `json:"code,omitempty"`
+	User *UserAccount `json:"user"`
+}
+
+type UserAccountsResp struct {
+	Err   string         `json:"err"`
+	Code  string         `json:"code,omitempty"`
+	Users []*UserAccount `json:"users"`
+}
+
+// UserUpdate holds the user details to change, empty fields are left alone.
+type UserUpdate struct {
+	Email string `json:"email,omitempty"`
+	Name  string `json:"name,omitempty"`
+}
+
+type AuthClient struct {
+	*Client
+}
+
+func NewAuthClient(baseURL string) *AuthClient {
+	return &AuthClient{New(baseURL)}
+}
+
+func (c *AuthClient) Login(ctx context.Context, email string, pass string) (string, error) {
+	var resp JWTResp
+	data := map[string]string{
+		"email": email,
+		"pass":  pass,
+	}
+	err := c.send(ctx, "POST", "/login", "", data, &resp)
+	return resp.Jwt, err
+}
+
+func (c *AuthClient) ChangePassword(ctx context.Context, token string, pass string) (bool, error) {
+	var resp ChangePasswordResp
+	data := map[string]string{
+		"pass": pass,
+	}
+	err := c.send(ctx, "POST", "/changePassword", token, data, &resp)
+	return resp.Success, err
+}
+
+func (c *AuthClient) UpdateUser(ctx context.Context, token string, update *UserUpdate) (bool, error) {
+	var resp UpdateUserResp
+	err := c.send(ctx, "POST", "/updateUser", token, update, &resp)
+	return resp.Success, err
+}
+
+func (c *AuthClient) UserInfo(ctx context.Context, token string) (*utils.User, error) {
+	var resp UserInfoResp
+	err := c.get(ctx, "/userInfo", token, &resp)
+	return resp.User, err
+}
@@ -0,0 +1,251 @@
+package clients
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/fluidmediaproductions/central_hotel_door_server/utils"
+)
+
+// The states a booking goes through. A confirmed booking can be checked in,
+// cancelled or marked as a no-show, and a checked in one checked out.
+const (
+	BookingConfirmed  = "confirmed"
+	BookingCheckedIn  = "checked_in"
+	BookingCheckedOut = "checked_out"
+	BookingCancelled  = "cancelled"
+	BookingNoShow     = "no_show"
+)
+
+// Booking is a stay in a hotel. Bookings can be made against a room
+// category, leaving RoomID empty until the hotel assigns a room. NeedsRoom is
+// set when the booking's room is taken out of service, until staff move it.
+type Booking struct {
+	ID           string            `json:"uid"`
+	UserID       string            `json:"userId"`
+	Start        time.Time         `json:"start"`
+	End          time.Time         `json:"end"`
+	HotelID      string            `json:"hotelId"`
+	RoomID       string            `json:"roomId"`
+	Category     string            `json:"category,omitempty"`
+	NeedsRoom    bool              `json:"needsRoom,omitempty"`
+	RoomHistory  []*RoomAssignment `json:"roomHistory,omitempty"`
+	Type         string            `json:"type"`
+	Status       string            `json:"status"`
+	CheckedInAt  *time.Time        `json:"checkedInAt,omitempty"`
+	CheckedOutAt *time.Time        `json:"checkedOutAt,omitempty"`
+	CancelledAt  *time.Time        `json:"cancelledAt,omitempty"`
+	NoShowAt     *time.Time        `json:"noShowAt,omitempty"`
+	GuestID      string            `json:"guestId,omitempty"`
+	Guests       []*BookingGuest   `json:"guests,omitempty"`
+	Price        *Quote            `json:"price,omitempty"`
+	Payment      *BookingPayment   `json:"payment,omitempty"`
+}
+
+// IsOpen is whether a booking still lets its guests in, rather than having
+// been cancelled, checked out or missed. Bookings from before there were
+// states count as confirmed.
+func (b *Booking) IsOpen() bool {
+	switch b.Status {
+	case "", BookingConfirmed, BookingCheckedIn:
+		return true
+	}
+	return false
+}
+
+// AllowsAccess is whether a booking lets its guests in at a time. Bookings
+// without a room yet don't let anyone in.
+func (b *Booking) AllowsAccess(now time.Time) bool {
+	return b.IsOpen() && b.RoomID != "" && !now.Before(b.Start) && !now.After(b.End)
+}
+
+// RoomAssignment is a room a booking was in, and who put it there. End is
+// nil for the room the booking is in now.
+type RoomAssignment struct {
+	ID         string     `json:"uid"`
+	RoomID     string     `json:"roomId"`
+	Start      time.Time  `json:"start"`
+	End        *time.Time `json:"end,omitempty"`
+	AssignedBy string     `json:"assignedBy,omitempty"`
+}
+
+type BookingsResp struct {
+	Err      string          `json:"err"`
+	Code     string          `json:"code,omitempty"`
+	Bookings []*Booking      `json:"bookings"`
+	PageInfo *utils.PageInfo `json:"pageInfo,omitempty"`
+}
+
+// Booking statuses that bookings can be filtered by, worked out from the
+// booking's dates.
+const (
+	BookingUpcoming = "upcoming"
+	BookingActive   = "active"
+	BookingPast     = "past"
+)
+
+// BookingFilter narrows down and pages through a user's bookings. From and
+// To match bookings that overlap them. Status is worked out from the dates,
+// and only matches open bookings, while State is the booking's own state.
+type BookingFilter struct {
+	utils.Page
+	From   *time.Time
+	To     *time.Time
+	Status string
+	State  string
+}
+
+func (f *BookingFilter) encode() string {
+	if f == nil {
+		return ""
+	}
+	query := url.Values{}
+	f.Page.Encode(query)
+	if f.From != nil {
+		query.Set("from", f.From.Format(time.RFC3339))
+	}
+	if f.To != nil {
+		query.Set("to", f.To.Format(time.RFC3339))
+	}
+	if f.Status != "" {
+		query.Set("status", f.Status)
+	}
+	if f.State != "" {
+		query.Set("state", f.State)
+	}
+	return encodeQuery(query)
+}
+
+type BookingResp struct {
+	Err     string   `json:"err"`
+	Code    string   `json:"code,omitempty"`
+	Booking *Booking `json:"booking"`
+}
+
+// BookingStatusChange moves a booking on to another state.
+type BookingStatusChange struct {
+	Status string `json:"status"`
+}
+
+// BookingTypeChange sets what type a booking is, which decides the zones its
+// guests can get in to.
+type BookingTypeChange struct {
+	Type string `json:"type"`
+}
+
+// RoomChange assigns a booking a room, or moves it to another one.
+type RoomChange struct {
+	RoomID string `json:"roomId"`
+}
+
+// BookingGuest is someone the booking's owner has shared access to the room
+// with. Guests only get access once they've accepted the invite with its
+// token, which is handed back just the once when they're invited.
+type BookingGuest struct {
+	ID          string    `json:"uid"`
+	Email       string    `json:"email"`
+	UserID      string    `json:"userId,omitempty"`
+	Start       time.Time `json:"start"`
+	End         time.Time `json:"end"`
+	Revoked     bool      `json:"revoked"`
+	InviteToken string    `json:"inviteToken,omitempty"`
+}
+
+type BookingGuestResp struct {
+	Err   string        `json:"err"`
+	Code  string        `json:"code,omitempty"`
+	Guest *BookingGuest `json:"guest"`
+}
+
+// GuestInvite asks for a guest to be added to a booking. Start and end
+// default to the booking's own.
+type GuestInvite struct {
+	Email string     `json:"email"`
+	Start *time.Time `json:"start,omitempty"`
+	End   *time.Time `json:"end,omitempty"`
+}
+
+// GuestInviteAccept redeems an invite's token for the user accepting it.
+type GuestInviteAccept struct {
+	Token string `json:"token"`
+}
+
+// BookingsClient calls the bookings service, which only returns bookings
+// belonging to the user in the token.
+type BookingsClient struct {
+	*Client
+}
+
+func NewBookingsClient(baseURL string) *BookingsClient {
+	return &BookingsClient{New(baseURL)}
+}
+
+func (c *BookingsClient) GetBookings(ctx context.Context, token string, filter *BookingFilter) ([]*Booking, *utils.PageInfo, error) {
+	var resp BookingsResp
+	err := c.get(ctx, "/bookings"+filter.encode(), token, &resp)
+	return resp.Bookings, resp.PageInfo, err
+}
+
+func (c *BookingsClient) GetBooking(ctx context.Context, token string, id string) (*Booking, error) {
+	var resp BookingResp
+	err := c.get(ctx, fmt.Sprintf("/bookings/%s", url.PathEscape(id)), token, &resp)
+	return resp.Booking, err
+}
+
+func (c *BookingsClient) GetBookingsByRoom(ctx context.Context, token string, roomId string) ([]*Booking, error) {
+	var resp BookingsResp
+	err := c.get(ctx, fmt.Sprintf("/bookings/by-room/%s", url.PathEscape(roomId)), token, &resp)
+	return resp.Bookings, err
+}
+
+func (c *BookingsClient) GetBookingsByHotel(ctx context.Context, token string, hotelId string) ([]*Booking, error) {
+	var resp BookingsResp
+	err := c.get(ctx, fmt.Sprintf("/bookings/by-hotel/%s", url.PathEscape(hotelId)), token, &resp)
+	return resp.Bookings, err
+}
+
+// GetBookingsNeedingRooms gets a hotel's open bookings whose rooms have been
+// taken out of service, for staff.
+func (c *BookingsClient) GetBookingsNeedingRooms(ctx context.Context, token string, hotelId string) ([]*Booking, error) {
+	var resp BookingsResp
+	err := c.get(ctx, fmt.Sprintf("/bookings/needs-room/%s", url.PathEscape(hotelId)), token, &resp)
+	return resp.Bookings, err
+}
+
+func (c *BookingsClient) InviteGuest(ctx context.Context, token string, bookingId string, invite *GuestInvite) (*BookingGuest, error) {
+	var resp BookingGuestResp
+	err := c.send(ctx, "POST", fmt.Sprintf("/bookings/%s/guests", url.PathEscape(bookingId)), token, invite, &resp)
+	return resp.Guest, err
+}
+
+func (c *BookingsClient) RevokeGuest(ctx context.Context, token string, bookingId string, guestId string) (*BookingGuest, error) {
+	var resp BookingGuestResp
+	err := c.send(ctx, "POST", fmt.Sprintf("/bookings/%s/guests/%s/revoke", url.PathEscape(bookingId), url.PathEscape(guestId)), token, nil, &resp)
+	return resp.Guest, err
+}
+
+// AcceptGuestInvite links the invite an invite token is for to the user
+// redeeming it.
+func (c *BookingsClient) AcceptGuestInvite(ctx context.Context, token string, inviteToken string) (*BookingGuest, error) {
+	var resp BookingGuestResp
+	err := c.send(ctx, "POST", "/guests/accept", token, &GuestInviteAccept{Token: inviteToken}, &resp)
+	return resp.Guest, err
+}
+
+// SetBookingStatus moves one of the user's bookings on to another state. Staff
+// can change anyone's bookings.
+func (c *BookingsClient) SetBookingStatus(ctx context.Context, token string, bookingId string, status string) (*Booking, error) {
+	var resp BookingResp
+	err := c.send(ctx, "POST", fmt.Sprintf("/bookings/%s/status", url.PathEscape(bookingId)), token, &BookingStatusChange{Status: status}, &resp)
+	return resp.Booking, err
+}
+
+// AssignRoom puts a booking in a room, moving it out of any room it's already
+// in. Only staff can assign rooms.
+func (c *BookingsClient) AssignRoom(ctx context.Context, token string, bookingId string, roomId string) (*Booking, error) {
+	var resp BookingResp
+	err := c.send(ctx, "POST", fmt.Sprintf("/bookings/%s/room", url.PathEscape(bookingId)), token, &RoomChange{RoomID: roomId}, &resp)
+	return resp.Booking, err
+}
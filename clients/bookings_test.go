@@ -0,0 +1,40 @@
+package clients
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBookingAllowsAccess(t *testing.T) {
+	start := time.Date(2030, 1, 1, 14, 0, 0, 0, time.UTC)
+	booking := &Booking{
+		RoomID: "0x1",
+		Start:  start,
+		End:    start.Add(48 * time.Hour),
+	}
+	during := start.Add(time.Hour)
+
+	for status, allowed := range map[string]bool{
+		"":                true,
+		BookingConfirmed:  true,
+		BookingCheckedIn:  true,
+		BookingCheckedOut: false,
+		BookingCancelled:  false,
+		BookingNoShow:     false,
+	} {
+		booking.Status = status
+		if booking.AllowsAccess(during) != allowed {
+			t.Errorf("expected a %s booking to allow access: %v", status, allowed)
+		}
+	}
+
+	booking.Status = BookingCheckedIn
+	if booking.AllowsAccess(booking.End.Add(time.Minute)) {
+		t.Error("expected no access after the booking ends")
+	}
+
+	booking.RoomID = ""
+	if booking.AllowsAccess(during) {
+		t.Error("expected no access before a room is assigned")
+	}
+}
@@ -0,0 +1,70 @@
+package clients
+
+import (
+	"sync"
+	"time"
+)
+
+// Breaker stops calls to a service after Threshold failures in a row, so a
+// service that is down fails fast instead of tying up the caller. Once
+// Cooldown has passed a single trial call is let through, and a success
+// closes the breaker again.
+type Breaker struct {
+	Threshold int
+	Cooldown  time.Duration
+
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	trial     bool
+}
+
+func NewBreaker(threshold int, cooldown time.Duration) *Breaker {
+	return &Breaker{
+		Threshold: threshold,
+		Cooldown:  cooldown,
+	}
+}
+
+func (b *Breaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.failures < b.Threshold {
+		return true
+	}
+	if time.Now().Before(b.openUntil) || b.trial {
+		return false
+	}
+	b.trial = true
+	return true
+}
+
+func (b *Breaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures = 0
+	b.trial = false
+}
+
+// Release gives back a trial call that never got an answer from the
+// service, such as one the caller cancelled, so another can be let through
+// without counting it either way.
+func (b *Breaker) Release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.trial = false
+}
+
+func (b *Breaker) Failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	b.trial = false
+	if b.failures >= b.Threshold {
+		b.openUntil = time.Now().Add(b.Cooldown)
+	}
+}
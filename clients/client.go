@@ -0,0 +1,241 @@
+// Package clients holds typed HTTP clients for the backend services, along
+// with the request and response types the services share with their callers.
+package clients
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/fluidmediaproductions/central_hotel_door_server/utils"
+	"github.com/pkg/errors"
+)
+
+const (
+	DefaultTimeout          = time.Second * 10
+	DefaultRetries          = 2
+	DefaultRetryDelay       = time.Millisecond * 100
+	DefaultBreakerThreshold = 5
+	DefaultBreakerCooldown  = time.Second * 30
+)
+
+var ErrCircuitOpen = &Error{
+	StatusCode: http.StatusServiceUnavailable,
+	Code:       utils.CodeUpstreamUnavailable,
+	Message:    "service unavailable",
+}
+
+// Error is returned when a service responds with an error status or sets the
+// err field of its response, or can't be reached at all.
+type Error struct {
+	StatusCode int
+	Code       string
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Extensions lets the error's code show up in GraphQL errors.
+func (e *Error) Extensions() map[string]interface{} {
+	return map[string]interface{}{
+		"code": e.Code,
+	}
+}
+
+// ErrorCode returns the code for an error from a client, or an empty string
+// if it didn't come from a service.
+func ErrorCode(err error) string {
+	cause := errors.Cause(err)
+	if cause == context.DeadlineExceeded || cause == context.Canceled {
+		return utils.CodeUpstreamUnavailable
+	}
+	clientErr, isOk := cause.(*Error)
+	if isOk {
+		return clientErr.Code
+	}
+	return ""
+}
+
+// IsNotFound checks for a not found response from a service.
+func IsNotFound(err error) bool {
+	clientErr, isOk := errors.Cause(err).(*Error)
+	return isOk && clientErr.StatusCode == http.StatusNotFound
+}
+
+// IsRejected checks for a service turning a request away with a 4xx
+// response, rather than failing to answer it.
+func IsRejected(err error) bool {
+	clientErr, isOk := errors.Cause(err).(*Error)
+	return isOk && clientErr.StatusCode >= 400 && clientErr.StatusCode < 500
+}
+
+// Client makes JSON requests to one service. Only GETs are retried, as the
+// services' other endpoints aren't safe to repeat.
+type Client struct {
+	BaseURL    string
+	HTTPClient *http.Client
+	Retries    int
+	RetryDelay time.Duration
+	Breaker    *Breaker
+}
+
+func New(baseURL string) *Client {
+	return &Client{
+		BaseURL:    baseURL,
+		HTTPClient: &http.Client{Timeout: DefaultTimeout},
+		Retries:    DefaultRetries,
+		RetryDelay: DefaultRetryDelay,
+		Breaker:    NewBreaker(DefaultBreakerThreshold, DefaultBreakerCooldown),
+	}
+}
+
+type errResp struct {
+	Err  string `json:"err"`
+	Code string `json:"code"`
+}
+
+// encodeQuery turns query parameters into the end of a path.
+func encodeQuery(query url.Values) string {
+	if len(query) == 0 {
+		return ""
+	}
+	return "?" + query.Encode()
+}
+
+func (c *Client) get(ctx context.Context, path string, token string, out interface{}) error {
+	return c.do(ctx, "GET", path, token, nil, out, c.Retries)
+}
+
+func (c *Client) send(ctx context.Context, method string, path string, token string, body interface{}, out interface{}) error {
+	return c.do(ctx, method, path, token, body, out, 0)
+}
+
+func (c *Client) do(ctx context.Context, method string, path string, token string, body interface{}, out interface{}, retries int) error {
+	var bodyBytes []byte
+	if body != nil {
+		var err error
+		bodyBytes, err = json.Marshal(body)
+		if err != nil {
+			return err
+		}
+	}
+
+	delay := c.RetryDelay
+	for attempt := 0; ; attempt++ {
+		retry, err := c.attempt(ctx, method, path, token, bodyBytes, out)
+		if err == nil || !retry || attempt >= retries {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// attempt makes a single request, reporting whether it's worth retrying.
+func (c *Client) attempt(ctx context.Context, method string, path string, token string, body []byte, out interface{}) (bool, error) {
+	if c.Breaker != nil && !c.Breaker.Allow() {
+		return false, ErrCircuitOpen
+	}
+
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequest(method, c.BaseURL+path, reader)
+	if err != nil {
+		c.release()
+		return false, err
+	}
+	req = req.WithContext(ctx)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", token))
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		// The caller giving up says nothing about the service
+		if ctx.Err() != nil {
+			c.release()
+			return false, ctx.Err()
+		}
+		c.failure()
+		return true, &Error{
+			Code:    utils.CodeUpstreamUnavailable,
+			Message: err.Error(),
+		}
+	}
+	defer resp.Body.Close()
+
+	respBytes, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		if ctx.Err() != nil {
+			c.release()
+			return false, ctx.Err()
+		}
+		c.failure()
+		return true, err
+	}
+
+	if resp.StatusCode >= http.StatusInternalServerError {
+		c.failure()
+	} else if c.Breaker != nil {
+		c.Breaker.Success()
+	}
+
+	var respErr errResp
+	json.Unmarshal(respBytes, &respErr)
+	if resp.StatusCode >= http.StatusBadRequest || respErr.Err != "" {
+		message := respErr.Err
+		if message == "" {
+			message = http.StatusText(resp.StatusCode)
+		}
+		code := respErr.Code
+		if code == "" {
+			code = utils.StatusCode(resp.StatusCode)
+		}
+		if code == "" {
+			code = utils.CodeInternal
+		}
+		return resp.StatusCode >= http.StatusInternalServerError, &Error{
+			StatusCode: resp.StatusCode,
+			Code:       code,
+			Message:    message,
+		}
+	}
+
+	if out != nil {
+		err = json.Unmarshal(respBytes, out)
+		if err != nil {
+			return false, errors.Wrap(err, "invalid response")
+		}
+	}
+	return false, nil
+}
+
+func (c *Client) failure() {
+	if c.Breaker != nil {
+		c.Breaker.Failure()
+	}
+}
+
+func (c *Client) release() {
+	if c.Breaker != nil {
+		c.Breaker.Release()
+	}
+}
@@ -0,0 +1,254 @@
+package clients
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/fluidmediaproductions/central_hotel_door_server/utils"
+)
+
+func newTestClient(url string) *Client {
+	c := New(url)
+	c.RetryDelay = time.Millisecond
+	return c
+}
+
+func TestGetRetries(t *testing.T) {
+	var calls int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		json.NewEncoder(w).Encode(&RoomResp{
+			Room: &Room{ID: "0x1", Name: "101"},
+		})
+	}))
+	defer ts.Close()
+
+	c := &RoomsClient{newTestClient(ts.URL)}
+	room, err := c.GetRoom(context.Background(), "0x1")
+	if err != nil {
+		t.Fatalf("Error getting room: %v", err)
+	}
+	if room.Name != "101" {
+		t.Errorf("Expected room 101, got %v", room.Name)
+	}
+	if calls != 3 {
+		t.Errorf("Expected 3 calls, got %d", calls)
+	}
+}
+
+func TestPostNotRetried(t *testing.T) {
+	var calls int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(&JWTResp{
+			Err: "db down",
+		})
+	}))
+	defer ts.Close()
+
+	c := &AuthClient{newTestClient(ts.URL)}
+	_, err := c.Login(context.Background(), "bob@example.com", "pass")
+	if err == nil || err.Error() != "db down" {
+		t.Errorf("Expected db down error, got %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("Expected 1 call, got %d", calls)
+	}
+}
+
+func TestErrorResponse(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			t.Errorf("Missing auth header")
+		}
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(&BookingResp{
+			Err: "booking not found",
+		})
+	}))
+	defer ts.Close()
+
+	c := &BookingsClient{newTestClient(ts.URL)}
+	_, err := c.GetBooking(context.Background(), "token", "0x1")
+	if !IsNotFound(err) {
+		t.Errorf("Expected not found error, got %v", err)
+	}
+	if ErrorCode(err) != utils.CodeNotFound {
+		t.Errorf("Expected code %s, got %s", utils.CodeNotFound, ErrorCode(err))
+	}
+}
+
+func TestErrorResponseCode(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(&UserInfoResp{
+			Err:  "token is expired",
+			Code: utils.CodeUnauthenticated,
+		})
+	}))
+	defer ts.Close()
+
+	c := &AuthClient{newTestClient(ts.URL)}
+	_, err := c.UserInfo(context.Background(), "token")
+	if ErrorCode(err) != utils.CodeUnauthenticated {
+		t.Errorf("Expected code %s, got %s", utils.CodeUnauthenticated, ErrorCode(err))
+	}
+	if !IsRejected(err) {
+		t.Errorf("Expected a rejected request, got %v", err)
+	}
+}
+
+func TestBreakerOpens(t *testing.T) {
+	var calls int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer ts.Close()
+
+	c := &HotelsClient{newTestClient(ts.URL)}
+	c.Retries = 0
+	c.Breaker = NewBreaker(2, time.Millisecond*50)
+
+	for i := 0; i < 2; i++ {
+		_, _, err := c.GetHotels(context.Background(), nil)
+		if err == nil {
+			t.Fatalf("Expected an error from a failing server")
+		}
+	}
+	_, _, err := c.GetHotels(context.Background(), nil)
+	if err != ErrCircuitOpen {
+		t.Errorf("Expected the circuit to be open, got %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("Expected 2 calls, got %d", calls)
+	}
+
+	time.Sleep(time.Millisecond * 60)
+	_, _, err = c.GetHotels(context.Background(), nil)
+	if err == ErrCircuitOpen {
+		t.Errorf("Expected a trial call after the cooldown")
+	}
+	if calls != 3 {
+		t.Errorf("Expected 3 calls, got %d", calls)
+	}
+}
+
+func TestBreakerIgnoresCancelled(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(time.Millisecond * 100)
+	}))
+	defer ts.Close()
+
+	c := newTestClient(ts.URL)
+	c.Retries = 0
+	c.Breaker = NewBreaker(1, time.Minute)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+	defer cancel()
+	err := c.get(ctx, "/rooms", "", nil)
+	if err != context.DeadlineExceeded {
+		t.Errorf("Expected deadline exceeded, got %v", err)
+	}
+	if !c.Breaker.Allow() {
+		t.Error("Expected the caller's deadline not to open the circuit")
+	}
+}
+
+func TestBreakerTrialReleased(t *testing.T) {
+	var calls int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		time.Sleep(time.Millisecond * 100)
+	}))
+	defer ts.Close()
+
+	c := newTestClient(ts.URL)
+	c.Retries = 0
+	c.Breaker = NewBreaker(1, time.Millisecond*10)
+
+	err := c.get(context.Background(), "/rooms", "", nil)
+	if err == nil {
+		t.Fatal("Expected an error from a failing server")
+	}
+	time.Sleep(time.Millisecond * 20)
+
+	// Neither a request that can't be made nor one the caller cancels uses
+	// up the trial call
+	err = c.get(context.Background(), "/rooms/\x7f", "", nil)
+	if err == nil || err == ErrCircuitOpen {
+		t.Errorf("Expected an error making the request, got %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+	defer cancel()
+	err = c.get(ctx, "/rooms", "", nil)
+	if err != context.DeadlineExceeded {
+		t.Errorf("Expected deadline exceeded, got %v", err)
+	}
+	if !c.Breaker.Allow() {
+		t.Error("Expected another trial call to be let through")
+	}
+}
+
+func TestContextDeadline(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(time.Millisecond * 100)
+	}))
+	defer ts.Close()
+
+	c := &RoomsClient{newTestClient(ts.URL)}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+	defer cancel()
+
+	_, _, err := c.GetRooms(ctx, nil)
+	if err != context.DeadlineExceeded {
+		t.Errorf("Expected deadline exceeded, got %v", err)
+	}
+	if ErrorCode(err) != utils.CodeUpstreamUnavailable {
+		t.Errorf("Expected code %s, got %s", utils.CodeUpstreamUnavailable, ErrorCode(err))
+	}
+}
+
+func TestBookingFilter(t *testing.T) {
+	from := time.Date(2018, 6, 1, 0, 0, 0, 0, time.UTC)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if query.Get("first") != "10" || query.Get("from") != "2018-06-01T00:00:00Z" || query.Get("status") != BookingActive {
+			t.Errorf("Unexpected query %v", query)
+		}
+		after, err := utils.DecodeCursor(query.Get("after"))
+		if err != nil || after != "0x5" {
+			t.Errorf("Unexpected cursor %q", query.Get("after"))
+		}
+		json.NewEncoder(w).Encode(&BookingsResp{
+			Bookings: []*Booking{{ID: "0x6"}},
+			PageInfo: utils.NewPageInfo(true, "0x6"),
+		})
+	}))
+	defer ts.Close()
+
+	c := &BookingsClient{newTestClient(ts.URL)}
+	bookings, pageInfo, err := c.GetBookings(context.Background(), "", &BookingFilter{
+		Page:   utils.Page{First: 10, After: "0x5"},
+		From:   &from,
+		Status: BookingActive,
+	})
+	if err != nil {
+		t.Fatalf("Error getting bookings: %v", err)
+	}
+	if len(bookings) != 1 || pageInfo == nil || !pageInfo.HasNextPage {
+		t.Errorf("Unexpected page %v, %+v", bookings, pageInfo)
+	}
+}
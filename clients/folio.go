@@ -0,0 +1,131 @@
+package clients
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// Kinds of line on a folio.
+const (
+	FolioLineNight   = "night"
+	FolioLineExtra   = "extra"
+	FolioLinePayment = "payment"
+	FolioLineRefund  = "refund"
+)
+
+// Formats an invoice can be exported in.
+const (
+	InvoiceHTML = "html"
+	InvoicePDF  = "pdf"
+)
+
+// FolioLine is one charge, payment or refund on a folio. Amounts are in the
+// minor unit of the folio's currency, and payments and refunds are positive. Dates are on the
+// hotel's calendar.
+type FolioLine struct {
+	ID          string    `json:"uid,omitempty"`
+	Kind        string    `json:"kind"`
+	Date        string    `json:"date"`
+	Description string    `json:"description"`
+	Quantity    int       `json:"quantity"`
+	UnitAmount  int64     `json:"unitAmount"`
+	Amount      int64     `json:"amount"`
+	Method      string    `json:"method,omitempty"`
+	Reference   string    `json:"reference,omitempty"`
+	PostedAt    time.Time `json:"postedAt"`
+	PostedBy    string    `json:"postedBy,omitempty"`
+}
+
+// Folio is the itemised account of a booking. The nights and their taxes
+// are the price the booking was made at, extras are posted by staff and
+// already include any tax, and the balance is what's left to pay.
+type Folio struct {
+	BookingID    string       `json:"bookingId"`
+	HotelID      string       `json:"hotelId"`
+	HotelName    string       `json:"hotelName"`
+	HotelAddress string       `json:"hotelAddress"`
+	TimeZone     string       `json:"timeZone,omitempty"`
+	GuestName    string       `json:"guestName"`
+	GuestEmail   string       `json:"guestEmail"`
+	Start        time.Time    `json:"start"`
+	End          time.Time    `json:"end"`
+	Currency     string       `json:"currency"`
+	Charges      []*FolioLine `json:"charges"`
+	Taxes        []*QuoteTax  `json:"taxes"`
+	Payments     []*FolioLine `json:"payments"`
+	ChargeTotal  int64        `json:"chargeTotal"`
+	TaxTotal     int64        `json:"taxTotal"`
+	Total        int64        `json:"total"`
+	Paid         int64        `json:"paid"`
+	Balance      int64        `json:"balance"`
+	IssuedAt     time.Time    `json:"issuedAt"`
+}
+
+type FolioResp struct {
+	Err   string `json:"err"`
+	Code  string `json:"code,omitempty"`
+	Folio *Folio `json:"folio"`
+}
+
+// FolioExtra is a charge for something other than the room, like breakfast
+// or parking. The unit amount includes any tax.
+type FolioExtra struct {
+	Description string `json:"description"`
+	Quantity    int    `json:"quantity"`
+	UnitAmount  int64  `json:"unitAmount"`
+}
+
+// FolioPayment records money taken for a booking, like at the front desk.
+type FolioPayment struct {
+	Amount    int64  `json:"amount"`
+	Method    string `json:"method"`
+	Reference string `json:"reference,omitempty"`
+}
+
+// Invoice is a folio rendered as a document to download.
+type Invoice struct {
+	Format      string `json:"format"`
+	ContentType string `json:"contentType"`
+	FileName    string `json:"fileName"`
+	Data        []byte `json:"data"`
+}
+
+type InvoiceResp struct {
+	Err     string   `json:"err"`
+	Code    string   `json:"code,omitempty"`
+	Invoice *Invoice `json:"invoice"`
+}
+
+// GetFolio gets a booking's folio, for its owner or staff.
+func (c *BookingsClient) GetFolio(ctx context.Context, token string, bookingId string) (*Folio, error) {
+	var resp FolioResp
+	err := c.get(ctx, fmt.Sprintf("/bookings/%s/folio", url.PathEscape(bookingId)), token, &resp)
+	return resp.Folio, err
+}
+
+// GetInvoice renders a booking's folio as an invoice in one of the invoice
+// formats.
+func (c *BookingsClient) GetInvoice(ctx context.Context, token string, bookingId string, format string) (*Invoice, error) {
+	query := url.Values{}
+	query.Set("format", format)
+	var resp InvoiceResp
+	err := c.get(ctx, fmt.Sprintf("/bookings/%s/invoice", url.PathEscape(bookingId))+encodeQuery(query), token, &resp)
+	return resp.Invoice, err
+}
+
+// PostFolioExtra charges an extra to a booking. Only staff can post extras.
+func (c *BookingsClient) PostFolioExtra(ctx context.Context, token string, bookingId string, extra *FolioExtra) (*Folio, error) {
+	var resp FolioResp
+	err := c.send(ctx, "POST", fmt.Sprintf("/bookings/%s/folio/extras", url.PathEscape(bookingId)), token, extra, &resp)
+	return resp.Folio, err
+}
+
+// RecordFolioPayment records a payment against a booking. Only staff can
+// record payments.
+func (c *BookingsClient) RecordFolioPayment(ctx context.Context, token string, bookingId string, payment *FolioPayment) (*Folio, error) {
+	var resp FolioResp
+	err := c.send(ctx, "POST", fmt.Sprintf("/bookings/%s/folio/payments", url.PathEscape(bookingId)), token, payment, &resp)
+	return resp.Folio, err
+}
@@ -0,0 +1,112 @@
+package clients
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+type CredentialZone struct {
+	ZoneID  string   `json:"zoneId"`
+	DoorIDs []string `json:"doorIds"`
+	Days    []int    `json:"days"`
+	From    string   `json:"from"`
+	To      string   `json:"to"`
+}
+
+type CredentialRequest struct {
+	BookingID string            `json:"bookingId"`
+	HotelID   string            `json:"hotelId"`
+	RoomID    string            `json:"roomId"`
+	Zones     []*CredentialZone `json:"zones"`
+	NotBefore time.Time         `json:"notBefore"`
+	NotAfter  time.Time         `json:"notAfter"`
+}
+
+type CredentialResp struct {
+	Err          string    `json:"err"`
+	Code         string    `json:"code,omitempty"`
+	CredentialID string    `json:"credentialId"`
+	Credential   []byte    `json:"credential"`
+	NotBefore    time.Time `json:"notBefore"`
+	NotAfter     time.Time `json:"notAfter"`
+}
+
+type RevokeCredentialsResp struct {
+	Err     string `json:"err"`
+	Code    string `json:"code,omitempty"`
+	Revoked int    `json:"revoked"`
+}
+
+// BookingEvent tells a hotel's local systems something happened to a booking
+// outside of them. Kind is the state the booking moved to.
+type BookingEvent struct {
+	BookingID string    `json:"bookingId"`
+	RoomID    string    `json:"roomId"`
+	Kind      string    `json:"kind"`
+	Time      time.Time `json:"time"`
+}
+
+type BookingEventResp struct {
+	Err  string `json:"err"`
+	Code string `json:"code,omitempty"`
+	ID   string `json:"id"`
+}
+
+// HotelStatus is whether a hotel has a server online to carry out unlocks.
+type HotelStatus struct {
+	HotelID  string     `json:"hotelId"`
+	Online   bool       `json:"online"`
+	LastSeen *time.Time `json:"lastSeen"`
+}
+
+type HotelStatusResp struct {
+	Err    string       `json:"err"`
+	Code   string       `json:"code,omitempty"`
+	Status *HotelStatus `json:"status"`
+}
+
+// HotelGatewayClient calls the hotel gateway, which tracks the hotels'
+// servers and signs the offline credentials their controllers accept.
+type HotelGatewayClient struct {
+	*Client
+}
+
+func NewHotelGatewayClient(baseURL string) *HotelGatewayClient {
+	return &HotelGatewayClient{New(baseURL)}
+}
+
+func (c *HotelGatewayClient) GetHotelStatus(ctx context.Context, token string, hotelId string) (*HotelStatus, error) {
+	var resp HotelStatusResp
+	err := c.get(ctx, fmt.Sprintf("/hotels/%s/status", url.PathEscape(hotelId)), token, &resp)
+	return resp.Status, err
+}
+
+func (c *HotelGatewayClient) IssueCredential(ctx context.Context, token string, req *CredentialRequest) (*CredentialResp, error) {
+	var resp CredentialResp
+	err := c.send(ctx, "POST", "/credentials", token, req, &resp)
+	if err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *HotelGatewayClient) RevokeCredential(ctx context.Context, token string, id string) (int, error) {
+	var resp RevokeCredentialsResp
+	err := c.send(ctx, "POST", fmt.Sprintf("/credentials/%s/revoke", url.PathEscape(id)), token, nil, &resp)
+	return resp.Revoked, err
+}
+
+func (c *HotelGatewayClient) RevokeBookingCredentials(ctx context.Context, token string, bookingId string) (int, error) {
+	var resp RevokeCredentialsResp
+	err := c.send(ctx, "POST", fmt.Sprintf("/credentials/by-booking/%s/revoke", url.PathEscape(bookingId)), token, nil, &resp)
+	return resp.Revoked, err
+}
+
+// NotifyBooking queues a booking event for the hotel to pick up with its
+// actions.
+func (c *HotelGatewayClient) NotifyBooking(ctx context.Context, token string, hotelId string, event *BookingEvent) error {
+	var resp BookingEventResp
+	return c.send(ctx, "POST", fmt.Sprintf("/hotels/%s/booking-events", url.PathEscape(hotelId)), token, event, &resp)
+}
@@ -0,0 +1,364 @@
+package clients
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fluidmediaproductions/central_hotel_door_server/utils"
+)
+
+type Hotel struct {
+	ID             string          `json:"uid"`
+	Name           string          `json:"name"`
+	Address        string          `json:"address"`
+	Location       *utils.Location `json:"location"`
+	CheckIn        time.Time       `json:"checkIn"`
+	TimeZone       string          `json:"timeZone,omitempty"`
+	HasCarPark     bool            `json:"hasCarPark"`
+	ShouldDoorOpen bool            `json:"shouldDoorOpen"`
+	ArchivedAt     *time.Time      `json:"archivedAt,omitempty"`
+}
+
+// Zone is the hotel's time zone, which check-in and booking dates are read
+// in. Hotels without one are on UTC.
+func (h *Hotel) Zone() *time.Location {
+	if h == nil {
+		return time.UTC
+	}
+	return utils.LoadTimeZone(h.TimeZone)
+}
+
+// Local gives a time as the hotel's clocks show it.
+func (h *Hotel) Local(t time.Time) time.Time {
+	return t.In(h.Zone())
+}
+
+// CheckInOn is when check-in opens on the hotel's date for a time.
+func (h *Hotel) CheckInOn(t time.Time) time.Time {
+	return utils.ClockOn(h.Local(t), h.CheckIn)
+}
+
+// StaffShift lets a member of staff into a hotel's rooms and doors while it's
+// on. A shift that's ended early has its end moved to when it was ended.
+type StaffShift struct {
+	ID        string    `json:"uid"`
+	UserID    string    `json:"userId"`
+	HotelID   string    `json:"hotelId"`
+	Start     time.Time `json:"start"`
+	End       time.Time `json:"end"`
+	CreatedBy string    `json:"createdBy,omitempty"`
+}
+
+// Covers is whether the shift is on at a time.
+func (s *StaffShift) Covers(t time.Time) bool {
+	return !t.Before(s.Start) && t.Before(s.End)
+}
+
+// ShiftInput puts a member of staff on shift at a hotel.
+type ShiftInput struct {
+	UserID string    `json:"userId"`
+	Start  time.Time `json:"start"`
+	End    time.Time `json:"end"`
+}
+
+type ShiftResp struct {
+	Err   string      `json:"err"`
+	Code  string      `json:"code,omitempty"`
+	Shift *StaffShift `json:"shift"`
+}
+
+type ShiftsResp struct {
+	Err    string        `json:"err"`
+	Code   string        `json:"code,omitempty"`
+	Shifts []*StaffShift `json:"shifts"`
+}
+
+type HotelsResp struct {
+	Err      string          `json:"err"`
+	Code     string          `json:"code,omitempty"`
+	Hotels   []*Hotel        `json:"hotels"`
+	PageInfo *utils.PageInfo `json:"pageInfo,omitempty"`
+}
+
+// HotelInput creates or edits a hotel. When editing, only the fields that
+// are set are changed.
+type HotelInput struct {
+	Name       *string        `json:"name,omitempty"`
+	Address    *string        `json:"address,omitempty"`
+	Location   *HotelLocation `json:"location,omitempty"`
+	CheckIn    *time.Time     `json:"checkIn,omitempty"`
+	TimeZone   *string        `json:"timeZone,omitempty"`
+	HasCarPark *bool          `json:"hasCarPark,omitempty"`
+}
+
+// HotelFilter narrows down and pages through all hotels. Name matches hotels
+// with all of its words in their name.
+type HotelFilter struct {
+	utils.Page
+	Name string
+}
+
+func (f *HotelFilter) encode() string {
+	if f == nil {
+		return ""
+	}
+	query := url.Values{}
+	f.Page.Encode(query)
+	if f.Name != "" {
+		query.Set("name", f.Name)
+	}
+	return encodeQuery(query)
+}
+
+type HotelResp struct {
+	Err   string `json:"err"`
+	Code  string `json:"code,omitempty"`
+	Hotel *Hotel `json:"hotel"`
+}
+
+// NearbyHotel is a hotel found by a location search, with how far it is
+// from the point searched from.
+type NearbyHotel struct {
+	Hotel      *Hotel  `json:"hotel"`
+	DistanceKm float64 `json:"distanceKm"`
+}
+
+type NearbyHotelsResp struct {
+	Err    string         `json:"err"`
+	Code   string         `json:"code,omitempty"`
+	Hotels []*NearbyHotel `json:"hotels"`
+}
+
+// HotelLocation sets where a hotel is.
+type HotelLocation struct {
+	Lat float64 `json:"lat"`
+	Lng float64 `json:"lng"`
+}
+
+type OpenHotelResp struct {
+	Err     string `json:"err"`
+	Code    string `json:"code,omitempty"`
+	Success bool   `json:"success"`
+}
+
+type Door struct {
+	ID         string  `json:"uid"`
+	Name       string  `json:"name"`
+	HotelID    string  `json:"hotelId"`
+	ShouldOpen bool    `json:"shouldOpen"`
+	Zones      []*Zone `json:"zones"`
+}
+
+// Zone is a set of doors that bookings are let through by its grants.
+// DoorIDs is only filled in when a zone is fetched on its own.
+type Zone struct {
+	ID      string             `json:"uid"`
+	Name    string             `json:"name"`
+	Kind    string             `json:"kind"`
+	HotelID string             `json:"hotelId"`
+	Grants  []*utils.ZoneGrant `json:"grants"`
+	DoorIDs []string           `json:"doorIds,omitempty"`
+}
+
+// DoorInput creates or edits a door. When editing, only the fields that are
+// set are changed.
+type DoorInput struct {
+	Name *string `json:"name,omitempty"`
+}
+
+// ZoneInput creates or edits a zone. When editing, only the fields that are
+// set are changed. DoorIDs or Grants that are set, even to an empty list,
+// replace all of the zone's doors or grants. The doors have to be in the
+// zone's hotel.
+type ZoneInput struct {
+	Name    *string            `json:"name,omitempty"`
+	Kind    *string            `json:"kind,omitempty"`
+	DoorIDs []string           `json:"doorIds"`
+	Grants  []*utils.ZoneGrant `json:"grants"`
+}
+
+type DoorsResp struct {
+	Err   string  `json:"err"`
+	Code  string  `json:"code,omitempty"`
+	Doors []*Door `json:"doors"`
+}
+
+type DoorResp struct {
+	Err  string `json:"err"`
+	Code string `json:"code,omitempty"`
+	Door *Door  `json:"door"`
+}
+
+type ZonesResp struct {
+	Err   string  `json:"err"`
+	Code  string  `json:"code,omitempty"`
+	Zones []*Zone `json:"zones"`
+}
+
+type ZoneResp struct {
+	Err  string `json:"err"`
+	Code string `json:"code,omitempty"`
+	Zone *Zone  `json:"zone"`
+}
+
+type OpenDoorResp struct {
+	Err     string `json:"err"`
+	Code    string `json:"code,omitempty"`
+	Success bool   `json:"success"`
+}
+
+const (
+	EmergencyNormal   = "normal"
+	EmergencyRelease  = "release"
+	EmergencyLockdown = "lockdown"
+)
+
+type EmergencyState struct {
+	HotelID  string     `json:"hotelId"`
+	Mode     string     `json:"mode"`
+	Since    *time.Time `json:"since"`
+	ByUserID string     `json:"byUserId"`
+	Acked    bool       `json:"acked"`
+}
+
+type EmergencyStateResp struct {
+	Err   string          `json:"err"`
+	Code  string          `json:"code,omitempty"`
+	State *EmergencyState `json:"state"`
+}
+
+type EmergencyRequestResp struct {
+	Err         string    `json:"err"`
+	Code        string    `json:"code,omitempty"`
+	ConfirmCode string    `json:"confirmCode"`
+	Expires     time.Time `json:"expires"`
+}
+
+type HotelsClient struct {
+	*Client
+}
+
+func NewHotelsClient(baseURL string) *HotelsClient {
+	return &HotelsClient{New(baseURL)}
+}
+
+func (c *HotelsClient) GetHotels(ctx context.Context, filter *HotelFilter) ([]*Hotel, *utils.PageInfo, error) {
+	var resp HotelsResp
+	err := c.get(ctx, "/hotels"+filter.encode(), "", &resp)
+	return resp.Hotels, resp.PageInfo, err
+}
+
+func (c *HotelsClient) GetHotel(ctx context.Context, id string) (*Hotel, error) {
+	var resp HotelResp
+	err := c.get(ctx, fmt.Sprintf("/hotels/%s", url.PathEscape(id)), "", &resp)
+	return resp.Hotel, err
+}
+
+func (c *HotelsClient) GetHotelsBatch(ctx context.Context, ids []string) ([]*Hotel, error) {
+	var resp HotelsResp
+	query := url.Values{}
+	query.Set("ids", strings.Join(ids, ","))
+	err := c.get(ctx, "/hotels/batch?"+query.Encode(), "", &resp)
+	return resp.Hotels, err
+}
+
+// GetHotelsNear finds the hotels within radiusKm of a point, nearest first.
+func (c *HotelsClient) GetHotelsNear(ctx context.Context, lat float64, lng float64, radiusKm float64) ([]*NearbyHotel, error) {
+	var resp NearbyHotelsResp
+	query := url.Values{}
+	query.Set("lat", strconv.FormatFloat(lat, 'f', -1, 64))
+	query.Set("lng", strconv.FormatFloat(lng, 'f', -1, 64))
+	query.Set("radius", strconv.FormatFloat(radiusKm, 'f', -1, 64))
+	err := c.get(ctx, "/hotels/near?"+query.Encode(), "", &resp)
+	return resp.Hotels, err
+}
+
+func (c *HotelsClient) SetHotelLocation(ctx context.Context, token string, id string, location *HotelLocation) (*Hotel, error) {
+	var resp HotelResp
+	err := c.send(ctx, "PUT", fmt.Sprintf("/hotels/%s/location", url.PathEscape(id)), token, location, &resp)
+	return resp.Hotel, err
+}
+
+func (c *HotelsClient) OpenHotel(ctx context.Context, token string, id string) (bool, error) {
+	var resp OpenHotelResp
+	err := c.send(ctx, "GET", fmt.Sprintf("/hotels/%s/open", url.PathEscape(id)), token, nil, &resp)
+	return resp.Success, err
+}
+
+func (c *HotelsClient) GetZonesByHotel(ctx context.Context, hotelId string) ([]*Zone, error) {
+	var resp ZonesResp
+	err := c.get(ctx, fmt.Sprintf("/zones/by-hotel/%s", url.PathEscape(hotelId)), "", &resp)
+	return resp.Zones, err
+}
+
+func (c *HotelsClient) GetDoor(ctx context.Context, id string) (*Door, error) {
+	var resp DoorResp
+	err := c.get(ctx, fmt.Sprintf("/doors/%s", url.PathEscape(id)), "", &resp)
+	return resp.Door, err
+}
+
+func (c *HotelsClient) GetDoorsByHotel(ctx context.Context, hotelId string) ([]*Door, error) {
+	var resp DoorsResp
+	err := c.get(ctx, fmt.Sprintf("/doors/by-hotel/%s", url.PathEscape(hotelId)), "", &resp)
+	return resp.Doors, err
+}
+
+func (c *HotelsClient) OpenDoor(ctx context.Context, id string) (bool, error) {
+	var resp OpenDoorResp
+	err := c.send(ctx, "GET", fmt.Sprintf("/doors/%s/open", url.PathEscape(id)), "", nil, &resp)
+	return resp.Success, err
+}
+
+func (c *HotelsClient) OpenDoorSuccess(ctx context.Context, id string) (bool, error) {
+	var resp OpenDoorResp
+	err := c.get(ctx, fmt.Sprintf("/doors/%s/open-success", url.PathEscape(id)), "", &resp)
+	return resp.Success, err
+}
+
+func (c *HotelsClient) GetEmergencyState(ctx context.Context, token string, hotelId string) (*EmergencyState, error) {
+	var resp EmergencyStateResp
+	err := c.get(ctx, fmt.Sprintf("/hotels/%s/emergency", url.PathEscape(hotelId)), token, &resp)
+	return resp.State, err
+}
+
+func (c *HotelsClient) RequestEmergency(ctx context.Context, token string, hotelId string, mode string) (*EmergencyRequestResp, error) {
+	var resp EmergencyRequestResp
+	data := map[string]string{
+		"mode": mode,
+	}
+	err := c.send(ctx, "POST", fmt.Sprintf("/hotels/%s/emergency", url.PathEscape(hotelId)), token, data, &resp)
+	if err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *HotelsClient) ConfirmEmergency(ctx context.Context, token string, hotelId string, mode string, code string) (*EmergencyState, error) {
+	var resp EmergencyStateResp
+	data := map[string]string{
+		"mode": mode,
+		"code": code,
+	}
+	err := c.send(ctx, "POST", fmt.Sprintf("/hotels/%s/emergency/confirm", url.PathEscape(hotelId)), token, data, &resp)
+	return resp.State, err
+}
+
+func (c *HotelsClient) AckEmergency(ctx context.Context, hotelId string, actionId string) (*EmergencyState, error) {
+	var resp EmergencyStateResp
+	err := c.send(ctx, "POST", fmt.Sprintf("/hotels/%s/emergency/ack/%s", url.PathEscape(hotelId), url.PathEscape(actionId)), "", nil, &resp)
+	return resp.State, err
+}
+
+// GetUserShifts gets a user's shifts that are on at a time, for that user or
+// an admin.
+func (c *HotelsClient) GetUserShifts(ctx context.Context, token string, userId string, at time.Time) ([]*StaffShift, error) {
+	var resp ShiftsResp
+	query := url.Values{}
+	query.Set("at", at.Format(time.RFC3339))
+	err := c.get(ctx, fmt.Sprintf("/shifts/by-user/%s", url.PathEscape(userId))+encodeQuery(query), token, &resp)
+	return resp.Shifts, err
+}
@@ -0,0 +1,56 @@
+package clients
+
+// The kinds of data the bulk import service loads, and the formats it reads.
+const (
+	ImportHotels   = "hotels"
+	ImportRooms    = "rooms"
+	ImportBookings = "bookings"
+
+	ImportCSV  = "csv"
+	ImportJSON = "json"
+)
+
+// ImportFile is one file of an import. A CSV file has a header row naming
+// its columns, a JSON file is an array of objects with the same names.
+type ImportFile struct {
+	Kind   string `json:"kind"`
+	Format string `json:"format"`
+	Data   string `json:"data"`
+}
+
+// ImportRequest loads a set of files together, so rooms can refer to hotels
+// and bookings to rooms in the same import.
+type ImportRequest struct {
+	Files  []*ImportFile `json:"files"`
+	DryRun bool          `json:"dryRun"`
+}
+
+type ImportCounts struct {
+	Created int `json:"created"`
+	Updated int `json:"updated"`
+}
+
+// ImportError is a problem with one row of an import. Row counts from 1, and
+// from the header in a CSV file so it matches the line number.
+type ImportError struct {
+	Kind    string `json:"kind"`
+	Row     int    `json:"row,omitempty"`
+	Ref     string `json:"ref,omitempty"`
+	Message string `json:"message"`
+}
+
+// ImportReport says what an import did, or on a dry run what it would do.
+// Nothing is written if there are any errors.
+type ImportReport struct {
+	DryRun   bool           `json:"dryRun"`
+	Hotels   ImportCounts   `json:"hotels"`
+	Rooms    ImportCounts   `json:"rooms"`
+	Bookings ImportCounts   `json:"bookings"`
+	Errors   []*ImportError `json:"errors"`
+}
+
+type ImportResp struct {
+	Err    string        `json:"err"`
+	Code   string        `json:"code,omitempty"`
+	Report *ImportReport `json:"report"`
+}
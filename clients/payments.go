@@ -0,0 +1,45 @@
+package clients
+
+import (
+	"context"
+	"time"
+)
+
+// States a booking's payment can be in. Payments are only ever saved once
+// they've been captured, as a booking isn't made until it's paid for.
+const (
+	PaymentCaptured = "captured"
+	PaymentRefunded = "refunded"
+	PaymentFailed   = "failed"
+)
+
+// BookingPayment is the money taken for a booking made and paid for online.
+// The ref is the payment's ID with the provider.
+type BookingPayment struct {
+	ID         string     `json:"uid"`
+	Provider   string     `json:"provider"`
+	Ref        string     `json:"ref"`
+	Status     string     `json:"status"`
+	Amount     int64      `json:"amount"`
+	Currency   string     `json:"currency"`
+	CapturedAt *time.Time `json:"capturedAt,omitempty"`
+	RefundedAt *time.Time `json:"refundedAt,omitempty"`
+	FailedAt   *time.Time `json:"failedAt,omitempty"`
+}
+
+// BookingRequest books a room for the user in the token, paying its quoted
+// price with a payment method from the payment provider's checkout.
+type BookingRequest struct {
+	RoomID        string    `json:"roomId"`
+	Start         time.Time `json:"start"`
+	End           time.Time `json:"end"`
+	PaymentMethod string    `json:"paymentMethod"`
+}
+
+// CreateBooking books and pays for a room. The booking is only made if the
+// payment goes through.
+func (c *BookingsClient) CreateBooking(ctx context.Context, token string, request *BookingRequest) (*Booking, error) {
+	var resp BookingResp
+	err := c.send(ctx, "POST", "/bookings", token, request, &resp)
+	return resp.Booking, err
+}
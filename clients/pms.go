@@ -0,0 +1,54 @@
+package clients
+
+import "time"
+
+// The states a reservation from a PMS can be in.
+const (
+	ReservationBooked    = "booked"
+	ReservationCancelled = "cancelled"
+)
+
+// Reservation is a booking as a property management system (PMS) sends it.
+// The room is given by its name in the hotel, or by its uid. Reservations
+// without a room are for a room category, with the room assigned later.
+type Reservation struct {
+	ID         string    `json:"id"`
+	Room       string    `json:"room,omitempty"`
+	RoomID     string    `json:"roomId,omitempty"`
+	Category   string    `json:"category,omitempty"`
+	GuestEmail string    `json:"email"`
+	Start      time.Time `json:"start"`
+	End        time.Time `json:"end"`
+	Type       string    `json:"type,omitempty"`
+	Status     string    `json:"status,omitempty"`
+}
+
+// ReservationBatch is a set of reservations from one PMS for one hotel. A
+// full batch lists every reservation the PMS has that hasn't ended, so any
+// of the hotel's bookings from the PMS that it leaves out were cancelled.
+type ReservationBatch struct {
+	Source       string         `json:"source"`
+	HotelID      string         `json:"hotelId"`
+	Full         bool           `json:"full"`
+	Reservations []*Reservation `json:"reservations"`
+}
+
+type SyncError struct {
+	ID      string `json:"id"`
+	Message string `json:"message"`
+}
+
+// SyncReport says what syncing a batch of reservations changed.
+type SyncReport struct {
+	Created   int          `json:"created"`
+	Updated   int          `json:"updated"`
+	Unchanged int          `json:"unchanged"`
+	Cancelled int          `json:"cancelled"`
+	Errors    []*SyncError `json:"errors"`
+}
+
+type SyncResp struct {
+	Err    string      `json:"err"`
+	Code   string      `json:"code,omitempty"`
+	Report *SyncReport `json:"report"`
+}
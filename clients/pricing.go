@@ -0,0 +1,206 @@
+package clients
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/url"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DateLayout is how the dates of seasons and nights are written. They're
+// dates on the hotel's calendar, not points in time.
+const DateLayout = "2006-01-02"
+
+// RatePlan is what a night in a room type costs. Amounts are in the minor
+// unit of the currency, like pence. Seasons override the nightly rate, and
+// the minimum stay for stays starting in them. Taxes are a percentage of the
+// nightly charges added on top.
+type RatePlan struct {
+	ID         string        `json:"uid"`
+	RoomTypeID string        `json:"roomTypeId"`
+	Currency   string        `json:"currency"`
+	Nightly    int64         `json:"nightly"`
+	MinStay    int           `json:"minStay"`
+	Seasons    []*SeasonRate `json:"seasons"`
+	Taxes      []*Tax        `json:"taxes"`
+	CreatedAt  time.Time     `json:"createdAt"`
+	CreatedBy  string        `json:"createdBy,omitempty"`
+}
+
+// SeasonRate covers the nights from From up to and including To. A MinStay
+// of 0 keeps the plan's own.
+type SeasonRate struct {
+	Name    string `json:"name"`
+	From    string `json:"from"`
+	To      string `json:"to"`
+	Nightly int64  `json:"nightly"`
+	MinStay int    `json:"minStay,omitempty"`
+}
+
+// Covers is whether a night, as a date, is in the season.
+func (s *SeasonRate) Covers(date string) bool {
+	return s.From <= date && date <= s.To
+}
+
+type Tax struct {
+	Name    string  `json:"name"`
+	Percent float64 `json:"percent"`
+}
+
+// RatePlanInput replaces the rates of a room type.
+type RatePlanInput struct {
+	Currency string        `json:"currency"`
+	Nightly  int64         `json:"nightly"`
+	MinStay  int           `json:"minStay"`
+	Seasons  []*SeasonRate `json:"seasons"`
+	Taxes    []*Tax        `json:"taxes"`
+}
+
+type RatePlanResp struct {
+	Err      string    `json:"err"`
+	Code     string    `json:"code,omitempty"`
+	RatePlan *RatePlan `json:"ratePlan"`
+}
+
+// QuoteNight is the charge for one night of a stay.
+type QuoteNight struct {
+	Date   string `json:"date"`
+	Amount int64  `json:"amount"`
+	Season string `json:"season,omitempty"`
+}
+
+type QuoteTax struct {
+	Name    string  `json:"name"`
+	Percent float64 `json:"percent"`
+	Amount  int64   `json:"amount"`
+}
+
+// Quote is the price of a stay in a room type. Bookings keep the quote they
+// were made with, so changing the rates doesn't change what they cost.
+type Quote struct {
+	RoomTypeID string        `json:"roomTypeId"`
+	RatePlanID string        `json:"ratePlanId,omitempty"`
+	Currency   string        `json:"currency"`
+	Nights     []*QuoteNight `json:"nights"`
+	MinStay    int           `json:"minStay,omitempty"`
+	Subtotal   int64         `json:"subtotal"`
+	Taxes      []*QuoteTax   `json:"taxes"`
+	Total      int64         `json:"total"`
+	QuotedAt   time.Time     `json:"quotedAt"`
+}
+
+// MeetsMinStay is whether the stay is long enough to be booked.
+func (q *Quote) MeetsMinStay() bool {
+	return len(q.Nights) >= q.MinStay
+}
+
+type QuoteResp struct {
+	Err   string `json:"err"`
+	Code  string `json:"code,omitempty"`
+	Quote *Quote `json:"quote"`
+}
+
+// stayDates lists the nights of a stay as dates in a time zone, from the date
+// it starts up to the date it ends.
+func stayDates(start time.Time, end time.Time, loc *time.Location) []string {
+	start = start.In(loc)
+	end = end.In(loc)
+	day := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, time.UTC)
+	last := time.Date(end.Year(), end.Month(), end.Day(), 0, 0, 0, 0, time.UTC)
+
+	dates := make([]string, 0)
+	for ; day.Before(last); day = day.AddDate(0, 0, 1) {
+		dates = append(dates, day.Format(DateLayout))
+	}
+	return dates
+}
+
+// season is the season a night falls in, or nil if it's at the plan's own
+// rate.
+func (p *RatePlan) season(date string) *SeasonRate {
+	for _, season := range p.Seasons {
+		if season.Covers(date) {
+			return season
+		}
+	}
+	return nil
+}
+
+// Quote prices a stay, with its nights counted on the calendar of the
+// hotel's time zone. It doesn't turn away stays shorter than the minimum, as
+// a PMS may already have sold them, so callers taking bookings have to check
+// MeetsMinStay.
+func (p *RatePlan) Quote(start time.Time, end time.Time, loc *time.Location, now time.Time) (*Quote, error) {
+	dates := stayDates(start, end, loc)
+	if len(dates) == 0 {
+		return nil, errors.New("a stay has to be at least one night")
+	}
+
+	quote := &Quote{
+		RoomTypeID: p.RoomTypeID,
+		RatePlanID: p.ID,
+		Currency:   p.Currency,
+		Nights:     make([]*QuoteNight, 0, len(dates)),
+		MinStay:    p.MinStay,
+		Taxes:      make([]*QuoteTax, 0, len(p.Taxes)),
+		QuotedAt:   now,
+	}
+	if season := p.season(dates[0]); season != nil && season.MinStay > 0 {
+		quote.MinStay = season.MinStay
+	}
+	for _, date := range dates {
+		night := &QuoteNight{
+			Date:   date,
+			Amount: p.Nightly,
+		}
+		if season := p.season(date); season != nil {
+			night.Amount = season.Nightly
+			night.Season = season.Name
+		}
+		quote.Nights = append(quote.Nights, night)
+		quote.Subtotal += night.Amount
+	}
+
+	quote.Total = quote.Subtotal
+	for _, tax := range p.Taxes {
+		amount := int64(math.Round(float64(quote.Subtotal) * tax.Percent / 100))
+		quote.Taxes = append(quote.Taxes, &QuoteTax{
+			Name:    tax.Name,
+			Percent: tax.Percent,
+			Amount:  amount,
+		})
+		quote.Total += amount
+	}
+	return quote, nil
+}
+
+func (c *RoomsClient) GetRatePlan(ctx context.Context, roomTypeId string) (*RatePlan, error) {
+	var resp RatePlanResp
+	err := c.get(ctx, fmt.Sprintf("/room-types/%s/rates", url.PathEscape(roomTypeId)), "", &resp)
+	return resp.RatePlan, err
+}
+
+// SetRatePlan replaces a room type's rates. Bookings already made keep the
+// price they were quoted.
+func (c *RoomsClient) SetRatePlan(ctx context.Context, token string, roomTypeId string, input *RatePlanInput) (*RatePlan, error) {
+	var resp RatePlanResp
+	err := c.send(ctx, "PUT", fmt.Sprintf("/room-types/%s/rates", url.PathEscape(roomTypeId)), token, input, &resp)
+	return resp.RatePlan, err
+}
+
+// GetQuote prices a stay in a room type. A hotel can be given to make sure
+// the type is one of its own.
+func (c *RoomsClient) GetQuote(ctx context.Context, hotelId string, roomTypeId string, start time.Time, end time.Time) (*Quote, error) {
+	query := url.Values{}
+	if hotelId != "" {
+		query.Set("hotel", hotelId)
+	}
+	query.Set("start", start.Format(time.RFC3339))
+	query.Set("end", end.Format(time.RFC3339))
+	var resp QuoteResp
+	err := c.get(ctx, fmt.Sprintf("/room-types/%s/quote", url.PathEscape(roomTypeId))+encodeQuery(query), "", &resp)
+	return resp.Quote, err
+}
@@ -0,0 +1,72 @@
+package clients
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRatePlanQuote(t *testing.T) {
+	plan := &RatePlan{
+		ID:         "0x2",
+		RoomTypeID: "0x1",
+		Currency:   "GBP",
+		Nightly:    10000,
+		MinStay:    1,
+		Seasons: []*SeasonRate{
+			{Name: "New Year", From: "2030-12-30", To: "2031-01-01", Nightly: 25000, MinStay: 3},
+		},
+		Taxes: []*Tax{
+			{Name: "VAT", Percent: 20},
+			{Name: "City tax", Percent: 2.5},
+		},
+	}
+	now := time.Date(2030, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	quote, err := plan.Quote(time.Date(2030, 12, 29, 15, 0, 0, 0, time.UTC),
+		time.Date(2031, 1, 1, 11, 0, 0, 0, time.UTC), time.UTC, now)
+	if err != nil {
+		t.Fatalf("Error quoting: %v", err)
+	}
+	if len(quote.Nights) != 3 || quote.Nights[0].Amount != 10000 || quote.Nights[1].Season != "New Year" {
+		t.Errorf("Unexpected nights %+v", quote.Nights)
+	}
+	if quote.Subtotal != 60000 || quote.Total != 73500 || quote.Taxes[1].Amount != 1500 {
+		t.Errorf("Unexpected totals %+v", quote)
+	}
+	if quote.MinStay != 1 || !quote.MeetsMinStay() {
+		t.Errorf("Expected the plan's minimum stay, got %d", quote.MinStay)
+	}
+	if quote.RatePlanID != "0x2" || quote.Currency != "GBP" || !quote.QuotedAt.Equal(now) {
+		t.Errorf("Unexpected quote %+v", quote)
+	}
+
+	// Arriving in the season takes its minimum stay
+	quote, err = plan.Quote(time.Date(2030, 12, 31, 15, 0, 0, 0, time.UTC),
+		time.Date(2031, 1, 2, 11, 0, 0, 0, time.UTC), time.UTC, now)
+	if err != nil {
+		t.Fatalf("Error quoting: %v", err)
+	}
+	if quote.MinStay != 3 || quote.MeetsMinStay() {
+		t.Errorf("Expected a two night stay to be under the season's minimum of 3, got %d", quote.MinStay)
+	}
+
+	// 23:00 UTC is already the next day in Tokyo
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	quote, err = plan.Quote(time.Date(2030, 12, 29, 23, 0, 0, 0, time.UTC),
+		time.Date(2030, 12, 31, 1, 0, 0, 0, time.UTC), tokyo, now)
+	if err != nil {
+		t.Fatalf("Error quoting: %v", err)
+	}
+	if len(quote.Nights) != 1 || quote.Nights[0].Date != "2030-12-30" {
+		t.Errorf("Expected one night on the 30th in Tokyo, got %+v", quote.Nights)
+	}
+
+	_, err = plan.Quote(time.Date(2030, 12, 29, 9, 0, 0, 0, time.UTC),
+		time.Date(2030, 12, 29, 17, 0, 0, 0, time.UTC), time.UTC, now)
+	if err == nil {
+		t.Error("Expected an error for a stay with no nights")
+	}
+}
@@ -0,0 +1,338 @@
+package clients
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fluidmediaproductions/central_hotel_door_server/utils"
+)
+
+type Room struct {
+	ID         string     `json:"uid"`
+	Name       string     `json:"name"`
+	Floor      string     `json:"floor"`
+	HotelID    string     `json:"hotelId"`
+	Category   string     `json:"category"`
+	Type       *RoomType  `json:"type,omitempty"`
+	ShouldOpen bool       `json:"shouldOpen"`
+	ArchivedAt *time.Time `json:"archivedAt,omitempty"`
+	// Blocks are the room's current and upcoming maintenance blocks
+	Blocks         []*RoomBlock `json:"blocks,omitempty"`
+	Housekeeping   string       `json:"housekeeping"`
+	HousekeepingAt *time.Time   `json:"housekeepingAt,omitempty"`
+}
+
+// The housekeeping states of a room. Rooms go dirty when their guests check
+// out, and are clean again once housekeeping are done. Rooms that have never
+// been cleaned count as clean.
+const (
+	HousekeepingDirty      = "dirty"
+	HousekeepingInProgress = "in_progress"
+	HousekeepingClean      = "clean"
+	HousekeepingInspected  = "inspected"
+)
+
+// HousekeepingChange moves a room on to another housekeeping state.
+type HousekeepingChange struct {
+	Status string `json:"status"`
+}
+
+// BlockDuring returns the first of the room's blocks that overlaps a time
+// range, or nil if it's in service for all of it.
+func (r *Room) BlockDuring(start time.Time, end time.Time) *RoomBlock {
+	for _, block := range r.Blocks {
+		if block.Overlaps(start, end) {
+			return block
+		}
+	}
+	return nil
+}
+
+// BlockAt returns the block the room is out of service for at a time, or nil
+// if it's in service.
+func (r *Room) BlockAt(t time.Time) *RoomBlock {
+	for _, block := range r.Blocks {
+		if !t.Before(block.Start) && t.Before(block.End) {
+			return block
+		}
+	}
+	return nil
+}
+
+// RoomBlock takes a room out of service for maintenance. A block that's
+// ended early has its end moved to when it was ended.
+type RoomBlock struct {
+	ID        string    `json:"uid"`
+	RoomID    string    `json:"roomId"`
+	Start     time.Time `json:"start"`
+	End       time.Time `json:"end"`
+	Reason    string    `json:"reason"`
+	CreatedBy string    `json:"createdBy,omitempty"`
+}
+
+func (b *RoomBlock) Overlaps(start time.Time, end time.Time) bool {
+	return b.Start.Before(end) && b.End.After(start)
+}
+
+// RoomBlockInput asks for a room to be taken out of service.
+type RoomBlockInput struct {
+	Start  time.Time `json:"start"`
+	End    time.Time `json:"end"`
+	Reason string    `json:"reason"`
+}
+
+// RoomBlockResp has the block, and the bookings that were in the room while
+// it's out of service, which have been flagged as needing another room.
+type RoomBlockResp struct {
+	Err     string     `json:"err"`
+	Code    string     `json:"code,omitempty"`
+	Block   *RoomBlock `json:"block"`
+	Flagged []string   `json:"flagged,omitempty"`
+}
+
+type RoomBlocksResp struct {
+	Err    string       `json:"err"`
+	Code   string       `json:"code,omitempty"`
+	Blocks []*RoomBlock `json:"blocks"`
+}
+
+// RoomType describes what a hotel's rooms of one kind are like. Beds is the
+// bed configuration, such as "1 king" or "2 single".
+type RoomType struct {
+	ID            string   `json:"uid"`
+	HotelID       string   `json:"hotelId"`
+	Name          string   `json:"name"`
+	Capacity      int      `json:"capacity"`
+	Beds          string   `json:"beds"`
+	Amenities     []string `json:"amenities"`
+	Accessibility []string `json:"accessibility"`
+}
+
+type RoomTypeResp struct {
+	Err      string    `json:"err"`
+	Code     string    `json:"code,omitempty"`
+	RoomType *RoomType `json:"roomType"`
+}
+
+type RoomTypesResp struct {
+	Err       string      `json:"err"`
+	Code      string      `json:"code,omitempty"`
+	RoomTypes []*RoomType `json:"roomTypes"`
+}
+
+// RoomTypeInput creates or edits a room type. When editing, only the fields
+// that are set are changed, and lists replace the old ones.
+type RoomTypeInput struct {
+	HotelID       *string   `json:"hotelId,omitempty"`
+	Name          *string   `json:"name,omitempty"`
+	Capacity      *int      `json:"capacity,omitempty"`
+	Beds          *string   `json:"beds,omitempty"`
+	Amenities     *[]string `json:"amenities,omitempty"`
+	Accessibility *[]string `json:"accessibility,omitempty"`
+}
+
+type RoomsResp struct {
+	Err      string          `json:"err"`
+	Code     string          `json:"code,omitempty"`
+	Rooms    []*Room         `json:"rooms"`
+	PageInfo *utils.PageInfo `json:"pageInfo,omitempty"`
+}
+
+// RoomInput creates or edits a room. When editing, only the fields that are
+// set are changed.
+type RoomInput struct {
+	Name     *string `json:"name,omitempty"`
+	Floor    *string `json:"floor,omitempty"`
+	Category *string `json:"category,omitempty"`
+	HotelID  *string `json:"hotelId,omitempty"`
+	TypeID   *string `json:"typeId,omitempty"`
+}
+
+// RoomFilter narrows down and pages through all rooms. Capacity matches rooms
+// that sleep at least that many, and rooms have to have all of the amenities
+// and accessibility features asked for. From and To, which go together, match
+// rooms that are free to book for all of that time. Housekeeping matches rooms
+// in a housekeeping state.
+type RoomFilter struct {
+	utils.Page
+	Floor         string
+	Category      string
+	TypeID        string
+	Capacity      int
+	Amenities     []string
+	Accessibility []string
+	From          *time.Time
+	To            *time.Time
+	Housekeeping  string
+}
+
+func (f *RoomFilter) encode() string {
+	if f == nil {
+		return ""
+	}
+	query := url.Values{}
+	f.Page.Encode(query)
+	if f.Floor != "" {
+		query.Set("floor", f.Floor)
+	}
+	if f.Category != "" {
+		query.Set("category", f.Category)
+	}
+	if f.TypeID != "" {
+		query.Set("type", f.TypeID)
+	}
+	if f.Capacity > 0 {
+		query.Set("capacity", strconv.Itoa(f.Capacity))
+	}
+	for _, amenity := range f.Amenities {
+		query.Add("amenity", amenity)
+	}
+	for _, feature := range f.Accessibility {
+		query.Add("accessibility", feature)
+	}
+	if f.From != nil {
+		query.Set("from", f.From.Format(time.RFC3339))
+	}
+	if f.To != nil {
+		query.Set("to", f.To.Format(time.RFC3339))
+	}
+	if f.Housekeeping != "" {
+		query.Set("housekeeping", f.Housekeeping)
+	}
+	return encodeQuery(query)
+}
+
+type RoomResp struct {
+	Err  string `json:"err"`
+	Code string `json:"code,omitempty"`
+	Room *Room  `json:"room"`
+}
+
+type OpenRoomResp struct {
+	Err     string `json:"err"`
+	Code    string `json:"code,omitempty"`
+	Success bool   `json:"success"`
+}
+
+type OpenRoomSuccessResp struct {
+	Err     string `json:"err"`
+	Code    string `json:"code,omitempty"`
+	Success bool   `json:"success"`
+}
+
+type Unlock struct {
+	ID        string    `json:"uid"`
+	RoomID    string    `json:"roomId,omitempty"`
+	UserID    string    `json:"userId"`
+	BookingID string    `json:"bookingId"`
+	GuestID   string    `json:"guestId,omitempty"`
+	ShiftID   string    `json:"shiftId,omitempty"`
+	Time      time.Time `json:"time"`
+}
+
+type UnlocksResp struct {
+	Err     string    `json:"err"`
+	Code    string    `json:"code,omitempty"`
+	Unlocks []*Unlock `json:"unlocks"`
+}
+
+// OpenRoomParams records who a room is being opened for. Staff open rooms
+// with a shift rather than a booking.
+type OpenRoomParams struct {
+	UserID    string
+	BookingID string
+	GuestID   string
+	ShiftID   string
+}
+
+type RoomsClient struct {
+	*Client
+}
+
+func NewRoomsClient(baseURL string) *RoomsClient {
+	return &RoomsClient{New(baseURL)}
+}
+
+func (c *RoomsClient) GetRooms(ctx context.Context, filter *RoomFilter) ([]*Room, *utils.PageInfo, error) {
+	var resp RoomsResp
+	err := c.get(ctx, "/rooms"+filter.encode(), "", &resp)
+	return resp.Rooms, resp.PageInfo, err
+}
+
+func (c *RoomsClient) GetRoom(ctx context.Context, id string) (*Room, error) {
+	var resp RoomResp
+	err := c.get(ctx, fmt.Sprintf("/rooms/%s", url.PathEscape(id)), "", &resp)
+	return resp.Room, err
+}
+
+func (c *RoomsClient) GetRoomsBatch(ctx context.Context, ids []string) ([]*Room, error) {
+	var resp RoomsResp
+	query := url.Values{}
+	query.Set("ids", strings.Join(ids, ","))
+	err := c.get(ctx, "/rooms/batch?"+query.Encode(), "", &resp)
+	return resp.Rooms, err
+}
+
+func (c *RoomsClient) GetRoomsByHotel(ctx context.Context, hotelId string) ([]*Room, error) {
+	var resp RoomsResp
+	err := c.get(ctx, fmt.Sprintf("/rooms/by-hotel/%s", url.PathEscape(hotelId)), "", &resp)
+	return resp.Rooms, err
+}
+
+// GetRoomBlocks gets all of a room's maintenance blocks, including past
+// ones.
+func (c *RoomsClient) GetRoomBlocks(ctx context.Context, roomId string) ([]*RoomBlock, error) {
+	var resp RoomBlocksResp
+	err := c.get(ctx, fmt.Sprintf("/rooms/%s/blocks", url.PathEscape(roomId)), "", &resp)
+	return resp.Blocks, err
+}
+
+func (c *RoomsClient) GetRoomType(ctx context.Context, id string) (*RoomType, error) {
+	var resp RoomTypeResp
+	err := c.get(ctx, fmt.Sprintf("/room-types/%s", url.PathEscape(id)), "", &resp)
+	return resp.RoomType, err
+}
+
+func (c *RoomsClient) GetRoomTypesByHotel(ctx context.Context, hotelId string) ([]*RoomType, error) {
+	var resp RoomTypesResp
+	err := c.get(ctx, fmt.Sprintf("/room-types/by-hotel/%s", url.PathEscape(hotelId)), "", &resp)
+	return resp.RoomTypes, err
+}
+
+// OpenRoom isn't retried, as each call is recorded as an unlock.
+func (c *RoomsClient) OpenRoom(ctx context.Context, id string, params *OpenRoomParams) (bool, error) {
+	query := url.Values{}
+	if params != nil {
+		if params.UserID != "" {
+			query.Set("user", params.UserID)
+		}
+		if params.BookingID != "" {
+			query.Set("booking", params.BookingID)
+		}
+		if params.GuestID != "" {
+			query.Set("guest", params.GuestID)
+		}
+		if params.ShiftID != "" {
+			query.Set("shift", params.ShiftID)
+		}
+	}
+	var resp OpenRoomResp
+	err := c.send(ctx, "GET", fmt.Sprintf("/rooms/%s/open?%s", url.PathEscape(id), query.Encode()), "", nil, &resp)
+	return resp.Success, err
+}
+
+func (c *RoomsClient) OpenRoomSuccess(ctx context.Context, id string) (bool, error) {
+	var resp OpenRoomSuccessResp
+	err := c.get(ctx, fmt.Sprintf("/rooms/%s/open-success", url.PathEscape(id)), "", &resp)
+	return resp.Success, err
+}
+
+func (c *RoomsClient) GetRoomUnlocks(ctx context.Context, id string) ([]*Unlock, error) {
+	var resp UnlocksResp
+	err := c.get(ctx, fmt.Sprintf("/rooms/%s/unlocks", url.PathEscape(id)), "", &resp)
+	return resp.Unlocks, err
+}
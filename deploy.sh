@@ -6,6 +6,7 @@ cat auth/deployment.yaml | sed "s/(hash)/$HASH/g" | kubectl apply -f -
 cat bookings/deployment.yaml | sed "s/(hash)/$HASH/g" | kubectl apply -f -
 cat hotels/deployment.yaml | sed "s/(hash)/$HASH/g" | kubectl apply -f -
 cat rooms/deployment.yaml | sed "s/(hash)/$HASH/g" | kubectl apply -f -
+cat bulk_import/deployment.yaml | sed "s/(hash)/$HASH/g" | kubectl apply -f -
 cat gateway/deployment.yaml | sed "s/(hash)/$HASH/g" | kubectl apply -f -
 cat hotel_gateway/deployment.yaml | sed "s/(hash)/$HASH/g" | kubectl apply -f -
 cat hotel_mqtt_auth/deployment.yaml | sed "s/(hash)/$HASH/g" | kubectl apply -f -
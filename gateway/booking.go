@@ -1,91 +1,106 @@
 package main
 
 import (
-	"github.com/graphql-go/graphql"
 	"time"
-	"net/http"
-	"fmt"
+
+	"github.com/fluidmediaproductions/central_hotel_door_server/clients"
 	"github.com/fluidmediaproductions/central_hotel_door_server/utils"
-	"errors"
+	"github.com/graphql-go/graphql"
 )
+
+var bookingStatusType = graphql.NewEnum(graphql.EnumConfig{
+	Name: "BookingStatus",
+	Values: graphql.EnumValueConfigMap{
+		"UPCOMING": &graphql.EnumValueConfig{
+			Value: clients.BookingUpcoming,
+		},
+		"ACTIVE": &graphql.EnumValueConfig{
+			Value: clients.BookingActive,
+		},
+		"PAST": &graphql.EnumValueConfig{
+			Value: clients.BookingPast,
+		},
+	},
+})
+
+var bookingStateType = graphql.NewEnum(graphql.EnumConfig{
+	Name: "BookingState",
+	Values: graphql.EnumValueConfigMap{
+		"CONFIRMED": &graphql.EnumValueConfig{
+			Value: clients.BookingConfirmed,
+		},
+		"CHECKED_IN": &graphql.EnumValueConfig{
+			Value: clients.BookingCheckedIn,
+		},
+		"CHECKED_OUT": &graphql.EnumValueConfig{
+			Value: clients.BookingCheckedOut,
+		},
+		"CANCELLED": &graphql.EnumValueConfig{
+			Value: clients.BookingCancelled,
+		},
+		"NO_SHOW": &graphql.EnumValueConfig{
+			Value: clients.BookingNoShow,
+		},
+	},
+})
+
 var bookingType = graphql.NewObject(graphql.ObjectConfig{
 	Name: "Booking",
 	Fields: graphql.Fields{
 		"ID": &graphql.Field{
 			Type: graphql.String,
-			Resolve: func(params graphql.ResolveParams) (interface{}, error) {
-				booking, isOk := params.Source.(map[string]interface{})
-				if isOk {
-					id, isOk := booking["uid"].(string)
-					if isOk {
-						return id, nil
-					}
-				}
-				return nil, nil
-			},
 		},
 		"start": &graphql.Field{
 			Type: graphql.DateTime,
-			Resolve: func(params graphql.ResolveParams) (interface{}, error) {
-				booking, isOk := params.Source.(map[string]interface{})
-				if isOk {
-					start, isOk := booking["start"].(string)
-					if isOk {
-						time, err := time.Parse(time.RFC3339, start)
-						if err != nil {
-							return nil, err
-						}
-						return time, nil
-					}
-				}
-				return nil, nil
-			},
+			Resolve: utcTime(func(booking *clients.Booking) time.Time {
+				return booking.Start
+			}),
 		},
 		"end": &graphql.Field{
 			Type: graphql.DateTime,
-			Resolve: func(params graphql.ResolveParams) (interface{}, error) {
-				booking, isOk := params.Source.(map[string]interface{})
-				if isOk {
-					end, isOk := booking["end"].(string)
-					if isOk {
-						time, err := time.Parse(time.RFC3339, end)
-						if err != nil {
-							return nil, err
-						}
-						return time, nil
-					}
-				}
-				return nil, nil
-			},
+			Resolve: utcTime(func(booking *clients.Booking) time.Time {
+				return booking.End
+			}),
+		},
+		"localStart": &graphql.Field{
+			Type: graphql.DateTime,
+			Resolve: hotelTime(func(booking *clients.Booking) time.Time {
+				return booking.Start
+			}),
+		},
+		"localEnd": &graphql.Field{
+			Type: graphql.DateTime,
+			Resolve: hotelTime(func(booking *clients.Booking) time.Time {
+				return booking.End
+			}),
+		},
+		"category": &graphql.Field{
+			Type: graphql.String,
+		},
+		"price": &graphql.Field{
+			Type: quoteType,
+		},
+		"payment": &graphql.Field{
+			Type: bookingPaymentType,
+		},
+		"status": &graphql.Field{
+			Type: bookingStateType,
+		},
+		"checkedInAt": &graphql.Field{
+			Type: graphql.DateTime,
+		},
+		"checkedOutAt": &graphql.Field{
+			Type: graphql.DateTime,
+		},
+		"cancelledAt": &graphql.Field{
+			Type: graphql.DateTime,
 		},
 		"hotel": &graphql.Field{
 			Type: hotelType,
 			Resolve: func(params graphql.ResolveParams) (interface{}, error) {
-				booking, isOk := params.Source.(map[string]interface{})
+				booking, isOk := params.Source.(*clients.Booking)
 				if isOk {
-					hotelId, isOk := booking["hotelId"].(string)
-					if isOk {
-						req, err := http.NewRequest("GET", HotelsServer+fmt.Sprintf("/hotels/%s", hotelId), nil)
-						if err != nil {
-							return nil, err
-						}
-
-						resp, err := utils.GetJson(req)
-						if err != nil {
-							return nil, err
-						}
-						respErr, isOk := resp["err"].(string)
-						if isOk {
-							if respErr != "" {
-								return nil, errors.New(respErr)
-							}
-						}
-
-						hotel, isOk := resp["hotel"].(map[string]interface{})
-						if isOk {
-							return hotel, nil
-						}
-					}
+					return getLoaders(params.Context).hotels.Load(booking.HotelID), nil
 				}
 				return nil, nil
 			},
@@ -93,34 +108,80 @@ var bookingType = graphql.NewObject(graphql.ObjectConfig{
 		"room": &graphql.Field{
 			Type: roomType,
 			Resolve: func(params graphql.ResolveParams) (interface{}, error) {
-				booking, isOk := params.Source.(map[string]interface{})
-				if isOk {
-					roomId, isOk := booking["roomId"].(string)
-					if isOk {
-						req, err := http.NewRequest("GET", RoomsServer+fmt.Sprintf("/rooms/%s", roomId), nil)
-						if err != nil {
-							return nil, err
-						}
-
-						resp, err := utils.GetJson(req)
-						if err != nil {
-							return nil, err
-						}
-						respErr, isOk := resp["err"].(string)
-						if isOk {
-							if respErr != "" {
-								return nil, errors.New(respErr)
-							}
-						}
-
-						room, isOk := resp["room"].(map[string]interface{})
-						if isOk {
-							return room, nil
-						}
-					}
+				booking, isOk := params.Source.(*clients.Booking)
+				if isOk && booking.RoomID != "" {
+					return getLoaders(params.Context).rooms.Load(booking.RoomID), nil
 				}
 				return nil, nil
 			},
 		},
+		"guests": &graphql.Field{
+			Type: graphql.NewList(bookingGuestType),
+			Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+				booking, isOk := params.Source.(*clients.Booking)
+				if isOk && booking.Guests != nil {
+					return booking.Guests, nil
+				}
+				return []*clients.BookingGuest{}, nil
+			},
+		},
 	},
 })
+
+// utcTime resolves one of a booking's times in UTC.
+func utcTime(get func(booking *clients.Booking) time.Time) graphql.FieldResolveFn {
+	return func(params graphql.ResolveParams) (interface{}, error) {
+		booking, isOk := params.Source.(*clients.Booking)
+		if isOk {
+			return get(booking).UTC(), nil
+		}
+		return nil, nil
+	}
+}
+
+// hotelTime resolves one of a booking's times as the hotel's clocks show it,
+// with the hotel's UTC offset.
+func hotelTime(get func(booking *clients.Booking) time.Time) graphql.FieldResolveFn {
+	return func(params graphql.ResolveParams) (interface{}, error) {
+		booking, isOk := params.Source.(*clients.Booking)
+		if !isOk {
+			return nil, nil
+		}
+		load := getLoaders(params.Context).hotels.Load(booking.HotelID)
+		return func() (interface{}, error) {
+			value, err := load()
+			if err != nil {
+				return nil, err
+			}
+			hotel, _ := value.(*clients.Hotel)
+			return hotel.Local(get(booking)), nil
+		}, nil
+	}
+}
+
+// bookingStatusMutation makes a mutation moving one of the user's bookings on
+// to another state.
+func bookingStatusMutation(status string) *graphql.Field {
+	return &graphql.Field{
+		Type: bookingType,
+		Args: graphql.FieldConfigArgument{
+			"bookingId": &graphql.ArgumentConfig{
+				Type: graphql.NewNonNull(graphql.String),
+			},
+		},
+		Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+			id, isOK := params.Args["bookingId"].(string)
+			if isOK {
+				user, isOk := params.Source.(*utils.User)
+				if isOk {
+					jwt, err := userToken(user)
+					if err != nil {
+						return nil, err
+					}
+					return bookingsClient.SetBookingStatus(requestContext(params), jwt, id, status)
+				}
+			}
+			return nil, nil
+		},
+	}
+}
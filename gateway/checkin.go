@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/fluidmediaproductions/central_hotel_door_server/clients"
+	"github.com/fluidmediaproductions/central_hotel_door_server/utils"
+	"github.com/graphql-go/graphql"
+)
+
+// checkInOpens is when a guest can check in themselves, which is the hotel's
+// check-in time on the first day of the booking in the hotel's time zone, or
+// the start of the booking if that's later. Hotels without a check-in time let
+// guests in from the start of the booking.
+func checkInOpens(booking *clients.Booking, hotel *clients.Hotel) time.Time {
+	if hotel == nil || hotel.CheckIn.IsZero() {
+		return booking.Start
+	}
+	opens := hotel.CheckInOn(booking.Start)
+	if opens.Before(booking.Start) {
+		return booking.Start
+	}
+	return opens
+}
+
+// roomAccessFrom is when a booking's room can be opened. Guests that have
+// already checked in aren't held to the check-in time.
+func roomAccessFrom(booking *clients.Booking, hotel *clients.Hotel) time.Time {
+	if booking.Status == clients.BookingCheckedIn {
+		return booking.Start
+	}
+	return checkInOpens(booking, hotel)
+}
+
+// getOwnBooking gets a booking the user made, as guests invited onto a
+// booking can't check it in or out.
+func getOwnBooking(ctx context.Context, user *utils.User, bookingId string) (*clients.Booking, error) {
+	booking, err := getUserBooking(ctx, user, bookingId)
+	if err != nil {
+		return nil, err
+	}
+	if booking.GuestID != "" || booking.UserID != user.ID {
+		return nil, newCodedError(utils.CodeForbidden, "only the booker can do this")
+	}
+	return booking, nil
+}
+
+// notifyHotel tells the hotel's own systems about a check-in or check-out.
+// The booking has already changed by then, so a failure is only logged.
+func notifyHotel(ctx context.Context, booking *clients.Booking, kind string, now time.Time) {
+	token, err := serviceToken()
+	if err != nil {
+		log.Printf("Error signing service token: %v\n", err)
+		return
+	}
+	err = hotelGatewayClient.NotifyBooking(ctx, token, booking.HotelID, &clients.BookingEvent{
+		BookingID: booking.ID,
+		RoomID:    booking.RoomID,
+		Kind:      kind,
+		Time:      now,
+	})
+	if err != nil {
+		log.Printf("Error notifying hotel %s of booking %s: %v\n", booking.HotelID, booking.ID, err)
+	}
+}
+
+func checkInBooking(ctx context.Context, user *utils.User, bookingId string) (*clients.Booking, error) {
+	booking, err := getOwnBooking(ctx, user, bookingId)
+	if err != nil {
+		return nil, err
+	}
+	hotel, err := hotelsClient.GetHotel(ctx, booking.HotelID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if now.Before(checkInOpens(booking, hotel)) {
+		return nil, newCodedError(utils.CodeBookingNotActive, "check-in hasn't opened yet")
+	}
+	if now.After(booking.End) {
+		return nil, newCodedError(utils.CodeBookingNotActive, "booking has ended")
+	}
+
+	jwt, err := userToken(user)
+	if err != nil {
+		return nil, err
+	}
+	booking, err = bookingsClient.SetBookingStatus(ctx, jwt, bookingId, clients.BookingCheckedIn)
+	if err != nil {
+		return nil, err
+	}
+	notifyHotel(ctx, booking, clients.BookingCheckedIn, now)
+	return booking, nil
+}
+
+// checkOutBooking checks a guest out. The bookings service takes away the
+// booking's door access once it's checked out.
+func checkOutBooking(ctx context.Context, user *utils.User, bookingId string) (*clients.Booking, error) {
+	_, err := getOwnBooking(ctx, user, bookingId)
+	if err != nil {
+		return nil, err
+	}
+
+	jwt, err := userToken(user)
+	if err != nil {
+		return nil, err
+	}
+	booking, err := bookingsClient.SetBookingStatus(ctx, jwt, bookingId, clients.BookingCheckedOut)
+	if err != nil {
+		return nil, err
+	}
+	notifyHotel(ctx, booking, clients.BookingCheckedOut, time.Now())
+	return booking, nil
+}
+
+func selfServiceMutation(change func(context.Context, *utils.User, string) (*clients.Booking, error)) *graphql.Field {
+	return &graphql.Field{
+		Type: bookingType,
+		Args: graphql.FieldConfigArgument{
+			"bookingId": &graphql.ArgumentConfig{
+				Type: graphql.NewNonNull(graphql.String),
+			},
+		},
+		Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+			id, isOK := params.Args["bookingId"].(string)
+			if isOK {
+				user, isOk := params.Source.(*utils.User)
+				if isOk {
+					return change(requestContext(params), user, id)
+				}
+			}
+			return nil, nil
+		},
+	}
+}
+
+var checkInMutation = selfServiceMutation(checkInBooking)
+var checkOutMutation = selfServiceMutation(checkOutBooking)
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fluidmediaproductions/central_hotel_door_server/clients"
+)
+
+func TestCheckInOpens(t *testing.T) {
+	start := time.Date(2030, 1, 1, 10, 0, 0, 0, time.UTC)
+	booking := &clients.Booking{
+		Start: start,
+		End:   start.Add(48 * time.Hour),
+	}
+
+	tests := []struct {
+		hotel  *clients.Hotel
+		status string
+		opens  time.Time
+		access time.Time
+	}{
+		{nil, "", start, start},
+		{&clients.Hotel{}, "", start, start},
+		{&clients.Hotel{CheckIn: time.Date(0, 1, 1, 15, 0, 0, 0, time.UTC)}, "",
+			time.Date(2030, 1, 1, 15, 0, 0, 0, time.UTC), time.Date(2030, 1, 1, 15, 0, 0, 0, time.UTC)},
+		{&clients.Hotel{CheckIn: time.Date(0, 1, 1, 8, 0, 0, 0, time.UTC)}, "", start, start},
+		{&clients.Hotel{CheckIn: time.Date(0, 1, 1, 15, 0, 0, 0, time.UTC)}, clients.BookingCheckedIn,
+			time.Date(2030, 1, 1, 15, 0, 0, 0, time.UTC), start},
+		// 15:00 in New York is 20:00 UTC
+		{&clients.Hotel{CheckIn: time.Date(0, 1, 1, 15, 0, 0, 0, time.UTC), TimeZone: "America/New_York"}, "",
+			time.Date(2030, 1, 1, 20, 0, 0, 0, time.UTC), time.Date(2030, 1, 1, 20, 0, 0, 0, time.UTC)},
+		// 11:00 in Tokyo is 02:00 UTC, before the booking starts
+		{&clients.Hotel{CheckIn: time.Date(0, 1, 1, 11, 0, 0, 0, time.UTC), TimeZone: "Asia/Tokyo"}, "", start, start},
+		// 10:00 UTC is already 19:00 in Tokyo, so 20:00 is 11:00 UTC
+		{&clients.Hotel{CheckIn: time.Date(0, 1, 1, 20, 0, 0, 0, time.UTC), TimeZone: "Asia/Tokyo"}, "",
+			time.Date(2030, 1, 1, 11, 0, 0, 0, time.UTC), time.Date(2030, 1, 1, 11, 0, 0, 0, time.UTC)},
+	}
+
+	for i, test := range tests {
+		booking.Status = test.status
+		if opens := checkInOpens(booking, test.hotel); !opens.Equal(test.opens) {
+			t.Errorf("%d: expected check-in to open at %v, got %v", i, test.opens, opens)
+		}
+		if access := roomAccessFrom(booking, test.hotel); !access.Equal(test.access) {
+			t.Errorf("%d: expected room access from %v, got %v", i, test.access, access)
+		}
+	}
+}
+
+func TestKeyExpiry(t *testing.T) {
+	now := time.Date(2030, 1, 1, 12, 0, 0, 0, time.UTC)
+	booking := &clients.Booking{
+		Start: now.Add(-2 * time.Hour),
+		End:   now.Add(48 * time.Hour),
+	}
+	later := &clients.RoomBlock{
+		Start: now.Add(24 * time.Hour),
+		End:   now.Add(72 * time.Hour),
+	}
+	after := &clients.RoomBlock{
+		Start: now.Add(96 * time.Hour),
+		End:   now.Add(120 * time.Hour),
+	}
+
+	expiry, err := keyExpiry(booking, &clients.Room{}, now)
+	if err != nil || !expiry.Equal(booking.End) {
+		t.Errorf("expected keys to last the booking, got %v %v", expiry, err)
+	}
+	expiry, err = keyExpiry(booking, &clients.Room{Blocks: []*clients.RoomBlock{after}}, now)
+	if err != nil || !expiry.Equal(booking.End) {
+		t.Errorf("expected a block after the booking to be ignored, got %v %v", expiry, err)
+	}
+	expiry, err = keyExpiry(booking, &clients.Room{Blocks: []*clients.RoomBlock{later, after}}, now)
+	if err != nil || !expiry.Equal(later.Start) {
+		t.Errorf("expected keys to stop at the block, got %v %v", expiry, err)
+	}
+	_, err = keyExpiry(booking, &clients.Room{Blocks: []*clients.RoomBlock{later}}, later.Start)
+	if err == nil {
+		t.Error("expected no key while the room is out of service")
+	}
+}
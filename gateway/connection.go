@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/fluidmediaproductions/central_hotel_door_server/utils"
+	"github.com/graphql-go/graphql"
+)
+
+// connection is a Relay style page of a list. The services return items in
+// uid order, so an item's cursor is made from its uid.
+type connection struct {
+	Edges    []*edge   `json:"edges"`
+	PageInfo *pageInfo `json:"pageInfo"`
+}
+
+type edge struct {
+	Cursor string      `json:"cursor"`
+	Node   interface{} `json:"node"`
+}
+
+type pageInfo struct {
+	HasNextPage     bool    `json:"hasNextPage"`
+	HasPreviousPage bool    `json:"hasPreviousPage"`
+	StartCursor     *string `json:"startCursor"`
+	EndCursor       *string `json:"endCursor"`
+}
+
+var pageInfoType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "PageInfo",
+	Fields: graphql.Fields{
+		"hasNextPage": &graphql.Field{
+			Type: graphql.NewNonNull(graphql.Boolean),
+		},
+		"hasPreviousPage": &graphql.Field{
+			Type: graphql.NewNonNull(graphql.Boolean),
+		},
+		"startCursor": &graphql.Field{
+			Type: graphql.String,
+		},
+		"endCursor": &graphql.Field{
+			Type: graphql.String,
+		},
+	},
+})
+
+// connectionType makes the connection and edge types for a node type.
+func connectionType(node *graphql.Object) *graphql.Object {
+	edgeType := graphql.NewObject(graphql.ObjectConfig{
+		Name: node.Name() + "Edge",
+		Fields: graphql.Fields{
+			"cursor": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.String),
+			},
+			"node": &graphql.Field{
+				Type: node,
+			},
+		},
+	})
+	return graphql.NewObject(graphql.ObjectConfig{
+		Name: node.Name() + "Connection",
+		Fields: graphql.Fields{
+			"edges": &graphql.Field{
+				Type: graphql.NewList(edgeType),
+			},
+			"pageInfo": &graphql.Field{
+				Type: graphql.NewNonNull(pageInfoType),
+			},
+		},
+	})
+}
+
+// connectionArgs adds the pagination arguments to a field's own.
+func connectionArgs(args graphql.FieldConfigArgument) graphql.FieldConfigArgument {
+	args["first"] = &graphql.ArgumentConfig{
+		Type:         graphql.Int,
+		DefaultValue: utils.DefaultPageSize,
+	}
+	args["after"] = &graphql.ArgumentConfig{
+		Type: graphql.String,
+	}
+	return args
+}
+
+// pageArgs reads the pagination arguments of a connection field.
+func pageArgs(params graphql.ResolveParams) (utils.Page, error) {
+	page := utils.Page{
+		First: utils.DefaultPageSize,
+	}
+	if first, isOk := params.Args["first"].(int); isOk {
+		if first < 1 || first > utils.MaxPageSize {
+			return page, newCodedError(utils.CodeBadRequest,
+				fmt.Sprintf("first must be between 1 and %d", utils.MaxPageSize))
+		}
+		page.First = first
+	}
+	if after, isOk := params.Args["after"].(string); isOk && after != "" {
+		uid, err := utils.DecodeCursor(after)
+		if err != nil {
+			return page, newCodedError(utils.CodeBadRequest, err.Error())
+		}
+		page.After = uid
+	}
+	return page, nil
+}
+
+// newConnection wraps a page of count items from a service. node returns
+// the uid and value of each item.
+func newConnection(count int, node func(i int) (string, interface{}), page utils.Page, info *utils.PageInfo) *connection {
+	conn := &connection{
+		Edges: make([]*edge, 0, count),
+		PageInfo: &pageInfo{
+			HasPreviousPage: page.After != "",
+		},
+	}
+	if info != nil {
+		conn.PageInfo.HasNextPage = info.HasNextPage
+	}
+	for i := 0; i < count; i++ {
+		id, value := node(i)
+		conn.Edges = append(conn.Edges, &edge{
+			Cursor: utils.EncodeCursor(id),
+			Node:   value,
+		})
+	}
+	if count > 0 {
+		conn.PageInfo.StartCursor = &conn.Edges[0].Cursor
+		conn.PageInfo.EndCursor = &conn.Edges[count-1].Cursor
+	}
+	return conn
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/fluidmediaproductions/central_hotel_door_server/clients"
+	"github.com/fluidmediaproductions/central_hotel_door_server/utils"
+	"github.com/graphql-go/graphql"
+)
+
+func TestNewConnection(t *testing.T) {
+	rooms := []*clients.Room{{ID: "0x1"}, {ID: "0x2"}}
+	page := utils.Page{First: 2, After: "0x0"}
+	conn := newConnection(len(rooms), func(i int) (string, interface{}) {
+		return rooms[i].ID, rooms[i]
+	}, page, utils.NewPageInfo(true, "0x2"))
+
+	if len(conn.Edges) != 2 || conn.Edges[1].Node != rooms[1] {
+		t.Fatalf("Unexpected edges %v", conn.Edges)
+	}
+	if !conn.PageInfo.HasNextPage || !conn.PageInfo.HasPreviousPage {
+		t.Errorf("Unexpected page info %+v", conn.PageInfo)
+	}
+	uid, err := utils.DecodeCursor(*conn.PageInfo.EndCursor)
+	if err != nil || uid != "0x2" {
+		t.Errorf("End cursor was for %q, %v", uid, err)
+	}
+
+	conn = newConnection(0, nil, utils.Page{First: 2}, nil)
+	if conn.PageInfo.StartCursor != nil || conn.PageInfo.EndCursor != nil || conn.PageInfo.HasPreviousPage {
+		t.Errorf("Unexpected page info for an empty page %+v", conn.PageInfo)
+	}
+}
+
+func TestPageArgs(t *testing.T) {
+	page, err := pageArgs(graphql.ResolveParams{
+		Args: map[string]interface{}{
+			"first": 5,
+			"after": utils.EncodeCursor("0x10"),
+		},
+	})
+	if err != nil || page.First != 5 || page.After != "0x10" {
+		t.Errorf("Page args were %+v, %v", page, err)
+	}
+
+	_, err = pageArgs(graphql.ResolveParams{
+		Args: map[string]interface{}{
+			"first": utils.MaxPageSize + 1,
+		},
+	})
+	if err == nil {
+		t.Errorf("Page over the limit was accepted")
+	}
+
+	_, err = pageArgs(graphql.ResolveParams{
+		Args: map[string]interface{}{
+			"after": "0x10",
+		},
+	})
+	if err == nil {
+		t.Errorf("Invalid cursor was accepted")
+	}
+}
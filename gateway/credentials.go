@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"time"
+
+	"github.com/fluidmediaproductions/central_hotel_door_server/clients"
+	"github.com/fluidmediaproductions/central_hotel_door_server/utils"
+	"github.com/graphql-go/graphql"
+)
+
+var digitalKeyType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "DigitalKey",
+	Fields: graphql.Fields{
+		"credentialId": &graphql.Field{
+			Type: graphql.NewNonNull(graphql.String),
+		},
+		"credential": &graphql.Field{
+			Type: graphql.NewNonNull(graphql.String),
+			Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+				key, isOk := params.Source.(*clients.CredentialResp)
+				if isOk {
+					return base64.StdEncoding.EncodeToString(key.Credential), nil
+				}
+				return nil, nil
+			},
+		},
+		"notBefore": &graphql.Field{
+			Type: graphql.DateTime,
+		},
+		"notAfter": &graphql.Field{
+			Type: graphql.DateTime,
+		},
+	},
+})
+
+func getUserBooking(ctx context.Context, user *utils.User, id string) (*clients.Booking, error) {
+	jwt, err := userToken(user)
+	if err != nil {
+		return nil, err
+	}
+	booking, err := bookingsClient.GetBooking(ctx, jwt, id)
+	if err != nil {
+		return nil, err
+	}
+	if booking == nil {
+		return nil, newCodedError(utils.CodeNotFound, "booking not found")
+	}
+	return booking, nil
+}
+
+// credentialZones works out which zones a booking can get into, grouping the
+// doors of each zone under every grant the booking matches. Grant schedules
+// are passed on for the hotel controller to enforce.
+func credentialZones(booking *clients.Booking, roomCategory string, doors []*clients.Door, hasCarPark bool) []*clients.CredentialZone {
+	zones := make([]*clients.CredentialZone, 0)
+	seen := map[string][]*clients.CredentialZone{}
+	for _, d := range doors {
+		for _, zone := range d.Zones {
+			if zone.Kind == carParkZone && !hasCarPark {
+				continue
+			}
+			credZones, isOk := seen[zone.ID]
+			if !isOk {
+				for _, grant := range zone.Grants {
+					if !grant.Matches(booking.Type, roomCategory) {
+						continue
+					}
+					credZone := &clients.CredentialZone{
+						ZoneID: zone.ID,
+					}
+					if grant.Schedule != nil {
+						credZone.Days = grant.Schedule.Days
+						credZone.From = grant.Schedule.From
+						credZone.To = grant.Schedule.To
+					}
+					credZones = append(credZones, credZone)
+				}
+				seen[zone.ID] = credZones
+				zones = append(zones, credZones...)
+			}
+			for _, credZone := range credZones {
+				credZone.DoorIDs = append(credZone.DoorIDs, d.ID)
+			}
+		}
+	}
+	return zones
+}
+
+// issueDigitalKey gives a guest an offline key for their booking. No keys are
+// given out while the hotel is in lockdown, as the key would let the guest
+// in without asking the server.
+func issueDigitalKey(ctx context.Context, user *utils.User, bookingId string) (*clients.CredentialResp, error) {
+	booking, err := getUserBooking(ctx, user, bookingId)
+	if err != nil {
+		return nil, err
+	}
+	if time.Now().After(booking.End) {
+		return nil, newCodedError(utils.CodeBookingNotActive, "booking has ended")
+	}
+	if !booking.IsOpen() {
+		return nil, newCodedError(utils.CodeBookingNotActive, "booking is no longer open")
+	}
+	if booking.RoomID == "" {
+		return nil, newCodedError(utils.CodeBookingNotActive, "no room assigned yet")
+	}
+	err = checkNotLockedDown(ctx, booking.HotelID)
+	if err != nil {
+		return nil, err
+	}
+
+	room, err := roomsClient.GetRoom(ctx, booking.RoomID)
+	if err != nil {
+		return nil, err
+	}
+	category := ""
+	notAfter := booking.End
+	if room != nil {
+		category = room.Category
+		notAfter, err = keyExpiry(booking, room, time.Now())
+		if err != nil {
+			return nil, err
+		}
+	}
+	doors, err := hotelsClient.GetDoorsByHotel(ctx, booking.HotelID)
+	if err != nil {
+		return nil, err
+	}
+	hotel, err := hotelsClient.GetHotel(ctx, booking.HotelID)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := serviceToken()
+	if err != nil {
+		return nil, err
+	}
+
+	return hotelGatewayClient.IssueCredential(ctx, token, &clients.CredentialRequest{
+		BookingID: booking.ID,
+		HotelID:   booking.HotelID,
+		RoomID:    booking.RoomID,
+		Zones:     credentialZones(booking, category, doors, hotel != nil && hotel.HasCarPark),
+		NotBefore: roomAccessFrom(booking, hotel),
+		NotAfter:  notAfter,
+	})
+}
+
+// keyExpiry is when a key for a booking's room stops working, which is the
+// start of the room's next maintenance block if that comes before the end of
+// the booking. No key is given out while the room is out of service.
+func keyExpiry(booking *clients.Booking, room *clients.Room, now time.Time) (time.Time, error) {
+	if room.BlockAt(now) != nil {
+		return time.Time{}, newCodedError(utils.CodeRoomOutOfService, "room is out of service")
+	}
+	if block := room.BlockDuring(now, booking.End); block != nil {
+		return block.Start, nil
+	}
+	return booking.End, nil
+}
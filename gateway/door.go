@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/fluidmediaproductions/central_hotel_door_server/clients"
+	"github.com/fluidmediaproductions/central_hotel_door_server/utils"
+)
+
+const carParkZone = "carPark"
+
+type activeBooking struct {
+	Type         string
+	RoomCategory string
+}
+
+func getRoomCategory(ctx context.Context, id string) (string, error) {
+	room, err := roomsClient.GetRoom(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	if room == nil {
+		return "", nil
+	}
+	return room.Category, nil
+}
+
+// getActiveBookings returns the user's bookings at a hotel that let them in
+// now.
+func getActiveBookings(ctx context.Context, user *utils.User, hotelId string, now time.Time) ([]*activeBooking, error) {
+	jwt, err := userToken(user)
+	if err != nil {
+		return nil, err
+	}
+	bookings, err := bookingsClient.GetBookingsByHotel(ctx, jwt, hotelId)
+	if err != nil {
+		return nil, err
+	}
+
+	active := make([]*activeBooking, 0)
+	for _, booking := range bookings {
+		if !booking.AllowsAccess(now) {
+			continue
+		}
+		category, err := getRoomCategory(ctx, booking.RoomID)
+		if err != nil {
+			return nil, err
+		}
+		active = append(active, &activeBooking{
+			Type:         booking.Type,
+			RoomCategory: category,
+		})
+	}
+	return active, nil
+}
+
+// canOpenDoor checks the user has a booking at the door's hotel that one of
+// the door's zones grants access to right now. Grant schedules are read on the
+// hotel's clock. Staff on shift at the hotel can open all of its doors.
+func canOpenDoor(ctx context.Context, user *utils.User, d *clients.Door, now time.Time) (bool, error) {
+	shift, err := currentShift(ctx, user, d.HotelID, now)
+	if err != nil {
+		return false, err
+	}
+	if shift != nil {
+		return true, nil
+	}
+
+	bookings, err := getActiveBookings(ctx, user, d.HotelID, now)
+	if err != nil {
+		return false, err
+	}
+	if len(bookings) == 0 {
+		return false, nil
+	}
+
+	hotel, err := hotelsClient.GetHotel(ctx, d.HotelID)
+	if err != nil {
+		return false, err
+	}
+	local := hotel.Local(now)
+
+	for _, zone := range d.Zones {
+		if zone.Kind == carParkZone && (hotel == nil || !hotel.HasCarPark) {
+			continue
+		}
+		for _, grant := range zone.Grants {
+			for _, booking := range bookings {
+				if grant.Permits(booking.Type, booking.RoomCategory, local) {
+					return true, nil
+				}
+			}
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+
+	"github.com/fluidmediaproductions/central_hotel_door_server/utils"
+)
+
+const emergencyLockdown = "lockdown"
+
+var errLockdown = newCodedError(utils.CodeHotelLockdown, "hotel is in lockdown")
+
+// checkNotLockedDown stops guests opening anything in a hotel that security
+// has locked down.
+func checkNotLockedDown(ctx context.Context, hotelId string) error {
+	state, err := hotelsClient.GetEmergencyState(ctx, "", hotelId)
+	if err != nil {
+		return err
+	}
+	if state != nil && state.Mode == emergencyLockdown {
+		return errLockdown
+	}
+	return nil
+}
+
+// checkHotelOnline stops guests waiting on a door the hotel can't open as
+// none of its servers are connected.
+func checkHotelOnline(ctx context.Context, hotelId string) error {
+	token, err := serviceToken()
+	if err != nil {
+		return err
+	}
+	status, err := hotelGatewayClient.GetHotelStatus(ctx, token, hotelId)
+	if err != nil {
+		return err
+	}
+	if status == nil || !status.Online {
+		return errHotelOffline
+	}
+	return nil
+}
+
+// checkCanUnlock checks a hotel can carry out an unlock for a guest.
+func checkCanUnlock(ctx context.Context, hotelId string) error {
+	err := checkNotLockedDown(ctx, hotelId)
+	if err != nil {
+		return err
+	}
+	return checkHotelOnline(ctx, hotelId)
+}
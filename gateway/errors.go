@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/fluidmediaproductions/central_hotel_door_server/clients"
+	"github.com/fluidmediaproductions/central_hotel_door_server/utils"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/location"
+)
+
+const (
+	codeQueryTooDeep    = "QUERY_TOO_DEEP"
+	codeQueryTooComplex = "QUERY_TOO_COMPLEX"
+	codeRateLimited     = "RATE_LIMITED"
+)
+
+// A codedError carries a machine readable code that ends up in the
+// extensions of the GraphQL error.
+type codedError struct {
+	message string
+	code    string
+}
+
+func newCodedError(code string, message string) *codedError {
+	return &codedError{
+		message: message,
+		code:    code,
+	}
+}
+
+func (e *codedError) Error() string {
+	return e.message
+}
+
+func (e *codedError) Extensions() map[string]interface{} {
+	return map[string]interface{}{
+		"code": e.code,
+	}
+}
+
+var (
+	errNotAuthenticated = newCodedError(utils.CodeUnauthenticated, "not authenticated")
+	errBookingNotActive = newCodedError(utils.CodeBookingNotActive, "no active booking")
+	errHotelOffline     = newCodedError(utils.CodeHotelOffline, "hotel is offline")
+)
+
+// errorCodes fills in the code of errors that don't have one once a query
+// has run. Errors from the services already carry theirs, so anything left
+// is either a service that couldn't be reached or a bug in the gateway.
+type errorCodes struct{}
+
+func (errorCodes) Init(ctx context.Context, p *graphql.Params) context.Context {
+	return ctx
+}
+
+func (errorCodes) Name() string {
+	return "errorCodes"
+}
+
+func (errorCodes) ParseDidStart(ctx context.Context) (context.Context, graphql.ParseFinishFunc) {
+	return ctx, func(error) {}
+}
+
+func (errorCodes) ValidationDidStart(ctx context.Context) (context.Context, graphql.ValidationFinishFunc) {
+	return ctx, func([]gqlerrors.FormattedError) {}
+}
+
+func (errorCodes) ExecutionDidStart(ctx context.Context) (context.Context, graphql.ExecutionFinishFunc) {
+	return ctx, func(result *graphql.Result) {
+		for i := range result.Errors {
+			addErrorCode(&result.Errors[i])
+		}
+	}
+}
+
+func (errorCodes) ResolveFieldDidStart(ctx context.Context, info *graphql.ResolveInfo) (context.Context, graphql.ResolveFieldFinishFunc) {
+	return ctx, func(interface{}, error) {}
+}
+
+func (errorCodes) HasResult() bool {
+	return false
+}
+
+func (errorCodes) GetResult(ctx context.Context) interface{} {
+	return nil
+}
+
+func addErrorCode(err *gqlerrors.FormattedError) {
+	if code, isOk := err.Extensions["code"].(string); isOk && code != "" {
+		return
+	}
+
+	original := err.OriginalError()
+	if located, isOk := original.(*gqlerrors.Error); isOk {
+		original = located.OriginalError
+	}
+	code := clients.ErrorCode(original)
+	if code == "" {
+		code = utils.CodeInternal
+	}
+
+	if err.Extensions == nil {
+		err.Extensions = map[string]interface{}{}
+	}
+	err.Extensions["code"] = code
+}
+
+// writeErrors rejects a request before it is executed, in the same shape as
+// errors from the schema.
+func writeErrors(w http.ResponseWriter, status int, errs ...*codedError) {
+	result := &graphql.Result{}
+	for _, err := range errs {
+		result.Errors = append(result.Errors, gqlerrors.FormattedError{
+			Message:    err.Error(),
+			Locations:  []location.SourceLocation{},
+			Extensions: err.Extensions(),
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/fluidmediaproductions/central_hotel_door_server/clients"
+	"github.com/fluidmediaproductions/central_hotel_door_server/utils"
+	"github.com/graphql-go/graphql"
+)
+
+func TestErrorCodes(t *testing.T) {
+	fields := graphql.Fields{}
+	errs := map[string]error{
+		"upstream": &clients.Error{StatusCode: 404, Code: utils.CodeNotFound, Message: "room not found"},
+		"coded":    errBookingNotActive,
+		"plain":    errors.New("something broke"),
+	}
+	for name, err := range errs {
+		err := err
+		fields[name] = &graphql.Field{
+			Type: graphql.String,
+			Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+				return nil, err
+			},
+		}
+	}
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{
+		Query: graphql.NewObject(graphql.ObjectConfig{
+			Name:   "Query",
+			Fields: fields,
+		}),
+		Extensions: []graphql.Extension{errorCodes{}},
+	})
+	if err != nil {
+		t.Fatalf("Error creating schema: %v", err)
+	}
+
+	expected := map[string]string{
+		"upstream": utils.CodeNotFound,
+		"coded":    utils.CodeBookingNotActive,
+		"plain":    utils.CodeInternal,
+	}
+	for name, code := range expected {
+		result := graphql.Do(graphql.Params{
+			Schema:        schema,
+			RequestString: "{ " + name + " }",
+		})
+		if len(result.Errors) != 1 {
+			t.Fatalf("Expected 1 error for %s, got %v", name, result.Errors)
+		}
+		if result.Errors[0].Extensions["code"] != code {
+			t.Errorf("Expected code %s for %s, got %v", code, name, result.Errors[0].Extensions)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/base64"
+
+	"github.com/fluidmediaproductions/central_hotel_door_server/clients"
+	"github.com/fluidmediaproductions/central_hotel_door_server/utils"
+	"github.com/graphql-go/graphql"
+)
+
+var folioLineType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "FolioLine",
+	Fields: graphql.Fields{
+		"kind": &graphql.Field{
+			Type: graphql.String,
+		},
+		"date": &graphql.Field{
+			Type: graphql.String,
+		},
+		"description": &graphql.Field{
+			Type: graphql.String,
+		},
+		"quantity": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"unitAmount": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"amount": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"method": &graphql.Field{
+			Type: graphql.String,
+		},
+		"reference": &graphql.Field{
+			Type: graphql.String,
+		},
+		"postedAt": &graphql.Field{
+			Type: graphql.DateTime,
+		},
+	},
+})
+
+// folioType is the itemised account of a booking. Amounts are in the minor
+// unit of the currency.
+var folioType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Folio",
+	Fields: graphql.Fields{
+		"bookingId": &graphql.Field{
+			Type: graphql.String,
+		},
+		"hotelName": &graphql.Field{
+			Type: graphql.String,
+		},
+		"currency": &graphql.Field{
+			Type: graphql.String,
+		},
+		"charges": &graphql.Field{
+			Type: graphql.NewList(folioLineType),
+		},
+		"taxes": &graphql.Field{
+			Type: graphql.NewList(quoteTaxType),
+		},
+		"payments": &graphql.Field{
+			Type: graphql.NewList(folioLineType),
+		},
+		"chargeTotal": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"taxTotal": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"total": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"paid": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"balance": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"issuedAt": &graphql.Field{
+			Type: graphql.DateTime,
+		},
+	},
+})
+
+var invoiceFormatType = graphql.NewEnum(graphql.EnumConfig{
+	Name: "InvoiceFormat",
+	Values: graphql.EnumValueConfigMap{
+		"PDF": &graphql.EnumValueConfig{
+			Value: clients.InvoicePDF,
+		},
+		"HTML": &graphql.EnumValueConfig{
+			Value: clients.InvoiceHTML,
+		},
+	},
+})
+
+// invoiceType is a folio as a document to download, with the document base64
+// encoded.
+var invoiceType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Invoice",
+	Fields: graphql.Fields{
+		"format": &graphql.Field{
+			Type: invoiceFormatType,
+		},
+		"contentType": &graphql.Field{
+			Type: graphql.String,
+		},
+		"fileName": &graphql.Field{
+			Type: graphql.String,
+		},
+		"data": &graphql.Field{
+			Type: graphql.String,
+			Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+				invoice, isOk := params.Source.(*clients.Invoice)
+				if isOk {
+					return base64.StdEncoding.EncodeToString(invoice.Data), nil
+				}
+				return nil, nil
+			},
+		},
+	},
+})
+
+var folioQuery = &graphql.Field{
+	Type: folioType,
+	Args: graphql.FieldConfigArgument{
+		"bookingId": &graphql.ArgumentConfig{
+			Type: graphql.NewNonNull(graphql.String),
+		},
+	},
+	Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+		bookingId, isOk := params.Args["bookingId"].(string)
+		if isOk {
+			user, isOk := params.Source.(*utils.User)
+			if isOk {
+				jwt, err := userToken(user)
+				if err != nil {
+					return nil, err
+				}
+				return bookingsClient.GetFolio(requestContext(params), jwt, bookingId)
+			}
+		}
+		return nil, nil
+	},
+}
+
+var invoiceQuery = &graphql.Field{
+	Type: invoiceType,
+	Args: graphql.FieldConfigArgument{
+		"bookingId": &graphql.ArgumentConfig{
+			Type: graphql.NewNonNull(graphql.String),
+		},
+		"format": &graphql.ArgumentConfig{
+			Type:         invoiceFormatType,
+			DefaultValue: clients.InvoicePDF,
+		},
+	},
+	Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+		bookingId, isOk := params.Args["bookingId"].(string)
+		if isOk {
+			user, isOk := params.Source.(*utils.User)
+			if isOk {
+				format, _ := params.Args["format"].(string)
+				jwt, err := userToken(user)
+				if err != nil {
+					return nil, err
+				}
+				return bookingsClient.GetInvoice(requestContext(params), jwt, bookingId, format)
+			}
+		}
+		return nil, nil
+	},
+}
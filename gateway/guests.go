@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/fluidmediaproductions/central_hotel_door_server/clients"
+	"github.com/fluidmediaproductions/central_hotel_door_server/utils"
+	"github.com/graphql-go/graphql"
+)
+
+// findCurrentBooking picks the booking, owned or shared with the user, that
+// lets them in now from a list returned by the bookings server.
+func findCurrentBooking(bookings []*clients.Booking, now time.Time) *clients.Booking {
+	for _, booking := range bookings {
+		if !booking.AllowsAccess(now) {
+			continue
+		}
+		return booking
+	}
+	return nil
+}
+
+var bookingGuestType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "BookingGuest",
+	Fields: graphql.Fields{
+		"ID": &graphql.Field{
+			Type: graphql.NewNonNull(graphql.String),
+		},
+		"email": &graphql.Field{
+			Type: graphql.NewNonNull(graphql.String),
+		},
+		"start": &graphql.Field{
+			Type: graphql.DateTime,
+		},
+		"end": &graphql.Field{
+			Type: graphql.DateTime,
+		},
+		"revoked": &graphql.Field{
+			Type: graphql.NewNonNull(graphql.Boolean),
+		},
+		"inviteToken": &graphql.Field{
+			Type: graphql.String,
+		},
+	},
+})
+
+func inviteGuest(ctx context.Context, user *utils.User, bookingId string, invite *clients.GuestInvite) (*clients.BookingGuest, error) {
+	jwt, err := userToken(user)
+	if err != nil {
+		return nil, err
+	}
+	return bookingsClient.InviteGuest(ctx, jwt, bookingId, invite)
+}
+
+func revokeGuest(ctx context.Context, user *utils.User, bookingId string, guestId string) (*clients.BookingGuest, error) {
+	jwt, err := userToken(user)
+	if err != nil {
+		return nil, err
+	}
+	return bookingsClient.RevokeGuest(ctx, jwt, bookingId, guestId)
+}
+
+func acceptGuestInvite(ctx context.Context, user *utils.User, token string) (*clients.BookingGuest, error) {
+	jwt, err := userToken(user)
+	if err != nil {
+		return nil, err
+	}
+	return bookingsClient.AcceptGuestInvite(ctx, jwt, token)
+}
+
+// inviteGuestMutation invites a guest onto a booking. The invite token is
+// only given back here, for the owner to pass on to their guest.
+var inviteGuestMutation = &graphql.Field{
+	Type: bookingGuestType,
+	Args: graphql.FieldConfigArgument{
+		"bookingId": &graphql.ArgumentConfig{
+			Type: graphql.NewNonNull(graphql.String),
+		},
+		"email": &graphql.ArgumentConfig{
+			Type: graphql.NewNonNull(graphql.String),
+		},
+		"start": &graphql.ArgumentConfig{
+			Type: graphql.DateTime,
+		},
+		"end": &graphql.ArgumentConfig{
+			Type: graphql.DateTime,
+		},
+	},
+	Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+		id, isOK := params.Args["bookingId"].(string)
+		if isOK {
+			user, isOk := params.Source.(*utils.User)
+			if isOk {
+				invite := &clients.GuestInvite{}
+				invite.Email, _ = params.Args["email"].(string)
+				start, isOk := params.Args["start"].(time.Time)
+				if isOk {
+					invite.Start = &start
+				}
+				end, isOk := params.Args["end"].(time.Time)
+				if isOk {
+					invite.End = &end
+				}
+				return inviteGuest(requestContext(params), user, id, invite)
+			}
+		}
+		return nil, nil
+	},
+}
+
+var revokeGuestMutation = &graphql.Field{
+	Type: bookingGuestType,
+	Args: graphql.FieldConfigArgument{
+		"bookingId": &graphql.ArgumentConfig{
+			Type: graphql.NewNonNull(graphql.String),
+		},
+		"guestId": &graphql.ArgumentConfig{
+			Type: graphql.NewNonNull(graphql.String),
+		},
+	},
+	Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+		id, isOK := params.Args["bookingId"].(string)
+		if isOK {
+			guestId, isOK := params.Args["guestId"].(string)
+			if isOK {
+				user, isOk := params.Source.(*utils.User)
+				if isOk {
+					return revokeGuest(requestContext(params), user, id, guestId)
+				}
+			}
+		}
+		return nil, nil
+	},
+}
+
+var acceptGuestInviteMutation = &graphql.Field{
+	Type: bookingGuestType,
+	Args: graphql.FieldConfigArgument{
+		"token": &graphql.ArgumentConfig{
+			Type: graphql.NewNonNull(graphql.String),
+		},
+	},
+	Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+		token, isOK := params.Args["token"].(string)
+		if isOK {
+			user, isOk := params.Source.(*utils.User)
+			if isOk {
+				return acceptGuestInvite(requestContext(params), user, token)
+			}
+		}
+		return nil, nil
+	},
+}
@@ -1,81 +1,108 @@
 package main
 
 import (
+	"github.com/fluidmediaproductions/central_hotel_door_server/clients"
+	"github.com/fluidmediaproductions/central_hotel_door_server/utils"
 	"github.com/graphql-go/graphql"
-	"time"
 )
 
+type latLng struct {
+	Lat float64 `json:"lat"`
+	Lng float64 `json:"lng"`
+}
+
+var locationType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Location",
+	Fields: graphql.Fields{
+		"lat": &graphql.Field{
+			Type: graphql.NewNonNull(graphql.Float),
+		},
+		"lng": &graphql.Field{
+			Type: graphql.NewNonNull(graphql.Float),
+		},
+	},
+})
+
 var hotelType = graphql.NewObject(graphql.ObjectConfig{
 	Name: "Hotel",
 	Fields: graphql.Fields{
 		"ID": &graphql.Field{
 			Type: graphql.String,
-			Resolve: func(params graphql.ResolveParams) (interface{}, error) {
-				hotel, isOk := params.Source.(map[string]interface{})
-				if isOk {
-					id, isOk := hotel["uid"].(string)
-					if isOk {
-						return id, nil
-					}
-				}
-				return nil, nil
-			},
 		},
 		"checkIn": &graphql.Field{
 			Type: graphql.DateTime,
+		},
+		"checkInTime": &graphql.Field{
+			Type: graphql.String,
 			Resolve: func(params graphql.ResolveParams) (interface{}, error) {
-				hotel, isOk := params.Source.(map[string]interface{})
-				if isOk {
-					checkIn, isOk := hotel["checkIn"].(string)
-					if isOk {
-						time, err := time.Parse(time.RFC3339, checkIn)
-						if err != nil {
-							return nil, err
-						}
-						return time, nil
-					}
+				hotel, isOk := params.Source.(*clients.Hotel)
+				if isOk && !hotel.CheckIn.IsZero() {
+					return hotel.CheckIn.UTC().Format("15:04"), nil
 				}
 				return nil, nil
 			},
 		},
-		"name": &graphql.Field{
+		"timeZone": &graphql.Field{
 			Type: graphql.String,
 			Resolve: func(params graphql.ResolveParams) (interface{}, error) {
-				hotel, isOk := params.Source.(map[string]interface{})
+				hotel, isOk := params.Source.(*clients.Hotel)
 				if isOk {
-					name, isOk := hotel["name"].(string)
-					if isOk {
-						return name, nil
-					}
+					return hotel.Zone().String(), nil
 				}
 				return nil, nil
 			},
 		},
+		"name": &graphql.Field{
+			Type: graphql.String,
+		},
 		"address": &graphql.Field{
 			Type: graphql.String,
+		},
+		"hasCarPark": &graphql.Field{
+			Type: graphql.String,
+		},
+		"location": &graphql.Field{
+			Type: locationType,
 			Resolve: func(params graphql.ResolveParams) (interface{}, error) {
-				hotel, isOk := params.Source.(map[string]interface{})
+				hotel, isOk := params.Source.(*clients.Hotel)
 				if isOk {
-					address, isOk := hotel["address"].(string)
-					if isOk {
-						return address, nil
-					}
+					return resolveLocation(hotel.Location), nil
 				}
 				return nil, nil
 			},
 		},
-		"hasCarPark": &graphql.Field{
-			Type: graphql.String,
+		"roomTypes": &graphql.Field{
+			Type: graphql.NewList(roomTypeType),
 			Resolve: func(params graphql.ResolveParams) (interface{}, error) {
-				hotel, isOk := params.Source.(map[string]interface{})
+				hotel, isOk := params.Source.(*clients.Hotel)
 				if isOk {
-					hasCarPark, isOk := hotel["hasCarPark"].(bool)
-					if isOk {
-						return hasCarPark, nil
-					}
+					return roomsClient.GetRoomTypesByHotel(requestContext(params), hotel.ID)
 				}
 				return nil, nil
 			},
 		},
 	},
 })
+
+var nearbyHotelType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "NearbyHotel",
+	Fields: graphql.Fields{
+		"hotel": &graphql.Field{
+			Type: hotelType,
+		},
+		"distanceKm": &graphql.Field{
+			Type: graphql.NewNonNull(graphql.Float),
+		},
+	},
+})
+
+func resolveLocation(location *utils.Location) *latLng {
+	lat, lng, isOk := location.LatLng()
+	if !isOk {
+		return nil
+	}
+	return &latLng{
+		Lat: lat,
+		Lng: lng,
+	}
+}
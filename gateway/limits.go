@@ -0,0 +1,282 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/fluidmediaproductions/central_hotel_door_server/utils"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/source"
+	"github.com/graphql-go/handler"
+)
+
+// listCost is how many items a list field is assumed to return when working
+// out the cost of a query, as the real count isn't known until it's run.
+const listCost = 10
+
+// queryLimits is checked against every request before it reaches the schema.
+type queryLimits struct {
+	MaxDepth      int
+	MaxComplexity int
+	TrustProxy    bool
+	ProxyHops     int
+	ipLimiter     *rateLimiter
+	userLimiter   *rateLimiter
+}
+
+// queryStats is how deep and how expensive a query is.
+type queryStats struct {
+	Depth      int
+	Complexity int
+}
+
+// analyseQuery works out the depth and cost of an operation. Every field
+// costs 1, and the fields under a list cost listCost times as much.
+// Introspection fields are free so GraphiQL and other tools still work.
+func analyseQuery(schema *graphql.Schema, doc *ast.Document, operationName string) (*queryStats, error) {
+	var op *ast.OperationDefinition
+	fragments := map[string]*ast.FragmentDefinition{}
+	for _, def := range doc.Definitions {
+		switch def := def.(type) {
+		case *ast.OperationDefinition:
+			if operationName == "" || (def.Name != nil && def.Name.Value == operationName) {
+				if op != nil && operationName == "" {
+					return nil, fmt.Errorf("must provide operation name if query contains multiple operations")
+				}
+				op = def
+			}
+		case *ast.FragmentDefinition:
+			fragments[def.Name.Value] = def
+		}
+	}
+	if op == nil {
+		return nil, fmt.Errorf("unknown operation named \"%s\"", operationName)
+	}
+
+	var root graphql.Type = schema.QueryType()
+	if op.Operation == ast.OperationTypeMutation {
+		root = schema.MutationType()
+	}
+
+	a := &queryAnalyser{
+		fragments: fragments,
+		visiting:  map[string]bool{},
+	}
+	depth, cost := a.selectionSet(op.SelectionSet, root, 0)
+	return &queryStats{
+		Depth:      depth,
+		Complexity: cost,
+	}, nil
+}
+
+type queryAnalyser struct {
+	fragments map[string]*ast.FragmentDefinition
+	visiting  map[string]bool
+}
+
+func (a *queryAnalyser) selectionSet(set *ast.SelectionSet, parent graphql.Type, depth int) (int, int) {
+	if set == nil {
+		return depth, 0
+	}
+
+	maxDepth := depth
+	cost := 0
+	for _, selection := range set.Selections {
+		var selDepth, selCost int
+		switch selection := selection.(type) {
+		case *ast.Field:
+			selDepth, selCost = a.field(selection, parent, depth)
+		case *ast.InlineFragment:
+			selDepth, selCost = a.selectionSet(selection.SelectionSet, parent, depth)
+		case *ast.FragmentSpread:
+			name := selection.Name.Value
+			fragment, isOk := a.fragments[name]
+			if !isOk || a.visiting[name] {
+				continue
+			}
+			a.visiting[name] = true
+			selDepth, selCost = a.selectionSet(fragment.SelectionSet, parent, depth)
+			a.visiting[name] = false
+		}
+		if selDepth > maxDepth {
+			maxDepth = selDepth
+		}
+		cost += selCost
+	}
+	return maxDepth, cost
+}
+
+func (a *queryAnalyser) field(field *ast.Field, parent graphql.Type, depth int) (int, int) {
+	if strings.HasPrefix(field.Name.Value, "__") {
+		return depth, 0
+	}
+
+	multiplier := 1
+	var fieldType graphql.Type
+	object, isOk := parent.(*graphql.Object)
+	if isOk {
+		def, isOk := object.Fields()[field.Name.Value]
+		if isOk {
+			fieldType = def.Type
+		}
+	}
+	if nonNull, isOk := fieldType.(*graphql.NonNull); isOk {
+		fieldType = nonNull.OfType
+	}
+	if list, isOk := fieldType.(*graphql.List); isOk {
+		multiplier = listCost
+		fieldType = list.OfType
+	}
+	if nonNull, isOk := fieldType.(*graphql.NonNull); isOk {
+		fieldType = nonNull.OfType
+	}
+
+	childDepth, childCost := a.selectionSet(field.SelectionSet, fieldType, depth+1)
+	return childDepth, 1 + multiplier*childCost
+}
+
+// queryUser finds the user a query is made as, from the token passed to the
+// top level auth field. Only valid tokens count, so made up ones just fall
+// back to the IP limit.
+func queryUser(doc *ast.Document, variables map[string]interface{}) string {
+	for _, def := range doc.Definitions {
+		op, isOk := def.(*ast.OperationDefinition)
+		if !isOk || op.SelectionSet == nil {
+			continue
+		}
+		for _, selection := range op.SelectionSet.Selections {
+			field, isOk := selection.(*ast.Field)
+			if !isOk || field.Name.Value != "auth" {
+				continue
+			}
+			for _, arg := range field.Arguments {
+				if arg.Name.Value != "token" {
+					continue
+				}
+				var token string
+				switch value := arg.Value.(type) {
+				case *ast.StringValue:
+					token = value.Value
+				case *ast.Variable:
+					token, _ = variables[value.Name.Value].(string)
+				}
+				claims, err := utils.VerifyJWT(token, jwtSecret)
+				if err == nil && claims.User != nil {
+					return claims.User.ID
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// clientIP works out who sent a request. Behind a trusted proxy it's the
+// X-Forwarded-For entry ProxyHops from the right, as clients can put anything
+// they like to the left of what the proxies add.
+func (l *queryLimits) clientIP(r *http.Request) string {
+	if l.TrustProxy {
+		var forwarded []string
+		for _, header := range r.Header["X-Forwarded-For"] {
+			for _, entry := range strings.Split(header, ",") {
+				forwarded = append(forwarded, strings.TrimSpace(entry))
+			}
+		}
+		hops := l.ProxyHops
+		if hops < 1 {
+			hops = 1
+		}
+		if len(forwarded) >= hops && forwarded[len(forwarded)-hops] != "" {
+			return forwarded[len(forwarded)-hops]
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func rateLimited(w http.ResponseWriter, wait int) {
+	w.Header().Set("Retry-After", fmt.Sprint(wait))
+	writeErrors(w, http.StatusTooManyRequests, newCodedError(codeRateLimited, "too many requests"))
+}
+
+// limitsHandler rejects requests over the rate limits, or with queries that
+// are too deep or too expensive, before they're run.
+func limitsHandler(schema *graphql.Schema, limits *queryLimits, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		allowed, wait := limits.ipLimiter.Allow(limits.clientIP(r))
+		if !allowed {
+			rateLimited(w, int(wait.Seconds())+1)
+			return
+		}
+
+		// The handler reads the body again, so keep a copy of it
+		var body []byte
+		if r.Body != nil {
+			var err error
+			body, err = ioutil.ReadAll(r.Body)
+			r.Body.Close()
+			if err != nil {
+				writeErrors(w, http.StatusBadRequest, newCodedError(utils.CodeBadRequest, err.Error()))
+				return
+			}
+			r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		}
+		opts := handler.NewRequestOptions(r)
+		if body != nil {
+			r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		}
+
+		// Requests without a query are left for the handler, which serves
+		// GraphiQL or reports the error
+		if opts == nil || opts.Query == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		doc, err := parser.Parse(parser.ParseParams{
+			Source: source.NewSource(&source.Source{
+				Body: []byte(opts.Query),
+				Name: "GraphQL request",
+			}),
+		})
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		userId := queryUser(doc, opts.Variables)
+		if userId != "" {
+			allowed, wait := limits.userLimiter.Allow(userId)
+			if !allowed {
+				rateLimited(w, int(wait.Seconds())+1)
+				return
+			}
+		}
+
+		stats, err := analyseQuery(schema, doc, opts.OperationName)
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if limits.MaxDepth > 0 && stats.Depth > limits.MaxDepth {
+			writeErrors(w, http.StatusBadRequest, newCodedError(codeQueryTooDeep,
+				fmt.Sprintf("query depth %d is over the limit of %d", stats.Depth, limits.MaxDepth)))
+			return
+		}
+		if limits.MaxComplexity > 0 && stats.Complexity > limits.MaxComplexity {
+			writeErrors(w, http.StatusBadRequest, newCodedError(codeQueryTooComplex,
+				fmt.Sprintf("query complexity %d is over the limit of %d", stats.Complexity, limits.MaxComplexity)))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
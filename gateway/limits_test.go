@@ -0,0 +1,103 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/graphql-go/graphql/language/parser"
+)
+
+func TestAnalyseQuery(t *testing.T) {
+	schema, err := initSchema()
+	if err != nil {
+		t.Fatalf("Error creating schema: %v", err)
+	}
+
+	cases := []struct {
+		query      string
+		depth      int
+		complexity int
+	}{
+		{`{ hotel(id: "0x1") { name } }`, 2, 2},
+		{`{ hotels { edges { node { name address } } } }`, 4, 32},
+		{`{ auth(token: "") { self { bookings { edges { node { room { hotel { name } } } } } } } }`, 8, 44},
+		{`query { hotels { edges { node { ...hotelFields } } } } fragment hotelFields on Hotel { name }`, 4, 22},
+		{`{ __schema { types { name fields { name type { name } } } } }`, 0, 0},
+	}
+
+	for _, c := range cases {
+		doc, err := parser.Parse(parser.ParseParams{Source: c.query})
+		if err != nil {
+			t.Fatalf("Error parsing %s: %v", c.query, err)
+		}
+		stats, err := analyseQuery(&schema, doc, "")
+		if err != nil {
+			t.Fatalf("Error analysing %s: %v", c.query, err)
+		}
+		if stats.Depth != c.depth {
+			t.Errorf("Expected depth %d for %s, got %d", c.depth, c.query, stats.Depth)
+		}
+		if stats.Complexity != c.complexity {
+			t.Errorf("Expected complexity %d for %s, got %d", c.complexity, c.query, stats.Complexity)
+		}
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	now := time.Now()
+	limiter := newRateLimiter(2)
+	limiter.now = func() time.Time {
+		return now
+	}
+
+	for i := 0; i < 2; i++ {
+		allowed, _ := limiter.Allow("bob")
+		if !allowed {
+			t.Fatalf("Request %d was limited", i)
+		}
+	}
+	allowed, wait := limiter.Allow("bob")
+	if allowed {
+		t.Errorf("Request over the limit was allowed")
+	}
+	if wait <= 0 || wait > time.Second*30 {
+		t.Errorf("Expected a wait of up to 30s, got %v", wait)
+	}
+
+	allowed, _ = limiter.Allow("alice")
+	if !allowed {
+		t.Errorf("Limit was shared between keys")
+	}
+
+	now = now.Add(time.Second * 30)
+	allowed, _ = limiter.Allow("bob")
+	if !allowed {
+		t.Errorf("Request after refill was limited")
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	for _, test := range []struct {
+		limits    *queryLimits
+		forwarded []string
+		ip        string
+	}{
+		{&queryLimits{}, []string{"1.1.1.1"}, "192.0.2.1"},
+		{&queryLimits{TrustProxy: true}, nil, "192.0.2.1"},
+		// Clients can forge the left of the header, but not what the proxy adds
+		{&queryLimits{TrustProxy: true}, []string{"1.1.1.1, 2.2.2.2"}, "2.2.2.2"},
+		{&queryLimits{TrustProxy: true, ProxyHops: 1}, []string{"1.1.1.1", "2.2.2.2"}, "2.2.2.2"},
+		{&queryLimits{TrustProxy: true, ProxyHops: 2}, []string{"1.1.1.1, 2.2.2.2, 3.3.3.3"}, "2.2.2.2"},
+		{&queryLimits{TrustProxy: true, ProxyHops: 2}, []string{"2.2.2.2"}, "192.0.2.1"},
+	} {
+		req := httptest.NewRequest("POST", "http://a/graphql", nil)
+		for _, forwarded := range test.forwarded {
+			req.Header.Add("X-Forwarded-For", forwarded)
+		}
+		ip := test.limits.clientIP(req)
+		if ip != test.ip {
+			t.Errorf("Expected %s for %v with %+v, got %s", test.ip, test.forwarded, test.limits, ip)
+		}
+	}
+}
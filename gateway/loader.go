@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+)
+
+// A Loader collects the IDs asked for while resolving one level of a query and
+// fetches them in a single batch request when the first result is needed.
+// graphql-go resolves thunks breadth first, so every Booking.hotel in a list
+// ends up in the same batch. Results are cached for the rest of the request.
+type Loader struct {
+	fetch   func(ids []string) (map[string]interface{}, error)
+	mu      sync.Mutex
+	results map[string]*loaderResult
+	pending []string
+}
+
+type loaderResult struct {
+	value interface{}
+	err   error
+}
+
+func NewLoader(fetch func(ids []string) (map[string]interface{}, error)) *Loader {
+	return &Loader{
+		fetch:   fetch,
+		results: map[string]*loaderResult{},
+	}
+}
+
+// Load queues an ID and returns a thunk for graphql-go to resolve later.
+func (l *Loader) Load(id string) func() (interface{}, error) {
+	l.mu.Lock()
+	result, isOk := l.results[id]
+	if !isOk {
+		result = &loaderResult{}
+		l.results[id] = result
+		l.pending = append(l.pending, id)
+	}
+	l.mu.Unlock()
+
+	return func() (interface{}, error) {
+		l.dispatch()
+		return result.value, result.err
+	}
+}
+
+func (l *Loader) dispatch() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.pending) == 0 {
+		return
+	}
+	ids := l.pending
+	l.pending = nil
+
+	values, err := l.fetch(ids)
+	for _, id := range ids {
+		result := l.results[id]
+		if err != nil {
+			result.err = err
+			continue
+		}
+		value, isOk := values[id]
+		if !isOk {
+			result.err = errors.New("not found")
+			continue
+		}
+		result.value = value
+	}
+}
+
+type loaders struct {
+	hotels *Loader
+	rooms  *Loader
+}
+
+type loadersKey struct{}
+
+func newLoaders(ctx context.Context) *loaders {
+	return &loaders{
+		hotels: NewLoader(func(ids []string) (map[string]interface{}, error) {
+			hotels, err := hotelsClient.GetHotelsBatch(ctx, ids)
+			if err != nil {
+				return nil, err
+			}
+			values := map[string]interface{}{}
+			for _, hotel := range hotels {
+				values[hotel.ID] = hotel
+			}
+			return values, nil
+		}),
+		rooms: NewLoader(func(ids []string) (map[string]interface{}, error) {
+			rooms, err := roomsClient.GetRoomsBatch(ctx, ids)
+			if err != nil {
+				return nil, err
+			}
+			values := map[string]interface{}{}
+			for _, room := range rooms {
+				values[room.ID] = room
+			}
+			return values, nil
+		}),
+	}
+}
+
+func withLoaders(ctx context.Context) context.Context {
+	return context.WithValue(ctx, loadersKey{}, newLoaders(ctx))
+}
+
+// getLoaders returns the request's loaders, or new ones if the query is run
+// without them, as the tests do.
+func getLoaders(ctx context.Context) *loaders {
+	if ctx != nil {
+		l, isOk := ctx.Value(loadersKey{}).(*loaders)
+		if isOk {
+			return l
+		}
+		return newLoaders(ctx)
+	}
+	return newLoaders(context.Background())
+}
+
+func loadersHandler(h interface {
+	ContextHandler(ctx context.Context, w http.ResponseWriter, r *http.Request)
+}) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.ContextHandler(withLoaders(r.Context()), w, r)
+	})
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestLoaderBatches(t *testing.T) {
+	calls := make([][]string, 0)
+	loader := NewLoader(func(ids []string) (map[string]interface{}, error) {
+		calls = append(calls, ids)
+		return map[string]interface{}{
+			"0x1": "one",
+			"0x2": "two",
+		}, nil
+	})
+
+	first := loader.Load("0x1")
+	second := loader.Load("0x2")
+	again := loader.Load("0x1")
+	missing := loader.Load("0x3")
+
+	value, err := first()
+	if err != nil || value != "one" {
+		t.Errorf("First load returned %v, %v", value, err)
+	}
+	value, err = second()
+	if err != nil || value != "two" {
+		t.Errorf("Second load returned %v, %v", value, err)
+	}
+	value, err = again()
+	if err != nil || value != "one" {
+		t.Errorf("Repeated load returned %v, %v", value, err)
+	}
+	_, err = missing()
+	if err == nil {
+		t.Errorf("Missing ID didn't return an error")
+	}
+
+	if len(calls) != 1 {
+		t.Fatalf("Expected 1 batch, got %d", len(calls))
+	}
+	if len(calls[0]) != 3 {
+		t.Errorf("Expected 3 IDs in the batch, got %v", calls[0])
+	}
+
+	value, err = loader.Load("0x2")()
+	if err != nil || value != "two" {
+		t.Errorf("Cached load returned %v, %v", value, err)
+	}
+	if len(calls) != 1 {
+		t.Errorf("Cached load fetched again")
+	}
+}
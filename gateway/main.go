@@ -1,8 +1,12 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net/http"
+	"strings"
+	"github.com/fluidmediaproductions/central_hotel_door_server/clients"
+	"github.com/fluidmediaproductions/central_hotel_door_server/utils"
 	"github.com/graphql-go/graphql"
 	"github.com/graphql-go/handler"
 	"github.com/rs/cors"
@@ -15,23 +19,68 @@ var AuthServer = "http://auth"
 var BookingsServer = "http://bookings"
 var HotelsServer = "http://hotels"
 var RoomsServer = "http://rooms"
+var HotelGatewayServer = "http://hotel-gateway"
 var jwtSecret []byte
 
+var authClient = clients.NewAuthClient(AuthServer)
+var bookingsClient = clients.NewBookingsClient(BookingsServer)
+var hotelsClient = clients.NewHotelsClient(HotelsServer)
+var roomsClient = clients.NewRoomsClient(RoomsServer)
+var hotelGatewayClient = clients.NewHotelGatewayClient(HotelGatewayServer)
+
+// requestContext returns the context to call the other services with, so
+// their requests are cancelled along with the query.
+func requestContext(params graphql.ResolveParams) context.Context {
+	if params.Context != nil {
+		return params.Context
+	}
+	return context.Background()
+}
+
+// userToken signs a token to call the other services as the user.
+func userToken(user *utils.User) (string, error) {
+	return utils.NewJWT(user, jwtSecret)
+}
+
+// serviceToken signs a token to call the other services as the gateway, for
+// the calls only services may make.
+func serviceToken() (string, error) {
+	return utils.NewServiceJWT("gateway", jwtSecret)
+}
+
 func initSchema() (graphql.Schema, error) {
 	schema, err := graphql.NewSchema(graphql.SchemaConfig{
-		Query:    rootQuery,
-		Mutation: rootMutation,
+		Query:      rootQuery,
+		Mutation:   rootMutation,
+		Extensions: []graphql.Extension{errorCodes{}},
 	})
 
 	return schema, err
 }
 
 func main() {
+	viper.SetDefault("GRAPHIQL", false)
+	viper.SetDefault("CORS_ORIGINS", "*")
+	viper.SetDefault("MAX_QUERY_DEPTH", 10)
+	viper.SetDefault("MAX_QUERY_COMPLEXITY", 500)
+	viper.SetDefault("RATE_LIMIT_IP", 120)
+	viper.SetDefault("RATE_LIMIT_USER", 60)
+	viper.SetDefault("PROXY_HOPS", 1)
+
 	viper.SetEnvPrefix("TRAVELR")
 	viper.AutomaticEnv()
 
 	jwtSecret = []byte(viper.GetString("JWT_SECRET"))
 
+	limits := &queryLimits{
+		MaxDepth:      viper.GetInt("MAX_QUERY_DEPTH"),
+		MaxComplexity: viper.GetInt("MAX_QUERY_COMPLEXITY"),
+		TrustProxy:    viper.GetBool("TRUST_PROXY"),
+		ProxyHops:     viper.GetInt("PROXY_HOPS"),
+		ipLimiter:     newRateLimiter(viper.GetInt("RATE_LIMIT_IP")),
+		userLimiter:   newRateLimiter(viper.GetInt("RATE_LIMIT_USER")),
+	}
+
 	schema, err := initSchema()
 	if err != nil {
 		panic(err)
@@ -40,10 +89,12 @@ func main() {
 	h := handler.New(&handler.Config{
 		Schema:   &schema,
 		Pretty:   true,
-		GraphiQL: true,
+		GraphiQL: viper.GetBool("GRAPHIQL"),
 	})
 
-	corsH := cors.Default().Handler(h)
+	corsH := cors.New(cors.Options{
+		AllowedOrigins: strings.Split(viper.GetString("CORS_ORIGINS"), ","),
+	}).Handler(limitsHandler(&schema, limits, loadersHandler(h)))
 
 	http.Handle("/graphql", corsH)
 
@@ -5,13 +5,101 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/fluidmediaproductions/central_hotel_door_server/clients"
 	"github.com/fluidmediaproductions/central_hotel_door_server/utils"
 	"github.com/graphql-go/graphql"
-	"github.com/jinzhu/gorm"
 )
 
+// fakeServices stands in for the auth, bookings, hotels, rooms and hotel
+// gateway servers, answering each path with a canned status and body.
+type fakeServices struct {
+	t         *testing.T
+	mu        sync.Mutex
+	responses map[string]*fakeResponse
+	requests  []*http.Request
+}
+
+type fakeResponse struct {
+	status int
+	body   string
+}
+
+// respond sets the reply to a method and path, like "GET /hotels/0x1".
+func (f *fakeServices) respond(route string, status int, body string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.responses[route] = &fakeResponse{status: status, body: body}
+}
+
+func (f *fakeServices) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	f.requests = append(f.requests, r)
+	resp, isOk := f.responses[r.Method+" "+r.URL.Path]
+	f.mu.Unlock()
+	if !isOk {
+		f.t.Errorf("Unexpected request %s %s", r.Method, r.URL)
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"err": "not found", "code": "NOT_FOUND"}`)
+		return
+	}
+	w.WriteHeader(resp.status)
+	fmt.Fprint(w, resp.body)
+}
+
+// token is the JWT sent with the last request to a path.
+func (f *fakeServices) token(path string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i := len(f.requests) - 1; i >= 0; i-- {
+		if f.requests[i].URL.Path == path {
+			return strings.TrimPrefix(f.requests[i].Header.Get("Authorization"), "Bearer ")
+		}
+	}
+	return ""
+}
+
+// expectServiceToken checks the last request to the path was made as the
+// gateway rather than as the user.
+func (f *fakeServices) expectServiceToken(t *testing.T, path string) {
+	claims, err := utils.VerifyJWT(f.token(path), jwtSecret)
+	if err != nil {
+		t.Errorf("Expected a service JWT for %s: %v", path, err)
+		return
+	}
+	if !claims.User.HasRole(utils.RoleService) {
+		t.Errorf("Expected a service JWT for %s, got user %+v", path, claims.User)
+	}
+}
+
+// useFakeServices points the gateway's clients at fake services until the
+// returned func is called. The clients don't retry, so errors come straight
+// back.
+func useFakeServices(t *testing.T) (*fakeServices, func()) {
+	fake := &fakeServices{t: t, responses: map[string]*fakeResponse{}}
+	ts := httptest.NewServer(fake)
+
+	oldAuth, oldBookings, oldHotels, oldRooms, oldHotelGateway := authClient, bookingsClient, hotelsClient, roomsClient, hotelGatewayClient
+	authClient = clients.NewAuthClient(ts.URL)
+	authClient.Retries = 0
+	bookingsClient = clients.NewBookingsClient(ts.URL)
+	bookingsClient.Retries = 0
+	hotelsClient = clients.NewHotelsClient(ts.URL)
+	hotelsClient.Retries = 0
+	roomsClient = clients.NewRoomsClient(ts.URL)
+	roomsClient.Retries = 0
+	hotelGatewayClient = clients.NewHotelGatewayClient(ts.URL)
+	hotelGatewayClient.Retries = 0
+
+	return fake, func() {
+		ts.Close()
+		authClient, bookingsClient, hotelsClient, roomsClient, hotelGatewayClient = oldAuth, oldBookings, oldHotels, oldRooms, oldHotelGateway
+	}
+}
+
 func runQuery(query string, variables map[string]interface{}, t *testing.T) *graphql.Result {
 	schema, err := initSchema()
 	if err != nil {
@@ -25,19 +113,57 @@ func runQuery(query string, variables map[string]interface{}, t *testing.T) *gra
 	return r
 }
 
-func TestQueryAuth(t *testing.T) {
-	user := &utils.User{
-		Name:  "Bob",
-		Email: "foo@bar.com",
-		Model: gorm.Model{
-			ID: 1,
-		},
+// resultField digs a value out of a query's result by field names and list
+// indexes.
+func resultField(t *testing.T, res *graphql.Result, path ...interface{}) interface{} {
+	value := res.Data
+	for i, step := range path {
+		switch step := step.(type) {
+		case string:
+			fields, isOk := value.(map[string]interface{})
+			if !isOk {
+				t.Fatalf("Error getting data%v, expected type map[string]interface{} got %T", path[:i+1], value)
+			}
+			value = fields[step]
+		case int:
+			list, isOk := value.([]interface{})
+			if !isOk || len(list) <= step {
+				t.Fatalf("Error getting data%v, expected a list longer than %d got %v", path[:i+1], step, value)
+			}
+			value = list[step]
+		}
+	}
+	return value
+}
+
+func expectField(t *testing.T, res *graphql.Result, want interface{}, path ...interface{}) {
+	got := resultField(t, res, path...)
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("data%v was not what was expected, wanted %v got %v", path, want, got)
 	}
+}
+
+var testUser = &utils.User{
+	ID:    "0x1",
+	Name:  "Bob",
+	Email: "foo@bar.com",
+}
 
-	jwt, err := utils.NewJWT(user)
+func testToken(t *testing.T) string {
+	jwt, err := userToken(testUser)
 	if err != nil {
 		t.Fatalf("Error creating JWT: %v", err)
 	}
+	return jwt
+}
+
+const userInfoResp = `{"err": "", "user": {"uid": "0x1", "name": "Bob", "email": "foo@bar.com"}}`
+
+func TestQueryAuth(t *testing.T) {
+	fake, restore := useFakeServices(t)
+	defer restore()
+
+	fake.respond("GET /userInfo", http.StatusOK, userInfoResp)
 
 	query := `
 		query ($token: String!) {
@@ -48,59 +174,23 @@ func TestQueryAuth(t *testing.T) {
 					ID
 				}
 			}
-        }
+		}
 	`
 	variables := map[string]interface{}{
-		"token": jwt,
+		"token": testToken(t),
 	}
 	res := runQuery(query, variables, t)
-
 	if res.HasErrors() {
 		t.Errorf("Errors given from query: %v", res.Errors)
 	}
-
-	data, isOk := res.Data.(map[string]interface{})
-	if !isOk {
-		t.Fatalf("Error getting data, expected type map[string]interface{} got %T", res.Data)
-	}
-
-	auth, isOk := data["auth"].(map[string]interface{})
-	if !isOk {
-		t.Fatalf("Error getting data[auth], expected type map[string]interface{} got %T", data["auth"])
-	}
-
-	self, isOk := auth["self"].(map[string]interface{})
-	if !isOk {
-		t.Fatalf("Error getting data[auth][self], expected type map[string]interface{} got %T", auth["self"])
-	}
-
-	name, isOk := self["name"].(string)
-	if !isOk {
-		t.Errorf("Error getting data[auth][self][name], expected type string got %T", self["name"])
-	} else {
-		if name != "Bob" {
-			t.Errorf("Name was not what was expected, wanted Bob got %s", name)
-		}
-	}
-
-	email, isOk := self["email"].(string)
-	if !isOk {
-		t.Errorf("Error getting data[auth][self][email], expected type string got %T", self["email"])
-	} else {
-		if email != "foo@bar.com" {
-			t.Errorf("Email was not what was expected, wanted foo@bar.com got %s", email)
-		}
-	}
-
-	ID, isOk := self["ID"].(int)
-	if !isOk {
-		t.Errorf("Error getting data[auth][self][ID], expected type int got %T", self["ID"])
-	} else {
-		if ID != 1 {
-			t.Errorf("ID was not what was expected, wanted 1 got %d", ID)
-		}
+	expectField(t, res, "Bob", "auth", "self", "name")
+	expectField(t, res, "foo@bar.com", "auth", "self", "email")
+	expectField(t, res, "0x1", "auth", "self", "ID")
+	if fake.token("/userInfo") != testToken(t) {
+		t.Errorf("Expected the token to be checked with the auth server, got %s", fake.token("/userInfo"))
 	}
 
+	fake.respond("GET /userInfo", http.StatusForbidden, `{"err": "invalid token", "code": "UNAUTHENTICATED"}`)
 	variables = map[string]interface{}{
 		"token": "bla",
 	}
@@ -108,116 +198,58 @@ func TestQueryAuth(t *testing.T) {
 	if !res.HasErrors() {
 		t.Error("Expected errors with invalid JWT got none")
 	}
-}
 
-func TestQueryBookings(t *testing.T) {
-	user := &utils.User{
-		Name:  "Bob",
-		Email: "foo@bar.com",
-		Model: gorm.Model{
-			ID: 1,
-		},
+	// The token is checked locally when the auth server is down
+	fake.respond("GET /userInfo", http.StatusBadGateway, `{"err": "down"}`)
+	variables = map[string]interface{}{
+		"token": testToken(t),
 	}
-
-	bookingsServerResp := `
-		{
-			"err": "",
-			"bookings": [
-				{
-					"ID": 1
-				}
-			]
-		}
-	`
-
-	jwt, err := utils.NewJWT(user)
-	if err != nil {
-		t.Fatalf("Error creating JWT: %v", err)
+	res = runQuery(query, variables, t)
+	if res.HasErrors() {
+		t.Errorf("Errors given from query: %v", res.Errors)
 	}
+	expectField(t, res, "0x1", "auth", "self", "ID")
+}
 
-	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ") == "" {
-			t.Errorf("No JWT given to bookings server, got %s",
-				strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "))
-		}
-		fmt.Fprint(w, bookingsServerResp)
-	}))
-	defer ts.Close()
+func TestQueryBookings(t *testing.T) {
+	fake, restore := useFakeServices(t)
+	defer restore()
 
-	BookingsServer = ts.URL
+	fake.respond("GET /userInfo", http.StatusOK, userInfoResp)
+	fake.respond("GET /bookings", http.StatusOK, `{
+		"err": "",
+		"bookings": [{"uid": "0x10"}],
+		"pageInfo": {"hasNextPage": false}
+	}`)
 
 	query := `
 		query ($token: String!) {
 			auth(token: $token) {
 				self {
 					bookings {
-						ID
+						edges {
+							node {
+								ID
+							}
+						}
 					}
 				}
 			}
-        }
+		}
 	`
 	variables := map[string]interface{}{
-		"token": jwt,
+		"token": testToken(t),
 	}
 	res := runQuery(query, variables, t)
-
 	if res.HasErrors() {
 		t.Errorf("Errors given from query: %v", res.Errors)
 	}
-
-	data, isOk := res.Data.(map[string]interface{})
-	if !isOk {
-		t.Fatalf("Error getting data, expected type map[string]interface{} got %T", res.Data)
-	}
-	auth, isOk := data["auth"].(map[string]interface{})
-	if !isOk {
-		t.Fatalf("Error getting data[auth], expected type map[string]interface{} got %T", data["auth"])
-	}
-	self, isOk := auth["self"].(map[string]interface{})
-	if !isOk {
-		t.Fatalf("Error getting data[auth][self], expected type map[string]interface{} got %T", auth["self"])
-	}
-	bookings, isOk := self["bookings"].([]interface{})
-	if !isOk {
-		t.Fatalf("Error getting data[auth][self][bookings], expected type []interface{} got %T", self["bookings"])
-	}
-
-	if len(bookings) != 1 {
-		t.Fatalf("Didn't get right length of bookings, expected 1 got %d", len(bookings))
-	}
-	booking, isOk := bookings[0].(map[string]interface{})
-	if !isOk {
-		t.Fatalf("Error getting data[auth][self][bookings[0], expected type map[string]interface{} got %T", bookings[0])
-	}
-
-	ID, isOk := booking["ID"].(int)
-	if !isOk {
-		t.Errorf("Error getting data[auth][self][bookings][0][ID], expected type int got %T", booking["ID"])
-	} else {
-		if ID != 1 {
-			t.Errorf("ID was not what was expected, wanted 1 got %d", ID)
-		}
+	expectField(t, res, "0x10", "auth", "self", "bookings", "edges", 0, "node", "ID")
+	if fake.token("/bookings") == "" {
+		t.Error("No JWT given to bookings server")
 	}
 
-	bookingsServerResp = `
-		{
-			"err": "foobar",
-			"bookings": []
-		}
-	`
-
-	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ") == "" {
-			t.Errorf("No JWT given to bookings server, got %s",
-				strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "))
-		}
-		fmt.Fprint(w, bookingsServerResp)
-	}))
-	defer ts.Close()
-
-	BookingsServer = ts.URL
-
+	fake.respond("GET /bookings", http.StatusInternalServerError, `{"err": "foobar", "bookings": []}`)
 	res = runQuery(query, variables, t)
 	if !res.HasErrors() {
 		t.Error("Expected errors with when bookings server sent error but got none")
@@ -225,274 +257,72 @@ func TestQueryBookings(t *testing.T) {
 }
 
 func TestQueryBooking(t *testing.T) {
-	user := &utils.User{
-		Name:  "Bob",
-		Email: "foo@bar.com",
-		Model: gorm.Model{
-			ID: 1,
-		},
-	}
-
-	bookingsServerResp := `
-		{
-			"err": "",
-			"booking": 
-			{
-				"ID": 1,
-				"start": "2006-01-02T15:04:05Z",
-				"end": "2006-01-02T15:04:05Z",
-				"hotelId": 1,
-				"roomId": 1
-			}
-		}
-	`
-
-	jwt, err := utils.NewJWT(user)
-	if err != nil {
-		t.Fatalf("Error creating JWT: %v", err)
-	}
-
-	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ") == "" {
-			t.Errorf("No JWT given to bookings server, got %s",
-				strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "))
-		}
-		fmt.Fprint(w, bookingsServerResp)
-	}))
-	defer ts.Close()
-
-	BookingsServer = ts.URL
+	fake, restore := useFakeServices(t)
+	defer restore()
+
+	fake.respond("GET /userInfo", http.StatusOK, userInfoResp)
+	fake.respond("GET /bookings/0x10", http.StatusOK, `{
+		"err": "",
+		"booking": {
+			"uid": "0x10",
+			"start": "2006-01-02T15:04:05Z",
+			"end": "2006-01-03T15:04:05Z",
+			"hotelId": "0x2",
+			"roomId": "0x3"
+		}
+	}`)
+	fake.respond("GET /hotels/batch", http.StatusOK, `{"err": "", "hotels": [{"uid": "0x2", "name": "foobar"}]}`)
+	fake.respond("GET /rooms/batch", http.StatusOK, `{"err": "", "rooms": [{"uid": "0x3", "name": "101"}]}`)
 
 	query := `
 		query ($token: String!) {
 			auth(token: $token) {
-				booking(id: 1) {
+				booking(id: "0x10") {
 					ID
 					start
 					end
-				}
-			}
-        }
-	`
-	variables := map[string]interface{}{
-		"token": jwt,
-	}
-	res := runQuery(query, variables, t)
-
-	if res.HasErrors() {
-		t.Errorf("Errors given from query: %v", res.Errors)
-	}
-
-	data, isOk := res.Data.(map[string]interface{})
-	if !isOk {
-		t.Fatalf("Error getting data, expected type map[string]interface{} got %T", res.Data)
-	}
-	auth, isOk := data["auth"].(map[string]interface{})
-	if !isOk {
-		t.Fatalf("Error getting data[auth], expected type map[string]interface{} got %T", data["auth"])
-	}
-	booking, isOk := auth["booking"].(map[string]interface{})
-	if !isOk {
-		t.Fatalf("Error getting data[auth][booking], expected type map[string]interface{} got %T", auth["booking"])
-	}
-
-	ID, isOk := booking["ID"].(int)
-	if !isOk {
-		t.Errorf("Error getting data[auth][booking][ID], expected type int got %T", booking["ID"])
-	} else {
-		if ID != 1 {
-			t.Errorf("ID was not what was expected, wanted 1 got %d", ID)
-		}
-	}
-	start, isOk := booking["start"].(string)
-	if !isOk {
-		t.Errorf("Error getting data[auth][booking][start], expected type string got %T", booking["start"])
-	} else {
-		if start != "2006-01-02T15:04:05Z" {
-			t.Errorf("Start was not what was expected, wanted 2006-01-02T15:04:05Z got %s", start)
-		}
-	}
-	end, isOk := booking["end"].(string)
-	if !isOk {
-		t.Errorf("Error getting data[auth][booking][end], expected type string got %T", booking["end"])
-	} else {
-		if end != "2006-01-02T15:04:05Z" {
-			t.Errorf("End was not what was expected, wanted 2006-01-02T15:04:05Z got %s", end)
-		}
-	}
-
-	query = `
-		query ($token: String!) {
-			auth(token: $token) {
-				booking(id: 1) {
 					hotel {
 						ID
+						name
 					}
-				}
-			}
-        }
-	`
-
-	hotelsServerResp := `
-		{
-			"err": "",
-			"hotel": 
-			{
-				"ID": 1
-			}
-		}
-	`
-
-	hotelsTs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		fmt.Fprint(w, hotelsServerResp)
-	}))
-	defer hotelsTs.Close()
-
-	HotelsServer = hotelsTs.URL
-
-	res = runQuery(query, variables, t)
-
-	if res.HasErrors() {
-		t.Errorf("Errors given from query: %v", res.Errors)
-	}
-	data, isOk = res.Data.(map[string]interface{})
-	if !isOk {
-		t.Fatalf("Error getting data, expected type map[string]interface{} got %T", res.Data)
-	}
-	auth, isOk = data["auth"].(map[string]interface{})
-	if !isOk {
-		t.Fatalf("Error getting data[auth], expected type map[string]interface{} got %T", data["auth"])
-	}
-	booking, isOk = auth["booking"].(map[string]interface{})
-	if !isOk {
-		t.Fatalf("Error getting data[auth][booking], expected type map[string]interface{} got %T", auth["booking"])
-	}
-
-	hotel, isOk := booking["hotel"].(map[string]interface{})
-	if !isOk {
-		t.Fatalf("Error getting data[auth][booking][hotel], expected type map[string]interface{} got %T", booking["hotel"])
-	}
-	ID, isOk = hotel["ID"].(int)
-	if !isOk {
-		t.Errorf("Error getting data[auth][booking][hotel][ID], expected type int got %T", hotel["ID"])
-	} else {
-		if ID != 1 {
-			t.Errorf("ID was not what was expected, wanted 1 got %d", ID)
-		}
-	}
-
-	hotelsServerResp = `
-		{
-			"err": "foobar",
-			"hotel": null
-		}
-	`
-
-	hotelsTs = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		fmt.Fprint(w, hotelsServerResp)
-	}))
-	defer hotelsTs.Close()
-
-	HotelsServer = hotelsTs.URL
-
-	res = runQuery(query, variables, t)
-
-	if !res.HasErrors() {
-		t.Error("Expected errors with when hotels server sent error but got none")
-	}
-
-	query = `
-		query ($token: String!) {
-			auth(token: $token) {
-				booking(id: 1) {
 					room {
 						ID
+						name
 					}
 				}
 			}
-        }
-	`
-
-	roomsServerResp := `
-		{
-			"err": "",
-			"room": 
-			{
-				"ID": 1
-			}
 		}
 	`
-
-	roomsTs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		fmt.Fprint(w, roomsServerResp)
-	}))
-	defer roomsTs.Close()
-
-	RoomsServer = roomsTs.URL
-
-	res = runQuery(query, variables, t)
-
+	variables := map[string]interface{}{
+		"token": testToken(t),
+	}
+	res := runQuery(query, variables, t)
 	if res.HasErrors() {
 		t.Errorf("Errors given from query: %v", res.Errors)
 	}
-	data, isOk = res.Data.(map[string]interface{})
-	if !isOk {
-		t.Fatalf("Error getting data, expected type map[string]interface{} got %T", res.Data)
-	}
-	auth, isOk = data["auth"].(map[string]interface{})
-	if !isOk {
-		t.Fatalf("Error getting data[auth], expected type map[string]interface{} got %T", data["auth"])
-	}
-	booking, isOk = auth["booking"].(map[string]interface{})
-	if !isOk {
-		t.Fatalf("Error getting data[auth][booking], expected type map[string]interface{} got %T", auth["booking"])
+	expectField(t, res, "0x10", "auth", "booking", "ID")
+	expectField(t, res, "2006-01-02T15:04:05Z", "auth", "booking", "start")
+	expectField(t, res, "2006-01-03T15:04:05Z", "auth", "booking", "end")
+	expectField(t, res, "foobar", "auth", "booking", "hotel", "name")
+	expectField(t, res, "101", "auth", "booking", "room", "name")
+	if fake.token("/bookings/0x10") == "" {
+		t.Error("No JWT given to bookings server")
 	}
 
-	room, isOk := booking["room"].(map[string]interface{})
-	if !isOk {
-		t.Fatalf("Error getting data[auth][booking][room], expected type map[string]interface{} got %T", booking["hotel"])
-	}
-	ID, isOk = room["ID"].(int)
-	if !isOk {
-		t.Errorf("Error getting data[auth][booking][room][ID], expected type int got %T", room["ID"])
-	} else {
-		if ID != 1 {
-			t.Errorf("ID was not what was expected, wanted 1 got %d", ID)
-		}
+	fake.respond("GET /hotels/batch", http.StatusInternalServerError, `{"err": "foobar", "hotels": []}`)
+	res = runQuery(query, variables, t)
+	if !res.HasErrors() {
+		t.Error("Expected errors with when hotels server sent error but got none")
 	}
 
-	roomsServerResp = `
-		{
-			"err": "foobar",
-			"hotel": null
-		}
-	`
-
-	roomsTs = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		fmt.Fprint(w, roomsServerResp)
-	}))
-	defer roomsTs.Close()
-
-	RoomsServer = roomsTs.URL
-
+	fake.respond("GET /hotels/batch", http.StatusOK, `{"err": "", "hotels": [{"uid": "0x2", "name": "foobar"}]}`)
+	fake.respond("GET /rooms/batch", http.StatusInternalServerError, `{"err": "foobar", "rooms": []}`)
 	res = runQuery(query, variables, t)
-
 	if !res.HasErrors() {
-		t.Error("Expected errors with when roomss server sent error but got none")
+		t.Error("Expected errors with when rooms server sent error but got none")
 	}
 
-	bookingsServerResp = `
-		{
-			"err": "foobar",
-			"bookings": []
-		}
-	`
-
-	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		fmt.Fprint(w, bookingsServerResp)
-	}))
-	defer ts.Close()
-
+	fake.respond("GET /bookings/0x10", http.StatusNotFound, `{"err": "booking not found", "code": "NOT_FOUND"}`)
 	res = runQuery(query, variables, t)
 	if !res.HasErrors() {
 		t.Error("Expected errors with when bookings server sent error but got none")
@@ -500,224 +330,80 @@ func TestQueryBooking(t *testing.T) {
 }
 
 func TestQueryHotel(t *testing.T) {
+	fake, restore := useFakeServices(t)
+	defer restore()
+
+	fake.respond("GET /hotels/0x2", http.StatusOK, `{
+		"err": "",
+		"hotel": {
+			"uid": "0x2",
+			"checkIn": "1970-01-01T14:00:00Z",
+			"name": "foobar",
+			"address": "foobar",
+			"hasCarPark": true
+		}
+	}`)
+
 	query := `
 		query {
-			hotel(id: 1) {
+			hotel(id: "0x2") {
 				ID
 				name
 				address
 				hasCarPark
-				checkIn
-			}
-        }
-	`
-
-	hotelsServerResp := `
-		{
-			"err": "",
-			"hotel": 
-			{
-				"ID": 1,
-				"checkIn": "1970-01-01T14:00:00Z",
-				"name": "foobar",
-				"address": "foobar",
-				"hasCarPark": true
 			}
 		}
 	`
-
-	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		fmt.Fprint(w, hotelsServerResp)
-	}))
-	defer ts.Close()
-
-	HotelsServer = ts.URL
-
 	res := runQuery(query, nil, t)
-
 	if res.HasErrors() {
 		t.Errorf("Errors given from query: %v", res.Errors)
 	}
-	data, isOk := res.Data.(map[string]interface{})
-	if !isOk {
-		t.Fatalf("Error getting data, expected type map[string]interface{} got %T", res.Data)
-	}
-	hotel, isOk := data["hotel"].(map[string]interface{})
-	if !isOk {
-		t.Fatalf("Error getting data[hotel], expected type map[string]interface{} got %T", data["hotel"])
-	}
-	ID, isOk := hotel["ID"].(int)
-	if !isOk {
-		t.Errorf("Error getting data[hotel][ID], expected type int got %T", hotel["ID"])
-	} else {
-		if ID != 1 {
-			t.Errorf("ID was not what was expected, wanted 1 got %d", ID)
-		}
-	}
-	name, isOk := hotel["name"].(string)
-	if !isOk {
-		t.Errorf("Error getting data[hotel][name], expected type string got %T", hotel["name"])
-	} else {
-		if name != "foobar" {
-			t.Errorf("ID was not what was expected, wanted foobar got %s", name)
-		}
-	}
-	address, isOk := hotel["address"].(string)
-	if !isOk {
-		t.Errorf("Error getting data[hotel][address], expected type string got %T", hotel["address"])
-	} else {
-		if address != "foobar" {
-			t.Errorf("ID was not what was expected, wanted foobar got %s", address)
-		}
-	}
-	checkIn, isOk := hotel["checkIn"].(string)
-	if !isOk {
-		t.Errorf("Error getting data[hotel][checkIn], expected type string got %T", hotel["checkIn"])
-	} else {
-		if checkIn != "1970-01-01T14:00:00Z" {
-			t.Errorf("ID was not what was expected, wanted foobar got %s", checkIn)
-		}
-	}
-
-	hotelsServerResp = `
-		{
-			"err": "",
-			"hotel": {
-				"checkIn": "bla"
-			}
-		}
-	`
-
-	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		fmt.Fprint(w, hotelsServerResp)
-	}))
-	defer ts.Close()
-
-	HotelsServer = ts.URL
-
-	res = runQuery(query, map[string]interface{}{}, t)
-
-	if !res.HasErrors() {
-		t.Errorf("Errors expected from query but none given")
-	}
-	data, isOk = res.Data.(map[string]interface{})
-	if !isOk {
-		t.Fatalf("Error getting data, expected type map[string]interface{} got %T", res.Data)
-	}
-	hotel, isOk = data["hotel"].(map[string]interface{})
-	if !isOk {
-		t.Fatalf("Error getting data[hotel], expected type map[string]interface{} got %T", data["hotel"])
-	}
-	ID, isOk = hotel["ID"].(int)
-	if isOk {
-		t.Errorf("Error getting data[hotel][ID], expected type <nil> got %T", hotel["ID"])
-	}
-	name, isOk = hotel["name"].(string)
-	if isOk {
-		t.Errorf("Error getting data[hotel][name], expected type <nil> got %T", hotel["name"])
-	}
-	address, isOk = hotel["address"].(string)
-	if isOk {
-		t.Errorf("Error getting data[hotel][address], expected type <nil> got %T", hotel["address"])
-	}
-	checkIn, isOk = hotel["checkIn"].(string)
-	if isOk {
-		t.Errorf("Error getting data[hotel][checkIn], expected type <nil> got %T", hotel["checkIn"])
-	}
-
-	hotelsServerResp = `
-		{
-			"err": "foobar",
-			"hotel": {}
-		}
-	`
-
-	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		fmt.Fprint(w, hotelsServerResp)
-	}))
-	defer ts.Close()
-
-	HotelsServer = ts.URL
+	expectField(t, res, "0x2", "hotel", "ID")
+	expectField(t, res, "foobar", "hotel", "name")
+	expectField(t, res, "foobar", "hotel", "address")
+	expectField(t, res, true, "hotel", "hasCarPark")
 
+	fake.respond("GET /hotels/0x2", http.StatusInternalServerError, `{"err": "foobar", "hotel": null}`)
 	res = runQuery(query, nil, t)
-
 	if !res.HasErrors() {
-		t.Error("No errors given when error returned from hotels server")
+		t.Error("Expected errors with when hotels server sent error but got none")
 	}
-
 }
 
 func TestQueryHotels(t *testing.T) {
-	hotelsServerResp := `
-		{
-			"err": "",
-			"hotels": [
-				{
-					"ID": 1
-				}
-			]
-		}
-	`
-	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		fmt.Fprint(w, hotelsServerResp)
-	}))
-	defer ts.Close()
+	fake, restore := useFakeServices(t)
+	defer restore()
 
-	HotelsServer = ts.URL
+	fake.respond("GET /hotels", http.StatusOK, `{
+		"err": "",
+		"hotels": [{"uid": "0x2", "name": "foobar"}, {"uid": "0x4", "name": "bar"}],
+		"pageInfo": {"hasNextPage": true, "endCursor": "Y3Vyc29yOjB4NA=="}
+	}`)
 
 	query := `
 		query {
-			hotels {
-				ID
+			hotels(first: 2) {
+				edges {
+					node {
+						ID
+						name
+					}
+				}
+				pageInfo {
+					hasNextPage
+				}
 			}
-        }
+		}
 	`
 	res := runQuery(query, nil, t)
-
 	if res.HasErrors() {
 		t.Errorf("Errors given from query: %v", res.Errors)
 	}
+	expectField(t, res, "0x2", "hotels", "edges", 0, "node", "ID")
+	expectField(t, res, "bar", "hotels", "edges", 1, "node", "name")
+	expectField(t, res, true, "hotels", "pageInfo", "hasNextPage")
 
-	data, isOk := res.Data.(map[string]interface{})
-	if !isOk {
-		t.Fatalf("Error getting data, expected type map[string]interface{} got %T", res.Data)
-	}
-	hotels, isOk := data["hotels"].([]interface{})
-	if !isOk {
-		t.Fatalf("Error getting data[hotels], expected type []interface{} got %T", data["hotels"])
-	}
-
-	if len(hotels) != 1 {
-		t.Fatalf("Didn't get right length of hotels, expected 1 got %d", len(hotels))
-	}
-	hotel, isOk := hotels[0].(map[string]interface{})
-	if !isOk {
-		t.Fatalf("Error getting data[hotels[0], expected type map[string]interface{} got %T", hotels[0])
-	}
-
-	ID, isOk := hotel["ID"].(int)
-	if !isOk {
-		t.Errorf("Error getting data[hotels][0][ID], expected type int got %T", hotel["ID"])
-	} else {
-		if ID != 1 {
-			t.Errorf("ID was not what was expected, wanted 1 got %d", ID)
-		}
-	}
-
-	hotelsServerResp = `
-		{
-			"err": "foobar",
-			"hotels": []
-		}
-	`
-
-	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		fmt.Fprint(w, hotelsServerResp)
-	}))
-	defer ts.Close()
-
-	BookingsServer = ts.URL
-
+	fake.respond("GET /hotels", http.StatusInternalServerError, `{"err": "foobar", "hotels": []}`)
 	res = runQuery(query, nil, t)
 	if !res.HasErrors() {
 		t.Error("Expected errors with when hotels server sent error but got none")
@@ -725,297 +411,78 @@ func TestQueryHotels(t *testing.T) {
 }
 
 func TestQueryRoom(t *testing.T) {
+	fake, restore := useFakeServices(t)
+	defer restore()
+
+	fake.respond("GET /rooms/0x3", http.StatusOK, `{
+		"err": "",
+		"room": {"uid": "0x3", "name": "101", "floor": "1", "hotelId": "0x2"}
+	}`)
+	fake.respond("GET /hotels/batch", http.StatusOK, `{"err": "", "hotels": [{"uid": "0x2", "name": "foobar"}]}`)
+
 	query := `
 		query {
-			room(id: 1) {
+			room(id: "0x3") {
 				ID
 				name
 				floor
-			}
-        }
-	`
-
-	roomsServerResp := `
-		{
-			"err": "",
-			"room": 
-			{
-				"ID": 1,
-				"name": "foobar",
-				"floor": "foobar"
-			}
-		}
-	`
-
-	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		fmt.Fprint(w, roomsServerResp)
-	}))
-	defer ts.Close()
-
-	RoomsServer = ts.URL
-
-	res := runQuery(query, nil, t)
-
-	if res.HasErrors() {
-		t.Errorf("Errors given from query: %v", res.Errors)
-	}
-	data, isOk := res.Data.(map[string]interface{})
-	if !isOk {
-		t.Fatalf("Error getting data, expected type map[string]interface{} got %T", res.Data)
-	}
-	room, isOk := data["room"].(map[string]interface{})
-	if !isOk {
-		t.Fatalf("Error getting data[room], expected type map[string]interface{} got %T", data["room"])
-	}
-	ID, isOk := room["ID"].(int)
-	if !isOk {
-		t.Errorf("Error getting data[room][ID], expected type int got %T", room["ID"])
-	} else {
-		if ID != 1 {
-			t.Errorf("ID was not what was expected, wanted 1 got %d", ID)
-		}
-	}
-	name, isOk := room["name"].(string)
-	if !isOk {
-		t.Errorf("Error getting data[room][name], expected type string got %T", room["name"])
-	} else {
-		if name != "foobar" {
-			t.Errorf("ID was not what was expected, wanted foobar got %s", name)
-		}
-	}
-	floor, isOk := room["floor"].(string)
-	if !isOk {
-		t.Errorf("Error getting data[room][floor], expected type string got %T", room["floor"])
-	} else {
-		if floor != "foobar" {
-			t.Errorf("ID was not what was expected, wanted foobar got %s", floor)
-		}
-	}
-
-	roomsServerResp = `
-		{
-			"err": "",
-			"room": {}
-		}
-	`
-
-	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		fmt.Fprint(w, roomsServerResp)
-	}))
-	defer ts.Close()
-
-	RoomsServer = ts.URL
-
-	res = runQuery(query, map[string]interface{}{}, t)
-
-	if res.HasErrors() {
-		t.Errorf("Errors given from query: %v", res.Errors)
-	}
-	data, isOk = res.Data.(map[string]interface{})
-	if !isOk {
-		t.Fatalf("Error getting data, expected type map[string]interface{} got %T", res.Data)
-	}
-	room, isOk = data["room"].(map[string]interface{})
-	if !isOk {
-		t.Fatalf("Error getting data[room], expected type map[string]interface{} got %T", data["room"])
-	}
-	ID, isOk = room["ID"].(int)
-	if isOk {
-		t.Errorf("Error getting data[room][ID], expected type <nil> got %T", room["ID"])
-	}
-	name, isOk = room["name"].(string)
-	if isOk {
-		t.Errorf("Error getting data[room][name], expected type <nil> got %T", room["name"])
-	}
-	floor, isOk = room["floor"].(string)
-	if isOk {
-		t.Errorf("Error getting data[room][floor], expected type <nil> got %T", room["floor"])
-	}
-
-	query = `
-		query {
-			room(id: 1) {
 				hotel {
-					ID
+					name
 				}
 			}
-        }
-	`
-
-	roomsServerResp = `
-		{
-			"err": "",
-			"room": 
-			{
-				"hotelId": 1
-			}
-		}
-	`
-
-	hotelsServerResp := `
-		{
-			"err": "",
-			"hotel": 
-			{
-				"ID": 1
-			}
 		}
 	`
-
-	hotelsTs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		fmt.Fprint(w, hotelsServerResp)
-	}))
-	defer hotelsTs.Close()
-
-	HotelsServer = hotelsTs.URL
-
-	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		fmt.Fprint(w, roomsServerResp)
-	}))
-	defer ts.Close()
-
-	RoomsServer = ts.URL
-
-	res = runQuery(query, nil, t)
-
+	res := runQuery(query, nil, t)
 	if res.HasErrors() {
 		t.Errorf("Errors given from query: %v", res.Errors)
 	}
-	data, isOk = res.Data.(map[string]interface{})
-	if !isOk {
-		t.Fatalf("Error getting data, expected type map[string]interface{} got %T", res.Data)
-	}
-	room, isOk = data["room"].(map[string]interface{})
-	if !isOk {
-		t.Fatalf("Error getting data[room], expected type map[string]interface{} got %T", data["room"])
-	}
-
-	hotel, isOk := room["hotel"].(map[string]interface{})
-	if !isOk {
-		t.Fatalf("Error getting data[room][hotel], expected type map[string]interface{} got %T", room["hotel"])
-	}
-	ID, isOk = hotel["ID"].(int)
-	if !isOk {
-		t.Errorf("Error getting data[room][hotel][ID], expected type int got %T", hotel["ID"])
-	} else {
-		if ID != 1 {
-			t.Errorf("ID was not what was expected, wanted 1 got %d", ID)
-		}
-	}
-
-	hotelsServerResp = `
-		{
-			"err": "foobar",
-			"hotel": null
-		}
-	`
-
-	hotelsTs = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		fmt.Fprint(w, hotelsServerResp)
-	}))
-	defer hotelsTs.Close()
-
-	HotelsServer = hotelsTs.URL
+	expectField(t, res, "0x3", "room", "ID")
+	expectField(t, res, "101", "room", "name")
+	expectField(t, res, "1", "room", "floor")
+	expectField(t, res, "foobar", "room", "hotel", "name")
 
+	fake.respond("GET /hotels/batch", http.StatusInternalServerError, `{"err": "foobar", "hotels": []}`)
 	res = runQuery(query, nil, t)
-
 	if !res.HasErrors() {
 		t.Error("Expected errors with when hotels server sent error but got none")
 	}
 
-	roomsServerResp = `
-		{
-			"err": "foobar",
-			"room": {}
-		}
-	`
-
-	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		fmt.Fprint(w, roomsServerResp)
-	}))
-	defer ts.Close()
-
-	RoomsServer = ts.URL
-
+	fake.respond("GET /rooms/0x3", http.StatusInternalServerError, `{"err": "foobar", "room": null}`)
 	res = runQuery(query, nil, t)
-
 	if !res.HasErrors() {
-		t.Error("No errors given when error returned from rooms server")
+		t.Error("Expected errors with when rooms server sent error but got none")
 	}
-
 }
 
 func TestQueryRooms(t *testing.T) {
-	roomsServerResp := `
-		{
-			"err": "",
-			"rooms": [
-				{
-					"ID": 1
-				}
-			]
-		}
-	`
-	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		fmt.Fprint(w, roomsServerResp)
-	}))
-	defer ts.Close()
+	fake, restore := useFakeServices(t)
+	defer restore()
 
-	RoomsServer = ts.URL
+	fake.respond("GET /rooms", http.StatusOK, `{
+		"err": "",
+		"rooms": [{"uid": "0x3", "name": "101"}],
+		"pageInfo": {"hasNextPage": false}
+	}`)
 
 	query := `
 		query {
 			rooms {
-				ID
+				edges {
+					node {
+						ID
+						name
+					}
+				}
 			}
-        }
+		}
 	`
 	res := runQuery(query, nil, t)
-
 	if res.HasErrors() {
 		t.Errorf("Errors given from query: %v", res.Errors)
 	}
+	expectField(t, res, "101", "rooms", "edges", 0, "node", "name")
 
-	data, isOk := res.Data.(map[string]interface{})
-	if !isOk {
-		t.Fatalf("Error getting data, expected type map[string]interface{} got %T", res.Data)
-	}
-	rooms, isOk := data["rooms"].([]interface{})
-	if !isOk {
-		t.Fatalf("Error getting data[rooms], expected type []interface{} got %T", data["rooms"])
-	}
-
-	if len(rooms) != 1 {
-		t.Fatalf("Didn't get right length of rooms, expected 1 got %d", len(rooms))
-	}
-	room, isOk := rooms[0].(map[string]interface{})
-	if !isOk {
-		t.Fatalf("Error getting data[rooms[0], expected type map[string]interface{} got %T", rooms[0])
-	}
-
-	ID, isOk := room["ID"].(int)
-	if !isOk {
-		t.Errorf("Error getting data[rooms][0][ID], expected type int got %T", room["ID"])
-	} else {
-		if ID != 1 {
-			t.Errorf("ID was not what was expected, wanted 1 got %d", ID)
-		}
-	}
-
-	roomsServerResp = `
-		{
-			"err": "foobar",
-			"rooms": []
-		}
-	`
-
-	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		fmt.Fprint(w, roomsServerResp)
-	}))
-	defer ts.Close()
-
-	RoomsServer = ts.URL
-
+	fake.respond("GET /rooms", http.StatusInternalServerError, `{"err": "foobar", "rooms": []}`)
 	res = runQuery(query, nil, t)
 	if !res.HasErrors() {
 		t.Error("Expected errors with when rooms server sent error but got none")
@@ -1023,179 +490,131 @@ func TestQueryRooms(t *testing.T) {
 }
 
 func TestOpenRoom(t *testing.T) {
-	user := &utils.User{
-		Name:  "Bob",
-		Email: "foo@bar.com",
-		Model: gorm.Model{
-			ID: 1,
-		},
-	}
-
-	roomsServerResp := `
-		{
-			"err": "",
-			"success": true
-		}
-	`
-
-	jwt, err := utils.NewJWT(user)
-	if err != nil {
-		t.Fatalf("Error creating JWT: %v", err)
-	}
-
-	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ") == "" {
-			t.Errorf("No JWT given to rooms server, got %s",
-				strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "))
-		}
-		fmt.Fprint(w, roomsServerResp)
-	}))
-	defer ts.Close()
-
-	RoomsServer = ts.URL
+	fake, restore := useFakeServices(t)
+	defer restore()
+
+	start := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+	end := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	fake.respond("GET /userInfo", http.StatusOK, userInfoResp)
+	fake.respond("GET /bookings/by-room/0x3", http.StatusOK, `{
+		"err": "",
+		"bookings": [{"uid": "0x10", "userId": "0x1", "hotelId": "0x2", "roomId": "0x3", "status": "checked_in", "start": "`+start+`", "end": "`+end+`"}]
+	}`)
+	fake.respond("GET /hotels/0x2", http.StatusOK, `{"err": "", "hotel": {"uid": "0x2"}}`)
+	fake.respond("GET /hotels/0x2/emergency", http.StatusOK, `{"err": "", "state": {"hotelId": "0x2", "mode": "normal"}}`)
+	fake.respond("GET /hotels/0x2/status", http.StatusOK, `{"err": "", "status": {"hotelId": "0x2", "online": true}}`)
+	fake.respond("GET /rooms/0x3/open", http.StatusOK, `{"err": "", "success": true}`)
 
 	query := `
 		mutation ($token: String!) {
 			auth(token: $token) {
-				openRoom(id: 1)
+				openRoom(id: "0x3")
 			}
-        }
+		}
 	`
 	variables := map[string]interface{}{
-		"token": jwt,
+		"token": testToken(t),
 	}
 	res := runQuery(query, variables, t)
-
 	if res.HasErrors() {
 		t.Errorf("Errors given from query: %v", res.Errors)
 	}
+	expectField(t, res, true, "auth", "openRoom")
+	fake.expectServiceToken(t, "/hotels/0x2/status")
 
-	data, isOk := res.Data.(map[string]interface{})
-	if !isOk {
-		t.Fatalf("Error getting data, expected type map[string]interface{} got %T", res.Data)
-	}
-	auth, isOk := data["auth"].(map[string]interface{})
-	if !isOk {
-		t.Fatalf("Error getting data[auth], expected type map[string]interface{} got %T", data["auth"])
-	}
-
-	openRoom, isOk := auth["openRoom"].(bool)
-	if !isOk {
-		t.Errorf("Error getting data[auth][openRoom], expected type bool got %T", auth["openRoom"])
-	} else {
-		if openRoom != true {
-			t.Errorf("Success value was not what was expected, wanted true got %t", openRoom)
-		}
+	fake.respond("GET /hotels/0x2/emergency", http.StatusOK, `{"err": "", "state": {"hotelId": "0x2", "mode": "lockdown"}}`)
+	res = runQuery(query, variables, t)
+	if !res.HasErrors() {
+		t.Error("Expected errors opening a room in a hotel in lockdown but got none")
 	}
 
-	roomsServerResp = `
-		{
-			"err": "foobar",
-			"success": false
-		}
-	`
-
-	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ") == "" {
-			t.Errorf("No JWT given to rooms server, got %s",
-				strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "))
-		}
-		fmt.Fprint(w, roomsServerResp)
-	}))
-	defer ts.Close()
-
-	RoomsServer = ts.URL
-
+	fake.respond("GET /hotels/0x2/emergency", http.StatusOK, `{"err": "", "state": {"hotelId": "0x2", "mode": "normal"}}`)
+	fake.respond("GET /rooms/0x3/open", http.StatusInternalServerError, `{"err": "foobar", "success": false}`)
 	res = runQuery(query, variables, t)
 	if !res.HasErrors() {
 		t.Error("Expected errors with when rooms server sent error but got none")
 	}
 }
 
-func TestOpenHotel(t *testing.T) {
-	user := &utils.User{
-		Name:  "Bob",
-		Email: "foo@bar.com",
-		Model: gorm.Model{
-			ID: 1,
-		},
-	}
+func TestDigitalKey(t *testing.T) {
+	fake, restore := useFakeServices(t)
+	defer restore()
 
-	hotelsServerResp := `
-		{
-			"err": "",
-			"success": true
+	start := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+	end := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	fake.respond("GET /userInfo", http.StatusOK, userInfoResp)
+	fake.respond("GET /bookings/0x10", http.StatusOK, `{
+		"err": "",
+		"booking": {"uid": "0x10", "userId": "0x1", "hotelId": "0x2", "roomId": "0x3", "status": "checked_in", "start": "`+start+`", "end": "`+end.Format(time.RFC3339)+`"}
+	}`)
+	fake.respond("GET /hotels/0x2/emergency", http.StatusOK, `{"err": "", "state": {"hotelId": "0x2", "mode": "lockdown"}}`)
+
+	query := `
+		mutation ($token: String!) {
+			auth(token: $token) {
+				digitalKey(bookingId: "0x10") {
+					credentialId
+				}
+			}
 		}
 	`
+	variables := map[string]interface{}{
+		"token": testToken(t),
+	}
+	res := runQuery(query, variables, t)
+	if !res.HasErrors() {
+		t.Error("Expected errors getting a key for a hotel in lockdown but got none")
+	}
+	fake.mu.Lock()
+	for _, r := range fake.requests {
+		if r.URL.Path == "/credentials" {
+			t.Error("Expected no key to be issued in a lockdown")
+		}
+	}
+	fake.mu.Unlock()
 
-	jwt, err := utils.NewJWT(user)
-	if err != nil {
-		t.Fatalf("Error creating JWT: %v", err)
+	fake.respond("GET /hotels/0x2/emergency", http.StatusOK, `{"err": "", "state": {"hotelId": "0x2", "mode": "normal"}}`)
+	fake.respond("GET /rooms/0x3", http.StatusOK, `{"err": "", "room": {"uid": "0x3", "hotelId": "0x2"}}`)
+	fake.respond("GET /doors/by-hotel/0x2", http.StatusOK, `{"err": "", "doors": []}`)
+	fake.respond("GET /hotels/0x2", http.StatusOK, `{"err": "", "hotel": {"uid": "0x2"}}`)
+	fake.respond("POST /credentials", http.StatusOK, `{"err": "", "credentialId": "0x20", "credential": "AQI=", "notAfter": "`+end.Format(time.RFC3339)+`"}`)
+	res = runQuery(query, variables, t)
+	if res.HasErrors() {
+		t.Errorf("Errors given from query: %v", res.Errors)
 	}
+	expectField(t, res, "0x20", "auth", "digitalKey", "credentialId")
+	fake.expectServiceToken(t, "/credentials")
+}
 
-	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ") == "" {
-			t.Errorf("No JWT given to hotels server, got %s",
-				strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "))
-		}
-		fmt.Fprint(w, hotelsServerResp)
-	}))
-	defer ts.Close()
+func TestOpenHotel(t *testing.T) {
+	fake, restore := useFakeServices(t)
+	defer restore()
 
-	HotelsServer = ts.URL
+	fake.respond("GET /userInfo", http.StatusOK, userInfoResp)
+	fake.respond("GET /hotels/0x2/emergency", http.StatusOK, `{"err": "", "state": {"hotelId": "0x2", "mode": "normal"}}`)
+	fake.respond("GET /hotels/0x2/status", http.StatusOK, `{"err": "", "status": {"hotelId": "0x2", "online": true}}`)
+	fake.respond("GET /hotels/0x2/open", http.StatusOK, `{"err": "", "success": true}`)
 
 	query := `
 		mutation ($token: String!) {
 			auth(token: $token) {
-				openHotelDoor(id: 1)
+				openHotelDoor(id: "0x2")
 			}
-        }
+		}
 	`
 	variables := map[string]interface{}{
-		"token": jwt,
+		"token": testToken(t),
 	}
 	res := runQuery(query, variables, t)
-
 	if res.HasErrors() {
 		t.Errorf("Errors given from query: %v", res.Errors)
 	}
-
-	data, isOk := res.Data.(map[string]interface{})
-	if !isOk {
-		t.Fatalf("Error getting data, expected type map[string]interface{} got %T", res.Data)
-	}
-	auth, isOk := data["auth"].(map[string]interface{})
-	if !isOk {
-		t.Fatalf("Error getting data[auth], expected type map[string]interface{} got %T", data["auth"])
+	expectField(t, res, true, "auth", "openHotelDoor")
+	if fake.token("/hotels/0x2/open") == "" {
+		t.Error("No JWT given to hotels server")
 	}
 
-	openHotelDoor, isOk := auth["openHotelDoor"].(bool)
-	if !isOk {
-		t.Errorf("Error getting data[auth][openHotelDoor], expected type bool got %T", auth["openHotelDoor"])
-	} else {
-		if openHotelDoor != true {
-			t.Errorf("Success value was not what was expected, wanted true got %t", openHotelDoor)
-		}
-	}
-
-	hotelsServerResp = `
-		{
-			"err": "foobar",
-			"success": false
-		}
-	`
-
-	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ") == "" {
-			t.Errorf("No JWT given to hotels server, got %s",
-				strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "))
-		}
-		fmt.Fprint(w, hotelsServerResp)
-	}))
-	defer ts.Close()
-
-	HotelsServer = ts.URL
-
+	fake.respond("GET /hotels/0x2/open", http.StatusInternalServerError, `{"err": "foobar", "success": false}`)
 	res = runQuery(query, variables, t)
 	if !res.HasErrors() {
 		t.Error("Expected errors with when hotels server sent error but got none")
@@ -1203,65 +622,25 @@ func TestOpenHotel(t *testing.T) {
 }
 
 func TestLogin(t *testing.T) {
-	authServerResp := `
-		{
-			"err": "",
-			"jwt": "foobar"
-		}
-	`
-
-	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		fmt.Fprint(w, authServerResp)
-	}))
-	defer ts.Close()
+	fake, restore := useFakeServices(t)
+	defer restore()
 
-	AuthServer = ts.URL
+	fake.respond("POST /login", http.StatusOK, `{"err": "", "jwt": "token"}`)
 
 	query := `
-		mutation ($email: String!, $pass: String!) {
-			loginUser(email: $email, pass: $pass)
-        }
+		mutation {
+			loginUser(email: "foo@bar.com", pass: "bar")
+		}
 	`
-	variables := map[string]interface{}{
-		"email": "foo@bar.com",
-		"pass": "foobar",
-	}
-	res := runQuery(query, variables, t)
-
+	res := runQuery(query, nil, t)
 	if res.HasErrors() {
 		t.Errorf("Errors given from query: %v", res.Errors)
 	}
+	expectField(t, res, "token", "loginUser")
 
-	data, isOk := res.Data.(map[string]interface{})
-	if !isOk {
-		t.Fatalf("Error getting data, expected type map[string]interface{} got %T", res.Data)
-	}
-
-	loginUser, isOk := data["loginUser"].(string)
-	if !isOk {
-		t.Errorf("Error getting data[loginUser], expected type bool got %T", data["loginUser"])
-	} else {
-		if loginUser != "foobar" {
-			t.Errorf("JWT was not what was expected, wanted foobar got %s", loginUser)
-		}
-	}
-
-	authServerResp = `
-		{
-			"err": "foobar",
-			"jwt": null
-		}
-	`
-
-	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		fmt.Fprint(w, authServerResp)
-	}))
-	defer ts.Close()
-
-	AuthServer = ts.URL
-
-	res = runQuery(query, variables, t)
+	fake.respond("POST /login", http.StatusUnauthorized, `{"err": "wrong password", "code": "UNAUTHENTICATED"}`)
+	res = runQuery(query, nil, t)
 	if !res.HasErrors() {
 		t.Error("Expected errors with when auth server sent error but got none")
 	}
-}
\ No newline at end of file
+}
@@ -2,12 +2,9 @@ package main
 
 import (
 	"github.com/graphql-go/graphql"
+	"github.com/fluidmediaproductions/central_hotel_door_server/clients"
 	"github.com/fluidmediaproductions/central_hotel_door_server/utils"
-	"net/http"
-	"bytes"
-	"fmt"
-	"encoding/json"
-	"errors"
+	"time"
 )
 
 var authedMutation = graphql.NewObject(graphql.ObjectConfig{
@@ -25,40 +22,11 @@ var authedMutation = graphql.NewObject(graphql.ObjectConfig{
 				if isOK {
 					user, isOk := params.Source.(*utils.User)
 					if isOk {
-						data := map[string]interface{}{
-							"pass": pass,
-						}
-						dataBytes, err := json.Marshal(data)
-						if err != nil {
-							return nil, err
-						}
-
-						req, err := http.NewRequest("POST", AuthServer+"/changePassword", bytes.NewBuffer(dataBytes))
-						if err != nil {
-							return nil, err
-						}
-
-						jwt, err := utils.NewJWT(user, jwtSecret)
-						if err != nil {
-							return nil, err
-						}
-						req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", jwt))
-
-						resp, err := utils.GetJson(req)
+						jwt, err := userToken(user)
 						if err != nil {
 							return nil, err
 						}
-						respErr, isOk := resp["err"].(string)
-						if isOk {
-							if respErr != "" {
-								return nil, errors.New(respErr)
-							}
-						}
-
-						success, isOk := resp["success"].(bool)
-						if isOk {
-							return success, nil
-						}
+						return authClient.ChangePassword(requestContext(params), jwt, pass)
 					}
 				}
 				return nil, nil
@@ -77,48 +45,22 @@ var authedMutation = graphql.NewObject(graphql.ObjectConfig{
 			Resolve: func(params graphql.ResolveParams) (interface{}, error) {
 				user, isOk := params.Source.(*utils.User)
 				if isOk {
-					data := map[string]interface{}{}
+					update := &clients.UserUpdate{}
 
 					email, isOK := params.Args["email"].(string)
 					if isOK {
-						data["email"] = email
+						update.Email = email
 					}
 					name, isOK := params.Args["name"].(string)
 					if isOK {
-						data["name"] = name
-					}
-
-					dataBytes, err := json.Marshal(data)
-					if err != nil {
-						return nil, err
+						update.Name = name
 					}
 
-					req, err := http.NewRequest("POST", AuthServer+"/updateUser", bytes.NewBuffer(dataBytes))
+					jwt, err := userToken(user)
 					if err != nil {
 						return nil, err
 					}
-
-					jwt, err := utils.NewJWT(user, jwtSecret)
-					if err != nil {
-						return nil, err
-					}
-					req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", jwt))
-
-					resp, err := utils.GetJson(req)
-					if err != nil {
-						return nil, err
-					}
-					respErr, isOk := resp["err"].(string)
-					if isOk {
-						if respErr != "" {
-							return nil, errors.New(respErr)
-						}
-					}
-
-					success, isOk := resp["success"].(bool)
-					if isOk {
-						return success, nil
-					}
+					return authClient.UpdateUser(requestContext(params), jwt, update)
 				}
 				return nil, nil
 			},
@@ -136,51 +78,104 @@ var authedMutation = graphql.NewObject(graphql.ObjectConfig{
 				if isOK {
 					user, isOk := params.Source.(*utils.User)
 					if isOk {
-						req, err := http.NewRequest("GET", BookingsServer+fmt.Sprintf("/bookings/by-room/%s", id), nil)
+						ctx := requestContext(params)
+
+						jwt, err := userToken(user)
 						if err != nil {
 							return nil, err
 						}
-
-						jwt, err := utils.NewJWT(user, jwtSecret)
+						bookings, err := bookingsClient.GetBookingsByRoom(ctx, jwt, id)
 						if err != nil {
 							return nil, err
 						}
-						req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", jwt))
 
-						resp, err := utils.GetJson(req)
+						now := time.Now()
+						booking := findCurrentBooking(bookings, now)
+						if booking == nil {
+							return openRoomOnShift(ctx, user, id, now)
+						}
+						hotel, err := hotelsClient.GetHotel(ctx, booking.HotelID)
 						if err != nil {
 							return nil, err
 						}
-						respErr, isOk := resp["err"].(string)
-						if isOk {
-							if respErr != "" {
-								return nil, errors.New(respErr)
-							}
+						if now.Before(roomAccessFrom(booking, hotel)) {
+							return nil, newCodedError(utils.CodeBookingNotActive, "check-in hasn't opened yet")
+						}
+						err = checkCanUnlock(ctx, booking.HotelID)
+						if err != nil {
+							return nil, err
 						}
 
-						_, isOk = resp["booking"].(map[string]interface{})
-						if isOk {
-							req, err := http.NewRequest("GET", RoomsServer+fmt.Sprintf("/rooms/%s/open", id), nil)
-							if err != nil {
-								return nil, err
-							}
+						return roomsClient.OpenRoom(ctx, id, &clients.OpenRoomParams{
+							UserID:    user.ID,
+							BookingID: booking.ID,
+							GuestID:   booking.GuestID,
+						})
+					}
+				}
+				return nil, nil
+			},
+		},
+		"openDoor": &graphql.Field{
+			Type: graphql.Boolean,
+			Args: graphql.FieldConfigArgument{
+				"doorId": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+			},
+			Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+				id, isOK := params.Args["doorId"].(string)
+				if isOK {
+					user, isOk := params.Source.(*utils.User)
+					if isOk {
+						ctx := requestContext(params)
 
-							resp, err := utils.GetJson(req)
-							if err != nil {
-								return nil, err
-							}
-							respErr, isOk := resp["err"].(string)
-							if isOk {
-								if respErr != "" {
-									return nil, errors.New(respErr)
-								}
-							}
+						d, err := hotelsClient.GetDoor(ctx, id)
+						if err != nil {
+							return nil, err
+						}
+						if d == nil {
+							return nil, newCodedError(utils.CodeNotFound, "door not found")
+						}
 
-							success, isOk := resp["success"].(bool)
-							if isOk {
-								return success, nil
-							}
+						allowed, err := canOpenDoor(ctx, user, d, time.Now())
+						if err != nil {
+							return nil, err
+						}
+						if !allowed {
+							return nil, newCodedError(utils.CodeForbidden, "no access to door")
+						}
+						err = checkCanUnlock(ctx, d.HotelID)
+						if err != nil {
+							return nil, err
 						}
+
+						return hotelsClient.OpenDoor(ctx, d.ID)
+					}
+				}
+				return nil, nil
+			},
+		},
+		"bookRoom": bookRoomMutation,
+		"inviteGuest": inviteGuestMutation,
+		"revokeGuest": revokeGuestMutation,
+		"acceptGuestInvite": acceptGuestInviteMutation,
+		"checkIn": checkInMutation,
+		"checkOut": checkOutMutation,
+		"cancelBooking": bookingStatusMutation(clients.BookingCancelled),
+		"digitalKey": &graphql.Field{
+			Type: digitalKeyType,
+			Args: graphql.FieldConfigArgument{
+				"bookingId": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+			},
+			Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+				id, isOK := params.Args["bookingId"].(string)
+				if isOK {
+					user, isOk := params.Source.(*utils.User)
+					if isOk {
+						return issueDigitalKey(requestContext(params), user, id)
 					}
 				}
 				return nil, nil
@@ -198,32 +193,18 @@ var authedMutation = graphql.NewObject(graphql.ObjectConfig{
 				if isOK {
 					user, isOk := params.Source.(*utils.User)
 					if isOk {
-						req, err := http.NewRequest("GET", HotelsServer+fmt.Sprintf("/hotels/%s/open", id), nil)
-						if err != nil {
-							return nil, err
-						}
+						ctx := requestContext(params)
 
-						jwt, err := utils.NewJWT(user, jwtSecret)
+						err := checkCanUnlock(ctx, id)
 						if err != nil {
 							return nil, err
 						}
-						req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", jwt))
 
-						resp, err := utils.GetJson(req)
+						jwt, err := userToken(user)
 						if err != nil {
 							return nil, err
 						}
-						respErr, isOk := resp["err"].(string)
-						if isOk {
-							if respErr != "" {
-								return nil, errors.New(respErr)
-							}
-						}
-
-						success, isOk := resp["success"].(bool)
-						if isOk {
-							return success, nil
-						}
+						return hotelsClient.OpenHotel(ctx, jwt, id)
 					}
 				}
 				return nil, nil
@@ -250,32 +231,7 @@ var rootMutation = graphql.NewObject(graphql.ObjectConfig{
 				if isOK {
 					pass, isOK := params.Args["pass"].(string)
 					if isOK {
-						data := map[string]interface{}{
-							"email": email,
-							"pass":  pass,
-						}
-						dataBytes, err := json.Marshal(data)
-						if err != nil {
-							return nil, err
-						}
-						req, err := http.NewRequest("POST", AuthServer+"/login", bytes.NewBuffer(dataBytes))
-						if err != nil {
-							return nil, err
-						}
-						resp, err := utils.GetJson(req)
-						if err != nil {
-							return nil, err
-						}
-						respErr, isOk := resp["err"].(string)
-						if isOk {
-							if respErr != "" {
-								return nil, errors.New(respErr)
-							}
-						}
-						jwt, isOk := resp["jwt"].(string)
-						if isOk {
-							return jwt, nil
-						}
+						return authClient.Login(requestContext(params), email, pass)
 					}
 				}
 				return nil, nil
@@ -291,11 +247,18 @@ var rootMutation = graphql.NewObject(graphql.ObjectConfig{
 			Resolve: func(params graphql.ResolveParams) (interface{}, error) {
 				token, isOK := params.Args["token"].(string)
 				if isOK {
-					claims, err := utils.VerifyJWT(token, jwtSecret)
+					user, err := getUser(requestContext(params), token)
 					if err != nil {
-						return nil, err
+						if clients.ErrorCode(err) != utils.CodePasswordReset || !onlyChangingPassword(params) {
+							return nil, err
+						}
+						claims, err := utils.VerifyJWT(token, jwtSecret)
+						if err != nil {
+							return nil, errNotAuthenticated
+						}
+						return claims.User, nil
 					}
-					return claims.User, nil
+					return user, nil
 				}
 				return nil, nil
 			},
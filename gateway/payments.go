@@ -0,0 +1,91 @@
+package main
+
+import (
+	"time"
+
+	"github.com/fluidmediaproductions/central_hotel_door_server/clients"
+	"github.com/fluidmediaproductions/central_hotel_door_server/utils"
+	"github.com/graphql-go/graphql"
+)
+
+var paymentStatusType = graphql.NewEnum(graphql.EnumConfig{
+	Name: "PaymentStatus",
+	Values: graphql.EnumValueConfigMap{
+		"CAPTURED": &graphql.EnumValueConfig{
+			Value: clients.PaymentCaptured,
+		},
+		"REFUNDED": &graphql.EnumValueConfig{
+			Value: clients.PaymentRefunded,
+		},
+		"FAILED": &graphql.EnumValueConfig{
+			Value: clients.PaymentFailed,
+		},
+	},
+})
+
+var bookingPaymentType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "BookingPayment",
+	Fields: graphql.Fields{
+		"provider": &graphql.Field{
+			Type: graphql.String,
+		},
+		"status": &graphql.Field{
+			Type: paymentStatusType,
+		},
+		"amount": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"currency": &graphql.Field{
+			Type: graphql.String,
+		},
+		"capturedAt": &graphql.Field{
+			Type: graphql.DateTime,
+		},
+		"refundedAt": &graphql.Field{
+			Type: graphql.DateTime,
+		},
+		"failedAt": &graphql.Field{
+			Type: graphql.DateTime,
+		},
+	},
+})
+
+// bookRoomMutation books and pays for a room. Nothing is booked if the
+// payment doesn't go through.
+var bookRoomMutation = &graphql.Field{
+	Type: bookingType,
+	Args: graphql.FieldConfigArgument{
+		"roomId": &graphql.ArgumentConfig{
+			Type: graphql.NewNonNull(graphql.String),
+		},
+		"start": &graphql.ArgumentConfig{
+			Type: graphql.NewNonNull(graphql.DateTime),
+		},
+		"end": &graphql.ArgumentConfig{
+			Type: graphql.NewNonNull(graphql.DateTime),
+		},
+		"paymentMethod": &graphql.ArgumentConfig{
+			Type: graphql.NewNonNull(graphql.String),
+		},
+	},
+	Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+		user, isOk := params.Source.(*utils.User)
+		if !isOk {
+			return nil, nil
+		}
+		request := &clients.BookingRequest{}
+		request.RoomID, _ = params.Args["roomId"].(string)
+		request.PaymentMethod, _ = params.Args["paymentMethod"].(string)
+		if start, isOk := params.Args["start"].(time.Time); isOk {
+			request.Start = start
+		}
+		if end, isOk := params.Args["end"].(time.Time); isOk {
+			request.End = end
+		}
+		jwt, err := userToken(user)
+		if err != nil {
+			return nil, err
+		}
+		return bookingsClient.CreateBooking(requestContext(params), jwt, request)
+	},
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/fluidmediaproductions/central_hotel_door_server/utils"
+	"github.com/graphql-go/graphql"
+)
+
+var quoteNightType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "QuoteNight",
+	Fields: graphql.Fields{
+		"date": &graphql.Field{
+			Type: graphql.String,
+		},
+		"amount": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"season": &graphql.Field{
+			Type: graphql.String,
+		},
+	},
+})
+
+var quoteTaxType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "QuoteTax",
+	Fields: graphql.Fields{
+		"name": &graphql.Field{
+			Type: graphql.String,
+		},
+		"percent": &graphql.Field{
+			Type: graphql.Float,
+		},
+		"amount": &graphql.Field{
+			Type: graphql.Int,
+		},
+	},
+})
+
+// quoteType is the price of a stay. Amounts are in the minor unit of the
+// currency, and nights are dates in the hotel's time zone.
+var quoteType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Quote",
+	Fields: graphql.Fields{
+		"roomTypeId": &graphql.Field{
+			Type: graphql.String,
+		},
+		"currency": &graphql.Field{
+			Type: graphql.String,
+		},
+		"nights": &graphql.Field{
+			Type: graphql.NewList(quoteNightType),
+		},
+		"minStay": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"subtotal": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"taxes": &graphql.Field{
+			Type: graphql.NewList(quoteTaxType),
+		},
+		"total": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"quotedAt": &graphql.Field{
+			Type: graphql.DateTime,
+		},
+	},
+})
+
+// quoteQuery prices a stay in one of a hotel's room types at its current
+// rates. Stays shorter than the minimum can't be booked, so aren't quoted.
+var quoteQuery = &graphql.Field{
+	Type: quoteType,
+	Args: graphql.FieldConfigArgument{
+		"hotelId": &graphql.ArgumentConfig{
+			Type: graphql.NewNonNull(graphql.String),
+		},
+		"roomType": &graphql.ArgumentConfig{
+			Type: graphql.NewNonNull(graphql.String),
+		},
+		"start": &graphql.ArgumentConfig{
+			Type: graphql.NewNonNull(graphql.DateTime),
+		},
+		"end": &graphql.ArgumentConfig{
+			Type: graphql.NewNonNull(graphql.DateTime),
+		},
+	},
+	Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+		hotelId, _ := params.Args["hotelId"].(string)
+		roomTypeId, _ := params.Args["roomType"].(string)
+		start, isOk := params.Args["start"].(time.Time)
+		if !isOk {
+			return nil, newCodedError(utils.CodeBadRequest, "invalid start")
+		}
+		end, isOk := params.Args["end"].(time.Time)
+		if !isOk {
+			return nil, newCodedError(utils.CodeBadRequest, "invalid end")
+		}
+
+		quote, err := roomsClient.GetQuote(requestContext(params), hotelId, roomTypeId, start, end)
+		if err != nil {
+			return nil, err
+		}
+		if !quote.MeetsMinStay() {
+			return nil, newCodedError(utils.CodeMinStay, fmt.Sprintf("stays from %s have to be at least %d nights", quote.Nights[0].Date, quote.MinStay))
+		}
+		return quote, nil
+	},
+}
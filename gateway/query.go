@@ -1,13 +1,15 @@
 package main
 
 import (
+	"github.com/fluidmediaproductions/central_hotel_door_server/clients"
 	"github.com/graphql-go/graphql"
-	"net/http"
-	"fmt"
 	"github.com/fluidmediaproductions/central_hotel_door_server/utils"
-	"errors"
+	"time"
 )
 
+var hotelConnectionType = connectionType(hotelType)
+var roomConnectionType = connectionType(roomType)
+
 var authedQuery = graphql.NewObject(graphql.ObjectConfig{
 	Name: "AuthedQuery",
 	Fields: graphql.Fields{
@@ -33,37 +35,18 @@ var authedQuery = graphql.NewObject(graphql.ObjectConfig{
 				if isOK {
 					user, isOk := params.Source.(*utils.User)
 					if isOk {
-						req, err := http.NewRequest("GET", BookingsServer+fmt.Sprintf("/bookings/%s", id), nil)
-						if err != nil {
-							return nil, err
-						}
-
-						jwt, err := utils.NewJWT(user, jwtSecret)
-						if err != nil {
-							return nil, err
-						}
-						req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", jwt))
-
-						resp, err := utils.GetJson(req)
+						jwt, err := userToken(user)
 						if err != nil {
 							return nil, err
 						}
-						respErr, isOk := resp["err"].(string)
-						if isOk {
-							if respErr != "" {
-								return nil, errors.New(respErr)
-							}
-						}
-
-						booking, isOk := resp["booking"].(map[string]interface{})
-						if isOk {
-							return booking, nil
-						}
+						return bookingsClient.GetBooking(requestContext(params), jwt, id)
 					}
 				}
 				return nil, nil
 			},
 		},
+		"folio": folioQuery,
+		"invoice": invoiceQuery,
 	},
 })
 
@@ -80,35 +63,54 @@ var rootQuery = graphql.NewObject(graphql.ObjectConfig{
 			Resolve: func(params graphql.ResolveParams) (interface{}, error) {
 				token, isOK := params.Args["token"].(string)
 				if isOK {
-					return getUser(token)
+					return getUser(requestContext(params), token)
 				}
 				return nil, nil
 			},
 		},
 		"hotels": &graphql.Field{
-			Type: graphql.NewList(hotelType),
+			Type: hotelConnectionType,
+			Args: connectionArgs(graphql.FieldConfigArgument{
+				"name": &graphql.ArgumentConfig{
+					Type: graphql.String,
+				},
+			}),
 			Resolve: func(params graphql.ResolveParams) (interface{}, error) {
-				req, err := http.NewRequest("GET", HotelsServer+"/hotels", nil)
+				page, err := pageArgs(params)
 				if err != nil {
 					return nil, err
 				}
-
-				resp, err := utils.GetJson(req)
+				filter := &clients.HotelFilter{
+					Page: page,
+				}
+				filter.Name, _ = params.Args["name"].(string)
+				hotels, info, err := hotelsClient.GetHotels(requestContext(params), filter)
 				if err != nil {
 					return nil, err
 				}
-				respErr, isOk := resp["err"].(string)
-				if isOk {
-					if respErr != "" {
-						return nil, errors.New(respErr)
-					}
-				}
-
-				hotels, isOk := resp["hotels"].([]interface{})
-				if isOk {
-					return hotels, nil
-				}
-				return nil, nil
+				return newConnection(len(hotels), func(i int) (string, interface{}) {
+					return hotels[i].ID, hotels[i]
+				}, page, info), nil
+			},
+		},
+		"hotelsNear": &graphql.Field{
+			Type: graphql.NewList(nearbyHotelType),
+			Args: graphql.FieldConfigArgument{
+				"lat": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.Float),
+				},
+				"lng": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.Float),
+				},
+				"radiusKm": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.Float),
+				},
+			},
+			Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+				lat, _ := params.Args["lat"].(float64)
+				lng, _ := params.Args["lng"].(float64)
+				radius, _ := params.Args["radiusKm"].(float64)
+				return hotelsClient.GetHotelsNear(requestContext(params), lat, lng, radius)
 			},
 		},
 		"hotel": &graphql.Field{
@@ -121,56 +123,69 @@ var rootQuery = graphql.NewObject(graphql.ObjectConfig{
 			Resolve: func(params graphql.ResolveParams) (interface{}, error) {
 				id, isOK := params.Args["id"].(string)
 				if isOK {
-					req, err := http.NewRequest("GET", HotelsServer+fmt.Sprintf("/hotels/%s", id), nil)
-					if err != nil {
-						return nil, err
-					}
-
-					resp, err := utils.GetJson(req)
-					if err != nil {
-						return nil, err
-					}
-					respErr, isOk := resp["err"].(string)
-					if isOk {
-						if respErr != "" {
-							return nil, errors.New(respErr)
-						}
-					}
-
-					hotel, isOk := resp["hotel"].(map[string]interface{})
-					if isOk {
-						return hotel, nil
-					}
+					return hotelsClient.GetHotel(requestContext(params), id)
 				}
 				return nil, nil
 			},
 		},
 		"rooms": &graphql.Field{
-			Type: graphql.NewList(roomType),
+			Type: roomConnectionType,
+			Args: connectionArgs(graphql.FieldConfigArgument{
+				"floor": &graphql.ArgumentConfig{
+					Type: graphql.String,
+				},
+				"category": &graphql.ArgumentConfig{
+					Type: graphql.String,
+				},
+				"typeId": &graphql.ArgumentConfig{
+					Type: graphql.String,
+				},
+				"capacity": &graphql.ArgumentConfig{
+					Type: graphql.Int,
+				},
+				"amenities": &graphql.ArgumentConfig{
+					Type: graphql.NewList(graphql.String),
+				},
+				"accessibility": &graphql.ArgumentConfig{
+					Type: graphql.NewList(graphql.String),
+				},
+				"from": &graphql.ArgumentConfig{
+					Type: graphql.DateTime,
+				},
+				"to": &graphql.ArgumentConfig{
+					Type: graphql.DateTime,
+				},
+			}),
 			Resolve: func(params graphql.ResolveParams) (interface{}, error) {
-				req, err := http.NewRequest("GET", RoomsServer+"/rooms", nil)
+				page, err := pageArgs(params)
 				if err != nil {
 					return nil, err
 				}
-
-				resp, err := utils.GetJson(req)
-				if err != nil {
-					return nil, err
+				filter := &clients.RoomFilter{
+					Page: page,
 				}
-				respErr, isOk := resp["err"].(string)
-				if isOk {
-					if respErr != "" {
-						return nil, errors.New(respErr)
-					}
+				filter.Floor, _ = params.Args["floor"].(string)
+				filter.Category, _ = params.Args["category"].(string)
+				filter.TypeID, _ = params.Args["typeId"].(string)
+				filter.Capacity, _ = params.Args["capacity"].(int)
+				filter.Amenities = stringList(params.Args["amenities"])
+				filter.Accessibility = stringList(params.Args["accessibility"])
+				if from, isOk := params.Args["from"].(time.Time); isOk {
+					filter.From = &from
 				}
-
-				rooms, isOk := resp["rooms"].([]interface{})
-				if isOk {
-					return rooms, nil
+				if to, isOk := params.Args["to"].(time.Time); isOk {
+					filter.To = &to
 				}
-				return nil, nil
+				rooms, info, err := roomsClient.GetRooms(requestContext(params), filter)
+				if err != nil {
+					return nil, err
+				}
+				return newConnection(len(rooms), func(i int) (string, interface{}) {
+					return rooms[i].ID, rooms[i]
+				}, page, info), nil
 			},
 		},
+		"quote": quoteQuery,
 		"room": &graphql.Field{
 			Type: roomType,
 			Args: graphql.FieldConfigArgument{
@@ -181,26 +196,7 @@ var rootQuery = graphql.NewObject(graphql.ObjectConfig{
 			Resolve: func(params graphql.ResolveParams) (interface{}, error) {
 				id, isOK := params.Args["id"].(string)
 				if isOK {
-					req, err := http.NewRequest("GET", RoomsServer+fmt.Sprintf("/rooms/%s", id), nil)
-					if err != nil {
-						return nil, err
-					}
-
-					resp, err := utils.GetJson(req)
-					if err != nil {
-						return nil, err
-					}
-					respErr, isOk := resp["err"].(string)
-					if isOk {
-						if respErr != "" {
-							return nil, errors.New(respErr)
-						}
-					}
-
-					room, isOk := resp["room"].(map[string]interface{})
-					if isOk {
-						return room, nil
-					}
+					return roomsClient.GetRoom(requestContext(params), id)
 				}
 				return nil, nil
 			},
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// rateLimiter is a token bucket per key, refilled at perMinute tokens a
+// minute up to a burst of perMinute. A limit of 0 lets everything through.
+type rateLimiter struct {
+	perMinute int
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(perMinute int) *rateLimiter {
+	return &rateLimiter{
+		perMinute: perMinute,
+		buckets:   map[string]*bucket{},
+		now:       time.Now,
+	}
+}
+
+// Allow takes a token for the key, returning how long until the next one
+// is available if there are none left.
+func (l *rateLimiter) Allow(key string) (bool, time.Duration) {
+	if l.perMinute <= 0 {
+		return true, 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	rate := float64(l.perMinute) / time.Minute.Seconds()
+	l.sweep(now)
+
+	b, isOk := l.buckets[key]
+	if !isOk {
+		b = &bucket{
+			tokens: float64(l.perMinute),
+			last:   now,
+		}
+		l.buckets[key] = b
+	}
+
+	b.tokens += now.Sub(b.last).Seconds() * rate
+	if b.tokens > float64(l.perMinute) {
+		b.tokens = float64(l.perMinute)
+	}
+	b.last = now
+
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) / rate * float64(time.Second))
+		return false, wait
+	}
+	b.tokens--
+	return true, 0
+}
+
+// sweep drops buckets that have been idle long enough to have refilled, as
+// they're the same as a new bucket.
+func (l *rateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < time.Minute {
+		return
+	}
+	l.lastSweep = now
+	for key, b := range l.buckets {
+		if now.Sub(b.last) >= time.Minute {
+			delete(l.buckets, key)
+		}
+	}
+}
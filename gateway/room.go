@@ -1,51 +1,60 @@
 package main
 
 import (
+	"time"
+
+	"github.com/fluidmediaproductions/central_hotel_door_server/clients"
 	"github.com/graphql-go/graphql"
-	"net/http"
-	"fmt"
-	"github.com/fluidmediaproductions/central_hotel_door_server/utils"
-	"errors"
 )
 
+var roomTypeType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "RoomType",
+	Fields: graphql.Fields{
+		"ID": &graphql.Field{
+			Type: graphql.String,
+		},
+		"name": &graphql.Field{
+			Type: graphql.String,
+		},
+		"capacity": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"beds": &graphql.Field{
+			Type: graphql.String,
+		},
+		"amenities": &graphql.Field{
+			Type: graphql.NewList(graphql.String),
+		},
+		"accessibility": &graphql.Field{
+			Type: graphql.NewList(graphql.String),
+		},
+	},
+})
+
 var roomType = graphql.NewObject(graphql.ObjectConfig{
 	Name: "Room",
 	Fields: graphql.Fields{
 		"ID": &graphql.Field{
 			Type: graphql.String,
-			Resolve: func(params graphql.ResolveParams) (interface{}, error) {
-				room, isOk := params.Source.(map[string]interface{})
-				if isOk {
-					id, isOk := room["uid"].(string)
-					if isOk {
-						return id, nil
-					}
-				}
-				return nil, nil
-			},
 		},
 		"name": &graphql.Field{
 			Type: graphql.String,
-			Resolve: func(params graphql.ResolveParams) (interface{}, error) {
-				room, isOk := params.Source.(map[string]interface{})
-				if isOk {
-					name, isOk := room["name"].(string)
-					if isOk {
-						return name, nil
-					}
-				}
-				return nil, nil
-			},
 		},
 		"floor": &graphql.Field{
 			Type: graphql.String,
+		},
+		"category": &graphql.Field{
+			Type: graphql.String,
+		},
+		"type": &graphql.Field{
+			Type: roomTypeType,
+		},
+		"outOfService": &graphql.Field{
+			Type: graphql.Boolean,
 			Resolve: func(params graphql.ResolveParams) (interface{}, error) {
-				room, isOk := params.Source.(map[string]interface{})
+				room, isOk := params.Source.(*clients.Room)
 				if isOk {
-					floor, isOk := room["floor"].(string)
-					if isOk {
-						return floor, nil
-					}
+					return room.BlockAt(time.Now()) != nil, nil
 				}
 				return nil, nil
 			},
@@ -53,34 +62,24 @@ var roomType = graphql.NewObject(graphql.ObjectConfig{
 		"hotel": &graphql.Field{
 			Type: hotelType,
 			Resolve: func(params graphql.ResolveParams) (interface{}, error) {
-				room, isOk := params.Source.(map[string]interface{})
+				room, isOk := params.Source.(*clients.Room)
 				if isOk {
-					hotelId, isOk := room["hotelId"].(string)
-					if isOk {
-						req, err := http.NewRequest("GET", HotelsServer+fmt.Sprintf("/hotels/%s", hotelId), nil)
-						if err != nil {
-							return nil, err
-						}
-
-						resp, err := utils.GetJson(req)
-						if err != nil {
-							return nil, err
-						}
-						respErr, isOk := resp["err"].(string)
-						if isOk {
-							if respErr != "" {
-								return nil, errors.New(respErr)
-							}
-						}
-
-						hotel, isOk := resp["hotel"].(map[string]interface{})
-						if isOk {
-							return hotel, nil
-						}
-					}
+					return getLoaders(params.Context).hotels.Load(room.HotelID), nil
 				}
 				return nil, nil
 			},
 		},
 	},
 })
+
+// stringList converts a list argument into strings, skipping any nulls in it.
+func stringList(arg interface{}) []string {
+	values, _ := arg.([]interface{})
+	list := make([]string, 0, len(values))
+	for _, value := range values {
+		if s, isOk := value.(string); isOk {
+			list = append(list, s)
+		}
+	}
+	return list
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/fluidmediaproductions/central_hotel_door_server/clients"
+	"github.com/fluidmediaproductions/central_hotel_door_server/utils"
+)
+
+// staffDoorRoles are the roles that can be put on shift at a hotel to get
+// into its rooms and doors.
+var staffDoorRoles = []string{utils.RoleAdmin, utils.RoleFrontDesk, utils.RoleHousekeeping}
+
+// findShift returns the shift that has a user on at a hotel at a time, or
+// nil if they're off.
+func findShift(shifts []*clients.StaffShift, hotelId string, now time.Time) *clients.StaffShift {
+	for _, shift := range shifts {
+		if shift.HotelID == hotelId && shift.Covers(now) {
+			return shift
+		}
+	}
+	return nil
+}
+
+// currentShift returns the shift a member of staff is on at a hotel now, or
+// nil if they aren't staff or are off.
+func currentShift(ctx context.Context, user *utils.User, hotelId string, now time.Time) (*clients.StaffShift, error) {
+	if !user.HasRole(staffDoorRoles...) {
+		return nil, nil
+	}
+	jwt, err := userToken(user)
+	if err != nil {
+		return nil, err
+	}
+	shifts, err := hotelsClient.GetUserShifts(ctx, jwt, user.ID, now)
+	if err != nil {
+		return nil, err
+	}
+	return findShift(shifts, hotelId, now), nil
+}
+
+// openRoomOnShift opens a room for a member of staff on shift at its hotel,
+// for when they don't have a booking for it.
+func openRoomOnShift(ctx context.Context, user *utils.User, roomId string, now time.Time) (bool, error) {
+	room, err := roomsClient.GetRoom(ctx, roomId)
+	if err != nil {
+		return false, err
+	}
+	if room == nil {
+		return false, errBookingNotActive
+	}
+	shift, err := currentShift(ctx, user, room.HotelID, now)
+	if err != nil {
+		return false, err
+	}
+	if shift == nil {
+		return false, errBookingNotActive
+	}
+	err = checkCanUnlock(ctx, room.HotelID)
+	if err != nil {
+		return false, err
+	}
+
+	return roomsClient.OpenRoom(ctx, roomId, &clients.OpenRoomParams{
+		UserID:  user.ID,
+		ShiftID: shift.ID,
+	})
+}
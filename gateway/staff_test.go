@@ -0,0 +1,27 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fluidmediaproductions/central_hotel_door_server/clients"
+)
+
+func TestFindShift(t *testing.T) {
+	now := time.Date(2030, 1, 1, 9, 0, 0, 0, time.UTC)
+	shifts := []*clients.StaffShift{
+		{ID: "0x1", HotelID: "0x10", Start: now.Add(-8 * time.Hour), End: now},
+		{ID: "0x2", HotelID: "0x11", Start: now.Add(-time.Hour), End: now.Add(7 * time.Hour)},
+		{ID: "0x3", HotelID: "0x10", Start: now, End: now.Add(8 * time.Hour)},
+	}
+
+	if shift := findShift(shifts, "0x10", now); shift == nil || shift.ID != "0x3" {
+		t.Errorf("expected the shift starting now, got %+v", shift)
+	}
+	if shift := findShift(shifts, "0x12", now); shift != nil {
+		t.Errorf("expected no shift at another hotel, got %+v", shift)
+	}
+	if shift := findShift(shifts, "0x10", now.Add(8*time.Hour)); shift != nil {
+		t.Errorf("expected no shift once it's ended, got %+v", shift)
+	}
+}
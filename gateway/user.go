@@ -2,13 +2,17 @@ package main
 
 import (
 	"github.com/graphql-go/graphql"
+	"github.com/fluidmediaproductions/central_hotel_door_server/clients"
 	"github.com/fluidmediaproductions/central_hotel_door_server/utils"
-	"net/http"
-	"fmt"
 	"errors"
-	"github.com/mitchellh/mapstructure"
+	"context"
+	"time"
+
+	"github.com/graphql-go/graphql/language/ast"
 )
 
+var bookingConnectionType = connectionType(bookingType)
+
 var userType = graphql.NewObject(graphql.ObjectConfig{
 	Name: "User",
 	Fields: graphql.Fields{
@@ -22,36 +26,53 @@ var userType = graphql.NewObject(graphql.ObjectConfig{
 			Type: graphql.NewNonNull(graphql.String),
 		},
 		"bookings": &graphql.Field{
-			Type: graphql.NewList(bookingType),
+			Type: bookingConnectionType,
+			Args: connectionArgs(graphql.FieldConfigArgument{
+				"from": &graphql.ArgumentConfig{
+					Type: graphql.DateTime,
+				},
+				"to": &graphql.ArgumentConfig{
+					Type: graphql.DateTime,
+				},
+				"status": &graphql.ArgumentConfig{
+					Type: bookingStatusType,
+				},
+				"state": &graphql.ArgumentConfig{
+					Type: bookingStateType,
+				},
+			}),
 			Resolve: func(params graphql.ResolveParams) (interface{}, error) {
 				user, isOk := params.Source.(*utils.User)
 				if isOk {
-					req, err := http.NewRequest("GET", BookingsServer+"/bookings", nil)
+					page, err := pageArgs(params)
 					if err != nil {
 						return nil, err
 					}
+					filter := &clients.BookingFilter{
+						Page: page,
+					}
+					from, isOk := params.Args["from"].(time.Time)
+					if isOk {
+						filter.From = &from
+					}
+					to, isOk := params.Args["to"].(time.Time)
+					if isOk {
+						filter.To = &to
+					}
+					filter.Status, _ = params.Args["status"].(string)
+					filter.State, _ = params.Args["state"].(string)
 
-					jwt, err := utils.NewJWT(user, jwtSecret)
+					jwt, err := userToken(user)
 					if err != nil {
 						return nil, err
 					}
-					req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", jwt))
-
-					resp, err := utils.GetJson(req)
+					bookings, info, err := bookingsClient.GetBookings(requestContext(params), jwt, filter)
 					if err != nil {
 						return nil, err
 					}
-					respErr, isOk := resp["err"].(string)
-					if isOk {
-						if respErr != "" {
-							return nil, errors.New(respErr)
-						}
-					}
-
-					bookings, isOk := resp["bookings"].([]interface{})
-					if isOk {
-						return bookings, nil
-					}
+					return newConnection(len(bookings), func(i int) (string, interface{}) {
+						return bookings[i].ID, bookings[i]
+					}, page, info), nil
 				}
 				return nil, nil
 			},
@@ -59,44 +80,53 @@ var userType = graphql.NewObject(graphql.ObjectConfig{
 	},
 })
 
-func getUser(token string) (*utils.User, error) {
-	user, err := getUserFromAuthServer(token)
+// getUser checks a token with the auth server, so disabled accounts and
+// revoked sessions are turned away. The token is only checked here when the
+// auth server can't be reached.
+func getUser(ctx context.Context, token string) (*utils.User, error) {
+	user, err := getUserFromAuthServer(ctx, token)
 	if err == nil {
 		return user, nil
 	}
+	if clients.IsRejected(err) {
+		return nil, err
+	}
 
 	claims, err := utils.VerifyJWT(token, jwtSecret)
 	if err != nil {
-		return nil, err
+		return nil, errNotAuthenticated
 	}
 
 	return claims.User, nil
 }
 
-func getUserFromAuthServer(token string) (*utils.User, error) {
-	req, err := http.NewRequest("GET", AuthServer+"/userInfo", nil)
+func getUserFromAuthServer(ctx context.Context, token string) (*utils.User, error) {
+	user, err := authClient.UserInfo(ctx, token)
 	if err != nil {
 		return nil, err
 	}
-
-	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", token))
-
-	resp, err := utils.GetJson(req)
-	if err != nil {
-		return nil, err
-	}
-	respErr, isOk := resp["err"].(string)
-	if isOk {
-		if respErr != "" {
-			return nil, errors.New(respErr)
-		}
+	if user == nil {
+		return nil, errors.New("invalid data from auth server")
 	}
+	return user, nil
+}
 
-	jsonUser, isOk := resp["user"].(map[string]interface{})
-	if isOk {
-		user := &utils.User{}
-		mapstructure.Decode(jsonUser, user)
-		return user, nil
+// onlyChangingPassword checks the fields asked for under auth are just
+// changePassword, which a user told to reset their password may still use.
+func onlyChangingPassword(params graphql.ResolveParams) bool {
+	for _, field := range params.Info.FieldASTs {
+		if field.SelectionSet == nil {
+			return false
+		}
+		for _, selection := range field.SelectionSet.Selections {
+			selected, isOk := selection.(*ast.Field)
+			if !isOk {
+				return false
+			}
+			if selected.Name.Value != "changePassword" && selected.Name.Value != "__typename" {
+				return false
+			}
+		}
 	}
-	return nil, errors.New("invalid data from auth server")
+	return true
 }
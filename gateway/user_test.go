@@ -0,0 +1,37 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+)
+
+func authFieldParams(t *testing.T, query string) graphql.ResolveParams {
+	doc, err := parser.Parse(parser.ParseParams{Source: query})
+	if err != nil {
+		t.Fatalf("Error parsing query: %v", err)
+	}
+	op := doc.Definitions[0].(*ast.OperationDefinition)
+	field := op.SelectionSet.Selections[0].(*ast.Field)
+	return graphql.ResolveParams{
+		Info: graphql.ResolveInfo{
+			FieldASTs: []*ast.Field{field},
+		},
+	}
+}
+
+func TestOnlyChangingPassword(t *testing.T) {
+	cases := map[string]bool{
+		`mutation { auth(token: "") { changePassword(pass: "new") } }`:                           true,
+		`mutation { auth(token: "") { __typename changePassword(pass: "new") } }`:                true,
+		`mutation { auth(token: "") { changePassword(pass: "new") updateUser(name: "") } }`:      false,
+		`mutation { auth(token: "") { ... on AuthedMutation { changePassword(pass: "new") } } }`: false,
+	}
+	for query, expected := range cases {
+		if onlyChangingPassword(authFieldParams(t, query)) != expected {
+			t.Errorf("Expected %v for %s", expected, query)
+		}
+	}
+}
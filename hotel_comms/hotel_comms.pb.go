@@ -15,10 +15,19 @@ It has these top-level messages:
 	GetDoors
 	GetDoorsResp
 	Action
+	BookingEvent
 	GetActions
 	GetActionsResp
 	ActionComplete
 	ActionCompleteResp
+	LockStatus
+	LockTelemetry
+	LockTelemetryResp
+	LockEvent
+	LockEventResp
+	CredentialZone
+	DoorCredential
+	SignedCredential
 */
 package hotel_comms
 
@@ -48,17 +57,25 @@ const (
 	MsgType_GET_DOORS_RESP       MsgType = 5
 	MsgType_ACTION_COMPLETE      MsgType = 6
 	MsgType_ACTION_COMPLETE_RESP MsgType = 7
+	MsgType_LOCK_TELEMETRY       MsgType = 8
+	MsgType_LOCK_TELEMETRY_RESP  MsgType = 9
+	MsgType_LOCK_EVENT           MsgType = 10
+	MsgType_LOCK_EVENT_RESP      MsgType = 11
 )
 
 var MsgType_name = map[int32]string{
-	0: "HOTEL_PING",
-	1: "HOTEL_PING_RESP",
-	2: "GET_ACTIONS",
-	3: "GET_ACTIONS_RESP",
-	4: "GET_DOORS",
-	5: "GET_DOORS_RESP",
-	6: "ACTION_COMPLETE",
-	7: "ACTION_COMPLETE_RESP",
+	0:  "HOTEL_PING",
+	1:  "HOTEL_PING_RESP",
+	2:  "GET_ACTIONS",
+	3:  "GET_ACTIONS_RESP",
+	4:  "GET_DOORS",
+	5:  "GET_DOORS_RESP",
+	6:  "ACTION_COMPLETE",
+	7:  "ACTION_COMPLETE_RESP",
+	8:  "LOCK_TELEMETRY",
+	9:  "LOCK_TELEMETRY_RESP",
+	10: "LOCK_EVENT",
+	11: "LOCK_EVENT_RESP",
 }
 var MsgType_value = map[string]int32{
 	"HOTEL_PING":           0,
@@ -69,6 +86,10 @@ var MsgType_value = map[string]int32{
 	"GET_DOORS_RESP":       5,
 	"ACTION_COMPLETE":      6,
 	"ACTION_COMPLETE_RESP": 7,
+	"LOCK_TELEMETRY":       8,
+	"LOCK_TELEMETRY_RESP":  9,
+	"LOCK_EVENT":           10,
+	"LOCK_EVENT_RESP":      11,
 }
 
 func (x MsgType) Enum() *MsgType {
@@ -92,14 +113,32 @@ func (MsgType) EnumDescriptor() ([]byte, []int) { return fileDescriptor0, []int{
 type ActionType int32
 
 const (
-	ActionType_ROOM_UNLOCK ActionType = 0
+	ActionType_ROOM_UNLOCK           ActionType = 0
+	ActionType_DOOR_UNLOCK           ActionType = 1
+	ActionType_EMERGENCY_RELEASE_ALL ActionType = 2
+	ActionType_EMERGENCY_LOCKDOWN    ActionType = 3
+	ActionType_EMERGENCY_CLEAR       ActionType = 4
+	ActionType_BOOKING_CHECK_IN      ActionType = 5
+	ActionType_BOOKING_CHECK_OUT     ActionType = 6
 )
 
 var ActionType_name = map[int32]string{
 	0: "ROOM_UNLOCK",
+	1: "DOOR_UNLOCK",
+	2: "EMERGENCY_RELEASE_ALL",
+	3: "EMERGENCY_LOCKDOWN",
+	4: "EMERGENCY_CLEAR",
+	5: "BOOKING_CHECK_IN",
+	6: "BOOKING_CHECK_OUT",
 }
 var ActionType_value = map[string]int32{
-	"ROOM_UNLOCK": 0,
+	"ROOM_UNLOCK":           0,
+	"DOOR_UNLOCK":           1,
+	"EMERGENCY_RELEASE_ALL": 2,
+	"EMERGENCY_LOCKDOWN":    3,
+	"EMERGENCY_CLEAR":       4,
+	"BOOKING_CHECK_IN":      5,
+	"BOOKING_CHECK_OUT":     6,
 }
 
 func (x ActionType) Enum() *ActionType {
@@ -120,6 +159,43 @@ func (x *ActionType) UnmarshalJSON(data []byte) error {
 }
 func (ActionType) EnumDescriptor() ([]byte, []int) { return fileDescriptor0, []int{1} }
 
+type LockEventType int32
+
+const (
+	LockEventType_DOOR_HELD_OPEN LockEventType = 0
+	LockEventType_FORCED_ENTRY   LockEventType = 1
+	LockEventType_TAMPER         LockEventType = 2
+)
+
+var LockEventType_name = map[int32]string{
+	0: "DOOR_HELD_OPEN",
+	1: "FORCED_ENTRY",
+	2: "TAMPER",
+}
+var LockEventType_value = map[string]int32{
+	"DOOR_HELD_OPEN": 0,
+	"FORCED_ENTRY":   1,
+	"TAMPER":         2,
+}
+
+func (x LockEventType) Enum() *LockEventType {
+	p := new(LockEventType)
+	*p = x
+	return p
+}
+func (x LockEventType) String() string {
+	return proto.EnumName(LockEventType_name, int32(x))
+}
+func (x *LockEventType) UnmarshalJSON(data []byte) error {
+	value, err := proto.UnmarshalJSONEnum(LockEventType_value, data, "LockEventType")
+	if err != nil {
+		return err
+	}
+	*x = LockEventType(value)
+	return nil
+}
+func (LockEventType) EnumDescriptor() ([]byte, []int) { return fileDescriptor0, []int{2} }
+
 type ProtoMsg struct {
 	Type             *MsgType `protobuf:"varint,1,req,name=type,enum=hotel_comms.MsgType" json:"type,omitempty"`
 	Msg              []byte   `protobuf:"bytes,2,req,name=msg" json:"msg,omitempty"`
@@ -179,10 +255,13 @@ func (m *HotelPing) GetTimestamp() int64 {
 }
 
 type HotelPingResp struct {
-	Success          *bool   `protobuf:"varint,1,req,name=success" json:"success,omitempty"`
-	Error            *string `protobuf:"bytes,2,opt,name=error" json:"error,omitempty"`
-	ActionRequired   *bool   `protobuf:"varint,3,opt,name=actionRequired" json:"actionRequired,omitempty"`
-	XXX_unrecognized []byte  `json:"-"`
+	Success            *bool     `protobuf:"varint,1,req,name=success" json:"success,omitempty"`
+	Error              *string   `protobuf:"bytes,2,opt,name=error" json:"error,omitempty"`
+	ActionRequired     *bool     `protobuf:"varint,3,opt,name=actionRequired" json:"actionRequired,omitempty"`
+	PriorityActions    []*Action `protobuf:"bytes,4,rep,name=priorityActions" json:"priorityActions,omitempty"`
+	RevokedCredentials []string  `protobuf:"bytes,5,rep,name=revokedCredentials" json:"revokedCredentials,omitempty"`
+	TimeZone           *string   `protobuf:"bytes,6,opt,name=timeZone" json:"timeZone,omitempty"`
+	XXX_unrecognized   []byte    `json:"-"`
 }
 
 func (m *HotelPingResp) Reset()                    { *m = HotelPingResp{} }
@@ -211,6 +290,27 @@ func (m *HotelPingResp) GetActionRequired() bool {
 	return false
 }
 
+func (m *HotelPingResp) GetPriorityActions() []*Action {
+	if m != nil {
+		return m.PriorityActions
+	}
+	return nil
+}
+
+func (m *HotelPingResp) GetRevokedCredentials() []string {
+	if m != nil {
+		return m.RevokedCredentials
+	}
+	return nil
+}
+
+func (m *HotelPingResp) GetTimeZone() string {
+	if m != nil && m.TimeZone != nil {
+		return *m.TimeZone
+	}
+	return ""
+}
+
 type Door struct {
 	Id               *int64  `protobuf:"varint,1,req,name=id" json:"id,omitempty"`
 	Name             *string `protobuf:"bytes,2,req,name=name" json:"name,omitempty"`
@@ -295,6 +395,39 @@ func (m *Action) GetPayload() []byte {
 	return nil
 }
 
+type BookingEvent struct {
+	BookingId        *string `protobuf:"bytes,1,req,name=bookingId" json:"bookingId,omitempty"`
+	RoomId           *string `protobuf:"bytes,2,opt,name=roomId" json:"roomId,omitempty"`
+	Timestamp        *int64  `protobuf:"varint,3,req,name=timestamp" json:"timestamp,omitempty"`
+	XXX_unrecognized []byte  `json:"-"`
+}
+
+func (m *BookingEvent) Reset()                    { *m = BookingEvent{} }
+func (m *BookingEvent) String() string            { return proto.CompactTextString(m) }
+func (*BookingEvent) ProtoMessage()               {}
+func (*BookingEvent) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{7} }
+
+func (m *BookingEvent) GetBookingId() string {
+	if m != nil && m.BookingId != nil {
+		return *m.BookingId
+	}
+	return ""
+}
+
+func (m *BookingEvent) GetRoomId() string {
+	if m != nil && m.RoomId != nil {
+		return *m.RoomId
+	}
+	return ""
+}
+
+func (m *BookingEvent) GetTimestamp() int64 {
+	if m != nil && m.Timestamp != nil {
+		return *m.Timestamp
+	}
+	return 0
+}
+
 type GetActions struct {
 	XXX_unrecognized []byte `json:"-"`
 }
@@ -302,7 +435,7 @@ type GetActions struct {
 func (m *GetActions) Reset()                    { *m = GetActions{} }
 func (m *GetActions) String() string            { return proto.CompactTextString(m) }
 func (*GetActions) ProtoMessage()               {}
-func (*GetActions) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{7} }
+func (*GetActions) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{8} }
 
 type GetActionsResp struct {
 	Actions          []*Action `protobuf:"bytes,1,rep,name=actions" json:"actions,omitempty"`
@@ -312,7 +445,7 @@ type GetActionsResp struct {
 func (m *GetActionsResp) Reset()                    { *m = GetActionsResp{} }
 func (m *GetActionsResp) String() string            { return proto.CompactTextString(m) }
 func (*GetActionsResp) ProtoMessage()               {}
-func (*GetActionsResp) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{8} }
+func (*GetActionsResp) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{9} }
 
 func (m *GetActionsResp) GetActions() []*Action {
 	if m != nil {
@@ -331,7 +464,7 @@ type ActionComplete struct {
 func (m *ActionComplete) Reset()                    { *m = ActionComplete{} }
 func (m *ActionComplete) String() string            { return proto.CompactTextString(m) }
 func (*ActionComplete) ProtoMessage()               {}
-func (*ActionComplete) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{9} }
+func (*ActionComplete) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{10} }
 
 func (m *ActionComplete) GetActionId() string {
 	if m != nil && m.ActionId != nil {
@@ -361,7 +494,271 @@ type ActionCompleteResp struct {
 func (m *ActionCompleteResp) Reset()                    { *m = ActionCompleteResp{} }
 func (m *ActionCompleteResp) String() string            { return proto.CompactTextString(m) }
 func (*ActionCompleteResp) ProtoMessage()               {}
-func (*ActionCompleteResp) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{10} }
+func (*ActionCompleteResp) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{11} }
+
+type LockStatus struct {
+	DoorId           *string `protobuf:"bytes,1,req,name=doorId" json:"doorId,omitempty"`
+	BatteryLevel     *int32  `protobuf:"varint,2,req,name=batteryLevel" json:"batteryLevel,omitempty"`
+	DoorOpen         *bool   `protobuf:"varint,3,opt,name=doorOpen" json:"doorOpen,omitempty"`
+	XXX_unrecognized []byte  `json:"-"`
+}
+
+func (m *LockStatus) Reset()                    { *m = LockStatus{} }
+func (m *LockStatus) String() string            { return proto.CompactTextString(m) }
+func (*LockStatus) ProtoMessage()               {}
+func (*LockStatus) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{12} }
+
+func (m *LockStatus) GetDoorId() string {
+	if m != nil && m.DoorId != nil {
+		return *m.DoorId
+	}
+	return ""
+}
+
+func (m *LockStatus) GetBatteryLevel() int32 {
+	if m != nil && m.BatteryLevel != nil {
+		return *m.BatteryLevel
+	}
+	return 0
+}
+
+func (m *LockStatus) GetDoorOpen() bool {
+	if m != nil && m.DoorOpen != nil {
+		return *m.DoorOpen
+	}
+	return false
+}
+
+type LockTelemetry struct {
+	Timestamp        *int64        `protobuf:"varint,1,req,name=timestamp" json:"timestamp,omitempty"`
+	Locks            []*LockStatus `protobuf:"bytes,2,rep,name=locks" json:"locks,omitempty"`
+	XXX_unrecognized []byte        `json:"-"`
+}
+
+func (m *LockTelemetry) Reset()                    { *m = LockTelemetry{} }
+func (m *LockTelemetry) String() string            { return proto.CompactTextString(m) }
+func (*LockTelemetry) ProtoMessage()               {}
+func (*LockTelemetry) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{13} }
+
+func (m *LockTelemetry) GetTimestamp() int64 {
+	if m != nil && m.Timestamp != nil {
+		return *m.Timestamp
+	}
+	return 0
+}
+
+func (m *LockTelemetry) GetLocks() []*LockStatus {
+	if m != nil {
+		return m.Locks
+	}
+	return nil
+}
+
+type LockTelemetryResp struct {
+	XXX_unrecognized []byte `json:"-"`
+}
+
+func (m *LockTelemetryResp) Reset()                    { *m = LockTelemetryResp{} }
+func (m *LockTelemetryResp) String() string            { return proto.CompactTextString(m) }
+func (*LockTelemetryResp) ProtoMessage()               {}
+func (*LockTelemetryResp) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{14} }
+
+type LockEvent struct {
+	DoorId           *string        `protobuf:"bytes,1,req,name=doorId" json:"doorId,omitempty"`
+	Type             *LockEventType `protobuf:"varint,2,req,name=type,enum=hotel_comms.LockEventType" json:"type,omitempty"`
+	Timestamp        *int64         `protobuf:"varint,3,req,name=timestamp" json:"timestamp,omitempty"`
+	Detail           *string        `protobuf:"bytes,4,opt,name=detail" json:"detail,omitempty"`
+	XXX_unrecognized []byte         `json:"-"`
+}
+
+func (m *LockEvent) Reset()                    { *m = LockEvent{} }
+func (m *LockEvent) String() string            { return proto.CompactTextString(m) }
+func (*LockEvent) ProtoMessage()               {}
+func (*LockEvent) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{15} }
+
+func (m *LockEvent) GetDoorId() string {
+	if m != nil && m.DoorId != nil {
+		return *m.DoorId
+	}
+	return ""
+}
+
+func (m *LockEvent) GetType() LockEventType {
+	if m != nil && m.Type != nil {
+		return *m.Type
+	}
+	return LockEventType_DOOR_HELD_OPEN
+}
+
+func (m *LockEvent) GetTimestamp() int64 {
+	if m != nil && m.Timestamp != nil {
+		return *m.Timestamp
+	}
+	return 0
+}
+
+func (m *LockEvent) GetDetail() string {
+	if m != nil && m.Detail != nil {
+		return *m.Detail
+	}
+	return ""
+}
+
+type LockEventResp struct {
+	XXX_unrecognized []byte `json:"-"`
+}
+
+func (m *LockEventResp) Reset()                    { *m = LockEventResp{} }
+func (m *LockEventResp) String() string            { return proto.CompactTextString(m) }
+func (*LockEventResp) ProtoMessage()               {}
+func (*LockEventResp) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{16} }
+
+type CredentialZone struct {
+	ZoneId           *string  `protobuf:"bytes,1,req,name=zoneId" json:"zoneId,omitempty"`
+	DoorIds          []string `protobuf:"bytes,2,rep,name=doorIds" json:"doorIds,omitempty"`
+	Days             []int32  `protobuf:"varint,3,rep,name=days" json:"days,omitempty"`
+	From             *string  `protobuf:"bytes,4,opt,name=from" json:"from,omitempty"`
+	To               *string  `protobuf:"bytes,5,opt,name=to" json:"to,omitempty"`
+	XXX_unrecognized []byte   `json:"-"`
+}
+
+func (m *CredentialZone) Reset()                    { *m = CredentialZone{} }
+func (m *CredentialZone) String() string            { return proto.CompactTextString(m) }
+func (*CredentialZone) ProtoMessage()               {}
+func (*CredentialZone) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{17} }
+
+func (m *CredentialZone) GetZoneId() string {
+	if m != nil && m.ZoneId != nil {
+		return *m.ZoneId
+	}
+	return ""
+}
+
+func (m *CredentialZone) GetDoorIds() []string {
+	if m != nil {
+		return m.DoorIds
+	}
+	return nil
+}
+
+func (m *CredentialZone) GetDays() []int32 {
+	if m != nil {
+		return m.Days
+	}
+	return nil
+}
+
+func (m *CredentialZone) GetFrom() string {
+	if m != nil && m.From != nil {
+		return *m.From
+	}
+	return ""
+}
+
+func (m *CredentialZone) GetTo() string {
+	if m != nil && m.To != nil {
+		return *m.To
+	}
+	return ""
+}
+
+type DoorCredential struct {
+	CredentialId     *string           `protobuf:"bytes,1,req,name=credentialId" json:"credentialId,omitempty"`
+	BookingId        *string           `protobuf:"bytes,2,req,name=bookingId" json:"bookingId,omitempty"`
+	HotelId          *string           `protobuf:"bytes,3,req,name=hotelId" json:"hotelId,omitempty"`
+	RoomId           *string           `protobuf:"bytes,4,opt,name=roomId" json:"roomId,omitempty"`
+	Zones            []*CredentialZone `protobuf:"bytes,5,rep,name=zones" json:"zones,omitempty"`
+	NotBefore        *int64            `protobuf:"varint,6,req,name=notBefore" json:"notBefore,omitempty"`
+	NotAfter         *int64            `protobuf:"varint,7,req,name=notAfter" json:"notAfter,omitempty"`
+	IssuedAt         *int64            `protobuf:"varint,8,req,name=issuedAt" json:"issuedAt,omitempty"`
+	XXX_unrecognized []byte            `json:"-"`
+}
+
+func (m *DoorCredential) Reset()                    { *m = DoorCredential{} }
+func (m *DoorCredential) String() string            { return proto.CompactTextString(m) }
+func (*DoorCredential) ProtoMessage()               {}
+func (*DoorCredential) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{18} }
+
+func (m *DoorCredential) GetCredentialId() string {
+	if m != nil && m.CredentialId != nil {
+		return *m.CredentialId
+	}
+	return ""
+}
+
+func (m *DoorCredential) GetBookingId() string {
+	if m != nil && m.BookingId != nil {
+		return *m.BookingId
+	}
+	return ""
+}
+
+func (m *DoorCredential) GetHotelId() string {
+	if m != nil && m.HotelId != nil {
+		return *m.HotelId
+	}
+	return ""
+}
+
+func (m *DoorCredential) GetRoomId() string {
+	if m != nil && m.RoomId != nil {
+		return *m.RoomId
+	}
+	return ""
+}
+
+func (m *DoorCredential) GetZones() []*CredentialZone {
+	if m != nil {
+		return m.Zones
+	}
+	return nil
+}
+
+func (m *DoorCredential) GetNotBefore() int64 {
+	if m != nil && m.NotBefore != nil {
+		return *m.NotBefore
+	}
+	return 0
+}
+
+func (m *DoorCredential) GetNotAfter() int64 {
+	if m != nil && m.NotAfter != nil {
+		return *m.NotAfter
+	}
+	return 0
+}
+
+func (m *DoorCredential) GetIssuedAt() int64 {
+	if m != nil && m.IssuedAt != nil {
+		return *m.IssuedAt
+	}
+	return 0
+}
+
+type SignedCredential struct {
+	Credential       []byte `protobuf:"bytes,1,req,name=credential" json:"credential,omitempty"`
+	Sig              []byte `protobuf:"bytes,2,req,name=sig" json:"sig,omitempty"`
+	XXX_unrecognized []byte `json:"-"`
+}
+
+func (m *SignedCredential) Reset()                    { *m = SignedCredential{} }
+func (m *SignedCredential) String() string            { return proto.CompactTextString(m) }
+func (*SignedCredential) ProtoMessage()               {}
+func (*SignedCredential) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{19} }
+
+func (m *SignedCredential) GetCredential() []byte {
+	if m != nil {
+		return m.Credential
+	}
+	return nil
+}
+
+func (m *SignedCredential) GetSig() []byte {
+	if m != nil {
+		return m.Sig
+	}
+	return nil
+}
 
 func init() {
 	proto.RegisterType((*ProtoMsg)(nil), "hotel_comms.ProtoMsg")
@@ -371,48 +768,93 @@ func init() {
 	proto.RegisterType((*GetDoors)(nil), "hotel_comms.GetDoors")
 	proto.RegisterType((*GetDoorsResp)(nil), "hotel_comms.GetDoorsResp")
 	proto.RegisterType((*Action)(nil), "hotel_comms.Action")
+	proto.RegisterType((*BookingEvent)(nil), "hotel_comms.BookingEvent")
 	proto.RegisterType((*GetActions)(nil), "hotel_comms.GetActions")
 	proto.RegisterType((*GetActionsResp)(nil), "hotel_comms.GetActionsResp")
 	proto.RegisterType((*ActionComplete)(nil), "hotel_comms.ActionComplete")
 	proto.RegisterType((*ActionCompleteResp)(nil), "hotel_comms.ActionCompleteResp")
+	proto.RegisterType((*LockStatus)(nil), "hotel_comms.LockStatus")
+	proto.RegisterType((*LockTelemetry)(nil), "hotel_comms.LockTelemetry")
+	proto.RegisterType((*LockTelemetryResp)(nil), "hotel_comms.LockTelemetryResp")
+	proto.RegisterType((*LockEvent)(nil), "hotel_comms.LockEvent")
+	proto.RegisterType((*LockEventResp)(nil), "hotel_comms.LockEventResp")
+	proto.RegisterType((*CredentialZone)(nil), "hotel_comms.CredentialZone")
+	proto.RegisterType((*DoorCredential)(nil), "hotel_comms.DoorCredential")
+	proto.RegisterType((*SignedCredential)(nil), "hotel_comms.SignedCredential")
 	proto.RegisterEnum("hotel_comms.MsgType", MsgType_name, MsgType_value)
 	proto.RegisterEnum("hotel_comms.ActionType", ActionType_name, ActionType_value)
+	proto.RegisterEnum("hotel_comms.LockEventType", LockEventType_name, LockEventType_value)
 }
 
 func init() { proto.RegisterFile("hotel_comms/hotel_comms.proto", fileDescriptor0) }
 
 var fileDescriptor0 = []byte{
-	// 511 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x7c, 0x92, 0x4f, 0x6f, 0xda, 0x4c,
-	0x10, 0xc6, 0xe3, 0x3f, 0x04, 0x3c, 0x10, 0xc7, 0xef, 0x04, 0xe9, 0x5d, 0x55, 0x8d, 0x64, 0xed,
-	0xa1, 0x75, 0xa9, 0x9a, 0x4a, 0xb9, 0xe4, 0x58, 0x45, 0x80, 0x08, 0x2a, 0x60, 0xb4, 0xc0, 0xd9,
-	0xb2, 0x60, 0xe5, 0x5a, 0xc2, 0xac, 0xeb, 0x35, 0x07, 0x4e, 0xfd, 0x38, 0xfd, 0x9a, 0xd5, 0x7a,
-	0x03, 0x98, 0xa8, 0xea, 0x6d, 0x9e, 0xc7, 0xbf, 0x9d, 0x7d, 0x66, 0xd6, 0x70, 0xff, 0x43, 0x94,
-	0x7c, 0x1b, 0xad, 0x45, 0x96, 0xc9, 0xaf, 0xb5, 0xfa, 0x21, 0x2f, 0x44, 0x29, 0xb0, 0x5d, 0xb3,
-	0xe8, 0x16, 0x5a, 0x73, 0xe5, 0x4e, 0x65, 0x82, 0x01, 0xd8, 0xe5, 0x21, 0xe7, 0xc4, 0xf0, 0xcd,
-	0xc0, 0x7d, 0xec, 0x3e, 0xd4, 0x8f, 0x4e, 0x65, 0xb2, 0x3c, 0xe4, 0x9c, 0x55, 0x04, 0x7a, 0x60,
-	0x65, 0x32, 0x21, 0xa6, 0x6f, 0x06, 0x1d, 0xa6, 0x4a, 0x44, 0xb0, 0x57, 0xab, 0xf1, 0x80, 0x58,
-	0xbe, 0x19, 0x38, 0xcc, 0xde, 0xaf, 0xc6, 0x03, 0x45, 0xc9, 0x34, 0x21, 0xb6, 0xa6, 0x64, 0x9a,
-	0xd0, 0x4f, 0xe0, 0xbc, 0xa8, 0xa6, 0xf3, 0x74, 0x97, 0xe0, 0x7b, 0x70, 0xca, 0x34, 0xe3, 0xb2,
-	0x8c, 0xb3, 0xbc, 0xba, 0xd3, 0x62, 0x67, 0x83, 0x26, 0x70, 0x73, 0x42, 0x19, 0x97, 0x39, 0x12,
-	0x68, 0xca, 0xfd, 0x7a, 0xcd, 0xa5, 0xac, 0xe0, 0x16, 0x3b, 0x4a, 0xec, 0x42, 0x83, 0x17, 0x85,
-	0x28, 0x88, 0xe9, 0x1b, 0x81, 0xc3, 0xb4, 0xc0, 0x0f, 0xe0, 0xc6, 0xeb, 0x32, 0x15, 0x3b, 0xc6,
-	0x7f, 0xee, 0xd3, 0x82, 0x6f, 0x88, 0xe5, 0x1b, 0x41, 0x8b, 0xbd, 0x71, 0x69, 0x0f, 0xec, 0x81,
-	0x10, 0x05, 0xba, 0x60, 0xa6, 0x9b, 0xd7, 0x1c, 0x66, 0xba, 0x51, 0x13, 0xed, 0xe2, 0x8c, 0x57,
-	0x43, 0x3a, 0xac, 0xaa, 0x29, 0x40, 0x6b, 0xc4, 0x4b, 0x85, 0x4b, 0xfa, 0x04, 0x9d, 0x63, 0x5d,
-	0xe5, 0xfb, 0x08, 0x8d, 0x8d, 0x12, 0xc4, 0xf0, 0xad, 0xa0, 0xfd, 0xf8, 0xdf, 0xc5, 0xfa, 0x14,
-	0xc6, 0xf4, 0x77, 0x1a, 0xc1, 0xf5, 0x73, 0x15, 0x01, 0x3f, 0x5f, 0x2c, 0xfc, 0xff, 0x8b, 0x13,
-	0x1a, 0xa9, 0xed, 0x5c, 0xe7, 0xd3, 0x69, 0x54, 0x3e, 0x02, 0xcd, 0x3c, 0x3e, 0x6c, 0x45, 0xac,
-	0x07, 0xeb, 0xb0, 0xa3, 0xa4, 0x1d, 0x80, 0x11, 0x2f, 0x75, 0x03, 0x49, 0xbf, 0x81, 0x7b, 0x56,
-	0x55, 0xd2, 0x2f, 0xd0, 0xd4, 0x3b, 0x38, 0x66, 0xbd, 0xfb, 0xcb, 0xcd, 0xec, 0xc8, 0xd0, 0x5f,
-	0xe0, 0x6a, 0xab, 0x2f, 0xb2, 0x7c, 0xcb, 0x4b, 0x8e, 0xef, 0xa0, 0xa5, 0x3f, 0x8e, 0xf5, 0xc2,
-	0x1c, 0x76, 0xd2, 0xf8, 0x04, 0x10, 0x9f, 0xa2, 0x57, 0x71, 0xff, 0x31, 0x59, 0x0d, 0xad, 0xbf,
-	0xaf, 0x75, 0xf1, 0xbe, 0xb4, 0x0b, 0x78, 0x19, 0x40, 0x4d, 0xd1, 0xfb, 0x6d, 0x40, 0xf3, 0xf5,
-	0xaf, 0x44, 0x17, 0xe0, 0x25, 0x5c, 0x0e, 0x27, 0xd1, 0x7c, 0x3c, 0x1b, 0x79, 0x57, 0x78, 0x07,
-	0xb7, 0x67, 0x1d, 0xb1, 0xe1, 0x62, 0xee, 0x19, 0x78, 0x0b, 0xed, 0xd1, 0x70, 0x19, 0x3d, 0xf7,
-	0x97, 0xe3, 0x70, 0xb6, 0xf0, 0x4c, 0xec, 0x82, 0x57, 0x33, 0x34, 0x66, 0xe1, 0x0d, 0x38, 0xca,
-	0x1d, 0x84, 0x21, 0x5b, 0x78, 0x36, 0x22, 0xb8, 0x27, 0xa9, 0x91, 0x86, 0x6a, 0xaf, 0x0f, 0x45,
-	0xfd, 0x70, 0x3a, 0x9f, 0x0c, 0x97, 0x43, 0xef, 0x1a, 0x09, 0x74, 0xdf, 0x98, 0x1a, 0x6f, 0xf6,
-	0xee, 0x01, 0xce, 0x33, 0xab, 0x18, 0x2c, 0x0c, 0xa7, 0xd1, 0x6a, 0x36, 0x09, 0xfb, 0xdf, 0xbd,
-	0xab, 0x3f, 0x01, 0x00, 0x00, 0xff, 0xff, 0xe7, 0xa4, 0xe0, 0xaa, 0xaf, 0x03, 0x00, 0x00,
+	// 1065 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x7c, 0x55, 0x4d, 0x6f, 0xeb, 0x44,
+	0x14, 0x6d, 0x9c, 0xef, 0xdb, 0x34, 0x75, 0xa7, 0x7d, 0xef, 0x99, 0xc7, 0x87, 0x22, 0x2f, 0x20,
+	0x14, 0xbd, 0x22, 0xba, 0x79, 0x2b, 0x84, 0xd2, 0x64, 0x68, 0xa3, 0x26, 0x71, 0x34, 0x71, 0x41,
+	0x20, 0x24, 0xcb, 0x8d, 0xa7, 0xc1, 0x6a, 0xe2, 0x09, 0xf6, 0xb4, 0x52, 0xde, 0x86, 0x35, 0x0b,
+	0x7e, 0x05, 0xff, 0x90, 0x1d, 0x3b, 0x74, 0x67, 0x12, 0x7f, 0x94, 0xd2, 0xdd, 0x9c, 0x73, 0x8f,
+	0x3d, 0xf7, 0x9e, 0x7b, 0xaf, 0x0d, 0x9f, 0xfe, 0x2a, 0x24, 0x5f, 0x7a, 0x73, 0xb1, 0x5a, 0x25,
+	0x5f, 0xe7, 0xce, 0x67, 0xeb, 0x58, 0x48, 0x41, 0xf6, 0x73, 0x94, 0xbd, 0x84, 0xc6, 0x14, 0xd9,
+	0x71, 0xb2, 0x20, 0x5d, 0xa8, 0xc8, 0xcd, 0x9a, 0x5b, 0xa5, 0x8e, 0xd1, 0x6d, 0x9f, 0x9f, 0x9c,
+	0xe5, 0x1f, 0x1d, 0x27, 0x0b, 0x77, 0xb3, 0xe6, 0x4c, 0x29, 0x88, 0x09, 0xe5, 0x55, 0xb2, 0xb0,
+	0x8c, 0x8e, 0xd1, 0x6d, 0x31, 0x3c, 0x12, 0x02, 0x95, 0x9b, 0x9b, 0xe1, 0xc0, 0x2a, 0x77, 0x8c,
+	0x6e, 0x93, 0x55, 0x1e, 0x6e, 0x86, 0x03, 0x54, 0x25, 0xe1, 0xc2, 0xaa, 0x68, 0x55, 0x12, 0x2e,
+	0xec, 0x2f, 0xa1, 0x79, 0x85, 0x2f, 0x9d, 0x86, 0xd1, 0x82, 0x7c, 0x02, 0x4d, 0x19, 0xae, 0x78,
+	0x22, 0xfd, 0xd5, 0x5a, 0xdd, 0x59, 0x66, 0x19, 0x61, 0xff, 0x5d, 0x82, 0x83, 0x54, 0xcb, 0x78,
+	0xb2, 0x26, 0x16, 0xd4, 0x93, 0x87, 0xf9, 0x9c, 0x27, 0x89, 0x52, 0x37, 0xd8, 0x0e, 0x92, 0x13,
+	0xa8, 0xf2, 0x38, 0x16, 0xb1, 0x65, 0x74, 0x4a, 0xdd, 0x26, 0xd3, 0x80, 0x7c, 0x0e, 0x6d, 0x7f,
+	0x2e, 0x43, 0x11, 0x31, 0xfe, 0xdb, 0x43, 0x18, 0xf3, 0xc0, 0x2a, 0x77, 0x4a, 0xdd, 0x06, 0x7b,
+	0xc2, 0x92, 0x6f, 0xe1, 0x70, 0x1d, 0x87, 0x22, 0x0e, 0xe5, 0xa6, 0xa7, 0x22, 0x89, 0x55, 0xe9,
+	0x94, 0xbb, 0xfb, 0xe7, 0xc7, 0x05, 0x07, 0x74, 0x8c, 0x3d, 0xd5, 0x92, 0x33, 0x20, 0x31, 0x7f,
+	0x14, 0xf7, 0x3c, 0xe8, 0xc7, 0x3c, 0xe0, 0x91, 0x0c, 0xfd, 0x65, 0x62, 0x55, 0x3b, 0xe5, 0x6e,
+	0x93, 0x3d, 0x13, 0x21, 0x6f, 0xa1, 0x81, 0x55, 0xfe, 0x2c, 0x22, 0x6e, 0xd5, 0x54, 0xbe, 0x29,
+	0xb6, 0x4f, 0xa1, 0x32, 0x10, 0x22, 0x26, 0x6d, 0x30, 0xc2, 0x60, 0xeb, 0x89, 0x11, 0x06, 0xe8,
+	0x6e, 0xe4, 0xaf, 0xb8, 0x32, 0xbc, 0xc9, 0xd4, 0xd9, 0x06, 0x68, 0x5c, 0x72, 0x89, 0xf2, 0xc4,
+	0x7e, 0x0f, 0xad, 0xdd, 0x59, 0x59, 0xf5, 0x05, 0x54, 0x03, 0x04, 0x56, 0x49, 0x15, 0x72, 0x54,
+	0x28, 0x04, 0x65, 0x4c, 0xc7, 0x6d, 0x0f, 0x6a, 0xba, 0x0e, 0xf2, 0x55, 0xa1, 0xf9, 0x6f, 0x9e,
+	0x29, 0x3d, 0xd7, 0x7f, 0x9d, 0x9f, 0xce, 0x06, 0xf3, 0xb3, 0xa0, 0xbe, 0xf6, 0x37, 0x4b, 0xe1,
+	0x6b, 0x8f, 0x5b, 0x6c, 0x07, 0xed, 0x5b, 0x68, 0x5d, 0x08, 0x71, 0x1f, 0x46, 0x0b, 0xfa, 0xc8,
+	0x23, 0x89, 0x4d, 0xbf, 0xd5, 0x78, 0xa8, 0x0b, 0x6c, 0xb2, 0x8c, 0x20, 0xaf, 0xa1, 0x16, 0x0b,
+	0xb1, 0x1a, 0x06, 0xdb, 0x4e, 0x6e, 0x51, 0x71, 0x54, 0xca, 0x4f, 0x47, 0xa5, 0x05, 0x70, 0xc9,
+	0xe5, 0xb6, 0x1f, 0xf6, 0x77, 0xd0, 0xce, 0x90, 0x72, 0xe3, 0x1d, 0xd4, 0x75, 0xcb, 0x77, 0x7e,
+	0x3c, 0xdb, 0xd8, 0x9d, 0xc6, 0xfe, 0x1d, 0xda, 0x9a, 0xea, 0x8b, 0xd5, 0x7a, 0xc9, 0x25, 0xc7,
+	0x96, 0xe9, 0x60, 0x9a, 0x73, 0x8a, 0xc9, 0x7b, 0x00, 0x3f, 0xb5, 0xc7, 0x32, 0x5e, 0x76, 0x2f,
+	0x27, 0xcd, 0x8f, 0x73, 0xb9, 0x30, 0xce, 0xf6, 0x09, 0x90, 0x62, 0x02, 0x58, 0x85, 0x1d, 0x00,
+	0x8c, 0xc4, 0xfc, 0x7e, 0x26, 0x7d, 0xf9, 0x90, 0xa0, 0x53, 0xd8, 0xc1, 0x34, 0xa1, 0x2d, 0x22,
+	0x36, 0xb4, 0x6e, 0x7d, 0x29, 0x79, 0xbc, 0x19, 0xf1, 0x47, 0xbe, 0x54, 0x09, 0x55, 0x59, 0x81,
+	0xc3, 0x72, 0x50, 0xed, 0xac, 0x79, 0xb4, 0x5d, 0x89, 0x14, 0xdb, 0xbf, 0xc0, 0x01, 0xde, 0xe2,
+	0xf2, 0x25, 0x5f, 0x71, 0x19, 0x6f, 0x5e, 0xde, 0x52, 0xf2, 0x0e, 0xaa, 0x4b, 0x31, 0xbf, 0x4f,
+	0x2c, 0x43, 0x19, 0x5b, 0x2c, 0x3c, 0x4b, 0x97, 0x69, 0x95, 0x7d, 0x0c, 0x47, 0x85, 0xb7, 0xab,
+	0xc2, 0xfe, 0x28, 0x41, 0x13, 0x59, 0x3d, 0x20, 0xff, 0x57, 0xd8, 0xd9, 0x76, 0x3e, 0xb5, 0xc3,
+	0x6f, 0xff, 0x73, 0x91, 0x7a, 0x3a, 0x37, 0xa2, 0x2f, 0x8e, 0x8c, 0xba, 0x85, 0x4b, 0x3f, 0x5c,
+	0x5a, 0x15, 0x3d, 0x68, 0x1a, 0xd9, 0x87, 0x70, 0x90, 0xbe, 0x4c, 0x25, 0xf7, 0x01, 0xda, 0xd9,
+	0xf2, 0xe2, 0x8e, 0xe2, 0xa3, 0x1f, 0x44, 0xc4, 0xb3, 0x04, 0x35, 0xc2, 0x7e, 0xea, 0x54, 0xb5,
+	0x19, 0x4d, 0xb6, 0x83, 0xb8, 0xbd, 0x81, 0xbf, 0xc1, 0x36, 0x97, 0xbb, 0x55, 0xa6, 0xce, 0xc8,
+	0xdd, 0xc5, 0x62, 0xb5, 0xbd, 0x5e, 0x9d, 0x71, 0xab, 0xa4, 0xb0, 0xaa, 0x8a, 0x31, 0xa4, 0xb0,
+	0xff, 0x34, 0xa0, 0x8d, 0xcb, 0x9a, 0x25, 0x80, 0xed, 0x9d, 0xa7, 0x28, 0x4d, 0xa1, 0xc0, 0x15,
+	0x57, 0xcc, 0x78, 0xba, 0x62, 0x16, 0xd4, 0x95, 0x75, 0xc3, 0x60, 0xfb, 0xad, 0xde, 0xc1, 0xdc,
+	0xf2, 0x55, 0x0a, 0xcb, 0xf7, 0x0d, 0x54, 0xb1, 0x44, 0xfd, 0x4d, 0xdb, 0x3f, 0xff, 0xb8, 0x60,
+	0x7d, 0xd1, 0x1c, 0xa6, 0x95, 0x98, 0x42, 0x24, 0xe4, 0x05, 0xbf, 0x13, 0x31, 0x7e, 0xe4, 0x94,
+	0xf9, 0x29, 0x81, 0xf3, 0x17, 0x09, 0xd9, 0xbb, 0x93, 0x3c, 0xb6, 0xea, 0x2a, 0x98, 0x62, 0x8c,
+	0x85, 0x49, 0xf2, 0xc0, 0x83, 0x9e, 0xb4, 0x1a, 0x3a, 0xb6, 0xc3, 0xf6, 0x00, 0xcc, 0x59, 0xb8,
+	0x88, 0xf2, 0x9f, 0x53, 0xf2, 0x19, 0x40, 0x56, 0xbc, 0xb2, 0xa3, 0xc5, 0x72, 0xcc, 0xee, 0x1f,
+	0x64, 0xa4, 0xff, 0xa0, 0xd3, 0x7f, 0x4a, 0x50, 0xdf, 0xfe, 0xcd, 0x48, 0x1b, 0xe0, 0xca, 0x71,
+	0xe9, 0xc8, 0x9b, 0x0e, 0x27, 0x97, 0xe6, 0x1e, 0x39, 0x86, 0xc3, 0x0c, 0x7b, 0x8c, 0xce, 0xa6,
+	0x66, 0x89, 0x1c, 0xc2, 0xfe, 0x25, 0x75, 0xbd, 0x5e, 0xdf, 0x1d, 0x3a, 0x93, 0x99, 0x69, 0x90,
+	0x13, 0x30, 0x73, 0x84, 0x96, 0x95, 0xc9, 0x01, 0x34, 0x91, 0x1d, 0x38, 0x0e, 0x9b, 0x99, 0x15,
+	0x42, 0xa0, 0x9d, 0x42, 0x2d, 0xa9, 0xe2, 0xeb, 0xf5, 0x43, 0x5e, 0xdf, 0x19, 0x4f, 0x47, 0xd4,
+	0xa5, 0x66, 0x8d, 0x58, 0x70, 0xf2, 0x84, 0xd4, 0xf2, 0x3a, 0xbe, 0x62, 0xe4, 0xf4, 0xaf, 0x3d,
+	0x97, 0x8e, 0xe8, 0x98, 0xba, 0xec, 0x27, 0xb3, 0x41, 0xde, 0xc0, 0x71, 0x91, 0xd3, 0xe2, 0x26,
+	0x96, 0xa2, 0x02, 0xf4, 0x07, 0x3a, 0x71, 0x4d, 0xc0, 0xbb, 0x32, 0xac, 0x45, 0xfb, 0xa7, 0x7f,
+	0x95, 0x00, 0xb2, 0xcf, 0x11, 0x56, 0xc6, 0x1c, 0x67, 0xec, 0xdd, 0x4c, 0x50, 0x6a, 0xee, 0x21,
+	0x81, 0x09, 0xef, 0x88, 0x12, 0xf9, 0x08, 0x5e, 0xd1, 0x31, 0x65, 0x97, 0x74, 0xd2, 0xc7, 0x9b,
+	0x46, 0xb4, 0x37, 0xa3, 0x5e, 0x6f, 0x34, 0x32, 0x0d, 0xf2, 0x1a, 0x48, 0x16, 0x42, 0xf9, 0xc0,
+	0xf9, 0x71, 0x62, 0x96, 0xf1, 0xe2, 0x8c, 0xef, 0x8f, 0x68, 0x8f, 0x99, 0x15, 0xb4, 0xec, 0xc2,
+	0x71, 0xae, 0xd1, 0xd5, 0xfe, 0x15, 0xed, 0x5f, 0x7b, 0xc3, 0x89, 0x59, 0x25, 0xaf, 0xe0, 0xa8,
+	0xc8, 0x3a, 0x37, 0xae, 0x59, 0x3b, 0xed, 0xe5, 0x96, 0x50, 0xe5, 0x49, 0xa0, 0xad, 0xd2, 0xba,
+	0xa2, 0xa3, 0x81, 0xe7, 0x4c, 0xe9, 0xc4, 0xdc, 0x23, 0x26, 0xb4, 0xbe, 0x77, 0x58, 0x9f, 0x0e,
+	0x3c, 0x3a, 0x41, 0x6b, 0x4a, 0x04, 0xa0, 0xe6, 0xf6, 0xc6, 0x53, 0xca, 0x4c, 0xe3, 0xdf, 0x01,
+	0x00, 0xcf, 0x75, 0x59, 0x6d, 0x03, 0x09, 0x00, 0x00,
 }
@@ -4,9 +4,8 @@ import (
 	"net/http"
 	"github.com/fluidmediaproductions/central_hotel_door_server/hotel_comms"
 	"github.com/golang/protobuf/proto"
-	"fmt"
-	"github.com/fluidmediaproductions/central_hotel_door_server/utils"
 	"errors"
+	"context"
 )
 
 func getAction(hotel *HotelServer, msg []byte, sig []byte, w http.ResponseWriter) error {
@@ -28,29 +27,50 @@ func getAction(hotel *HotelServer, msg []byte, sig []byte, w http.ResponseWriter
 	return sendMsg(resp, hotel_comms.MsgType_GET_ACTIONS_RESP, w)
 }
 
-func getActions(hotelId uint) ([]*hotel_comms.Action, error) {
-	actions := make([]*hotel_comms.Action, 0)
+func getActions(hotelId string) ([]*hotel_comms.Action, error) {
+	// Booking events don't unlock anything, so they go through even in a
+	// lockdown
+	actions, err := bookingEventActions(hotelId)
+	if err != nil {
+		return nil, err
+	}
+
+	// Guest unlocks are held back for as long as the hotel is locked down
+	state, err := getEmergencyState(hotelId)
+	if err != nil {
+		return nil, err
+	}
+	if state.Mode == emergencyLockdown {
+		return actions, nil
+	}
+
 	rooms, err := getRoomsByHotel(hotelId)
 	if err != nil {
 		return nil, err
 	}
 	for _, room := range rooms {
-		room, isOk := room.(map[string]interface{})
-		if isOk {
-			shouldOpen, isOk := room["shouldOpen"].(bool)
-			if isOk {
-				if shouldOpen {
-					id, isOk := room["ID"].(string)
-					if isOk {
-						actionType := hotel_comms.ActionType_ROOM_UNLOCK
-						action := &hotel_comms.Action{
-							Type: &actionType,
-							Id:   proto.String(id),
-						}
-						actions = append(actions, action)
-					}
-				}
+		if room.ShouldOpen {
+			actionType := hotel_comms.ActionType_ROOM_UNLOCK
+			action := &hotel_comms.Action{
+				Type: &actionType,
+				Id:   proto.String(room.ID),
+			}
+			actions = append(actions, action)
+		}
+	}
+
+	doors, err := getDoorsByHotel(hotelId)
+	if err != nil {
+		return nil, err
+	}
+	for _, door := range doors {
+		if door.ShouldOpen {
+			actionType := hotel_comms.ActionType_DOOR_UNLOCK
+			action := &hotel_comms.Action{
+				Type: &actionType,
+				Id:   proto.String(door.ID),
 			}
+			actions = append(actions, action)
 		}
 	}
 	return actions, nil
@@ -65,7 +85,22 @@ func actionComplete(hotel *HotelServer, msg []byte, sig []byte, w http.ResponseW
 
 	if newMsg.GetSuccess() {
 		if newMsg.GetActionType() == hotel_comms.ActionType_ROOM_UNLOCK {
-			err := completeRoomUnlock(newMsg.GetActionId(), hotel.ID)
+			err := completeRoomUnlock(newMsg.GetActionId(), hotel.HotelId)
+			if err != nil {
+				return err
+			}
+		} else if newMsg.GetActionType() == hotel_comms.ActionType_DOOR_UNLOCK {
+			err := completeDoorUnlock(newMsg.GetActionId(), hotel.HotelId)
+			if err != nil {
+				return err
+			}
+		} else if isEmergencyAction(newMsg.GetActionType()) {
+			err := completeEmergency(newMsg.GetActionId(), hotel.HotelId)
+			if err != nil {
+				return err
+			}
+		} else if isBookingEventAction(newMsg.GetActionType()) {
+			err := completeBookingEvent(newMsg.GetActionId(), hotel.HotelId)
 			if err != nil {
 				return err
 			}
@@ -77,48 +112,20 @@ func actionComplete(hotel *HotelServer, msg []byte, sig []byte, w http.ResponseW
 }
 
 func completeRoomUnlock(roomId string, hotelId string) error {
-	req, err := http.NewRequest("GET", RoomsServer+fmt.Sprintf("/rooms/%s", roomId), nil)
+	ctx := context.Background()
 
-	resp, err := utils.GetJson(req)
+	room, err := roomsClient.GetRoom(ctx, roomId)
 	if err != nil {
 		return err
 	}
-	respErr, isOk := resp["err"].(string)
-	if isOk {
-		if respErr != "" {
-			return errors.New(respErr)
-		}
-	}
-
-	room, isOk := resp["room"].(map[string]interface{})
-	if !isOk {
-		return errors.New("unable to get room")
-	}
-
-	roomHotelId, isOk := room["hotelId"].(string)
-	if !isOk {
+	if room == nil {
 		return errors.New("unable to get room")
 	}
 
-	if hotelId != roomHotelId {
+	if hotelId != room.HotelID {
 		return errors.New("room not in hotel")
 	}
 
-	req, err = http.NewRequest("GET", RoomsServer+fmt.Sprintf("/rooms/%s/open-success", roomId), nil)
-	if err != nil {
-		return  err
-	}
-
-	resp, err = utils.GetJson(req)
-	if err != nil {
-		return err
-	}
-	respErr, isOk = resp["err"].(string)
-	if isOk {
-		if respErr != "" {
-			return errors.New(respErr)
-		}
-	}
-
-	return nil
+	_, err = roomsClient.OpenRoomSuccess(ctx, roomId)
+	return err
 }
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/fluidmediaproductions/central_hotel_door_server/clients"
+	"github.com/fluidmediaproductions/central_hotel_door_server/hotel_comms"
+	"github.com/golang/protobuf/proto"
+)
+
+// useFakeRooms points roomsClient at a fake rooms service that serves room
+// 0x3 in hotel 0x2, and records the paths it was asked for.
+func useFakeRooms(t *testing.T) (func() []string, func()) {
+	var mu sync.Mutex
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		paths = append(paths, r.URL.Path)
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/rooms/0x3":
+			fmt.Fprint(w, `{"err": "", "room": {"uid": "0x3", "hotelId": "0x2"}}`)
+		case "/rooms/0x3/open-success":
+			fmt.Fprint(w, `{"err": "", "success": true}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"err": "room not found", "code": "NOT_FOUND"}`)
+		}
+	}))
+
+	oldClient := roomsClient
+	roomsClient = clients.NewRoomsClient(server.URL)
+	return func() []string {
+			mu.Lock()
+			defer mu.Unlock()
+			return append([]string(nil), paths...)
+		}, func() {
+			roomsClient = oldClient
+			server.Close()
+		}
+}
+
+func useTestKey(t *testing.T) func() {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("Error making key: %v", err)
+	}
+	oldKey := status.PrivateKey
+	status.PrivateKey = key
+	return func() {
+		status.PrivateKey = oldKey
+	}
+}
+
+func TestActionCompleteRoomUnlock(t *testing.T) {
+	paths, restore := useFakeRooms(t)
+	defer restore()
+	defer useTestKey(t)()
+
+	actionType := hotel_comms.ActionType_ROOM_UNLOCK
+	msg, err := proto.Marshal(&hotel_comms.ActionComplete{
+		ActionId:   proto.String("0x3"),
+		ActionType: &actionType,
+		Success:    proto.Bool(true),
+	})
+	if err != nil {
+		t.Fatalf("Error making message: %v", err)
+	}
+
+	// The server node's uid differs from the hotel's, and the room is
+	// matched against the hotel.
+	hotel := &HotelServer{ID: "0x5", HotelId: "0x2"}
+	err = actionComplete(hotel, msg, nil, httptest.NewRecorder())
+	if err != nil {
+		t.Fatalf("Error completing room unlock: %v", err)
+	}
+	got := paths()
+	if len(got) != 2 || got[1] != "/rooms/0x3/open-success" {
+		t.Errorf("Expected the room unlock to be marked a success, got requests %v", got)
+	}
+
+	other := &HotelServer{ID: "0x6", HotelId: "0x7"}
+	err = actionComplete(other, msg, nil, httptest.NewRecorder())
+	if err == nil || err.Error() != "room not in hotel" {
+		t.Errorf("Expected room not in hotel, got %v", err)
+	}
+	if got := paths(); len(got) != 3 {
+		t.Errorf("Expected no open-success for another hotel's room, got requests %v", got)
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const lowBatteryAlert = "LOW_BATTERY"
+
+var alertWebhook string
+var lowBatteryThreshold = 20
+var alertInterval = time.Hour
+
+type Alert struct {
+	HotelID string    `json:"hotelId"`
+	DoorID  string    `json:"doorId"`
+	Type    string    `json:"type"`
+	Detail  string    `json:"detail,omitempty"`
+	Time    time.Time `json:"time"`
+}
+
+// Low battery alerts are repeated at most once per alertInterval for a door,
+// as every telemetry report would otherwise trigger one.
+var lastBatteryAlert = struct {
+	sync.Mutex
+	doors map[string]time.Time
+}{doors: map[string]time.Time{}}
+
+func checkBattery(hotel *HotelServer, doorId string, level int) {
+	if level > lowBatteryThreshold {
+		return
+	}
+
+	lastBatteryAlert.Lock()
+	last, isOk := lastBatteryAlert.doors[doorId]
+	if isOk && time.Since(last) < alertInterval {
+		lastBatteryAlert.Unlock()
+		return
+	}
+	lastBatteryAlert.doors[doorId] = time.Now()
+	lastBatteryAlert.Unlock()
+
+	sendAlert(&Alert{
+		HotelID: hotel.HotelId,
+		DoorID:  doorId,
+		Type:    lowBatteryAlert,
+		Detail:  fmt.Sprintf("battery at %d%%", level),
+		Time:    time.Now(),
+	})
+}
+
+func sendAlert(alert *Alert) {
+	log.Printf("Alert %s for door %s at hotel %s: %s\n", alert.Type, alert.DoorID, alert.HotelID, alert.Detail)
+	if alertWebhook == "" {
+		return
+	}
+
+	data, err := json.Marshal(alert)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	go func() {
+		c := http.Client{Timeout: time.Second * 10}
+		resp, err := c.Post(alertWebhook, "application/json", bytes.NewBuffer(data))
+		if err != nil {
+			log.Printf("Unable to send alert: %v\n", err)
+			return
+		}
+		resp.Body.Close()
+	}()
+}
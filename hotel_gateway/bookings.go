@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/dgraph-io/dgo/protos/api"
+	"github.com/fluidmediaproductions/central_hotel_door_server/clients"
+	"github.com/fluidmediaproductions/central_hotel_door_server/hotel_comms"
+	"github.com/fluidmediaproductions/central_hotel_door_server/utils"
+	"github.com/golang/protobuf/proto"
+	"github.com/gorilla/mux"
+)
+
+// Booking events are queued here until the hotel's server picks them up
+// with its actions and says it's done with them.
+
+type BookingEvent = clients.BookingEvent
+type BookingEventResp = clients.BookingEventResp
+
+var bookingEventActionTypes = map[string]hotel_comms.ActionType{
+	clients.BookingCheckedIn:  hotel_comms.ActionType_BOOKING_CHECK_IN,
+	clients.BookingCheckedOut: hotel_comms.ActionType_BOOKING_CHECK_OUT,
+}
+
+type bookingEventNode struct {
+	ID        string    `json:"uid"`
+	Hotel     *uidRef   `json:"bookingEvent.hotel,omitempty"`
+	Booking   string    `json:"bookingEvent.booking"`
+	Room      string    `json:"bookingEvent.room"`
+	Kind      string    `json:"bookingEvent.kind"`
+	Time      time.Time `json:"bookingEvent.time"`
+	Delivered bool      `json:"bookingEvent.delivered"`
+}
+
+func notifyBooking(w http.ResponseWriter, r *http.Request) {
+	_, err := getServiceClaims(r)
+	if err != nil {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(&BookingEventResp{
+			Err:  err.Error(),
+			Code: serviceAuthCode(err),
+		})
+		return
+	}
+
+	vars := mux.Vars(r)
+
+	hotelId := vars["id"]
+
+	var data BookingEvent
+	err = json.NewDecoder(r.Body).Decode(&data)
+	r.Body.Close()
+	_, isKnown := bookingEventActionTypes[data.Kind]
+	if err != nil || !utils.IsUID(hotelId) || data.BookingID == "" || !isKnown {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(&BookingEventResp{
+			Err:  "bad request data",
+			Code: utils.CodeBadRequest,
+		})
+		return
+	}
+
+	out, err := json.Marshal(&bookingEventNode{
+		ID:      "_:event",
+		Hotel:   &uidRef{ID: hotelId},
+		Booking: data.BookingID,
+		Room:    data.RoomID,
+		Kind:    data.Kind,
+		Time:    data.Time,
+	})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(&BookingEventResp{
+			Err:  err.Error(),
+			Code: utils.CodeInternal,
+		})
+		return
+	}
+
+	assigned, err := db.NewTxn().Mutate(context.Background(), &api.Mutation{SetJson: out, CommitNow: true})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(&BookingEventResp{
+			Err:  err.Error(),
+			Code: utils.CodeInternal,
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(&BookingEventResp{
+		ID: assigned.GetUids()["event"],
+	})
+}
+
+func getPendingBookingEvents(hotelId string) ([]*bookingEventNode, error) {
+	q := `query q($id: string) {
+            hotels(func: uid($id)) {
+              events: ~bookingEvent.hotel @filter(eq(bookingEvent.delivered, false)) (orderasc: bookingEvent.time) {
+                uid
+                bookingEvent.booking
+                bookingEvent.room
+                bookingEvent.kind
+                bookingEvent.time
+              }
+            }
+          }`
+
+	resp, err := db.NewTxn().QueryWithVars(context.Background(), q, map[string]string{"$id": hotelId})
+	if err != nil {
+		return nil, err
+	}
+	var hotels struct {
+		Hotels []struct {
+			Events []*bookingEventNode `json:"events"`
+		} `json:"hotels"`
+	}
+	err = json.Unmarshal(resp.GetJson(), &hotels)
+	if err != nil {
+		return nil, err
+	}
+	if len(hotels.Hotels) == 0 {
+		return nil, nil
+	}
+	return hotels.Hotels[0].Events, nil
+}
+
+// bookingEventActions turns the hotel's pending booking events into actions,
+// with the event as the payload.
+func bookingEventActions(hotelId string) ([]*hotel_comms.Action, error) {
+	events, err := getPendingBookingEvents(hotelId)
+	if err != nil {
+		return nil, err
+	}
+
+	actions := make([]*hotel_comms.Action, 0, len(events))
+	for _, event := range events {
+		actionType, isOk := bookingEventActionTypes[event.Kind]
+		if !isOk {
+			continue
+		}
+		payload, err := proto.Marshal(&hotel_comms.BookingEvent{
+			BookingId: proto.String(event.Booking),
+			RoomId:    proto.String(event.Room),
+			Timestamp: proto.Int64(event.Time.Unix()),
+		})
+		if err != nil {
+			return nil, err
+		}
+		actions = append(actions, &hotel_comms.Action{
+			Type:    &actionType,
+			Id:      proto.String(event.ID),
+			Payload: payload,
+		})
+	}
+	return actions, nil
+}
+
+func isBookingEventAction(actionType hotel_comms.ActionType) bool {
+	return actionType == hotel_comms.ActionType_BOOKING_CHECK_IN ||
+		actionType == hotel_comms.ActionType_BOOKING_CHECK_OUT
+}
+
+// completeBookingEvent marks an event as delivered once the hotel has passed
+// it on, checking it was queued for that hotel.
+func completeBookingEvent(eventId string, hotelId string) error {
+	ctx := context.Background()
+	txn := db.NewTxn()
+	defer txn.Discard(ctx)
+
+	q := `query q($id: string) {
+            events(func: uid($id)) @filter(has(bookingEvent.kind)) {
+              bookingEvent.hotel {
+                uid
+              }
+            }
+          }`
+	resp, err := txn.QueryWithVars(ctx, q, map[string]string{"$id": eventId})
+	if err != nil {
+		return err
+	}
+	var events struct {
+		Events []struct {
+			Hotel []uidRef `json:"bookingEvent.hotel"`
+		} `json:"events"`
+	}
+	err = json.Unmarshal(resp.GetJson(), &events)
+	if err != nil {
+		return err
+	}
+	if len(events.Events) == 0 || len(events.Events[0].Hotel) == 0 || events.Events[0].Hotel[0].ID != hotelId {
+		return errors.New("booking event not for hotel")
+	}
+
+	out, err := json.Marshal(map[string]interface{}{
+		"uid":                    eventId,
+		"bookingEvent.delivered": true,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = txn.Mutate(ctx, &api.Mutation{SetJson: out, CommitNow: true})
+	return err
+}
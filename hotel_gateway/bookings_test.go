@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/fluidmediaproductions/central_hotel_door_server/utils"
+)
+
+func postBookingEvent(hotelId string, jwt string, body string) (*http.Response, *BookingEventResp) {
+	req := httptest.NewRequest("POST", "http://a/hotels/"+hotelId+"/booking-events", strings.NewReader(body))
+	if jwt != "" {
+		req.Header.Set("Authorization", "Bearer "+jwt)
+	}
+	w := httptest.NewRecorder()
+	router().ServeHTTP(w, req)
+
+	resp := w.Result()
+	respBody, _ := ioutil.ReadAll(resp.Body)
+	var eventResp BookingEventResp
+	json.Unmarshal(respBody, &eventResp)
+	return resp, &eventResp
+}
+
+func TestNotifyBooking(t *testing.T) {
+	fake, restore := useFakeDB(t)
+	defer restore()
+
+	event := `{"bookingId": "0x10", "roomId": "0x3", "kind": "checked_in", "time": "2030-01-01T12:00:00Z"}`
+	guest := newTestJWT(t, &utils.User{ID: "0x3"})
+
+	resp, eventResp := postBookingEvent("0x1", "", event)
+	if resp.StatusCode != http.StatusForbidden || eventResp.Code != utils.CodeUnauthenticated {
+		t.Errorf("Expected 403 error without a JWT, got %s %+v", resp.Status, eventResp)
+	}
+	resp, eventResp = postBookingEvent("0x1", guest, event)
+	if resp.StatusCode != http.StatusForbidden || eventResp.Code != utils.CodeForbidden {
+		t.Errorf("Expected 403 error for a guest, got %s %+v", resp.Status, eventResp)
+	}
+
+	service := newServiceTestJWT(t)
+	resp, eventResp = postBookingEvent("foo", service, event)
+	if resp.StatusCode != http.StatusBadRequest || eventResp.Code != utils.CodeBadRequest {
+		t.Errorf("Expected 400 error for a hotel id that isn't a uid, got %s %+v", resp.Status, eventResp)
+	}
+	if len(fake.mutations) != 0 {
+		t.Fatal("Expected no mutations")
+	}
+
+	resp, eventResp = postBookingEvent("0x1", service, event)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected the event to be queued, got %s %+v", resp.Status, eventResp)
+	}
+	if len(fake.mutations) != 1 {
+		t.Fatalf("Expected one mutation, got %d", len(fake.mutations))
+	}
+	var node bookingEventNode
+	err := json.Unmarshal(fake.mutations[0].SetJson, &node)
+	if err != nil || node.Hotel == nil || node.Hotel.ID != "0x1" || node.Booking != "0x10" {
+		t.Errorf("Expected an event for booking 0x10 at hotel 0x1, got %s", string(fake.mutations[0].SetJson))
+	}
+}
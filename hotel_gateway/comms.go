@@ -6,7 +6,6 @@ import (
 	"log"
 	"github.com/fluidmediaproductions/central_hotel_door_server/hotel_comms"
 	"github.com/golang/protobuf/proto"
-	"github.com/jinzhu/gorm"
 	"crypto/x509"
 	"crypto/rsa"
 	"crypto"
@@ -33,13 +32,10 @@ func protoServ(w http.ResponseWriter, r *http.Request) {
 
 	for _, handler := range protoHandlers {
 		if handler.msgType == newMsg.GetType() {
-			hotelServer := &HotelServer{
-				UUID: *newMsg.UUID,
-			}
-			err := db.First(hotelServer).Error
+			hotelServer, err := getHotelServer(newMsg.GetUUID())
 			if err != nil {
-				if err == gorm.ErrRecordNotFound {
-					log.Printf("Hotel %s not found\n", hotelServer.UUID)
+				if err == errHotelServerNotFound {
+					log.Printf("Hotel %s not found\n", newMsg.GetUUID())
 					w.WriteHeader(http.StatusNotFound)
 					return
 				} else {
@@ -88,18 +84,22 @@ func verifySignature(msg []byte, sig []byte, pubKey []byte) error {
 	return nil
 }
 
+func signBytes(msg []byte) ([]byte, error) {
+	reader := rand.Reader
+	hash := crypto.SHA256
+	h := hash.New()
+	h.Write(msg)
+	hashed := h.Sum(nil)
+	return rsa.SignPKCS1v15(reader, status.PrivateKey, hash, hashed)
+}
+
 func sendMsg(msg proto.Message, msgType hotel_comms.MsgType, w http.ResponseWriter) error {
 	msgBytes, err := proto.Marshal(msg)
 	if err != nil {
 		return err
 	}
 
-	reader := rand.Reader
-	hash := crypto.SHA256
-	h := hash.New()
-	h.Write(msgBytes)
-	hashed := h.Sum(nil)
-	sig, err := rsa.SignPKCS1v15(reader, status.PrivateKey, hash, hashed)
+	sig, err := signBytes(msgBytes)
 	if err != nil {
 		return err
 	}
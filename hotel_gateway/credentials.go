@@ -0,0 +1,347 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/dgraph-io/dgo/protos/api"
+	"github.com/fluidmediaproductions/central_hotel_door_server/clients"
+	"github.com/fluidmediaproductions/central_hotel_door_server/hotel_comms"
+	"github.com/fluidmediaproductions/central_hotel_door_server/utils"
+	"github.com/golang/protobuf/proto"
+	"github.com/gorilla/mux"
+)
+
+// A credential lets a hotel controller unlock doors for a booking without
+// asking the server, so guests can still get in while the hotel is offline.
+// Controllers check the signature against the same server key they use for
+// every other message.
+
+type CredentialZone = clients.CredentialZone
+type CredentialRequest = clients.CredentialRequest
+type CredentialResp = clients.CredentialResp
+type RevokeCredentialsResp = clients.RevokeCredentialsResp
+
+type credentialNode struct {
+	ID       string    `json:"uid"`
+	Booking  *uidRef   `json:"credential.booking,omitempty"`
+	Hotel    *uidRef   `json:"credential.hotel,omitempty"`
+	Issued   time.Time `json:"credential.issued"`
+	NotAfter time.Time `json:"credential.notAfter"`
+	Revoked  bool      `json:"credential.revoked"`
+}
+
+var errNotService = errors.New("only other services may call this")
+
+// getServiceClaims checks the request is from one of the other services
+// rather than a user, for the calls only services make, such as signing or
+// revoking credentials.
+func getServiceClaims(r *http.Request) (*utils.JWTClaims, error) {
+	claims, err := utils.GetRequestJWT(r, jwtSecret)
+	if err != nil {
+		return nil, err
+	}
+	if !claims.User.HasRole(utils.RoleService) {
+		return nil, errNotService
+	}
+	return claims, nil
+}
+
+func serviceAuthCode(err error) string {
+	if err == errNotService {
+		return utils.CodeForbidden
+	}
+	return utils.CodeUnauthenticated
+}
+
+func issueCredential(w http.ResponseWriter, r *http.Request) {
+	_, err := getServiceClaims(r)
+	if err != nil {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(&CredentialResp{
+			Err:  err.Error(),
+			Code: serviceAuthCode(err),
+		})
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(&CredentialResp{
+			Err:  err.Error(),
+			Code: utils.CodeBadRequest,
+		})
+		return
+	}
+	defer r.Body.Close()
+
+	var data CredentialRequest
+	err = json.Unmarshal(body, &data)
+	if err != nil || data.BookingID == "" || data.HotelID == "" || !data.NotAfter.After(data.NotBefore) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(&CredentialResp{
+			Err:  "bad request data",
+			Code: utils.CodeBadRequest,
+		})
+		return
+	}
+
+	issued := time.Now()
+	node := &credentialNode{
+		ID:       "_:credential",
+		Booking:  &uidRef{ID: data.BookingID},
+		Hotel:    &uidRef{ID: data.HotelID},
+		Issued:   issued,
+		NotAfter: data.NotAfter,
+	}
+	out, err := json.Marshal(node)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(&CredentialResp{
+			Err:  err.Error(),
+			Code: utils.CodeInternal,
+		})
+		return
+	}
+
+	ctx := context.Background()
+	txn := db.NewTxn()
+	defer txn.Discard(ctx)
+
+	assigned, err := txn.Mutate(ctx, &api.Mutation{SetJson: out})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(&CredentialResp{
+			Err:  err.Error(),
+			Code: utils.CodeInternal,
+		})
+		return
+	}
+	id := assigned.GetUids()["credential"]
+
+	credential := &hotel_comms.DoorCredential{
+		CredentialId: proto.String(id),
+		BookingId:    proto.String(data.BookingID),
+		HotelId:      proto.String(data.HotelID),
+		NotBefore:    proto.Int64(data.NotBefore.Unix()),
+		NotAfter:     proto.Int64(data.NotAfter.Unix()),
+		IssuedAt:     proto.Int64(issued.Unix()),
+	}
+	if data.RoomID != "" {
+		credential.RoomId = proto.String(data.RoomID)
+	}
+	for _, zone := range data.Zones {
+		credZone := &hotel_comms.CredentialZone{
+			ZoneId:  proto.String(zone.ZoneID),
+			DoorIds: zone.DoorIDs,
+		}
+		for _, day := range zone.Days {
+			credZone.Days = append(credZone.Days, int32(day))
+		}
+		if zone.From != "" {
+			credZone.From = proto.String(zone.From)
+		}
+		if zone.To != "" {
+			credZone.To = proto.String(zone.To)
+		}
+		credential.Zones = append(credential.Zones, credZone)
+	}
+
+	credBytes, err := proto.Marshal(credential)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(&CredentialResp{
+			Err:  err.Error(),
+			Code: utils.CodeInternal,
+		})
+		return
+	}
+	sig, err := signBytes(credBytes)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(&CredentialResp{
+			Err:  err.Error(),
+			Code: utils.CodeInternal,
+		})
+		return
+	}
+	signed, err := proto.Marshal(&hotel_comms.SignedCredential{
+		Credential: credBytes,
+		Sig:        sig,
+	})
+	if err == nil {
+		err = txn.Commit(ctx)
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(&CredentialResp{
+			Err:  err.Error(),
+			Code: utils.CodeInternal,
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(&CredentialResp{
+		CredentialID: id,
+		Credential:   signed,
+		NotBefore:    data.NotBefore,
+		NotAfter:     data.NotAfter,
+	})
+}
+
+func revokeCredentials(ctx context.Context, q string, id string) (int, error) {
+	txn := db.NewTxn()
+	defer txn.Discard(ctx)
+
+	resp, err := txn.QueryWithVars(ctx, q, map[string]string{"$id": id})
+	if err != nil {
+		return 0, err
+	}
+	var credentials struct {
+		Credentials []*credentialNode `json:"credentials"`
+	}
+	err = json.Unmarshal(resp.GetJson(), &credentials)
+	if err != nil {
+		return 0, err
+	}
+
+	revoked := make([]map[string]interface{}, 0)
+	for _, credential := range credentials.Credentials {
+		if credential.Revoked {
+			continue
+		}
+		revoked = append(revoked, map[string]interface{}{
+			"uid":                credential.ID,
+			"credential.revoked": true,
+		})
+	}
+	if len(revoked) == 0 {
+		return 0, nil
+	}
+
+	out, err := json.Marshal(revoked)
+	if err != nil {
+		return 0, err
+	}
+	_, err = txn.Mutate(ctx, &api.Mutation{SetJson: out, CommitNow: true})
+	if err != nil {
+		return 0, err
+	}
+	return len(revoked), nil
+}
+
+func writeRevokeAuthError(w http.ResponseWriter, err error) {
+	w.WriteHeader(http.StatusForbidden)
+	json.NewEncoder(w).Encode(&RevokeCredentialsResp{
+		Err:  err.Error(),
+		Code: serviceAuthCode(err),
+	})
+}
+
+func writeRevokeResp(w http.ResponseWriter, revoked int, err error) {
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(&RevokeCredentialsResp{
+			Err:  err.Error(),
+			Code: utils.CodeInternal,
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(&RevokeCredentialsResp{
+		Revoked: revoked,
+	})
+}
+
+func revokeCredential(w http.ResponseWriter, r *http.Request) {
+	_, err := getServiceClaims(r)
+	if err != nil {
+		writeRevokeAuthError(w, err)
+		return
+	}
+
+	vars := mux.Vars(r)
+
+	id := vars["id"]
+
+	q := `query q($id: string) {
+            credentials(func: uid($id)) @filter(has(credential.booking)) {
+              uid
+              credential.revoked
+            }
+          }`
+
+	revoked, err := revokeCredentials(context.Background(), q, id)
+	writeRevokeResp(w, revoked, err)
+}
+
+func revokeBookingCredentials(w http.ResponseWriter, r *http.Request) {
+	_, err := getServiceClaims(r)
+	if err != nil {
+		writeRevokeAuthError(w, err)
+		return
+	}
+
+	vars := mux.Vars(r)
+
+	id := vars["id"]
+
+	q := `query q($id: string) {
+            bookings(func: uid($id)) {
+              credentials as ~credential.booking
+            }
+            credentials(func: uid(credentials)) {
+              uid
+              credential.revoked
+            }
+          }`
+
+	revoked, err := revokeCredentials(context.Background(), q, id)
+	writeRevokeResp(w, revoked, err)
+}
+
+// getRevokedCredentials lists the hotel's revoked credentials that haven't
+// expired yet, as controllers will reject expired ones anyway.
+func getRevokedCredentials(hotelId string) ([]string, error) {
+	ctx := context.Background()
+	txn := db.NewTxn()
+
+	variables := map[string]string{
+		"$id":  hotelId,
+		"$now": time.Now().Format(time.RFC3339),
+	}
+	q := `query q($id: string, $now: string) {
+            hotels(func: uid($id)) {
+              ~credential.hotel @filter(eq(credential.revoked, true) AND ge(credential.notAfter, $now)) {
+                uid
+              }
+	        }
+          }`
+
+	resp, err := txn.QueryWithVars(ctx, q, variables)
+	if err != nil {
+		return nil, err
+	}
+	var hotels struct {
+		Hotels []struct {
+			Credentials []*uidRef `json:"~credential.hotel"`
+		} `json:"hotels"`
+	}
+	err = json.Unmarshal(resp.GetJson(), &hotels)
+	if err != nil {
+		return nil, err
+	}
+
+	revoked := make([]string, 0)
+	for _, hotel := range hotels.Hotels {
+		for _, credential := range hotel.Credentials {
+			revoked = append(revoked, credential.ID)
+		}
+	}
+	return revoked, nil
+}
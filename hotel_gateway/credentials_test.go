@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/fluidmediaproductions/central_hotel_door_server/utils"
+)
+
+func newServiceTestJWT(t *testing.T) string {
+	jwt, err := utils.NewServiceJWT("bookings", jwtSecret)
+	if err != nil {
+		t.Fatalf("Error making JWT: %v", err)
+	}
+	return jwt
+}
+
+func TestCredentialsAuth(t *testing.T) {
+	fake, restore := useFakeDB(t)
+	defer restore()
+
+	admin := newTestJWT(t, &utils.User{ID: "0x9", Roles: []string{utils.RoleAdmin, utils.RoleSecurity}})
+	guest := newTestJWT(t, &utils.User{ID: "0x3"})
+
+	for _, req := range []struct{ method, path string }{
+		{"POST", "/credentials"},
+		{"POST", "/credentials/0x20/revoke"},
+		{"POST", "/credentials/by-booking/0x10/revoke"},
+	} {
+		resp, body := doRequest(req.method, "http://a"+req.path, "")
+		var errResp RevokeCredentialsResp
+		json.Unmarshal(body, &errResp)
+		if resp.StatusCode != http.StatusForbidden || errResp.Code != utils.CodeUnauthenticated {
+			t.Errorf("%s: expected 403 error without a JWT, got %s %s", req.path, resp.Status, string(body))
+		}
+		for _, jwt := range []string{guest, admin} {
+			resp, body = doRequest(req.method, "http://a"+req.path, jwt)
+			errResp = RevokeCredentialsResp{}
+			json.Unmarshal(body, &errResp)
+			if resp.StatusCode != http.StatusForbidden || errResp.Code != utils.CodeForbidden {
+				t.Errorf("%s: expected 403 error for a user, got %s %s", req.path, resp.Status, string(body))
+			}
+		}
+	}
+	if len(fake.mutations) != 0 {
+		t.Fatal("Expected no mutations")
+	}
+
+	service := newServiceTestJWT(t)
+
+	// Past the auth check, the missing body is rejected
+	resp, body := doRequest("POST", "http://a/credentials", service)
+	var credResp CredentialResp
+	json.Unmarshal(body, &credResp)
+	if resp.StatusCode != http.StatusBadRequest || credResp.Code != utils.CodeBadRequest {
+		t.Errorf("Expected 400 error for a service without a request, got %s %s", resp.Status, string(body))
+	}
+
+	fake.expectQuery("~credential.booking", `{
+		"credentials": [
+			{"uid": "0x20", "credential.revoked": false},
+			{"uid": "0x21", "credential.revoked": true}
+		]
+	}`)
+	resp, body = doRequest("POST", "http://a/credentials/by-booking/0x10/revoke", service)
+	var revokeResp RevokeCredentialsResp
+	err := json.Unmarshal(body, &revokeResp)
+	if err != nil || resp.StatusCode != http.StatusOK || revokeResp.Revoked != 1 {
+		t.Errorf("Expected one credential revoked, got %s %s", resp.Status, string(body))
+	}
+	if len(fake.mutations) != 1 {
+		t.Errorf("Expected one mutation, got %d", len(fake.mutations))
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"context"
+	"errors"
+
+	"github.com/fluidmediaproductions/central_hotel_door_server/clients"
+)
+
+const HotelsServer = "http://hotels"
+
+var hotelsClient = clients.NewHotelsClient(HotelsServer)
+
+func getDoorsByHotel(hotel string) ([]*clients.Door, error) {
+	return hotelsClient.GetDoorsByHotel(context.Background(), hotel)
+}
+
+func completeDoorUnlock(doorId string, hotelId string) error {
+	ctx := context.Background()
+
+	door, err := hotelsClient.GetDoor(ctx, doorId)
+	if err != nil {
+		return err
+	}
+	if door == nil {
+		return errors.New("unable to get door")
+	}
+
+	if hotelId != door.HotelID {
+		return errors.New("door not in hotel")
+	}
+
+	_, err = hotelsClient.OpenDoorSuccess(ctx, doorId)
+	return err
+}
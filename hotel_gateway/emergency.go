@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/fluidmediaproductions/central_hotel_door_server/hotel_comms"
+	"github.com/golang/protobuf/proto"
+)
+
+const (
+	emergencyNormal   = "normal"
+	emergencyRelease  = "release"
+	emergencyLockdown = "lockdown"
+)
+
+type emergencyState struct {
+	Mode  string
+	Since time.Time
+	Acked bool
+}
+
+func getEmergencyState(hotelId string) (*emergencyState, error) {
+	respState, err := hotelsClient.GetEmergencyState(context.Background(), "", hotelId)
+	if err != nil {
+		return nil, err
+	}
+
+	state := &emergencyState{
+		Mode: emergencyNormal,
+	}
+	if respState == nil {
+		return state, nil
+	}
+	if respState.Mode != "" {
+		state.Mode = respState.Mode
+	}
+	state.Acked = respState.Acked
+	if respState.Since != nil {
+		state.Since = *respState.Since
+	}
+	return state, nil
+}
+
+// emergencyActions returns the action a hotel has to apply straight away for
+// its emergency mode, if it hasn't done so yet. The action ID is the mode's
+// start time so the ack can be matched to it.
+func emergencyActions(state *emergencyState) []*hotel_comms.Action {
+	if state.Acked || state.Since.IsZero() {
+		return nil
+	}
+
+	var actionType hotel_comms.ActionType
+	switch state.Mode {
+	case emergencyRelease:
+		actionType = hotel_comms.ActionType_EMERGENCY_RELEASE_ALL
+	case emergencyLockdown:
+		actionType = hotel_comms.ActionType_EMERGENCY_LOCKDOWN
+	default:
+		actionType = hotel_comms.ActionType_EMERGENCY_CLEAR
+	}
+
+	return []*hotel_comms.Action{{
+		Type: &actionType,
+		Id:   proto.String(fmt.Sprint(state.Since.Unix())),
+	}}
+}
+
+func isEmergencyAction(actionType hotel_comms.ActionType) bool {
+	return actionType == hotel_comms.ActionType_EMERGENCY_RELEASE_ALL ||
+		actionType == hotel_comms.ActionType_EMERGENCY_LOCKDOWN ||
+		actionType == hotel_comms.ActionType_EMERGENCY_CLEAR
+}
+
+func completeEmergency(actionId string, hotelId string) error {
+	_, err := hotelsClient.AckEmergency(context.Background(), hotelId, actionId)
+	return err
+}
@@ -22,6 +22,9 @@ import (
 const addr = ":80"
 
 var db *dgo.Dgraph
+var jwtSecret []byte
+
+var errHotelServerNotFound = errors.New("hotel server not found")
 
 type Status struct {
 	PrivateKey *rsa.PrivateKey
@@ -63,6 +66,14 @@ var protoHandlers = []ProtoHandler{
 		msgType: hotel_comms.MsgType_ACTION_COMPLETE,
 		handler: actionComplete,
 	},
+	{
+		msgType: hotel_comms.MsgType_LOCK_TELEMETRY,
+		handler: lockTelemetry,
+	},
+	{
+		msgType: hotel_comms.MsgType_LOCK_EVENT,
+		handler: lockEvent,
+	},
 }
 
 type hotelQuery struct {
@@ -75,6 +86,63 @@ type hotelQuery struct {
 	} `json:"hotels"`
 }
 
+// getHotelServer finds a hotel's server by the UUID it sends its messages
+// with.
+func getHotelServer(uuid string) (*HotelServer, error) {
+	ctx := context.Background()
+	txn := db.NewTxn()
+
+	q := `query q($uuid: string) {
+            servers(func: eq(hotelServer.uuid, $uuid)) {
+              uid
+              hotelServer.uuid
+              hotelServer.lastSeen
+              hotelServer.online
+              hotelServer.pubKey
+              hotelServer.hotel {
+                uid
+              }
+	        }
+          }`
+
+	resp, err := txn.QueryWithVars(ctx, q, map[string]string{"$uuid": uuid})
+	if err != nil {
+		return nil, err
+	}
+	var servers struct {
+		Servers []struct {
+			ID       string     `json:"uid"`
+			UUID     string     `json:"hotelServer.uuid"`
+			LastSeen *time.Time `json:"hotelServer.lastSeen"`
+			Online   bool       `json:"hotelServer.online"`
+			PubKey   []byte     `json:"hotelServer.pubKey"`
+			Hotel    []*uidRef  `json:"hotelServer.hotel"`
+		} `json:"servers"`
+	}
+	err = json.Unmarshal(resp.GetJson(), &servers)
+	if err != nil {
+		return nil, err
+	}
+	if len(servers.Servers) == 0 {
+		return nil, errHotelServerNotFound
+	}
+
+	server := servers.Servers[0]
+	hotelServer := &HotelServer{
+		ID:        server.ID,
+		UUID:      server.UUID,
+		Online:    server.Online,
+		PublicKey: server.PubKey,
+	}
+	if server.LastSeen != nil {
+		hotelServer.LastSeen = *server.LastSeen
+	}
+	if len(server.Hotel) > 0 {
+		hotelServer.HotelId = server.Hotel[0].ID
+	}
+	return hotelServer, nil
+}
+
 func getHotels() (*hotelQuery, error) {
 	ctx := context.Background()
 	txn := db.NewTxn()
@@ -154,7 +222,18 @@ func hotelPing(hotel *HotelServer, msg []byte, sig []byte, w http.ResponseWriter
 
 	hotel.LastSeen = time.Now()
 	hotel.Online = true
-	db.Save(hotel)
+	seen, err := json.Marshal(map[string]interface{}{
+		"uid":                  hotel.ID,
+		"hotelServer.lastSeen": hotel.LastSeen,
+		"hotelServer.online":   true,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = db.NewTxn().Mutate(context.Background(), &api.Mutation{SetJson: seen, CommitNow: true})
+	if err != nil {
+		return err
+	}
 
 	actions, err := getActions(hotel.HotelId)
 	if err != nil {
@@ -162,9 +241,30 @@ func hotelPing(hotel *HotelServer, msg []byte, sig []byte, w http.ResponseWriter
 	}
 	actionRequired := len(actions) != 0
 
+	state, err := getEmergencyState(hotel.HotelId)
+	if err != nil {
+		return err
+	}
+
+	revoked, err := getRevokedCredentials(hotel.HotelId)
+	if err != nil {
+		return err
+	}
+
 	resp := &hotel_comms.HotelPingResp{
-		Success:        proto.Bool(true),
-		ActionRequired: proto.Bool(actionRequired),
+		Success:            proto.Bool(true),
+		ActionRequired:     proto.Bool(actionRequired),
+		PriorityActions:    emergencyActions(state),
+		RevokedCredentials: revoked,
+	}
+
+	// Times sent to the hotel are Unix times, so it's told its time zone to
+	// show them on its own clock
+	hotelInfo, err := hotelsClient.GetHotel(context.Background(), hotel.HotelId)
+	if err != nil {
+		log.Printf("Error getting hotel %v: %v\n", hotel.HotelId, err)
+	} else {
+		resp.TimeZone = proto.String(hotelInfo.Zone().String())
 	}
 
 	w.WriteHeader(http.StatusOK)
@@ -185,11 +285,32 @@ func newDbClient(dbHost string) *dgo.Dgraph {
 func setupSchema(c *dgo.Dgraph) {
 	err := c.Alter(context.Background(), &api.Operation{
 		Schema: `
-			hotelServer.uuid: string .
+			hotelServer.uuid: string @index(exact) .
 			hotelServer.hotel: uid @reverse .
 			hotelServer.lastSeen: dateTime .
 			hotelServer.online: bool .
 			hotelServer.pubKey: string .
+			lockReading.hotel: uid @reverse .
+			lockReading.door: string @index(exact) .
+			lockReading.battery: int .
+			lockReading.doorOpen: bool .
+			lockReading.time: dateTime @index(hour) .
+			lockEvent.hotel: uid @reverse .
+			lockEvent.door: string @index(exact) .
+			lockEvent.type: string @index(exact) .
+			lockEvent.time: dateTime @index(hour) .
+			lockEvent.detail: string .
+			credential.booking: uid @reverse .
+			credential.hotel: uid @reverse .
+			credential.issued: dateTime .
+			credential.notAfter: dateTime @index(hour) .
+			credential.revoked: bool @index(bool) .
+			bookingEvent.hotel: uid @reverse .
+			bookingEvent.booking: string @index(exact) .
+			bookingEvent.room: string .
+			bookingEvent.kind: string .
+			bookingEvent.time: dateTime @index(hour) .
+			bookingEvent.delivered: bool @index(bool) .
 		`,
 	})
 	if err != nil {
@@ -199,11 +320,15 @@ func setupSchema(c *dgo.Dgraph) {
 
 func main() {
 	viper.SetDefault("DB_HOST", "dgraph-server-public:9080")
+	viper.SetDefault("LOW_BATTERY_THRESHOLD", 20)
 
 	viper.SetEnvPrefix("TRAVELR")
 	viper.AutomaticEnv()
 
 	dbHost := viper.GetString("DB_HOST")
+	jwtSecret = []byte(viper.GetString("JWT_SECRET"))
+	alertWebhook = viper.GetString("ALERT_WEBHOOK")
+	lowBatteryThreshold = viper.GetInt("LOW_BATTERY_THRESHOLD")
 
 	db = newDbClient(dbHost)
 
@@ -218,8 +343,19 @@ func main() {
 
 	go checkHotels()
 
+	log.Printf("Listening on %s\n", addr)
+	log.Fatalln(http.ListenAndServe(addr, router()))
+}
+
+func router() *mux.Router {
 	r := mux.NewRouter()
 	r.Methods("POST").Path("/proto").HandlerFunc(protoServ)
-	log.Printf("Listening on %s\n", addr)
-	log.Fatalln(http.ListenAndServe(addr, r))
+	r.Methods("GET").Path("/hotels/{id}/locks").HandlerFunc(getLockHealth)
+	r.Methods("GET").Path("/hotels/{id}/alarms").HandlerFunc(getLockAlarms)
+	r.Methods("GET").Path("/hotels/{id}/status").HandlerFunc(getHotelStatus)
+	r.Methods("POST").Path("/hotels/{id}/booking-events").HandlerFunc(notifyBooking)
+	r.Methods("POST").Path("/credentials").HandlerFunc(issueCredential)
+	r.Methods("POST").Path("/credentials/{id}/revoke").HandlerFunc(revokeCredential)
+	r.Methods("POST").Path("/credentials/by-booking/{id}/revoke").HandlerFunc(revokeBookingCredentials)
+	return r
 }
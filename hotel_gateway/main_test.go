@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dgraph-io/dgo"
+	"github.com/dgraph-io/dgo/protos/api"
+	"github.com/fluidmediaproductions/central_hotel_door_server/utils"
+	"google.golang.org/grpc"
+)
+
+// fakeDgraph stands in for a Dgraph server. Each query is answered with the
+// JSON of the first expectation whose text it contains, and mutations are
+// recorded for the test to look at.
+type fakeDgraph struct {
+	api.DgraphClient
+	t         *testing.T
+	queries   []*fakeQuery
+	mutations []*api.Mutation
+}
+
+type fakeQuery struct {
+	contains string
+	json     string
+	err      error
+}
+
+func (f *fakeDgraph) expectQuery(contains string, json string) {
+	f.queries = append(f.queries, &fakeQuery{contains: contains, json: json})
+}
+
+func (f *fakeDgraph) failQuery(contains string, err error) {
+	f.queries = append(f.queries, &fakeQuery{contains: contains, err: err})
+}
+
+func (f *fakeDgraph) Query(ctx context.Context, in *api.Request, opts ...grpc.CallOption) (*api.Response, error) {
+	for _, query := range f.queries {
+		if strings.Contains(in.Query, query.contains) {
+			if query.err != nil {
+				return nil, query.err
+			}
+			return &api.Response{Json: []byte(query.json)}, nil
+		}
+	}
+	f.t.Errorf("Unexpected query %s", in.Query)
+	return nil, errors.New("unexpected query")
+}
+
+func (f *fakeDgraph) Mutate(ctx context.Context, in *api.Mutation, opts ...grpc.CallOption) (*api.Assigned, error) {
+	f.mutations = append(f.mutations, in)
+	return &api.Assigned{Uids: map[string]string{}}, nil
+}
+
+// useFakeDB points the service at a fake Dgraph until the returned func is
+// called.
+func useFakeDB(t *testing.T) (*fakeDgraph, func()) {
+	fake := &fakeDgraph{t: t}
+	oldDb := db
+	db = dgo.NewDgraphClient(fake)
+	return fake, func() {
+		db = oldDb
+	}
+}
+
+func newTestJWT(t *testing.T, user *utils.User) string {
+	jwt, err := utils.NewJWT(user, jwtSecret)
+	if err != nil {
+		t.Fatalf("Error making JWT: %v", err)
+	}
+	return jwt
+}
+
+func doRequest(method string, url string, jwt string) (*http.Response, []byte) {
+	req := httptest.NewRequest(method, url, nil)
+	if jwt != "" {
+		req.Header.Set("Authorization", "Bearer "+jwt)
+	}
+	w := httptest.NewRecorder()
+	router().ServeHTTP(w, req)
+
+	resp := w.Result()
+	body, _ := ioutil.ReadAll(resp.Body)
+	return resp, body
+}
@@ -1,38 +1,21 @@
 package main
 
 import (
+	"context"
 	"net/http"
-	"fmt"
-	"github.com/fluidmediaproductions/central_hotel_door_server/utils"
-	"errors"
+	"strconv"
+
+	"github.com/fluidmediaproductions/central_hotel_door_server/clients"
 	"github.com/fluidmediaproductions/central_hotel_door_server/hotel_comms"
 	"github.com/golang/protobuf/proto"
 )
 
 const RoomsServer = "http://rooms"
 
-func getRoomsByHotel(hotel uint) ([]interface{}, error) {
-	req, err := http.NewRequest("GET", RoomsServer+fmt.Sprintf("/rooms/by-hotel/%d", hotel), nil)
-	if err != nil {
-		return nil, err
-	}
-
-	resp, err := utils.GetJson(req)
-	if err != nil {
-		return nil, err
-	}
-	respErr, isOk := resp["err"].(string)
-	if isOk {
-		if respErr != "" {
-			return nil, errors.New(respErr)
-		}
-	}
+var roomsClient = clients.NewRoomsClient(RoomsServer)
 
-	rooms, isOk := resp["rooms"].([]interface{})
-	if isOk {
-		return rooms, nil
-	}
-	return nil, nil
+func getRoomsByHotel(hotel string) ([]*clients.Room, error) {
+	return roomsClient.GetRoomsByHotel(context.Background(), hotel)
 }
 
 func getDoors(hotel *HotelServer, msg []byte, sig []byte, w http.ResponseWriter) error {
@@ -49,20 +32,16 @@ func getDoors(hotel *HotelServer, msg []byte, sig []byte, w http.ResponseWriter)
 
 	doors := make([]*hotel_comms.Door, 0)
 	for _, room := range rooms {
-		room, isOk := room.(map[string]interface{})
-		if isOk {
-			name, isOk := room["name"].(string)
-			if isOk {
-				id, isOk := room["ID"].(float64)
-				if isOk {
-					door := &hotel_comms.Door{
-						Id:   proto.Int64(int64(id)),
-						Name: proto.String(name),
-					}
-					doors = append(doors, door)
-				}
-			}
+		// Controllers number their doors, so use the room's uid as a number
+		id, err := strconv.ParseInt(room.ID, 0, 64)
+		if err != nil {
+			continue
+		}
+		door := &hotel_comms.Door{
+			Id:   proto.Int64(id),
+			Name: proto.String(room.Name),
 		}
+		doors = append(doors, door)
 	}
 
 	resp := &hotel_comms.GetDoorsResp{
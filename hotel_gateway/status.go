@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/fluidmediaproductions/central_hotel_door_server/clients"
+	"github.com/fluidmediaproductions/central_hotel_door_server/utils"
+	"github.com/gorilla/mux"
+)
+
+// A hotel server that hasn't pinged for this long is taken to be offline,
+// the same as in checkHotels.
+const hotelOfflineAfter = time.Minute
+
+type HotelStatus = clients.HotelStatus
+type HotelStatusResp = clients.HotelStatusResp
+
+var errNotStatusRole = errors.New("hotel status needs the admin or security role")
+
+// getStatusClaims checks the request is from staff allowed to see a hotel's
+// locks, or from a service checking on behalf of a guest.
+func getStatusClaims(r *http.Request) (*utils.JWTClaims, error) {
+	claims, err := utils.GetRequestJWT(r, jwtSecret)
+	if err != nil {
+		return nil, err
+	}
+	if !claims.User.HasRole(utils.RoleAdmin, utils.RoleSecurity, utils.RoleService) {
+		return nil, errNotStatusRole
+	}
+	return claims, nil
+}
+
+// getHotelStatus reports whether any of a hotel's servers are online, so
+// callers can tell guests their door won't open before they wait for it.
+func getHotelStatus(w http.ResponseWriter, r *http.Request) {
+	_, err := getStatusClaims(r)
+	if err != nil {
+		code := utils.CodeUnauthenticated
+		if err == errNotStatusRole {
+			code = utils.CodeForbidden
+		}
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(&HotelStatusResp{
+			Err:  err.Error(),
+			Code: code,
+		})
+		return
+	}
+
+	vars := mux.Vars(r)
+
+	id := vars["id"]
+
+	ctx := context.Background()
+	txn := db.NewTxn()
+
+	q := `query q($id: string) {
+            hotels(func: uid($id)) {
+              ~hotelServer.hotel {
+                hotelServer.online
+                hotelServer.lastSeen
+              }
+            }
+          }`
+
+	resp, err := txn.QueryWithVars(ctx, q, map[string]string{"$id": id})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(&HotelStatusResp{
+			Err:  err.Error(),
+			Code: utils.CodeInternal,
+		})
+		return
+	}
+	var hotels struct {
+		Hotels []struct {
+			Servers []struct {
+				Online   bool       `json:"hotelServer.online"`
+				LastSeen *time.Time `json:"hotelServer.lastSeen"`
+			} `json:"~hotelServer.hotel"`
+		} `json:"hotels"`
+	}
+	err = json.Unmarshal(resp.GetJson(), &hotels)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(&HotelStatusResp{
+			Err:  err.Error(),
+			Code: utils.CodeInternal,
+		})
+		return
+	}
+
+	status := &HotelStatus{
+		HotelID: id,
+	}
+	for _, hotel := range hotels.Hotels {
+		for _, server := range hotel.Servers {
+			if server.LastSeen == nil {
+				continue
+			}
+			if status.LastSeen == nil || server.LastSeen.After(*status.LastSeen) {
+				status.LastSeen = server.LastSeen
+			}
+			if server.Online && time.Since(*server.LastSeen) <= hotelOfflineAfter {
+				status.Online = true
+			}
+		}
+	}
+
+	json.NewEncoder(w).Encode(&HotelStatusResp{
+		Status: status,
+	})
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/fluidmediaproductions/central_hotel_door_server/utils"
+)
+
+func TestGetHotelStatus(t *testing.T) {
+	fake, restore := useFakeDB(t)
+	defer restore()
+
+	guest := newTestJWT(t, &utils.User{ID: "0x3"})
+
+	resp, body := doRequest("GET", "http://a/hotels/0x1/status", "")
+	var errResp HotelStatusResp
+	json.Unmarshal(body, &errResp)
+	if resp.StatusCode != http.StatusForbidden || errResp.Code != utils.CodeUnauthenticated {
+		t.Errorf("Expected 403 error without a JWT, got %s %s", resp.Status, string(body))
+	}
+	resp, body = doRequest("GET", "http://a/hotels/0x1/status", guest)
+	errResp = HotelStatusResp{}
+	json.Unmarshal(body, &errResp)
+	if resp.StatusCode != http.StatusForbidden || errResp.Code != utils.CodeForbidden {
+		t.Errorf("Expected 403 error for a guest, got %s %s", resp.Status, string(body))
+	}
+	if len(fake.queries) != 0 {
+		t.Fatal("Expected no queries")
+	}
+
+	lastSeen := time.Now().Add(-time.Second).UTC().Format(time.RFC3339)
+	fake.expectQuery("~hotelServer.hotel", `{
+		"hotels": [{
+			"~hotelServer.hotel": [
+				{"hotelServer.online": false, "hotelServer.lastSeen": "2030-01-01T12:00:00Z"},
+				{"hotelServer.online": true, "hotelServer.lastSeen": "`+lastSeen+`"}
+			]
+		}]
+	}`)
+	security := newTestJWT(t, &utils.User{ID: "0x9", Roles: []string{utils.RoleSecurity}})
+	for _, jwt := range []string{security, newServiceTestJWT(t)} {
+		resp, body = doRequest("GET", "http://a/hotels/0x1/status", jwt)
+		var status HotelStatusResp
+		err := json.Unmarshal(body, &status)
+		if err != nil || resp.StatusCode != http.StatusOK || status.Status == nil {
+			t.Fatalf("Expected the hotel's status, got %s %s", resp.Status, string(body))
+		}
+		if !status.Status.Online || status.Status.HotelID != "0x1" {
+			t.Errorf("Expected hotel 0x1 to be online, got %+v", status.Status)
+		}
+	}
+}
@@ -0,0 +1,330 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/dgraph-io/dgo/protos/api"
+	"github.com/fluidmediaproductions/central_hotel_door_server/hotel_comms"
+	"github.com/fluidmediaproductions/central_hotel_door_server/utils"
+	"github.com/golang/protobuf/proto"
+	"github.com/gorilla/mux"
+)
+
+type LockHealth struct {
+	DoorID       string    `json:"doorId"`
+	BatteryLevel int       `json:"batteryLevel"`
+	LowBattery   bool      `json:"lowBattery"`
+	DoorOpen     bool      `json:"doorOpen"`
+	LastSeen     time.Time `json:"lastSeen"`
+}
+
+type LockAlarm struct {
+	ID     string    `json:"uid"`
+	DoorID string    `json:"doorId"`
+	Type   string    `json:"type"`
+	Time   time.Time `json:"time"`
+	Detail string    `json:"detail"`
+}
+
+type LockHealthResp struct {
+	Err   string        `json:"err"`
+	Code  string        `json:"code,omitempty"`
+	Locks []*LockHealth `json:"locks"`
+}
+
+type LockAlarmsResp struct {
+	Err    string       `json:"err"`
+	Code   string       `json:"code,omitempty"`
+	Alarms []*LockAlarm `json:"alarms"`
+}
+
+type lockReading struct {
+	Hotel    *uidRef   `json:"lockReading.hotel"`
+	Door     string    `json:"lockReading.door"`
+	Battery  int32     `json:"lockReading.battery"`
+	DoorOpen bool      `json:"lockReading.doorOpen"`
+	Time     time.Time `json:"lockReading.time"`
+}
+
+type lockEventNode struct {
+	Hotel  *uidRef   `json:"lockEvent.hotel"`
+	Door   string    `json:"lockEvent.door"`
+	Type   string    `json:"lockEvent.type"`
+	Time   time.Time `json:"lockEvent.time"`
+	Detail string    `json:"lockEvent.detail,omitempty"`
+}
+
+type uidRef struct {
+	ID string `json:"uid"`
+}
+
+// How far back to look for readings and alarms when reporting on a hotel.
+const telemetryWindow = time.Hour * 24
+
+func lockTelemetry(hotel *HotelServer, msg []byte, sig []byte, w http.ResponseWriter) error {
+	newMsg := &hotel_comms.LockTelemetry{}
+	err := proto.Unmarshal(msg, newMsg)
+	if err != nil {
+		return err
+	}
+
+	readingTime := time.Unix(newMsg.GetTimestamp(), 0)
+	readings := make([]*lockReading, 0)
+	for _, lock := range newMsg.GetLocks() {
+		reading := &lockReading{
+			Hotel:    &uidRef{ID: hotel.HotelId},
+			Door:     lock.GetDoorId(),
+			Battery:  lock.GetBatteryLevel(),
+			DoorOpen: lock.GetDoorOpen(),
+			Time:     readingTime,
+		}
+		readings = append(readings, reading)
+	}
+
+	if len(readings) > 0 {
+		out, err := json.Marshal(readings)
+		if err != nil {
+			return err
+		}
+
+		txn := db.NewTxn()
+		_, err = txn.Mutate(context.Background(), &api.Mutation{SetJson: out, CommitNow: true})
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, reading := range readings {
+		checkBattery(hotel, reading.Door, int(reading.Battery))
+	}
+
+	resp := &hotel_comms.LockTelemetryResp{}
+	return sendMsg(resp, hotel_comms.MsgType_LOCK_TELEMETRY_RESP, w)
+}
+
+func lockEvent(hotel *HotelServer, msg []byte, sig []byte, w http.ResponseWriter) error {
+	newMsg := &hotel_comms.LockEvent{}
+	err := proto.Unmarshal(msg, newMsg)
+	if err != nil {
+		return err
+	}
+
+	event := &lockEventNode{
+		Hotel:  &uidRef{ID: hotel.HotelId},
+		Door:   newMsg.GetDoorId(),
+		Type:   newMsg.GetType().String(),
+		Time:   time.Unix(newMsg.GetTimestamp(), 0),
+		Detail: newMsg.GetDetail(),
+	}
+
+	out, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	txn := db.NewTxn()
+	_, err = txn.Mutate(context.Background(), &api.Mutation{SetJson: out, CommitNow: true})
+	if err != nil {
+		return err
+	}
+
+	sendAlert(&Alert{
+		HotelID: hotel.HotelId,
+		DoorID:  event.Door,
+		Type:    event.Type,
+		Detail:  event.Detail,
+		Time:    event.Time,
+	})
+
+	resp := &hotel_comms.LockEventResp{}
+	return sendMsg(resp, hotel_comms.MsgType_LOCK_EVENT_RESP, w)
+}
+
+var errNotSecurity = errors.New("lock telemetry needs the admin or security role")
+
+// getTelemetryClaims checks the request is from a user allowed to see a
+// hotel's locks.
+func getTelemetryClaims(r *http.Request) (*utils.JWTClaims, error) {
+	claims, err := utils.GetRequestJWT(r, jwtSecret)
+	if err != nil {
+		return nil, err
+	}
+	if !claims.User.HasRole(utils.RoleAdmin, utils.RoleSecurity) {
+		return nil, errNotSecurity
+	}
+	return claims, nil
+}
+
+func telemetryAuthCode(err error) string {
+	if err == errNotSecurity {
+		return utils.CodeForbidden
+	}
+	return utils.CodeUnauthenticated
+}
+
+func getLockHealth(w http.ResponseWriter, r *http.Request) {
+	_, err := getTelemetryClaims(r)
+	if err != nil {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(&LockHealthResp{
+			Err:  err.Error(),
+			Code: telemetryAuthCode(err),
+		})
+		return
+	}
+
+	vars := mux.Vars(r)
+
+	id := vars["id"]
+
+	ctx := context.Background()
+	txn := db.NewTxn()
+
+	variables := map[string]string{
+		"$id":    id,
+		"$since": time.Now().Add(-telemetryWindow).Format(time.RFC3339),
+	}
+	q := `query q($id: string, $since: string) {
+            hotels(func: uid($id)) {
+              ~lockReading.hotel (orderdesc: lockReading.time) @filter(ge(lockReading.time, $since)) {
+                lockReading.door
+                lockReading.battery
+                lockReading.doorOpen
+                lockReading.time
+              }
+	        }
+          }`
+
+	resp, err := txn.QueryWithVars(ctx, q, variables)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(&LockHealthResp{
+			Err:  err.Error(),
+			Code: utils.CodeInternal,
+		})
+		return
+	}
+	var hotels struct {
+		Hotels []struct {
+			Readings []*lockReading `json:"~lockReading.hotel"`
+		} `json:"hotels"`
+	}
+	err = json.Unmarshal(resp.GetJson(), &hotels)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(&LockHealthResp{
+			Err:  err.Error(),
+			Code: utils.CodeInternal,
+		})
+		return
+	}
+
+	// Readings are newest first, so the first one seen for a door is current
+	seen := map[string]bool{}
+	locks := make([]*LockHealth, 0)
+	for _, hotel := range hotels.Hotels {
+		for _, reading := range hotel.Readings {
+			if seen[reading.Door] {
+				continue
+			}
+			seen[reading.Door] = true
+			locks = append(locks, &LockHealth{
+				DoorID:       reading.Door,
+				BatteryLevel: int(reading.Battery),
+				LowBattery:   int(reading.Battery) <= lowBatteryThreshold,
+				DoorOpen:     reading.DoorOpen,
+				LastSeen:     reading.Time,
+			})
+		}
+	}
+
+	json.NewEncoder(w).Encode(&LockHealthResp{
+		Locks: locks,
+	})
+}
+
+func getLockAlarms(w http.ResponseWriter, r *http.Request) {
+	_, err := getTelemetryClaims(r)
+	if err != nil {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(&LockAlarmsResp{
+			Err:  err.Error(),
+			Code: telemetryAuthCode(err),
+		})
+		return
+	}
+
+	vars := mux.Vars(r)
+
+	id := vars["id"]
+
+	ctx := context.Background()
+	txn := db.NewTxn()
+
+	variables := map[string]string{
+		"$id":    id,
+		"$since": time.Now().Add(-telemetryWindow).Format(time.RFC3339),
+	}
+	q := `query q($id: string, $since: string) {
+            hotels(func: uid($id)) {
+              ~lockEvent.hotel (orderdesc: lockEvent.time) @filter(ge(lockEvent.time, $since)) {
+                uid
+                lockEvent.door
+                lockEvent.type
+                lockEvent.time
+                lockEvent.detail
+              }
+	        }
+          }`
+
+	resp, err := txn.QueryWithVars(ctx, q, variables)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(&LockAlarmsResp{
+			Err:  err.Error(),
+			Code: utils.CodeInternal,
+		})
+		return
+	}
+	var hotels struct {
+		Hotels []struct {
+			Events []struct {
+				ID     string    `json:"uid"`
+				Door   string    `json:"lockEvent.door"`
+				Type   string    `json:"lockEvent.type"`
+				Time   time.Time `json:"lockEvent.time"`
+				Detail string    `json:"lockEvent.detail"`
+			} `json:"~lockEvent.hotel"`
+		} `json:"hotels"`
+	}
+	err = json.Unmarshal(resp.GetJson(), &hotels)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(&LockAlarmsResp{
+			Err:  err.Error(),
+			Code: utils.CodeInternal,
+		})
+		return
+	}
+
+	alarms := make([]*LockAlarm, 0)
+	for _, hotel := range hotels.Hotels {
+		for _, event := range hotel.Events {
+			alarms = append(alarms, &LockAlarm{
+				ID:     event.ID,
+				DoorID: event.Door,
+				Type:   event.Type,
+				Time:   event.Time,
+				Detail: event.Detail,
+			})
+		}
+	}
+
+	json.NewEncoder(w).Encode(&LockAlarmsResp{
+		Alarms: alarms,
+	})
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/fluidmediaproductions/central_hotel_door_server/hotel_comms"
+	"github.com/fluidmediaproductions/central_hotel_door_server/utils"
+	"github.com/golang/protobuf/proto"
+)
+
+// useAlertWebhook sends alerts to a channel until the returned func is
+// called.
+func useAlertWebhook(t *testing.T) (chan *Alert, func()) {
+	alerts := make(chan *Alert, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var alert Alert
+		err := json.NewDecoder(r.Body).Decode(&alert)
+		if err != nil {
+			t.Errorf("Error reading alert: %v", err)
+		}
+		alerts <- &alert
+	}))
+
+	oldWebhook := alertWebhook
+	alertWebhook = server.URL
+	lastBatteryAlert.Lock()
+	lastBatteryAlert.doors = map[string]time.Time{}
+	lastBatteryAlert.Unlock()
+	return alerts, func() {
+		alertWebhook = oldWebhook
+		server.Close()
+	}
+}
+
+func expectAlert(t *testing.T, alerts chan *Alert, doorId string) {
+	select {
+	case alert := <-alerts:
+		if alert.Type != lowBatteryAlert || alert.DoorID != doorId || alert.HotelID != "0x1" {
+			t.Errorf("Expected a low battery alert for %s, got %+v", doorId, alert)
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("Expected a low battery alert for %s", doorId)
+	}
+}
+
+func expectNoAlert(t *testing.T, alerts chan *Alert) {
+	select {
+	case alert := <-alerts:
+		t.Errorf("Expected no alert, got %+v", alert)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestCheckBattery(t *testing.T) {
+	alerts, restore := useAlertWebhook(t)
+	defer restore()
+
+	hotel := &HotelServer{HotelId: "0x1"}
+
+	checkBattery(hotel, "101", lowBatteryThreshold+1)
+	expectNoAlert(t, alerts)
+
+	checkBattery(hotel, "101", lowBatteryThreshold)
+	expectAlert(t, alerts, "101")
+
+	// The door has already been alerted on within the interval
+	checkBattery(hotel, "101", 5)
+	expectNoAlert(t, alerts)
+
+	checkBattery(hotel, "102", 5)
+	expectAlert(t, alerts, "102")
+
+	lastBatteryAlert.Lock()
+	lastBatteryAlert.doors["101"] = time.Now().Add(-alertInterval)
+	lastBatteryAlert.Unlock()
+	checkBattery(hotel, "101", 5)
+	expectAlert(t, alerts, "101")
+}
+
+func TestLockTelemetry(t *testing.T) {
+	fake, restore := useFakeDB(t)
+	defer restore()
+	alerts, restoreAlerts := useAlertWebhook(t)
+	defer restoreAlerts()
+
+	priv, _, err := hotel_comms.GetKeys()
+	if err != nil {
+		t.Fatalf("Error getting keys: %v", err)
+	}
+	status.PrivateKey = priv
+
+	readingTime := time.Date(2030, 1, 1, 12, 0, 0, 0, time.UTC)
+	msg, err := proto.Marshal(&hotel_comms.LockTelemetry{
+		Timestamp: proto.Int64(readingTime.Unix()),
+		Locks: []*hotel_comms.LockStatus{
+			{DoorId: proto.String("101"), BatteryLevel: proto.Int32(80), DoorOpen: proto.Bool(true)},
+			{DoorId: proto.String("102"), BatteryLevel: proto.Int32(10)},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Error making message: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	err = lockTelemetry(&HotelServer{HotelId: "0x1"}, msg, nil, w)
+	if err != nil {
+		t.Fatalf("Error handling telemetry: %v", err)
+	}
+
+	if len(fake.mutations) != 1 || !fake.mutations[0].CommitNow {
+		t.Fatalf("Expected the readings to be committed in one mutation, got %d", len(fake.mutations))
+	}
+	var readings []*lockReading
+	err = json.Unmarshal(fake.mutations[0].SetJson, &readings)
+	if err != nil {
+		t.Fatalf("Error reading mutation: %v", err)
+	}
+	if len(readings) != 2 {
+		t.Fatalf("Expected two readings, got %d", len(readings))
+	}
+	for _, reading := range readings {
+		if reading.Hotel == nil || reading.Hotel.ID != "0x1" || !reading.Time.Equal(readingTime) {
+			t.Errorf("Expected a reading for the hotel at %v, got %+v", readingTime, reading)
+		}
+	}
+	if readings[0].Door != "101" || readings[0].Battery != 80 || !readings[0].DoorOpen {
+		t.Errorf("Unexpected reading %+v", readings[0])
+	}
+	if readings[1].Door != "102" || readings[1].Battery != 10 || readings[1].DoorOpen {
+		t.Errorf("Unexpected reading %+v", readings[1])
+	}
+
+	// Only the lock under the threshold is alerted on
+	expectAlert(t, alerts, "102")
+	expectNoAlert(t, alerts)
+}
+
+func TestGetLockHealth(t *testing.T) {
+	fake, restore := useFakeDB(t)
+	defer restore()
+
+	security := newTestJWT(t, &utils.User{ID: "0x9", Roles: []string{utils.RoleSecurity}})
+	guest := newTestJWT(t, &utils.User{ID: "0x3"})
+
+	for _, path := range []string{"/hotels/0x1/locks", "/hotels/0x1/alarms"} {
+		resp, _ := doRequest("GET", "http://a"+path, "")
+		if resp.StatusCode != http.StatusForbidden {
+			t.Errorf("%s: expected 403 error without a JWT, got %s", path, resp.Status)
+		}
+		resp, body := doRequest("GET", "http://a"+path, guest)
+		var errResp LockHealthResp
+		json.Unmarshal(body, &errResp)
+		if resp.StatusCode != http.StatusForbidden || errResp.Code != utils.CodeForbidden {
+			t.Errorf("%s: expected 403 error for a guest, got %s %s", path, resp.Status, string(body))
+		}
+	}
+	if len(fake.queries) != 0 {
+		t.Fatal("Expected no queries")
+	}
+
+	// Readings are newest first, so older ones for the same door are skipped
+	fake.expectQuery("~lockReading.hotel", `{
+		"hotels": [{
+			"~lockReading.hotel": [
+				{"lockReading.door": "101", "lockReading.battery": 15, "lockReading.time": "2030-01-01T12:00:00Z"},
+				{"lockReading.door": "102", "lockReading.battery": 90, "lockReading.doorOpen": true, "lockReading.time": "2030-01-01T11:00:00Z"},
+				{"lockReading.door": "101", "lockReading.battery": 90, "lockReading.time": "2030-01-01T10:00:00Z"}
+			]
+		}]
+	}`)
+	resp, body := doRequest("GET", "http://a/hotels/0x1/locks", security)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected the locks, got %s %s", resp.Status, string(body))
+	}
+	var health LockHealthResp
+	err := json.Unmarshal(body, &health)
+	if err != nil || len(health.Locks) != 2 {
+		t.Fatalf("Expected two locks, got %s", string(body))
+	}
+	if health.Locks[0].DoorID != "101" || health.Locks[0].BatteryLevel != 15 || !health.Locks[0].LowBattery {
+		t.Errorf("Expected door 101 to have a low battery, got %+v", health.Locks[0])
+	}
+	if health.Locks[1].DoorID != "102" || health.Locks[1].LowBattery || !health.Locks[1].DoorOpen {
+		t.Errorf("Expected door 102 to be open with a good battery, got %+v", health.Locks[1])
+	}
+}
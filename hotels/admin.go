@@ -0,0 +1,280 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dgraph-io/dgo"
+	"github.com/dgraph-io/dgo/protos/api"
+	"github.com/fluidmediaproductions/central_hotel_door_server/clients"
+	"github.com/fluidmediaproductions/central_hotel_door_server/utils"
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+)
+
+type HotelInput = clients.HotelInput
+
+var errNotAdmin = errors.New("managing hotels needs the admin role")
+
+// getAdminClaims checks the request is from an admin.
+func getAdminClaims(r *http.Request) (*utils.JWTClaims, error) {
+	claims, err := utils.GetRequestJWT(r, jwtSecret)
+	if err != nil {
+		return nil, err
+	}
+	if !claims.User.HasRole(utils.RoleAdmin) {
+		return nil, errNotAdmin
+	}
+	return claims, nil
+}
+
+func writeAdminAuthError(w http.ResponseWriter, err error) {
+	code := utils.CodeUnauthenticated
+	if err == errNotAdmin {
+		code = utils.CodeForbidden
+	}
+	w.WriteHeader(http.StatusForbidden)
+	json.NewEncoder(w).Encode(&HotelResp{
+		Err:  err.Error(),
+		Code: code,
+	})
+}
+
+func writeHotelError(w http.ResponseWriter, status int, err error) {
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(&HotelResp{
+		Err:  err.Error(),
+		Code: utils.StatusCode(status),
+	})
+}
+
+// hotelNode turns the fields set in a HotelInput into the predicates of a
+// mutation.
+func hotelNode(id string, input *HotelInput) (map[string]interface{}, error) {
+	node := map[string]interface{}{
+		"uid": id,
+	}
+	if input.Name != nil {
+		name := strings.TrimSpace(*input.Name)
+		if name == "" {
+			return nil, errors.New("name can't be empty")
+		}
+		node["hotel.name"] = name
+	}
+	if input.Address != nil {
+		address := strings.TrimSpace(*input.Address)
+		if address == "" {
+			return nil, errors.New("address can't be empty")
+		}
+		node["hotel.address"] = address
+	}
+	if input.Location != nil {
+		err := utils.CheckLatLng(input.Location.Lat, input.Location.Lng)
+		if err != nil {
+			return nil, err
+		}
+		node["hotel.location"] = utils.NewPoint(input.Location.Lat, input.Location.Lng)
+	}
+	if input.CheckIn != nil {
+		// Check-in is a time on the hotel's own clock
+		node["hotel.checkIn"] = utils.ClockTime(*input.CheckIn)
+	}
+	if input.TimeZone != nil {
+		err := utils.CheckTimeZone(*input.TimeZone)
+		if err != nil {
+			return nil, err
+		}
+		node["hotel.timeZone"] = *input.TimeZone
+	}
+	if input.HasCarPark != nil {
+		node["hotel.hasCarPark"] = *input.HasCarPark
+	}
+	return node, nil
+}
+
+func decodeHotelInput(r *http.Request) (*HotelInput, error) {
+	defer r.Body.Close()
+	var input HotelInput
+	err := json.NewDecoder(r.Body).Decode(&input)
+	if err != nil {
+		return nil, errors.New("bad request data")
+	}
+	return &input, nil
+}
+
+// hotelExists checks for a hotel, archived or not, that may not have all
+// its details yet.
+func hotelExists(ctx context.Context, txn *dgo.Txn, id string) (bool, error) {
+	q := `query q($id: string) {
+            hotels(func: uid($id)) @filter(has(hotel)) {
+              uid
+	        }
+          }`
+	resp, err := txn.QueryWithVars(ctx, q, map[string]string{"$id": id})
+	if err != nil {
+		return false, err
+	}
+	var hotels hotelQuery
+	err = json.Unmarshal(resp.GetJson(), &hotels)
+	if err != nil {
+		return false, err
+	}
+	return len(hotels.Hotels) > 0, nil
+}
+
+// saveHotel writes a hotel mutation and its audit entry, then fetches the
+// hotel as it now is.
+func saveHotel(ctx context.Context, txn *dgo.Txn, node map[string]interface{}, action string, userId string, detail string) (*Hotel, error) {
+	mutData, err := json.Marshal(node)
+	if err != nil {
+		return nil, err
+	}
+	assigned, err := txn.Mutate(ctx, &api.Mutation{SetJson: mutData})
+	if err != nil {
+		return nil, err
+	}
+	id, _ := node["uid"].(string)
+	if newId, isOk := assigned.GetUids()["hotel"]; isOk {
+		id = newId
+	}
+	err = writeAudit(ctx, txn, utils.NewAuditEntry(action, userId, id, detail))
+	if err != nil {
+		return nil, err
+	}
+	err = txn.Commit(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return getHotelFromDB(ctx, db.NewTxn(), id)
+}
+
+func createHotel(w http.ResponseWriter, r *http.Request) {
+	claims, err := getAdminClaims(r)
+	if err != nil {
+		writeAdminAuthError(w, err)
+		return
+	}
+
+	input, err := decodeHotelInput(r)
+	if err != nil {
+		writeHotelError(w, http.StatusBadRequest, err)
+		return
+	}
+	if input.Name == nil || input.Address == nil || input.Location == nil || input.CheckIn == nil || input.TimeZone == nil {
+		writeHotelError(w, http.StatusBadRequest, errors.New("name, address, location, checkIn and timeZone are needed"))
+		return
+	}
+	node, err := hotelNode("_:hotel", input)
+	if err != nil {
+		writeHotelError(w, http.StatusBadRequest, err)
+		return
+	}
+	node["hotel"] = true
+	if input.HasCarPark == nil {
+		node["hotel.hasCarPark"] = false
+	}
+
+	ctx := context.Background()
+	txn := db.NewTxn()
+	defer txn.Discard(ctx)
+
+	hotel, err := saveHotel(ctx, txn, node, "hotel.created", claims.User.ID, "")
+	if err != nil {
+		writeHotelError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(&HotelResp{
+		Hotel: hotel,
+	})
+}
+
+func updateHotel(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	claims, err := getAdminClaims(r)
+	if err != nil {
+		writeAdminAuthError(w, err)
+		return
+	}
+
+	input, err := decodeHotelInput(r)
+	if err != nil {
+		writeHotelError(w, http.StatusBadRequest, err)
+		return
+	}
+	node, err := hotelNode(id, input)
+	if err != nil {
+		writeHotelError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	ctx := context.Background()
+	txn := db.NewTxn()
+	defer txn.Discard(ctx)
+
+	exists, err := hotelExists(ctx, txn, id)
+	if err != nil {
+		writeHotelError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if !exists {
+		writeHotelError(w, http.StatusNotFound, errHotelNotFound)
+		return
+	}
+
+	hotel, err := saveHotel(ctx, txn, node, "hotel.updated", claims.User.ID, "")
+	if err != nil {
+		writeHotelError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(&HotelResp{
+		Hotel: hotel,
+	})
+}
+
+// archiveHotel hides a hotel from lists and searches. It can still be
+// fetched by its ID, so existing bookings keep working.
+func archiveHotel(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	claims, err := getAdminClaims(r)
+	if err != nil {
+		writeAdminAuthError(w, err)
+		return
+	}
+
+	ctx := context.Background()
+	txn := db.NewTxn()
+	defer txn.Discard(ctx)
+
+	exists, err := hotelExists(ctx, txn, id)
+	if err != nil {
+		writeHotelError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if !exists {
+		writeHotelError(w, http.StatusNotFound, errHotelNotFound)
+		return
+	}
+
+	node := map[string]interface{}{
+		"uid":              id,
+		"hotel.archivedAt": time.Now(),
+	}
+	hotel, err := saveHotel(ctx, txn, node, "hotel.archived", claims.User.ID, "")
+	if err != nil {
+		writeHotelError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(&HotelResp{
+		Hotel: hotel,
+	})
+}
@@ -0,0 +1,453 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/dgraph-io/dgo"
+	"github.com/dgraph-io/dgo/protos/api"
+	"github.com/fluidmediaproductions/central_hotel_door_server/clients"
+	"github.com/fluidmediaproductions/central_hotel_door_server/utils"
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+)
+
+const (
+	emergencyNormal   = "normal"
+	emergencyRelease  = "release"
+	emergencyLockdown = "lockdown"
+)
+
+// How long a requested emergency mode change waits for confirmation
+const emergencyConfirmWindow = time.Minute * 2
+
+var errHotelNotFound = errors.New("hotel not found")
+
+type EmergencyState = clients.EmergencyState
+type EmergencyStateResp = clients.EmergencyStateResp
+type EmergencyRequestResp = clients.EmergencyRequestResp
+
+type emergencyQuery struct {
+	Hotels []struct {
+		ID    string     `json:"uid"`
+		Mode  string     `json:"hotel.emergencyMode"`
+		Since *time.Time `json:"hotel.emergencySince"`
+		Acked bool       `json:"hotel.emergencyAcked"`
+		By    []struct {
+			ID string `json:"uid"`
+		} `json:"hotel.emergencyBy"`
+		Requests []struct {
+			ID      string    `json:"uid"`
+			Mode    string    `json:"emergencyRequest.mode"`
+			Code    string    `json:"emergencyRequest.code"`
+			Expires time.Time `json:"emergencyRequest.expires"`
+			User    []struct {
+				ID string `json:"uid"`
+			} `json:"emergencyRequest.user"`
+		} `json:"~emergencyRequest.hotel"`
+	} `json:"hotels"`
+}
+
+func isEmergencyMode(mode string) bool {
+	return mode == emergencyNormal || mode == emergencyRelease || mode == emergencyLockdown
+}
+
+func getEmergencyFromDB(ctx context.Context, txn *dgo.Txn, id string) (*emergencyQuery, error) {
+	q := `query q($id: string) {
+            hotels(func: uid($id)) @filter(has(hotel)) {
+              uid
+              hotel.emergencyMode
+              hotel.emergencySince
+              hotel.emergencyAcked
+              hotel.emergencyBy {
+                uid
+              }
+              ~emergencyRequest.hotel {
+                uid
+                emergencyRequest.mode
+                emergencyRequest.code
+                emergencyRequest.expires
+                emergencyRequest.user {
+                  uid
+                }
+              }
+	        }
+          }`
+
+	resp, err := txn.QueryWithVars(ctx, q, map[string]string{"$id": id})
+	if err != nil {
+		return nil, err
+	}
+	var hotels emergencyQuery
+	err = json.Unmarshal(resp.GetJson(), &hotels)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(hotels.Hotels) == 0 {
+		return nil, errHotelNotFound
+	}
+
+	return &hotels, nil
+}
+
+func (q *emergencyQuery) toState() *EmergencyState {
+	hotel := q.Hotels[0]
+	state := &EmergencyState{
+		HotelID: hotel.ID,
+		Mode:    hotel.Mode,
+		Since:   hotel.Since,
+		Acked:   hotel.Acked,
+	}
+	if state.Mode == "" {
+		state.Mode = emergencyNormal
+	}
+	if len(hotel.By) > 0 {
+		state.ByUserID = hotel.By[0].ID
+	}
+	return state
+}
+
+func writeEmergencyError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	if err == errHotelNotFound {
+		status = http.StatusNotFound
+	}
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(&EmergencyStateResp{
+		Err:  err.Error(),
+		Code: utils.StatusCode(status),
+	})
+}
+
+// getEmergencyClaims checks the request is from a user allowed to change a
+// hotel's emergency mode.
+func getEmergencyClaims(r *http.Request) (*utils.JWTClaims, error) {
+	claims, err := utils.GetRequestJWT(r, jwtSecret)
+	if err != nil {
+		return nil, err
+	}
+	if !claims.User.HasRole(utils.RoleAdmin, utils.RoleSecurity) {
+		return nil, errors.New("emergency modes need the admin or security role")
+	}
+	return claims, nil
+}
+
+func newConfirmationCode() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
+
+func writeAudit(ctx context.Context, txn *dgo.Txn, entry *utils.AuditEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	_, err = txn.Mutate(ctx, &api.Mutation{SetJson: data})
+	return err
+}
+
+func getEmergencyState(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	ctx := context.Background()
+	txn := db.NewTxn()
+	defer txn.Discard(ctx)
+
+	hotels, err := getEmergencyFromDB(ctx, txn, id)
+	if err != nil {
+		writeEmergencyError(w, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(&EmergencyStateResp{
+		State: hotels.toState(),
+	})
+}
+
+func requestEmergency(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	claims, err := getEmergencyClaims(r)
+	if err != nil {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(&EmergencyRequestResp{
+			Err:  err.Error(),
+			Code: utils.CodeForbidden,
+		})
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(&EmergencyRequestResp{
+			Err:  err.Error(),
+			Code: utils.CodeBadRequest,
+		})
+		return
+	}
+	defer r.Body.Close()
+
+	var data struct {
+		Mode string `json:"mode"`
+	}
+	err = json.Unmarshal(body, &data)
+	if err != nil || !isEmergencyMode(data.Mode) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(&EmergencyRequestResp{
+			Err:  "bad request data",
+			Code: utils.CodeBadRequest,
+		})
+		return
+	}
+
+	ctx := context.Background()
+	txn := db.NewTxn()
+	defer txn.Discard(ctx)
+
+	_, err = getEmergencyFromDB(ctx, txn, id)
+	if err != nil {
+		writeEmergencyError(w, err)
+		return
+	}
+
+	code, err := newConfirmationCode()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(&EmergencyRequestResp{
+			Err:  err.Error(),
+			Code: utils.CodeInternal,
+		})
+		return
+	}
+
+	var mutation struct {
+		Hotel   *utils.UIDRef `json:"emergencyRequest.hotel"`
+		User    *utils.UIDRef `json:"emergencyRequest.user"`
+		Mode    string        `json:"emergencyRequest.mode"`
+		Code    string        `json:"emergencyRequest.code"`
+		Expires time.Time     `json:"emergencyRequest.expires"`
+	}
+	mutation.Hotel = &utils.UIDRef{ID: id}
+	mutation.User = &utils.UIDRef{ID: claims.User.ID}
+	mutation.Mode = data.Mode
+	mutation.Code = code
+	mutation.Expires = time.Now().Add(emergencyConfirmWindow)
+
+	mutData, err := json.Marshal(&mutation)
+	if err == nil {
+		_, err = txn.Mutate(ctx, &api.Mutation{SetJson: mutData})
+	}
+	if err == nil {
+		err = writeAudit(ctx, txn, utils.NewAuditEntry("emergency.requested", claims.User.ID, id, data.Mode))
+	}
+	if err == nil {
+		err = txn.Commit(ctx)
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(&EmergencyRequestResp{
+			Err:  err.Error(),
+			Code: utils.CodeInternal,
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(&EmergencyRequestResp{
+		ConfirmCode: code,
+		Expires:     mutation.Expires,
+	})
+}
+
+func confirmEmergency(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	claims, err := getEmergencyClaims(r)
+	if err != nil {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(&EmergencyStateResp{
+			Err:  err.Error(),
+			Code: utils.CodeForbidden,
+		})
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(&EmergencyStateResp{
+			Err:  err.Error(),
+			Code: utils.CodeBadRequest,
+		})
+		return
+	}
+	defer r.Body.Close()
+
+	var data struct {
+		Mode string `json:"mode"`
+		Code string `json:"code"`
+	}
+	err = json.Unmarshal(body, &data)
+	if err != nil || !isEmergencyMode(data.Mode) || data.Code == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(&EmergencyStateResp{
+			Err:  "bad request data",
+			Code: utils.CodeBadRequest,
+		})
+		return
+	}
+
+	ctx := context.Background()
+	txn := db.NewTxn()
+	defer txn.Discard(ctx)
+
+	hotels, err := getEmergencyFromDB(ctx, txn, id)
+	if err != nil {
+		writeEmergencyError(w, err)
+		return
+	}
+
+	requestId := ""
+	for _, request := range hotels.Hotels[0].Requests {
+		if request.Code != data.Code || request.Mode != data.Mode || time.Now().After(request.Expires) {
+			continue
+		}
+		if len(request.User) == 0 || request.User[0].ID != claims.User.ID {
+			continue
+		}
+		requestId = request.ID
+	}
+	if requestId == "" {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(&EmergencyStateResp{
+			Err:  "invalid or expired confirmation code",
+			Code: utils.CodeForbidden,
+		})
+		return
+	}
+
+	now := time.Now()
+	var mutation struct {
+		ID    string        `json:"uid"`
+		Mode  string        `json:"hotel.emergencyMode"`
+		Since time.Time     `json:"hotel.emergencySince"`
+		Acked bool          `json:"hotel.emergencyAcked"`
+		By    *utils.UIDRef `json:"hotel.emergencyBy"`
+	}
+	mutation.ID = id
+	mutation.Mode = data.Mode
+	mutation.Since = now
+	mutation.Acked = false
+	mutation.By = &utils.UIDRef{ID: claims.User.ID}
+
+	mutData, err := json.Marshal(&mutation)
+	if err == nil {
+		// emergencyBy is a single uid edge, so the old value is replaced
+		_, err = txn.Mutate(ctx, &api.Mutation{SetJson: mutData})
+	}
+	if err == nil {
+		var del []byte
+		del, err = json.Marshal(&utils.UIDRef{ID: requestId})
+		if err == nil {
+			_, err = txn.Mutate(ctx, &api.Mutation{DeleteJson: del})
+		}
+	}
+	if err == nil {
+		err = writeAudit(ctx, txn, utils.NewAuditEntry("emergency.confirmed", claims.User.ID, id, data.Mode))
+	}
+	if err == nil {
+		err = txn.Commit(ctx)
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(&EmergencyStateResp{
+			Err:  err.Error(),
+			Code: utils.CodeInternal,
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(&EmergencyStateResp{
+		State: &EmergencyState{
+			HotelID:  id,
+			Mode:     data.Mode,
+			Since:    &now,
+			ByUserID: claims.User.ID,
+		},
+	})
+}
+
+// ackEmergency is called by the hotel gateway once a hotel has applied its
+// current emergency mode. The action ID is the mode's start time, so acks for
+// a superseded mode are ignored.
+func ackEmergency(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+	actionId := vars["actionId"]
+
+	ctx := context.Background()
+	txn := db.NewTxn()
+	defer txn.Discard(ctx)
+
+	hotels, err := getEmergencyFromDB(ctx, txn, id)
+	if err != nil {
+		writeEmergencyError(w, err)
+		return
+	}
+
+	state := hotels.toState()
+	if state.Since == nil || strconv.FormatInt(state.Since.Unix(), 10) != actionId {
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(&EmergencyStateResp{
+			Err:   "emergency mode has changed",
+			Code:  utils.CodeConflict,
+			State: state,
+		})
+		return
+	}
+
+	var mutation struct {
+		ID    string `json:"uid"`
+		Acked bool   `json:"hotel.emergencyAcked"`
+	}
+	mutation.ID = id
+	mutation.Acked = true
+
+	mutData, err := json.Marshal(&mutation)
+	if err == nil {
+		_, err = txn.Mutate(ctx, &api.Mutation{SetJson: mutData})
+	}
+	if err == nil {
+		err = writeAudit(ctx, txn, utils.NewAuditEntry("emergency.applied", "", id, state.Mode))
+	}
+	if err == nil {
+		err = txn.Commit(ctx)
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(&EmergencyStateResp{
+			Err:  err.Error(),
+			Code: utils.CodeInternal,
+		})
+		return
+	}
+
+	state.Acked = true
+	json.NewEncoder(w).Encode(&EmergencyStateResp{
+		State: state,
+	})
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/fluidmediaproductions/central_hotel_door_server/clients"
+	"github.com/fluidmediaproductions/central_hotel_door_server/utils"
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+)
+
+type NearbyHotel = clients.NearbyHotel
+type NearbyHotelsResp = clients.NearbyHotelsResp
+type HotelLocation = clients.HotelLocation
+
+// maxNearRadiusKm limits how far a location search can reach, so it can't
+// be used to list every hotel.
+const maxNearRadiusKm = 500
+
+func parseFloatParam(r *http.Request, name string) (float64, error) {
+	value := r.URL.Query().Get(name)
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, errors.Errorf("invalid %s %q", name, value)
+	}
+	return f, nil
+}
+
+func parseNearParams(r *http.Request) (float64, float64, float64, error) {
+	lat, err := parseFloatParam(r, "lat")
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	lng, err := parseFloatParam(r, "lng")
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	err = utils.CheckLatLng(lat, lng)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	radius, err := parseFloatParam(r, "radius")
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	if math.IsNaN(radius) || radius <= 0 || radius > maxNearRadiusKm {
+		return 0, 0, 0, errors.Errorf("radius must be over 0 and at most %dkm", maxNearRadiusKm)
+	}
+	return lat, lng, radius, nil
+}
+
+// getHotelsNear finds the hotels within the radius query parameter, in km,
+// of the lat and lng query parameters, nearest first.
+func getHotelsNear(w http.ResponseWriter, r *http.Request) {
+	lat, lng, radius, err := parseNearParams(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(&NearbyHotelsResp{
+			Err:  err.Error(),
+			Code: utils.CodeBadRequest,
+		})
+		return
+	}
+
+	ctx := context.Background()
+	txn := db.NewTxn()
+
+	// The values were parsed as floats, so are safe to put in the query
+	near := fmt.Sprintf("near(hotel.location, [%s, %s], %d)",
+		strconv.FormatFloat(lng, 'f', -1, 64), strconv.FormatFloat(lat, 'f', -1, 64), int(radius*1000))
+	q := `query {
+            hotels(func: ` + near + `) @filter(` + hotelComplete + ` AND NOT has(hotel.archivedAt)) {
+              ` + hotelFields + `
+	        }
+          }`
+
+	resp, err := txn.Query(ctx, q)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(&NearbyHotelsResp{
+			Err:  err.Error(),
+			Code: utils.CodeInternal,
+		})
+		return
+	}
+	var hotels hotelQuery
+	err = json.Unmarshal(resp.GetJson(), &hotels)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(&NearbyHotelsResp{
+			Err:  err.Error(),
+			Code: utils.CodeInternal,
+		})
+		return
+	}
+
+	outHotels := make([]*NearbyHotel, 0)
+	for _, hotel := range hotels.toHotels() {
+		hotelLat, hotelLng, isOk := hotel.Location.LatLng()
+		if !isOk {
+			continue
+		}
+		outHotels = append(outHotels, &NearbyHotel{
+			Hotel:      hotel,
+			DistanceKm: utils.DistanceKm(lat, lng, hotelLat, hotelLng),
+		})
+	}
+	sort.Slice(outHotels, func(i, j int) bool {
+		return outHotels[i].DistanceKm < outHotels[j].DistanceKm
+	})
+
+	json.NewEncoder(w).Encode(&NearbyHotelsResp{
+		Hotels: outHotels,
+	})
+}
+
+// setHotelLocation moves a hotel to the lat and lng in the body. Only admins
+// can do this.
+func setHotelLocation(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	claims, err := getAdminClaims(r)
+	if err != nil {
+		writeAdminAuthError(w, err)
+		return
+	}
+
+	var data HotelLocation
+	err = json.NewDecoder(r.Body).Decode(&data)
+	r.Body.Close()
+	if err == nil {
+		err = utils.CheckLatLng(data.Lat, data.Lng)
+	}
+	if err != nil {
+		writeHotelError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	ctx := context.Background()
+	txn := db.NewTxn()
+	defer txn.Discard(ctx)
+
+	exists, err := hotelExists(ctx, txn, id)
+	if err != nil {
+		writeHotelError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if !exists {
+		writeHotelError(w, http.StatusNotFound, errHotelNotFound)
+		return
+	}
+
+	node := map[string]interface{}{
+		"uid":            id,
+		"hotel.location": utils.NewPoint(data.Lat, data.Lng),
+	}
+	detail := fmt.Sprintf("%v,%v", data.Lat, data.Lng)
+	hotel, err := saveHotel(ctx, txn, node, "hotel.location", claims.User.ID, detail)
+	if err != nil {
+		writeHotelError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(&HotelResp{
+		Hotel: hotel,
+	})
+}
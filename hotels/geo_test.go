@@ -0,0 +1,29 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseNearParams(t *testing.T) {
+	for _, query := range []string{
+		"lat=51.5&lng=-0.1&radius=NaN",
+		"lat=51.5&lng=-0.1&radius=0",
+		"lat=51.5&lng=-0.1&radius=501",
+		"lat=51.5&lng=-0.1&radius=Inf",
+		"lat=NaN&lng=-0.1&radius=5",
+		"lat=51.5&lng=-0.1",
+	} {
+		r := httptest.NewRequest("GET", "http://a/hotels/near?"+query, nil)
+		_, _, _, err := parseNearParams(r)
+		if err == nil {
+			t.Errorf("Expected an error for %s", query)
+		}
+	}
+
+	r := httptest.NewRequest("GET", "http://a/hotels/near?lat=51.5&lng=-0.1&radius=5", nil)
+	lat, lng, radius, err := parseNearParams(r)
+	if err != nil || lat != 51.5 || lng != -0.1 || radius != 5 {
+		t.Errorf("Expected 51.5, -0.1 and 5, got %v, %v, %v, %v", lat, lng, radius, err)
+	}
+}
@@ -6,12 +6,13 @@ import (
 	"log"
 	"net/http"
 	//"strconv"
-	//"strings"
+	"strings"
 	"time"
 
 	"context"
 	"github.com/dgraph-io/dgo"
 	"github.com/dgraph-io/dgo/protos/api"
+	"github.com/fluidmediaproductions/central_hotel_door_server/clients"
 	"github.com/fluidmediaproductions/central_hotel_door_server/utils"
 	"github.com/gorilla/mux"
 	"github.com/spf13/viper"
@@ -25,61 +26,99 @@ var BookingsServer = "http://bookings"
 var db *dgo.Dgraph
 var jwtSecret []byte
 
-type Hotel struct {
-	ID             string          `json:"uid"`
-	Name           string          `json:"name"`
-	Address        string          `json:"address"`
-	Location       *utils.Location `json:"location"`
-	CheckIn        time.Time       `json:"checkIn"`
-	HasCarPark     bool            `json:"hasCarPark"`
-	ShouldDoorOpen bool            `json:"shouldDoorOpen"`
-}
-
-type HotelsResp struct {
-	Err    string   `json:"err"`
-	Hotels []*Hotel `json:"hotels"`
-}
-
-type HotelResp struct {
-	Err   string `json:"err"`
-	Hotel *Hotel `json:"hotel"`
-}
-
-type OpenHotelResp struct {
-	Err     string `json:"err"`
-	Success bool   `json:"success"`
-}
+type Hotel = clients.Hotel
+type HotelsResp = clients.HotelsResp
+type HotelResp = clients.HotelResp
+type OpenHotelResp = clients.OpenHotelResp
 
 type hotelQuery struct {
 	Hotels []struct {
 		ID    string `json:"uid"`
 		Name    string `json:"hotel.name"`
 		Address    string `json:"hotel.address"`
+		Location   *utils.Location `json:"hotel.location"`
 		CheckIn   *time.Time `json:"hotel.checkIn"`
+		TimeZone   string `json:"hotel.timeZone"`
 		HasCarPark  bool `json:"hotel.hasCarPark"`
+		ArchivedAt *time.Time `json:"hotel.archivedAt"`
 	} `json:"hotels"`
 }
 
-func getHotels(w http.ResponseWriter, r *http.Request) {
-	ctx := context.Background()
-	txn := db.NewTxn()
-
-	q := `query{
-            hotels(func: has(hotel)) @cascade {
-              uid
+// hotelFields are the predicates of a hotel, for the body of a query.
+const hotelFields = `uid
               hotel.name
               hotel.address
               hotel.location
               hotel.checkIn
+              hotel.timeZone
               hotel.hasCarPark
+              hotel.archivedAt`
+
+// hotelComplete filters out hotels missing any of the details a Hotel needs.
+// Unlike @cascade it works on the root, so pages aren't cut short.
+const hotelComplete = `has(hotel) AND has(hotel.name) AND has(hotel.address) AND has(hotel.location) AND has(hotel.checkIn) AND has(hotel.hasCarPark)`
+
+func (q *hotelQuery) toHotels() []*Hotel {
+	outHotels := make([]*Hotel, 0)
+	for _, hotel := range q.Hotels {
+		outHotel := &Hotel{
+			ID: hotel.ID,
+			Name: hotel.Name,
+			Address: hotel.Address,
+			Location: hotel.Location,
+			CheckIn: *hotel.CheckIn,
+			TimeZone: hotel.TimeZone,
+			HasCarPark: hotel.HasCarPark,
+			ArchivedAt: hotel.ArchivedAt,
+		}
+		outHotels = append(outHotels, outHotel)
+	}
+	return outHotels
+}
+
+func getHotels(w http.ResponseWriter, r *http.Request) {
+	page, err := utils.ParsePage(r.URL.Query())
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(&HotelsResp{
+			Err:  err.Error(),
+			Code: utils.CodeBadRequest,
+		})
+		return
+	}
+
+	ctx := context.Background()
+	txn := db.NewTxn()
+
+	// Archived hotels are only listed for admins that ask for them
+	variables := map[string]string{}
+	filter := hotelComplete
+	if r.URL.Query().Get("archived") == "include" {
+		_, err := getAdminClaims(r)
+		if err != nil {
+			writeAdminAuthError(w, err)
+			return
+		}
+	} else {
+		filter += " AND NOT has(hotel.archivedAt)"
+	}
+	if name := r.URL.Query().Get("name"); name != "" {
+		variables["$name"] = name
+		filter += " AND allofterms(hotel.name, $name)"
+	}
+
+	q := utils.QueryHeader(variables) + ` {
+            hotels(func: has(hotel)` + page.Args() + `) @filter(` + filter + `) {
+              ` + hotelFields + `
 	        }
           }`
 
-	resp, err := txn.Query(ctx, q)
+	resp, err := txn.QueryWithVars(ctx, q, variables)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(&HotelsResp{
-			Err: err.Error(),
+			Err:  err.Error(),
+			Code: utils.CodeInternal,
 		})
 		return
 	}
@@ -88,53 +127,61 @@ func getHotels(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(&HotelsResp{
-			Err: err.Error(),
+			Err:  err.Error(),
+			Code: utils.CodeInternal,
 		})
 		return
 	}
 
-	outHotels := make([]*Hotel, 0)
-	for _, hotel := range hotels.Hotels {
-		outHotel := &Hotel{
-			ID: hotel.ID,
-			Name: hotel.Name,
-			Address: hotel.Address,
-			CheckIn: *hotel.CheckIn,
-			HasCarPark: hotel.HasCarPark,
-		}
-		outHotels = append(outHotels, outHotel)
+	count, hasNext := page.Limit(len(hotels.Hotels))
+	hotels.Hotels = hotels.Hotels[:count]
+	lastID := ""
+	if count > 0 {
+		lastID = hotels.Hotels[count-1].ID
 	}
+	outHotels := hotels.toHotels()
 
 	json.NewEncoder(w).Encode(&HotelsResp{
-		Hotels: outHotels,
+		Hotels:   outHotels,
+		PageInfo: utils.NewPageInfo(hasNext, lastID),
 	})
 	return
 }
 
-func getHotel(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-
-	id := vars["id"]
+// getHotelsBatch fetches the hotels in the ids query parameter, skipping any
+// that don't exist.
+func getHotelsBatch(w http.ResponseWriter, r *http.Request) {
+	ids, err := utils.ParseUIDs(r.URL.Query().Get("ids"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(&HotelsResp{
+			Err:  err.Error(),
+			Code: utils.CodeBadRequest,
+		})
+		return
+	}
+	if len(ids) == 0 {
+		json.NewEncoder(w).Encode(&HotelsResp{
+			Hotels: make([]*Hotel, 0),
+		})
+		return
+	}
 
 	ctx := context.Background()
 	txn := db.NewTxn()
 
-	q := `query q($id: string) {
-            hotels(func: uid($id)) @filter(has(hotel)) @cascade {
-              uid
-              hotel.name
-              hotel.address
-              hotel.location
-              hotel.checkIn
-              hotel.hasCarPark
+	q := `{
+            hotels(func: uid(` + strings.Join(ids, ", ") + `)) @filter(` + hotelComplete + `) {
+              ` + hotelFields + `
 	        }
           }`
 
-	resp, err := txn.QueryWithVars(ctx, q, map[string]string{"$id": id})
+	resp, err := txn.Query(ctx, q)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(&HotelsResp{
-			Err: err.Error(),
+			Err:  err.Error(),
+			Code: utils.CodeInternal,
 		})
 		return
 	}
@@ -143,30 +190,67 @@ func getHotel(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(&HotelsResp{
-			Err: err.Error(),
+			Err:  err.Error(),
+			Code: utils.CodeInternal,
 		})
 		return
 	}
 
-	if len(hotels.Hotels) == 0 {
-		w.WriteHeader(http.StatusNotFound)
-		json.NewEncoder(w).Encode(&HotelsResp{
-			Err: "hotel not found",
-		})
-		return
+	json.NewEncoder(w).Encode(&HotelsResp{
+		Hotels: hotels.toHotels(),
+	})
+}
+
+// getHotelFromDB fetches a hotel, returning errHotelNotFound if it doesn't
+// exist or is missing any of its details.
+func getHotelFromDB(ctx context.Context, txn *dgo.Txn, id string) (*Hotel, error) {
+	q := `query q($id: string) {
+            hotels(func: uid($id)) @filter(` + hotelComplete + `) {
+              ` + hotelFields + `
+	        }
+          }`
+
+	resp, err := txn.QueryWithVars(ctx, q, map[string]string{"$id": id})
+	if err != nil {
+		return nil, err
+	}
+	var hotels hotelQuery
+	err = json.Unmarshal(resp.GetJson(), &hotels)
+	if err != nil {
+		return nil, err
 	}
 
-	hotel := hotels.Hotels[0]
-	outHotel := &Hotel{
-			ID: hotel.ID,
-			Name: hotel.Name,
-			Address: hotel.Address,
-			CheckIn: *hotel.CheckIn,
-			HasCarPark: hotel.HasCarPark,
+	outHotels := hotels.toHotels()
+	if len(outHotels) == 0 {
+		return nil, errHotelNotFound
+	}
+	return outHotels[0], nil
+}
+
+func getHotel(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	id := vars["id"]
+
+	ctx := context.Background()
+	txn := db.NewTxn()
+
+	hotel, err := getHotelFromDB(ctx, txn, id)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if err == errHotelNotFound {
+			status = http.StatusNotFound
 		}
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(&HotelResp{
+			Err:  err.Error(),
+			Code: utils.StatusCode(status),
+		})
+		return
+	}
 
 	json.NewEncoder(w).Encode(&HotelResp{
-		Hotel: outHotel,
+		Hotel: hotel,
 	})
 }
 
@@ -264,7 +348,8 @@ func openHotel(w http.ResponseWriter, r *http.Request) {
 	//}
 	w.WriteHeader(http.StatusForbidden)
 	json.NewEncoder(w).Encode(&OpenHotelResp{
-		Err: "no auth header",
+		Err:  "no auth header",
+		Code: utils.CodeUnauthenticated,
 	})
 }
 
@@ -272,8 +357,31 @@ func router() *mux.Router {
 	r := mux.NewRouter()
 
 	r.Methods("GET").Path("/hotels").HandlerFunc(getHotels)
+	r.Methods("GET").Path("/hotels/batch").HandlerFunc(getHotelsBatch)
+	r.Methods("GET").Path("/hotels/near").HandlerFunc(getHotelsNear)
+	r.Methods("POST").Path("/hotels").HandlerFunc(createHotel)
 	r.Methods("GET").Path("/hotels/{id}").HandlerFunc(getHotel)
+	r.Methods("PUT").Path("/hotels/{id}").HandlerFunc(updateHotel)
+	r.Methods("POST").Path("/hotels/{id}/archive").HandlerFunc(archiveHotel)
 	r.Methods("GET").Path("/hotels/{id}/open").HandlerFunc(openHotel)
+	r.Methods("PUT").Path("/hotels/{id}/location").HandlerFunc(setHotelLocation)
+	r.Methods("GET").Path("/hotels/{id}/emergency").HandlerFunc(getEmergencyState)
+	r.Methods("POST").Path("/hotels/{id}/emergency").HandlerFunc(requestEmergency)
+	r.Methods("POST").Path("/hotels/{id}/emergency/confirm").HandlerFunc(confirmEmergency)
+	r.Methods("POST").Path("/hotels/{id}/emergency/ack/{actionId}").HandlerFunc(ackEmergency)
+	r.Methods("GET").Path("/hotels/{id}/shifts").HandlerFunc(getHotelShifts)
+	r.Methods("POST").Path("/hotels/{id}/shifts").HandlerFunc(createShift)
+	r.Methods("GET").Path("/shifts/by-user/{id}").HandlerFunc(getUserShifts)
+	r.Methods("POST").Path("/shifts/{id}/end").HandlerFunc(endShift)
+	r.Methods("GET").Path("/zones/by-hotel/{id}").HandlerFunc(getZonesByHotel)
+	r.Methods("POST").Path("/hotels/{id}/zones").HandlerFunc(createZone)
+	r.Methods("PUT").Path("/zones/{id}").HandlerFunc(updateZone)
+	r.Methods("GET").Path("/doors/{id}").HandlerFunc(getDoor)
+	r.Methods("POST").Path("/hotels/{id}/doors").HandlerFunc(createDoor)
+	r.Methods("PUT").Path("/doors/{id}").HandlerFunc(updateDoor)
+	r.Methods("GET").Path("/doors/by-hotel/{id}").HandlerFunc(getDoorsByHotel)
+	r.Methods("GET").Path("/doors/{id}/open").HandlerFunc(openDoor)
+	r.Methods("GET").Path("/doors/{id}/open-success").HandlerFunc(openDoorSuccess)
 
 	return r
 }
@@ -292,12 +400,41 @@ func newDbClient(dbHost string) *dgo.Dgraph {
 func setup(c *dgo.Dgraph) {
 	err := c.Alter(context.Background(), &api.Operation{
 		Schema: `
-			hotel.name: string .
+			hotel.name: string @index(term) .
 			hotel.address: string .
-			hotel.location: geo .
+			hotel.location: geo @index(geo) .
 			hotel.checkIn: dateTime .
+			hotel.timeZone: string .
 			hotel.hasCarPark: bool .
-		`,
+			hotel.archivedAt: dateTime .
+			door.name: string .
+			door.hotel: uid @reverse .
+			door.shouldOpen: bool .
+			zone.name: string .
+			zone.kind: string .
+			zone.hotel: uid @reverse .
+			zone.doors: uid @reverse .
+			zone.grants: uid .
+			grant.bookingType: string .
+			grant.roomCategory: string .
+			grant.days: [int] .
+			grant.from: string .
+			grant.to: string .
+			hotel.emergencyMode: string .
+			hotel.emergencySince: dateTime .
+			hotel.emergencyAcked: bool .
+			hotel.emergencyBy: uid .
+			emergencyRequest.hotel: uid @reverse .
+			emergencyRequest.user: uid .
+			emergencyRequest.mode: string .
+			emergencyRequest.code: string .
+			emergencyRequest.expires: dateTime .
+			shift.user: uid @reverse .
+			shift.hotel: uid @reverse .
+			shift.start: dateTime @index(hour) .
+			shift.end: dateTime @index(hour) .
+			shift.createdBy: uid .
+		` + utils.AuditSchema,
 	})
 	if err != nil {
 		log.Fatalf("Error setting up schema: %v\n", err)
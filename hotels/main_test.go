@@ -2,522 +2,273 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
-	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
-	"regexp"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/dgraph-io/dgo"
+	"github.com/dgraph-io/dgo/protos/api"
 	"github.com/fluidmediaproductions/central_hotel_door_server/utils"
-	"github.com/jinzhu/gorm"
-	"gopkg.in/DATA-DOG/go-sqlmock.v1"
-	"strings"
+	"google.golang.org/grpc"
 )
 
-func fixedFullRe(s string) string {
-	return fmt.Sprintf("^%s$", regexp.QuoteMeta(s))
+// fakeDgraph stands in for a Dgraph server. Each query is answered with the
+// JSON of the first expectation whose text it contains, and mutations are
+// recorded for the test to look at.
+type fakeDgraph struct {
+	api.DgraphClient
+	t         *testing.T
+	queries   []*fakeQuery
+	mutations []*api.Mutation
+	uids      map[string]string
+	commits   int
 }
 
-func newDB(t *testing.T) (sqlmock.Sqlmock, *gorm.DB) {
-	db, mock, err := sqlmock.New()
-	if err != nil {
-		t.Fatalf("can't create sqlmock: %s", err)
-	}
-
-	gormDB, gerr := gorm.Open("mysql", db)
-	if gerr != nil {
-		t.Fatalf("can't open gorm connection: %s", err)
-	}
-
-	return mock, gormDB.Set("gorm:update_column", true)
+type fakeQuery struct {
+	contains string
+	json     string
+	err      error
 }
 
-func getRowsForHotels(hotels []*Hotel) *sqlmock.Rows {
-	var hotelFieldNames = []string{"id", "name", "address", "location", "has_car_park", "check_in", "should_door_open", "created_at", "updated_at", "deleted_at"}
-	rows := sqlmock.NewRows(hotelFieldNames)
-	for _, h := range hotels {
-		rows = rows.AddRow(h.ID, h.Name, h.Address, h.Location, h.HasCarPark, h.CheckIn, h.ShouldDoorOpen, h.CreatedAt, h.UpdatedAt, h.DeletedAt)
-	}
-	return rows
+func (f *fakeDgraph) expectQuery(contains string, json string) {
+	f.queries = append(f.queries, &fakeQuery{contains: contains, json: json})
 }
 
-func TestGetHotels(t *testing.T) {
-	sqlMock, dbMock := newDB(t)
-
-	oldDb := db
-	db = dbMock
-
-	req := httptest.NewRequest("GET", "http://a/hotels", nil)
-	w := httptest.NewRecorder()
-
-	hotels := []*Hotel{
-		{
-			Model: gorm.Model{
-				ID:        uint(1),
-				CreatedAt: time.Now(),
-				UpdatedAt: time.Now(),
-			},
-			Name: "foo",
-		},
-	}
-
-	sqlMock.ExpectQuery(fixedFullRe("SELECT * FROM `hotels` WHERE `hotels`.`deleted_at` IS NULL")).
-		WillReturnRows(getRowsForHotels(hotels))
-
-	router().ServeHTTP(w, req)
-
-	resp := w.Result()
-	body, _ := ioutil.ReadAll(resp.Body)
-
-	expBody := &bytes.Buffer{}
-	err := json.NewEncoder(expBody).Encode(&HotelsResp{
-		Hotels: hotels,
-	})
-	if err != nil {
-		t.Fatalf("Error creating test JSON: %v", err)
-	}
-
-	if string(body) != string(expBody.Bytes()) {
-		t.Errorf("Response not what was expected, got %s wanted %s", string(body), string(expBody.Bytes()))
-	}
-
-	req = httptest.NewRequest("GET", "http://a/hotels", nil)
-	w = httptest.NewRecorder()
-
-	sqlMock.ExpectQuery(fixedFullRe("SELECT * FROM `hotels` WHERE `hotels`.`deleted_at` IS NULL")).
-		WillReturnError(errors.New("foobar"))
-
-	router().ServeHTTP(w, req)
-
-	resp = w.Result()
-	body, _ = ioutil.ReadAll(resp.Body)
+func (f *fakeDgraph) failQuery(contains string, err error) {
+	f.queries = append(f.queries, &fakeQuery{contains: contains, err: err})
+}
 
-	if resp.StatusCode != http.StatusInternalServerError {
-		t.Errorf("Expected 500 error got %s", resp.Status)
+func (f *fakeDgraph) Query(ctx context.Context, in *api.Request, opts ...grpc.CallOption) (*api.Response, error) {
+	for _, query := range f.queries {
+		if strings.Contains(in.Query, query.contains) {
+			if query.err != nil {
+				return nil, query.err
+			}
+			return &api.Response{Json: []byte(query.json)}, nil
+		}
 	}
+	f.t.Errorf("Unexpected query %s", in.Query)
+	return nil, errors.New("unexpected query")
+}
 
-	expBody = &bytes.Buffer{}
-	err = json.NewEncoder(expBody).Encode(&HotelsResp{
-		Err: "foobar",
-	})
-	if err != nil {
-		t.Fatalf("Error creating test JSON: %v", err)
-	}
+// Mutate hands back the uids set up for blank nodes.
+func (f *fakeDgraph) Mutate(ctx context.Context, in *api.Mutation, opts ...grpc.CallOption) (*api.Assigned, error) {
+	f.mutations = append(f.mutations, in)
+	if in.CommitNow {
+		f.commits++
+	}
+	// Handing back a key makes the client commit through CommitOrAbort
+	return &api.Assigned{
+		Uids:    f.uids,
+		Context: &api.TxnContext{Keys: []string{"hotel"}},
+	}, nil
+}
 
-	if string(body) != string(expBody.Bytes()) {
-		t.Errorf("Response not what was expected, got %s wanted %s", string(body), string(expBody.Bytes()))
+func (f *fakeDgraph) CommitOrAbort(ctx context.Context, in *api.TxnContext, opts ...grpc.CallOption) (*api.TxnContext, error) {
+	if !in.Aborted {
+		f.commits++
 	}
-
-	db = oldDb
+	return in, nil
 }
 
-func TestGetHotel(t *testing.T) {
-	sqlMock, dbMock := newDB(t)
-
+// useFakeDB points the service at a fake Dgraph until the returned func is
+// called.
+func useFakeDB(t *testing.T) (*fakeDgraph, func()) {
+	fake := &fakeDgraph{t: t, uids: map[string]string{}}
 	oldDb := db
-	db = dbMock
-
-	req := httptest.NewRequest("GET", "http://a/hotels/1", nil)
-	w := httptest.NewRecorder()
-
-	hotel := &Hotel{
-		Model: gorm.Model{
-			ID:        uint(1),
-			CreatedAt: time.Now(),
-			UpdatedAt: time.Now(),
-		},
-		Name: "foo",
+	db = dgo.NewDgraphClient(fake)
+	return fake, func() {
+		db = oldDb
 	}
+}
 
-	sqlMock.ExpectQuery(fixedFullRe("SELECT * FROM `hotels` WHERE `hotels`.`deleted_at` IS NULL AND ((`hotels`.`id` = 1))")).
-		WillReturnRows(getRowsForHotels([]*Hotel{hotel}))
-
-	router().ServeHTTP(w, req)
-
-	resp := w.Result()
-	body, _ := ioutil.ReadAll(resp.Body)
-
-	expBody := &bytes.Buffer{}
-	err := json.NewEncoder(expBody).Encode(&HotelResp{
-		Hotel: hotel,
-	})
-	if err != nil {
-		t.Fatalf("Error creating test JSON: %v", err)
-	}
-
-	if string(body) != string(expBody.Bytes()) {
-		t.Errorf("Response not what was expected, got %s wanted %s", string(body), string(expBody.Bytes()))
-	}
-
-	req = httptest.NewRequest("GET", "http://a/hotels/1", nil)
-	w = httptest.NewRecorder()
-
-	sqlMock.ExpectQuery(fixedFullRe("SELECT * FROM `hotels` WHERE `hotels`.`deleted_at` IS NULL AND ((`hotels`.`id` = 1))")).
-		WillReturnRows(getRowsForHotels([]*Hotel{}))
-
-	router().ServeHTTP(w, req)
-
-	resp = w.Result()
-	body, _ = ioutil.ReadAll(resp.Body)
-
-	expBody = &bytes.Buffer{}
-	err = json.NewEncoder(expBody).Encode(&HotelResp{
-		Err: "hotel not found",
-	})
+func newTestJWT(t *testing.T, user *utils.User) string {
+	jwt, err := utils.NewJWT(user, jwtSecret)
 	if err != nil {
-		t.Fatalf("Error creating test JSON: %v", err)
+		t.Fatalf("Error making JWT: %v", err)
 	}
+	return jwt
+}
 
-	if string(body) != string(expBody.Bytes()) {
-		t.Errorf("Response not what was expected, got %s wanted %s", string(body), string(expBody.Bytes()))
-	}
-
-	req = httptest.NewRequest("GET", "http://a/hotels/1", nil)
-	w = httptest.NewRecorder()
-
-	sqlMock.ExpectQuery(fixedFullRe("SELECT * FROM `hotels` WHERE `hotels`.`deleted_at` IS NULL AND ((`hotels`.`id` = 1))")).
-		WillReturnError(errors.New("foobar"))
-
-	router().ServeHTTP(w, req)
-
-	resp = w.Result()
-	body, _ = ioutil.ReadAll(resp.Body)
-
-	expBody = &bytes.Buffer{}
-	err = json.NewEncoder(expBody).Encode(&HotelResp{
-		Err: "foobar",
-	})
-	if err != nil {
-		t.Fatalf("Error creating test JSON: %v", err)
+func doRequest(method string, url string, jwt string, body string) (*http.Response, []byte) {
+	var reqBody io.Reader
+	if body != "" {
+		reqBody = strings.NewReader(body)
 	}
-
-	if string(body) != string(expBody.Bytes()) {
-		t.Errorf("Response not what was expected, got %s wanted %s", string(body), string(expBody.Bytes()))
+	req := httptest.NewRequest(method, url, reqBody)
+	if jwt != "" {
+		req.Header.Set("Authorization", "Bearer "+jwt)
 	}
-
-	db = oldDb
-}
-
-func TestOpenHotel(t *testing.T) {
-	sqlMock, dbMock := newDB(t)
-
-	oldDb := db
-	db = dbMock
-
-	req := httptest.NewRequest("GET", "http://a/hotels/1/open", nil)
 	w := httptest.NewRecorder()
-
-	sqlMock.ExpectQuery(fixedFullRe("SELECT * FROM `hotels` WHERE `hotels`.`deleted_at` IS NULL AND ((`hotels`.`id` = 1))")).
-		WillReturnRows(getRowsForHotels([]*Hotel{}))
-
 	router().ServeHTTP(w, req)
 
 	resp := w.Result()
-	body, _ := ioutil.ReadAll(resp.Body)
+	respBody, _ := ioutil.ReadAll(resp.Body)
+	return resp, respBody
+}
 
+func encodeResp(t *testing.T, v interface{}) string {
 	expBody := &bytes.Buffer{}
-	err := json.NewEncoder(expBody).Encode(&OpenHotelResp{
-		Err: "hotel not found",
-	})
-	if err != nil {
-		t.Fatalf("Error creating test JSON: %v", err)
-	}
-
-	if string(body) != string(expBody.Bytes()) {
-		t.Errorf("Response not what was expected, got %s wanted %s", string(body), string(expBody.Bytes()))
-	}
-
-	req = httptest.NewRequest("GET", "http://a/hotels/1/open", nil)
-	w = httptest.NewRecorder()
-
-	sqlMock.ExpectQuery(fixedFullRe("SELECT * FROM `hotels` WHERE `hotels`.`deleted_at` IS NULL AND ((`hotels`.`id` = 1))")).
-		WillReturnError(errors.New("foobar"))
-
-	router().ServeHTTP(w, req)
-
-	resp = w.Result()
-	body, _ = ioutil.ReadAll(resp.Body)
-
-	expBody = &bytes.Buffer{}
-	err = json.NewEncoder(expBody).Encode(&OpenHotelResp{
-		Err: "foobar",
-	})
+	err := json.NewEncoder(expBody).Encode(v)
 	if err != nil {
 		t.Fatalf("Error creating test JSON: %v", err)
 	}
+	return expBody.String()
+}
 
-	if string(body) != string(expBody.Bytes()) {
-		t.Errorf("Response not what was expected, got %s wanted %s", string(body), string(expBody.Bytes()))
-	}
-
-	req = httptest.NewRequest("GET", "http://a/hotels/1/open", nil)
-	w = httptest.NewRecorder()
-
-	hotel := &Hotel{
-		Model: gorm.Model{
-			ID:        uint(1),
-			CreatedAt: time.Now(),
-			UpdatedAt: time.Now(),
-		},
-		Name: "foo",
-	}
-
-	sqlMock.ExpectQuery(fixedFullRe("SELECT * FROM `hotels` WHERE `hotels`.`deleted_at` IS NULL AND ((`hotels`.`id` = 1))")).
-		WillReturnRows(getRowsForHotels([]*Hotel{hotel}))
-
-	router().ServeHTTP(w, req)
-
-	resp = w.Result()
-	body, _ = ioutil.ReadAll(resp.Body)
-
-	expBody = &bytes.Buffer{}
-	err = json.NewEncoder(expBody).Encode(&OpenHotelResp{
-		Err: "no auth header",
-	})
-	if err != nil {
-		t.Fatalf("Error creating test JSON: %v", err)
-	}
-
-	if string(body) != string(expBody.Bytes()) {
-		t.Errorf("Response not what was expected, got %s wanted %s", string(body), string(expBody.Bytes()))
-	}
-
-	req = httptest.NewRequest("GET", "http://a/hotels/1/open", nil)
-	req.Header.Set("Authorization", "Bearer bla")
-	w = httptest.NewRecorder()
-
-	sqlMock.ExpectQuery(fixedFullRe("SELECT * FROM `hotels` WHERE `hotels`.`deleted_at` IS NULL AND ((`hotels`.`id` = 1))")).
-		WillReturnRows(getRowsForHotels([]*Hotel{hotel}))
-
-	router().ServeHTTP(w, req)
-
-	resp = w.Result()
-	body, _ = ioutil.ReadAll(resp.Body)
-
-	expBody = &bytes.Buffer{}
-	err = json.NewEncoder(expBody).Encode(&OpenHotelResp{
-		Err: "token contains an invalid number of segments",
-	})
-	if err != nil {
-		t.Fatalf("Error creating test JSON: %v", err)
-	}
-
-	if string(body) != string(expBody.Bytes()) {
-		t.Errorf("Response not what was expected, got %s wanted %s", string(body), string(expBody.Bytes()))
-	}
-
-	user := &utils.User{
-		Model: gorm.Model{
-			ID: 1,
-		},
-		Name: "Bob",
+// mutationNodes reads the nodes set by a mutation.
+func mutationNodes(t *testing.T, mutation *api.Mutation) []map[string]interface{} {
+	data := mutation.SetJson
+	if len(data) == 0 {
+		data = mutation.DeleteJson
+	}
+	var nodes []map[string]interface{}
+	if bytes.HasPrefix(data, []byte("[")) {
+		err := json.Unmarshal(data, &nodes)
+		if err != nil {
+			t.Fatalf("Error reading mutation: %v", err)
+		}
+		return nodes
 	}
-	jwt, err := utils.NewJWT(user)
+	var node map[string]interface{}
+	err := json.Unmarshal(data, &node)
 	if err != nil {
-		t.Fatalf("Failed to make JWT: %v", err)
+		t.Fatalf("Error reading mutation: %v", err)
 	}
+	return []map[string]interface{}{node}
+}
 
-	req = httptest.NewRequest("GET", "http://a/hotels/1/open", nil)
-	req.Header.Set("Authorization", "Bearer "+jwt)
-	w = httptest.NewRecorder()
+var testCheckIn = time.Date(2018, 1, 1, 14, 0, 0, 0, time.UTC)
 
-	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ") != jwt {
-			t.Errorf("Wrong JWT given to bookings server, got %s expected %s",
-				strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "), jwt)
+const testHotelsJSON = `{
+	"hotels": [
+		{
+			"uid": "0x1",
+			"hotel.name": "foo",
+			"hotel.address": "1 High Street",
+			"hotel.location": {"type": "Point", "coordinates": [-0.1, 51.5]},
+			"hotel.checkIn": "2018-01-01T14:00:00Z",
+			"hotel.timeZone": "Europe/London",
+			"hotel.hasCarPark": true
 		}
-		fmt.Fprint(w, `
-			bla
-		`)
-	}))
-	defer ts.Close()
-
-	sqlMock.ExpectQuery(fixedFullRe("SELECT * FROM `hotels` WHERE `hotels`.`deleted_at` IS NULL AND ((`hotels`.`id` = 1))")).
-		WillReturnRows(getRowsForHotels([]*Hotel{hotel}))
-
-	BookingsServer = ts.URL
-	router().ServeHTTP(w, req)
-
-	resp = w.Result()
-	body, _ = ioutil.ReadAll(resp.Body)
-
-	expBody = &bytes.Buffer{}
-	err = json.NewEncoder(expBody).Encode(&OpenHotelResp{
-		Err: "invalid character 'b' looking for beginning of value",
-	})
-	if err != nil {
-		t.Fatalf("Error creating test JSON: %v", err)
-	}
-
-	if string(body) != string(expBody.Bytes()) {
-		t.Errorf("Response not what was expected, got %s wanted %s", string(body), string(expBody.Bytes()))
+	]
+}`
+
+func testHotel() *Hotel {
+	return &Hotel{
+		ID:         "0x1",
+		Name:       "foo",
+		Address:    "1 High Street",
+		Location:   utils.NewPoint(51.5, -0.1),
+		CheckIn:    testCheckIn,
+		TimeZone:   "Europe/London",
+		HasCarPark: true,
 	}
+}
 
-	req = httptest.NewRequest("GET", "http://a/hotels/1/open", nil)
-	req.Header.Set("Authorization", "Bearer "+jwt)
-	w = httptest.NewRecorder()
-
-	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ") != jwt {
-			t.Errorf("Wrong JWT given to bookings server, got %s expected %s",
-				strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "), jwt)
-		}
-		fmt.Fprint(w, `
-			{
-				"err": "foobar"
-			}
-		`)
-	}))
-	defer ts.Close()
-
-	sqlMock.ExpectQuery(fixedFullRe("SELECT * FROM `hotels` WHERE `hotels`.`deleted_at` IS NULL AND ((`hotels`.`id` = 1))")).
-		WillReturnRows(getRowsForHotels([]*Hotel{hotel}))
-
-	BookingsServer = ts.URL
-	router().ServeHTTP(w, req)
+func TestGetHotels(t *testing.T) {
+	fake, restore := useFakeDB(t)
+	defer restore()
 
-	resp = w.Result()
-	body, _ = ioutil.ReadAll(resp.Body)
+	fake.expectQuery("hotels(func: has(hotel)", testHotelsJSON)
+	resp, body := doRequest("GET", "http://a/hotels", "", "")
 
-	expBody = &bytes.Buffer{}
-	err = json.NewEncoder(expBody).Encode(&OpenHotelResp{
-		Err: "foobar",
+	expBody := encodeResp(t, &HotelsResp{
+		Hotels:   []*Hotel{testHotel()},
+		PageInfo: utils.NewPageInfo(false, "0x1"),
 	})
-	if err != nil {
-		t.Fatalf("Error creating test JSON: %v", err)
+	if resp.StatusCode != http.StatusOK || string(body) != expBody {
+		t.Errorf("Response not what was expected, got %s %s wanted %s", resp.Status, string(body), expBody)
+	}
+
+	// One more hotel than asked for is fetched to see if there's another page
+	fake.queries = nil
+	fake.expectQuery("hotels(func: has(hotel), first: 2", `{
+		"hotels": [
+			{"uid": "0x1", "hotel.name": "foo", "hotel.checkIn": "2018-01-01T14:00:00Z"},
+			{"uid": "0x2", "hotel.name": "bar", "hotel.checkIn": "2018-01-01T14:00:00Z"}
+		]
+	}`)
+	resp, body = doRequest("GET", "http://a/hotels?first=1", "", "")
+	var hotelsResp HotelsResp
+	err := json.Unmarshal(body, &hotelsResp)
+	if resp.StatusCode != http.StatusOK || err != nil || len(hotelsResp.Hotels) != 1 {
+		t.Fatalf("Expected one hotel, got %s %s", resp.Status, string(body))
+	}
+	if !hotelsResp.PageInfo.HasNextPage || hotelsResp.PageInfo.EndCursor != utils.EncodeCursor("0x1") {
+		t.Errorf("Expected another page after the first hotel, got %+v", hotelsResp.PageInfo)
+	}
+
+	fake.queries = nil
+	fake.failQuery("hotels(func: has(hotel)", errors.New("foobar"))
+	resp, body = doRequest("GET", "http://a/hotels", "", "")
+
+	expBody = encodeResp(t, &HotelsResp{
+		Err:  "foobar",
+		Code: utils.CodeInternal,
+	})
+	if resp.StatusCode != http.StatusInternalServerError || string(body) != expBody {
+		t.Errorf("Expected 500 error, got %s %s", resp.Status, string(body))
 	}
 
-	if string(body) != string(expBody.Bytes()) {
-		t.Errorf("Response not what was expected, got %s wanted %s", string(body), string(expBody.Bytes()))
+	resp, _ = doRequest("GET", "http://a/hotels?archived=include", "", "")
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("Expected 403 error listing archived hotels without a JWT, got %s", resp.Status)
 	}
+}
 
-	req = httptest.NewRequest("GET", "http://a/hotels/1/open", nil)
-	req.Header.Set("Authorization", "Bearer "+jwt)
-	w = httptest.NewRecorder()
-
-	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ") != jwt {
-			t.Errorf("Wrong JWT given to bookings server, got %s expected %s",
-				strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "), jwt)
-		}
-		fmt.Fprint(w, `
-			{
-				"booking": {
-				}
-			}
-		`)
-	}))
-	defer ts.Close()
-
-	sqlMock.ExpectQuery(fixedFullRe("SELECT * FROM `hotels` WHERE `hotels`.`deleted_at` IS NULL AND ((`hotels`.`id` = 1))")).
-		WillReturnRows(getRowsForHotels([]*Hotel{hotel}))
-
-	sqlMock.ExpectExec(fixedFullRe("UPDATE `hotels` SET `created_at` = ?, `updated_at` = ?, `deleted_at` = ?, `name` = ?," +
-		" `address` = ?, `check_in` = ?, `has_car_park` = ?, `should_door_open` = ? WHERE `hotels`.`deleted_at` IS NULL AND `hotels`.`id` = ?")).
-		WillReturnError(errors.New("foobar"))
-
-	BookingsServer = ts.URL
-	router().ServeHTTP(w, req)
+func TestGetHotel(t *testing.T) {
+	fake, restore := useFakeDB(t)
+	defer restore()
 
-	resp = w.Result()
-	body, _ = ioutil.ReadAll(resp.Body)
+	fake.expectQuery("hotels(func: uid($id))", testHotelsJSON)
+	resp, body := doRequest("GET", "http://a/hotels/0x1", "", "")
 
-	expBody = &bytes.Buffer{}
-	err = json.NewEncoder(expBody).Encode(&OpenHotelResp{
-		Err: "foobar",
+	expBody := encodeResp(t, &HotelResp{
+		Hotel: testHotel(),
 	})
-	if err != nil {
-		t.Fatalf("Error creating test JSON: %v", err)
-	}
-
-	if string(body) != string(expBody.Bytes()) {
-		t.Errorf("Response not what was expected, got %s wanted %s", string(body), string(expBody.Bytes()))
+	if resp.StatusCode != http.StatusOK || string(body) != expBody {
+		t.Errorf("Response not what was expected, got %s %s wanted %s", resp.Status, string(body), expBody)
 	}
 
-	req = httptest.NewRequest("GET", "http://a/hotels/1/open", nil)
-	req.Header.Set("Authorization", "Bearer "+jwt)
-	w = httptest.NewRecorder()
+	fake.queries = nil
+	fake.expectQuery("hotels(func: uid($id))", `{"hotels": []}`)
+	resp, body = doRequest("GET", "http://a/hotels/0x2", "", "")
 
-	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ") != jwt {
-			t.Errorf("Wrong JWT given to bookings server, got %s expected %s",
-				strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "), jwt)
-		}
-		fmt.Fprint(w, `
-			{
-				"booking": {
-				}
-			}
-		`)
-	}))
-	defer ts.Close()
-
-	sqlMock.ExpectQuery(fixedFullRe("SELECT * FROM `hotels` WHERE `hotels`.`deleted_at` IS NULL AND ((`hotels`.`id` = 1))")).
-		WillReturnRows(getRowsForHotels([]*Hotel{hotel}))
-
-	sqlMock.ExpectExec(fixedFullRe("UPDATE `hotels` SET `created_at` = ?, `updated_at` = ?, `deleted_at` = ?, `name` = ?," +
-		" `address` = ?, `check_in` = ?, `has_car_park` = ?, `should_door_open` = ? WHERE `hotels`.`deleted_at` IS NULL AND `hotels`.`id` = ?")).
-		WillReturnResult(sqlmock.NewResult(0, 1))
-
-	BookingsServer = ts.URL
-	router().ServeHTTP(w, req)
-
-	resp = w.Result()
-	body, _ = ioutil.ReadAll(resp.Body)
-
-	expBody = &bytes.Buffer{}
-	err = json.NewEncoder(expBody).Encode(&OpenHotelResp{
-		Success: true,
+	expBody = encodeResp(t, &HotelResp{
+		Err:  "hotel not found",
+		Code: utils.CodeNotFound,
 	})
-	if err != nil {
-		t.Fatalf("Error creating test JSON: %v", err)
+	if resp.StatusCode != http.StatusNotFound || string(body) != expBody {
+		t.Errorf("Expected 404 error, got %s %s", resp.Status, string(body))
 	}
 
-	if string(body) != string(expBody.Bytes()) {
-		t.Errorf("Response not what was expected, got %s wanted %s", string(body), string(expBody.Bytes()))
+	fake.queries = nil
+	fake.failQuery("hotels(func: uid($id))", errors.New("foobar"))
+	resp, _ = doRequest("GET", "http://a/hotels/0x1", "", "")
+	if resp.StatusCode != http.StatusInternalServerError {
+		t.Errorf("Expected 500 error, got %s", resp.Status)
 	}
+}
 
-	req = httptest.NewRequest("GET", "http://a/hotels/1/open", nil)
-	req.Header.Set("Authorization", "Bearer "+jwt)
-	w = httptest.NewRecorder()
-
-	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ") != jwt {
-			t.Errorf("Wrong JWT given to bookings server, got %s expected %s",
-				strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "), jwt)
-		}
-		fmt.Fprint(w, `
-			{
-				"foo": "bar"
-			}
-		`)
-	}))
-	defer ts.Close()
-
-	sqlMock.ExpectQuery(fixedFullRe("SELECT * FROM `hotels` WHERE `hotels`.`deleted_at` IS NULL AND ((`hotels`.`id` = 1))")).
-		WillReturnRows(getRowsForHotels([]*Hotel{hotel}))
-
-	BookingsServer = ts.URL
-	router().ServeHTTP(w, req)
+func TestOpenHotel(t *testing.T) {
+	_, restore := useFakeDB(t)
+	defer restore()
 
-	resp = w.Result()
-	body, _ = ioutil.ReadAll(resp.Body)
+	resp, body := doRequest("GET", "http://a/hotels/0x1/open", "", "")
 
-	expBody = &bytes.Buffer{}
-	err = json.NewEncoder(expBody).Encode(&OpenHotelResp{
-		Err: "unknown",
+	expBody := encodeResp(t, &OpenHotelResp{
+		Err:  "no auth header",
+		Code: utils.CodeUnauthenticated,
 	})
-	if err != nil {
-		t.Fatalf("Error creating test JSON: %v", err)
+	if resp.StatusCode != http.StatusForbidden || string(body) != expBody {
+		t.Errorf("Expected 403 error, got %s %s", resp.Status, string(body))
 	}
-
-	if string(body) != string(expBody.Bytes()) {
-		t.Errorf("Response not what was expected, got %s wanted %s", string(body), string(expBody.Bytes()))
-	}
-
-	db = oldDb
 }
@@ -0,0 +1,382 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/dgraph-io/dgo"
+	"github.com/dgraph-io/dgo/protos/api"
+	"github.com/fluidmediaproductions/central_hotel_door_server/clients"
+	"github.com/fluidmediaproductions/central_hotel_door_server/utils"
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+)
+
+type StaffShift = clients.StaffShift
+type ShiftInput = clients.ShiftInput
+type ShiftResp = clients.ShiftResp
+type ShiftsResp = clients.ShiftsResp
+
+var errShiftNotFound = errors.New("shift not found")
+
+const shiftFields = `uid
+                shift.start
+                shift.end
+                shift.user {
+                  uid
+                }
+                shift.hotel {
+                  uid
+                }
+                shift.createdBy {
+                  uid
+                }`
+
+type shiftQuery struct {
+	ID    string    `json:"uid"`
+	Start time.Time `json:"shift.start"`
+	End   time.Time `json:"shift.end"`
+	User  []struct {
+		ID string `json:"uid"`
+	} `json:"shift.user"`
+	Hotel []struct {
+		ID string `json:"uid"`
+	} `json:"shift.hotel"`
+	CreatedBy []struct {
+		ID string `json:"uid"`
+	} `json:"shift.createdBy"`
+}
+
+func (s *shiftQuery) toShift() *StaffShift {
+	shift := &StaffShift{
+		ID:    s.ID,
+		Start: s.Start,
+		End:   s.End,
+	}
+	if len(s.User) > 0 {
+		shift.UserID = s.User[0].ID
+	}
+	if len(s.Hotel) > 0 {
+		shift.HotelID = s.Hotel[0].ID
+	}
+	if len(s.CreatedBy) > 0 {
+		shift.CreatedBy = s.CreatedBy[0].ID
+	}
+	return shift
+}
+
+func toShifts(queried []*shiftQuery) []*StaffShift {
+	shifts := make([]*StaffShift, 0, len(queried))
+	for _, shift := range queried {
+		shifts = append(shifts, shift.toShift())
+	}
+	return shifts
+}
+
+// checkShiftInput checks a shift makes sense and hasn't already finished.
+func checkShiftInput(input *ShiftInput, now time.Time) error {
+	if !utils.IsUID(input.UserID) {
+		return errors.Errorf("invalid user %q", input.UserID)
+	}
+	if !input.Start.Before(input.End) {
+		return errors.New("start must be before end")
+	}
+	if !input.End.After(now) {
+		return errors.New("shift has already ended")
+	}
+	return nil
+}
+
+func writeShiftError(w http.ResponseWriter, status int, err error) {
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(&ShiftResp{
+		Err:  err.Error(),
+		Code: utils.StatusCode(status),
+	})
+}
+
+func getShiftFromDB(ctx context.Context, txn *dgo.Txn, id string) (*StaffShift, error) {
+	q := `query q($id: string) {
+            shifts(func: uid($id)) @filter(has(shift.user)) {
+              ` + shiftFields + `
+            }
+          }`
+
+	resp, err := txn.QueryWithVars(ctx, q, map[string]string{"$id": id})
+	if err != nil {
+		return nil, err
+	}
+	var shifts struct {
+		Shifts []*shiftQuery `json:"shifts"`
+	}
+	err = json.Unmarshal(resp.GetJson(), &shifts)
+	if err != nil {
+		return nil, err
+	}
+	if len(shifts.Shifts) == 0 {
+		return nil, errShiftNotFound
+	}
+	return shifts.Shifts[0].toShift(), nil
+}
+
+// createShift puts a member of staff on shift at a hotel, letting them into
+// its rooms and doors while it's on.
+func createShift(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	claims, err := getAdminClaims(r)
+	if err != nil {
+		writeAdminAuthError(w, err)
+		return
+	}
+
+	var input ShiftInput
+	err = json.NewDecoder(r.Body).Decode(&input)
+	r.Body.Close()
+	if err != nil {
+		writeShiftError(w, http.StatusBadRequest, errors.New("bad request data"))
+		return
+	}
+	err = checkShiftInput(&input, time.Now())
+	if err != nil {
+		writeShiftError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	ctx := context.Background()
+	txn := db.NewTxn()
+	defer txn.Discard(ctx)
+
+	exists, err := hotelExists(ctx, txn, id)
+	if err != nil {
+		writeShiftError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if !exists {
+		writeShiftError(w, http.StatusNotFound, errHotelNotFound)
+		return
+	}
+
+	mutData, err := json.Marshal(map[string]interface{}{
+		"uid":             "_:shift",
+		"shift.user":      &utils.UIDRef{ID: input.UserID},
+		"shift.hotel":     &utils.UIDRef{ID: id},
+		"shift.start":     input.Start,
+		"shift.end":       input.End,
+		"shift.createdBy": &utils.UIDRef{ID: claims.User.ID},
+	})
+	if err != nil {
+		writeShiftError(w, http.StatusInternalServerError, err)
+		return
+	}
+	assigned, err := txn.Mutate(ctx, &api.Mutation{SetJson: mutData})
+	if err != nil {
+		writeShiftError(w, http.StatusInternalServerError, err)
+		return
+	}
+	shiftId := assigned.GetUids()["shift"]
+	err = writeAudit(ctx, txn, utils.NewAuditEntry("shift.created", claims.User.ID, shiftId, "for "+input.UserID+" at "+id))
+	if err == nil {
+		err = txn.Commit(ctx)
+	}
+	if err != nil {
+		writeShiftError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	shift, err := getShiftFromDB(ctx, db.NewTxn(), shiftId)
+	if err != nil {
+		writeShiftError(w, http.StatusInternalServerError, err)
+		return
+	}
+	json.NewEncoder(w).Encode(&ShiftResp{
+		Shift: shift,
+	})
+}
+
+// getHotelShifts lists a hotel's shifts that haven't ended by from, which is
+// now if it's not given, for admins and the front desk.
+func getHotelShifts(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	claims, err := utils.GetRequestJWT(r, jwtSecret)
+	if err != nil {
+		writeAdminAuthError(w, err)
+		return
+	}
+	if !claims.User.HasRole(utils.RoleAdmin, utils.RoleFrontDesk) {
+		writeShiftError(w, http.StatusForbidden, errors.New("only admins and the front desk can see shifts"))
+		return
+	}
+
+	from := time.Now()
+	if value := r.URL.Query().Get("from"); value != "" {
+		from, err = time.Parse(time.RFC3339, value)
+		if err != nil {
+			writeShiftError(w, http.StatusBadRequest, errors.Errorf("invalid from %q", value))
+			return
+		}
+	}
+
+	ctx := context.Background()
+	txn := db.NewTxn()
+	defer txn.Discard(ctx)
+
+	q := `query q($id: string, $from: string) {
+            hotels(func: uid($id)) @filter(has(hotel)) {
+              ~shift.hotel @filter(gt(shift.end, $from)) (orderasc: shift.start) {
+                ` + shiftFields + `
+              }
+            }
+          }`
+
+	resp, err := txn.QueryWithVars(ctx, q, map[string]string{"$id": id, "$from": from.Format(time.RFC3339)})
+	if err != nil {
+		writeShiftError(w, http.StatusInternalServerError, err)
+		return
+	}
+	var hotels struct {
+		Hotels []struct {
+			Shifts []*shiftQuery `json:"~shift.hotel"`
+		} `json:"hotels"`
+	}
+	err = json.Unmarshal(resp.GetJson(), &hotels)
+	if err != nil {
+		writeShiftError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if len(hotels.Hotels) == 0 {
+		writeShiftError(w, http.StatusNotFound, errHotelNotFound)
+		return
+	}
+
+	json.NewEncoder(w).Encode(&ShiftsResp{
+		Shifts: toShifts(hotels.Hotels[0].Shifts),
+	})
+}
+
+// getUserShifts lists a user's shifts that are on at a time, which is now if
+// it's not given, for that user or an admin.
+func getUserShifts(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	claims, err := utils.GetRequestJWT(r, jwtSecret)
+	if err != nil {
+		writeAdminAuthError(w, err)
+		return
+	}
+	if claims.User.ID != id && !claims.User.HasRole(utils.RoleAdmin) {
+		writeShiftError(w, http.StatusForbidden, errors.New("can only see your own shifts"))
+		return
+	}
+
+	at := time.Now()
+	if value := r.URL.Query().Get("at"); value != "" {
+		at, err = time.Parse(time.RFC3339, value)
+		if err != nil {
+			writeShiftError(w, http.StatusBadRequest, errors.Errorf("invalid at %q", value))
+			return
+		}
+	}
+
+	ctx := context.Background()
+	txn := db.NewTxn()
+	defer txn.Discard(ctx)
+
+	q := `query q($id: string, $at: string) {
+            users(func: uid($id)) {
+              ~shift.user @filter(le(shift.start, $at) AND gt(shift.end, $at)) (orderasc: shift.start) {
+                ` + shiftFields + `
+              }
+            }
+          }`
+
+	resp, err := txn.QueryWithVars(ctx, q, map[string]string{"$id": id, "$at": at.Format(time.RFC3339)})
+	if err != nil {
+		writeShiftError(w, http.StatusInternalServerError, err)
+		return
+	}
+	var users struct {
+		Users []struct {
+			Shifts []*shiftQuery `json:"~shift.user"`
+		} `json:"users"`
+	}
+	err = json.Unmarshal(resp.GetJson(), &users)
+	if err != nil {
+		writeShiftError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	shifts := make([]*StaffShift, 0)
+	for _, user := range users.Users {
+		shifts = append(shifts, toShifts(user.Shifts)...)
+	}
+	json.NewEncoder(w).Encode(&ShiftsResp{
+		Shifts: shifts,
+	})
+}
+
+// endShift takes away a member of staff's access now, or cancels a shift
+// that hasn't started.
+func endShift(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	claims, err := getAdminClaims(r)
+	if err != nil {
+		writeAdminAuthError(w, err)
+		return
+	}
+
+	ctx := context.Background()
+	txn := db.NewTxn()
+	defer txn.Discard(ctx)
+
+	shift, err := getShiftFromDB(ctx, txn, id)
+	if err == errShiftNotFound {
+		writeShiftError(w, http.StatusNotFound, err)
+		return
+	} else if err != nil {
+		writeShiftError(w, http.StatusInternalServerError, err)
+		return
+	}
+	now := time.Now()
+	if !shift.End.After(now) {
+		writeShiftError(w, http.StatusConflict, errors.New("shift has already ended"))
+		return
+	}
+
+	end := now
+	if shift.Start.After(now) {
+		end = shift.Start
+	}
+	mutData, err := json.Marshal(map[string]interface{}{
+		"uid":       id,
+		"shift.end": end,
+	})
+	if err != nil {
+		writeShiftError(w, http.StatusInternalServerError, err)
+		return
+	}
+	_, err = txn.Mutate(ctx, &api.Mutation{SetJson: mutData})
+	if err == nil {
+		err = writeAudit(ctx, txn, utils.NewAuditEntry("shift.ended", claims.User.ID, id, ""))
+	}
+	if err == nil {
+		err = txn.Commit(ctx)
+	}
+	if err != nil {
+		writeShiftError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	shift.End = end
+	json.NewEncoder(w).Encode(&ShiftResp{
+		Shift: shift,
+	})
+}
@@ -0,0 +1,337 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/dgraph-io/dgo/protos/api"
+	"github.com/fluidmediaproductions/central_hotel_door_server/clients"
+	"github.com/fluidmediaproductions/central_hotel_door_server/utils"
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+)
+
+type Door = clients.Door
+type Zone = clients.Zone
+type DoorsResp = clients.DoorsResp
+type DoorResp = clients.DoorResp
+type ZonesResp = clients.ZonesResp
+type OpenDoorResp = clients.OpenDoorResp
+
+var errDoorNotFound = errors.New("door not found")
+
+type grantQuery struct {
+	ID           string `json:"uid"`
+	BookingType  string `json:"grant.bookingType"`
+	RoomCategory string `json:"grant.roomCategory"`
+	Days         []int  `json:"grant.days"`
+	From         string `json:"grant.from"`
+	To           string `json:"grant.to"`
+}
+
+type zoneQuery struct {
+	ID     string        `json:"uid"`
+	Name   string        `json:"zone.name"`
+	Kind   string        `json:"zone.kind"`
+	Grants []*grantQuery `json:"zone.grants"`
+	Hotel  []struct {
+		ID string `json:"uid"`
+	} `json:"zone.hotel"`
+}
+
+type doorQuery struct {
+	Doors []struct {
+		ID         string `json:"uid"`
+		Name       string `json:"door.name"`
+		ShouldOpen bool   `json:"door.shouldOpen"`
+		Hotel      []struct {
+			ID string `json:"uid"`
+		} `json:"door.hotel"`
+		Zones []*zoneQuery `json:"~zone.doors"`
+	} `json:"doors"`
+}
+
+const zoneFields = `uid
+                zone.name
+                zone.kind
+                zone.hotel {
+                  uid
+                }
+                zone.grants {
+                  uid
+                  grant.bookingType
+                  grant.roomCategory
+                  grant.days
+                  grant.from
+                  grant.to
+                }`
+
+func (z *zoneQuery) toZone() *Zone {
+	zone := &Zone{
+		ID:     z.ID,
+		Name:   z.Name,
+		Kind:   z.Kind,
+		Grants: make([]*utils.ZoneGrant, 0),
+	}
+	if len(z.Hotel) > 0 {
+		zone.HotelID = z.Hotel[0].ID
+	}
+	for _, g := range z.Grants {
+		grant := &utils.ZoneGrant{
+			ID:           g.ID,
+			BookingType:  g.BookingType,
+			RoomCategory: g.RoomCategory,
+		}
+		if len(g.Days) > 0 || g.From != "" || g.To != "" {
+			grant.Schedule = &utils.AccessSchedule{
+				Days: g.Days,
+				From: g.From,
+				To:   g.To,
+			}
+		}
+		zone.Grants = append(zone.Grants, grant)
+	}
+	return zone
+}
+
+func (d *doorQuery) toDoors() []*Door {
+	outDoors := make([]*Door, 0)
+	for _, door := range d.Doors {
+		outDoor := &Door{
+			ID:         door.ID,
+			Name:       door.Name,
+			ShouldOpen: door.ShouldOpen,
+			Zones:      make([]*Zone, 0),
+		}
+		if len(door.Hotel) > 0 {
+			outDoor.HotelID = door.Hotel[0].ID
+		}
+		for _, zone := range door.Zones {
+			outDoor.Zones = append(outDoor.Zones, zone.toZone())
+		}
+		outDoors = append(outDoors, outDoor)
+	}
+	return outDoors
+}
+
+func getDoorFromDB(id string) (*Door, error) {
+	ctx := context.Background()
+	txn := db.NewTxn()
+	defer txn.Discard(ctx)
+
+	q := `query q($id: string) {
+            doors(func: uid($id)) @filter(has(door)) {
+              uid
+              door.name
+              door.shouldOpen
+              door.hotel {
+                uid
+              }
+              ~zone.doors {
+                ` + zoneFields + `
+              }
+	        }
+          }`
+
+	resp, err := txn.QueryWithVars(ctx, q, map[string]string{"$id": id})
+	if err != nil {
+		return nil, err
+	}
+	var doors doorQuery
+	err = json.Unmarshal(resp.GetJson(), &doors)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(doors.Doors) == 0 {
+		return nil, errDoorNotFound
+	}
+
+	return doors.toDoors()[0], nil
+}
+
+func getDoor(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	id := vars["id"]
+
+	door, err := getDoorFromDB(id)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(&DoorResp{
+			Err:  err.Error(),
+			Code: utils.CodeInternal,
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(&DoorResp{
+		Door: door,
+	})
+}
+
+func getDoorsByHotel(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	id := vars["id"]
+
+	ctx := context.Background()
+	txn := db.NewTxn()
+
+	q := `query q($id: string) {
+            var (func: uid($id)) {
+              h as uid
+	        }
+            doors(func: has(door)) @cascade {
+              uid
+              door.name
+              door.shouldOpen
+              door.hotel @filter(uid(h)) {
+                uid
+              }
+	        }
+          }`
+
+	resp, err := txn.QueryWithVars(ctx, q, map[string]string{"$id": id})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(&DoorsResp{
+			Err:  err.Error(),
+			Code: utils.CodeInternal,
+		})
+		return
+	}
+	var doors doorQuery
+	err = json.Unmarshal(resp.GetJson(), &doors)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(&DoorsResp{
+			Err:  err.Error(),
+			Code: utils.CodeInternal,
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(&DoorsResp{
+		Doors: doors.toDoors(),
+	})
+}
+
+func getZonesByHotel(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	id := vars["id"]
+
+	ctx := context.Background()
+	txn := db.NewTxn()
+
+	q := `query q($id: string) {
+            hotels(func: uid($id)) @filter(has(hotel)) {
+              ~zone.hotel @filter(has(zone)) {
+                ` + zoneFields + `
+              }
+	        }
+          }`
+
+	resp, err := txn.QueryWithVars(ctx, q, map[string]string{"$id": id})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(&ZonesResp{
+			Err:  err.Error(),
+			Code: utils.CodeInternal,
+		})
+		return
+	}
+	var zones struct {
+		Hotels []struct {
+			Zones []*zoneQuery `json:"~zone.hotel"`
+		} `json:"hotels"`
+	}
+	err = json.Unmarshal(resp.GetJson(), &zones)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(&ZonesResp{
+			Err:  err.Error(),
+			Code: utils.CodeInternal,
+		})
+		return
+	}
+
+	outZones := make([]*Zone, 0)
+	for _, hotel := range zones.Hotels {
+		for _, zone := range hotel.Zones {
+			outZones = append(outZones, zone.toZone())
+		}
+	}
+
+	json.NewEncoder(w).Encode(&ZonesResp{
+		Zones: outZones,
+	})
+}
+
+func setDoorShouldOpen(id string, shouldOpen bool) error {
+	door, err := getDoorFromDB(id)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	txn := db.NewTxn()
+
+	var mutation struct {
+		ID         string `json:"uid"`
+		ShouldOpen bool   `json:"door.shouldOpen"`
+	}
+	mutation.ID = door.ID
+	mutation.ShouldOpen = shouldOpen
+
+	mutData, err := json.Marshal(&mutation)
+	if err != nil {
+		return err
+	}
+
+	_, err = txn.Mutate(ctx, &api.Mutation{
+		SetJson:   mutData,
+		CommitNow: true,
+	})
+	return err
+}
+
+func openDoor(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	err := setDoorShouldOpen(id, true)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(&OpenDoorResp{
+			Err:  err.Error(),
+			Code: utils.CodeInternal,
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(&OpenDoorResp{
+		Success: true,
+	})
+}
+
+func openDoorSuccess(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	err := setDoorShouldOpen(id, false)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(&OpenDoorResp{
+			Err:  err.Error(),
+			Code: utils.CodeInternal,
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(&OpenDoorResp{
+		Success: true,
+	})
+}
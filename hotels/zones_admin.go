@@ -0,0 +1,499 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/dgraph-io/dgo"
+	"github.com/dgraph-io/dgo/protos/api"
+	"github.com/fluidmediaproductions/central_hotel_door_server/clients"
+	"github.com/fluidmediaproductions/central_hotel_door_server/utils"
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+)
+
+type DoorInput = clients.DoorInput
+type ZoneInput = clients.ZoneInput
+type ZoneResp = clients.ZoneResp
+
+var errZoneNotFound = errors.New("zone not found")
+
+func writeDoorError(w http.ResponseWriter, status int, err error) {
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(&DoorResp{
+		Err:  err.Error(),
+		Code: utils.StatusCode(status),
+	})
+}
+
+func writeZoneError(w http.ResponseWriter, status int, err error) {
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(&ZoneResp{
+		Err:  err.Error(),
+		Code: utils.StatusCode(status),
+	})
+}
+
+// nameField trims a name that's being set, which can't be left empty.
+func nameField(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", errors.New("name can't be empty")
+	}
+	return name, nil
+}
+
+// grantNode turns a grant into a node for a mutation, checking its schedule.
+func grantNode(grant *utils.ZoneGrant) (map[string]interface{}, error) {
+	if grant == nil {
+		return nil, errors.New("grants can't be null")
+	}
+	node := map[string]interface{}{
+		"grant.bookingType":  strings.TrimSpace(grant.BookingType),
+		"grant.roomCategory": strings.TrimSpace(grant.RoomCategory),
+	}
+	if grant.Schedule != nil {
+		err := utils.CheckAccessSchedule(grant.Schedule)
+		if err != nil {
+			return nil, err
+		}
+		if len(grant.Schedule.Days) > 0 {
+			node["grant.days"] = grant.Schedule.Days
+		}
+		if grant.Schedule.From != "" {
+			node["grant.from"] = grant.Schedule.From
+		}
+		if grant.Schedule.To != "" {
+			node["grant.to"] = grant.Schedule.To
+		}
+	}
+	return node, nil
+}
+
+// zoneNode turns the fields set in a ZoneInput into the predicates of a
+// mutation. The doors still have to be checked against the zone's hotel.
+func zoneNode(id string, input *ZoneInput) (map[string]interface{}, error) {
+	node := map[string]interface{}{
+		"uid": id,
+	}
+	if input.Name != nil {
+		name, err := nameField(*input.Name)
+		if err != nil {
+			return nil, err
+		}
+		node["zone.name"] = name
+	}
+	if input.Kind != nil {
+		node["zone.kind"] = strings.TrimSpace(*input.Kind)
+	}
+	if input.DoorIDs != nil {
+		doors := make([]*utils.UIDRef, 0)
+		for _, doorId := range input.DoorIDs {
+			if !utils.IsUID(doorId) {
+				return nil, errors.Errorf("invalid door id %q", doorId)
+			}
+			doors = append(doors, &utils.UIDRef{ID: doorId})
+		}
+		node["zone.doors"] = doors
+	}
+	if input.Grants != nil {
+		grants := make([]map[string]interface{}, 0)
+		for _, grant := range input.Grants {
+			grantData, err := grantNode(grant)
+			if err != nil {
+				return nil, err
+			}
+			grants = append(grants, grantData)
+		}
+		node["zone.grants"] = grants
+	}
+	return node, nil
+}
+
+// checkDoorsInHotel checks all the doors given are the hotel's, so a zone
+// can't let guests through another hotel's doors.
+func checkDoorsInHotel(ctx context.Context, txn *dgo.Txn, hotelId string, doorIds []string) error {
+	if len(doorIds) == 0 {
+		return nil
+	}
+	q := `query q($hotel: string) {
+            var(func: uid($hotel)) {
+              h as uid
+            }
+            doors(func: uid(` + strings.Join(doorIds, ", ") + `)) @filter(has(door)) @cascade {
+              uid
+              door.hotel @filter(uid(h)) {
+                uid
+              }
+            }
+          }`
+	resp, err := txn.QueryWithVars(ctx, q, map[string]string{"$hotel": hotelId})
+	if err != nil {
+		return err
+	}
+	var doors doorQuery
+	err = json.Unmarshal(resp.GetJson(), &doors)
+	if err != nil {
+		return err
+	}
+
+	found := map[string]bool{}
+	for _, door := range doors.Doors {
+		found[door.ID] = true
+	}
+	for _, doorId := range doorIds {
+		if !found[doorId] {
+			return errors.Errorf("door %s isn't in the hotel", doorId)
+		}
+	}
+	return nil
+}
+
+// getZoneFromDB gets a zone with the doors it covers.
+func getZoneFromDB(ctx context.Context, txn *dgo.Txn, id string) (*Zone, error) {
+	q := `query q($id: string) {
+            zones(func: uid($id)) @filter(has(zone)) {
+              ` + zoneFields + `
+              zone.doors {
+                uid
+              }
+            }
+          }`
+	resp, err := txn.QueryWithVars(ctx, q, map[string]string{"$id": id})
+	if err != nil {
+		return nil, err
+	}
+	var zones struct {
+		Zones []struct {
+			zoneQuery
+			Doors []struct {
+				ID string `json:"uid"`
+			} `json:"zone.doors"`
+		} `json:"zones"`
+	}
+	err = json.Unmarshal(resp.GetJson(), &zones)
+	if err != nil {
+		return nil, err
+	}
+	if len(zones.Zones) == 0 {
+		return nil, errZoneNotFound
+	}
+
+	zone := zones.Zones[0].toZone()
+	zone.DoorIDs = make([]string, 0)
+	for _, door := range zones.Zones[0].Doors {
+		zone.DoorIDs = append(zone.DoorIDs, door.ID)
+	}
+	return zone, nil
+}
+
+func decodeZoneInput(r *http.Request) (*ZoneInput, error) {
+	defer r.Body.Close()
+	var input ZoneInput
+	err := json.NewDecoder(r.Body).Decode(&input)
+	if err != nil {
+		return nil, errors.New("bad request data")
+	}
+	return &input, nil
+}
+
+func decodeDoorInput(r *http.Request) (*DoorInput, error) {
+	defer r.Body.Close()
+	var input DoorInput
+	err := json.NewDecoder(r.Body).Decode(&input)
+	if err != nil {
+		return nil, errors.New("bad request data")
+	}
+	return &input, nil
+}
+
+// saveNode writes a mutation and its audit entry, and commits them. It gives
+// back the uid of the node, which is new if the node's uid was the blank
+// node given.
+func saveNode(ctx context.Context, txn *dgo.Txn, node map[string]interface{}, blank string, action string, userId string, detail string) (string, error) {
+	mutData, err := json.Marshal(node)
+	if err != nil {
+		return "", err
+	}
+	assigned, err := txn.Mutate(ctx, &api.Mutation{SetJson: mutData})
+	if err != nil {
+		return "", err
+	}
+	id, _ := node["uid"].(string)
+	if newId, isOk := assigned.GetUids()[blank]; isOk {
+		id = newId
+	}
+	err = writeAudit(ctx, txn, utils.NewAuditEntry(action, userId, id, detail))
+	if err != nil {
+		return "", err
+	}
+	return id, txn.Commit(ctx)
+}
+
+func createDoor(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	hotelId := vars["id"]
+
+	claims, err := getAdminClaims(r)
+	if err != nil {
+		writeAdminAuthError(w, err)
+		return
+	}
+
+	input, err := decodeDoorInput(r)
+	if err != nil {
+		writeDoorError(w, http.StatusBadRequest, err)
+		return
+	}
+	if input.Name == nil {
+		writeDoorError(w, http.StatusBadRequest, errors.New("name is needed"))
+		return
+	}
+	name, err := nameField(*input.Name)
+	if err != nil {
+		writeDoorError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	ctx := context.Background()
+	txn := db.NewTxn()
+	defer txn.Discard(ctx)
+
+	exists, err := hotelExists(ctx, txn, hotelId)
+	if err != nil {
+		writeDoorError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if !exists {
+		writeDoorError(w, http.StatusNotFound, errHotelNotFound)
+		return
+	}
+
+	node := map[string]interface{}{
+		"uid":             "_:door",
+		"door":            true,
+		"door.name":       name,
+		"door.hotel":      &utils.UIDRef{ID: hotelId},
+		"door.shouldOpen": false,
+	}
+	id, err := saveNode(ctx, txn, node, "door", "door.created", claims.User.ID, "at "+hotelId)
+	if err != nil {
+		writeDoorError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	door, err := getDoorFromDB(id)
+	if err != nil {
+		writeDoorError(w, http.StatusInternalServerError, err)
+		return
+	}
+	json.NewEncoder(w).Encode(&DoorResp{
+		Door: door,
+	})
+}
+
+func updateDoor(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	claims, err := getAdminClaims(r)
+	if err != nil {
+		writeAdminAuthError(w, err)
+		return
+	}
+
+	input, err := decodeDoorInput(r)
+	if err != nil {
+		writeDoorError(w, http.StatusBadRequest, err)
+		return
+	}
+	node := map[string]interface{}{
+		"uid": id,
+	}
+	if input.Name != nil {
+		name, err := nameField(*input.Name)
+		if err != nil {
+			writeDoorError(w, http.StatusBadRequest, err)
+			return
+		}
+		node["door.name"] = name
+	}
+
+	_, err = getDoorFromDB(id)
+	if err == errDoorNotFound {
+		writeDoorError(w, http.StatusNotFound, err)
+		return
+	} else if err != nil {
+		writeDoorError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	ctx := context.Background()
+	txn := db.NewTxn()
+	defer txn.Discard(ctx)
+
+	_, err = saveNode(ctx, txn, node, "door", "door.updated", claims.User.ID, "")
+	if err != nil {
+		writeDoorError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	door, err := getDoorFromDB(id)
+	if err != nil {
+		writeDoorError(w, http.StatusInternalServerError, err)
+		return
+	}
+	json.NewEncoder(w).Encode(&DoorResp{
+		Door: door,
+	})
+}
+
+func createZone(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	hotelId := vars["id"]
+
+	claims, err := getAdminClaims(r)
+	if err != nil {
+		writeAdminAuthError(w, err)
+		return
+	}
+
+	input, err := decodeZoneInput(r)
+	if err != nil {
+		writeZoneError(w, http.StatusBadRequest, err)
+		return
+	}
+	if input.Name == nil {
+		writeZoneError(w, http.StatusBadRequest, errors.New("name is needed"))
+		return
+	}
+	node, err := zoneNode("_:zone", input)
+	if err != nil {
+		writeZoneError(w, http.StatusBadRequest, err)
+		return
+	}
+	node["zone"] = true
+	node["zone.hotel"] = &utils.UIDRef{ID: hotelId}
+
+	ctx := context.Background()
+	txn := db.NewTxn()
+	defer txn.Discard(ctx)
+
+	exists, err := hotelExists(ctx, txn, hotelId)
+	if err != nil {
+		writeZoneError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if !exists {
+		writeZoneError(w, http.StatusNotFound, errHotelNotFound)
+		return
+	}
+	err = checkDoorsInHotel(ctx, txn, hotelId, input.DoorIDs)
+	if err != nil {
+		writeZoneError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	id, err := saveNode(ctx, txn, node, "zone", "zone.created", claims.User.ID, "at "+hotelId)
+	if err != nil {
+		writeZoneError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	zone, err := getZoneFromDB(ctx, db.NewTxn(), id)
+	if err != nil {
+		writeZoneError(w, http.StatusInternalServerError, err)
+		return
+	}
+	json.NewEncoder(w).Encode(&ZoneResp{
+		Zone: zone,
+	})
+}
+
+// updateZone edits a zone. Doors or grants that are given replace the old
+// ones, and the old grants are deleted.
+func updateZone(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	claims, err := getAdminClaims(r)
+	if err != nil {
+		writeAdminAuthError(w, err)
+		return
+	}
+
+	input, err := decodeZoneInput(r)
+	if err != nil {
+		writeZoneError(w, http.StatusBadRequest, err)
+		return
+	}
+	node, err := zoneNode(id, input)
+	if err != nil {
+		writeZoneError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	ctx := context.Background()
+	txn := db.NewTxn()
+	defer txn.Discard(ctx)
+
+	zone, err := getZoneFromDB(ctx, txn, id)
+	if err == errZoneNotFound {
+		writeZoneError(w, http.StatusNotFound, err)
+		return
+	} else if err != nil {
+		writeZoneError(w, http.StatusInternalServerError, err)
+		return
+	}
+	err = checkDoorsInHotel(ctx, txn, zone.HotelID, input.DoorIDs)
+	if err != nil {
+		writeZoneError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	deletes := make([]interface{}, 0)
+	if input.DoorIDs != nil {
+		deletes = append(deletes, map[string]interface{}{
+			"uid":        id,
+			"zone.doors": nil,
+		})
+	}
+	if input.Grants != nil {
+		deletes = append(deletes, map[string]interface{}{
+			"uid":         id,
+			"zone.grants": nil,
+		})
+		for _, grant := range zone.Grants {
+			deletes = append(deletes, &utils.UIDRef{ID: grant.ID})
+		}
+	}
+	if len(deletes) > 0 {
+		delData, err := json.Marshal(deletes)
+		if err != nil {
+			writeZoneError(w, http.StatusInternalServerError, err)
+			return
+		}
+		_, err = txn.Mutate(ctx, &api.Mutation{DeleteJson: delData})
+		if err != nil {
+			writeZoneError(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	_, err = saveNode(ctx, txn, node, "zone", "zone.updated", claims.User.ID, "")
+	if err != nil {
+		writeZoneError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	zone, err = getZoneFromDB(ctx, db.NewTxn(), id)
+	if err != nil {
+		writeZoneError(w, http.StatusInternalServerError, err)
+		return
+	}
+	json.NewEncoder(w).Encode(&ZoneResp{
+		Zone: zone,
+	})
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/fluidmediaproductions/central_hotel_door_server/utils"
+)
+
+const testHotelExistsJSON = `{"hotels": [{"uid": "0x1"}]}`
+
+const testDoorJSON = `{
+	"doors": [
+		{
+			"uid": "0x20",
+			"door.name": "Pool",
+			"door.hotel": [{"uid": "0x1"}]
+		}
+	]
+}`
+
+const testZoneJSON = `{
+	"zones": [
+		{
+			"uid": "0x30",
+			"zone.name": "Pool",
+			"zone.hotel": [{"uid": "0x1"}],
+			"zone.grants": [{"uid": "0x31", "grant.bookingType": "spa"}],
+			"zone.doors": [{"uid": "0x20"}]
+		}
+	]
+}`
+
+func TestCreateDoor(t *testing.T) {
+	fake, restore := useFakeDB(t)
+	defer restore()
+
+	admin := newTestJWT(t, &utils.User{ID: "0x9", Roles: []string{utils.RoleAdmin}})
+	guest := newTestJWT(t, &utils.User{ID: "0x3"})
+
+	resp, _ := doRequest("POST", "http://a/hotels/0x1/doors", "", `{"name": "Pool"}`)
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("Expected 403 error without a JWT, got %s", resp.Status)
+	}
+	resp, body := doRequest("POST", "http://a/hotels/0x1/doors", guest, `{"name": "Pool"}`)
+	expBody := encodeResp(t, &HotelResp{
+		Err:  errNotAdmin.Error(),
+		Code: utils.CodeForbidden,
+	})
+	if resp.StatusCode != http.StatusForbidden || string(body) != expBody {
+		t.Errorf("Expected 403 error for a guest, got %s %s", resp.Status, string(body))
+	}
+	resp, _ = doRequest("POST", "http://a/hotels/0x1/doors", admin, `{"name": " "}`)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected 400 error for an empty name, got %s", resp.Status)
+	}
+	if len(fake.mutations) != 0 {
+		t.Fatalf("Expected no mutations, got %d", len(fake.mutations))
+	}
+
+	fake.expectQuery("@filter(has(hotel)) {", `{"hotels": []}`)
+	resp, _ = doRequest("POST", "http://a/hotels/0x2/doors", admin, `{"name": "Pool"}`)
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected 404 error for a missing hotel, got %s", resp.Status)
+	}
+
+	fake.queries = nil
+	fake.uids["door"] = "0x20"
+	fake.expectQuery("@filter(has(hotel)) {", testHotelExistsJSON)
+	fake.expectQuery("doors(func: uid($id))", testDoorJSON)
+	resp, body = doRequest("POST", "http://a/hotels/0x1/doors", admin, `{"name": "Pool"}`)
+
+	expBody = encodeResp(t, &DoorResp{
+		Door: &Door{
+			ID:      "0x20",
+			Name:    "Pool",
+			HotelID: "0x1",
+			Zones:   []*Zone{},
+		},
+	})
+	if resp.StatusCode != http.StatusOK || string(body) != expBody {
+		t.Errorf("Response not what was expected, got %s %s wanted %s", resp.Status, string(body), expBody)
+	}
+	// The door and its audit entry are committed together
+	if len(fake.mutations) != 2 || fake.commits != 1 {
+		t.Fatalf("Expected two committed mutations, got %d with %d commits", len(fake.mutations), fake.commits)
+	}
+	door := mutationNodes(t, fake.mutations[0])[0]
+	hotel, _ := door["door.hotel"].(map[string]interface{})
+	if door["door.name"] != "Pool" || hotel["uid"] != "0x1" {
+		t.Errorf("Expected a door in the hotel, got %s", string(fake.mutations[0].SetJson))
+	}
+}
+
+func TestCreateZone(t *testing.T) {
+	fake, restore := useFakeDB(t)
+	defer restore()
+
+	admin := newTestJWT(t, &utils.User{ID: "0x9", Roles: []string{utils.RoleAdmin}})
+
+	for _, body := range []string{
+		`{"kind": "spa"}`,
+		`{"name": "Pool", "doorIds": ["pool"]}`,
+		`{"name": "Pool", "grants": [null]}`,
+		`{"name": "Pool", "grants": [{"schedule": {"days": [7]}}]}`,
+		`{"name": "Pool", "grants": [{"schedule": {"from": "7am"}}]}`,
+	} {
+		resp, _ := doRequest("POST", "http://a/hotels/0x1/zones", admin, body)
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("Expected 400 error for %s, got %s", body, resp.Status)
+		}
+	}
+
+	// A door in another hotel doesn't come back from the query
+	fake.expectQuery("@filter(has(hotel)) {", testHotelExistsJSON)
+	fake.expectQuery("door.hotel @filter(uid(h))", `{"doors": []}`)
+	resp, body := doRequest("POST", "http://a/hotels/0x1/zones", admin, `{"name": "Pool", "doorIds": ["0x21"]}`)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected 400 error for another hotel's door, got %s %s", resp.Status, string(body))
+	}
+	if len(fake.mutations) != 0 {
+		t.Fatalf("Expected no mutations, got %d", len(fake.mutations))
+	}
+
+	fake.queries = nil
+	fake.uids["zone"] = "0x30"
+	fake.expectQuery("@filter(has(hotel)) {", testHotelExistsJSON)
+	fake.expectQuery("door.hotel @filter(uid(h))", testDoorJSON)
+	fake.expectQuery("zones(func: uid($id))", testZoneJSON)
+	resp, body = doRequest("POST", "http://a/hotels/0x1/zones", admin, `{
+		"name": "Pool",
+		"doorIds": ["0x20"],
+		"grants": [{"bookingType": "spa", "schedule": {"days": [1, 2], "from": "07:00", "to": "22:00"}}]
+	}`)
+
+	expBody := encodeResp(t, &ZoneResp{
+		Zone: &Zone{
+			ID:      "0x30",
+			Name:    "Pool",
+			HotelID: "0x1",
+			Grants:  []*utils.ZoneGrant{{ID: "0x31", BookingType: "spa"}},
+			DoorIDs: []string{"0x20"},
+		},
+	})
+	if resp.StatusCode != http.StatusOK || string(body) != expBody {
+		t.Errorf("Response not what was expected, got %s %s wanted %s", resp.Status, string(body), expBody)
+	}
+	if len(fake.mutations) != 2 || fake.commits != 1 {
+		t.Fatalf("Expected two committed mutations, got %d with %d commits", len(fake.mutations), fake.commits)
+	}
+	zone := mutationNodes(t, fake.mutations[0])[0]
+	grants, _ := zone["zone.grants"].([]interface{})
+	if zone["zone"] != true || len(grants) != 1 {
+		t.Fatalf("Expected a zone with a grant, got %s", string(fake.mutations[0].SetJson))
+	}
+	grant := grants[0].(map[string]interface{})
+	if grant["grant.bookingType"] != "spa" || grant["grant.from"] != "07:00" || grant["grant.to"] != "22:00" {
+		t.Errorf("Expected the grant to be saved, got %v", grant)
+	}
+}
+
+func TestUpdateZone(t *testing.T) {
+	fake, restore := useFakeDB(t)
+	defer restore()
+
+	admin := newTestJWT(t, &utils.User{ID: "0x9", Roles: []string{utils.RoleAdmin}})
+
+	fake.expectQuery("zones(func: uid($id))", `{"zones": []}`)
+	resp, _ := doRequest("PUT", "http://a/zones/0x31", admin, `{"name": "Gym"}`)
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected 404 error for a missing zone, got %s", resp.Status)
+	}
+
+	// Only the name is changed, so the doors and grants are left alone
+	fake.queries = nil
+	fake.expectQuery("zones(func: uid($id))", testZoneJSON)
+	resp, body := doRequest("PUT", "http://a/zones/0x30", admin, `{"name": "Gym"}`)
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected the zone, got %s %s", resp.Status, string(body))
+	}
+	if len(fake.mutations) != 2 || len(fake.mutations[0].DeleteJson) != 0 {
+		t.Fatalf("Expected only the zone and audit entry to be set, got %d mutations", len(fake.mutations))
+	}
+
+	fake.mutations = nil
+	resp, body = doRequest("PUT", "http://a/zones/0x30", admin, `{"doorIds": [], "grants": []}`)
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected the zone, got %s %s", resp.Status, string(body))
+	}
+	if len(fake.mutations) != 3 {
+		t.Fatalf("Expected the old doors and grants to be deleted, got %d mutations", len(fake.mutations))
+	}
+	deleted := map[string]bool{}
+	for _, node := range mutationNodes(t, fake.mutations[0]) {
+		for predicate := range node {
+			deleted[node["uid"].(string)+" "+predicate] = true
+		}
+	}
+	if !deleted["0x30 zone.doors"] || !deleted["0x30 zone.grants"] || !deleted["0x31 uid"] {
+		t.Errorf("Expected the zone's doors and grants to be deleted, got %s", string(fake.mutations[0].DeleteJson))
+	}
+}
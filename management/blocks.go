@@ -0,0 +1,177 @@
+package management
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/fluidmediaproductions/central_hotel_door_server/utils"
+	"github.com/graphql-go/graphql"
+)
+
+var roomBlockType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "RoomBlock",
+	Fields: graphql.Fields{
+		"ID": &graphql.Field{
+			Type:    graphql.NewNonNull(graphql.String),
+			Resolve: sourceID,
+		},
+		"roomId": &graphql.Field{
+			Type: graphql.String,
+		},
+		"reason": &graphql.Field{
+			Type: graphql.String,
+		},
+		"createdBy": &graphql.Field{
+			Type: graphql.String,
+		},
+		"start": &graphql.Field{
+			Type:    graphql.DateTime,
+			Resolve: resolveDateTime("start"),
+		},
+		"end": &graphql.Field{
+			Type:    graphql.DateTime,
+			Resolve: resolveDateTime("end"),
+		},
+	},
+})
+
+// roomBlockResultType is a new block, and the bookings that now need another
+// room because of it.
+var roomBlockResultType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "RoomBlockResult",
+	Fields: graphql.Fields{
+		"block": &graphql.Field{
+			Type: roomBlockType,
+		},
+		"flagged": &graphql.Field{
+			Type: graphql.NewList(graphql.String),
+		},
+	},
+})
+
+var roomBlocksQuery = &graphql.Field{
+	Type: graphql.NewList(roomBlockType),
+	Args: graphql.FieldConfigArgument{
+		"roomId": &graphql.ArgumentConfig{
+			Type: graphql.NewNonNull(graphql.String),
+		},
+	},
+	Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+		roomId, isOk := params.Args["roomId"].(string)
+		if isOk {
+			user, isOk := params.Source.(*utils.User)
+			if isOk {
+				resp, err := sendAsUser("GET", RoomsServer+fmt.Sprintf("/rooms/%s/blocks", url.PathEscape(roomId)), user, nil)
+				if err != nil {
+					return nil, err
+				}
+				return resp["blocks"], nil
+			}
+		}
+		return nil, nil
+	},
+}
+
+var bookingsNeedingRoomsQuery = &graphql.Field{
+	Type: graphql.NewList(userBookingType),
+	Args: graphql.FieldConfigArgument{
+		"hotelId": &graphql.ArgumentConfig{
+			Type: graphql.NewNonNull(graphql.String),
+		},
+	},
+	Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+		hotelId, isOk := params.Args["hotelId"].(string)
+		if isOk {
+			user, isOk := params.Source.(*utils.User)
+			if isOk {
+				resp, err := sendAsUser("GET", BookingsServer+fmt.Sprintf("/bookings/needs-room/%s", url.PathEscape(hotelId)), user, nil)
+				if err != nil {
+					return nil, err
+				}
+				return resp["bookings"], nil
+			}
+		}
+		return nil, nil
+	},
+}
+
+// createRoomBlockMutation takes a room out of service. Bookings in the room
+// while it's out are flagged for staff to move with assignBookingRoom.
+var createRoomBlockMutation = &graphql.Field{
+	Type: roomBlockResultType,
+	Args: graphql.FieldConfigArgument{
+		"roomId": &graphql.ArgumentConfig{
+			Type: graphql.NewNonNull(graphql.String),
+		},
+		"start": &graphql.ArgumentConfig{
+			Type: graphql.NewNonNull(graphql.DateTime),
+		},
+		"end": &graphql.ArgumentConfig{
+			Type: graphql.NewNonNull(graphql.DateTime),
+		},
+		"reason": &graphql.ArgumentConfig{
+			Type: graphql.NewNonNull(graphql.String),
+		},
+	},
+	Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+		roomId, isOk := params.Args["roomId"].(string)
+		if isOk {
+			user, isOk := params.Source.(*utils.User)
+			if isOk {
+				data := inputFromArgs(params.Args, "start", "end", "reason")
+				return sendAsUser("POST", RoomsServer+fmt.Sprintf("/rooms/%s/blocks", url.PathEscape(roomId)), user, data)
+			}
+		}
+		return nil, nil
+	},
+}
+
+// endRoomBlockMutation puts a room back in service, or cancels a block that
+// hasn't started yet.
+var endRoomBlockMutation = &graphql.Field{
+	Type: roomBlockType,
+	Args: graphql.FieldConfigArgument{
+		"blockId": &graphql.ArgumentConfig{
+			Type: graphql.NewNonNull(graphql.String),
+		},
+	},
+	Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+		blockId, isOk := params.Args["blockId"].(string)
+		if isOk {
+			user, isOk := params.Source.(*utils.User)
+			if isOk {
+				resp, err := sendAsUser("POST", RoomsServer+fmt.Sprintf("/blocks/%s/end", url.PathEscape(blockId)), user, nil)
+				if err != nil {
+					return nil, err
+				}
+				return resp["block"], nil
+			}
+		}
+		return nil, nil
+	},
+}
+
+// maintenanceOpenRoomMutation opens a room that's out of service for the
+// maintenance staff working on it.
+var maintenanceOpenRoomMutation = &graphql.Field{
+	Type: graphql.Boolean,
+	Args: graphql.FieldConfigArgument{
+		"roomId": &graphql.ArgumentConfig{
+			Type: graphql.NewNonNull(graphql.String),
+		},
+	},
+	Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+		roomId, isOk := params.Args["roomId"].(string)
+		if isOk {
+			user, isOk := params.Source.(*utils.User)
+			if isOk {
+				resp, err := sendAsUser("POST", RoomsServer+fmt.Sprintf("/rooms/%s/maintenance-open", url.PathEscape(roomId)), user, nil)
+				if err != nil {
+					return nil, err
+				}
+				return resp["success"], nil
+			}
+		}
+		return nil, nil
+	},
+}
@@ -0,0 +1,204 @@
+package management
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/fluidmediaproductions/central_hotel_door_server/utils"
+	"github.com/graphql-go/graphql"
+)
+
+var bookingStateType = graphql.NewEnum(graphql.EnumConfig{
+	Name: "BookingState",
+	Values: graphql.EnumValueConfigMap{
+		"CONFIRMED": &graphql.EnumValueConfig{
+			Value: "confirmed",
+		},
+		"CHECKED_IN": &graphql.EnumValueConfig{
+			Value: "checked_in",
+		},
+		"CHECKED_OUT": &graphql.EnumValueConfig{
+			Value: "checked_out",
+		},
+		"CANCELLED": &graphql.EnumValueConfig{
+			Value: "cancelled",
+		},
+		"NO_SHOW": &graphql.EnumValueConfig{
+			Value: "no_show",
+		},
+	},
+})
+
+var paymentStatusType = graphql.NewEnum(graphql.EnumConfig{
+	Name: "PaymentStatus",
+	Values: graphql.EnumValueConfigMap{
+		"CAPTURED": &graphql.EnumValueConfig{
+			Value: "captured",
+		},
+		"REFUNDED": &graphql.EnumValueConfig{
+			Value: "refunded",
+		},
+		"FAILED": &graphql.EnumValueConfig{
+			Value: "failed",
+		},
+	},
+})
+
+var bookingPaymentType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "BookingPayment",
+	Fields: graphql.Fields{
+		"ID": &graphql.Field{
+			Type:    graphql.String,
+			Resolve: sourceID,
+		},
+		"provider": &graphql.Field{
+			Type: graphql.String,
+		},
+		"ref": &graphql.Field{
+			Type: graphql.String,
+		},
+		"status": &graphql.Field{
+			Type: paymentStatusType,
+		},
+		"amount": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"currency": &graphql.Field{
+			Type: graphql.String,
+		},
+		"capturedAt": &graphql.Field{
+			Type:    graphql.DateTime,
+			Resolve: resolveDateTime("capturedAt"),
+		},
+		"refundedAt": &graphql.Field{
+			Type:    graphql.DateTime,
+			Resolve: resolveDateTime("refundedAt"),
+		},
+		"failedAt": &graphql.Field{
+			Type:    graphql.DateTime,
+			Resolve: resolveDateTime("failedAt"),
+		},
+	},
+})
+
+var roomAssignmentType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "RoomAssignment",
+	Fields: graphql.Fields{
+		"ID": &graphql.Field{
+			Type:    graphql.NewNonNull(graphql.String),
+			Resolve: sourceID,
+		},
+		"roomId": &graphql.Field{
+			Type: graphql.String,
+		},
+		"assignedBy": &graphql.Field{
+			Type: graphql.String,
+		},
+		"start": &graphql.Field{
+			Type:    graphql.DateTime,
+			Resolve: resolveDateTime("start"),
+		},
+		"end": &graphql.Field{
+			Type:    graphql.DateTime,
+			Resolve: resolveDateTime("end"),
+		},
+	},
+})
+
+// bookingStatusMutation makes a mutation for the front desk moving a guest's
+// booking on to another state.
+func bookingStatusMutation(status string) *graphql.Field {
+	return &graphql.Field{
+		Type: userBookingType,
+		Args: graphql.FieldConfigArgument{
+			"bookingId": &graphql.ArgumentConfig{
+				Type: graphql.NewNonNull(graphql.String),
+			},
+		},
+		Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+			bookingId, isOk := params.Args["bookingId"].(string)
+			if isOk {
+				user, isOk := params.Source.(*utils.User)
+				if isOk {
+					data := map[string]interface{}{
+						"status": status,
+					}
+					resp, err := sendAsUser("POST", BookingsServer+fmt.Sprintf("/bookings/%s/status", url.PathEscape(bookingId)), user, data)
+					if err != nil {
+						return nil, err
+					}
+					return resp["booking"], nil
+				}
+			}
+			return nil, nil
+		},
+	}
+}
+
+var checkInBookingMutation = bookingStatusMutation("checked_in")
+var checkOutBookingMutation = bookingStatusMutation("checked_out")
+var cancelBookingMutation = bookingStatusMutation("cancelled")
+var markNoShowMutation = bookingStatusMutation("no_show")
+
+// assignBookingRoomMutation gives a booking a room, or moves the guest to
+// another one.
+var assignBookingRoomMutation = &graphql.Field{
+	Type: userBookingType,
+	Args: graphql.FieldConfigArgument{
+		"bookingId": &graphql.ArgumentConfig{
+			Type: graphql.NewNonNull(graphql.String),
+		},
+		"roomId": &graphql.ArgumentConfig{
+			Type: graphql.NewNonNull(graphql.String),
+		},
+	},
+	Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+		bookingId, isOk := params.Args["bookingId"].(string)
+		if isOk {
+			roomId, isOk := params.Args["roomId"].(string)
+			if isOk {
+				user, isOk := params.Source.(*utils.User)
+				if isOk {
+					data := map[string]interface{}{
+						"roomId": roomId,
+					}
+					resp, err := sendAsUser("POST", BookingsServer+fmt.Sprintf("/bookings/%s/room", url.PathEscape(bookingId)), user, data)
+					if err != nil {
+						return nil, err
+					}
+					return resp["booking"], nil
+				}
+			}
+		}
+		return nil, nil
+	},
+}
+
+// setBookingTypeMutation changes what type a booking is, which decides the
+// zones its guests can get in to.
+var setBookingTypeMutation = &graphql.Field{
+	Type: userBookingType,
+	Args: graphql.FieldConfigArgument{
+		"bookingId": &graphql.ArgumentConfig{
+			Type: graphql.NewNonNull(graphql.String),
+		},
+		"type": &graphql.ArgumentConfig{
+			Type: graphql.NewNonNull(graphql.String),
+		},
+	},
+	Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+		bookingId, isOk := params.Args["bookingId"].(string)
+		if isOk {
+			user, isOk := params.Source.(*utils.User)
+			if isOk {
+				data := inputFromArgs(params.Args, "type")
+				resp, err := sendAsUser("POST", BookingsServer+fmt.Sprintf("/bookings/%s/type", url.PathEscape(bookingId)), user, data)
+				if err != nil {
+					return nil, err
+				}
+				return resp["booking"], nil
+			}
+		}
+		return nil, nil
+	},
+}
@@ -0,0 +1,189 @@
+package management
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/fluidmediaproductions/central_hotel_door_server/utils"
+	"github.com/graphql-go/graphql"
+)
+
+var HotelsServer = "http://hotels"
+
+var emergencyModeEnum = graphql.NewEnum(graphql.EnumConfig{
+	Name: "EmergencyMode",
+	Values: graphql.EnumValueConfigMap{
+		"NORMAL": &graphql.EnumValueConfig{
+			Value: "normal",
+		},
+		"RELEASE": &graphql.EnumValueConfig{
+			Value: "release",
+		},
+		"LOCKDOWN": &graphql.EnumValueConfig{
+			Value: "lockdown",
+		},
+	},
+})
+
+var emergencyStateType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "EmergencyState",
+	Fields: graphql.Fields{
+		"hotelId": &graphql.Field{
+			Type: graphql.NewNonNull(graphql.String),
+		},
+		"mode": &graphql.Field{
+			Type: graphql.NewNonNull(emergencyModeEnum),
+		},
+		"since": &graphql.Field{
+			Type:    graphql.DateTime,
+			Resolve: resolveDateTime("since"),
+		},
+		"byUserId": &graphql.Field{
+			Type: graphql.String,
+		},
+		"acked": &graphql.Field{
+			Type: graphql.NewNonNull(graphql.Boolean),
+		},
+	},
+})
+
+var emergencyRequestType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "EmergencyRequest",
+	Fields: graphql.Fields{
+		"code": &graphql.Field{
+			Type: graphql.NewNonNull(graphql.String),
+			Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+				request, isOk := params.Source.(map[string]interface{})
+				if isOk {
+					return request["confirmCode"], nil
+				}
+				return nil, nil
+			},
+		},
+		"expires": &graphql.Field{
+			Type:    graphql.NewNonNull(graphql.DateTime),
+			Resolve: resolveDateTime("expires"),
+		},
+	},
+})
+
+// sendAsUser makes a request to a backend service with a JWT for the
+// logged in user, so the service can do its own role checks.
+func sendAsUser(method string, url string, user *utils.User, data interface{}) (map[string]interface{}, error) {
+	var body io.Reader
+	if data != nil {
+		dataBytes, err := json.Marshal(data)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewBuffer(dataBytes)
+	}
+
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return nil, err
+	}
+
+	jwt, err := utils.NewJWT(user, jwtSecret)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", jwt))
+
+	resp, err := utils.GetJson(req)
+	if err != nil {
+		return nil, err
+	}
+	respErr, isOk := resp["err"].(string)
+	if isOk {
+		if respErr != "" {
+			return nil, errors.New(respErr)
+		}
+	}
+	return resp, nil
+}
+
+var hotelEmergencyQuery = &graphql.Field{
+	Type: emergencyStateType,
+	Args: graphql.FieldConfigArgument{
+		"hotelId": &graphql.ArgumentConfig{
+			Type: graphql.NewNonNull(graphql.String),
+		},
+	},
+	Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+		hotelId, isOk := params.Args["hotelId"].(string)
+		if isOk {
+			user, isOk := params.Source.(*utils.User)
+			if isOk {
+				resp, err := sendAsUser("GET", HotelsServer+fmt.Sprintf("/hotels/%s/emergency", hotelId), user, nil)
+				if err != nil {
+					return nil, err
+				}
+				return resp["state"], nil
+			}
+		}
+		return nil, nil
+	},
+}
+
+var requestEmergencyMutation = &graphql.Field{
+	Type: emergencyRequestType,
+	Args: graphql.FieldConfigArgument{
+		"hotelId": &graphql.ArgumentConfig{
+			Type: graphql.NewNonNull(graphql.String),
+		},
+		"mode": &graphql.ArgumentConfig{
+			Type: graphql.NewNonNull(emergencyModeEnum),
+		},
+	},
+	Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+		hotelId, isOk := params.Args["hotelId"].(string)
+		if isOk {
+			user, isOk := params.Source.(*utils.User)
+			if isOk {
+				data := map[string]interface{}{
+					"mode": params.Args["mode"],
+				}
+				return sendAsUser("POST", HotelsServer+fmt.Sprintf("/hotels/%s/emergency", hotelId), user, data)
+			}
+		}
+		return nil, nil
+	},
+}
+
+var confirmEmergencyMutation = &graphql.Field{
+	Type: emergencyStateType,
+	Args: graphql.FieldConfigArgument{
+		"hotelId": &graphql.ArgumentConfig{
+			Type: graphql.NewNonNull(graphql.String),
+		},
+		"mode": &graphql.ArgumentConfig{
+			Type: graphql.NewNonNull(emergencyModeEnum),
+		},
+		"code": &graphql.ArgumentConfig{
+			Type: graphql.NewNonNull(graphql.String),
+		},
+	},
+	Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+		hotelId, isOk := params.Args["hotelId"].(string)
+		if isOk {
+			user, isOk := params.Source.(*utils.User)
+			if isOk {
+				data := map[string]interface{}{
+					"mode": params.Args["mode"],
+					"code": params.Args["code"],
+				}
+				resp, err := sendAsUser("POST", HotelsServer+fmt.Sprintf("/hotels/%s/emergency/confirm", hotelId), user, data)
+				if err != nil {
+					return nil, err
+				}
+				return resp["state"], nil
+			}
+		}
+		return nil, nil
+	},
+}
@@ -0,0 +1,249 @@
+package management
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/fluidmediaproductions/central_hotel_door_server/utils"
+	"github.com/graphql-go/graphql"
+)
+
+var folioLineType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "FolioLine",
+	Fields: graphql.Fields{
+		"ID": &graphql.Field{
+			Type:    graphql.String,
+			Resolve: sourceID,
+		},
+		"kind": &graphql.Field{
+			Type: graphql.String,
+		},
+		"date": &graphql.Field{
+			Type: graphql.String,
+		},
+		"description": &graphql.Field{
+			Type: graphql.String,
+		},
+		"quantity": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"unitAmount": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"amount": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"method": &graphql.Field{
+			Type: graphql.String,
+		},
+		"reference": &graphql.Field{
+			Type: graphql.String,
+		},
+		"postedAt": &graphql.Field{
+			Type:    graphql.DateTime,
+			Resolve: resolveDateTime("postedAt"),
+		},
+		"postedBy": &graphql.Field{
+			Type: graphql.String,
+		},
+	},
+})
+
+var folioType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Folio",
+	Fields: graphql.Fields{
+		"bookingId": &graphql.Field{
+			Type: graphql.String,
+		},
+		"hotelId": &graphql.Field{
+			Type: graphql.String,
+		},
+		"guestName": &graphql.Field{
+			Type: graphql.String,
+		},
+		"guestEmail": &graphql.Field{
+			Type: graphql.String,
+		},
+		"currency": &graphql.Field{
+			Type: graphql.String,
+		},
+		"charges": &graphql.Field{
+			Type: graphql.NewList(folioLineType),
+		},
+		"taxes": &graphql.Field{
+			Type: graphql.NewList(quoteTaxType),
+		},
+		"payments": &graphql.Field{
+			Type: graphql.NewList(folioLineType),
+		},
+		"chargeTotal": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"taxTotal": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"total": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"paid": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"balance": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"issuedAt": &graphql.Field{
+			Type:    graphql.DateTime,
+			Resolve: resolveDateTime("issuedAt"),
+		},
+	},
+})
+
+var invoiceFormatType = graphql.NewEnum(graphql.EnumConfig{
+	Name: "InvoiceFormat",
+	Values: graphql.EnumValueConfigMap{
+		"PDF": &graphql.EnumValueConfig{
+			Value: "pdf",
+		},
+		"HTML": &graphql.EnumValueConfig{
+			Value: "html",
+		},
+	},
+})
+
+// invoiceType is a folio as a document to download. The data is base64
+// encoded.
+var invoiceType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Invoice",
+	Fields: graphql.Fields{
+		"format": &graphql.Field{
+			Type: invoiceFormatType,
+		},
+		"contentType": &graphql.Field{
+			Type: graphql.String,
+		},
+		"fileName": &graphql.Field{
+			Type: graphql.String,
+		},
+		"data": &graphql.Field{
+			Type: graphql.String,
+		},
+	},
+})
+
+var bookingFolioQuery = &graphql.Field{
+	Type: folioType,
+	Args: graphql.FieldConfigArgument{
+		"bookingId": &graphql.ArgumentConfig{
+			Type: graphql.NewNonNull(graphql.String),
+		},
+	},
+	Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+		bookingId, isOk := params.Args["bookingId"].(string)
+		if isOk {
+			user, isOk := params.Source.(*utils.User)
+			if isOk {
+				resp, err := sendAsUser("GET", BookingsServer+fmt.Sprintf("/bookings/%s/folio", url.PathEscape(bookingId)), user, nil)
+				if err != nil {
+					return nil, err
+				}
+				return resp["folio"], nil
+			}
+		}
+		return nil, nil
+	},
+}
+
+var bookingInvoiceQuery = &graphql.Field{
+	Type: invoiceType,
+	Args: graphql.FieldConfigArgument{
+		"bookingId": &graphql.ArgumentConfig{
+			Type: graphql.NewNonNull(graphql.String),
+		},
+		"format": &graphql.ArgumentConfig{
+			Type:         invoiceFormatType,
+			DefaultValue: "pdf",
+		},
+	},
+	Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+		bookingId, isOk := params.Args["bookingId"].(string)
+		if isOk {
+			user, isOk := params.Source.(*utils.User)
+			if isOk {
+				format, _ := params.Args["format"].(string)
+				path := fmt.Sprintf("/bookings/%s/invoice?format=%s", url.PathEscape(bookingId), url.QueryEscape(format))
+				resp, err := sendAsUser("GET", BookingsServer+path, user, nil)
+				if err != nil {
+					return nil, err
+				}
+				return resp["invoice"], nil
+			}
+		}
+		return nil, nil
+	},
+}
+
+var postFolioExtraMutation = &graphql.Field{
+	Type: folioType,
+	Args: graphql.FieldConfigArgument{
+		"bookingId": &graphql.ArgumentConfig{
+			Type: graphql.NewNonNull(graphql.String),
+		},
+		"description": &graphql.ArgumentConfig{
+			Type: graphql.NewNonNull(graphql.String),
+		},
+		"quantity": &graphql.ArgumentConfig{
+			Type: graphql.Int,
+		},
+		"unitAmount": &graphql.ArgumentConfig{
+			Type: graphql.NewNonNull(graphql.Int),
+		},
+	},
+	Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+		bookingId, isOk := params.Args["bookingId"].(string)
+		if isOk {
+			user, isOk := params.Source.(*utils.User)
+			if isOk {
+				data := inputFromArgs(params.Args, "description", "quantity", "unitAmount")
+				resp, err := sendAsUser("POST", BookingsServer+fmt.Sprintf("/bookings/%s/folio/extras", url.PathEscape(bookingId)), user, data)
+				if err != nil {
+					return nil, err
+				}
+				return resp["folio"], nil
+			}
+		}
+		return nil, nil
+	},
+}
+
+var recordFolioPaymentMutation = &graphql.Field{
+	Type: folioType,
+	Args: graphql.FieldConfigArgument{
+		"bookingId": &graphql.ArgumentConfig{
+			Type: graphql.NewNonNull(graphql.String),
+		},
+		"amount": &graphql.ArgumentConfig{
+			Type: graphql.NewNonNull(graphql.Int),
+		},
+		"method": &graphql.ArgumentConfig{
+			Type: graphql.NewNonNull(graphql.String),
+		},
+		"reference": &graphql.ArgumentConfig{
+			Type: graphql.String,
+		},
+	},
+	Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+		bookingId, isOk := params.Args["bookingId"].(string)
+		if isOk {
+			user, isOk := params.Source.(*utils.User)
+			if isOk {
+				data := inputFromArgs(params.Args, "amount", "method", "reference")
+				resp, err := sendAsUser("POST", BookingsServer+fmt.Sprintf("/bookings/%s/folio/payments", url.PathEscape(bookingId)), user, data)
+				if err != nil {
+					return nil, err
+				}
+				return resp["folio"], nil
+			}
+		}
+		return nil, nil
+	},
+}
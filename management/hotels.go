@@ -0,0 +1,587 @@
+package management
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+
+	"github.com/fluidmediaproductions/central_hotel_door_server/utils"
+	"github.com/graphql-go/graphql"
+)
+
+var RoomsServer = "http://rooms"
+
+var locationType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Location",
+	Fields: graphql.Fields{
+		"lat": &graphql.Field{
+			Type: graphql.NewNonNull(graphql.Float),
+		},
+		"lng": &graphql.Field{
+			Type: graphql.NewNonNull(graphql.Float),
+		},
+	},
+})
+
+var hotelType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Hotel",
+	Fields: graphql.Fields{
+		"ID": &graphql.Field{
+			Type: graphql.NewNonNull(graphql.String),
+			Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+				hotel, isOk := params.Source.(map[string]interface{})
+				if isOk {
+					return hotel["uid"], nil
+				}
+				return nil, nil
+			},
+		},
+		"name": &graphql.Field{
+			Type: graphql.String,
+		},
+		"address": &graphql.Field{
+			Type: graphql.String,
+		},
+		"checkIn": &graphql.Field{
+			Type:    graphql.DateTime,
+			Resolve: resolveDateTime("checkIn"),
+		},
+		"timeZone": &graphql.Field{
+			Type: graphql.String,
+		},
+		"hasCarPark": &graphql.Field{
+			Type: graphql.Boolean,
+		},
+		"archivedAt": &graphql.Field{
+			Type:    graphql.DateTime,
+			Resolve: resolveDateTime("archivedAt"),
+		},
+		"location": &graphql.Field{
+			Type: locationType,
+			Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+				hotel, isOk := params.Source.(map[string]interface{})
+				if !isOk {
+					return nil, nil
+				}
+				location, isOk := hotel["location"].(map[string]interface{})
+				if !isOk {
+					return nil, nil
+				}
+				// GeoJSON puts the longitude first
+				coords, isOk := location["coordinates"].([]interface{})
+				if !isOk || len(coords) != 2 {
+					return nil, nil
+				}
+				return map[string]interface{}{
+					"lat": coords[1],
+					"lng": coords[0],
+				}, nil
+			},
+		},
+	},
+})
+
+var setHotelLocationMutation = &graphql.Field{
+	Type: hotelType,
+	Args: graphql.FieldConfigArgument{
+		"hotelId": &graphql.ArgumentConfig{
+			Type: graphql.NewNonNull(graphql.String),
+		},
+		"lat": &graphql.ArgumentConfig{
+			Type: graphql.NewNonNull(graphql.Float),
+		},
+		"lng": &graphql.ArgumentConfig{
+			Type: graphql.NewNonNull(graphql.Float),
+		},
+	},
+	Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+		hotelId, isOk := params.Args["hotelId"].(string)
+		if isOk {
+			user, isOk := params.Source.(*utils.User)
+			if isOk {
+				data := map[string]interface{}{
+					"lat": params.Args["lat"],
+					"lng": params.Args["lng"],
+				}
+				resp, err := sendAsUser("PUT", HotelsServer+fmt.Sprintf("/hotels/%s/location", hotelId), user, data)
+				if err != nil {
+					return nil, err
+				}
+				return resp["hotel"], nil
+			}
+		}
+		return nil, nil
+	},
+}
+
+var roomTypeType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "RoomType",
+	Fields: graphql.Fields{
+		"ID": &graphql.Field{
+			Type:    graphql.NewNonNull(graphql.String),
+			Resolve: sourceID,
+		},
+		"hotelId": &graphql.Field{
+			Type: graphql.String,
+		},
+		"name": &graphql.Field{
+			Type: graphql.String,
+		},
+		"capacity": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"beds": &graphql.Field{
+			Type: graphql.String,
+		},
+		"amenities": &graphql.Field{
+			Type: graphql.NewList(graphql.String),
+		},
+		"accessibility": &graphql.Field{
+			Type: graphql.NewList(graphql.String),
+		},
+	},
+})
+
+var roomType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Room",
+	Fields: graphql.Fields{
+		"ID": &graphql.Field{
+			Type: graphql.NewNonNull(graphql.String),
+			Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+				room, isOk := params.Source.(map[string]interface{})
+				if isOk {
+					return room["uid"], nil
+				}
+				return nil, nil
+			},
+		},
+		"name": &graphql.Field{
+			Type: graphql.String,
+		},
+		"floor": &graphql.Field{
+			Type: graphql.String,
+		},
+		"category": &graphql.Field{
+			Type: graphql.String,
+		},
+		"type": &graphql.Field{
+			Type: roomTypeType,
+		},
+		"blocks": &graphql.Field{
+			Type: graphql.NewList(roomBlockType),
+		},
+		"housekeeping": &graphql.Field{
+			Type: housekeepingStatusType,
+		},
+		"housekeepingAt": &graphql.Field{
+			Type:    graphql.DateTime,
+			Resolve: resolveDateTime("housekeepingAt"),
+		},
+		"hotelId": &graphql.Field{
+			Type: graphql.String,
+		},
+		"archivedAt": &graphql.Field{
+			Type:    graphql.DateTime,
+			Resolve: resolveDateTime("archivedAt"),
+		},
+	},
+})
+
+// inputFromArgs copies the arguments that were given into the body of a
+// request to a service, so fields left out of an edit aren't changed.
+func inputFromArgs(args map[string]interface{}, names ...string) map[string]interface{} {
+	data := map[string]interface{}{}
+	for _, name := range names {
+		value, isOk := args[name]
+		if isOk && value != nil {
+			data[name] = value
+		}
+	}
+	return data
+}
+
+func hotelInputFromArgs(args map[string]interface{}) (map[string]interface{}, error) {
+	data := inputFromArgs(args, "name", "address", "checkIn", "timeZone", "hasCarPark")
+	lat, hasLat := args["lat"]
+	lng, hasLng := args["lng"]
+	if hasLat != hasLng {
+		return nil, errors.New("lat and lng have to be set together")
+	}
+	if hasLat {
+		data["location"] = map[string]interface{}{
+			"lat": lat,
+			"lng": lng,
+		}
+	}
+	return data, nil
+}
+
+var hotelsQuery = &graphql.Field{
+	Type: graphql.NewList(hotelType),
+	Args: graphql.FieldConfigArgument{
+		"includeArchived": &graphql.ArgumentConfig{
+			Type: graphql.Boolean,
+		},
+	},
+	Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+		user, isOk := params.Source.(*utils.User)
+		if isOk {
+			path := "/hotels"
+			if includeArchived, _ := params.Args["includeArchived"].(bool); includeArchived {
+				path += "?archived=include"
+			}
+			resp, err := sendAsUser("GET", HotelsServer+path, user, nil)
+			if err != nil {
+				return nil, err
+			}
+			return resp["hotels"], nil
+		}
+		return nil, nil
+	},
+}
+
+var roomsQuery = &graphql.Field{
+	Type: graphql.NewList(roomType),
+	Args: graphql.FieldConfigArgument{
+		"hotelId": &graphql.ArgumentConfig{
+			Type: graphql.NewNonNull(graphql.String),
+		},
+		"includeArchived": &graphql.ArgumentConfig{
+			Type: graphql.Boolean,
+		},
+		"housekeeping": &graphql.ArgumentConfig{
+			Type: housekeepingStatusType,
+		},
+	},
+	Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+		hotelId, isOk := params.Args["hotelId"].(string)
+		if isOk {
+			user, isOk := params.Source.(*utils.User)
+			if isOk {
+				query := url.Values{}
+				if includeArchived, _ := params.Args["includeArchived"].(bool); includeArchived {
+					query.Set("archived", "include")
+				}
+				if housekeeping, _ := params.Args["housekeeping"].(string); housekeeping != "" {
+					query.Set("housekeeping", housekeeping)
+				}
+				path := fmt.Sprintf("/rooms/by-hotel/%s", hotelId)
+				if len(query) > 0 {
+					path += "?" + query.Encode()
+				}
+				resp, err := sendAsUser("GET", RoomsServer+path, user, nil)
+				if err != nil {
+					return nil, err
+				}
+				return resp["rooms"], nil
+			}
+		}
+		return nil, nil
+	},
+}
+
+var createHotelMutation = &graphql.Field{
+	Type: hotelType,
+	Args: graphql.FieldConfigArgument{
+		"name": &graphql.ArgumentConfig{
+			Type: graphql.NewNonNull(graphql.String),
+		},
+		"address": &graphql.ArgumentConfig{
+			Type: graphql.NewNonNull(graphql.String),
+		},
+		"lat": &graphql.ArgumentConfig{
+			Type: graphql.NewNonNull(graphql.Float),
+		},
+		"lng": &graphql.ArgumentConfig{
+			Type: graphql.NewNonNull(graphql.Float),
+		},
+		"checkIn": &graphql.ArgumentConfig{
+			Type: graphql.NewNonNull(graphql.DateTime),
+		},
+		"timeZone": &graphql.ArgumentConfig{
+			Type: graphql.NewNonNull(graphql.String),
+		},
+		"hasCarPark": &graphql.ArgumentConfig{
+			Type: graphql.Boolean,
+		},
+	},
+	Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+		user, isOk := params.Source.(*utils.User)
+		if isOk {
+			data, err := hotelInputFromArgs(params.Args)
+			if err != nil {
+				return nil, err
+			}
+			resp, err := sendAsUser("POST", HotelsServer+"/hotels", user, data)
+			if err != nil {
+				return nil, err
+			}
+			return resp["hotel"], nil
+		}
+		return nil, nil
+	},
+}
+
+var updateHotelMutation = &graphql.Field{
+	Type: hotelType,
+	Args: graphql.FieldConfigArgument{
+		"hotelId": &graphql.ArgumentConfig{
+			Type: graphql.NewNonNull(graphql.String),
+		},
+		"name": &graphql.ArgumentConfig{
+			Type: graphql.String,
+		},
+		"address": &graphql.ArgumentConfig{
+			Type: graphql.String,
+		},
+		"lat": &graphql.ArgumentConfig{
+			Type: graphql.Float,
+		},
+		"lng": &graphql.ArgumentConfig{
+			Type: graphql.Float,
+		},
+		"checkIn": &graphql.ArgumentConfig{
+			Type: graphql.DateTime,
+		},
+		"timeZone": &graphql.ArgumentConfig{
+			Type: graphql.String,
+		},
+		"hasCarPark": &graphql.ArgumentConfig{
+			Type: graphql.Boolean,
+		},
+	},
+	Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+		hotelId, isOk := params.Args["hotelId"].(string)
+		if isOk {
+			user, isOk := params.Source.(*utils.User)
+			if isOk {
+				data, err := hotelInputFromArgs(params.Args)
+				if err != nil {
+					return nil, err
+				}
+				resp, err := sendAsUser("PUT", HotelsServer+fmt.Sprintf("/hotels/%s", hotelId), user, data)
+				if err != nil {
+					return nil, err
+				}
+				return resp["hotel"], nil
+			}
+		}
+		return nil, nil
+	},
+}
+
+var archiveHotelMutation = &graphql.Field{
+	Type: hotelType,
+	Args: graphql.FieldConfigArgument{
+		"hotelId": &graphql.ArgumentConfig{
+			Type: graphql.NewNonNull(graphql.String),
+		},
+	},
+	Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+		hotelId, isOk := params.Args["hotelId"].(string)
+		if isOk {
+			user, isOk := params.Source.(*utils.User)
+			if isOk {
+				resp, err := sendAsUser("POST", HotelsServer+fmt.Sprintf("/hotels/%s/archive", hotelId), user, nil)
+				if err != nil {
+					return nil, err
+				}
+				return resp["hotel"], nil
+			}
+		}
+		return nil, nil
+	},
+}
+
+var createRoomMutation = &graphql.Field{
+	Type: roomType,
+	Args: graphql.FieldConfigArgument{
+		"hotelId": &graphql.ArgumentConfig{
+			Type: graphql.NewNonNull(graphql.String),
+		},
+		"name": &graphql.ArgumentConfig{
+			Type: graphql.NewNonNull(graphql.String),
+		},
+		"floor": &graphql.ArgumentConfig{
+			Type: graphql.String,
+		},
+		"category": &graphql.ArgumentConfig{
+			Type: graphql.String,
+		},
+		"typeId": &graphql.ArgumentConfig{
+			Type: graphql.String,
+		},
+	},
+	Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+		user, isOk := params.Source.(*utils.User)
+		if isOk {
+			data := inputFromArgs(params.Args, "hotelId", "name", "floor", "category", "typeId")
+			resp, err := sendAsUser("POST", RoomsServer+"/rooms", user, data)
+			if err != nil {
+				return nil, err
+			}
+			return resp["room"], nil
+		}
+		return nil, nil
+	},
+}
+
+var updateRoomMutation = &graphql.Field{
+	Type: roomType,
+	Args: graphql.FieldConfigArgument{
+		"roomId": &graphql.ArgumentConfig{
+			Type: graphql.NewNonNull(graphql.String),
+		},
+		"hotelId": &graphql.ArgumentConfig{
+			Type: graphql.String,
+		},
+		"name": &graphql.ArgumentConfig{
+			Type: graphql.String,
+		},
+		"floor": &graphql.ArgumentConfig{
+			Type: graphql.String,
+		},
+		"category": &graphql.ArgumentConfig{
+			Type: graphql.String,
+		},
+		"typeId": &graphql.ArgumentConfig{
+			Type: graphql.String,
+		},
+	},
+	Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+		roomId, isOk := params.Args["roomId"].(string)
+		if isOk {
+			user, isOk := params.Source.(*utils.User)
+			if isOk {
+				data := inputFromArgs(params.Args, "hotelId", "name", "floor", "category", "typeId")
+				resp, err := sendAsUser("PUT", RoomsServer+fmt.Sprintf("/rooms/%s", roomId), user, data)
+				if err != nil {
+					return nil, err
+				}
+				return resp["room"], nil
+			}
+		}
+		return nil, nil
+	},
+}
+
+var archiveRoomMutation = &graphql.Field{
+	Type: roomType,
+	Args: graphql.FieldConfigArgument{
+		"roomId": &graphql.ArgumentConfig{
+			Type: graphql.NewNonNull(graphql.String),
+		},
+	},
+	Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+		roomId, isOk := params.Args["roomId"].(string)
+		if isOk {
+			user, isOk := params.Source.(*utils.User)
+			if isOk {
+				resp, err := sendAsUser("POST", RoomsServer+fmt.Sprintf("/rooms/%s/archive", roomId), user, nil)
+				if err != nil {
+					return nil, err
+				}
+				return resp["room"], nil
+			}
+		}
+		return nil, nil
+	},
+}
+
+var roomTypesQuery = &graphql.Field{
+	Type: graphql.NewList(roomTypeType),
+	Args: graphql.FieldConfigArgument{
+		"hotelId": &graphql.ArgumentConfig{
+			Type: graphql.NewNonNull(graphql.String),
+		},
+	},
+	Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+		hotelId, isOk := params.Args["hotelId"].(string)
+		if isOk {
+			user, isOk := params.Source.(*utils.User)
+			if isOk {
+				resp, err := sendAsUser("GET", RoomsServer+fmt.Sprintf("/room-types/by-hotel/%s", hotelId), user, nil)
+				if err != nil {
+					return nil, err
+				}
+				return resp["roomTypes"], nil
+			}
+		}
+		return nil, nil
+	},
+}
+
+var roomTypeArgs = graphql.FieldConfigArgument{
+	"name": &graphql.ArgumentConfig{
+		Type: graphql.String,
+	},
+	"capacity": &graphql.ArgumentConfig{
+		Type: graphql.Int,
+	},
+	"beds": &graphql.ArgumentConfig{
+		Type: graphql.String,
+	},
+	"amenities": &graphql.ArgumentConfig{
+		Type: graphql.NewList(graphql.String),
+	},
+	"accessibility": &graphql.ArgumentConfig{
+		Type: graphql.NewList(graphql.String),
+	},
+}
+
+// withArgs adds arguments to a shared set for one field.
+func withArgs(args graphql.FieldConfigArgument, extra graphql.FieldConfigArgument) graphql.FieldConfigArgument {
+	all := graphql.FieldConfigArgument{}
+	for name, arg := range args {
+		all[name] = arg
+	}
+	for name, arg := range extra {
+		all[name] = arg
+	}
+	return all
+}
+
+var createRoomTypeMutation = &graphql.Field{
+	Type: roomTypeType,
+	Args: withArgs(roomTypeArgs, graphql.FieldConfigArgument{
+		"hotelId": &graphql.ArgumentConfig{
+			Type: graphql.NewNonNull(graphql.String),
+		},
+	}),
+	Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+		user, isOk := params.Source.(*utils.User)
+		if isOk {
+			data := inputFromArgs(params.Args, "hotelId", "name", "capacity", "beds", "amenities", "accessibility")
+			resp, err := sendAsUser("POST", RoomsServer+"/room-types", user, data)
+			if err != nil {
+				return nil, err
+			}
+			return resp["roomType"], nil
+		}
+		return nil, nil
+	},
+}
+
+var updateRoomTypeMutation = &graphql.Field{
+	Type: roomTypeType,
+	Args: withArgs(roomTypeArgs, graphql.FieldConfigArgument{
+		"roomTypeId": &graphql.ArgumentConfig{
+			Type: graphql.NewNonNull(graphql.String),
+		},
+	}),
+	Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+		roomTypeId, isOk := params.Args["roomTypeId"].(string)
+		if isOk {
+			user, isOk := params.Source.(*utils.User)
+			if isOk {
+				data := inputFromArgs(params.Args, "name", "capacity", "beds", "amenities", "accessibility")
+				resp, err := sendAsUser("PUT", RoomsServer+fmt.Sprintf("/room-types/%s", roomTypeId), user, data)
+				if err != nil {
+					return nil, err
+				}
+				return resp["roomType"], nil
+			}
+		}
+		return nil, nil
+	},
+}
@@ -0,0 +1,131 @@
+package management
+
+import (
+	"github.com/fluidmediaproductions/central_hotel_door_server/utils"
+	"github.com/graphql-go/graphql"
+)
+
+var ImportServer = "http://bulk-import"
+
+var importKindType = graphql.NewEnum(graphql.EnumConfig{
+	Name: "ImportKind",
+	Values: graphql.EnumValueConfigMap{
+		"HOTELS": &graphql.EnumValueConfig{
+			Value: "hotels",
+		},
+		"ROOMS": &graphql.EnumValueConfig{
+			Value: "rooms",
+		},
+		"BOOKINGS": &graphql.EnumValueConfig{
+			Value: "bookings",
+		},
+	},
+})
+
+var importFormatType = graphql.NewEnum(graphql.EnumConfig{
+	Name: "ImportFormat",
+	Values: graphql.EnumValueConfigMap{
+		"CSV": &graphql.EnumValueConfig{
+			Value: "csv",
+		},
+		"JSON": &graphql.EnumValueConfig{
+			Value: "json",
+		},
+	},
+})
+
+var importFileInputType = graphql.NewInputObject(graphql.InputObjectConfig{
+	Name: "ImportFileInput",
+	Fields: graphql.InputObjectConfigFieldMap{
+		"kind": &graphql.InputObjectFieldConfig{
+			Type: graphql.NewNonNull(importKindType),
+		},
+		"format": &graphql.InputObjectFieldConfig{
+			Type: graphql.NewNonNull(importFormatType),
+		},
+		"data": &graphql.InputObjectFieldConfig{
+			Type: graphql.NewNonNull(graphql.String),
+		},
+	},
+})
+
+var importCountsType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "ImportCounts",
+	Fields: graphql.Fields{
+		"created": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"updated": &graphql.Field{
+			Type: graphql.Int,
+		},
+	},
+})
+
+var importErrorType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "ImportError",
+	Fields: graphql.Fields{
+		"kind": &graphql.Field{
+			Type: graphql.String,
+		},
+		"row": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"ref": &graphql.Field{
+			Type: graphql.String,
+		},
+		"message": &graphql.Field{
+			Type: graphql.String,
+		},
+	},
+})
+
+var importReportType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "ImportReport",
+	Fields: graphql.Fields{
+		"dryRun": &graphql.Field{
+			Type: graphql.Boolean,
+		},
+		"hotels": &graphql.Field{
+			Type: importCountsType,
+		},
+		"rooms": &graphql.Field{
+			Type: importCountsType,
+		},
+		"bookings": &graphql.Field{
+			Type: importCountsType,
+		},
+		"errors": &graphql.Field{
+			Type: graphql.NewList(importErrorType),
+		},
+	},
+})
+
+// importDataMutation loads hotels, rooms and bookings in bulk. Nothing is
+// written if any row has a problem, the report lists them instead.
+var importDataMutation = &graphql.Field{
+	Type: importReportType,
+	Args: graphql.FieldConfigArgument{
+		"files": &graphql.ArgumentConfig{
+			Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(importFileInputType))),
+		},
+		"dryRun": &graphql.ArgumentConfig{
+			Type:         graphql.Boolean,
+			DefaultValue: false,
+		},
+	},
+	Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+		user, isOk := params.Source.(*utils.User)
+		if isOk {
+			data := map[string]interface{}{
+				"files":  params.Args["files"],
+				"dryRun": params.Args["dryRun"],
+			}
+			resp, err := sendAsUser("POST", ImportServer+"/import", user, data)
+			if err != nil {
+				return nil, err
+			}
+			return resp["report"], nil
+		}
+		return nil, nil
+	},
+}
@@ -0,0 +1,132 @@
+package management
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+
+	"github.com/fluidmediaproductions/central_hotel_door_server/utils"
+	"github.com/graphql-go/graphql"
+)
+
+var HotelGatewayServer = "http://hotel-gateway"
+
+var lockHealthType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "LockHealth",
+	Fields: graphql.Fields{
+		"doorId": &graphql.Field{
+			Type: graphql.NewNonNull(graphql.String),
+		},
+		"batteryLevel": &graphql.Field{
+			Type: graphql.NewNonNull(graphql.Int),
+		},
+		"lowBattery": &graphql.Field{
+			Type: graphql.NewNonNull(graphql.Boolean),
+		},
+		"doorOpen": &graphql.Field{
+			Type: graphql.NewNonNull(graphql.Boolean),
+		},
+		"lastSeen": &graphql.Field{
+			Type:    graphql.NewNonNull(graphql.DateTime),
+			Resolve: resolveDateTime("lastSeen"),
+		},
+	},
+})
+
+var lockAlarmType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "LockAlarm",
+	Fields: graphql.Fields{
+		"ID": &graphql.Field{
+			Type: graphql.NewNonNull(graphql.String),
+			Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+				alarm, isOk := params.Source.(map[string]interface{})
+				if isOk {
+					return alarm["uid"], nil
+				}
+				return nil, nil
+			},
+		},
+		"doorId": &graphql.Field{
+			Type: graphql.NewNonNull(graphql.String),
+		},
+		"type": &graphql.Field{
+			Type: graphql.NewNonNull(graphql.String),
+		},
+		"time": &graphql.Field{
+			Type:    graphql.NewNonNull(graphql.DateTime),
+			Resolve: resolveDateTime("time"),
+		},
+		"detail": &graphql.Field{
+			Type: graphql.String,
+		},
+	},
+})
+
+var errNotSecurity = errors.New("lock telemetry needs the admin or security role")
+
+// getFromHotelGateway fetches a hotel's lock telemetry for a user with the
+// admin or security role.
+func getFromHotelGateway(path string, user *utils.User, key string) ([]interface{}, error) {
+	if !user.HasRole(utils.RoleAdmin, utils.RoleSecurity) {
+		return nil, errNotSecurity
+	}
+
+	resp, err := sendAsUser("GET", HotelGatewayServer+path, user, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	items, isOk := resp[key].([]interface{})
+	if isOk {
+		return items, nil
+	}
+	return nil, nil
+}
+
+var lockHealthQuery = &graphql.Field{
+	Type: graphql.NewList(lockHealthType),
+	Args: graphql.FieldConfigArgument{
+		"hotelId": &graphql.ArgumentConfig{
+			Type: graphql.NewNonNull(graphql.String),
+		},
+	},
+	Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+		hotelId, isOk := params.Args["hotelId"].(string)
+		if isOk {
+			user, isOk := params.Source.(*utils.User)
+			if isOk {
+				return getFromHotelGateway(fmt.Sprintf("/hotels/%s/locks", url.PathEscape(hotelId)), user, "locks")
+			}
+		}
+		return nil, nil
+	},
+}
+
+var lockAlarmsQuery = &graphql.Field{
+	Type: graphql.NewList(lockAlarmType),
+	Args: graphql.FieldConfigArgument{
+		"hotelId": &graphql.ArgumentConfig{
+			Type: graphql.NewNonNull(graphql.String),
+		},
+		"first": &graphql.ArgumentConfig{
+			Type: graphql.Int,
+		},
+		"offset": &graphql.ArgumentConfig{
+			Type: graphql.Int,
+		},
+	},
+	Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+		hotelId, isOk := params.Args["hotelId"].(string)
+		if isOk {
+			user, isOk := params.Source.(*utils.User)
+			if isOk {
+				alarms, err := getFromHotelGateway(fmt.Sprintf("/hotels/%s/alarms", url.PathEscape(hotelId)), user, "alarms")
+				if err != nil {
+					return nil, err
+				}
+				return paginateSlice(alarms, params.Args), nil
+			}
+		}
+		return nil, nil
+	},
+}
@@ -12,6 +12,7 @@ import (
 	"bytes"
 	"errors"
 	"github.com/spf13/viper"
+	"time"
 )
 
 const addr = ":80"
@@ -78,6 +79,53 @@ func takeArg(arg interface{}, kind reflect.Kind) (val reflect.Value, ok bool) {
 	return
 }
 
+// resolveDateTime resolves a field holding an RFC3339 string in a JSON map.
+func resolveDateTime(key string) graphql.FieldResolveFn {
+	return func(params graphql.ResolveParams) (interface{}, error) {
+		source, isOk := params.Source.(map[string]interface{})
+		if isOk {
+			value, isOk := source[key].(string)
+			if isOk {
+				return time.Parse(time.RFC3339, value)
+			}
+		}
+		return nil, nil
+	}
+}
+
+// getUser checks a token with the auth server, so staff whose accounts have
+// been disabled, or sessions revoked, are turned away.
+func getUser(token string) (*utils.User, error) {
+	req, err := http.NewRequest("GET", AuthServer+"/userInfo", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add("Authorization", "Bearer "+token)
+	resp, err := utils.GetJson(req)
+	if err != nil {
+		return nil, err
+	}
+	respErr, isOk := resp["err"].(string)
+	if isOk {
+		if respErr != "" {
+			return nil, errors.New(respErr)
+		}
+	}
+	userBytes, err := json.Marshal(resp["user"])
+	if err != nil {
+		return nil, err
+	}
+	var user *utils.User
+	err = json.Unmarshal(userBytes, &user)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, errors.New("invalid data from auth server")
+	}
+	return user, nil
+}
+
 func makeAuthWrapper(field *graphql.Object) *graphql.Field {
 	return &graphql.Field{
 		Type: field,
@@ -89,12 +137,7 @@ func makeAuthWrapper(field *graphql.Object) *graphql.Field {
 		Resolve: func(params graphql.ResolveParams) (interface{}, error) {
 			tokenString, isOK := params.Args["token"].(string)
 			if isOK {
-				claims, err := utils.VerifyJWT(tokenString, jwtSecret)
-				if err != nil {
-					return nil, err
-				} else {
-					return claims.User, nil
-				}
+				return getUser(tokenString)
 			}
 			return nil, nil
 		},
@@ -114,6 +157,22 @@ var authenticatedQueries = graphql.NewObject(graphql.ObjectConfig{
 				return nil, nil
 			},
 		},
+		"lockHealth": lockHealthQuery,
+		"lockAlarms": lockAlarmsQuery,
+		"hotelEmergency": hotelEmergencyQuery,
+		"hotels": hotelsQuery,
+		"rooms": roomsQuery,
+		"zones": zonesQuery,
+		"doors": doorsQuery,
+		"roomTypes": roomTypesQuery,
+		"roomTypeRates": roomTypeRatesQuery,
+		"roomBlocks": roomBlocksQuery,
+		"bookingsNeedingRooms": bookingsNeedingRoomsQuery,
+		"bookingFolio": bookingFolioQuery,
+		"bookingInvoice": bookingInvoiceQuery,
+		"shifts": shiftsQuery,
+		"users": usersQuery,
+		"user": userQuery,
 	},
 })
 
@@ -127,6 +186,42 @@ var rootQuery = graphql.NewObject(graphql.ObjectConfig{
 var authenticatedMutations = graphql.NewObject(graphql.ObjectConfig{
 	Name: "AuthenticatedMutations",
 	Fields: graphql.Fields{
+		"requestEmergency": requestEmergencyMutation,
+		"confirmEmergency": confirmEmergencyMutation,
+		"setHotelLocation": setHotelLocationMutation,
+		"createHotel": createHotelMutation,
+		"updateHotel": updateHotelMutation,
+		"archiveHotel": archiveHotelMutation,
+		"createDoor": createDoorMutation,
+		"updateDoor": updateDoorMutation,
+		"createZone": createZoneMutation,
+		"updateZone": updateZoneMutation,
+		"createRoom": createRoomMutation,
+		"updateRoom": updateRoomMutation,
+		"archiveRoom": archiveRoomMutation,
+		"createRoomType": createRoomTypeMutation,
+		"updateRoomType": updateRoomTypeMutation,
+		"setRoomTypeRates": setRoomTypeRatesMutation,
+		"disableUser": disableUserMutation,
+		"enableUser": enableUserMutation,
+		"revokeSessions": revokeSessionsMutation,
+		"forcePasswordReset": forcePasswordResetMutation,
+		"verifyUserEmail": verifyUserEmailMutation,
+		"importData": importDataMutation,
+		"checkInBooking": checkInBookingMutation,
+		"postFolioExtra": postFolioExtraMutation,
+		"recordFolioPayment": recordFolioPaymentMutation,
+		"checkOutBooking": checkOutBookingMutation,
+		"cancelBooking": cancelBookingMutation,
+		"markNoShow": markNoShowMutation,
+		"assignBookingRoom": assignBookingRoomMutation,
+		"setBookingType": setBookingTypeMutation,
+		"createRoomBlock": createRoomBlockMutation,
+		"endRoomBlock": endRoomBlockMutation,
+		"maintenanceOpenRoom": maintenanceOpenRoomMutation,
+		"setRoomHousekeeping": setRoomHousekeepingMutation,
+		"createShift": createShiftMutation,
+		"endShift": endShiftMutation,
 	},
 })
 
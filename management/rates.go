@@ -0,0 +1,235 @@
+package management
+
+import (
+	"fmt"
+
+	"github.com/fluidmediaproductions/central_hotel_door_server/utils"
+	"github.com/graphql-go/graphql"
+)
+
+var seasonRateType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "SeasonRate",
+	Fields: graphql.Fields{
+		"name": &graphql.Field{
+			Type: graphql.String,
+		},
+		"from": &graphql.Field{
+			Type: graphql.String,
+		},
+		"to": &graphql.Field{
+			Type: graphql.String,
+		},
+		"nightly": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"minStay": &graphql.Field{
+			Type: graphql.Int,
+		},
+	},
+})
+
+var taxType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Tax",
+	Fields: graphql.Fields{
+		"name": &graphql.Field{
+			Type: graphql.String,
+		},
+		"percent": &graphql.Field{
+			Type: graphql.Float,
+		},
+	},
+})
+
+var ratePlanType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "RatePlan",
+	Fields: graphql.Fields{
+		"ID": &graphql.Field{
+			Type:    graphql.NewNonNull(graphql.String),
+			Resolve: sourceID,
+		},
+		"currency": &graphql.Field{
+			Type: graphql.String,
+		},
+		"nightly": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"minStay": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"seasons": &graphql.Field{
+			Type: graphql.NewList(seasonRateType),
+		},
+		"taxes": &graphql.Field{
+			Type: graphql.NewList(taxType),
+		},
+		"createdAt": &graphql.Field{
+			Type:    graphql.DateTime,
+			Resolve: resolveDateTime("createdAt"),
+		},
+		"createdBy": &graphql.Field{
+			Type: graphql.String,
+		},
+	},
+})
+
+var quoteNightType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "QuoteNight",
+	Fields: graphql.Fields{
+		"date": &graphql.Field{
+			Type: graphql.String,
+		},
+		"amount": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"season": &graphql.Field{
+			Type: graphql.String,
+		},
+	},
+})
+
+var quoteTaxType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "QuoteTax",
+	Fields: graphql.Fields{
+		"name": &graphql.Field{
+			Type: graphql.String,
+		},
+		"percent": &graphql.Field{
+			Type: graphql.Float,
+		},
+		"amount": &graphql.Field{
+			Type: graphql.Int,
+		},
+	},
+})
+
+// quoteType is the price a booking was made at.
+var quoteType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Quote",
+	Fields: graphql.Fields{
+		"roomTypeId": &graphql.Field{
+			Type: graphql.String,
+		},
+		"ratePlanId": &graphql.Field{
+			Type: graphql.String,
+		},
+		"currency": &graphql.Field{
+			Type: graphql.String,
+		},
+		"nights": &graphql.Field{
+			Type: graphql.NewList(quoteNightType),
+		},
+		"minStay": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"subtotal": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"taxes": &graphql.Field{
+			Type: graphql.NewList(quoteTaxType),
+		},
+		"total": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"quotedAt": &graphql.Field{
+			Type:    graphql.DateTime,
+			Resolve: resolveDateTime("quotedAt"),
+		},
+	},
+})
+
+var roomTypeRatesQuery = &graphql.Field{
+	Type: ratePlanType,
+	Args: graphql.FieldConfigArgument{
+		"roomTypeId": &graphql.ArgumentConfig{
+			Type: graphql.NewNonNull(graphql.String),
+		},
+	},
+	Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+		roomTypeId, isOk := params.Args["roomTypeId"].(string)
+		if isOk {
+			user, isOk := params.Source.(*utils.User)
+			if isOk {
+				resp, err := sendAsUser("GET", RoomsServer+fmt.Sprintf("/room-types/%s/rates", roomTypeId), user, nil)
+				if err != nil {
+					return nil, err
+				}
+				return resp["ratePlan"], nil
+			}
+		}
+		return nil, nil
+	},
+}
+
+var seasonRateInputType = graphql.NewInputObject(graphql.InputObjectConfig{
+	Name: "SeasonRateInput",
+	Fields: graphql.InputObjectConfigFieldMap{
+		"name": &graphql.InputObjectFieldConfig{
+			Type: graphql.NewNonNull(graphql.String),
+		},
+		"from": &graphql.InputObjectFieldConfig{
+			Type: graphql.NewNonNull(graphql.String),
+		},
+		"to": &graphql.InputObjectFieldConfig{
+			Type: graphql.NewNonNull(graphql.String),
+		},
+		"nightly": &graphql.InputObjectFieldConfig{
+			Type: graphql.NewNonNull(graphql.Int),
+		},
+		"minStay": &graphql.InputObjectFieldConfig{
+			Type: graphql.Int,
+		},
+	},
+})
+
+var taxInputType = graphql.NewInputObject(graphql.InputObjectConfig{
+	Name: "TaxInput",
+	Fields: graphql.InputObjectConfigFieldMap{
+		"name": &graphql.InputObjectFieldConfig{
+			Type: graphql.NewNonNull(graphql.String),
+		},
+		"percent": &graphql.InputObjectFieldConfig{
+			Type: graphql.NewNonNull(graphql.Float),
+		},
+	},
+})
+
+// setRoomTypeRatesMutation replaces a room type's rates. Bookings already
+// made keep the price they were quoted.
+var setRoomTypeRatesMutation = &graphql.Field{
+	Type: ratePlanType,
+	Args: graphql.FieldConfigArgument{
+		"roomTypeId": &graphql.ArgumentConfig{
+			Type: graphql.NewNonNull(graphql.String),
+		},
+		"currency": &graphql.ArgumentConfig{
+			Type: graphql.NewNonNull(graphql.String),
+		},
+		"nightly": &graphql.ArgumentConfig{
+			Type: graphql.NewNonNull(graphql.Int),
+		},
+		"minStay": &graphql.ArgumentConfig{
+			Type: graphql.Int,
+		},
+		"seasons": &graphql.ArgumentConfig{
+			Type: graphql.NewList(seasonRateInputType),
+		},
+		"taxes": &graphql.ArgumentConfig{
+			Type: graphql.NewList(taxInputType),
+		},
+	},
+	Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+		roomTypeId, isOk := params.Args["roomTypeId"].(string)
+		if isOk {
+			user, isOk := params.Source.(*utils.User)
+			if isOk {
+				data := inputFromArgs(params.Args, "currency", "nightly", "minStay", "seasons", "taxes")
+				resp, err := sendAsUser("PUT", RoomsServer+fmt.Sprintf("/room-types/%s/rates", roomTypeId), user, data)
+				if err != nil {
+					return nil, err
+				}
+				return resp["ratePlan"], nil
+			}
+		}
+		return nil, nil
+	},
+}
@@ -0,0 +1,167 @@
+package management
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/fluidmediaproductions/central_hotel_door_server/utils"
+	"github.com/graphql-go/graphql"
+)
+
+var housekeepingStatusType = graphql.NewEnum(graphql.EnumConfig{
+	Name: "HousekeepingStatus",
+	Values: graphql.EnumValueConfigMap{
+		"DIRTY": &graphql.EnumValueConfig{
+			Value: "dirty",
+		},
+		"IN_PROGRESS": &graphql.EnumValueConfig{
+			Value: "in_progress",
+		},
+		"CLEAN": &graphql.EnumValueConfig{
+			Value: "clean",
+		},
+		"INSPECTED": &graphql.EnumValueConfig{
+			Value: "inspected",
+		},
+	},
+})
+
+var staffShiftType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "StaffShift",
+	Fields: graphql.Fields{
+		"ID": &graphql.Field{
+			Type:    graphql.NewNonNull(graphql.String),
+			Resolve: sourceID,
+		},
+		"userId": &graphql.Field{
+			Type: graphql.String,
+		},
+		"hotelId": &graphql.Field{
+			Type: graphql.String,
+		},
+		"createdBy": &graphql.Field{
+			Type: graphql.String,
+		},
+		"start": &graphql.Field{
+			Type:    graphql.DateTime,
+			Resolve: resolveDateTime("start"),
+		},
+		"end": &graphql.Field{
+			Type:    graphql.DateTime,
+			Resolve: resolveDateTime("end"),
+		},
+	},
+})
+
+// setRoomHousekeepingMutation moves a room on to another housekeeping state,
+// for the front desk and housekeeping.
+var setRoomHousekeepingMutation = &graphql.Field{
+	Type: roomType,
+	Args: graphql.FieldConfigArgument{
+		"roomId": &graphql.ArgumentConfig{
+			Type: graphql.NewNonNull(graphql.String),
+		},
+		"status": &graphql.ArgumentConfig{
+			Type: graphql.NewNonNull(housekeepingStatusType),
+		},
+	},
+	Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+		roomId, isOk := params.Args["roomId"].(string)
+		if isOk {
+			user, isOk := params.Source.(*utils.User)
+			if isOk {
+				data := inputFromArgs(params.Args, "status")
+				resp, err := sendAsUser("POST", RoomsServer+fmt.Sprintf("/rooms/%s/housekeeping", url.PathEscape(roomId)), user, data)
+				if err != nil {
+					return nil, err
+				}
+				return resp["room"], nil
+			}
+		}
+		return nil, nil
+	},
+}
+
+// shiftsQuery lists a hotel's shifts that are on or coming up.
+var shiftsQuery = &graphql.Field{
+	Type: graphql.NewList(staffShiftType),
+	Args: graphql.FieldConfigArgument{
+		"hotelId": &graphql.ArgumentConfig{
+			Type: graphql.NewNonNull(graphql.String),
+		},
+	},
+	Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+		hotelId, isOk := params.Args["hotelId"].(string)
+		if isOk {
+			user, isOk := params.Source.(*utils.User)
+			if isOk {
+				resp, err := sendAsUser("GET", HotelsServer+fmt.Sprintf("/hotels/%s/shifts", url.PathEscape(hotelId)), user, nil)
+				if err != nil {
+					return nil, err
+				}
+				return resp["shifts"], nil
+			}
+		}
+		return nil, nil
+	},
+}
+
+// createShiftMutation puts a member of staff on shift at a hotel, letting
+// them into its rooms and doors while it's on.
+var createShiftMutation = &graphql.Field{
+	Type: staffShiftType,
+	Args: graphql.FieldConfigArgument{
+		"hotelId": &graphql.ArgumentConfig{
+			Type: graphql.NewNonNull(graphql.String),
+		},
+		"userId": &graphql.ArgumentConfig{
+			Type: graphql.NewNonNull(graphql.String),
+		},
+		"start": &graphql.ArgumentConfig{
+			Type: graphql.NewNonNull(graphql.DateTime),
+		},
+		"end": &graphql.ArgumentConfig{
+			Type: graphql.NewNonNull(graphql.DateTime),
+		},
+	},
+	Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+		hotelId, isOk := params.Args["hotelId"].(string)
+		if isOk {
+			user, isOk := params.Source.(*utils.User)
+			if isOk {
+				data := inputFromArgs(params.Args, "userId", "start", "end")
+				resp, err := sendAsUser("POST", HotelsServer+fmt.Sprintf("/hotels/%s/shifts", url.PathEscape(hotelId)), user, data)
+				if err != nil {
+					return nil, err
+				}
+				return resp["shift"], nil
+			}
+		}
+		return nil, nil
+	},
+}
+
+// endShiftMutation takes away a member of staff's access now, or cancels a
+// shift that hasn't started.
+var endShiftMutation = &graphql.Field{
+	Type: staffShiftType,
+	Args: graphql.FieldConfigArgument{
+		"shiftId": &graphql.ArgumentConfig{
+			Type: graphql.NewNonNull(graphql.String),
+		},
+	},
+	Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+		shiftId, isOk := params.Args["shiftId"].(string)
+		if isOk {
+			user, isOk := params.Source.(*utils.User)
+			if isOk {
+				resp, err := sendAsUser("POST", HotelsServer+fmt.Sprintf("/shifts/%s/end", url.PathEscape(shiftId)), user, nil)
+				if err != nil {
+					return nil, err
+				}
+				return resp["shift"], nil
+			}
+		}
+		return nil, nil
+	},
+}
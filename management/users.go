@@ -0,0 +1,269 @@
+package management
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/fluidmediaproductions/central_hotel_door_server/utils"
+	"github.com/graphql-go/graphql"
+)
+
+var BookingsServer = "http://bookings"
+
+// staffKey is where the staff member looking at a user is kept in the
+// user's map, for the fields that call other services.
+const staffKey = "_staff"
+
+func withStaff(item interface{}, staff *utils.User) interface{} {
+	account, isOk := item.(map[string]interface{})
+	if isOk {
+		account[staffKey] = staff
+	}
+	return item
+}
+
+// sourceID resolves the ID of an item from a service, held in its uid.
+func sourceID(params graphql.ResolveParams) (interface{}, error) {
+	source, isOk := params.Source.(map[string]interface{})
+	if isOk {
+		return source["uid"], nil
+	}
+	return nil, nil
+}
+
+var pageArgs = graphql.FieldConfigArgument{
+	"first": &graphql.ArgumentConfig{
+		Type: graphql.Int,
+	},
+	"offset": &graphql.ArgumentConfig{
+		Type: graphql.Int,
+	},
+}
+
+var userBookingType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "UserBooking",
+	Fields: graphql.Fields{
+		"ID": &graphql.Field{
+			Type:    graphql.NewNonNull(graphql.String),
+			Resolve: sourceID,
+		},
+		"hotelId": &graphql.Field{
+			Type: graphql.String,
+		},
+		"roomId": &graphql.Field{
+			Type: graphql.String,
+		},
+		"category": &graphql.Field{
+			Type: graphql.String,
+		},
+		"needsRoom": &graphql.Field{
+			Type: graphql.Boolean,
+		},
+		"roomHistory": &graphql.Field{
+			Type: graphql.NewList(roomAssignmentType),
+		},
+		"type": &graphql.Field{
+			Type: graphql.String,
+		},
+		"start": &graphql.Field{
+			Type:    graphql.DateTime,
+			Resolve: resolveDateTime("start"),
+		},
+		"end": &graphql.Field{
+			Type:    graphql.DateTime,
+			Resolve: resolveDateTime("end"),
+		},
+		"status": &graphql.Field{
+			Type: bookingStateType,
+		},
+		"price": &graphql.Field{
+			Type: quoteType,
+		},
+		"payment": &graphql.Field{
+			Type: bookingPaymentType,
+		},
+		"checkedInAt": &graphql.Field{
+			Type:    graphql.DateTime,
+			Resolve: resolveDateTime("checkedInAt"),
+		},
+		"checkedOutAt": &graphql.Field{
+			Type:    graphql.DateTime,
+			Resolve: resolveDateTime("checkedOutAt"),
+		},
+		"cancelledAt": &graphql.Field{
+			Type:    graphql.DateTime,
+			Resolve: resolveDateTime("cancelledAt"),
+		},
+		"noShowAt": &graphql.Field{
+			Type:    graphql.DateTime,
+			Resolve: resolveDateTime("noShowAt"),
+		},
+	},
+})
+
+var userUnlockType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "UserUnlock",
+	Fields: graphql.Fields{
+		"ID": &graphql.Field{
+			Type:    graphql.NewNonNull(graphql.String),
+			Resolve: sourceID,
+		},
+		"roomId": &graphql.Field{
+			Type: graphql.String,
+		},
+		"bookingId": &graphql.Field{
+			Type: graphql.String,
+		},
+		"guestId": &graphql.Field{
+			Type: graphql.String,
+		},
+		"time": &graphql.Field{
+			Type:    graphql.DateTime,
+			Resolve: resolveDateTime("time"),
+		},
+	},
+})
+
+// userHistory makes a field listing one of a user's histories from a
+// service, as the staff member asking.
+func userHistory(itemType *graphql.Object, server string, path string, key string) *graphql.Field {
+	return &graphql.Field{
+		Type: graphql.NewList(itemType),
+		Args: pageArgs,
+		Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+			account, isOk := params.Source.(map[string]interface{})
+			if isOk {
+				userId, _ := account["uid"].(string)
+				staff, isOk := account[staffKey].(*utils.User)
+				if isOk {
+					resp, err := sendAsUser("GET", server+fmt.Sprintf(path, url.PathEscape(userId)), staff, nil)
+					if err != nil {
+						return nil, err
+					}
+					return paginateSlice(resp[key], params.Args), nil
+				}
+			}
+			return nil, nil
+		},
+	}
+}
+
+var userAccountType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "UserAccount",
+	Fields: graphql.Fields{
+		"ID": &graphql.Field{
+			Type:    graphql.NewNonNull(graphql.String),
+			Resolve: sourceID,
+		},
+		"email": &graphql.Field{
+			Type: graphql.String,
+		},
+		"name": &graphql.Field{
+			Type: graphql.String,
+		},
+		"roles": &graphql.Field{
+			Type: graphql.NewList(graphql.String),
+		},
+		"disabled": &graphql.Field{
+			Type: graphql.Boolean,
+		},
+		"mustResetPass": &graphql.Field{
+			Type: graphql.Boolean,
+		},
+		"emailVerified": &graphql.Field{
+			Type: graphql.Boolean,
+		},
+		"sessionsValidAfter": &graphql.Field{
+			Type:    graphql.DateTime,
+			Resolve: resolveDateTime("sessionsValidAfter"),
+		},
+		"bookings": userHistory(userBookingType, BookingsServer, "/bookings/by-user/%s", "bookings"),
+		"unlocks":  userHistory(userUnlockType, RoomsServer, "/unlocks/by-user/%s", "unlocks"),
+	},
+})
+
+var usersQuery = &graphql.Field{
+	Type: graphql.NewList(userAccountType),
+	Args: graphql.FieldConfigArgument{
+		"search": &graphql.ArgumentConfig{
+			Type: graphql.String,
+		},
+		"first":  pageArgs["first"],
+		"offset": pageArgs["offset"],
+	},
+	Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+		user, isOk := params.Source.(*utils.User)
+		if isOk {
+			path := "/users"
+			if search, _ := params.Args["search"].(string); search != "" {
+				path += "?q=" + url.QueryEscape(search)
+			}
+			resp, err := sendAsUser("GET", AuthServer+path, user, nil)
+			if err != nil {
+				return nil, err
+			}
+			users := paginateSlice(resp["users"], params.Args)
+			for _, account := range users {
+				withStaff(account, user)
+			}
+			return users, nil
+		}
+		return nil, nil
+	},
+}
+
+var userQuery = &graphql.Field{
+	Type: userAccountType,
+	Args: graphql.FieldConfigArgument{
+		"userId": &graphql.ArgumentConfig{
+			Type: graphql.NewNonNull(graphql.String),
+		},
+	},
+	Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+		userId, isOk := params.Args["userId"].(string)
+		if isOk {
+			user, isOk := params.Source.(*utils.User)
+			if isOk {
+				resp, err := sendAsUser("GET", AuthServer+fmt.Sprintf("/users/%s", url.PathEscape(userId)), user, nil)
+				if err != nil {
+					return nil, err
+				}
+				return withStaff(resp["user"], user), nil
+			}
+		}
+		return nil, nil
+	},
+}
+
+// userStateMutation makes a mutation that posts to one of the auth
+// service's account actions.
+func userStateMutation(action string) *graphql.Field {
+	return &graphql.Field{
+		Type: userAccountType,
+		Args: graphql.FieldConfigArgument{
+			"userId": &graphql.ArgumentConfig{
+				Type: graphql.NewNonNull(graphql.String),
+			},
+		},
+		Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+			userId, isOk := params.Args["userId"].(string)
+			if isOk {
+				user, isOk := params.Source.(*utils.User)
+				if isOk {
+					resp, err := sendAsUser("POST", AuthServer+fmt.Sprintf("/users/%s/%s", url.PathEscape(userId), action), user, nil)
+					if err != nil {
+						return nil, err
+					}
+					return withStaff(resp["user"], user), nil
+				}
+			}
+			return nil, nil
+		},
+	}
+}
+
+var disableUserMutation = userStateMutation("disable")
+var enableUserMutation = userStateMutation("enable")
+var revokeSessionsMutation = userStateMutation("revoke-sessions")
+var forcePasswordResetMutation = userStateMutation("force-reset")
+var verifyUserEmailMutation = userStateMutation("verify-email")
@@ -0,0 +1,291 @@
+package management
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/fluidmediaproductions/central_hotel_door_server/utils"
+	"github.com/graphql-go/graphql"
+)
+
+var accessScheduleType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "AccessSchedule",
+	Fields: graphql.Fields{
+		"days": &graphql.Field{
+			Type: graphql.NewList(graphql.Int),
+		},
+		"from": &graphql.Field{
+			Type: graphql.String,
+		},
+		"to": &graphql.Field{
+			Type: graphql.String,
+		},
+	},
+})
+
+var zoneGrantType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "ZoneGrant",
+	Fields: graphql.Fields{
+		"ID": &graphql.Field{
+			Type:    graphql.NewNonNull(graphql.String),
+			Resolve: sourceID,
+		},
+		"bookingType": &graphql.Field{
+			Type: graphql.String,
+		},
+		"roomCategory": &graphql.Field{
+			Type: graphql.String,
+		},
+		"schedule": &graphql.Field{
+			Type: accessScheduleType,
+		},
+	},
+})
+
+var zoneType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Zone",
+	Fields: graphql.Fields{
+		"ID": &graphql.Field{
+			Type:    graphql.NewNonNull(graphql.String),
+			Resolve: sourceID,
+		},
+		"name": &graphql.Field{
+			Type: graphql.String,
+		},
+		"kind": &graphql.Field{
+			Type: graphql.String,
+		},
+		"hotelId": &graphql.Field{
+			Type: graphql.String,
+		},
+		"grants": &graphql.Field{
+			Type: graphql.NewList(zoneGrantType),
+		},
+		"doorIds": &graphql.Field{
+			Type: graphql.NewList(graphql.String),
+		},
+	},
+})
+
+var doorType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Door",
+	Fields: graphql.Fields{
+		"ID": &graphql.Field{
+			Type:    graphql.NewNonNull(graphql.String),
+			Resolve: sourceID,
+		},
+		"name": &graphql.Field{
+			Type: graphql.String,
+		},
+		"hotelId": &graphql.Field{
+			Type: graphql.String,
+		},
+		"zones": &graphql.Field{
+			Type: graphql.NewList(zoneType),
+		},
+	},
+})
+
+var accessScheduleInputType = graphql.NewInputObject(graphql.InputObjectConfig{
+	Name: "AccessScheduleInput",
+	Fields: graphql.InputObjectConfigFieldMap{
+		"days": &graphql.InputObjectFieldConfig{
+			Type: graphql.NewList(graphql.NewNonNull(graphql.Int)),
+		},
+		"from": &graphql.InputObjectFieldConfig{
+			Type: graphql.String,
+		},
+		"to": &graphql.InputObjectFieldConfig{
+			Type: graphql.String,
+		},
+	},
+})
+
+var zoneGrantInputType = graphql.NewInputObject(graphql.InputObjectConfig{
+	Name: "ZoneGrantInput",
+	Fields: graphql.InputObjectConfigFieldMap{
+		"bookingType": &graphql.InputObjectFieldConfig{
+			Type: graphql.String,
+		},
+		"roomCategory": &graphql.InputObjectFieldConfig{
+			Type: graphql.String,
+		},
+		"schedule": &graphql.InputObjectFieldConfig{
+			Type: accessScheduleInputType,
+		},
+	},
+})
+
+var zonesQuery = &graphql.Field{
+	Type: graphql.NewList(zoneType),
+	Args: graphql.FieldConfigArgument{
+		"hotelId": &graphql.ArgumentConfig{
+			Type: graphql.NewNonNull(graphql.String),
+		},
+	},
+	Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+		hotelId, isOk := params.Args["hotelId"].(string)
+		if isOk {
+			user, isOk := params.Source.(*utils.User)
+			if isOk {
+				resp, err := sendAsUser("GET", HotelsServer+fmt.Sprintf("/zones/by-hotel/%s", url.PathEscape(hotelId)), user, nil)
+				if err != nil {
+					return nil, err
+				}
+				return resp["zones"], nil
+			}
+		}
+		return nil, nil
+	},
+}
+
+var doorsQuery = &graphql.Field{
+	Type: graphql.NewList(doorType),
+	Args: graphql.FieldConfigArgument{
+		"hotelId": &graphql.ArgumentConfig{
+			Type: graphql.NewNonNull(graphql.String),
+		},
+	},
+	Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+		hotelId, isOk := params.Args["hotelId"].(string)
+		if isOk {
+			user, isOk := params.Source.(*utils.User)
+			if isOk {
+				resp, err := sendAsUser("GET", HotelsServer+fmt.Sprintf("/doors/by-hotel/%s", url.PathEscape(hotelId)), user, nil)
+				if err != nil {
+					return nil, err
+				}
+				return resp["doors"], nil
+			}
+		}
+		return nil, nil
+	},
+}
+
+var createDoorMutation = &graphql.Field{
+	Type: doorType,
+	Args: graphql.FieldConfigArgument{
+		"hotelId": &graphql.ArgumentConfig{
+			Type: graphql.NewNonNull(graphql.String),
+		},
+		"name": &graphql.ArgumentConfig{
+			Type: graphql.NewNonNull(graphql.String),
+		},
+	},
+	Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+		hotelId, isOk := params.Args["hotelId"].(string)
+		if isOk {
+			user, isOk := params.Source.(*utils.User)
+			if isOk {
+				data := inputFromArgs(params.Args, "name")
+				resp, err := sendAsUser("POST", HotelsServer+fmt.Sprintf("/hotels/%s/doors", url.PathEscape(hotelId)), user, data)
+				if err != nil {
+					return nil, err
+				}
+				return resp["door"], nil
+			}
+		}
+		return nil, nil
+	},
+}
+
+var updateDoorMutation = &graphql.Field{
+	Type: doorType,
+	Args: graphql.FieldConfigArgument{
+		"doorId": &graphql.ArgumentConfig{
+			Type: graphql.NewNonNull(graphql.String),
+		},
+		"name": &graphql.ArgumentConfig{
+			Type: graphql.String,
+		},
+	},
+	Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+		doorId, isOk := params.Args["doorId"].(string)
+		if isOk {
+			user, isOk := params.Source.(*utils.User)
+			if isOk {
+				data := inputFromArgs(params.Args, "name")
+				resp, err := sendAsUser("PUT", HotelsServer+fmt.Sprintf("/doors/%s", url.PathEscape(doorId)), user, data)
+				if err != nil {
+					return nil, err
+				}
+				return resp["door"], nil
+			}
+		}
+		return nil, nil
+	},
+}
+
+var createZoneMutation = &graphql.Field{
+	Type: zoneType,
+	Args: graphql.FieldConfigArgument{
+		"hotelId": &graphql.ArgumentConfig{
+			Type: graphql.NewNonNull(graphql.String),
+		},
+		"name": &graphql.ArgumentConfig{
+			Type: graphql.NewNonNull(graphql.String),
+		},
+		"kind": &graphql.ArgumentConfig{
+			Type: graphql.String,
+		},
+		"doorIds": &graphql.ArgumentConfig{
+			Type: graphql.NewList(graphql.NewNonNull(graphql.String)),
+		},
+		"grants": &graphql.ArgumentConfig{
+			Type: graphql.NewList(graphql.NewNonNull(zoneGrantInputType)),
+		},
+	},
+	Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+		hotelId, isOk := params.Args["hotelId"].(string)
+		if isOk {
+			user, isOk := params.Source.(*utils.User)
+			if isOk {
+				data := inputFromArgs(params.Args, "name", "kind", "doorIds", "grants")
+				resp, err := sendAsUser("POST", HotelsServer+fmt.Sprintf("/hotels/%s/zones", url.PathEscape(hotelId)), user, data)
+				if err != nil {
+					return nil, err
+				}
+				return resp["zone"], nil
+			}
+		}
+		return nil, nil
+	},
+}
+
+// updateZoneMutation edits a zone. Doors or grants that are given replace
+// all of the zone's old ones.
+var updateZoneMutation = &graphql.Field{
+	Type: zoneType,
+	Args: graphql.FieldConfigArgument{
+		"zoneId": &graphql.ArgumentConfig{
+			Type: graphql.NewNonNull(graphql.String),
+		},
+		"name": &graphql.ArgumentConfig{
+			Type: graphql.String,
+		},
+		"kind": &graphql.ArgumentConfig{
+			Type: graphql.String,
+		},
+		"doorIds": &graphql.ArgumentConfig{
+			Type: graphql.NewList(graphql.NewNonNull(graphql.String)),
+		},
+		"grants": &graphql.ArgumentConfig{
+			Type: graphql.NewList(graphql.NewNonNull(zoneGrantInputType)),
+		},
+	},
+	Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+		zoneId, isOk := params.Args["zoneId"].(string)
+		if isOk {
+			user, isOk := params.Source.(*utils.User)
+			if isOk {
+				data := inputFromArgs(params.Args, "name", "kind", "doorIds", "grants")
+				resp, err := sendAsUser("PUT", HotelsServer+fmt.Sprintf("/zones/%s", url.PathEscape(zoneId)), user, data)
+				if err != nil {
+					return nil, err
+				}
+				return resp["zone"], nil
+			}
+		}
+		return nil, nil
+	},
+}
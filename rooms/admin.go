@@ -0,0 +1,358 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dgraph-io/dgo"
+	"github.com/dgraph-io/dgo/protos/api"
+	"github.com/fluidmediaproductions/central_hotel_door_server/clients"
+	"github.com/fluidmediaproductions/central_hotel_door_server/utils"
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+)
+
+type RoomInput = clients.RoomInput
+
+var errNotAdmin = errors.New("managing rooms needs the admin role")
+var errRoomNotFound = errors.New("room not found")
+
+// getAdminClaims checks the request is from an admin.
+func getAdminClaims(r *http.Request) (*utils.JWTClaims, error) {
+	claims, err := utils.GetRequestJWT(r, jwtSecret)
+	if err != nil {
+		return nil, err
+	}
+	if !claims.User.HasRole(utils.RoleAdmin) {
+		return nil, errNotAdmin
+	}
+	return claims, nil
+}
+
+func writeAdminAuthError(w http.ResponseWriter, err error) {
+	code := utils.CodeUnauthenticated
+	if err == errNotAdmin {
+		code = utils.CodeForbidden
+	}
+	w.WriteHeader(http.StatusForbidden)
+	json.NewEncoder(w).Encode(&RoomResp{
+		Err:  err.Error(),
+		Code: code,
+	})
+}
+
+func writeRoomError(w http.ResponseWriter, status int, err error) {
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(&RoomResp{
+		Err:  err.Error(),
+		Code: utils.StatusCode(status),
+	})
+}
+
+// archivedFilter leaves archived rooms out of a list, unless an admin has
+// asked for them with the archived query parameter.
+func archivedFilter(r *http.Request) ([]string, error) {
+	if r.URL.Query().Get("archived") == "include" {
+		_, err := getAdminClaims(r)
+		if err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+	return []string{"NOT has(room.archivedAt)"}, nil
+}
+
+func roomFilter(conds []string) string {
+	if len(conds) == 0 {
+		return ""
+	}
+	return "@filter(" + strings.Join(conds, " AND ") + ")"
+}
+
+func writeAudit(ctx context.Context, txn *dgo.Txn, entry *utils.AuditEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	_, err = txn.Mutate(ctx, &api.Mutation{SetJson: data})
+	return err
+}
+
+// roomNode turns the fields set in a RoomInput into the predicates of a
+// mutation.
+func roomNode(id string, input *RoomInput) (map[string]interface{}, error) {
+	node := map[string]interface{}{
+		"uid": id,
+	}
+	if input.Name != nil {
+		name := strings.TrimSpace(*input.Name)
+		if name == "" {
+			return nil, errors.New("name can't be empty")
+		}
+		node["room.name"] = name
+	}
+	if input.Floor != nil {
+		node["room.floor"] = strings.TrimSpace(*input.Floor)
+	}
+	if input.Category != nil {
+		node["room.category"] = strings.TrimSpace(*input.Category)
+	}
+	if input.HotelID != nil {
+		node["room.hotel"] = &utils.UIDRef{ID: *input.HotelID}
+	}
+	if input.TypeID != nil && *input.TypeID != "" {
+		node["room.type"] = &utils.UIDRef{ID: *input.TypeID}
+	}
+	return node, nil
+}
+
+func decodeRoomInput(r *http.Request) (*RoomInput, error) {
+	defer r.Body.Close()
+	var input RoomInput
+	err := json.NewDecoder(r.Body).Decode(&input)
+	if err != nil {
+		return nil, errors.New("bad request data")
+	}
+	return &input, nil
+}
+
+// nodeExists checks there's a node with the uid id and the predicate kind.
+func nodeExists(ctx context.Context, txn *dgo.Txn, id string, kind string) (bool, error) {
+	q := `query q($id: string) {
+            nodes(func: uid($id)) @filter(has(` + kind + `)) {
+              uid
+	        }
+          }`
+	resp, err := txn.QueryWithVars(ctx, q, map[string]string{"$id": id})
+	if err != nil {
+		return false, err
+	}
+	var nodes struct {
+		Nodes []struct {
+			ID string `json:"uid"`
+		} `json:"nodes"`
+	}
+	err = json.Unmarshal(resp.GetJson(), &nodes)
+	if err != nil {
+		return false, err
+	}
+	return len(nodes.Nodes) > 0, nil
+}
+
+// checkRoomHotel makes sure a room is being put in a hotel that exists.
+func checkRoomHotel(ctx context.Context, txn *dgo.Txn, input *RoomInput) (int, error) {
+	if input.HotelID == nil {
+		return 0, nil
+	}
+	if !utils.IsUID(*input.HotelID) {
+		return http.StatusBadRequest, errors.Errorf("invalid hotel %q", *input.HotelID)
+	}
+	exists, err := nodeExists(ctx, txn, *input.HotelID, "hotel")
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if !exists {
+		return http.StatusBadRequest, errors.New("hotel not found")
+	}
+	return 0, nil
+}
+
+// saveRoom writes a room mutation and its audit entry, then fetches the
+// room as it now is.
+func saveRoom(ctx context.Context, txn *dgo.Txn, node map[string]interface{}, action string, userId string) (*Room, error) {
+	mutData, err := json.Marshal(node)
+	if err != nil {
+		return nil, err
+	}
+	assigned, err := txn.Mutate(ctx, &api.Mutation{SetJson: mutData})
+	if err != nil {
+		return nil, err
+	}
+	id, _ := node["uid"].(string)
+	if newId, isOk := assigned.GetUids()["room"]; isOk {
+		id = newId
+	}
+	err = writeAudit(ctx, txn, utils.NewAuditEntry(action, userId, id, ""))
+	if err != nil {
+		return nil, err
+	}
+	err = txn.Commit(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rooms, err := getRoomFormDB(id)
+	if err != nil {
+		return nil, err
+	}
+	return rooms.toRooms()[0], nil
+}
+
+func createRoom(w http.ResponseWriter, r *http.Request) {
+	claims, err := getAdminClaims(r)
+	if err != nil {
+		writeAdminAuthError(w, err)
+		return
+	}
+
+	input, err := decodeRoomInput(r)
+	if err != nil {
+		writeRoomError(w, http.StatusBadRequest, err)
+		return
+	}
+	if input.Name == nil || input.HotelID == nil {
+		writeRoomError(w, http.StatusBadRequest, errors.New("name and hotelId are needed"))
+		return
+	}
+	node, err := roomNode("_:room", input)
+	if err != nil {
+		writeRoomError(w, http.StatusBadRequest, err)
+		return
+	}
+	node["room"] = true
+	node["room.shouldOpen"] = false
+
+	ctx := context.Background()
+	txn := db.NewTxn()
+	defer txn.Discard(ctx)
+
+	status, err := checkRoomHotel(ctx, txn, input)
+	if err == nil {
+		status, err = checkRoomType(ctx, txn, "", input)
+	}
+	if err != nil {
+		writeRoomError(w, status, err)
+		return
+	}
+
+	room, err := saveRoom(ctx, txn, node, "room.created", claims.User.ID)
+	if err != nil {
+		writeRoomError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(&RoomResp{
+		Room: room,
+	})
+}
+
+func updateRoom(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	claims, err := getAdminClaims(r)
+	if err != nil {
+		writeAdminAuthError(w, err)
+		return
+	}
+
+	input, err := decodeRoomInput(r)
+	if err != nil {
+		writeRoomError(w, http.StatusBadRequest, err)
+		return
+	}
+	node, err := roomNode(id, input)
+	if err != nil {
+		writeRoomError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	ctx := context.Background()
+	txn := db.NewTxn()
+	defer txn.Discard(ctx)
+
+	exists, err := nodeExists(ctx, txn, id, "room")
+	if err != nil {
+		writeRoomError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if !exists {
+		writeRoomError(w, http.StatusNotFound, errRoomNotFound)
+		return
+	}
+	status, err := checkRoomHotel(ctx, txn, input)
+	if err == nil {
+		status, err = checkRoomType(ctx, txn, id, input)
+	}
+	if err != nil {
+		writeRoomError(w, status, err)
+		return
+	}
+
+	// A room is only ever in one hotel, so drop the old edge when moving it,
+	// along with its type unless it's been given one from the new hotel
+	edges := map[string]interface{}{
+		"uid": id,
+	}
+	if input.HotelID != nil {
+		edges["room.hotel"] = nil
+		edges["room.type"] = nil
+	}
+	if input.TypeID != nil {
+		edges["room.type"] = nil
+	}
+	if len(edges) > 1 {
+		del, err := json.Marshal(edges)
+		if err == nil {
+			_, err = txn.Mutate(ctx, &api.Mutation{DeleteJson: del})
+		}
+		if err != nil {
+			writeRoomError(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	room, err := saveRoom(ctx, txn, node, "room.updated", claims.User.ID)
+	if err != nil {
+		writeRoomError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(&RoomResp{
+		Room: room,
+	})
+}
+
+// archiveRoom hides a room from lists. It can still be fetched by its ID, so
+// existing bookings keep working.
+func archiveRoom(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	claims, err := getAdminClaims(r)
+	if err != nil {
+		writeAdminAuthError(w, err)
+		return
+	}
+
+	ctx := context.Background()
+	txn := db.NewTxn()
+	defer txn.Discard(ctx)
+
+	exists, err := nodeExists(ctx, txn, id, "room")
+	if err != nil {
+		writeRoomError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if !exists {
+		writeRoomError(w, http.StatusNotFound, errRoomNotFound)
+		return
+	}
+
+	node := map[string]interface{}{
+		"uid":             id,
+		"room.archivedAt": time.Now(),
+	}
+	room, err := saveRoom(ctx, txn, node, "room.archived", claims.User.ID)
+	if err != nil {
+		writeRoomError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(&RoomResp{
+		Room: room,
+	})
+}
@@ -0,0 +1,452 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dgraph-io/dgo"
+	"github.com/dgraph-io/dgo/protos/api"
+	"github.com/fluidmediaproductions/central_hotel_door_server/clients"
+	"github.com/fluidmediaproductions/central_hotel_door_server/utils"
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+)
+
+var HotelGatewayServer = "http://hotel-gateway"
+
+var hotelGatewayClient = clients.NewHotelGatewayClient(HotelGatewayServer)
+
+type RoomBlock = clients.RoomBlock
+type RoomBlockInput = clients.RoomBlockInput
+type RoomBlockResp = clients.RoomBlockResp
+type RoomBlocksResp = clients.RoomBlocksResp
+
+var errBlockNotFound = errors.New("block not found")
+
+// openBookingFilter matches bookings that still hold their room, including
+// those made before bookings had states.
+const openBookingFilter = `(NOT has(booking.status) OR eq(booking.status, "` + clients.BookingConfirmed +
+	`") OR eq(booking.status, "` + clients.BookingCheckedIn + `"))`
+
+const blockFields = `uid
+                block.start
+                block.end
+                block.reason
+                block.room {
+                  uid
+                }
+                block.createdBy {
+                  uid
+                }`
+
+// roomBlockFields gets a room's blocks that haven't ended by now.
+func roomBlockFields(now time.Time) string {
+	return `~block.room @filter(gt(block.end, "` + now.UTC().Format(time.RFC3339) + `")) (orderasc: block.start) {
+                ` + blockFields + `
+              }`
+}
+
+type blockQuery struct {
+	ID     string    `json:"uid"`
+	Start  time.Time `json:"block.start"`
+	End    time.Time `json:"block.end"`
+	Reason string    `json:"block.reason"`
+	Room   []struct {
+		ID string `json:"uid"`
+	} `json:"block.room"`
+	CreatedBy []struct {
+		ID string `json:"uid"`
+	} `json:"block.createdBy"`
+}
+
+func (b *blockQuery) toBlock() *RoomBlock {
+	block := &RoomBlock{
+		ID:     b.ID,
+		Start:  b.Start,
+		End:    b.End,
+		Reason: b.Reason,
+	}
+	if len(b.Room) > 0 {
+		block.RoomID = b.Room[0].ID
+	}
+	if len(b.CreatedBy) > 0 {
+		block.CreatedBy = b.CreatedBy[0].ID
+	}
+	return block
+}
+
+// availabilityFilter builds the var blocks finding the rooms that are out of
+// service or booked at some point between from and to.
+func availabilityFilter(from time.Time, to time.Time, variables map[string]string) (string, []string) {
+	variables["$from"] = from.Format(time.RFC3339)
+	variables["$to"] = to.Format(time.RFC3339)
+	block := `var (func: lt(block.start, $to)) @filter(gt(block.end, $from)) {
+              blocked as block.room
+            }
+            var (func: lt(booking.start, $to)) @filter(gt(booking.end, $from) AND ` + openBookingFilter + `) {
+              booked as booking.room
+            }`
+	return block, []string{"NOT uid(blocked)", "NOT uid(booked)"}
+}
+
+// checkBlockInput checks a block makes sense and hasn't already finished.
+func checkBlockInput(input *RoomBlockInput, now time.Time) error {
+	input.Reason = strings.TrimSpace(input.Reason)
+	if input.Reason == "" {
+		return errors.New("a reason is needed")
+	}
+	if !input.Start.Before(input.End) {
+		return errors.New("start must be before end")
+	}
+	if !input.End.After(now) {
+		return errors.New("block has already ended")
+	}
+	return nil
+}
+
+func writeBlockError(w http.ResponseWriter, status int, err error) {
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(&RoomBlockResp{
+		Err:  err.Error(),
+		Code: utils.StatusCode(status),
+	})
+}
+
+func getBlockFromDB(ctx context.Context, txn *dgo.Txn, id string) (*RoomBlock, error) {
+	q := `query q($id: string) {
+            blocks(func: uid($id)) @filter(has(block.room)) {
+              ` + blockFields + `
+            }
+          }`
+
+	resp, err := txn.QueryWithVars(ctx, q, map[string]string{"$id": id})
+	if err != nil {
+		return nil, err
+	}
+	var blocks struct {
+		Blocks []*blockQuery `json:"blocks"`
+	}
+	err = json.Unmarshal(resp.GetJson(), &blocks)
+	if err != nil {
+		return nil, err
+	}
+	if len(blocks.Blocks) == 0 {
+		return nil, errBlockNotFound
+	}
+	return blocks.Blocks[0].toBlock(), nil
+}
+
+// blockedBookings finds the open bookings that have a room for any of a
+// block.
+func blockedBookings(ctx context.Context, txn *dgo.Txn, roomId string, start time.Time, end time.Time) ([]string, error) {
+	q := `query q($id: string, $from: string, $to: string) {
+            rooms(func: uid($id)) {
+              ~booking.room @filter(lt(booking.start, $to) AND gt(booking.end, $from) AND ` + openBookingFilter + `) {
+                uid
+              }
+            }
+          }`
+
+	resp, err := txn.QueryWithVars(ctx, q, map[string]string{
+		"$id":   roomId,
+		"$from": start.Format(time.RFC3339),
+		"$to":   end.Format(time.RFC3339),
+	})
+	if err != nil {
+		return nil, err
+	}
+	var rooms struct {
+		Rooms []struct {
+			Bookings []struct {
+				ID string `json:"uid"`
+			} `json:"~booking.room"`
+		} `json:"rooms"`
+	}
+	err = json.Unmarshal(resp.GetJson(), &rooms)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, 0)
+	for _, room := range rooms.Rooms {
+		for _, booking := range room.Bookings {
+			ids = append(ids, booking.ID)
+		}
+	}
+	return ids, nil
+}
+
+// revokeBookingKeys revokes the offline keys of bookings moved out of a
+// room. The block has already been made by then, so a failure is only
+// logged.
+func revokeBookingKeys(bookingIds []string) {
+	token, err := utils.NewServiceJWT("rooms", jwtSecret)
+	if err != nil {
+		log.Printf("Error signing service token: %v\n", err)
+		return
+	}
+	for _, id := range bookingIds {
+		_, err := hotelGatewayClient.RevokeBookingCredentials(context.Background(), token, id)
+		if err != nil {
+			log.Printf("Error revoking credentials for booking %s: %v\n", id, err)
+		}
+	}
+}
+
+// createRoomBlock takes a room out of service. Bookings that have the room
+// while it's out are flagged as needing another one and their keys revoked,
+// and an unlock still waiting for the hotel is cancelled if the block has
+// already started.
+func createRoomBlock(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	claims, err := getAdminClaims(r)
+	if err != nil {
+		writeAdminAuthError(w, err)
+		return
+	}
+
+	var input RoomBlockInput
+	err = json.NewDecoder(r.Body).Decode(&input)
+	r.Body.Close()
+	if err != nil {
+		writeBlockError(w, http.StatusBadRequest, errors.New("bad request data"))
+		return
+	}
+	now := time.Now()
+	err = checkBlockInput(&input, now)
+	if err != nil {
+		writeBlockError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	ctx := context.Background()
+	txn := db.NewTxn()
+	defer txn.Discard(ctx)
+
+	exists, err := nodeExists(ctx, txn, id, "room")
+	if err != nil {
+		writeBlockError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if !exists {
+		writeBlockError(w, http.StatusNotFound, errRoomNotFound)
+		return
+	}
+	flagged, err := blockedBookings(ctx, txn, id, input.Start, input.End)
+	if err != nil {
+		writeBlockError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	set := []interface{}{
+		map[string]interface{}{
+			"uid":             "_:block",
+			"block.room":      &utils.UIDRef{ID: id},
+			"block.start":     input.Start,
+			"block.end":       input.End,
+			"block.reason":    input.Reason,
+			"block.createdBy": &utils.UIDRef{ID: claims.User.ID},
+		},
+		utils.NewAuditEntry("room.blocked", claims.User.ID, id,
+			fmt.Sprintf("%s, %d bookings flagged", input.Reason, len(flagged))),
+	}
+	for _, bookingId := range flagged {
+		set = append(set, map[string]interface{}{
+			"uid":               bookingId,
+			"booking.needsRoom": true,
+		})
+	}
+	if !input.Start.After(now) {
+		set = append(set, map[string]interface{}{
+			"uid":             id,
+			"room.shouldOpen": false,
+		})
+	}
+
+	mutData, err := json.Marshal(set)
+	if err != nil {
+		writeBlockError(w, http.StatusInternalServerError, err)
+		return
+	}
+	assigned, err := txn.Mutate(ctx, &api.Mutation{SetJson: mutData})
+	if err == nil {
+		err = txn.Commit(ctx)
+	}
+	if err != nil {
+		writeBlockError(w, http.StatusInternalServerError, err)
+		return
+	}
+	revokeBookingKeys(flagged)
+
+	readTxn := db.NewTxn()
+	defer readTxn.Discard(ctx)
+	block, err := getBlockFromDB(ctx, readTxn, assigned.GetUids()["block"])
+	if err != nil {
+		writeBlockError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(&RoomBlockResp{
+		Block:   block,
+		Flagged: flagged,
+	})
+}
+
+func getRoomBlocks(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	ctx := context.Background()
+	txn := db.NewTxn()
+	defer txn.Discard(ctx)
+
+	q := `query q($id: string) {
+            rooms(func: uid($id)) @filter(has(room)) {
+              ~block.room (orderasc: block.start) {
+                ` + blockFields + `
+              }
+            }
+          }`
+
+	resp, err := txn.QueryWithVars(ctx, q, map[string]string{"$id": id})
+	if err != nil {
+		writeBlockError(w, http.StatusInternalServerError, err)
+		return
+	}
+	var rooms struct {
+		Rooms []struct {
+			Blocks []*blockQuery `json:"~block.room"`
+		} `json:"rooms"`
+	}
+	err = json.Unmarshal(resp.GetJson(), &rooms)
+	if err != nil {
+		writeBlockError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	blocks := make([]*RoomBlock, 0)
+	for _, room := range rooms.Rooms {
+		for _, block := range room.Blocks {
+			blocks = append(blocks, block.toBlock())
+		}
+	}
+	json.NewEncoder(w).Encode(&RoomBlocksResp{
+		Blocks: blocks,
+	})
+}
+
+// endRoomBlock puts a room back in service now, or cancels a block that
+// hasn't started. Bookings it flagged stay flagged for staff to sort out.
+func endRoomBlock(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	claims, err := getAdminClaims(r)
+	if err != nil {
+		writeAdminAuthError(w, err)
+		return
+	}
+
+	ctx := context.Background()
+	txn := db.NewTxn()
+	defer txn.Discard(ctx)
+
+	block, err := getBlockFromDB(ctx, txn, id)
+	if err == errBlockNotFound {
+		writeBlockError(w, http.StatusNotFound, err)
+		return
+	} else if err != nil {
+		writeBlockError(w, http.StatusInternalServerError, err)
+		return
+	}
+	now := time.Now()
+	if !block.End.After(now) {
+		writeBlockError(w, http.StatusConflict, errors.New("block has already ended"))
+		return
+	}
+
+	end := now
+	if block.Start.After(now) {
+		end = block.Start
+	}
+	mutData, err := json.Marshal([]interface{}{
+		map[string]interface{}{
+			"uid":       id,
+			"block.end": end,
+		},
+		utils.NewAuditEntry("room.unblocked", claims.User.ID, block.RoomID, block.Reason),
+	})
+	if err != nil {
+		writeBlockError(w, http.StatusInternalServerError, err)
+		return
+	}
+	_, err = txn.Mutate(ctx, &api.Mutation{SetJson: mutData, CommitNow: true})
+	if err != nil {
+		writeBlockError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	block.End = end
+	json.NewEncoder(w).Encode(&RoomBlockResp{
+		Block: block,
+	})
+}
+
+// maintenanceOpen opens a room that's out of service for the maintenance
+// staff working on it, which guests can't do.
+func maintenanceOpen(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	claims, err := getAdminClaims(r)
+	if err != nil {
+		writeAdminAuthError(w, err)
+		return
+	}
+
+	rooms, err := getRoomFormDB(id)
+	if err != nil {
+		writeRoomError(w, http.StatusNotFound, err)
+		return
+	}
+	now := time.Now()
+	block := rooms.toRooms()[0].BlockAt(now)
+	if block == nil {
+		writeRoomError(w, http.StatusConflict, errors.New("room isn't out of service"))
+		return
+	}
+
+	unlock := &unlockNode{
+		Room: &uidRef{ID: id},
+		User: &uidRef{ID: claims.User.ID},
+		Time: now,
+	}
+	mutData, err := json.Marshal([]interface{}{
+		map[string]interface{}{
+			"uid":             id,
+			"room.shouldOpen": true,
+		},
+		unlock,
+		utils.NewAuditEntry("room.maintenance_opened", claims.User.ID, id, block.Reason),
+	})
+	if err != nil {
+		writeRoomError(w, http.StatusInternalServerError, err)
+		return
+	}
+	_, err = db.NewTxn().Mutate(context.Background(), &api.Mutation{SetJson: mutData, CommitNow: true})
+	if err != nil {
+		writeRoomError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(&OpenRoomResp{
+		Success: true,
+	})
+}
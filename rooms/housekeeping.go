@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/dgraph-io/dgo/protos/api"
+	"github.com/fluidmediaproductions/central_hotel_door_server/clients"
+	"github.com/fluidmediaproductions/central_hotel_door_server/utils"
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+)
+
+type HousekeepingChange = clients.HousekeepingChange
+
+var housekeepingRoles = []string{utils.RoleAdmin, utils.RoleFrontDesk, utils.RoleHousekeeping}
+
+var housekeepingStates = map[string]bool{
+	clients.HousekeepingDirty:      true,
+	clients.HousekeepingInProgress: true,
+	clients.HousekeepingClean:      true,
+	clients.HousekeepingInspected:  true,
+}
+
+// housekeepingState is the housekeeping state of a room with a stored
+// status, as rooms that have never been cleaned don't have one.
+func housekeepingState(status string) string {
+	if status == "" {
+		return clients.HousekeepingClean
+	}
+	return status
+}
+
+// housekeepingFilter builds the condition matching rooms in a housekeeping
+// state, adding the value it needs to the query's variables.
+func housekeepingFilter(status string, variables map[string]string) (string, error) {
+	if !housekeepingStates[status] {
+		return "", errors.Errorf("invalid housekeeping %q", status)
+	}
+	variables["$housekeeping"] = status
+	if status == clients.HousekeepingClean {
+		return "(eq(room.housekeeping, $housekeeping) OR NOT has(room.housekeeping))", nil
+	}
+	return "eq(room.housekeeping, $housekeeping)", nil
+}
+
+// setHousekeeping moves a room on to another housekeeping state, for the
+// front desk and housekeeping.
+func setHousekeeping(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	claims, err := utils.GetRequestJWT(r, jwtSecret)
+	if err != nil {
+		writeAdminAuthError(w, err)
+		return
+	}
+	if !claims.User.HasRole(housekeepingRoles...) {
+		writeRoomError(w, http.StatusForbidden, errors.New("only staff can change housekeeping"))
+		return
+	}
+
+	var change HousekeepingChange
+	err = json.NewDecoder(r.Body).Decode(&change)
+	r.Body.Close()
+	if err != nil || !housekeepingStates[change.Status] {
+		writeRoomError(w, http.StatusBadRequest, errors.New("bad request data"))
+		return
+	}
+
+	ctx := context.Background()
+	txn := db.NewTxn()
+	defer txn.Discard(ctx)
+
+	exists, err := nodeExists(ctx, txn, id, "room")
+	if err != nil {
+		writeRoomError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if !exists {
+		writeRoomError(w, http.StatusNotFound, errRoomNotFound)
+		return
+	}
+
+	mutData, err := json.Marshal([]interface{}{
+		map[string]interface{}{
+			"uid":                 id,
+			"room.housekeeping":   change.Status,
+			"room.housekeepingAt": time.Now(),
+		},
+		utils.NewAuditEntry("room.housekeeping", claims.User.ID, id, change.Status),
+	})
+	if err != nil {
+		writeRoomError(w, http.StatusInternalServerError, err)
+		return
+	}
+	_, err = txn.Mutate(ctx, &api.Mutation{SetJson: mutData, CommitNow: true})
+	if err != nil {
+		writeRoomError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	rooms, err := getRoomFormDB(id)
+	if err != nil {
+		writeRoomError(w, http.StatusInternalServerError, err)
+		return
+	}
+	json.NewEncoder(w).Encode(&RoomResp{
+		Room: rooms.toRooms()[0],
+	})
+}
@@ -11,39 +11,22 @@ import (
 	"github.com/dgraph-io/dgo/protos/api"
 	"context"
 	"github.com/pkg/errors"
+	"github.com/fluidmediaproductions/central_hotel_door_server/utils"
+	"github.com/fluidmediaproductions/central_hotel_door_server/clients"
+	"strings"
+	"time"
 )
 
 const addr = ":80"
 
 var db *dgo.Dgraph
+var jwtSecret []byte
 
-type Room struct {
-	ID string `json:"uid"`
-	Name       string `json:"name"`
-	Floor      string `json:"floor"`
-	HotelID    string   `json:"hotelId"`
-	ShouldOpen bool   `json:"shouldOpen"`
-}
-
-type RoomsResp struct {
-	Err   string  `json:"err"`
-	Rooms []*Room `json:"rooms"`
-}
-
-type RoomResp struct {
-	Err  string `json:"err"`
-	Room *Room  `json:"room"`
-}
-
-type OpenRoomResp struct {
-	Err     string `json:"err"`
-	Success bool   `json:"success"`
-}
-
-type OpenRoomSuccessResp struct {
-	Err     string `json:"err"`
-	Success bool   `json:"success"`
-}
+type Room = clients.Room
+type RoomsResp = clients.RoomsResp
+type RoomResp = clients.RoomResp
+type OpenRoomResp = clients.OpenRoomResp
+type OpenRoomSuccessResp = clients.OpenRoomSuccessResp
 
 type roomQuery struct {
 	Rooms []struct {
@@ -51,23 +34,67 @@ type roomQuery struct {
 		Name    string `json:"room.name"`
 		Floor    string `json:"room.floor"`
 		ShouldOpen    bool `json:"room.shouldOpen"`
+		Category    string `json:"room.category"`
+		Housekeeping    string `json:"room.housekeeping"`
+		HousekeepingAt    *time.Time `json:"room.housekeepingAt"`
+		Type  []*roomTypeQuery `json:"room.type"`
+		Blocks  []*blockQuery `json:"~block.room"`
+		ArchivedAt  *time.Time `json:"room.archivedAt"`
 		Hotel  []struct{
 			ID    string `json:"uid"`
 		} `json:"room.hotel"`
 	} `json:"rooms"`
 }
 
+// toRooms skips rooms that aren't linked to a hotel, which includes rooms
+// removed by a room.hotel filter.
+func (q *roomQuery) toRooms() []*Room {
+	outRooms := make([]*Room, 0)
+	for _, room := range q.Rooms {
+		if len(room.Hotel) == 0 {
+			continue
+		}
+		outRoom := &Room{
+			ID:             room.ID,
+			Name:           room.Name,
+			Floor:          room.Floor,
+			HotelID:        room.Hotel[0].ID,
+			Category:       room.Category,
+			ShouldOpen:     room.ShouldOpen,
+			ArchivedAt:     room.ArchivedAt,
+			Housekeeping:   housekeepingState(room.Housekeeping),
+			HousekeepingAt: room.HousekeepingAt,
+		}
+		if len(room.Type) > 0 {
+			outRoom.Type = room.Type[0].toRoomType()
+		}
+		for _, block := range room.Blocks {
+			outRoom.Blocks = append(outRoom.Blocks, block.toBlock())
+		}
+		outRooms = append(outRooms, outRoom)
+	}
+	return outRooms
+}
+
 func getRoomFormDB(id string) (*roomQuery, error) {
 	ctx := context.Background()
 	txn := db.NewTxn()
 	defer txn.Commit(ctx)
 
 	q := `query q($id: string) {
-            rooms(func: uid($id)) @filter(has(room)) @cascade {
+            rooms(func: uid($id)) @filter(has(room)) {
               uid
               room.name
               room.floor
               room.shouldOpen
+              room.category
+              room.housekeeping
+              room.housekeepingAt
+              room.type {
+                ` + roomTypeFields + `
+              }
+              ` + roomBlockFields(time.Now()) + `
+              room.archivedAt
               room.hotel {
                 uid
               }
@@ -84,7 +111,7 @@ func getRoomFormDB(id string) (*roomQuery, error) {
 		return nil, err
 	}
 
-	if len(rooms.Rooms) == 0 {
+	if len(rooms.toRooms()) == 0 {
 		return nil, errors.New("room not found")
 	}
 
@@ -92,26 +119,63 @@ func getRoomFormDB(id string) (*roomQuery, error) {
 }
 
 func getRooms(w http.ResponseWriter, r *http.Request) {
+	page, err := utils.ParsePage(r.URL.Query())
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(&RoomsResp{
+			Err:  err.Error(),
+			Code: utils.CodeBadRequest,
+		})
+		return
+	}
+
 	ctx := context.Background()
 	txn := db.NewTxn()
 
-	q := `query {
-            rooms(func: has(room)) @cascade {
+	variables := map[string]string{}
+	filter, err := archivedFilter(r)
+	if err != nil {
+		writeAdminAuthError(w, err)
+		return
+	}
+	blocks, conds, err := roomListFilter(r.URL.Query(), variables)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(&RoomsResp{
+			Err:  err.Error(),
+			Code: utils.CodeBadRequest,
+		})
+		return
+	}
+	filter = append(filter, conds...)
+
+	q := utils.QueryHeader(variables) + ` {
+            ` + blocks + `
+            rooms(func: has(room)` + page.Args() + `) ` + roomFilter(filter) + ` {
               uid
               room.name
               room.floor
               room.shouldOpen
+              room.category
+              room.housekeeping
+              room.housekeepingAt
+              room.type {
+                ` + roomTypeFields + `
+              }
+              ` + roomBlockFields(time.Now()) + `
+              room.archivedAt
               room.hotel {
                 uid
               }
 	        }
           }`
 
-	resp, err := txn.Query(ctx, q)
+	resp, err := txn.QueryWithVars(ctx, q, variables)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(&RoomsResp{
-			Err: err.Error(),
+			Err:  err.Error(),
+			Code: utils.CodeInternal,
 		})
 		return
 	}
@@ -120,24 +184,90 @@ func getRooms(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(&RoomsResp{
-			Err: err.Error(),
+			Err:  err.Error(),
+			Code: utils.CodeInternal,
 		})
 		return
 	}
 
-	outRooms:= make([]*Room, 0)
-	for _, room := range rooms.Rooms {
-		outRoom := &Room{
-			ID:         room.ID,
-			Name:       room.Name,
-			Floor: room.Floor,
-			HotelID: room.Hotel[0].ID,
-		}
-		outRooms = append(outRooms, outRoom)
+	count, hasNext := page.Limit(len(rooms.Rooms))
+	rooms.Rooms = rooms.Rooms[:count]
+	lastID := ""
+	if count > 0 {
+		lastID = rooms.Rooms[count-1].ID
+	}
+	outRooms := rooms.toRooms()
+
+	json.NewEncoder(w).Encode(&RoomsResp{
+		Rooms:    outRooms,
+		PageInfo: utils.NewPageInfo(hasNext, lastID),
+	})
+}
+
+// getRoomsBatch fetches the rooms in the ids query parameter, skipping any
+// that don't exist.
+func getRoomsBatch(w http.ResponseWriter, r *http.Request) {
+	ids, err := utils.ParseUIDs(r.URL.Query().Get("ids"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(&RoomsResp{
+			Err:  err.Error(),
+			Code: utils.CodeBadRequest,
+		})
+		return
+	}
+	if len(ids) == 0 {
+		json.NewEncoder(w).Encode(&RoomsResp{
+			Rooms: make([]*Room, 0),
+		})
+		return
+	}
+
+	ctx := context.Background()
+	txn := db.NewTxn()
+
+	q := `{
+            rooms(func: uid(` + strings.Join(ids, ", ") + `)) @filter(has(room)) {
+              uid
+              room.name
+              room.floor
+              room.shouldOpen
+              room.category
+              room.housekeeping
+              room.housekeepingAt
+              room.type {
+                ` + roomTypeFields + `
+              }
+              ` + roomBlockFields(time.Now()) + `
+              room.archivedAt
+              room.hotel {
+                uid
+              }
+	        }
+          }`
+
+	resp, err := txn.Query(ctx, q)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(&RoomsResp{
+			Err:  err.Error(),
+			Code: utils.CodeInternal,
+		})
+		return
+	}
+	var rooms roomQuery
+	err = json.Unmarshal(resp.GetJson(), &rooms)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(&RoomsResp{
+			Err:  err.Error(),
+			Code: utils.CodeInternal,
+		})
+		return
 	}
 
 	json.NewEncoder(w).Encode(&RoomsResp{
-		Rooms: outRooms,
+		Rooms: rooms.toRooms(),
 	})
 }
 
@@ -151,21 +281,14 @@ func getRoom(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(&RoomResp{
-			Err: err.Error(),
+			Err:  err.Error(),
+			Code: utils.CodeInternal,
 		})
 		return
 	}
 
-	room := rooms.Rooms[0]
-	outRoom := &Room{
-		ID:         room.ID,
-		Name:       room.Name,
-		Floor: room.Floor,
-		HotelID: room.Hotel[0].ID,
-	}
-
 	json.NewEncoder(w).Encode(&RoomResp{
-		Room: outRoom,
+		Room: rooms.toRooms()[0],
 	})
 }
 
@@ -174,29 +297,56 @@ func getRoomsByHotel(w http.ResponseWriter, r *http.Request) {
 
 	id := vars["id"]
 
+	filter, err := archivedFilter(r)
+	if err != nil {
+		writeAdminAuthError(w, err)
+		return
+	}
+	variables := map[string]string{"$id": id}
+	blocks, conds, err := roomListFilter(r.URL.Query(), variables)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(&RoomsResp{
+			Err:  err.Error(),
+			Code: utils.CodeBadRequest,
+		})
+		return
+	}
+	filter = append(filter, conds...)
+
 	ctx := context.Background()
 	txn := db.NewTxn()
 
-	q := `query q($id: string) {
+	q := utils.QueryHeader(variables) + ` {
             var (func: uid($id)) {
               u as uid
 	        }
-            rooms(func: has(room)) @cascade {
+            ` + blocks + `
+            rooms(func: has(room)) ` + roomFilter(filter) + ` {
               uid
               room.name
               room.floor
               room.shouldOpen
+              room.category
+              room.housekeeping
+              room.housekeepingAt
+              room.type {
+                ` + roomTypeFields + `
+              }
+              ` + roomBlockFields(time.Now()) + `
+              room.archivedAt
               room.hotel @filter(uid(u)) {
                 uid
               }
 	        }
           }`
 
-	resp, err := txn.QueryWithVars(ctx, q, map[string]string{"$id": id})
+	resp, err := txn.QueryWithVars(ctx, q, variables)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(&RoomResp{
-			Err: err.Error(),
+			Err:  err.Error(),
+			Code: utils.CodeInternal,
 		})
 		return
 	}
@@ -205,24 +355,14 @@ func getRoomsByHotel(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(&RoomResp{
-			Err: err.Error(),
+			Err:  err.Error(),
+			Code: utils.CodeInternal,
 		})
 		return
 	}
 
-	outRooms:= make([]*Room, 0)
-	for _, room := range rooms.Rooms {
-		outRoom := &Room{
-			ID:         room.ID,
-			Name:       room.Name,
-			Floor: room.Floor,
-			HotelID: room.Hotel[0].ID,
-		}
-		outRooms = append(outRooms, outRoom)
-	}
-
 	json.NewEncoder(w).Encode(&RoomsResp{
-		Rooms: outRooms,
+		Rooms: rooms.toRooms(),
 	})
 }
 
@@ -235,7 +375,18 @@ func openRoom(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(&OpenRoomResp{
-			Err: err.Error(),
+			Err:  err.Error(),
+			Code: utils.CodeInternal,
+		})
+		return
+	}
+
+	now := time.Now()
+	if rooms.toRooms()[0].BlockAt(now) != nil {
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(&OpenRoomResp{
+			Err:  "room is out of service",
+			Code: utils.CodeRoomOutOfService,
 		})
 		return
 	}
@@ -250,24 +401,27 @@ func openRoom(w http.ResponseWriter, r *http.Request) {
 	mutation.ID = rooms.Rooms[0].ID
 	mutation.ShouldOpen = true
 
-	mutData, err := json.Marshal(&mutation)
+	mutData, err := json.Marshal([]interface{}{&mutation, newUnlockNode(mutation.ID, r)})
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(&OpenRoomResp{
-			Err: err.Error(),
+			Err:  err.Error(),
+			Code: utils.CodeInternal,
 		})
 		return
 	}
 
 	mu := &api.Mutation{
-		SetJson: mutData,
+		SetJson:   mutData,
+		CommitNow: true,
 	}
 
 	_, err = txn.Mutate(ctx, mu)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(&OpenRoomResp{
-			Err: err.Error(),
+			Err:  err.Error(),
+			Code: utils.CodeInternal,
 		})
 		return
 	}
@@ -286,7 +440,8 @@ func openRoomSuccess(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(&OpenRoomSuccessResp{
-			Err: err.Error(),
+			Err:  err.Error(),
+			Code: utils.CodeInternal,
 		})
 		return
 	}
@@ -305,20 +460,23 @@ func openRoomSuccess(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(&OpenRoomSuccessResp{
-			Err: err.Error(),
+			Err:  err.Error(),
+			Code: utils.CodeInternal,
 		})
 		return
 	}
 
 	mu := &api.Mutation{
-		SetJson: mutData,
+		SetJson:   mutData,
+		CommitNow: true,
 	}
 
 	_, err = txn.Mutate(ctx, mu)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(&OpenRoomSuccessResp{
-			Err: err.Error(),
+			Err:  err.Error(),
+			Code: utils.CodeInternal,
 		})
 		return
 	}
@@ -332,10 +490,28 @@ func router() *mux.Router {
 	r := mux.NewRouter()
 
 	r.Methods("GET").Path("/rooms").HandlerFunc(getRooms)
+	r.Methods("GET").Path("/rooms/batch").HandlerFunc(getRoomsBatch)
+	r.Methods("POST").Path("/rooms").HandlerFunc(createRoom)
 	r.Methods("GET").Path("/rooms/{id}").HandlerFunc(getRoom)
+	r.Methods("PUT").Path("/rooms/{id}").HandlerFunc(updateRoom)
+	r.Methods("POST").Path("/rooms/{id}/archive").HandlerFunc(archiveRoom)
 	r.Methods("GET").Path("/rooms/by-hotel/{id}").HandlerFunc(getRoomsByHotel)
+	r.Methods("POST").Path("/room-types").HandlerFunc(createRoomType)
+	r.Methods("GET").Path("/room-types/by-hotel/{id}").HandlerFunc(getRoomTypesByHotel)
+	r.Methods("GET").Path("/room-types/{id}").HandlerFunc(getRoomType)
+	r.Methods("PUT").Path("/room-types/{id}").HandlerFunc(updateRoomType)
+	r.Methods("GET").Path("/room-types/{id}/rates").HandlerFunc(getRatePlan)
+	r.Methods("PUT").Path("/room-types/{id}/rates").HandlerFunc(setRatePlan)
+	r.Methods("GET").Path("/room-types/{id}/quote").HandlerFunc(getQuote)
 	r.Methods("GET").Path("/rooms/{id}/open").HandlerFunc(openRoom)
 	r.Methods("GET").Path("/rooms/{id}/open-success").HandlerFunc(openRoomSuccess)
+	r.Methods("GET").Path("/rooms/{id}/unlocks").HandlerFunc(getRoomUnlocks)
+	r.Methods("GET").Path("/rooms/{id}/blocks").HandlerFunc(getRoomBlocks)
+	r.Methods("POST").Path("/rooms/{id}/blocks").HandlerFunc(createRoomBlock)
+	r.Methods("POST").Path("/rooms/{id}/maintenance-open").HandlerFunc(maintenanceOpen)
+	r.Methods("POST").Path("/rooms/{id}/housekeeping").HandlerFunc(setHousekeeping)
+	r.Methods("POST").Path("/blocks/{id}/end").HandlerFunc(endRoomBlock)
+	r.Methods("GET").Path("/unlocks/by-user/{id}").HandlerFunc(getUserUnlocks)
 
 	return r
 }
@@ -355,10 +531,48 @@ func setup(c *dgo.Dgraph) {
 	err := c.Alter(context.Background(), &api.Operation{
 		Schema: `
 			room.name: string .
-			room.floor: string .
+			room.floor: string @index(exact) .
 			room.shouldOpen: bool .
+			room.category: string @index(exact) .
+			room.type: uid @reverse .
+			roomType.name: string @index(exact) .
+			roomType.hotel: uid @reverse .
+			roomType.capacity: int @index(int) .
+			roomType.beds: string .
+			roomType.amenities: [string] @index(exact) .
+			roomType.accessibility: [string] @index(exact) .
+			roomType.ratePlan: uid .
+			ratePlan.roomType: uid @reverse .
+			ratePlan.currency: string .
+			ratePlan.nightly: int .
+			ratePlan.minStay: int .
+			ratePlan.seasons: uid .
+			ratePlan.taxes: uid .
+			ratePlan.createdAt: dateTime .
+			ratePlan.createdBy: uid .
+			season.name: string .
+			season.from: string .
+			season.to: string .
+			season.nightly: int .
+			season.minStay: int .
+			tax.name: string .
+			tax.percent: float .
 			room.hotel: uid @reverse .
-		`,
+			room.archivedAt: dateTime .
+			room.housekeeping: string @index(exact) .
+			room.housekeepingAt: dateTime .
+			block.room: uid @reverse .
+			block.start: dateTime @index(hour) .
+			block.end: dateTime @index(hour) .
+			block.reason: string .
+			block.createdBy: uid .
+			unlock.room: uid @reverse .
+			unlock.user: uid @reverse .
+			unlock.booking: uid @reverse .
+			unlock.guest: uid @reverse .
+			unlock.shift: uid @reverse .
+			unlock.time: dateTime @index(hour) .
+		` + utils.AuditSchema,
 	})
 	if err != nil {
 		log.Fatalf("Error setting up schema: %v\n", err)
@@ -372,6 +586,7 @@ func main() {
 	viper.AutomaticEnv()
 
 	dbHost := viper.GetString("DB_HOST")
+	jwtSecret = []byte(viper.GetString("JWT_SECRET"))
 
 	db = newDbClient(dbHost)
 
@@ -2,600 +2,333 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
-	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
-	"regexp"
 	"strings"
 	"testing"
-	"time"
 
+	"github.com/dgraph-io/dgo"
+	"github.com/dgraph-io/dgo/protos/api"
+	"github.com/fluidmediaproductions/central_hotel_door_server/clients"
 	"github.com/fluidmediaproductions/central_hotel_door_server/utils"
-	"github.com/jinzhu/gorm"
-	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+	"google.golang.org/grpc"
 )
 
-func fixedFullRe(s string) string {
-	return fmt.Sprintf("^%s$", regexp.QuoteMeta(s))
+// fakeDgraph stands in for a Dgraph server. Each query is answered with the
+// JSON of the first expectation whose text it contains, and mutations are
+// recorded for the test to look at.
+type fakeDgraph struct {
+	api.DgraphClient
+	t         *testing.T
+	queries   []*fakeQuery
+	mutations []*api.Mutation
+	commits   int
+	mutateErr error
 }
 
-func newDB(t *testing.T) (sqlmock.Sqlmock, *gorm.DB) {
-	db, mock, err := sqlmock.New()
-	if err != nil {
-		t.Fatalf("can't create sqlmock: %s", err)
-	}
-
-	gormDB, gerr := gorm.Open("mysql", db)
-	if gerr != nil {
-		t.Fatalf("can't open gorm connection: %s", err)
-	}
-
-	return mock, gormDB.Set("gorm:update_column", true)
+type fakeQuery struct {
+	contains string
+	json     string
+	err      error
 }
 
-func getRowsForRooms(rooms []*Room) *sqlmock.Rows {
-	var roomFieldNames = []string{"id", "name", "floor", "hotel_id", "door_id", "should_open", "created_at", "updated_at", "deleted_at"}
-	rows := sqlmock.NewRows(roomFieldNames)
-	for _, r := range rooms {
-		rows = rows.AddRow(r.ID, r.Name, r.Floor, r.HotelID, r.DoorID, r.ShouldOpen, r.CreatedAt, r.UpdatedAt, r.DeletedAt)
-	}
-	return rows
+func (f *fakeDgraph) expectQuery(contains string, json string) {
+	f.queries = append(f.queries, &fakeQuery{contains: contains, json: json})
 }
 
-func TestGetRooms(t *testing.T) {
-	sqlMock, dbMock := newDB(t)
-
-	oldDb := db
-	db = dbMock
-
-	req := httptest.NewRequest("GET", "http://a/rooms", nil)
-	w := httptest.NewRecorder()
-
-	rooms := []*Room{
-		{
-			Model: gorm.Model{
-				ID:        uint(1),
-				CreatedAt: time.Now(),
-				UpdatedAt: time.Now(),
-			},
-			Name:  "1",
-			Floor: "1",
-		},
-	}
-
-	sqlMock.ExpectQuery(fixedFullRe("SELECT * FROM `rooms` WHERE `rooms`.`deleted_at` IS NULL")).
-		WillReturnRows(getRowsForRooms(rooms))
-
-	router().ServeHTTP(w, req)
-
-	resp := w.Result()
-	body, _ := ioutil.ReadAll(resp.Body)
-
-	expBody := &bytes.Buffer{}
-	err := json.NewEncoder(expBody).Encode(&RoomsResp{
-		Rooms: rooms,
-	})
-	if err != nil {
-		t.Fatalf("Error creating test JSON: %v", err)
-	}
+func (f *fakeDgraph) failQuery(contains string, err error) {
+	f.queries = append(f.queries, &fakeQuery{contains: contains, err: err})
+}
 
-	if string(body) != string(expBody.Bytes()) {
-		t.Errorf("Response not what was expected, got %s wanted %s", string(body), string(expBody.Bytes()))
+func (f *fakeDgraph) Query(ctx context.Context, in *api.Request, opts ...grpc.CallOption) (*api.Response, error) {
+	for _, query := range f.queries {
+		if strings.Contains(in.Query, query.contains) {
+			if query.err != nil {
+				return nil, query.err
+			}
+			return &api.Response{Json: []byte(query.json)}, nil
+		}
 	}
+	f.t.Errorf("Unexpected query %s", in.Query)
+	return nil, errors.New("unexpected query")
+}
 
-	req = httptest.NewRequest("GET", "http://a/rooms", nil)
-	w = httptest.NewRecorder()
-
-	sqlMock.ExpectQuery(fixedFullRe("SELECT * FROM `rooms` WHERE `rooms`.`deleted_at` IS NULL")).
-		WillReturnError(errors.New("foobar"))
-
-	router().ServeHTTP(w, req)
-
-	resp = w.Result()
-	body, _ = ioutil.ReadAll(resp.Body)
-
-	if resp.StatusCode != http.StatusInternalServerError {
-		t.Errorf("Expected 500 error got %s", resp.Status)
+func (f *fakeDgraph) Mutate(ctx context.Context, in *api.Mutation, opts ...grpc.CallOption) (*api.Assigned, error) {
+	f.mutations = append(f.mutations, in)
+	if f.mutateErr != nil {
+		return nil, f.mutateErr
 	}
-
-	expBody = &bytes.Buffer{}
-	err = json.NewEncoder(expBody).Encode(&RoomsResp{
-		Err: "foobar",
-	})
-	if err != nil {
-		t.Fatalf("Error creating test JSON: %v", err)
+	if in.CommitNow {
+		f.commits++
 	}
+	// Handing back a key makes the client commit through CommitOrAbort
+	return &api.Assigned{
+		Uids:    map[string]string{},
+		Context: &api.TxnContext{Keys: []string{"room"}},
+	}, nil
+}
 
-	if string(body) != string(expBody.Bytes()) {
-		t.Errorf("Response not what was expected, got %s wanted %s", string(body), string(expBody.Bytes()))
+func (f *fakeDgraph) CommitOrAbort(ctx context.Context, in *api.TxnContext, opts ...grpc.CallOption) (*api.TxnContext, error) {
+	if !in.Aborted {
+		f.commits++
 	}
-
-	db = oldDb
+	return in, nil
 }
 
-func TestGetRoom(t *testing.T) {
-	sqlMock, dbMock := newDB(t)
-
+// useFakeDB points the service at a fake Dgraph until the returned func is
+// called.
+func useFakeDB(t *testing.T) (*fakeDgraph, func()) {
+	fake := &fakeDgraph{t: t}
 	oldDb := db
-	db = dbMock
-
-	req := httptest.NewRequest("GET", "http://a/rooms/1", nil)
-	w := httptest.NewRecorder()
-
-	room := &Room{
-		Model: gorm.Model{
-			ID:        uint(1),
-			CreatedAt: time.Now(),
-			UpdatedAt: time.Now(),
-		},
-		Name:  "1",
-		Floor: "1",
+	db = dgo.NewDgraphClient(fake)
+	return fake, func() {
+		db = oldDb
 	}
+}
 
-	sqlMock.ExpectQuery(fixedFullRe("SELECT * FROM `rooms` WHERE `rooms`.`deleted_at` IS NULL AND ((`rooms`.`id` = 1))")).
-		WillReturnRows(getRowsForRooms([]*Room{room}))
-
+func doRequest(method string, url string) (*http.Response, []byte) {
+	req := httptest.NewRequest(method, url, nil)
+	w := httptest.NewRecorder()
 	router().ServeHTTP(w, req)
 
 	resp := w.Result()
 	body, _ := ioutil.ReadAll(resp.Body)
+	return resp, body
+}
 
+func encodeResp(t *testing.T, v interface{}) string {
 	expBody := &bytes.Buffer{}
-	err := json.NewEncoder(expBody).Encode(&RoomResp{
-		Room: room,
-	})
+	err := json.NewEncoder(expBody).Encode(v)
 	if err != nil {
 		t.Fatalf("Error creating test JSON: %v", err)
 	}
+	return expBody.String()
+}
 
-	if string(body) != string(expBody.Bytes()) {
-		t.Errorf("Response not what was expected, got %s wanted %s", string(body), string(expBody.Bytes()))
-	}
-
-	req = httptest.NewRequest("GET", "http://a/rooms/1", nil)
-	w = httptest.NewRecorder()
+const testRoomsJSON = `{
+	"rooms": [
+		{
+			"uid": "0x10",
+			"room.name": "101",
+			"room.floor": "1",
+			"room.hotel": [{"uid": "0x1"}]
+		},
+		{
+			"uid": "0x11",
+			"room.name": "102",
+			"room.floor": "1"
+		}
+	]
+}`
 
-	sqlMock.ExpectQuery(fixedFullRe("SELECT * FROM `rooms` WHERE `rooms`.`deleted_at` IS NULL AND ((`rooms`.`id` = 1))")).
-		WillReturnRows(getRowsForRooms([]*Room{}))
+func testRoom() *Room {
+	return &Room{
+		ID:           "0x10",
+		Name:         "101",
+		Floor:        "1",
+		HotelID:      "0x1",
+		Housekeeping: clients.HousekeepingClean,
+	}
+}
 
-	router().ServeHTTP(w, req)
+func TestGetRooms(t *testing.T) {
+	fake, restore := useFakeDB(t)
+	defer restore()
 
-	resp = w.Result()
-	body, _ = ioutil.ReadAll(resp.Body)
+	fake.expectQuery("rooms(func: has(room)", testRoomsJSON)
+	resp, body := doRequest("GET", "http://a/rooms")
 
-	expBody = &bytes.Buffer{}
-	err = json.NewEncoder(expBody).Encode(&RoomResp{
-		Err: "room not found",
+	// The second room isn't linked to a hotel, so it's left out, but the
+	// cursor still goes past it
+	expBody := encodeResp(t, &RoomsResp{
+		Rooms:    []*Room{testRoom()},
+		PageInfo: utils.NewPageInfo(false, "0x11"),
 	})
-	if err != nil {
-		t.Fatalf("Error creating test JSON: %v", err)
+	if resp.StatusCode != http.StatusOK || string(body) != expBody {
+		t.Errorf("Response not what was expected, got %s %s wanted %s", resp.Status, string(body), expBody)
 	}
 
-	if string(body) != string(expBody.Bytes()) {
-		t.Errorf("Response not what was expected, got %s wanted %s", string(body), string(expBody.Bytes()))
+	resp, body = doRequest("GET", "http://a/rooms?first=1")
+	expBody = encodeResp(t, &RoomsResp{
+		Rooms:    []*Room{testRoom()},
+		PageInfo: utils.NewPageInfo(true, "0x10"),
+	})
+	if resp.StatusCode != http.StatusOK || string(body) != expBody {
+		t.Errorf("Response not what was expected, got %s %s wanted %s", resp.Status, string(body), expBody)
 	}
 
-	req = httptest.NewRequest("GET", "http://a/rooms/1", nil)
-	w = httptest.NewRecorder()
-
-	sqlMock.ExpectQuery(fixedFullRe("SELECT * FROM `rooms` WHERE `rooms`.`deleted_at` IS NULL AND ((`rooms`.`id` = 1))")).
-		WillReturnError(errors.New("foobar"))
-
-	router().ServeHTTP(w, req)
+	fake.queries = nil
+	fake.failQuery("rooms(func: has(room)", errors.New("foobar"))
+	resp, body = doRequest("GET", "http://a/rooms")
 
-	resp = w.Result()
-	body, _ = ioutil.ReadAll(resp.Body)
-
-	expBody = &bytes.Buffer{}
-	err = json.NewEncoder(expBody).Encode(&RoomResp{
-		Err: "foobar",
+	expBody = encodeResp(t, &RoomsResp{
+		Err:  "foobar",
+		Code: utils.CodeInternal,
 	})
-	if err != nil {
-		t.Fatalf("Error creating test JSON: %v", err)
+	if resp.StatusCode != http.StatusInternalServerError || string(body) != expBody {
+		t.Errorf("Expected 500 error, got %s %s", resp.Status, string(body))
 	}
 
-	if string(body) != string(expBody.Bytes()) {
-		t.Errorf("Response not what was expected, got %s wanted %s", string(body), string(expBody.Bytes()))
+	resp, _ = doRequest("GET", "http://a/rooms?archived=include")
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("Expected 403 error listing archived rooms without a JWT, got %s", resp.Status)
 	}
-
-	db = oldDb
 }
 
-func TestGetRoomByHotel(t *testing.T) {
-	sqlMock, dbMock := newDB(t)
-
-	oldDb := db
-	db = dbMock
+func TestGetRoom(t *testing.T) {
+	fake, restore := useFakeDB(t)
+	defer restore()
 
-	req := httptest.NewRequest("GET", "http://a/rooms/by-hotel/1", nil)
-	w := httptest.NewRecorder()
+	fake.expectQuery("rooms(func: uid($id))", testRoomsJSON)
+	resp, body := doRequest("GET", "http://a/rooms/0x10")
 
-	rooms := []*Room{
-		{
-			Model: gorm.Model{
-				ID:        uint(1),
-				CreatedAt: time.Now(),
-				UpdatedAt: time.Now(),
-			},
-			Name:    "1",
-			Floor:   "1",
-			HotelID: 1,
-		},
+	expBody := encodeResp(t, &RoomResp{
+		Room: testRoom(),
+	})
+	if resp.StatusCode != http.StatusOK || string(body) != expBody {
+		t.Errorf("Response not what was expected, got %s %s wanted %s", resp.Status, string(body), expBody)
 	}
 
-	sqlMock.ExpectQuery(fixedFullRe("SELECT * FROM `rooms` WHERE `rooms`.`deleted_at` IS NULL AND ((`rooms`.`hotel_id` = ?))")).
-		WithArgs(1).
-		WillReturnRows(getRowsForRooms(rooms))
+	fake.queries = nil
+	fake.expectQuery("rooms(func: uid($id))", `{"rooms": []}`)
+	resp, body = doRequest("GET", "http://a/rooms/0x12")
 
-	router().ServeHTTP(w, req)
-
-	resp := w.Result()
-	body, _ := ioutil.ReadAll(resp.Body)
-
-	expBody := &bytes.Buffer{}
-	err := json.NewEncoder(expBody).Encode(&RoomsResp{
-		Rooms: rooms,
+	expBody = encodeResp(t, &RoomResp{
+		Err:  "room not found",
+		Code: utils.CodeInternal,
 	})
-	if err != nil {
-		t.Fatalf("Error creating test JSON: %v", err)
-	}
-
-	if string(body) != string(expBody.Bytes()) {
-		t.Errorf("Response not what was expected, got %s wanted %s", string(body), string(expBody.Bytes()))
+	if resp.StatusCode != http.StatusInternalServerError || string(body) != expBody {
+		t.Errorf("Expected room not found, got %s %s", resp.Status, string(body))
 	}
 
-	req = httptest.NewRequest("GET", "http://a/rooms/by-hotel/1", nil)
-	w = httptest.NewRecorder()
+	fake.queries = nil
+	fake.failQuery("rooms(func: uid($id))", errors.New("foobar"))
+	resp, body = doRequest("GET", "http://a/rooms/0x10")
 
-	sqlMock.ExpectQuery(fixedFullRe("SELECT * FROM `rooms` WHERE `rooms`.`deleted_at` IS NULL AND ((`rooms`.`hotel_id` = ?))")).
-		WithArgs(1).
-		WillReturnError(errors.New("foobar"))
-
-	router().ServeHTTP(w, req)
-
-	resp = w.Result()
-	body, _ = ioutil.ReadAll(resp.Body)
-
-	expBody = &bytes.Buffer{}
-	err = json.NewEncoder(expBody).Encode(&RoomsResp{
-		Err: "foobar",
+	expBody = encodeResp(t, &RoomResp{
+		Err:  "foobar",
+		Code: utils.CodeInternal,
 	})
-	if err != nil {
-		t.Fatalf("Error creating test JSON: %v", err)
+	if resp.StatusCode != http.StatusInternalServerError || string(body) != expBody {
+		t.Errorf("Expected 500 error, got %s %s", resp.Status, string(body))
 	}
-
-	if string(body) != string(expBody.Bytes()) {
-		t.Errorf("Response not what was expected, got %s wanted %s", string(body), string(expBody.Bytes()))
-	}
-
-	db = oldDb
 }
 
-func TestOpenRoom(t *testing.T) {
-	sqlMock, dbMock := newDB(t)
-
-	oldDb := db
-	db = dbMock
-
-	req := httptest.NewRequest("GET", "http://a/rooms/1/open", nil)
-	w := httptest.NewRecorder()
-
-	sqlMock.ExpectQuery(fixedFullRe("SELECT * FROM `rooms` WHERE `rooms`.`deleted_at` IS NULL AND ((`rooms`.`id` = 1))")).
-		WillReturnRows(getRowsForRooms([]*Room{}))
-
-	router().ServeHTTP(w, req)
+func TestGetRoomByHotel(t *testing.T) {
+	fake, restore := useFakeDB(t)
+	defer restore()
 
-	resp := w.Result()
-	body, _ := ioutil.ReadAll(resp.Body)
+	fake.expectQuery("room.hotel @filter(uid(u))", testRoomsJSON)
+	resp, body := doRequest("GET", "http://a/rooms/by-hotel/0x1")
 
-	expBody := &bytes.Buffer{}
-	err := json.NewEncoder(expBody).Encode(&OpenRoomResp{
-		Err: "room not found",
+	expBody := encodeResp(t, &RoomsResp{
+		Rooms: []*Room{testRoom()},
 	})
-	if err != nil {
-		t.Fatalf("Error creating test JSON: %v", err)
+	if resp.StatusCode != http.StatusOK || string(body) != expBody {
+		t.Errorf("Response not what was expected, got %s %s wanted %s", resp.Status, string(body), expBody)
 	}
 
-	if string(body) != string(expBody.Bytes()) {
-		t.Errorf("Response not what was expected, got %s wanted %s", string(body), string(expBody.Bytes()))
-	}
+	fake.queries = nil
+	fake.failQuery("room.hotel @filter(uid(u))", errors.New("foobar"))
+	resp, body = doRequest("GET", "http://a/rooms/by-hotel/0x1")
 
-	req = httptest.NewRequest("GET", "http://a/rooms/1/open", nil)
-	w = httptest.NewRecorder()
-
-	sqlMock.ExpectQuery(fixedFullRe("SELECT * FROM `rooms` WHERE `rooms`.`deleted_at` IS NULL AND ((`rooms`.`id` = 1))")).
-		WillReturnError(errors.New("foobar"))
-
-	router().ServeHTTP(w, req)
-
-	resp = w.Result()
-	body, _ = ioutil.ReadAll(resp.Body)
-
-	expBody = &bytes.Buffer{}
-	err = json.NewEncoder(expBody).Encode(&OpenRoomResp{
-		Err: "foobar",
+	expBody = encodeResp(t, &RoomResp{
+		Err:  "foobar",
+		Code: utils.CodeInternal,
 	})
-	if err != nil {
-		t.Fatalf("Error creating test JSON: %v", err)
+	if resp.StatusCode != http.StatusInternalServerError || string(body) != expBody {
+		t.Errorf("Expected 500 error, got %s %s", resp.Status, string(body))
 	}
+}
 
-	if string(body) != string(expBody.Bytes()) {
-		t.Errorf("Response not what was expected, got %s wanted %s", string(body), string(expBody.Bytes()))
-	}
-
-	req = httptest.NewRequest("GET", "http://a/rooms/1/open", nil)
-	w = httptest.NewRecorder()
-
-	room := &Room{
-		Model: gorm.Model{
-			ID:        uint(1),
-			CreatedAt: time.Now(),
-			UpdatedAt: time.Now(),
-		},
-		Name:    "1",
-		Floor:   "1",
-		HotelID: 1,
-	}
-
-	sqlMock.ExpectQuery(fixedFullRe("SELECT * FROM `rooms` WHERE `rooms`.`deleted_at` IS NULL AND ((`rooms`.`id` = 1))")).
-		WillReturnRows(getRowsForRooms([]*Room{room}))
-
-	router().ServeHTTP(w, req)
+func TestOpenRoom(t *testing.T) {
+	fake, restore := useFakeDB(t)
+	defer restore()
 
-	resp = w.Result()
-	body, _ = ioutil.ReadAll(resp.Body)
+	fake.expectQuery("rooms(func: uid($id))", `{"rooms": []}`)
+	resp, body := doRequest("GET", "http://a/rooms/0x12/open")
 
-	expBody = &bytes.Buffer{}
-	err = json.NewEncoder(expBody).Encode(&OpenRoomResp{
-		Err: "no auth header",
+	expBody := encodeResp(t, &OpenRoomResp{
+		Err:  "room not found",
+		Code: utils.CodeInternal,
 	})
-	if err != nil {
-		t.Fatalf("Error creating test JSON: %v", err)
+	if string(body) != expBody {
+		t.Errorf("Response not what was expected, got %s wanted %s", string(body), expBody)
 	}
-
-	if string(body) != string(expBody.Bytes()) {
-		t.Errorf("Response not what was expected, got %s wanted %s", string(body), string(expBody.Bytes()))
+	if len(fake.mutations) != 0 {
+		t.Errorf("Expected no mutations for a missing room, got %d", len(fake.mutations))
 	}
 
-	req = httptest.NewRequest("GET", "http://a/rooms/1/open", nil)
-	req.Header.Set("Authorization", "Bearer bla")
-	w = httptest.NewRecorder()
-
-	sqlMock.ExpectQuery(fixedFullRe("SELECT * FROM `rooms` WHERE `rooms`.`deleted_at` IS NULL AND ((`rooms`.`id` = 1))")).
-		WillReturnRows(getRowsForRooms([]*Room{room}))
-
-	router().ServeHTTP(w, req)
+	fake.queries = nil
+	fake.failQuery("rooms(func: uid($id))", errors.New("foobar"))
+	resp, body = doRequest("GET", "http://a/rooms/0x10/open")
 
-	resp = w.Result()
-	body, _ = ioutil.ReadAll(resp.Body)
-
-	expBody = &bytes.Buffer{}
-	err = json.NewEncoder(expBody).Encode(&OpenRoomResp{
-		Err: "token contains an invalid number of segments",
+	expBody = encodeResp(t, &OpenRoomResp{
+		Err:  "foobar",
+		Code: utils.CodeInternal,
 	})
-	if err != nil {
-		t.Fatalf("Error creating test JSON: %v", err)
-	}
-
-	if string(body) != string(expBody.Bytes()) {
-		t.Errorf("Response not what was expected, got %s wanted %s", string(body), string(expBody.Bytes()))
-	}
-
-	user := &utils.User{
-		Model: gorm.Model{
-			ID: 1,
-		},
-		Name: "Bob",
-	}
-	jwt, err := utils.NewJWT(user)
-	if err != nil {
-		t.Fatalf("Failed to make JWT: %v", err)
+	if resp.StatusCode != http.StatusInternalServerError || string(body) != expBody {
+		t.Errorf("Expected 500 error, got %s %s", resp.Status, string(body))
 	}
 
-	req = httptest.NewRequest("GET", "http://a/rooms/1/open", nil)
-	req.Header.Set("Authorization", "Bearer "+jwt)
-	w = httptest.NewRecorder()
-
-	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ") != jwt {
-			t.Errorf("Wrong JWT given to bookings server, got %s expected %s",
-				strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "), jwt)
-		}
-		fmt.Fprint(w, `
-			bla
-		`)
-	}))
-	defer ts.Close()
-
-	sqlMock.ExpectQuery(fixedFullRe("SELECT * FROM `rooms` WHERE `rooms`.`deleted_at` IS NULL AND ((`rooms`.`id` = 1))")).
-		WillReturnRows(getRowsForRooms([]*Room{room}))
+	fake.queries = nil
+	fake.expectQuery("rooms(func: uid($id))", testRoomsJSON)
+	resp, body = doRequest("GET", "http://a/rooms/0x10/open?user=0x3")
 
-	BookingsServer = ts.URL
-	router().ServeHTTP(w, req)
-
-	resp = w.Result()
-	body, _ = ioutil.ReadAll(resp.Body)
-
-	expBody = &bytes.Buffer{}
-	err = json.NewEncoder(expBody).Encode(&OpenRoomResp{
-		Err: "invalid character 'b' looking for beginning of value",
+	expBody = encodeResp(t, &OpenRoomResp{
+		Success: true,
 	})
-	if err != nil {
-		t.Fatalf("Error creating test JSON: %v", err)
+	if resp.StatusCode != http.StatusOK || string(body) != expBody {
+		t.Errorf("Response not what was expected, got %s %s wanted %s", resp.Status, string(body), expBody)
 	}
-
-	if string(body) != string(expBody.Bytes()) {
-		t.Errorf("Response not what was expected, got %s wanted %s", string(body), string(expBody.Bytes()))
+	if len(fake.mutations) != 1 || fake.commits != 1 {
+		t.Fatalf("Expected one committed mutation, got %d with %d commits", len(fake.mutations), fake.commits)
 	}
-
-	req = httptest.NewRequest("GET", "http://a/rooms/1/open", nil)
-	req.Header.Set("Authorization", "Bearer "+jwt)
-	w = httptest.NewRecorder()
-
-	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ") != jwt {
-			t.Errorf("Wrong JWT given to bookings server, got %s expected %s",
-				strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "), jwt)
-		}
-		fmt.Fprint(w, `
-			{
-				"err": "foobar"
-			}
-		`)
-	}))
-	defer ts.Close()
-
-	sqlMock.ExpectQuery(fixedFullRe("SELECT * FROM `rooms` WHERE `rooms`.`deleted_at` IS NULL AND ((`rooms`.`id` = 1))")).
-		WillReturnRows(getRowsForRooms([]*Room{room}))
-
-	BookingsServer = ts.URL
-	router().ServeHTTP(w, req)
-
-	resp = w.Result()
-	body, _ = ioutil.ReadAll(resp.Body)
-
-	expBody = &bytes.Buffer{}
-	err = json.NewEncoder(expBody).Encode(&OpenRoomResp{
-		Err: "foobar",
-	})
+	var nodes []map[string]interface{}
+	err := json.Unmarshal(fake.mutations[0].SetJson, &nodes)
 	if err != nil {
-		t.Fatalf("Error creating test JSON: %v", err)
+		t.Fatalf("Error reading mutation: %v", err)
 	}
-
-	if string(body) != string(expBody.Bytes()) {
-		t.Errorf("Response not what was expected, got %s wanted %s", string(body), string(expBody.Bytes()))
+	if len(nodes) != 2 || nodes[0]["uid"] != "0x10" || nodes[0]["room.shouldOpen"] != true {
+		t.Errorf("Expected the room to be set to open, got %s", string(fake.mutations[0].SetJson))
 	}
 
-	req = httptest.NewRequest("GET", "http://a/rooms/1/open", nil)
-	req.Header.Set("Authorization", "Bearer "+jwt)
-	w = httptest.NewRecorder()
+	fake.mutateErr = errors.New("foobar")
+	resp, body = doRequest("GET", "http://a/rooms/0x10/open?user=0x3")
 
-	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ") != jwt {
-			t.Errorf("Wrong JWT given to bookings server, got %s expected %s",
-				strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "), jwt)
-		}
-		fmt.Fprint(w, `
-			{
-				"booking": {
-				}
-			}
-		`)
-	}))
-	defer ts.Close()
-
-	sqlMock.ExpectQuery(fixedFullRe("SELECT * FROM `rooms` WHERE `rooms`.`deleted_at` IS NULL AND ((`rooms`.`id` = 1))")).
-		WillReturnRows(getRowsForRooms([]*Room{room}))
-
-	sqlMock.ExpectExec(fixedFullRe("UPDATE `rooms` SET `created_at` = ?, `updated_at` = ?, `deleted_at` = ?, `name` = ?," +
-		" `floor` = ?, `hotel_id` = ?, `door_id` = ?, `should_open` = ? WHERE `rooms`.`deleted_at` IS NULL AND `rooms`.`id` = ?")).
-		WillReturnError(errors.New("foobar"))
-
-	BookingsServer = ts.URL
-	router().ServeHTTP(w, req)
-
-	resp = w.Result()
-	body, _ = ioutil.ReadAll(resp.Body)
-
-	expBody = &bytes.Buffer{}
-	err = json.NewEncoder(expBody).Encode(&OpenRoomResp{
-		Err: "foobar",
+	expBody = encodeResp(t, &OpenRoomResp{
+		Err:  "foobar",
+		Code: utils.CodeInternal,
 	})
-	if err != nil {
-		t.Fatalf("Error creating test JSON: %v", err)
+	if resp.StatusCode != http.StatusInternalServerError || string(body) != expBody {
+		t.Errorf("Expected 500 error when the room can't be saved, got %s %s", resp.Status, string(body))
 	}
+}
 
-	if string(body) != string(expBody.Bytes()) {
-		t.Errorf("Response not what was expected, got %s wanted %s", string(body), string(expBody.Bytes()))
-	}
-
-	req = httptest.NewRequest("GET", "http://a/rooms/1/open", nil)
-	req.Header.Set("Authorization", "Bearer "+jwt)
-	w = httptest.NewRecorder()
-
-	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ") != jwt {
-			t.Errorf("Wrong JWT given to bookings server, got %s expected %s",
-				strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "), jwt)
-		}
-		fmt.Fprint(w, `
-			{
-				"booking": {
-				}
-			}
-		`)
-	}))
-	defer ts.Close()
-
-	sqlMock.ExpectQuery(fixedFullRe("SELECT * FROM `rooms` WHERE `rooms`.`deleted_at` IS NULL AND ((`rooms`.`id` = 1))")).
-		WillReturnRows(getRowsForRooms([]*Room{room}))
-
-	sqlMock.ExpectExec(fixedFullRe("UPDATE `rooms` SET `created_at` = ?, `updated_at` = ?, `deleted_at` = ?, `name` = ?," +
-		" `floor` = ?, `hotel_id` = ?, `door_id` = ?, `should_open` = ? WHERE `rooms`.`deleted_at` IS NULL AND `rooms`.`id` = ?")).
-		WillReturnResult(sqlmock.NewResult(0, 1))
-
-	BookingsServer = ts.URL
-	router().ServeHTTP(w, req)
+func TestOpenRoomSuccess(t *testing.T) {
+	fake, restore := useFakeDB(t)
+	defer restore()
 
-	resp = w.Result()
-	body, _ = ioutil.ReadAll(resp.Body)
+	fake.expectQuery("rooms(func: uid($id))", testRoomsJSON)
+	resp, body := doRequest("GET", "http://a/rooms/0x10/open-success")
 
-	expBody = &bytes.Buffer{}
-	err = json.NewEncoder(expBody).Encode(&OpenRoomResp{
+	expBody := encodeResp(t, &OpenRoomSuccessResp{
 		Success: true,
 	})
-	if err != nil {
-		t.Fatalf("Error creating test JSON: %v", err)
-	}
-
-	if string(body) != string(expBody.Bytes()) {
-		t.Errorf("Response not what was expected, got %s wanted %s", string(body), string(expBody.Bytes()))
+	if resp.StatusCode != http.StatusOK || string(body) != expBody {
+		t.Errorf("Response not what was expected, got %s %s wanted %s", resp.Status, string(body), expBody)
 	}
-
-	req = httptest.NewRequest("GET", "http://a/rooms/1/open", nil)
-	req.Header.Set("Authorization", "Bearer "+jwt)
-	w = httptest.NewRecorder()
-
-	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ") != jwt {
-			t.Errorf("Wrong JWT given to bookings server, got %s expected %s",
-				strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "), jwt)
-		}
-		fmt.Fprint(w, `
-			{
-				"foo": "bar"
-			}
-		`)
-	}))
-	defer ts.Close()
-
-	sqlMock.ExpectQuery(fixedFullRe("SELECT * FROM `rooms` WHERE `rooms`.`deleted_at` IS NULL AND ((`rooms`.`id` = 1))")).
-		WillReturnRows(getRowsForRooms([]*Room{room}))
-
-	sqlMock.ExpectExec(fixedFullRe("UPDATE `rooms` SET `created_at` = ?, `updated_at` = ?, `deleted_at` = ?, `name` = ?," +
-		" `floor` = ?, `hotel_id` = ?, `door_id` = ?, `should_open` = ? WHERE `rooms`.`deleted_at` IS NULL AND `rooms`.`id` = ?")).
-		WillReturnResult(sqlmock.NewResult(0, 1))
-
-	BookingsServer = ts.URL
-	router().ServeHTTP(w, req)
-
-	resp = w.Result()
-	body, _ = ioutil.ReadAll(resp.Body)
-
-	expBody = &bytes.Buffer{}
-	err = json.NewEncoder(expBody).Encode(&OpenRoomResp{
-		Err: "unknown",
-	})
-	if err != nil {
-		t.Fatalf("Error creating test JSON: %v", err)
+	// Moving a room relies on shouldOpen having been cleared for good
+	if len(fake.mutations) != 1 || fake.commits != 1 {
+		t.Fatalf("Expected one committed mutation, got %d with %d commits", len(fake.mutations), fake.commits)
 	}
-
-	if string(body) != string(expBody.Bytes()) {
-		t.Errorf("Response not what was expected, got %s wanted %s", string(body), string(expBody.Bytes()))
+	var node map[string]interface{}
+	err := json.Unmarshal(fake.mutations[0].SetJson, &node)
+	if err != nil || node["uid"] != "0x10" || node["room.shouldOpen"] != false {
+		t.Errorf("Expected the room to be set to closed, got %s", string(fake.mutations[0].SetJson))
 	}
-
-	db = oldDb
 }
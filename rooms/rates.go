@@ -0,0 +1,451 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dgraph-io/dgo"
+	"github.com/dgraph-io/dgo/protos/api"
+	"github.com/fluidmediaproductions/central_hotel_door_server/clients"
+	"github.com/fluidmediaproductions/central_hotel_door_server/utils"
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+)
+
+type RatePlan = clients.RatePlan
+type RatePlanInput = clients.RatePlanInput
+type RatePlanResp = clients.RatePlanResp
+type QuoteResp = clients.QuoteResp
+
+var errNoRates = errors.New("room type has no rates")
+
+// ratePlanFields are the predicates of a rate plan, nested under
+// roomType.ratePlan. Plans are never changed once written, so old ones stay
+// as they were for the bookings quoted from them.
+const ratePlanFields = `uid
+                ratePlan.currency
+                ratePlan.nightly
+                ratePlan.minStay
+                ratePlan.createdAt
+                ratePlan.createdBy {
+                  uid
+                }
+                ratePlan.seasons (orderasc: season.from) {
+                  season.name
+                  season.from
+                  season.to
+                  season.nightly
+                  season.minStay
+                }
+                ratePlan.taxes (orderasc: tax.name) {
+                  tax.name
+                  tax.percent
+                }`
+
+type ratePlanQuery struct {
+	ID        string    `json:"uid"`
+	Currency  string    `json:"ratePlan.currency"`
+	Nightly   int64     `json:"ratePlan.nightly"`
+	MinStay   int       `json:"ratePlan.minStay"`
+	CreatedAt time.Time `json:"ratePlan.createdAt"`
+	CreatedBy []struct {
+		ID string `json:"uid"`
+	} `json:"ratePlan.createdBy"`
+	Seasons []struct {
+		Name    string `json:"season.name"`
+		From    string `json:"season.from"`
+		To      string `json:"season.to"`
+		Nightly int64  `json:"season.nightly"`
+		MinStay int    `json:"season.minStay"`
+	} `json:"ratePlan.seasons"`
+	Taxes []struct {
+		Name    string  `json:"tax.name"`
+		Percent float64 `json:"tax.percent"`
+	} `json:"ratePlan.taxes"`
+}
+
+func (p *ratePlanQuery) toRatePlan(roomTypeId string) *RatePlan {
+	plan := &RatePlan{
+		ID:         p.ID,
+		RoomTypeID: roomTypeId,
+		Currency:   p.Currency,
+		Nightly:    p.Nightly,
+		MinStay:    p.MinStay,
+		Seasons:    make([]*clients.SeasonRate, 0, len(p.Seasons)),
+		Taxes:      make([]*clients.Tax, 0, len(p.Taxes)),
+		CreatedAt:  p.CreatedAt,
+	}
+	if len(p.CreatedBy) > 0 {
+		plan.CreatedBy = p.CreatedBy[0].ID
+	}
+	for _, season := range p.Seasons {
+		plan.Seasons = append(plan.Seasons, &clients.SeasonRate{
+			Name:    season.Name,
+			From:    season.From,
+			To:      season.To,
+			Nightly: season.Nightly,
+			MinStay: season.MinStay,
+		})
+	}
+	for _, tax := range p.Taxes {
+		plan.Taxes = append(plan.Taxes, &clients.Tax{
+			Name:    tax.Name,
+			Percent: tax.Percent,
+		})
+	}
+	return plan
+}
+
+// pricedType is a room type with what's needed to quote a stay in it.
+type pricedType struct {
+	HotelID  string
+	TimeZone string
+	Plan     *RatePlan
+}
+
+// getPricedType gets a room type's current rates and its hotel's time zone.
+// The plan is nil for types that haven't been given rates yet.
+func getPricedType(ctx context.Context, txn *dgo.Txn, id string) (*pricedType, error) {
+	q := `query q($id: string) {
+            types(func: uid($id)) @filter(has(roomType)) {
+              uid
+              roomType.hotel {
+                uid
+                hotel.timeZone
+              }
+              roomType.ratePlan {
+                ` + ratePlanFields + `
+              }
+            }
+          }`
+
+	resp, err := txn.QueryWithVars(ctx, q, map[string]string{"$id": id})
+	if err != nil {
+		return nil, err
+	}
+	var types struct {
+		Types []struct {
+			ID    string `json:"uid"`
+			Hotel []struct {
+				ID       string `json:"uid"`
+				TimeZone string `json:"hotel.timeZone"`
+			} `json:"roomType.hotel"`
+			Plan []*ratePlanQuery `json:"roomType.ratePlan"`
+		} `json:"types"`
+	}
+	err = json.Unmarshal(resp.GetJson(), &types)
+	if err != nil {
+		return nil, err
+	}
+	if len(types.Types) == 0 {
+		return nil, errRoomTypeNotFound
+	}
+	roomType := types.Types[0]
+	priced := &pricedType{}
+	if len(roomType.Hotel) > 0 {
+		priced.HotelID = roomType.Hotel[0].ID
+		priced.TimeZone = roomType.Hotel[0].TimeZone
+	}
+	if len(roomType.Plan) > 0 {
+		priced.Plan = roomType.Plan[0].toRatePlan(roomType.ID)
+	}
+	return priced, nil
+}
+
+func checkAmount(name string, amount int64) error {
+	if amount < 0 {
+		return errors.Errorf("%s can't be negative", name)
+	}
+	return nil
+}
+
+func checkMinStay(minStay int) error {
+	if minStay < 0 {
+		return errors.New("minStay can't be negative")
+	}
+	return nil
+}
+
+// ratePlanNode checks a rate plan and turns it into a new plan node. Seasons
+// can't overlap, so each night has one rate.
+func ratePlanNode(input *RatePlanInput) (map[string]interface{}, error) {
+	currency := strings.ToUpper(strings.TrimSpace(input.Currency))
+	if len(currency) != 3 || strings.Trim(currency, "ABCDEFGHIJKLMNOPQRSTUVWXYZ") != "" {
+		return nil, errors.Errorf("invalid currency %q", input.Currency)
+	}
+	if err := checkAmount("nightly", input.Nightly); err != nil {
+		return nil, err
+	}
+	if err := checkMinStay(input.MinStay); err != nil {
+		return nil, err
+	}
+	minStay := input.MinStay
+	if minStay == 0 {
+		minStay = 1
+	}
+
+	seasons := make([]*clients.SeasonRate, 0, len(input.Seasons))
+	for _, season := range input.Seasons {
+		name := strings.TrimSpace(season.Name)
+		if name == "" {
+			return nil, errors.New("a season needs a name")
+		}
+		from, err := time.Parse(clients.DateLayout, season.From)
+		if err != nil {
+			return nil, errors.Errorf("invalid from %q for season %s", season.From, name)
+		}
+		to, err := time.Parse(clients.DateLayout, season.To)
+		if err != nil {
+			return nil, errors.Errorf("invalid to %q for season %s", season.To, name)
+		}
+		if to.Before(from) {
+			return nil, errors.Errorf("season %s ends before it starts", name)
+		}
+		if err := checkAmount("nightly", season.Nightly); err != nil {
+			return nil, err
+		}
+		if err := checkMinStay(season.MinStay); err != nil {
+			return nil, err
+		}
+		seasons = append(seasons, &clients.SeasonRate{
+			Name:    name,
+			From:    season.From,
+			To:      season.To,
+			Nightly: season.Nightly,
+			MinStay: season.MinStay,
+		})
+	}
+	sort.Slice(seasons, func(i, j int) bool {
+		return seasons[i].From < seasons[j].From
+	})
+	for i := 1; i < len(seasons); i++ {
+		if seasons[i].From <= seasons[i-1].To {
+			return nil, errors.Errorf("seasons %s and %s overlap", seasons[i-1].Name, seasons[i].Name)
+		}
+	}
+
+	taxes := make([]map[string]interface{}, 0, len(input.Taxes))
+	for _, tax := range input.Taxes {
+		name := strings.TrimSpace(tax.Name)
+		if name == "" {
+			return nil, errors.New("a tax needs a name")
+		}
+		if math.IsNaN(tax.Percent) || tax.Percent < 0 || tax.Percent > 100 {
+			return nil, errors.Errorf("invalid percent %v for tax %s", tax.Percent, name)
+		}
+		taxes = append(taxes, map[string]interface{}{
+			"tax.name":    name,
+			"tax.percent": tax.Percent,
+		})
+	}
+
+	seasonNodes := make([]map[string]interface{}, 0, len(seasons))
+	for _, season := range seasons {
+		seasonNodes = append(seasonNodes, map[string]interface{}{
+			"season.name":    season.Name,
+			"season.from":    season.From,
+			"season.to":      season.To,
+			"season.nightly": season.Nightly,
+			"season.minStay": season.MinStay,
+		})
+	}
+
+	return map[string]interface{}{
+		"uid":               "_:ratePlan",
+		"ratePlan":          true,
+		"ratePlan.currency": currency,
+		"ratePlan.nightly":  input.Nightly,
+		"ratePlan.minStay":  minStay,
+		"ratePlan.seasons":  seasonNodes,
+		"ratePlan.taxes":    taxes,
+	}, nil
+}
+
+func writeRatePlanError(w http.ResponseWriter, status int, err error) {
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(&RatePlanResp{
+		Err:  err.Error(),
+		Code: utils.StatusCode(status),
+	})
+}
+
+func getRatePlan(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	ctx := context.Background()
+	txn := db.NewTxn()
+	defer txn.Discard(ctx)
+
+	priced, err := getPricedType(ctx, txn, id)
+	if err == errRoomTypeNotFound {
+		writeRatePlanError(w, http.StatusNotFound, err)
+		return
+	} else if err != nil {
+		writeRatePlanError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if priced.Plan == nil {
+		writeRatePlanError(w, http.StatusNotFound, errNoRates)
+		return
+	}
+
+	json.NewEncoder(w).Encode(&RatePlanResp{
+		RatePlan: priced.Plan,
+	})
+}
+
+// setRatePlan gives a room type a new rate plan. The old plan is kept, but
+// only bookings already quoted from it still point to it.
+func setRatePlan(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	claims, err := getAdminClaims(r)
+	if err != nil {
+		writeAdminAuthError(w, err)
+		return
+	}
+
+	var input RatePlanInput
+	err = json.NewDecoder(r.Body).Decode(&input)
+	r.Body.Close()
+	if err != nil {
+		writeRatePlanError(w, http.StatusBadRequest, errors.New("bad request data"))
+		return
+	}
+	plan, err := ratePlanNode(&input)
+	if err != nil {
+		writeRatePlanError(w, http.StatusBadRequest, err)
+		return
+	}
+	plan["ratePlan.roomType"] = &utils.UIDRef{ID: id}
+	plan["ratePlan.createdAt"] = time.Now()
+	plan["ratePlan.createdBy"] = &utils.UIDRef{ID: claims.User.ID}
+
+	ctx := context.Background()
+	txn := db.NewTxn()
+	defer txn.Discard(ctx)
+
+	exists, err := nodeExists(ctx, txn, id, "roomType")
+	if err != nil {
+		writeRatePlanError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if !exists {
+		writeRatePlanError(w, http.StatusNotFound, errRoomTypeNotFound)
+		return
+	}
+
+	// The type only ever points to its current plan
+	del, err := json.Marshal(map[string]interface{}{
+		"uid":               id,
+		"roomType.ratePlan": nil,
+	})
+	if err == nil {
+		_, err = txn.Mutate(ctx, &api.Mutation{DeleteJson: del})
+	}
+	if err != nil {
+		writeRatePlanError(w, http.StatusInternalServerError, err)
+		return
+	}
+	mutData, err := json.Marshal(map[string]interface{}{
+		"uid":               id,
+		"roomType.ratePlan": plan,
+	})
+	if err == nil {
+		_, err = txn.Mutate(ctx, &api.Mutation{SetJson: mutData})
+	}
+	if err != nil {
+		writeRatePlanError(w, http.StatusInternalServerError, err)
+		return
+	}
+	err = writeAudit(ctx, txn, utils.NewAuditEntry("roomType.rates_set", claims.User.ID, id, ""))
+	if err == nil {
+		err = txn.Commit(ctx)
+	}
+	if err != nil {
+		writeRatePlanError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	readTxn := db.NewTxn()
+	defer readTxn.Discard(ctx)
+	priced, err := getPricedType(ctx, readTxn, id)
+	if err != nil {
+		writeRatePlanError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(&RatePlanResp{
+		RatePlan: priced.Plan,
+	})
+}
+
+func writeQuoteError(w http.ResponseWriter, status int, err error) {
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(&QuoteResp{
+		Err:  err.Error(),
+		Code: utils.StatusCode(status),
+	})
+}
+
+// getQuote prices a stay in a room type at its current rates, counting the
+// nights in the hotel's time zone. Stays under the minimum are still quoted,
+// with the minimum for the caller to check.
+func getQuote(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	query := r.URL.Query()
+	start, err := time.Parse(time.RFC3339, query.Get("start"))
+	if err != nil {
+		writeQuoteError(w, http.StatusBadRequest, errors.Errorf("invalid start %q", query.Get("start")))
+		return
+	}
+	end, err := time.Parse(time.RFC3339, query.Get("end"))
+	if err != nil {
+		writeQuoteError(w, http.StatusBadRequest, errors.Errorf("invalid end %q", query.Get("end")))
+		return
+	}
+	if !start.Before(end) {
+		writeQuoteError(w, http.StatusBadRequest, errors.New("start must be before end"))
+		return
+	}
+
+	ctx := context.Background()
+	txn := db.NewTxn()
+	defer txn.Discard(ctx)
+
+	priced, err := getPricedType(ctx, txn, id)
+	if err == errRoomTypeNotFound {
+		writeQuoteError(w, http.StatusNotFound, err)
+		return
+	} else if err != nil {
+		writeQuoteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if hotelId := query.Get("hotel"); hotelId != "" && hotelId != priced.HotelID {
+		writeQuoteError(w, http.StatusNotFound, errRoomTypeNotFound)
+		return
+	}
+	if priced.Plan == nil {
+		writeQuoteError(w, http.StatusNotFound, errNoRates)
+		return
+	}
+
+	quote, err := priced.Plan.Quote(start, end, utils.LoadTimeZone(priced.TimeZone), time.Now())
+	if err != nil {
+		writeQuoteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(&QuoteResp{
+		Quote: quote,
+	})
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/fluidmediaproductions/central_hotel_door_server/clients"
+)
+
+func TestRatePlanNode(t *testing.T) {
+	node, err := ratePlanNode(&RatePlanInput{
+		Currency: " gbp",
+		Nightly:  12000,
+		Seasons: []*clients.SeasonRate{
+			{Name: "Summer", From: "2030-07-01", To: "2030-08-31", Nightly: 15000},
+			{Name: "Easter", From: "2030-04-18", To: "2030-04-22", Nightly: 14000, MinStay: 2},
+		},
+		Taxes: []*clients.Tax{
+			{Name: "VAT", Percent: 20},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if node["ratePlan.currency"] != "GBP" || node["ratePlan.minStay"] != 1 {
+		t.Errorf("unexpected plan %v", node)
+	}
+	seasons, _ := node["ratePlan.seasons"].([]map[string]interface{})
+	if len(seasons) != 2 || seasons[0]["season.name"] != "Easter" {
+		t.Errorf("expected the seasons in date order, got %v", seasons)
+	}
+
+	for i, input := range []*RatePlanInput{
+		{Currency: "pounds", Nightly: 100},
+		{Currency: "GBP", Nightly: -1},
+		{Currency: "GBP", Nightly: 100, MinStay: -1},
+		{Currency: "GBP", Nightly: 100, Seasons: []*clients.SeasonRate{
+			{Name: "Summer", From: "2030-08-31", To: "2030-07-01", Nightly: 150},
+		}},
+		{Currency: "GBP", Nightly: 100, Seasons: []*clients.SeasonRate{
+			{Name: "Summer", From: "2030-07-01", To: "2030-08-31", Nightly: 150},
+			{Name: "August", From: "2030-08-01", To: "2030-08-31", Nightly: 200},
+		}},
+		{Currency: "GBP", Nightly: 100, Seasons: []*clients.SeasonRate{
+			{Name: "Summer", From: "July", To: "2030-08-31", Nightly: 150},
+		}},
+		{Currency: "GBP", Nightly: 100, Taxes: []*clients.Tax{{Name: "VAT", Percent: 120}}},
+		{Currency: "GBP", Nightly: 100, Taxes: []*clients.Tax{{Percent: 20}}},
+	} {
+		if _, err := ratePlanNode(input); err == nil {
+			t.Errorf("%d: expected an error for %+v", i, input)
+		}
+	}
+}
@@ -0,0 +1,508 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dgraph-io/dgo"
+	"github.com/dgraph-io/dgo/protos/api"
+	"github.com/fluidmediaproductions/central_hotel_door_server/clients"
+	"github.com/fluidmediaproductions/central_hotel_door_server/utils"
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+)
+
+type RoomType = clients.RoomType
+type RoomTypeResp = clients.RoomTypeResp
+type RoomTypesResp = clients.RoomTypesResp
+type RoomTypeInput = clients.RoomTypeInput
+
+var errRoomTypeNotFound = errors.New("room type not found")
+
+// roomTypeFields are the predicates of a room type to query, nested under
+// room.type for rooms.
+const roomTypeFields = `uid
+                roomType.name
+                roomType.capacity
+                roomType.beds
+                roomType.amenities
+                roomType.accessibility
+                roomType.hotel {
+                  uid
+                }`
+
+type roomTypeQuery struct {
+	ID            string   `json:"uid"`
+	Name          string   `json:"roomType.name"`
+	Capacity      int      `json:"roomType.capacity"`
+	Beds          string   `json:"roomType.beds"`
+	Amenities     []string `json:"roomType.amenities"`
+	Accessibility []string `json:"roomType.accessibility"`
+	Hotel         []struct {
+		ID string `json:"uid"`
+	} `json:"roomType.hotel"`
+}
+
+func (t *roomTypeQuery) toRoomType() *RoomType {
+	roomType := &RoomType{
+		ID:            t.ID,
+		Name:          t.Name,
+		Capacity:      t.Capacity,
+		Beds:          t.Beds,
+		Amenities:     t.Amenities,
+		Accessibility: t.Accessibility,
+	}
+	if roomType.Amenities == nil {
+		roomType.Amenities = make([]string, 0)
+	}
+	if roomType.Accessibility == nil {
+		roomType.Accessibility = make([]string, 0)
+	}
+	if len(t.Hotel) > 0 {
+		roomType.HotelID = t.Hotel[0].ID
+	}
+	return roomType
+}
+
+// roomListFilter builds the conditions on a room list from its query
+// parameters, adding the values they need to the query's variables. Filters
+// on the room's type go through the rooms of the matching types, and from and
+// to leave out the rooms that are out of service or booked, all found by the
+// var blocks it returns.
+func roomListFilter(query url.Values, variables map[string]string) (string, []string, error) {
+	var conds []string
+	if floor := query.Get("floor"); floor != "" {
+		variables["$floor"] = floor
+		conds = append(conds, "eq(room.floor, $floor)")
+	}
+	if category := query.Get("category"); category != "" {
+		variables["$category"] = category
+		conds = append(conds, "eq(room.category, $category)")
+	}
+	if status := query.Get("housekeeping"); status != "" {
+		cond, err := housekeepingFilter(status, variables)
+		if err != nil {
+			return "", nil, err
+		}
+		conds = append(conds, cond)
+	}
+
+	var typeConds []string
+	if typeId := query.Get("type"); typeId != "" {
+		if !utils.IsUID(typeId) {
+			return "", nil, errors.Errorf("invalid type %q", typeId)
+		}
+		variables["$type"] = typeId
+		typeConds = append(typeConds, "uid($type)")
+	}
+	if capacity := query.Get("capacity"); capacity != "" {
+		value, err := strconv.Atoi(capacity)
+		if err != nil || value < 1 {
+			return "", nil, errors.Errorf("invalid capacity %q", capacity)
+		}
+		variables["$capacity"] = strconv.Itoa(value)
+		typeConds = append(typeConds, "ge(roomType.capacity, $capacity)")
+	}
+	for i, amenity := range query["amenity"] {
+		name := fmt.Sprintf("$amenity%d", i)
+		variables[name] = strings.ToLower(strings.TrimSpace(amenity))
+		typeConds = append(typeConds, "eq(roomType.amenities, "+name+")")
+	}
+	for i, feature := range query["accessibility"] {
+		name := fmt.Sprintf("$accessibility%d", i)
+		variables[name] = strings.ToLower(strings.TrimSpace(feature))
+		typeConds = append(typeConds, "eq(roomType.accessibility, "+name+")")
+	}
+
+	var blocks []string
+	if len(typeConds) > 0 {
+		blocks = append(blocks, `var (func: has(roomType)) @filter(`+strings.Join(typeConds, " AND ")+`) {
+              typed as ~room.type
+            }`)
+		conds = append(conds, "uid(typed)")
+	}
+
+	from, to := query.Get("from"), query.Get("to")
+	if from != "" || to != "" {
+		start, err := time.Parse(time.RFC3339, from)
+		if err != nil {
+			return "", nil, errors.Errorf("invalid from %q", from)
+		}
+		end, err := time.Parse(time.RFC3339, to)
+		if err != nil {
+			return "", nil, errors.Errorf("invalid to %q", to)
+		}
+		if !start.Before(end) {
+			return "", nil, errors.New("from must be before to")
+		}
+		block, free := availabilityFilter(start, end, variables)
+		blocks = append(blocks, block)
+		conds = append(conds, free...)
+	}
+	return strings.Join(blocks, "\n            "), conds, nil
+}
+
+// roomTypeNode turns the fields set in a RoomTypeInput into the predicates
+// of a mutation. The hotel is only set when the type is created, as its
+// rooms are all in that hotel.
+func roomTypeNode(id string, input *RoomTypeInput) (map[string]interface{}, error) {
+	node := map[string]interface{}{
+		"uid": id,
+	}
+	if input.Name != nil {
+		name := strings.TrimSpace(*input.Name)
+		if name == "" {
+			return nil, errors.New("name can't be empty")
+		}
+		node["roomType.name"] = name
+	}
+	if input.Capacity != nil {
+		if *input.Capacity < 1 {
+			return nil, errors.New("capacity has to be at least 1")
+		}
+		node["roomType.capacity"] = *input.Capacity
+	}
+	if input.Beds != nil {
+		node["roomType.beds"] = strings.TrimSpace(*input.Beds)
+	}
+	if input.Amenities != nil {
+		node["roomType.amenities"] = cleanList(*input.Amenities)
+	}
+	if input.Accessibility != nil {
+		node["roomType.accessibility"] = cleanList(*input.Accessibility)
+	}
+	return node, nil
+}
+
+// cleanList trims and lower cases the values of a list, dropping empty and
+// repeated ones, so filters match however they were typed.
+func cleanList(values []string) []string {
+	cleaned := make([]string, 0, len(values))
+	seen := map[string]bool{}
+	for _, value := range values {
+		value = strings.ToLower(strings.TrimSpace(value))
+		if value == "" || seen[value] {
+			continue
+		}
+		seen[value] = true
+		cleaned = append(cleaned, value)
+	}
+	return cleaned
+}
+
+func getRoomTypeFromDB(ctx context.Context, txn *dgo.Txn, id string) (*RoomType, error) {
+	q := `query q($id: string) {
+            types(func: uid($id)) @filter(has(roomType)) {
+              ` + roomTypeFields + `
+            }
+          }`
+
+	resp, err := txn.QueryWithVars(ctx, q, map[string]string{"$id": id})
+	if err != nil {
+		return nil, err
+	}
+	var types struct {
+		Types []*roomTypeQuery `json:"types"`
+	}
+	err = json.Unmarshal(resp.GetJson(), &types)
+	if err != nil {
+		return nil, err
+	}
+	if len(types.Types) == 0 {
+		return nil, errRoomTypeNotFound
+	}
+	return types.Types[0].toRoomType(), nil
+}
+
+// getRoomHotel finds the hotel a room is in.
+func getRoomHotel(ctx context.Context, txn *dgo.Txn, id string) (string, error) {
+	q := `query q($id: string) {
+            rooms(func: uid($id)) @filter(has(room)) {
+              room.hotel {
+                uid
+              }
+            }
+          }`
+
+	resp, err := txn.QueryWithVars(ctx, q, map[string]string{"$id": id})
+	if err != nil {
+		return "", err
+	}
+	var rooms roomQuery
+	err = json.Unmarshal(resp.GetJson(), &rooms)
+	if err != nil {
+		return "", err
+	}
+	if len(rooms.Rooms) == 0 || len(rooms.Rooms[0].Hotel) == 0 {
+		return "", nil
+	}
+	return rooms.Rooms[0].Hotel[0].ID, nil
+}
+
+// checkRoomType makes sure a room is being given a type from its own hotel.
+// An empty type takes the room's type away.
+func checkRoomType(ctx context.Context, txn *dgo.Txn, roomId string, input *RoomInput) (int, error) {
+	if input.TypeID == nil || *input.TypeID == "" {
+		return 0, nil
+	}
+	if !utils.IsUID(*input.TypeID) {
+		return http.StatusBadRequest, errors.Errorf("invalid type %q", *input.TypeID)
+	}
+	roomType, err := getRoomTypeFromDB(ctx, txn, *input.TypeID)
+	if err == errRoomTypeNotFound {
+		return http.StatusBadRequest, err
+	} else if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	hotelId := ""
+	if input.HotelID != nil {
+		hotelId = *input.HotelID
+	} else {
+		hotelId, err = getRoomHotel(ctx, txn, roomId)
+		if err != nil {
+			return http.StatusInternalServerError, err
+		}
+	}
+	if roomType.HotelID != hotelId {
+		return http.StatusBadRequest, errors.New("room type is for another hotel")
+	}
+	return 0, nil
+}
+
+func writeRoomTypeError(w http.ResponseWriter, status int, err error) {
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(&RoomTypeResp{
+		Err:  err.Error(),
+		Code: utils.StatusCode(status),
+	})
+}
+
+func decodeRoomTypeInput(r *http.Request) (*RoomTypeInput, error) {
+	defer r.Body.Close()
+	var input RoomTypeInput
+	err := json.NewDecoder(r.Body).Decode(&input)
+	if err != nil {
+		return nil, errors.New("bad request data")
+	}
+	return &input, nil
+}
+
+// saveRoomType writes a room type mutation and its audit entry, then fetches
+// the type as it now is.
+func saveRoomType(ctx context.Context, txn *dgo.Txn, node map[string]interface{}, action string, userId string) (*RoomType, error) {
+	mutData, err := json.Marshal(node)
+	if err != nil {
+		return nil, err
+	}
+	assigned, err := txn.Mutate(ctx, &api.Mutation{SetJson: mutData})
+	if err != nil {
+		return nil, err
+	}
+	id, _ := node["uid"].(string)
+	if newId, isOk := assigned.GetUids()["roomType"]; isOk {
+		id = newId
+	}
+	err = writeAudit(ctx, txn, utils.NewAuditEntry(action, userId, id, ""))
+	if err != nil {
+		return nil, err
+	}
+	err = txn.Commit(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	readTxn := db.NewTxn()
+	defer readTxn.Discard(ctx)
+	return getRoomTypeFromDB(ctx, readTxn, id)
+}
+
+func getRoomType(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	ctx := context.Background()
+	txn := db.NewTxn()
+	defer txn.Discard(ctx)
+
+	roomType, err := getRoomTypeFromDB(ctx, txn, id)
+	if err == errRoomTypeNotFound {
+		writeRoomTypeError(w, http.StatusNotFound, err)
+		return
+	} else if err != nil {
+		writeRoomTypeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(&RoomTypeResp{
+		RoomType: roomType,
+	})
+}
+
+func getRoomTypesByHotel(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	ctx := context.Background()
+	txn := db.NewTxn()
+	defer txn.Discard(ctx)
+
+	q := `query q($id: string) {
+            hotels(func: uid($id)) {
+              types: ~roomType.hotel (orderasc: roomType.name) {
+                ` + roomTypeFields + `
+              }
+            }
+          }`
+
+	resp, err := txn.QueryWithVars(ctx, q, map[string]string{"$id": id})
+	if err != nil {
+		writeRoomTypeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	var hotels struct {
+		Hotels []struct {
+			Types []*roomTypeQuery `json:"types"`
+		} `json:"hotels"`
+	}
+	err = json.Unmarshal(resp.GetJson(), &hotels)
+	if err != nil {
+		writeRoomTypeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	types := make([]*RoomType, 0)
+	if len(hotels.Hotels) > 0 {
+		for _, roomType := range hotels.Hotels[0].Types {
+			types = append(types, roomType.toRoomType())
+		}
+	}
+	json.NewEncoder(w).Encode(&RoomTypesResp{
+		RoomTypes: types,
+	})
+}
+
+func createRoomType(w http.ResponseWriter, r *http.Request) {
+	claims, err := getAdminClaims(r)
+	if err != nil {
+		writeAdminAuthError(w, err)
+		return
+	}
+
+	input, err := decodeRoomTypeInput(r)
+	if err != nil {
+		writeRoomTypeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if input.Name == nil || input.HotelID == nil {
+		writeRoomTypeError(w, http.StatusBadRequest, errors.New("name and hotelId are needed"))
+		return
+	}
+	node, err := roomTypeNode("_:roomType", input)
+	if err != nil {
+		writeRoomTypeError(w, http.StatusBadRequest, err)
+		return
+	}
+	node["roomType"] = true
+	node["roomType.hotel"] = &utils.UIDRef{ID: *input.HotelID}
+	if input.Capacity == nil {
+		node["roomType.capacity"] = 1
+	}
+
+	ctx := context.Background()
+	txn := db.NewTxn()
+	defer txn.Discard(ctx)
+
+	status, err := checkRoomHotel(ctx, txn, &RoomInput{HotelID: input.HotelID})
+	if err != nil {
+		writeRoomTypeError(w, status, err)
+		return
+	}
+
+	roomType, err := saveRoomType(ctx, txn, node, "roomType.created", claims.User.ID)
+	if err != nil {
+		writeRoomTypeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(&RoomTypeResp{
+		RoomType: roomType,
+	})
+}
+
+func updateRoomType(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	claims, err := getAdminClaims(r)
+	if err != nil {
+		writeAdminAuthError(w, err)
+		return
+	}
+
+	input, err := decodeRoomTypeInput(r)
+	if err != nil {
+		writeRoomTypeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if input.HotelID != nil {
+		writeRoomTypeError(w, http.StatusBadRequest, errors.New("a room type can't move hotel"))
+		return
+	}
+	node, err := roomTypeNode(id, input)
+	if err != nil {
+		writeRoomTypeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	ctx := context.Background()
+	txn := db.NewTxn()
+	defer txn.Discard(ctx)
+
+	exists, err := nodeExists(ctx, txn, id, "roomType")
+	if err != nil {
+		writeRoomTypeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if !exists {
+		writeRoomTypeError(w, http.StatusNotFound, errRoomTypeNotFound)
+		return
+	}
+
+	// Lists that are set replace the old ones rather than adding to them
+	del := map[string]interface{}{
+		"uid": id,
+	}
+	if input.Amenities != nil {
+		del["roomType.amenities"] = nil
+	}
+	if input.Accessibility != nil {
+		del["roomType.accessibility"] = nil
+	}
+	if len(del) > 1 {
+		delData, err := json.Marshal(del)
+		if err == nil {
+			_, err = txn.Mutate(ctx, &api.Mutation{DeleteJson: delData})
+		}
+		if err != nil {
+			writeRoomTypeError(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	roomType, err := saveRoomType(ctx, txn, node, "roomType.updated", claims.User.ID)
+	if err != nil {
+		writeRoomTypeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(&RoomTypeResp{
+		RoomType: roomType,
+	})
+}
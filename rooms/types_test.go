@@ -0,0 +1,113 @@
+package main
+
+import (
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRoomListFilter(t *testing.T) {
+	variables := map[string]string{}
+	block, conds, err := roomListFilter(url.Values{}, variables)
+	if err != nil || block != "" || len(conds) != 0 {
+		t.Errorf("expected no filter, got %q %v %v", block, conds, err)
+	}
+
+	variables = map[string]string{}
+	block, conds, err = roomListFilter(url.Values{
+		"category":      {"double"},
+		"capacity":      {"2"},
+		"amenity":       {"minibar", "bath"},
+		"accessibility": {"step-free"},
+	}, variables)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(conds, []string{"eq(room.category, $category)", "uid(typed)"}) {
+		t.Errorf("unexpected conditions %v", conds)
+	}
+	for _, cond := range []string{
+		"ge(roomType.capacity, $capacity)",
+		"eq(roomType.amenities, $amenity0)",
+		"eq(roomType.amenities, $amenity1)",
+		"eq(roomType.accessibility, $accessibility0)",
+	} {
+		if !strings.Contains(block, cond) {
+			t.Errorf("expected the type block to have %s, got %s", cond, block)
+		}
+	}
+	if variables["$amenity1"] != "bath" || variables["$capacity"] != "2" {
+		t.Errorf("unexpected variables %v", variables)
+	}
+
+	variables = map[string]string{}
+	block, conds, err = roomListFilter(url.Values{
+		"from": {"2018-06-01T14:00:00Z"},
+		"to":   {"2018-06-03T11:00:00Z"},
+	}, variables)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(conds, []string{"NOT uid(blocked)", "NOT uid(booked)"}) {
+		t.Errorf("unexpected conditions %v", conds)
+	}
+	if !strings.Contains(block, "blocked as block.room") || !strings.Contains(block, "booked as booking.room") {
+		t.Errorf("expected blocks for blocked and booked rooms, got %s", block)
+	}
+	if variables["$from"] != "2018-06-01T14:00:00Z" || variables["$to"] != "2018-06-03T11:00:00Z" {
+		t.Errorf("unexpected variables %v", variables)
+	}
+
+	variables = map[string]string{}
+	_, conds, err = roomListFilter(url.Values{"housekeeping": {"clean"}}, variables)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(conds) != 1 || !strings.Contains(conds[0], "NOT has(room.housekeeping)") {
+		t.Errorf("expected rooms never cleaned to count as clean, got %v", conds)
+	}
+
+	for _, query := range []url.Values{
+		{"capacity": {"0"}},
+		{"capacity": {"two"}},
+		{"type": {"double"}},
+		{"from": {"2018-06-01T14:00:00Z"}},
+		{"housekeeping": {"spotless"}},
+		{"from": {"2018-06-03T11:00:00Z"}, "to": {"2018-06-01T14:00:00Z"}},
+	} {
+		_, _, err = roomListFilter(query, map[string]string{})
+		if err == nil {
+			t.Errorf("expected %v to be rejected", query)
+		}
+	}
+}
+
+func TestRoomTypeNode(t *testing.T) {
+	name := " Deluxe Double "
+	capacity := 2
+	amenities := []string{"Minibar", " bath", "minibar", ""}
+	node, err := roomTypeNode("0x1", &RoomTypeInput{
+		Name:      &name,
+		Capacity:  &capacity,
+		Amenities: &amenities,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if node["roomType.name"] != "Deluxe Double" || node["roomType.capacity"] != 2 {
+		t.Errorf("unexpected node %v", node)
+	}
+	if !reflect.DeepEqual(node["roomType.amenities"], []string{"minibar", "bath"}) {
+		t.Errorf("expected amenities to be cleaned up, got %v", node["roomType.amenities"])
+	}
+	if _, isSet := node["roomType.accessibility"]; isSet {
+		t.Error("expected accessibility to be left alone")
+	}
+
+	capacity = 0
+	_, err = roomTypeNode("0x1", &RoomTypeInput{Capacity: &capacity})
+	if err == nil {
+		t.Error("expected a capacity of 0 to be rejected")
+	}
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/fluidmediaproductions/central_hotel_door_server/clients"
+	"github.com/fluidmediaproductions/central_hotel_door_server/utils"
+	"github.com/gorilla/mux"
+)
+
+type Unlock = clients.Unlock
+type UnlocksResp = clients.UnlocksResp
+
+type uidRef struct {
+	ID string `json:"uid"`
+}
+
+type unlockNode struct {
+	Room    *uidRef   `json:"unlock.room"`
+	User    *uidRef   `json:"unlock.user,omitempty"`
+	Booking *uidRef   `json:"unlock.booking,omitempty"`
+	Guest   *uidRef   `json:"unlock.guest,omitempty"`
+	Shift   *uidRef   `json:"unlock.shift,omitempty"`
+	Time    time.Time `json:"unlock.time"`
+}
+
+// newUnlockNode records who asked for a room to be opened. The gateway passes
+// the user, and the booking and guest invite or staff shift they used, as
+// query parameters.
+func newUnlockNode(roomId string, r *http.Request) *unlockNode {
+	node := &unlockNode{
+		Room: &uidRef{ID: roomId},
+		Time: time.Now(),
+	}
+	query := r.URL.Query()
+	if user := query.Get("user"); user != "" {
+		node.User = &uidRef{ID: user}
+	}
+	if booking := query.Get("booking"); booking != "" {
+		node.Booking = &uidRef{ID: booking}
+	}
+	if guest := query.Get("guest"); guest != "" {
+		node.Guest = &uidRef{ID: guest}
+	}
+	if shift := query.Get("shift"); shift != "" {
+		node.Shift = &uidRef{ID: shift}
+	}
+	return node
+}
+
+// unlockFields are the predicates of an unlock node to query.
+const unlockFields = `uid
+                unlock.time
+                unlock.room {
+                  uid
+                }
+                unlock.user {
+                  uid
+                }
+                unlock.booking {
+                  uid
+                }
+                unlock.guest {
+                  uid
+                }
+                unlock.shift {
+                  uid
+                }`
+
+type unlockResult struct {
+	ID      string    `json:"uid"`
+	Time    time.Time `json:"unlock.time"`
+	Room    []*uidRef `json:"unlock.room"`
+	User    []*uidRef `json:"unlock.user"`
+	Booking []*uidRef `json:"unlock.booking"`
+	Guest   []*uidRef `json:"unlock.guest"`
+	Shift   []*uidRef `json:"unlock.shift"`
+}
+
+func (u *unlockResult) toUnlock() *Unlock {
+	unlock := &Unlock{
+		ID:   u.ID,
+		Time: u.Time,
+	}
+	if len(u.Room) > 0 {
+		unlock.RoomID = u.Room[0].ID
+	}
+	if len(u.User) > 0 {
+		unlock.UserID = u.User[0].ID
+	}
+	if len(u.Booking) > 0 {
+		unlock.BookingID = u.Booking[0].ID
+	}
+	if len(u.Guest) > 0 {
+		unlock.GuestID = u.Guest[0].ID
+	}
+	if len(u.Shift) > 0 {
+		unlock.ShiftID = u.Shift[0].ID
+	}
+	return unlock
+}
+
+func getRoomUnlocks(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	id := vars["id"]
+
+	ctx := context.Background()
+	txn := db.NewTxn()
+
+	q := `query q($id: string) {
+            rooms(func: uid($id)) @filter(has(room)) {
+              ~unlock.room (orderdesc: unlock.time) {
+                ` + unlockFields + `
+              }
+	        }
+          }`
+
+	resp, err := txn.QueryWithVars(ctx, q, map[string]string{"$id": id})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(&UnlocksResp{
+			Err:  err.Error(),
+			Code: utils.CodeInternal,
+		})
+		return
+	}
+	var rooms struct {
+		Rooms []struct {
+			Unlocks []*unlockResult `json:"~unlock.room"`
+		} `json:"rooms"`
+	}
+	err = json.Unmarshal(resp.GetJson(), &rooms)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(&UnlocksResp{
+			Err:  err.Error(),
+			Code: utils.CodeInternal,
+		})
+		return
+	}
+
+	unlocks := make([]*Unlock, 0)
+	for _, room := range rooms.Rooms {
+		for _, u := range room.Unlocks {
+			unlocks = append(unlocks, u.toUnlock())
+		}
+	}
+
+	json.NewEncoder(w).Encode(&UnlocksResp{
+		Unlocks: unlocks,
+	})
+}
+
+// getUserUnlocks lists the rooms a user has opened, newest first, for support
+// staff looking into a guest's account.
+func getUserUnlocks(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	id := vars["id"]
+
+	claims, err := utils.GetRequestJWT(r, jwtSecret)
+	if err != nil {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(&UnlocksResp{
+			Err:  err.Error(),
+			Code: utils.CodeUnauthenticated,
+		})
+		return
+	}
+	if !claims.User.HasRole(utils.RoleAdmin, utils.RoleSupport) {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(&UnlocksResp{
+			Err:  "unlock history needs the admin or support role",
+			Code: utils.CodeForbidden,
+		})
+		return
+	}
+
+	ctx := context.Background()
+	txn := db.NewTxn()
+
+	q := `query q($id: string) {
+            users(func: uid($id)) {
+              ~unlock.user (orderdesc: unlock.time) {
+                ` + unlockFields + `
+              }
+	        }
+          }`
+
+	resp, err := txn.QueryWithVars(ctx, q, map[string]string{"$id": id})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(&UnlocksResp{
+			Err:  err.Error(),
+			Code: utils.CodeInternal,
+		})
+		return
+	}
+	var users struct {
+		Users []struct {
+			Unlocks []*unlockResult `json:"~unlock.user"`
+		} `json:"users"`
+	}
+	err = json.Unmarshal(resp.GetJson(), &users)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(&UnlocksResp{
+			Err:  err.Error(),
+			Code: utils.CodeInternal,
+		})
+		return
+	}
+
+	unlocks := make([]*Unlock, 0)
+	for _, user := range users.Users {
+		for _, u := range user.Unlocks {
+			unlocks = append(unlocks, u.toUnlock())
+		}
+	}
+
+	json.NewEncoder(w).Encode(&UnlocksResp{
+		Unlocks: unlocks,
+	})
+}
@@ -0,0 +1,111 @@
+package utils
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const timeOfDayLayout = "15:04"
+
+// AccessSchedule limits when a grant can be used. Days holds time.Weekday
+// values and From/To are times of day in 15:04 format, a window where From is
+// after To runs overnight. Empty fields don't restrict anything.
+type AccessSchedule struct {
+	Days []int  `json:"days,omitempty"`
+	From string `json:"from,omitempty"`
+	To   string `json:"to,omitempty"`
+}
+
+// ZoneGrant gives bookings of a type, or in a room category, access to a zone.
+// Empty fields match any booking.
+type ZoneGrant struct {
+	ID           string          `json:"uid"`
+	BookingType  string          `json:"bookingType,omitempty"`
+	RoomCategory string          `json:"roomCategory,omitempty"`
+	Schedule     *AccessSchedule `json:"schedule,omitempty"`
+}
+
+func minuteOfDay(s string) (int, bool) {
+	t, err := time.Parse(timeOfDayLayout, s)
+	if err != nil {
+		return 0, false
+	}
+	return t.Hour()*60 + t.Minute(), true
+}
+
+// CheckAccessSchedule checks a schedule's days are weekdays and its times
+// are in 15:04 format, before it's saved.
+func CheckAccessSchedule(s *AccessSchedule) error {
+	if s == nil {
+		return nil
+	}
+	for _, day := range s.Days {
+		if day < int(time.Sunday) || day > int(time.Saturday) {
+			return errors.Errorf("invalid day %d", day)
+		}
+	}
+	for _, clock := range []string{s.From, s.To} {
+		if _, isOk := minuteOfDay(clock); clock != "" && !isOk {
+			return errors.Errorf("invalid time of day %q", clock)
+		}
+	}
+	return nil
+}
+
+// Allows checks a time is in the schedule. Days and times are read off t's
+// own clock, so it should be in the hotel's time zone.
+func (s *AccessSchedule) Allows(t time.Time) bool {
+	if s == nil {
+		return true
+	}
+
+	if len(s.Days) > 0 {
+		dayOk := false
+		for _, day := range s.Days {
+			if time.Weekday(day) == t.Weekday() {
+				dayOk = true
+				break
+			}
+		}
+		if !dayOk {
+			return false
+		}
+	}
+
+	if s.From == "" && s.To == "" {
+		return true
+	}
+	from, isOk := minuteOfDay(s.From)
+	if !isOk {
+		from = 0
+	}
+	to, isOk := minuteOfDay(s.To)
+	if !isOk {
+		to = 24 * 60
+	}
+
+	minute := t.Hour()*60 + t.Minute()
+	if from <= to {
+		return minute >= from && minute < to
+	}
+	return minute >= from || minute < to
+}
+
+// Matches checks the grant applies to a booking, ignoring its schedule.
+func (g *ZoneGrant) Matches(bookingType string, roomCategory string) bool {
+	if g.BookingType != "" && g.BookingType != bookingType {
+		return false
+	}
+	if g.RoomCategory != "" && g.RoomCategory != roomCategory {
+		return false
+	}
+	return true
+}
+
+func (g *ZoneGrant) Permits(bookingType string, roomCategory string, t time.Time) bool {
+	if !g.Matches(bookingType, roomCategory) {
+		return false
+	}
+	return g.Schedule.Allows(t)
+}
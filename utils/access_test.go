@@ -0,0 +1,102 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAccessSchedule(t *testing.T) {
+	// 2018-06-04 was a Monday
+	monday := func(hour, minute int) time.Time {
+		return time.Date(2018, time.June, 4, hour, minute, 0, 0, time.UTC)
+	}
+
+	type testCase struct {
+		schedule *AccessSchedule
+		time     time.Time
+		output   bool
+	}
+	testMap := []*testCase{
+		{nil, monday(3, 0), true},
+		{&AccessSchedule{}, monday(3, 0), true},
+		{&AccessSchedule{From: "07:00", To: "22:00"}, monday(6, 59), false},
+		{&AccessSchedule{From: "07:00", To: "22:00"}, monday(7, 0), true},
+		{&AccessSchedule{From: "07:00", To: "22:00"}, monday(22, 0), false},
+		{&AccessSchedule{From: "22:00", To: "06:00"}, monday(23, 30), true},
+		{&AccessSchedule{From: "22:00", To: "06:00"}, monday(5, 59), true},
+		{&AccessSchedule{From: "22:00", To: "06:00"}, monday(12, 0), false},
+		{&AccessSchedule{From: "07:00"}, monday(23, 59), true},
+		{&AccessSchedule{Days: []int{int(time.Monday)}}, monday(12, 0), true},
+		{&AccessSchedule{Days: []int{int(time.Saturday), int(time.Sunday)}}, monday(12, 0), false},
+	}
+	for _, test := range testMap {
+		output := test.schedule.Allows(test.time)
+		if output != test.output {
+			t.Errorf("%+v.Allows(%v) expected %t, got %t", test.schedule, test.time, test.output, output)
+		}
+	}
+}
+
+func TestCheckAccessSchedule(t *testing.T) {
+	valid := []*AccessSchedule{
+		nil,
+		{},
+		{Days: []int{0, 6}, From: "22:00", To: "06:00"},
+		{To: "23:59"},
+	}
+	for _, schedule := range valid {
+		if err := CheckAccessSchedule(schedule); err != nil {
+			t.Errorf("%+v: unexpected error %v", schedule, err)
+		}
+	}
+
+	invalid := []*AccessSchedule{
+		{Days: []int{7}},
+		{Days: []int{-1}},
+		{From: "7am"},
+		{From: "07:00", To: "24:00"},
+	}
+	for _, schedule := range invalid {
+		if err := CheckAccessSchedule(schedule); err == nil {
+			t.Errorf("%+v: expected an error", schedule)
+		}
+	}
+}
+
+func TestZoneGrantPermits(t *testing.T) {
+	now := time.Date(2018, time.June, 4, 12, 0, 0, 0, time.UTC)
+
+	grant := &ZoneGrant{}
+	if !grant.Permits("standard", "double", now) {
+		t.Errorf("Empty grant should permit any booking")
+	}
+
+	grant = &ZoneGrant{BookingType: "spa"}
+	if grant.Permits("standard", "double", now) {
+		t.Errorf("Grant for spa bookings permitted a standard booking")
+	}
+	if !grant.Permits("spa", "double", now) {
+		t.Errorf("Grant for spa bookings did not permit a spa booking")
+	}
+
+	grant = &ZoneGrant{RoomCategory: "suite", Schedule: &AccessSchedule{From: "13:00", To: "14:00"}}
+	if grant.Permits("standard", "suite", now) {
+		t.Errorf("Grant permitted access outside of its schedule")
+	}
+	if grant.Permits("standard", "double", now.Add(time.Hour)) {
+		t.Errorf("Grant for suites permitted a double room")
+	}
+	if !grant.Permits("standard", "suite", now.Add(time.Hour)) {
+		t.Errorf("Grant for suites did not permit a suite within its schedule")
+	}
+}
+
+func TestZoneGrantMatches(t *testing.T) {
+	grant := &ZoneGrant{RoomCategory: "suite", Schedule: &AccessSchedule{From: "13:00", To: "14:00"}}
+	if !grant.Matches("standard", "suite") {
+		t.Errorf("Grant for suites did not match a suite booking")
+	}
+	if grant.Matches("standard", "double") {
+		t.Errorf("Grant for suites matched a double room")
+	}
+}
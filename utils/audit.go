@@ -0,0 +1,42 @@
+package utils
+
+import (
+	"time"
+)
+
+// AuditSchema holds the Dgraph schema for audit entries, for services that
+// write them to include in their own schema.
+const AuditSchema = `
+			audit.action: string @index(exact) .
+			audit.user: uid @reverse .
+			audit.subject: uid @reverse .
+			audit.time: dateTime @index(hour) .
+			audit.detail: string .
+`
+
+type UIDRef struct {
+	ID string `json:"uid"`
+}
+
+type AuditEntry struct {
+	Action  string    `json:"audit.action"`
+	User    *UIDRef   `json:"audit.user,omitempty"`
+	Subject *UIDRef   `json:"audit.subject,omitempty"`
+	Time    time.Time `json:"audit.time"`
+	Detail  string    `json:"audit.detail,omitempty"`
+}
+
+func NewAuditEntry(action string, userId string, subjectId string, detail string) *AuditEntry {
+	entry := &AuditEntry{
+		Action: action,
+		Time:   now(),
+		Detail: detail,
+	}
+	if userId != "" {
+		entry.User = &UIDRef{ID: userId}
+	}
+	if subjectId != "" {
+		entry.Subject = &UIDRef{ID: subjectId}
+	}
+	return entry
+}
@@ -0,0 +1,45 @@
+package utils
+
+import "net/http"
+
+// Error codes the services put in the code field of their responses, and
+// the gateway passes on in the extensions of GraphQL errors, so apps can
+// tell failures apart without matching on messages.
+const (
+	CodeUnauthenticated     = "UNAUTHENTICATED"
+	CodeForbidden           = "FORBIDDEN"
+	CodeNotFound            = "NOT_FOUND"
+	CodeBadRequest          = "BAD_REQUEST"
+	CodeConflict            = "CONFLICT"
+	CodeAccountDisabled     = "ACCOUNT_DISABLED"
+	CodePasswordReset       = "PASSWORD_RESET_REQUIRED"
+	CodeBookingNotActive    = "BOOKING_NOT_ACTIVE"
+	CodeHotelOffline        = "HOTEL_OFFLINE"
+	CodeHotelLockdown       = "HOTEL_LOCKDOWN"
+	CodeRoomOutOfService    = "ROOM_OUT_OF_SERVICE"
+	CodeMinStay             = "MIN_STAY_NOT_MET"
+	CodePaymentFailed       = "PAYMENT_FAILED"
+	CodeUpstreamUnavailable = "UPSTREAM_UNAVAILABLE"
+	CodeInternal            = "INTERNAL"
+)
+
+// StatusCode is the code to use for an error response that doesn't set one.
+func StatusCode(status int) string {
+	switch {
+	case status == http.StatusUnauthorized:
+		return CodeUnauthenticated
+	case status == http.StatusForbidden:
+		return CodeForbidden
+	case status == http.StatusNotFound:
+		return CodeNotFound
+	case status == http.StatusConflict:
+		return CodeConflict
+	case status == http.StatusBadGateway, status == http.StatusServiceUnavailable, status == http.StatusGatewayTimeout:
+		return CodeUpstreamUnavailable
+	case status >= 500:
+		return CodeInternal
+	case status >= 400:
+		return CodeBadRequest
+	}
+	return ""
+}
@@ -0,0 +1,24 @@
+package utils
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestStatusCode(t *testing.T) {
+	cases := map[int]string{
+		http.StatusOK:                  "",
+		http.StatusBadRequest:          CodeBadRequest,
+		http.StatusUnauthorized:        CodeUnauthenticated,
+		http.StatusForbidden:           CodeForbidden,
+		http.StatusNotFound:            CodeNotFound,
+		http.StatusConflict:            CodeConflict,
+		http.StatusInternalServerError: CodeInternal,
+		http.StatusServiceUnavailable:  CodeUpstreamUnavailable,
+	}
+	for status, code := range cases {
+		if StatusCode(status) != code {
+			t.Errorf("Expected %s for %d, got %s", code, status, StatusCode(status))
+		}
+	}
+}
@@ -1,6 +1,8 @@
 package utils
 
 import (
+	"net/http"
+	"strings"
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
@@ -10,10 +12,11 @@ import (
 var now = time.Now
 
 type User struct {
-	ID    string `json:"uid"`
-	Email string `json:"email"`
-	Pass  string `json:"pass,omitempty"`
-	Name  string `json:"name"`
+	ID    string   `json:"uid"`
+	Email string   `json:"email"`
+	Pass  string   `json:"pass,omitempty"`
+	Name  string   `json:"name"`
+	Roles []string `json:"roles,omitempty"`
 }
 
 type MQTTUser struct {
@@ -51,6 +54,12 @@ func NewJWT(user *User, secret []byte) (string, error) {
 	return s, nil
 }
 
+// NewServiceJWT signs a token for a service to call another as itself
+// rather than on behalf of a user.
+func NewServiceJWT(service string, secret []byte) (string, error) {
+	return NewJWT(&User{Name: service, Roles: []string{RoleService}}, secret)
+}
+
 func NewHotelJWT(user *MQTTUser, secret []byte) (string, error) {
 	claims := MQTTJWTClaims{
 		User: user,
@@ -98,3 +107,14 @@ func VerifyMQTTJWT(tokenString string, secret []byte) (*MQTTJWTClaims, error) {
 		return nil, errors.New("invalid jwt data")
 	}
 }
+
+func GetRequestJWT(r *http.Request, secret []byte) (*JWTClaims, error) {
+	authHeaders, isOk := r.Header["Authorization"]
+	if isOk {
+		if len(authHeaders) > 0 {
+			jwt := strings.TrimPrefix(authHeaders[0], "Bearer ")
+			return VerifyJWT(jwt, secret)
+		}
+	}
+	return nil, errors.New("no auth header")
+}
@@ -1,6 +1,8 @@
 package utils
 
 import (
+	"fmt"
+	"net/http/httptest"
 	"testing"
 	"time"
 
@@ -44,3 +46,48 @@ func TestJWT(t *testing.T) {
 	jwt.TimeFunc = time.Now
 	now = time.Now
 }
+
+func TestNewServiceJWT(t *testing.T) {
+	token, err := NewServiceJWT("bookings", JWTSecret)
+	if err != nil {
+		t.Fatalf("Got error whilst making JWT: %v", err)
+	}
+
+	claims, err := VerifyJWT(token, JWTSecret)
+	if err != nil {
+		t.Fatalf("Got error verifying JWT: %v", err)
+	}
+	if claims.User.Name != "bookings" || !claims.User.HasRole(RoleService) {
+		t.Errorf("Expected a service token for bookings, got %+v", claims.User)
+	}
+	if claims.User.HasRole(RoleAdmin, RoleSecurity, RoleSupport, RoleFrontDesk, RoleHousekeeping) {
+		t.Errorf("Service token has a staff role: %v", claims.User.Roles)
+	}
+}
+
+func TestGetRequestJWT(t *testing.T) {
+	user := &User{
+		Name:  "Bob",
+		Roles: []string{RoleAdmin},
+	}
+
+	token, err := NewJWT(user, JWTSecret)
+	if err != nil {
+		t.Fatalf("Got error whilst making JWT: %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "http://a/", nil)
+	_, err = GetRequestJWT(req, JWTSecret)
+	if err == nil {
+		t.Errorf("Did not get error without auth header")
+	}
+
+	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", token))
+	claims, err := GetRequestJWT(req, JWTSecret)
+	if err != nil {
+		t.Fatalf("Got error getting JWT from request: %v", err)
+	}
+	if !claims.User.HasRole(RoleAdmin) {
+		t.Errorf("Roles not kept in JWT, got %v", claims.User.Roles)
+	}
+}
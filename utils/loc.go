@@ -1,6 +1,58 @@
 package utils
 
+import (
+	"math"
+
+	"github.com/pkg/errors"
+)
+
+const earthRadiusKm = 6371.0
+
+// Location is a GeoJSON point, as Dgraph stores geo predicates. Coords are
+// longitude then latitude.
 type Location struct {
 	Type   string    `json:"type,omitempty"`
 	Coords []float64 `json:"coordinates,omitempty"`
 }
+
+// NewPoint makes a GeoJSON point from a latitude and longitude.
+func NewPoint(lat float64, lng float64) *Location {
+	return &Location{
+		Type:   "Point",
+		Coords: []float64{lng, lat},
+	}
+}
+
+// CheckLatLng makes sure a latitude and longitude are on the globe.
+func CheckLatLng(lat float64, lng float64) error {
+	if math.IsNaN(lat) || lat < -90 || lat > 90 {
+		return errors.Errorf("invalid latitude %v", lat)
+	}
+	if math.IsNaN(lng) || lng < -180 || lng > 180 {
+		return errors.Errorf("invalid longitude %v", lng)
+	}
+	return nil
+}
+
+// LatLng gets the latitude and longitude of a point, which isn't there for
+// hotels without a location or for other shapes.
+func (l *Location) LatLng() (float64, float64, bool) {
+	if l == nil || l.Type != "Point" || len(l.Coords) != 2 {
+		return 0, 0, false
+	}
+	return l.Coords[1], l.Coords[0], true
+}
+
+func toRadians(deg float64) float64 {
+	return deg * math.Pi / 180
+}
+
+// DistanceKm is the great circle distance between two latitudes and
+// longitudes.
+func DistanceKm(lat1 float64, lng1 float64, lat2 float64, lng2 float64) float64 {
+	dLat := toRadians(lat2 - lat1)
+	dLng := toRadians(lng2 - lng1)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(toRadians(lat1))*math.Cos(toRadians(lat2))*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * earthRadiusKm * math.Asin(math.Min(1, math.Sqrt(a)))
+}
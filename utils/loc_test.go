@@ -0,0 +1,41 @@
+package utils
+
+import (
+	"math"
+	"testing"
+)
+
+func TestNewPoint(t *testing.T) {
+	lat, lng, isOk := NewPoint(51.5, -0.12).LatLng()
+	if !isOk || lat != 51.5 || lng != -0.12 {
+		t.Errorf("Point was %v, %v, %v", lat, lng, isOk)
+	}
+
+	var missing *Location
+	if _, _, isOk := missing.LatLng(); isOk {
+		t.Errorf("Missing location had a latitude and longitude")
+	}
+}
+
+func TestCheckLatLng(t *testing.T) {
+	if err := CheckLatLng(51.5, -0.12); err != nil {
+		t.Errorf("Valid point was rejected: %v", err)
+	}
+	if err := CheckLatLng(91, 0); err == nil {
+		t.Errorf("Latitude over 90 was accepted")
+	}
+	if err := CheckLatLng(0, -181); err == nil {
+		t.Errorf("Longitude under -180 was accepted")
+	}
+}
+
+func TestDistanceKm(t *testing.T) {
+	// London to Paris
+	d := DistanceKm(51.5074, -0.1278, 48.8566, 2.3522)
+	if math.Abs(d-343.5) > 1 {
+		t.Errorf("Expected about 343.5km, got %v", d)
+	}
+	if d := DistanceKm(10, 10, 10, 10); d != 0 {
+		t.Errorf("Expected no distance to the same point, got %v", d)
+	}
+}
@@ -0,0 +1,127 @@
+package utils
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultPageSize is how many items a connection returns when the
+	// client doesn't say.
+	DefaultPageSize = 20
+	// MaxPageSize limits how many items can be fetched in one page.
+	MaxPageSize = 100
+)
+
+const cursorPrefix = "cursor:"
+
+// A Page is a slice of a list endpoint, taken from the first and after query
+// parameters. Items come back in uid order, so the cursor of an item is just
+// its uid and Dgraph can page through them with first and after. A zero
+// First means no limit, which is what callers get when they don't ask for a
+// page.
+type Page struct {
+	First int
+	After string
+}
+
+// PageInfo says whether there is more to fetch after a page, and the cursor
+// to fetch it with.
+type PageInfo struct {
+	HasNextPage bool   `json:"hasNextPage"`
+	EndCursor   string `json:"endCursor,omitempty"`
+}
+
+// EncodeCursor turns a uid into an opaque cursor.
+func EncodeCursor(uid string) string {
+	return base64.URLEncoding.EncodeToString([]byte(cursorPrefix + uid))
+}
+
+// DecodeCursor gets the uid back out of a cursor. The uid is checked so it
+// can be put straight into a query.
+func DecodeCursor(cursor string) (string, error) {
+	raw, err := base64.URLEncoding.DecodeString(cursor)
+	if err != nil {
+		return "", errors.Errorf("invalid cursor %q", cursor)
+	}
+	uid := strings.TrimPrefix(string(raw), cursorPrefix)
+	if len(uid) == len(raw) || !uidRegexp.MatchString(uid) {
+		return "", errors.Errorf("invalid cursor %q", cursor)
+	}
+	return uid, nil
+}
+
+// ParsePage reads the first and after query parameters.
+func ParsePage(query url.Values) (*Page, error) {
+	page := &Page{}
+	if first := query.Get("first"); first != "" {
+		n, err := strconv.Atoi(first)
+		if err != nil || n < 1 {
+			return nil, errors.Errorf("invalid first %q", first)
+		}
+		if n > MaxPageSize {
+			return nil, errors.Errorf("at most %d items can be fetched at once", MaxPageSize)
+		}
+		page.First = n
+	}
+	if after := query.Get("after"); after != "" {
+		uid, err := DecodeCursor(after)
+		if err != nil {
+			return nil, err
+		}
+		page.After = uid
+	}
+	return page, nil
+}
+
+// Encode adds the page to the query parameters of a request.
+func (p *Page) Encode(query url.Values) {
+	if p == nil {
+		return
+	}
+	if p.First > 0 {
+		query.Set("first", strconv.Itoa(p.First))
+	}
+	if p.After != "" {
+		query.Set("after", EncodeCursor(p.After))
+	}
+}
+
+// Args are the pagination arguments for the root function of a Dgraph
+// query, to go after the function itself. One more item than was asked for
+// is fetched so Limit can tell if there's another page.
+func (p *Page) Args() string {
+	args := ""
+	if p.First > 0 {
+		args += fmt.Sprintf(", first: %d", p.First+1)
+	}
+	if p.After != "" {
+		args += ", after: " + p.After
+	}
+	return args
+}
+
+// Limit is how many of the count items fetched with Args belong in the page,
+// and whether there are more after them.
+func (p *Page) Limit(count int) (int, bool) {
+	if p.First > 0 && count > p.First {
+		return p.First, true
+	}
+	return count, false
+}
+
+// NewPageInfo describes a page ending with the item with the uid lastUID.
+func NewPageInfo(hasNext bool, lastUID string) *PageInfo {
+	info := &PageInfo{
+		HasNextPage: hasNext,
+	}
+	if lastUID != "" {
+		info.EndCursor = EncodeCursor(lastUID)
+	}
+	return info
+}
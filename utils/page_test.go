@@ -0,0 +1,68 @@
+package utils
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestCursor(t *testing.T) {
+	uid, err := DecodeCursor(EncodeCursor("0x2a"))
+	if err != nil || uid != "0x2a" {
+		t.Errorf("Cursor decoded as %q, %v", uid, err)
+	}
+
+	for _, cursor := range []string{"0x2a", "not base64!", EncodeCursor("0x1) { name }")} {
+		_, err = DecodeCursor(cursor)
+		if err == nil {
+			t.Errorf("Invalid cursor %q was accepted", cursor)
+		}
+	}
+}
+
+func TestParsePage(t *testing.T) {
+	page, err := ParsePage(url.Values{})
+	if err != nil || page.First != 0 || page.After != "" {
+		t.Errorf("Empty page parsed as %+v, %v", page, err)
+	}
+	if page.Args() != "" {
+		t.Errorf("Empty page had args %q", page.Args())
+	}
+
+	query := url.Values{}
+	(&Page{First: 5, After: "0x10"}).Encode(query)
+	page, err = ParsePage(query)
+	if err != nil {
+		t.Fatalf("Error parsing page: %v", err)
+	}
+	if page.First != 5 || page.After != "0x10" {
+		t.Errorf("Page parsed as %+v", page)
+	}
+	if page.Args() != ", first: 6, after: 0x10" {
+		t.Errorf("Page args were %q", page.Args())
+	}
+
+	for _, first := range []string{"0", "-1", "abc", "101"} {
+		_, err = ParsePage(url.Values{"first": {first}})
+		if err == nil {
+			t.Errorf("Invalid first %q was accepted", first)
+		}
+	}
+}
+
+func TestPageLimit(t *testing.T) {
+	page := &Page{First: 2}
+	if n, more := page.Limit(3); n != 2 || !more {
+		t.Errorf("Limit(3) was %d, %v", n, more)
+	}
+	if n, more := page.Limit(2); n != 2 || more {
+		t.Errorf("Limit(2) was %d, %v", n, more)
+	}
+	if n, more := (&Page{}).Limit(50); n != 50 || more {
+		t.Errorf("Unlimited page Limit(50) was %d, %v", n, more)
+	}
+
+	info := NewPageInfo(false, "")
+	if info.HasNextPage || info.EndCursor != "" {
+		t.Errorf("Empty page info was %+v", info)
+	}
+}
@@ -0,0 +1,21 @@
+package utils
+
+import (
+	"sort"
+	"strings"
+)
+
+// QueryHeader starts a Dgraph query taking variables, all of which are
+// declared as strings as that's how they're passed anyway. Queries built up
+// from optional filters can use it to only declare the variables they use.
+func QueryHeader(variables map[string]string) string {
+	if len(variables) == 0 {
+		return "query"
+	}
+	var decls []string
+	for name := range variables {
+		decls = append(decls, name+": string")
+	}
+	sort.Strings(decls)
+	return "query q(" + strings.Join(decls, ", ") + ")"
+}
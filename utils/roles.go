@@ -0,0 +1,26 @@
+package utils
+
+const (
+	RoleAdmin        = "admin"
+	RoleSecurity     = "security"
+	RoleSupport      = "support"
+	RoleFrontDesk    = "frontdesk"
+	RoleHousekeeping = "housekeeping"
+	// RoleService is held by the tokens services sign to call each other,
+	// rather than by any user.
+	RoleService = "service"
+)
+
+func (u *User) HasRole(roles ...string) bool {
+	if u == nil {
+		return false
+	}
+	for _, have := range u.Roles {
+		for _, want := range roles {
+			if have == want {
+				return true
+			}
+		}
+	}
+	return false
+}
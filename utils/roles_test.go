@@ -0,0 +1,23 @@
+package utils
+
+import "testing"
+
+func TestHasRole(t *testing.T) {
+	var nilUser *User
+	if nilUser.HasRole(RoleAdmin) {
+		t.Errorf("nil user has admin role")
+	}
+
+	user := &User{}
+	if user.HasRole(RoleAdmin) {
+		t.Errorf("User without roles has admin role")
+	}
+
+	user.Roles = []string{RoleSecurity}
+	if user.HasRole(RoleAdmin) {
+		t.Errorf("Security user has admin role")
+	}
+	if !user.HasRole(RoleAdmin, RoleSecurity) {
+		t.Errorf("Security user does not have one of admin or security roles")
+	}
+}
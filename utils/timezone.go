@@ -0,0 +1,48 @@
+package utils
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// CheckTimeZone makes sure a time zone is an IANA name, like Europe/London,
+// that can be loaded. The machine's own Local zone isn't allowed.
+func CheckTimeZone(name string) error {
+	if name == "" || name == "Local" {
+		return errors.Errorf("invalid time zone %q", name)
+	}
+	_, err := time.LoadLocation(name)
+	if err != nil {
+		return errors.Errorf("invalid time zone %q", name)
+	}
+	return nil
+}
+
+// LoadTimeZone gets a time zone by its IANA name. Hotels set up before they
+// had a time zone, or with one that can't be loaded, are taken to be on UTC.
+func LoadTimeZone(name string) *time.Location {
+	if name == "" || name == "Local" {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// ClockTime drops a time's zone, keeping the time its clock shows but in UTC.
+// Times of day, like a hotel's check-in, are stored this way so they mean the
+// same clock time wherever the hotel is.
+func ClockTime(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.UTC)
+}
+
+// ClockOn gives the time a stored time of day falls at on the date day shows
+// in its own zone.
+func ClockOn(day time.Time, clock time.Time) time.Time {
+	clock = clock.UTC()
+	return time.Date(day.Year(), day.Month(), day.Day(),
+		clock.Hour(), clock.Minute(), clock.Second(), 0, day.Location())
+}
@@ -0,0 +1,66 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCheckTimeZone(t *testing.T) {
+	for _, name := range []string{"UTC", "Europe/London", "America/New_York"} {
+		if err := CheckTimeZone(name); err != nil {
+			t.Errorf("Valid time zone %q was rejected: %v", name, err)
+		}
+	}
+	for _, name := range []string{"", "Local", "Europe/Nowhere", "+01:00"} {
+		if err := CheckTimeZone(name); err == nil {
+			t.Errorf("Invalid time zone %q was accepted", name)
+		}
+	}
+}
+
+func TestLoadTimeZone(t *testing.T) {
+	if loc := LoadTimeZone("Europe/London"); loc.String() != "Europe/London" {
+		t.Errorf("Expected Europe/London, got %v", loc)
+	}
+	for _, name := range []string{"", "Local", "Europe/Nowhere"} {
+		if loc := LoadTimeZone(name); loc != time.UTC {
+			t.Errorf("Expected %q to fall back to UTC, got %v", name, loc)
+		}
+	}
+}
+
+func TestClockTime(t *testing.T) {
+	paris := time.FixedZone("CET", 3600)
+	clock := ClockTime(time.Date(2030, 1, 1, 15, 30, 0, 0, paris))
+	expected := time.Date(2030, 1, 1, 15, 30, 0, 0, time.UTC)
+	if !clock.Equal(expected) {
+		t.Errorf("Expected %v, got %v", expected, clock)
+	}
+}
+
+func TestClockOn(t *testing.T) {
+	london := LoadTimeZone("Europe/London")
+	newYork := LoadTimeZone("America/New_York")
+	checkIn := time.Date(0, 1, 1, 15, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		day      time.Time
+		clock    time.Time
+		expected time.Time
+	}{
+		{time.Date(2030, 1, 1, 10, 0, 0, 0, time.UTC), checkIn,
+			time.Date(2030, 1, 1, 15, 0, 0, 0, time.UTC)},
+		// British Summer Time
+		{time.Date(2030, 7, 1, 10, 0, 0, 0, time.UTC).In(london), checkIn,
+			time.Date(2030, 7, 1, 14, 0, 0, 0, time.UTC)},
+		// Still the evening before in New York
+		{time.Date(2030, 1, 2, 2, 0, 0, 0, time.UTC).In(newYork), checkIn,
+			time.Date(2030, 1, 1, 20, 0, 0, 0, time.UTC)},
+	}
+
+	for i, test := range tests {
+		if at := ClockOn(test.day, test.clock); !at.Equal(test.expected) {
+			t.Errorf("%d: expected %v, got %v", i, test.expected, at)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package utils
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var uidRegexp = regexp.MustCompile(`^0x[0-9a-fA-F]+$`)
+
+// MaxBatchUIDs limits how many nodes a batch endpoint will fetch at once.
+const MaxBatchUIDs = 100
+
+// ParseUIDs splits a comma separated list of Dgraph uids, as taken by batch
+// endpoints, dropping duplicates. The uids are checked so they can be put
+// straight into a query.
+func ParseUIDs(s string) ([]string, error) {
+	uids := make([]string, 0)
+	seen := map[string]bool{}
+	for _, uid := range strings.Split(s, ",") {
+		uid = strings.TrimSpace(uid)
+		if uid == "" || seen[uid] {
+			continue
+		}
+		if !uidRegexp.MatchString(uid) {
+			return nil, errors.Errorf("invalid uid %q", uid)
+		}
+		seen[uid] = true
+		uids = append(uids, uid)
+	}
+	if len(uids) > MaxBatchUIDs {
+		return nil, errors.Errorf("at most %d uids can be fetched at once", MaxBatchUIDs)
+	}
+	return uids, nil
+}
+
+// IsUID checks a string is a Dgraph uid, so it can be put straight into a
+// query.
+func IsUID(s string) bool {
+	return uidRegexp.MatchString(s)
+}
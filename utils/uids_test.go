@@ -0,0 +1,50 @@
+package utils
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseUIDs(t *testing.T) {
+	uids, err := ParseUIDs("0x1, 0x2a,,0x1")
+	if err != nil {
+		t.Fatalf("Error parsing uids: %v", err)
+	}
+	if !reflect.DeepEqual(uids, []string{"0x1", "0x2a"}) {
+		t.Errorf("Parsed uids were %v", uids)
+	}
+
+	uids, err = ParseUIDs("")
+	if err != nil || len(uids) != 0 {
+		t.Errorf("Empty list parsed as %v, %v", uids, err)
+	}
+
+	_, err = ParseUIDs("0x1,0x2) { name }")
+	if err == nil {
+		t.Errorf("Invalid uid was accepted")
+	}
+
+	_, err = ParseUIDs("0x1" + strings.Repeat(",0x1", MaxBatchUIDs))
+	if err != nil {
+		t.Errorf("Duplicate uids counted towards the limit: %v", err)
+	}
+
+	many := make([]string, 0)
+	for i := 0; i <= MaxBatchUIDs; i++ {
+		many = append(many, "0x"+strings.Repeat("f", i+1))
+	}
+	_, err = ParseUIDs(strings.Join(many, ","))
+	if err == nil {
+		t.Errorf("More than %d uids were accepted", MaxBatchUIDs)
+	}
+}
+
+func TestIsUID(t *testing.T) {
+	if !IsUID("0x2a") {
+		t.Errorf("Valid uid was rejected")
+	}
+	if IsUID("0x2a) { name }") || IsUID("") {
+		t.Errorf("Invalid uid was accepted")
+	}
+}